@@ -5,7 +5,7 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
@@ -13,38 +13,61 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/passbi/passbi_core/internal/api"
 	"github.com/passbi/passbi_core/internal/cache"
+	"github.com/passbi/passbi_core/internal/config"
 	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/disruption"
+	"github.com/passbi/passbi_core/internal/errreport"
+	"github.com/passbi/passbi_core/internal/eta"
 	"github.com/passbi/passbi_core/internal/graph"
+	"github.com/passbi/passbi_core/internal/gtfs"
+	"github.com/passbi/passbi_core/internal/headway"
+	"github.com/passbi/passbi_core/internal/history"
+	"github.com/passbi/passbi_core/internal/logging"
+	"github.com/passbi/passbi_core/internal/middleware"
+	"github.com/passbi/passbi_core/internal/occupancy"
+	"github.com/passbi/passbi_core/internal/retry"
+	"github.com/passbi/passbi_core/internal/routing"
+	"github.com/passbi/passbi_core/internal/tracing"
+	"github.com/passbi/passbi_core/internal/vehicles"
 )
 
+var logger = logging.For("api")
+
 func main() {
-	log.Println("Starting PassBi API server...")
+	// Settings from the PASSBI_CONFIG file, under the environment
+	config.MustSetup("api")
 
-	// Initialize database connection
-	if _, err := db.GetDB(); err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
-	}
-	defer db.Close()
-	log.Println("✓ Database connection established")
+	logging.Setup("api")
 
-	// Initialize Redis connection
-	if _, err := cache.GetClient(); err != nil {
-		log.Fatalf("Failed to connect to Redis: %v", err)
-	}
-	defer cache.Close()
-	log.Println("✓ Redis connection established")
+	// Error reporting (enabled when SENTRY_DSN is set)
+	errreport.Init("api")
+	defer errreport.Flush(5 * time.Second)
+	logger.Info("Starting PassBi API server")
+
+	// OpenTelemetry tracing (enabled when OTEL_EXPORTER_OTLP_ENDPOINT is set)
+	tracing.Init(tracing.LoadConfigFromEnv("passbi-api"))
+	defer tracing.Close()
 
-	// Load routing graph into memory
-	pool, _ := db.GetDB()
-	g := graph.GetGraph()
-	if err := g.LoadFromDB(context.Background(), pool); err != nil {
-		log.Fatalf("Failed to load routing graph: %v", err)
+	// Postgres and Redis may still be starting (deploys restart them along
+	// with the API): retry with backoff up to STARTUP_RETRY_DEADLINE
+	startupRetry := retry.StartupConfigFromEnv()
+
+	// EMBEDDED_GTFS serves route search, and nothing else, from feeds in
+	// memory without Postgres or Redis, for local development; it is not a
+	// store the importer or the other endpoints can use
+	embedded, err := db.EmbeddedConfigFromEnv()
+	if err != nil {
+		logging.Fatal(logger, "Invalid embedded mode configuration", "error", err)
+	}
+	if embedded != nil {
+		startEmbedded(embedded)
+	} else {
+		startServices(startupRetry)
 	}
-	log.Println("✓ Routing graph loaded into memory")
+	defer db.Close()
+	defer cache.Close()
 
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
@@ -53,30 +76,80 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  120 * time.Second,
 		ErrorHandler: customErrorHandler,
+
+		// Startup is logged as structured records instead of Fiber's banner
+		DisableStartupMessage: true,
 	})
 
 	// Middleware
-	app.Use(recover.New())
-	app.Use(logger.New(logger.Config{
-		Format:     "${time} | ${status} | ${latency} | ${method} ${path}\n",
-		TimeFormat: "15:04:05",
-		TimeZone:   "Local",
-	}))
+	app.Use(middleware.Recover())
+	app.Use(middleware.RequestID())
+	app.Use(middleware.Tracing())
+	app.Use(middleware.AccessLog())
+	app.Use(middleware.RequestTimeout(middleware.RequestTimeoutFromEnv()))
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowMethods: "GET,POST,OPTIONS",
-		AllowHeaders: "Origin, Content-Type, Accept",
+		AllowOrigins:  "*",
+		AllowMethods:  "GET,POST,OPTIONS",
+		AllowHeaders:  "Origin, Content-Type, Accept, If-None-Match, X-Request-ID, traceparent",
+		ExposeHeaders: "ETag, Deprecation, Sunset, Link, X-Request-ID, traceresponse",
 	}))
+	if embedded != nil {
+		app.Use(embeddedOnly)
+	}
 
 	// Routes
+	// Endpoints writing operator data, or reading operator-only data back,
+	// need a key: they are only served by the with_auth build
 	app.Get("/health", api.Health)
+	app.Get("/livez", api.Livez)
+	app.Get("/readyz", api.Readyz)
+	app.Get("/metrics", api.Metrics)
+	app.Get("/gtfs-rt/alerts", api.GTFSRTAlerts)
+	app.Post("/driver/pings", api.DeviceAuth, api.DriverPings)
+	app.Use("/v2", middleware.Deprecation(middleware.V2Deprecation()))
 	app.Get("/v2/route-search", api.RouteSearch)
 	app.Get("/v2/stops/nearby", api.StopsNearby)
 	app.Get("/v2/stops/search", api.StopsSearch)
 	app.Get("/v2/routes/list", api.RoutesList)
 	app.Get("/v2/stops/:id/departures", api.StopDepartures)
+	app.Get("/v2/stops/:id/routes", api.StopRoutes)
 	app.Get("/v2/routes/:id/schedule", api.RouteSchedule)
+	app.Get("/v2/routes/:id/schedule.ics", api.RouteScheduleICS)
 	app.Get("/v2/routes/:id/trips", api.RouteTrips)
+	app.Get("/v2/routes/:id/stops", api.RouteStops)
+	app.Get("/v2/routes/:id/frequency", api.RouteFrequency)
+	app.Get("/v2/routes/:id/vehicles", api.RouteVehicles)
+	app.Get("/v2/routes/:id/occupancy", api.RouteOccupancy)
+	app.Get("/v2/network/stats", api.NetworkStats)
+	app.Get("/v2/services", api.ActiveServices)
+	app.Get("/v2/alerts", api.ListAlerts)
+	app.Get("/v2/siri/stop-monitoring", api.SIRIStopMonitoring)
+	app.Post("/v2/itineraries", api.CreateItinerary)
+	app.Get("/v2/itineraries/:token", api.GetItinerary)
+	app.Post("/v2/feedback", api.SubmitFeedback)
+
+	// API v3: same handlers, enveloped responses and RFC 7807 errors
+	v3 := app.Group("/v3", api.V3Envelope)
+	v3.Get("/route-search", api.RouteSearch)
+	v3.Get("/stops/nearby", api.StopsNearby)
+	v3.Get("/stops/search", api.StopsSearch)
+	v3.Get("/routes", api.RoutesListV3)
+	v3.Get("/stops/:id/departures", api.StopDepartures)
+	v3.Get("/stops/:id/routes", api.StopRoutes)
+	v3.Get("/routes/:id/schedule", api.RouteSchedule)
+	v3.Get("/routes/:id/schedule.ics", api.RouteScheduleICS)
+	v3.Get("/routes/:id/trips", api.RouteTripsV3)
+	v3.Get("/routes/:id/stops", api.RouteStops)
+	v3.Get("/routes/:id/frequency", api.RouteFrequency)
+	v3.Get("/routes/:id/vehicles", api.RouteVehicles)
+	v3.Get("/routes/:id/occupancy", api.RouteOccupancy)
+	v3.Get("/network/stats", api.NetworkStats)
+	v3.Get("/services", api.ActiveServices)
+	v3.Get("/alerts", api.ListAlerts)
+	v3.Get("/siri/stop-monitoring", api.SIRIStopMonitoring)
+	v3.Post("/itineraries", api.CreateItinerary)
+	v3.Get("/itineraries/:token", api.GetItinerary)
+	v3.Post("/feedback", api.SubmitFeedback)
 
 	// 404 handler
 	app.Use(func(c *fiber.Ctx) error {
@@ -95,20 +168,136 @@ func main() {
 		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 		<-sigChan
 
-		log.Println("Shutting down gracefully...")
+		logger.Info("Shutting down gracefully")
 		if err := app.Shutdown(); err != nil {
-			log.Printf("Error during shutdown: %v", err)
+			logger.Error("Error during shutdown", "error", err)
 		}
 	}()
 
 	// Start server
-	log.Printf("🚀 Server listening on http://localhost%s", addr)
-	log.Printf("📍 Route search: http://localhost%s/v2/route-search?from=LAT,LON&to=LAT,LON", addr)
-	log.Printf("❤️  Health check: http://localhost%s/health", addr)
+	logger.Info("Server listening", "addr", addr)
 
 	if err := app.Listen(addr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+		logging.Fatal(logger, "Failed to start server", "error", err)
+	}
+}
+
+// startServices connects to Postgres and Redis, loads the routing graph and
+// starts the background jobs writing to the database
+func startServices(startupRetry retry.Config) {
+	// Initialize database connection
+	pool, err := db.Connect(context.Background(), startupRetry)
+	if err != nil {
+		logging.Fatal(logger, "Failed to connect to database", "error", err)
+	}
+	logger.Info("Database connection established")
+
+	// Initialize Redis connection; without it the API runs on the local cache
+	if _, err := cache.Connect(context.Background(), startupRetry); err != nil {
+		logger.Warn("Starting without Redis, serving from the local cache until it answers", "error", err)
+	} else {
+		logger.Info("Redis connection established")
+	}
+
+	// Load routing graph into memory in the background; /readyz reports
+	// not ready until it is in memory, /livez answers meanwhile
+	go func() {
+		err := retry.Do(context.Background(), startupRetry, "routing graph", func(ctx context.Context) error {
+			return graph.GetGraph().LoadFromDB(ctx, pool)
+		})
+		if err != nil {
+			logging.Fatal(logger, "Failed to load routing graph", "error", err)
+		}
+		logger.Info("Routing graph loaded into memory")
+		api.WarmRouteCacheAsync(pool)
+	}()
+
+	// Reload the graph when the importer or another instance rebuilds it
+	// (disabled by GRAPH_RELOAD_ON_NOTIFY=false)
+	if graph.ReloadOnNotify() {
+		go graph.ListenForReloads(context.Background(), pool, api.GraphReloaded(pool))
 	}
+
+	// Sampled route searches for tuning (enabled by ROUTING_TELEMETRY_SAMPLE)
+	go routing.RunTelemetryWriter(context.Background(), pool)
+
+	// Anonymized origin-destination cells of searches without an itinerary
+	go api.RunGapWriter(context.Background(), pool)
+
+	// Vehicle position history older than VEHICLE_POSITION_RETENTION
+	go vehicles.RunRetention(context.Background(), pool, vehicles.ConfigFromEnv())
+
+	// Segment travel times learned from those fixes, for departure predictions
+	go eta.Run(context.Background(), pool, eta.ConfigFromEnv())
+
+	// Delays detected from the same fixes, propagated to downstream stops
+	go eta.RunDelays(context.Background(), pool, eta.ConfigFromEnv())
+
+	// Typical crowding by route and time of day, from occupancy reports
+	go occupancy.Run(context.Background(), pool, occupancy.ConfigFromEnv())
+
+	// Headways between vehicles of a route, alerting riders of bunching and gaps
+	go headway.Run(context.Background(), pool, headway.ConfigFromEnv())
+
+	// Provisional alerts for routes at a standstill or mostly cancelled
+	go disruption.Run(context.Background(), pool, disruption.ConfigFromEnv())
+
+	// Downsampled archive of each day's fixes, kept past their retention
+	go history.Run(context.Background(), pool, history.ConfigFromEnv())
+}
+
+// embeddedPaths are the endpoints served in embedded mode: those answered
+// from the in-memory graph alone
+var embeddedPaths = map[string]bool{
+	"/livez":           true,
+	"/readyz":          true,
+	"/metrics":         true,
+	"/v2/route-search": true,
+	"/v3/route-search": true,
+}
+
+// loadEmbeddedGraph parses the feeds of EMBEDDED_GTFS, cleans them like the
+// importer (without the stop deduplication, which needs PostGIS) and builds
+// the graph from them
+func loadEmbeddedGraph(ctx context.Context, config *db.EmbeddedConfig) error {
+	feeds := make(map[string]*gtfs.GTFSFeed, len(config.Feeds))
+	for _, agencyID := range config.Agencies() {
+		path := config.Feeds[agencyID]
+		feed, err := gtfs.ParseGTFSZip(path)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s (%s): %w", agencyID, path, err)
+		}
+		feed.Stops = gtfs.ValidateAndCleanStops(feed.Stops)
+		feeds[agencyID] = feed
+		logger.Info("Parsed embedded feed", "agency_id", agencyID, "path", path,
+			"stops", len(feed.Stops), "trips", len(feed.Trips))
+	}
+	return graph.GetGraph().LoadFromFeeds(ctx, feeds)
+}
+
+// startEmbedded switches the API to embedded mode and builds the graph in
+// the background; /readyz reports not ready until it is in memory
+func startEmbedded(config *db.EmbeddedConfig) {
+	db.UseEmbedded()
+	logger.Warn("Running in embedded mode: no database or Redis, only route search is served",
+		"agencies", config.Agencies())
+
+	go func() {
+		if err := loadEmbeddedGraph(context.Background(), config); err != nil {
+			logging.Fatal(logger, "Failed to build the embedded routing graph", "error", err)
+		}
+		logger.Info("Routing graph built from GTFS feeds")
+	}()
+}
+
+// embeddedOnly answers 503 for the endpoints that need the database
+func embeddedOnly(c *fiber.Ctx) error {
+	if embeddedPaths[c.Path()] {
+		return c.Next()
+	}
+	return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+		"error": "endpoint not available in embedded mode, which only serves route search",
+	})
 }
 
 // customErrorHandler handles errors returned from handlers
@@ -119,10 +308,20 @@ func customErrorHandler(c *fiber.Ctx, err error) error {
 		code = e.Code
 	}
 
-	log.Printf("Error: %v", err)
+	requestID := middleware.GetRequestID(c)
+
+	// Recovered panics are logged (and reported) with their stack already
+	if !middleware.Panicked(c) {
+		level := slog.LevelError
+		if code < 500 {
+			level = slog.LevelWarn
+		}
+		logger.Log(c.Context(), level, "Request failed", "method", c.Method(), "path", c.Path(), "status", code, "error", err)
+	}
 
 	return c.Status(code).JSON(fiber.Map{
-		"error": err.Error(),
+		"error":      err.Error(),
+		"request_id": requestID,
 	})
 }
 
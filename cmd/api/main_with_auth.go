@@ -5,7 +5,7 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"strconv"
@@ -14,47 +14,138 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/passbi/passbi_core/internal/anomaly"
 	"github.com/passbi/passbi_core/internal/api"
 	"github.com/passbi/passbi_core/internal/cache"
+	"github.com/passbi/passbi_core/internal/config"
 	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/disruption"
+	"github.com/passbi/passbi_core/internal/errreport"
+	"github.com/passbi/passbi_core/internal/eta"
 	"github.com/passbi/passbi_core/internal/graph"
+	"github.com/passbi/passbi_core/internal/headway"
+	"github.com/passbi/passbi_core/internal/history"
+	"github.com/passbi/passbi_core/internal/jobs"
+	"github.com/passbi/passbi_core/internal/logging"
 	"github.com/passbi/passbi_core/internal/middleware"
+	"github.com/passbi/passbi_core/internal/mqtt"
+	"github.com/passbi/passbi_core/internal/notify"
+	"github.com/passbi/passbi_core/internal/occupancy"
+	"github.com/passbi/passbi_core/internal/retry"
+	"github.com/passbi/passbi_core/internal/routing"
+	"github.com/passbi/passbi_core/internal/tracing"
+	"github.com/passbi/passbi_core/internal/vehicles"
 )
 
+var logger = logging.For("api")
+
 func main() {
-	log.Println("Starting PassBi API server...")
+	// Settings from the PASSBI_CONFIG file, under the environment
+	config.MustSetup("api")
+
+	logging.Setup("api")
+
+	// Error reporting (enabled when SENTRY_DSN is set)
+	errreport.Init("api")
+	defer errreport.Flush(5 * time.Second)
+	logger.Info("Starting PassBi API server")
+
+	// OpenTelemetry tracing (enabled when OTEL_EXPORTER_OTLP_ENDPOINT is set)
+	tracing.Init(tracing.LoadConfigFromEnv("passbi-api"))
+	defer tracing.Close()
+
+	// Postgres and Redis may still be starting (deploys restart them along
+	// with the API): retry with backoff up to STARTUP_RETRY_DEADLINE
+	startupRetry := retry.StartupConfigFromEnv()
 
 	// Initialize database connection
-	pool, err := db.GetDB()
+	pool, err := db.Connect(context.Background(), startupRetry)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		logging.Fatal(logger, "Failed to connect to database", "error", err)
 	}
 	defer db.Close()
-	log.Println("✓ Database connection established")
+	logger.Info("Database connection established")
 
-	// Initialize Redis connection
-	rdb, err := cache.GetClient()
+	// Initialize Redis connection; without it the API runs degraded: the
+	// local cache serves, rate limits are not enforced and idempotency keys
+	// are not checked until Redis answers
+	rdb, err := cache.Connect(context.Background(), startupRetry)
 	if err != nil {
-		log.Fatalf("Failed to connect to Redis: %v", err)
+		logger.Warn("Starting without Redis, running degraded until it answers", "error", err)
+	} else {
+		logger.Info("Redis connection established")
 	}
 	defer cache.Close()
-	log.Println("✓ Redis connection established")
 
-	// Load routing graph into memory
-	g := graph.GetGraph()
-	if err := g.LoadFromDB(context.Background(), pool); err != nil {
-		log.Fatalf("Failed to load routing graph: %v", err)
+	// Optional MQTT publishing of alerts (enabled when MQTT_BROKER_URL is set)
+	mqtt.GetPublisher()
+	defer mqtt.Close()
+
+	// Load routing graph into memory in the background; /readyz reports
+	// not ready until it is in memory, /livez answers meanwhile
+	go func() {
+		err := retry.Do(context.Background(), startupRetry, "routing graph", func(ctx context.Context) error {
+			return graph.GetGraph().LoadFromDB(ctx, pool)
+		})
+		if err != nil {
+			logging.Fatal(logger, "Failed to load routing graph", "error", err)
+		}
+		logger.Info("Routing graph loaded into memory")
+		api.WarmRouteCacheAsync(pool)
+	}()
+
+	// Reload the graph when the importer or another instance rebuilds it
+	// (disabled by GRAPH_RELOAD_ON_NOTIFY=false)
+	if graph.ReloadOnNotify() {
+		go graph.ListenForReloads(context.Background(), pool, api.GraphReloaded(pool))
+	}
+
+	// Sampled route searches for tuning (enabled by ROUTING_TELEMETRY_SAMPLE)
+	go routing.RunTelemetryWriter(context.Background(), pool)
+
+	// Anonymized origin-destination cells of searches without an itinerary
+	go api.RunGapWriter(context.Background(), pool)
+
+	// Vehicle position history older than VEHICLE_POSITION_RETENTION
+	go vehicles.RunRetention(context.Background(), pool, vehicles.ConfigFromEnv())
+
+	// Segment travel times learned from those fixes, for departure predictions
+	go eta.Run(context.Background(), pool, eta.ConfigFromEnv())
+
+	// Delays detected from the same fixes, propagated to downstream stops
+	go eta.RunDelays(context.Background(), pool, eta.ConfigFromEnv())
+
+	// Typical crowding by route and time of day, from occupancy reports
+	go occupancy.Run(context.Background(), pool, occupancy.ConfigFromEnv())
+
+	// Headways between vehicles of a route, alerting riders of bunching and gaps
+	go headway.Run(context.Background(), pool, headway.ConfigFromEnv())
+
+	// Provisional alerts for routes at a standstill or mostly cancelled
+	go disruption.Run(context.Background(), pool, disruption.ConfigFromEnv())
+
+	// Downsampled archive of each day's fixes, kept past their retention
+	go history.Run(context.Background(), pool, history.ConfigFromEnv())
+
+	// Admin jobs do not survive a restart; record them as failed
+	if n, err := jobs.FailInterrupted(context.Background(), pool); err != nil {
+		logger.Warn("Failed to clean up interrupted jobs", "error", err)
+	} else if n > 0 {
+		logger.Info("Marked interrupted admin jobs as failed", "jobs", n)
 	}
-	log.Println("✓ Routing graph loaded into memory")
 
 	// Check if authentication is enabled
 	enableAuth := getEnvBool("ENABLE_AUTH", true)
 	enableRateLimit := getEnvBool("ENABLE_RATE_LIMIT", true)
 	enableAnalytics := getEnvBool("ENABLE_ANALYTICS", true)
 
-	log.Printf("Configuration: Auth=%v, RateLimit=%v, Analytics=%v", enableAuth, enableRateLimit, enableAnalytics)
+	logger.Info("Configuration", "auth", enableAuth, "rate_limit", enableRateLimit, "analytics", enableAnalytics)
+
+	// Remind partners of API keys about to expire (hourly check)
+	if enableAuth && getEnvBool("KEY_EXPIRY_REMINDERS", true) {
+		go notify.RunKeyExpiryReminders(context.Background(), pool, time.Hour)
+		logger.Info("API key expiry reminders enabled")
+	}
 
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
@@ -62,20 +153,24 @@ func main() {
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  120 * time.Second,
+		BodyLimit:    64 * 1024 * 1024, // GTFS uploads on /admin/imports
 		ErrorHandler: customErrorHandler,
+
+		// Startup is logged as structured records instead of Fiber's banner
+		DisableStartupMessage: true,
 	})
 
 	// Global middleware
-	app.Use(recover.New())
-	app.Use(logger.New(logger.Config{
-		Format:     "${time} | ${status} | ${latency} | ${method} ${path} | ${ip}\n",
-		TimeFormat: "15:04:05",
-		TimeZone:   "Local",
-	}))
+	app.Use(middleware.Recover())
+	app.Use(middleware.RequestID())
+	app.Use(middleware.Tracing())
+	app.Use(middleware.AccessLog())
+	app.Use(middleware.RequestTimeout(middleware.RequestTimeoutFromEnv()))
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "*",
-		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
+		AllowMethods:     "GET,POST,PUT,PATCH,DELETE,OPTIONS",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, If-None-Match, X-User-ID, X-Request-ID, Idempotency-Key, traceparent",
+		ExposeHeaders:    "ETag, Deprecation, Sunset, Link, X-Request-ID, Idempotent-Replayed, traceresponse",
 		AllowCredentials: false,
 	}))
 
@@ -104,69 +199,266 @@ func main() {
 	})
 
 	app.Get("/health", api.Health)
+	app.Get("/livez", api.Livez)
+	app.Get("/readyz", api.Readyz)
+	app.Get("/metrics", api.Metrics)
+
+	// GTFS-Realtime feeds are public so trip planners can consume them
+	app.Get("/gtfs-rt/alerts", api.GTFSRTAlerts)
+
+	// The driver app pushes pings with a device token rather than an API key
+	app.Post("/driver/pings", api.DeviceAuth, api.DriverPings)
 
 	// ============================================
-	// API V2 - Protected Routes
+	// API V2 (deprecated) and V3 - Protected Routes
 	// ============================================
-	v2 := app.Group("/v2")
+	// Both versions share handlers; v2 announces its sunset on every
+	// response and v3 envelopes bodies and reports RFC 7807 errors
+	v2 := app.Group("/v2", middleware.Deprecation(middleware.V2Deprecation()))
+	v3 := app.Group("/v3", api.V3Envelope)
+	versions := []fiber.Router{v2, v3}
 
 	// Apply authentication middleware if enabled
 	if enableAuth {
-		v2.Use(middleware.AuthMiddleware(pool))
-		log.Println("✓ Authentication middleware enabled")
+		for _, v := range versions {
+			v.Use(middleware.AuthMiddleware(pool))
+			v.Use(middleware.RequestSigning(rdb))
+		}
+		logger.Info("Authentication middleware enabled")
 	}
 
 	// Apply rate limiting middleware if enabled
 	if enableRateLimit && enableAuth {
-		v2.Use(middleware.RateLimitMiddleware(rdb))
-		log.Println("✓ Rate limiting middleware enabled")
+		quotaNotifier := notify.NewQuotaNotifier(pool)
+		for _, v := range versions {
+			v.Use(middleware.RateLimitMiddleware(rdb, quotaNotifier.Notify))
+		}
+		logger.Info("Rate limiting middleware enabled")
 	}
 
 	// Apply analytics middleware if enabled
+	var usageWriter *middleware.UsageWriter
 	if enableAnalytics && enableAuth {
-		v2.Use(middleware.AnalyticsMiddleware(pool))
-		log.Println("✓ Analytics middleware enabled")
+		usageWriter = middleware.NewUsageWriter(pool, middleware.UsageWriterConfigFromEnv())
+		for _, v := range versions {
+			v.Use(middleware.AnalyticsMiddleware(usageWriter))
+		}
+		logger.Info("Analytics middleware enabled")
+
+		// Flag keys with abnormal traffic, from the usage the analytics log
+		if getEnvBool("ANOMALY_DETECTION", true) {
+			cfg := anomaly.ConfigFromEnv()
+			go anomaly.Run(context.Background(), pool, cfg)
+			logger.Info("Usage anomaly detection enabled", "interval", cfg.Interval.String(), "auto_suspend", cfg.AutoSuspend)
+		}
 	}
 
-	// Core API endpoints
-	v2.Get("/route-search", api.RouteSearch)
-	v2.Get("/stops/nearby", api.StopsNearby)
-	v2.Get("/stops/search", api.StopsSearch)
-	v2.Get("/routes/list", api.RoutesList)
-	v2.Get("/stops/:id/departures", api.StopDepartures)
-	v2.Get("/routes/:id/schedule", api.RouteSchedule)
-	v2.Get("/routes/:id/trips", api.RouteTrips)
+	// Retried POSTs carrying an Idempotency-Key replay the first response
+	idempotent := middleware.Idempotency(rdb)
+
+	// Core API endpoints, each requiring its scope from middleware.APIScopes
+	s2 := middleware.Scoped(v2, middleware.APIScopes, enableAuth)
+	s3 := middleware.Scoped(v3, middleware.APIScopes, enableAuth)
+
+	s2.Get("/route-search", api.RouteSearch)
+	s2.Get("/stops/nearby", api.StopsNearby)
+	s2.Get("/stops/search", api.StopsSearch)
+	s2.Get("/routes/list", api.RoutesList)
+	s2.Get("/stops/:id/departures", api.StopDepartures)
+	s2.Get("/stops/:id/routes", api.StopRoutes)
+	s2.Get("/routes/:id/schedule", api.RouteSchedule)
+	s2.Get("/routes/:id/schedule.ics", api.RouteScheduleICS)
+	s2.Get("/routes/:id/trips", api.RouteTrips)
+	s2.Get("/routes/:id/stops", api.RouteStops)
+	s2.Get("/routes/:id/frequency", api.RouteFrequency)
+	s2.Get("/routes/:id/vehicles", api.RouteVehicles)
+	s2.Get("/routes/:id/occupancy", api.RouteOccupancy)
+	s2.Get("/routes/:id/headways", api.RouteHeadways)
+	s2.Get("/trips/:id/replay", api.TripReplay)
+	s2.Get("/network/stats", api.NetworkStats)
+	s2.Get("/services", api.ActiveServices)
+	s2.Get("/alerts", api.ListAlerts)
+	s2.Get("/siri/stop-monitoring", api.SIRIStopMonitoring)
+	s2.Post("/itineraries", idempotent, api.CreateItinerary)
+	s2.Get("/itineraries/:token", api.GetItinerary)
+	s2.Post("/feedback", idempotent, api.SubmitFeedback)
+	s2.Post("/vehicles/positions", api.PushVehiclePositions)
+	s2.Post("/occupancy", api.PostOccupancy)
+	s2.Get("/driver/devices", api.ListDriverDevices)
+	s2.Post("/driver/devices", idempotent, api.CreateDriverDevice)
+	s2.Delete("/driver/devices/:id", api.RevokeDriverDevice)
+
+	s3.Get("/route-search", api.RouteSearch)
+	s3.Get("/stops/nearby", api.StopsNearby)
+	s3.Get("/stops/search", api.StopsSearch)
+	s3.Get("/routes", api.RoutesListV3)
+	s3.Get("/stops/:id/departures", api.StopDepartures)
+	s3.Get("/stops/:id/routes", api.StopRoutes)
+	s3.Get("/routes/:id/schedule", api.RouteSchedule)
+	s3.Get("/routes/:id/schedule.ics", api.RouteScheduleICS)
+	s3.Get("/routes/:id/trips", api.RouteTripsV3)
+	s3.Get("/routes/:id/stops", api.RouteStops)
+	s3.Get("/routes/:id/frequency", api.RouteFrequency)
+	s3.Get("/routes/:id/vehicles", api.RouteVehicles)
+	s3.Get("/routes/:id/occupancy", api.RouteOccupancy)
+	s3.Get("/routes/:id/headways", api.RouteHeadways)
+	s3.Get("/trips/:id/replay", api.TripReplay)
+	s3.Get("/network/stats", api.NetworkStats)
+	s3.Get("/services", api.ActiveServices)
+	s3.Get("/alerts", api.ListAlerts)
+	s3.Get("/siri/stop-monitoring", api.SIRIStopMonitoring)
+	s3.Post("/itineraries", idempotent, api.CreateItinerary)
+	s3.Get("/itineraries/:token", api.GetItinerary)
+	s3.Post("/feedback", idempotent, api.SubmitFeedback)
+	s3.Post("/vehicles/positions", api.PushVehiclePositions)
+	s3.Post("/occupancy", api.PostOccupancy)
+	s3.Get("/driver/devices", api.ListDriverDevices)
+	s3.Post("/driver/devices", idempotent, api.CreateDriverDevice)
+	s3.Delete("/driver/devices/:id", api.RevokeDriverDevice)
+
+	scopedVersions := []*middleware.ScopedRouter{s2, s3}
+
+	// Current usage and remaining quota of the calling key
+	if enableRateLimit && enableAuth {
+		for _, v := range scopedVersions {
+			v.Get(middleware.RateLimitStatusPath, api.GetLimits)
+		}
+	}
+
+	// Saved places and favorites of partner app users (X-User-ID)
+	if enableAuth {
+		for _, v := range scopedVersions {
+			v.Get("/me", api.GetUserData)
+			v.Delete("/me", api.DeleteUserData)
+			v.Put("/me/places/:kind", api.PutUserPlace)
+			v.Delete("/me/places/:kind", api.DeleteUserPlace)
+			v.Put("/me/stops/:id", api.PutFavoriteStop)
+			v.Delete("/me/stops/:id", api.DeleteFavoriteStop)
+			v.Put("/me/routes/:id", api.PutFavoriteRoute)
+			v.Delete("/me/routes/:id", api.DeleteFavoriteRoute)
+		}
+	}
 
 	// ============================================
 	// Partner Dashboard API
 	// ============================================
 	if enableAuth {
-		dashboard := app.Group("/dashboard")
-		dashboard.Use(middleware.AuthMiddleware(pool))
+		// Email/password login issuing short-lived session tokens
+		app.Post("/dashboard/login", api.DashboardLogin)
+
+		// Invited dashboard users choose their password
+		app.Post("/dashboard/invitations/accept", api.AcceptInvitation)
+
+		// OAuth2 client-credentials grant, an alternative to pk_ keys
+		app.Post("/oauth/token", api.OAuthToken)
+
+		dashboardGroup := app.Group("/dashboard")
+		dashboardGroup.Use(middleware.DashboardAuth(pool, rdb))
+
+		// Each endpoint requires a capability of the user's role
+		dashboard := middleware.Permissioned(dashboardGroup)
 
 		// Partner information
 		dashboard.Get("/me", api.GetPartnerInfo)
+		dashboard.Put("/password", api.ChangeDashboardPassword)
 
 		// API key management
 		dashboard.Get("/api-keys", api.GetAPIKeys)
-		dashboard.Post("/api-keys", api.CreateAPIKey)
+		dashboard.Post("/api-keys", idempotent, api.CreateAPIKey)
 		dashboard.Delete("/api-keys/:id", api.RevokeAPIKey)
+		dashboard.Post("/api-keys/:id/signing-secret", api.CreateSigningSecret)
+		dashboard.Patch("/api-keys/:id/signing-secret", api.UpdateSigningSecret)
+		dashboard.Delete("/api-keys/:id/signing-secret", api.DeleteSigningSecret)
 
 		// Usage and analytics
 		dashboard.Get("/usage", api.GetUsageStats)
+		dashboard.Get("/usage/export", api.ExportUsage)
 		dashboard.Get("/quota", api.GetQuotaUsage)
+		dashboard.Put("/tier", api.ChangeTier)
+
+		// Billing
+		dashboard.Get("/invoices", api.GetInvoices)
+		dashboard.Get("/invoices/:id", api.GetInvoice)
+
+		// Quota threshold notifications
+		dashboard.Get("/notifications/quota", api.GetQuotaNotifications)
+		dashboard.Put("/notifications/quota", api.UpdateQuotaNotifications)
 
-		log.Println("✓ Dashboard API endpoints registered")
+		// Users of the partner account and their roles
+		dashboard.Get("/users", api.GetDashboardUsers)
+		dashboard.Post("/users", api.InviteDashboardUser)
+		dashboard.Patch("/users/:id", api.UpdateDashboardUser)
+		dashboard.Delete("/users/:id", api.DeleteDashboardUser)
+
+		logger.Info("Dashboard API endpoints registered")
 	}
 
 	// ============================================
-	// Admin Routes (optional - for future use)
+	// Admin Routes (admin:* keys; write:alerts keys for alerts)
 	// ============================================
-	// admin := app.Group("/admin")
-	// admin.Use(middleware.AdminAuth(pool))
-	// admin.Get("/partners", api.ListPartners)
-	// admin.Post("/partners", api.CreatePartner)
-	// admin.Put("/partners/:id", api.UpdatePartner)
+	if enableAuth {
+		adminGroup := app.Group("/admin")
+		adminGroup.Use(middleware.AdminAuth(pool, rdb))
+		admin := middleware.Scoped(adminGroup, middleware.AdminScopes, true)
+
+		// Ops dashboard
+		admin.Get("/stats", api.AdminStats)
+		admin.Get("/cache/stats", api.AdminCacheStats)
+		admin.Delete("/cache", api.AdminPurgeCache)
+
+		// Service alerts
+		admin.Get("/alerts", api.AdminListAlerts)
+		admin.Post("/alerts", idempotent, api.AdminCreateAlert)
+		admin.Get("/alerts/:id", api.AdminGetAlert)
+		admin.Put("/alerts/:id", api.AdminUpdateAlert)
+		admin.Post("/alerts/:id/expire", api.AdminExpireAlert)
+		admin.Post("/alerts/:id/confirm", api.AdminConfirmAlert)
+		admin.Delete("/alerts/:id", api.AdminDeleteAlert)
+
+		// Data feedback triage
+		admin.Get("/feedback", api.AdminListFeedback)
+		admin.Get("/feedback/:id", api.AdminGetFeedback)
+		admin.Patch("/feedback/:id", api.AdminTriageFeedback)
+
+		// GTFS imports (background jobs)
+		admin.Get("/imports", api.AdminListImports)
+		admin.Post("/imports", api.AdminCreateImport)
+		admin.Get("/imports/:id", api.AdminGetImport)
+
+		// Graph rebuilds (background jobs)
+		admin.Get("/graph/rebuild", api.AdminListGraphRebuilds)
+		admin.Post("/graph/rebuild", api.AdminRebuildGraph)
+		admin.Get("/graph/rebuild/:id", api.AdminGetGraphRebuild)
+
+		// Billing exports for the finance team
+		admin.Post("/invoices", api.AdminGenerateInvoices)
+		admin.Get("/invoices/export", api.AdminExportInvoices)
+
+		// Partner plans
+		admin.Put("/partners/:id/tier", api.AdminChangeTier)
+
+		// Support impersonation (audited)
+		admin.Post("/partners/:id/impersonate", api.AdminImpersonate)
+		admin.Get("/impersonations", api.AdminListImpersonations)
+		admin.Get("/impersonations/:id", api.AdminGetImpersonation)
+		admin.Post("/impersonations/:id/end", api.AdminEndImpersonation)
+
+		// Usage anomalies flagged by the background detector
+		admin.Get("/anomalies", api.AdminListAnomalies)
+		admin.Get("/anomalies/:id", api.AdminGetAnomaly)
+		admin.Patch("/anomalies/:id", api.AdminReviewAnomaly)
+
+		// Where searches find no itinerary, for network planning
+		admin.Get("/analytics/gaps", api.AdminRouteGaps)
+
+		// Runtime profiles (go tool pprof), e.g. for in-memory graph growth
+		admin.Get("/debug/pprof", api.AdminPprofIndex)
+		admin.Get("/debug/pprof/profile", api.AdminPprofCPU)
+		admin.Get("/debug/pprof/trace", api.AdminPprofTrace)
+		admin.Get("/debug/pprof/:name", api.AdminPprofLookup)
+
+		logger.Info("Admin API endpoints registered")
+	}
 
 	// ============================================
 	// 404 handler
@@ -183,49 +475,42 @@ func main() {
 	port := getEnv("API_PORT", "8080")
 	addr := fmt.Sprintf(":%s", port)
 
-	// Graceful shutdown
+	// Graceful shutdown: finish in-flight requests, write their usage logs,
+	// then close connections
+	shutdown := make(chan struct{})
 	go func() {
+		defer close(shutdown)
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 		<-sigChan
 
-		log.Println("\n⚠️  Received shutdown signal...")
-		log.Println("Closing database connections...")
-		db.Close()
-		log.Println("Closing Redis connections...")
-		cache.Close()
-		log.Println("Shutting down server...")
-
+		logger.Info("Received shutdown signal, draining requests")
 		if err := app.ShutdownWithTimeout(30 * time.Second); err != nil {
-			log.Printf("Error during shutdown: %v", err)
+			logger.Error("Error during shutdown", "error", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		if err := usageWriter.Close(ctx); err != nil {
+			logger.Error("Usage logs not fully written before shutdown", "error", err)
 		}
-		log.Println("✓ Server shut down gracefully")
+
+		db.Close()
+		cache.Close()
+		logger.Info("Server shut down gracefully")
 	}()
 
-	// Start server
-	log.Println("═══════════════════════════════════════════════════")
-	log.Printf("🚀 PassBi API Server Started")
-	log.Printf("📍 Listening on: http://localhost%s", addr)
-	log.Println("═══════════════════════════════════════════════════")
-	log.Println("Available Endpoints:")
-	log.Printf("  GET  /                     - API information")
-	log.Printf("  GET  /health               - Health check")
-	log.Printf("  GET  /v2/route-search      - Route planning")
-	log.Printf("  GET  /v2/stops/nearby      - Find nearby stops")
-	log.Printf("  GET  /v2/routes/list       - List all routes")
-	if enableAuth {
-		log.Println("\nPartner Dashboard:")
-		log.Printf("  GET  /dashboard/me         - Partner info")
-		log.Printf("  GET  /dashboard/api-keys   - List API keys")
-		log.Printf("  POST /dashboard/api-keys   - Create API key")
-		log.Printf("  GET  /dashboard/usage      - Usage statistics")
-		log.Printf("  GET  /dashboard/quota      - Quota status")
+	// Start server; LOG_LEVEL=debug lists every route
+	routes := app.GetRoutes(true)
+	for _, r := range routes {
+		logger.Debug("Route registered", "method", r.Method, "path", r.Path)
 	}
-	log.Println("═══════════════════════════════════════════════════")
+	logger.Info("PassBi API server started", "addr", addr, "routes", len(routes))
 
 	if err := app.Listen(addr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+		logging.Fatal(logger, "Failed to start server", "error", err)
 	}
+	<-shutdown
 }
 
 // customErrorHandler handles errors returned from handlers
@@ -236,11 +521,21 @@ func customErrorHandler(c *fiber.Ctx, err error) error {
 		code = e.Code
 	}
 
-	log.Printf("Error [%s %s]: %v", c.Method(), c.Path(), err)
+	requestID := middleware.GetRequestID(c)
+
+	// Recovered panics are logged (and reported) with their stack already
+	if !middleware.Panicked(c) {
+		level := slog.LevelError
+		if code < 500 {
+			level = slog.LevelWarn
+		}
+		logger.Log(c.Context(), level, "Request failed", "method", c.Method(), "path", c.Path(), "status", code, "error", err)
+	}
 
 	return c.Status(code).JSON(fiber.Map{
-		"error":   "internal_error",
-		"message": err.Error(),
+		"error":      "internal_error",
+		"message":    err.Error(),
+		"request_id": requestID,
 	})
 }
 
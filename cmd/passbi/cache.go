@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/cache"
+	"github.com/passbi/passbi_core/internal/logging"
+)
+
+var cacheLogger = logging.For("cache")
+
+var cacheCommands = map[string]command{
+	"stats": {"Count the keys of each namespace, their size and TTLs", runCacheStats},
+	"get":   {"Show a key's value and TTL, or list the keys matching a glob", runCacheGet},
+	"purge": {"Delete the keys of a namespace, of one ID in it, or matching a glob", runCachePurge},
+}
+
+// runCache dispatches passbi cache <subcommand>
+func runCache(args []string) int {
+	if len(args) == 0 {
+		cacheUsage()
+		return 2
+	}
+	cmd, ok := cacheCommands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "passbi cache: unknown command %q\n\n", args[0])
+		cacheUsage()
+		return 2
+	}
+	defer cache.Close()
+	return cmd.run(args[1:])
+}
+
+func cacheUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: passbi cache <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	names := make([]string, 0, len(cacheCommands))
+	for name := range cacheCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, cacheCommands[name].summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintf(os.Stderr, "Namespaces: %s\n", strings.Join(namespaceNames(), ", "))
+}
+
+func namespaceNames() []string {
+	names := make([]string, len(cache.Namespaces))
+	for i, ns := range cache.Namespaces {
+		names[i] = ns.Name
+	}
+	return names
+}
+
+// runCacheStats prints the keys of every namespace, or of those named
+func runCacheStats(args []string) int {
+	flags := flag.NewFlagSet("cache stats", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "Print the stats as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: passbi cache stats [flags] [namespace...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	namespaces := cache.Namespaces
+	if flags.NArg() > 0 {
+		namespaces = nil
+		for _, name := range flags.Args() {
+			ns, ok := cache.NamespaceByName(name)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "passbi cache stats: unknown namespace %q (use %s)\n", name, strings.Join(namespaceNames(), ", "))
+				return 2
+			}
+			namespaces = append(namespaces, ns)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	if _, err := cache.GetClient(); err != nil {
+		cacheLogger.Error("Failed to connect to Redis", "error", err)
+		return 1
+	}
+	version := cache.DataVersion(ctx)
+
+	stats := make([]cache.NamespaceStats, 0, len(namespaces))
+	for _, ns := range namespaces {
+		s, err := ns.Stats(ctx, version)
+		if err != nil {
+			cacheLogger.Error("Failed to scan keys", "namespace", ns.Name, "error", err)
+			return 1
+		}
+		stats = append(stats, s)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(map[string]any{"data_version": version, "namespaces": stats})
+		return 0
+	}
+	fmt.Printf("Data version: %d\n\n", version)
+	fmt.Printf("%-12s %9s %9s %9s %10s %10s %10s\n", "namespace", "keys", "current", "stale", "avg size", "min ttl", "max ttl")
+	for _, s := range stats {
+		stale := "-"
+		if s.Namespace != "rl" {
+			stale = fmt.Sprint(s.Keys - s.Current)
+		}
+		fmt.Printf("%-12s %9d %9d %9s %10s %10s %10s\n", s.Namespace, s.Keys, s.Current, stale,
+			byteSize(s.AvgBytes), ttlString(s.MinTTL, s.Sampled > 0), ttlString(s.MaxTTL, s.Sampled > 0))
+	}
+	fmt.Printf("\nSizes and TTLs are sampled; stale keys belong to an older data version and wait for their TTL\n")
+	return 0
+}
+
+// runCacheGet prints a key, or the keys matching a glob
+func runCacheGet(args []string) int {
+	flags := flag.NewFlagSet("cache get", flag.ExitOnError)
+	limit := flags.Int("limit", 50, "Most keys listed for a glob")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: passbi cache get [flags] <key | glob>")
+		fmt.Fprintln(os.Stderr, `  e.g. passbi cache get "v*:dep:S1:*"`)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	key := flags.Arg(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if _, err := cache.GetClient(); err != nil {
+		cacheLogger.Error("Failed to connect to Redis", "error", err)
+		return 1
+	}
+
+	if strings.ContainsAny(key, "*?[") {
+		keys, more, err := cache.Keys(ctx, key, *limit)
+		if err != nil {
+			cacheLogger.Error("Failed to scan keys", "pattern", key, "error", err)
+			return 1
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Println(k)
+		}
+		if more {
+			fmt.Fprintf(os.Stderr, "(more than %d keys; raise -limit or narrow the glob)\n", *limit)
+		}
+		if len(keys) == 0 {
+			fmt.Fprintln(os.Stderr, "no key matches")
+			return 1
+		}
+		return 0
+	}
+
+	info, err := cache.Inspect(ctx, key)
+	if err != nil {
+		cacheLogger.Error("Failed to read key", "key", key, "error", err)
+		return 1
+	}
+	if info == nil {
+		fmt.Fprintf(os.Stderr, "passbi cache get: no key %s\n", key)
+		return 1
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(info)
+	return 0
+}
+
+// runCachePurge deletes keys after a confirmation
+func runCachePurge(args []string) int {
+	flags := flag.NewFlagSet("cache purge", flag.ExitOnError)
+	id := flags.String("id", "", "Only the keys of this stop (departures), route (schedule) or partner (rl)")
+	pattern := flags.String("pattern", "", "Delete the keys matching this Redis glob instead of a namespace")
+	yes := flags.Bool("yes", false, "Skip the confirmation prompt")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: passbi cache purge [flags] <namespace>")
+		fmt.Fprintln(os.Stderr, "       passbi cache purge [flags] -pattern <glob>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	var glob string
+	switch {
+	case *pattern != "" && flags.NArg() == 0:
+		if *pattern == "*" {
+			fmt.Fprintln(os.Stderr, "passbi cache purge: refusing to delete every key")
+			return 2
+		}
+		glob = *pattern
+	case *pattern == "" && flags.NArg() == 1:
+		ns, ok := cache.NamespaceByName(flags.Arg(0))
+		if !ok {
+			fmt.Fprintf(os.Stderr, "passbi cache purge: unknown namespace %q (use %s)\n", flags.Arg(0), strings.Join(namespaceNames(), ", "))
+			return 2
+		}
+		glob = ns.Pattern
+		if *id != "" {
+			if ns.ByID == nil {
+				fmt.Fprintf(os.Stderr, "passbi cache purge: %s keys are not by ID\n", ns.Name)
+				return 2
+			}
+			glob = ns.ByID(*id)
+		}
+	default:
+		flags.Usage()
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	if _, err := cache.GetClient(); err != nil {
+		cacheLogger.Error("Failed to connect to Redis", "error", err)
+		return 1
+	}
+
+	if !*yes {
+		if strings.HasPrefix(glob, "rl:") {
+			fmt.Println("⚠️  Rate limit counters are not cached responses: this resets partners' limits")
+		}
+		fmt.Printf("Delete every key matching %s? (yes/no): ", glob)
+		var confirm string
+		fmt.Scanln(&confirm)
+		if confirm != "yes" && confirm != "y" {
+			cacheLogger.Info("Purge cancelled")
+			return 0
+		}
+	}
+
+	deleted, err := cache.Purge(ctx, glob)
+	if err != nil {
+		cacheLogger.Error("Cache purge failed", "pattern", glob, "deleted", deleted, "error", err)
+		return 1
+	}
+	cacheLogger.Info("Cache purged", "pattern", glob, "deleted", deleted)
+	fmt.Printf("Deleted %d keys matching %s\n", deleted, glob)
+	fmt.Println("Other instances may serve their in-process copy for up to CACHE_LOCAL_TTL")
+	return 0
+}
+
+func byteSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+func ttlString(ttl time.Duration, sampled bool) string {
+	if !sampled || ttl <= 0 {
+		return "-"
+	}
+	return ttl.Round(time.Second).String()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/doctor"
+)
+
+var statusIcons = map[doctor.Status]string{
+	doctor.StatusOK:   "✅",
+	doctor.StatusWarn: "⚠️ ",
+	doctor.StatusFail: "❌",
+	doctor.StatusSkip: "⏭️ ",
+}
+
+// runDoctor prints the checks; it exits 1 when one failed
+func runDoctor(args []string) int {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	migrations := flags.String("migrations", "migrations", "Directory of the migration files the schema is compared with")
+	timeout := flags.Duration("timeout", 10*time.Second, "Timeout of each network check")
+	asJSON := flags.Bool("json", false, "Print the results as JSON")
+	flags.Parse(args)
+
+	report := doctor.Run(context.Background(), doctor.Options{MigrationsDir: *migrations, Timeout: *timeout})
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		for _, res := range report.Results {
+			fmt.Printf("%s %-10s %s\n", statusIcons[res.Status], res.Check, res.Detail)
+			if res.Fix != "" {
+				fmt.Printf("   %-10s → %s\n", "", res.Fix)
+			}
+		}
+	}
+
+	if report.Failed() {
+		return 1
+	}
+	return 0
+}
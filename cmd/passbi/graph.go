@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/cache"
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/graph"
+	"github.com/passbi/passbi_core/internal/logging"
+)
+
+var graphLogger = logging.For("graph")
+
+var graphCommands = map[string]command{
+	"dump":    {"Export the node and edge tables to a file", runGraphDump},
+	"inspect": {"Show a stop's or node's edges and the routes reachable from it", runGraphInspect},
+	"restore": {"Replace the node and edge tables with a dump", runGraphRestore},
+}
+
+// runGraph dispatches passbi graph <subcommand>
+func runGraph(args []string) int {
+	if len(args) == 0 {
+		graphUsage()
+		return 2
+	}
+	cmd, ok := graphCommands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "passbi graph: unknown command %q\n\n", args[0])
+		graphUsage()
+		return 2
+	}
+	return cmd.run(args[1:])
+}
+
+func graphUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: passbi graph <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	names := make([]string, 0, len(graphCommands))
+	for name := range graphCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, graphCommands[name].summary)
+	}
+}
+
+// loadGraph loads the graph into memory from the dump at path, or from the
+// database without one, and prints its size when summary is set
+func loadGraph(ctx context.Context, path string, summary bool) bool {
+	source := "database"
+	if path != "" {
+		source = path
+		f, err := os.Open(path)
+		if err != nil {
+			graphLogger.Error("Failed to open dump", "path", path, "error", err)
+			return false
+		}
+		_, err = graph.GetGraph().LoadFromDump(ctx, f)
+		f.Close()
+		if err != nil {
+			graphLogger.Error("Failed to load graph dump", "path", path, "error", err)
+			return false
+		}
+	} else {
+		pool, err := db.GetDB()
+		if err != nil {
+			graphLogger.Error("Failed to connect to database", "error", err)
+			return false
+		}
+		err = graph.GetGraph().LoadFromDB(ctx, pool)
+		db.Close()
+		if err != nil {
+			graphLogger.Error("Failed to load graph", "error", err)
+			return false
+		}
+	}
+
+	if summary {
+		stats := graph.GetGraph().Stats()
+		fmt.Printf("Graph: %d nodes, %d edges, from %s\n\n", stats.Nodes, stats.Edges, source)
+	}
+	return true
+}
+
+// runGraphDump writes the graph tables to -o, or stdout with -o -
+func runGraphDump(args []string) int {
+	flags := flag.NewFlagSet("graph dump", flag.ExitOnError)
+	output := flags.String("o", "graph-"+time.Now().UTC().Format("20060102-150405")+".tar.gz", `File to write, "-" for stdout`)
+	format := flags.String("format", string(graph.FormatBinary), "COPY format: binary (fast, same PostgreSQL and PostGIS versions) or csv (portable)")
+	flags.Parse(args)
+
+	pool, err := db.GetDB()
+	if err != nil {
+		graphLogger.Error("Failed to connect to database", "error", err)
+		return 1
+	}
+	defer db.Close()
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			graphLogger.Error("Failed to create dump file", "path", *output, "error", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+
+	manifest, err := graph.Dump(context.Background(), pool, w, graph.DumpFormat(*format))
+	if err != nil {
+		graphLogger.Error("Graph dump failed", "error", err)
+		if *output != "-" {
+			os.Remove(*output)
+		}
+		return 1
+	}
+
+	graphLogger.Info("Graph dumped", "path", *output, "format", manifest.Format, "schema_version", manifest.SchemaVersion,
+		"nodes", manifest.Tables[0].Rows, "edges", manifest.Tables[1].Rows)
+	return 0
+}
+
+// runGraphRestore loads a dump and tells the API instances to reload
+func runGraphRestore(args []string) int {
+	flags := flag.NewFlagSet("graph restore", flag.ExitOnError)
+	yes := flags.Bool("yes", false, "Skip the confirmation prompt")
+	ignoreVersion := flags.Bool("ignore-schema-version", false, "Restore a dump taken at another migration version")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: passbi graph restore [flags] <dump.tar.gz | ->")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	path := flags.Arg(0)
+	if path == "-" && !*yes {
+		fmt.Fprintln(os.Stderr, "passbi graph restore: reading the dump from stdin needs -yes")
+		return 2
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			graphLogger.Error("Failed to open dump", "path", path, "error", err)
+			return 1
+		}
+		defer f.Close()
+		r = f
+	}
+
+	pool, err := db.GetDB()
+	if err != nil {
+		graphLogger.Error("Failed to connect to database", "error", err)
+		return 1
+	}
+	defer db.Close()
+
+	if !*yes {
+		fmt.Println("⚠️  This will REPLACE all existing nodes and edges!")
+		fmt.Print("Continue? (yes/no): ")
+		var confirm string
+		fmt.Scanln(&confirm)
+		if confirm != "yes" && confirm != "y" {
+			graphLogger.Info("Restore cancelled")
+			return 0
+		}
+	}
+
+	ctx := context.Background()
+	manifest, err := graph.Restore(ctx, pool, r, graph.RestoreOptions{IgnoreSchemaVersion: *ignoreVersion})
+	if errors.Is(err, graph.ErrSchemaMismatch) {
+		graphLogger.Error("Graph restore refused; migrate the database to the dump's version, or pass -ignore-schema-version", "error", err)
+		return 1
+	}
+	if err != nil {
+		graphLogger.Error("Graph restore failed; the graph is unchanged", "error", err)
+		return 1
+	}
+
+	if _, err := cache.BumpDataVersion(ctx); err != nil {
+		graphLogger.Warn("Failed to invalidate cached responses (they expire with their TTL)", "error", err)
+	}
+	if err := graph.NotifyReload(ctx, pool, "restore", ""); err != nil {
+		graphLogger.Warn("Failed to notify graph reload (restart API instances to load the new graph)", "error", err)
+	}
+
+	graphLogger.Info("Graph restored", "path", path, "created_at", manifest.CreatedAt, "schema_version", manifest.SchemaVersion,
+		"nodes", manifest.Tables[0].Rows, "edges", manifest.Tables[1].Rows)
+	return 0
+}
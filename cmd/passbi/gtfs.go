@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/passbi/passbi_core/internal/gtfs"
+	"github.com/passbi/passbi_core/internal/logging"
+)
+
+var gtfsLogger = logging.For("gtfs")
+
+var gtfsCommands = map[string]command{
+	"diff": {"Summarize what a new feed changes from an old one, before importing it", runGTFSDiff},
+}
+
+// runGTFS dispatches passbi gtfs <subcommand>
+func runGTFS(args []string) int {
+	if len(args) == 0 {
+		gtfsUsage()
+		return 2
+	}
+	cmd, ok := gtfsCommands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "passbi gtfs: unknown command %q\n\n", args[0])
+		gtfsUsage()
+		return 2
+	}
+	return cmd.run(args[1:])
+}
+
+func gtfsUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: passbi gtfs <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	names := make([]string, 0, len(gtfsCommands))
+	for name := range gtfsCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, gtfsCommands[name].summary)
+	}
+}
+
+// runGTFSDiff compares two GTFS zips
+func runGTFSDiff(args []string) int {
+	flags := flag.NewFlagSet("gtfs diff", flag.ExitOnError)
+	limit := flags.Int("limit", 20, "Most IDs listed per table and change; 0 for all")
+	asJSON := flags.Bool("json", false, "Print the whole diff as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: passbi gtfs diff [flags] old.zip new.zip")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	feeds := make([]*gtfs.GTFSFeed, 2)
+	for i, path := range flags.Args() {
+		feed, err := gtfs.ParseGTFSZip(path)
+		if err != nil {
+			gtfsLogger.Error("Failed to parse feed", "path", path, "error", err)
+			return 1
+		}
+		feeds[i] = feed
+	}
+	d := gtfs.Diff(feeds[0], feeds[1])
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(d)
+		return 0
+	}
+
+	fmt.Printf("%s -> %s\n", flags.Arg(0), flags.Arg(1))
+	fmt.Printf("Service span: %s -> %s\n", dateSpan(d.OldSpan), dateSpan(d.NewSpan))
+	if d.Empty() {
+		fmt.Println("\nNo change")
+		return 0
+	}
+
+	tables := []struct {
+		name string
+		diff gtfs.EntityDiff
+	}{{"Stops", d.Stops}, {"Routes", d.Routes}, {"Trips", d.Trips}, {"Services", d.Services}}
+	for _, t := range tables {
+		e := t.diff
+		fmt.Printf("\n%s: %d added, %d removed, %d changed, %d unchanged\n",
+			t.name, len(e.Added), len(e.Removed), len(e.Changed), e.Unchanged)
+		printIDs("+", e.Added, *limit)
+		printIDs("-", e.Removed, *limit)
+		for i, c := range e.Changed {
+			if *limit > 0 && i == *limit {
+				fmt.Printf("  ~ ... %d more\n", len(e.Changed)-i)
+				break
+			}
+			for j, detail := range c.Details {
+				id := c.ID
+				if j > 0 {
+					id = ""
+				}
+				fmt.Printf("  ~ %-20s %s\n", id, detail)
+			}
+		}
+	}
+
+	if len(d.RouteService) > 0 {
+		fmt.Printf("\nRoute service (trips, first and last departure): %d routes changed\n", len(d.RouteService))
+		for i, rs := range d.RouteService {
+			if *limit > 0 && i == *limit {
+				fmt.Printf("  ... %d more\n", len(d.RouteService)-i)
+				break
+			}
+			fmt.Printf("  %-20s %5d -> %-5d %s -> %s\n", rs.RouteID, rs.OldTrips, rs.NewTrips,
+				timeSpan(rs.OldFirst, rs.OldLast), timeSpan(rs.NewFirst, rs.NewLast))
+		}
+	}
+	return 0
+}
+
+func printIDs(sign string, ids []string, limit int) {
+	for i, id := range ids {
+		if limit > 0 && i == limit {
+			fmt.Printf("  %s ... %d more\n", sign, len(ids)-i)
+			return
+		}
+		fmt.Printf("  %s %s\n", sign, id)
+	}
+}
+
+func dateSpan(s gtfs.DateSpan) string {
+	if s.Start == "" {
+		return "none"
+	}
+	return s.Start + "-" + s.End
+}
+
+func timeSpan(first, last string) string {
+	if first == "" {
+		return "none"
+	}
+	return first + "-" + last
+}
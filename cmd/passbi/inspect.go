@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/passbi/passbi_core/internal/graph"
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/passbi/passbi_core/internal/routing"
+)
+
+// runGraphInspect prints the nodes of a stop, or a node, as searches see
+// them; it exits 1 when one has a problem
+func runGraphInspect(args []string) int {
+	flags := flag.NewFlagSet("graph inspect", flag.ExitOnError)
+	stopID := flags.String("stop", "", "Stop ID: inspect each of its nodes")
+	nodeID := flags.Int64("node", 0, "Node ID")
+	hops := flags.Int("hops", 3, "Edges followed to list the reachable routes")
+	dump := flags.String("graph", "", "Load the graph from a dump of passbi graph dump rather than the database")
+	agencies := flags.String("agency", "", "Comma-separated agencies searches are restricted to")
+	asJSON := flags.Bool("json", false, "Print the inspections as JSON")
+	flags.Parse(args)
+
+	if (*stopID == "") == (*nodeID == 0) {
+		fmt.Fprintln(os.Stderr, "passbi graph inspect: pass one of -stop or -node")
+		flags.Usage()
+		return 2
+	}
+	if *hops < 0 {
+		fmt.Fprintln(os.Stderr, "passbi graph inspect: -hops must not be negative")
+		return 2
+	}
+	if *dump != "" && *agencies != "" {
+		fmt.Fprintln(os.Stderr, "passbi graph inspect: a graph dump has no agencies; -agency needs the database")
+		return 2
+	}
+
+	if !loadGraph(context.Background(), *dump, !*asJSON) {
+		return 1
+	}
+	g := graph.GetGraph()
+
+	ids := []int64{*nodeID}
+	if *stopID != "" {
+		ids = nil
+		for _, n := range g.GetStopNodes(*stopID) {
+			ids = append(ids, n.ID)
+		}
+		if len(ids) == 0 {
+			fmt.Fprintf(os.Stderr, "passbi graph inspect: stop %s has no node: no route of the graph serves it\n", *stopID)
+			return 1
+		}
+	}
+
+	router := routing.NewRouter().WithAgencies(splitComma(*agencies))
+	inspections := make([]*routing.Inspection, 0, len(ids))
+	code := 0
+	for _, id := range ids {
+		in, ok := router.Inspect(id, *hops)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "passbi graph inspect: no node %d\n", id)
+			return 1
+		}
+		if len(in.Problems) > 0 {
+			code = 1
+		}
+		inspections = append(inspections, in)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(inspections)
+		return code
+	}
+	for _, in := range inspections {
+		printInspection(g, in, *hops)
+	}
+	return code
+}
+
+func printInspection(g *graph.InMemoryGraph, in *routing.Inspection, hops int) {
+	n := in.Node
+	fmt.Printf("── %s\n", nodeLabel(n))
+	fmt.Printf("   agency %s, at %.6f,%.6f\n", n.AgencyID, n.Lat, n.Lon)
+
+	printEdges := func(title string, edges []models.Edge, other func(models.Edge) int64) {
+		fmt.Printf("\n   %s (%d):\n", title, len(edges))
+		for _, e := range edges {
+			label := fmt.Sprintf("missing node #%d", other(e))
+			if node, ok := g.GetNode(other(e)); ok {
+				label = nodeLabel(node)
+			}
+			fmt.Printf("   %-8s %5ds %5dm %dx  %s", e.Type, e.CostTime, e.CostWalk, e.CostTransfer, label)
+			if e.TripID != "" {
+				fmt.Printf("  trip %s", e.TripID)
+			}
+			fmt.Println()
+		}
+	}
+	printEdges("Outgoing edges", in.Out, func(e models.Edge) int64 { return e.ToNodeID })
+	printEdges("Incoming edges", in.In, func(e models.Edge) int64 { return e.FromNodeID })
+
+	fmt.Printf("\n   Routes reachable within %d hops (%d):\n", hops, len(in.Routes))
+	for _, r := range in.Routes {
+		fmt.Printf("   %-4d %-5s %-20s %-20s %d stops\n", r.Hops, r.Mode, r.RouteName, r.AgencyID, r.Stops)
+	}
+
+	if len(in.Problems) == 0 {
+		fmt.Println("\n   ✅ No problem found")
+	} else {
+		fmt.Println()
+		for _, p := range in.Problems {
+			fmt.Printf("   ❌ %s\n", p)
+		}
+	}
+	fmt.Println()
+}
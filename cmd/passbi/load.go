@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/loadgen"
+)
+
+// runLoad sends mixed traffic to an API and prints how it held up; it exits
+// 1 when a request failed or got a server error
+func runLoad(args []string) int {
+	def := loadgen.DefaultConfig()
+	flags := flag.NewFlagSet("load", flag.ExitOnError)
+	target := flags.String("target", def.Target, "Base URL of the API")
+	key := flags.String("key", os.Getenv("PASSBI_API_KEY"), "API key, sent as a bearer token (default $PASSBI_API_KEY)")
+	rps := flags.Float64("rps", def.RPS, "Requests per second")
+	duration := flags.Duration("duration", def.Duration, "How long to send requests")
+	ramp := flags.Duration("ramp", 0, "Time to rise from 0 to -rps, within -duration")
+	concurrency := flags.Int("concurrency", def.Concurrency, "Most requests in flight; requests beyond it are dropped")
+	timeout := flags.Duration("timeout", def.Timeout, "Timeout of each request")
+	mix := flags.String("mix", "route-search=5,nearby=3,departures=2", "Weight of each kind of request")
+	center := flags.String("center", fmt.Sprintf("%g,%g", def.Area.Lat, def.Area.Lon), "Center of the area places are picked in, lat,lon")
+	radius := flags.Float64("radius", def.Area.Radius, "Radius of the area, in meters")
+	hotspots := flags.Int("hotspots", def.Hotspots, "Places most searches go from and to")
+	fresh := flags.Float64("fresh", def.Fresh, "Share of places picked anywhere in the area, which miss the cache")
+	seed := flags.Int64("seed", def.Seed, "Random seed, to repeat a run's requests")
+	asJSON := flags.Bool("json", false, "Print the report as JSON")
+	quiet := flags.Bool("quiet", false, "Do not print progress every second")
+	flags.Parse(args)
+
+	cfg := def
+	cfg.Target, cfg.APIKey, cfg.RPS, cfg.Duration, cfg.Ramp = *target, *key, *rps, *duration, *ramp
+	cfg.Concurrency, cfg.Timeout, cfg.Hotspots, cfg.Fresh, cfg.Seed = *concurrency, *timeout, *hotspots, *fresh, *seed
+	cfg.Area.Radius = *radius
+	var err error
+	if cfg.Mix, err = loadgen.ParseMix(*mix); err != nil {
+		fmt.Fprintf(os.Stderr, "passbi load: -mix: %v\n", err)
+		return 2
+	}
+	if _, err := fmt.Sscanf(*center, "%g,%g", &cfg.Area.Lat, &cfg.Area.Lon); err != nil {
+		fmt.Fprintf(os.Stderr, "passbi load: -center %q: use lat,lon\n", *center)
+		return 2
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "passbi load: %v\n", err)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var progress func(*loadgen.Report)
+	if !*quiet {
+		fmt.Fprintf(os.Stderr, "Sending %g requests/s to %s for %s (seed %d)\n", cfg.RPS, cfg.Target, cfg.Duration, cfg.Seed)
+		progress = func(r *loadgen.Report) {
+			fmt.Fprintf(os.Stderr, "%6.0fs  sent %-7d %6.1f req/s  dropped %d\n", r.Elapsed, r.Sent, r.Achieved, r.Dropped)
+		}
+	}
+	report, err := loadgen.Run(ctx, cfg, nil, progress)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "passbi load: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		printLoadReport(report)
+	}
+
+	for _, k := range report.Kinds {
+		if k.Failed > 0 || k.ServerError > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+func printLoadReport(r *loadgen.Report) {
+	fmt.Printf("%d requests in %s (%.1f req/s), %d dropped\n\n", r.Sent, time.Duration(r.Elapsed*float64(time.Second)).Round(time.Millisecond), r.Achieved, r.Dropped)
+	fmt.Printf("%-13s %8s %7s %6s %6s %6s %6s %7s %9s %9s %9s %9s\n",
+		"kind", "requests", "ok", "4xx", "429", "5xx", "failed", "cached", "p50 ms", "p90 ms", "p99 ms", "max ms")
+	for _, k := range r.Kinds {
+		cached := 0.0
+		if k.Requests > 0 {
+			cached = 100 * float64(k.CacheHits) / float64(k.Requests)
+		}
+		fmt.Printf("%-13s %8d %7d %6d %6d %6d %6d %6.0f%% %9.1f %9.1f %9.1f %9.1f\n",
+			k.Kind, k.Requests, k.OK, k.ClientError, k.RateLimited, k.ServerError, k.Failed, cached, k.P50, k.P90, k.P99, k.Max)
+	}
+}
@@ -0,0 +1,67 @@
+// Command passbi groups the maintenance commands of a PassBi deployment
+//
+//	passbi <command> [flags]
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/passbi/passbi_core/internal/config"
+	"github.com/passbi/passbi_core/internal/logging"
+)
+
+// command is a subcommand; run returns the exit code
+type command struct {
+	summary string
+	run     func(args []string) int
+}
+
+var commands = map[string]command{
+	"cache":  {"Inspect and purge the Redis cache and rate limit keys", runCache},
+	"doctor": {"Check the environment, database, Redis and graph, and how to fix them", runDoctor},
+	"graph":  {"Dump and restore the routing graph tables", runGraph},
+	"gtfs":   {"Compare GTFS feeds before importing them", runGTFS},
+	"load":   {"Send mixed route-search, nearby and departures traffic to an API", runLoad},
+	"route":  {"Run the router locally and explain the path it chose", runRoute},
+	"seed":   {"Generate a synthetic grid city GTFS feed, and import it with -import", runSeed},
+	"smoke":  {"Check every public endpoint of a deployed API, for post-deploy verification", runSmoke},
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "help" || os.Args[1] == "-h" || os.Args[1] == "--help" {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "passbi: unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	// doctor reports a broken configuration rather than refusing to run
+	if os.Args[1] != "doctor" {
+		config.MustSetup("passbi")
+	}
+	logging.Setup("passbi")
+	os.Exit(cmd.run(os.Args[2:]))
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: passbi <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, `Run "passbi <command> -h" for the flags of a command`)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/passbi/passbi_core/internal/routing"
+)
+
+// routeAlternatives is how many alternatives are printed without -verbose
+const routeAlternatives = 5
+
+// runRoute runs the router in process and explains the path it chose; it
+// exits 1 when a strategy found no path
+func runRoute(args []string) int {
+	flags := flag.NewFlagSet("route", flag.ExitOnError)
+	from := flags.String("from", "", "Origin, lat,lon")
+	to := flags.String("to", "", "Destination, lat,lon")
+	strategyName := flags.String("strategy", "simple", `Strategy: no_transfer, direct, simple, fast, or "all"`)
+	dump := flags.String("graph", "", "Load the graph from a dump of passbi graph dump rather than the database")
+	agencies := flags.String("agency", "", "Comma-separated agencies paths are restricted to")
+	verbose := flags.Bool("verbose", false, "Also print the edges each hop passed over, and every alternative")
+	asJSON := flags.Bool("json", false, "Print the explanations as JSON")
+	flags.Parse(args)
+
+	fromLat, fromLon, err := parseLatLon(*from)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "passbi route: -from: %v\n", err)
+		return 2
+	}
+	toLat, toLon, err := parseLatLon(*to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "passbi route: -to: %v\n", err)
+		return 2
+	}
+	var strategies []routing.Strategy
+	for _, s := range routing.GetAllStrategies() {
+		if *strategyName == "all" || s.Name() == *strategyName {
+			strategies = append(strategies, s)
+		}
+	}
+	if len(strategies) == 0 {
+		fmt.Fprintf(os.Stderr, "passbi route: unknown strategy %q\n", *strategyName)
+		return 2
+	}
+	if *dump != "" && *agencies != "" {
+		fmt.Fprintln(os.Stderr, "passbi route: a graph dump has no agencies; -agency needs the database")
+		return 2
+	}
+
+	ctx := context.Background()
+	if !loadGraph(ctx, *dump, !*asJSON) {
+		return 1
+	}
+
+	router := routing.NewRouter().WithAgencies(splitComma(*agencies))
+	explanations := make([]*routing.Explanation, 0, len(strategies))
+	code := 0
+	for _, s := range strategies {
+		e, err := router.Explain(ctx, fromLat, fromLon, toLat, toLon, s)
+		if err != nil {
+			code = 1
+		}
+		explanations = append(explanations, e)
+		if !*asJSON {
+			printExplanation(e, err, *verbose)
+		}
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(explanations)
+	}
+	return code
+}
+
+func printExplanation(e *routing.Explanation, err error, verbose bool) {
+	s := e.Stats
+	fmt.Printf("── %s: %s in %s, %d nodes explored (queue peak %d, limit %d), %d partial paths stopped\n",
+		e.Strategy, s.Outcome, s.Duration.Round(time.Microsecond), s.ExploredNodes, s.PeakQueue, s.MaxExplored, e.Stopped)
+	fmt.Printf("   %d start nodes (nearest %s), %d goal nodes (nearest %s)\n",
+		len(e.StartNodes), meters(s.StartSnapM), len(e.GoalNodes), meters(s.GoalSnapM))
+	if err != nil {
+		fmt.Printf("   no path: %v\n", err)
+	}
+
+	if p := e.Path; p != nil {
+		fmt.Printf("\n   Path: cost %d, %d min, %d m walk, %d transfers\n", p.TotalTime, p.DurationMins, p.WalkDistanceM, p.Transfers)
+		fmt.Printf("   %-3s %-8s %-6s %-5s %-6s %-6s %s\n", "#", "type", "base", "cost", "g", "h", "to")
+		if len(e.Hops) > 0 {
+			fmt.Printf("   %-3s %-8s %-6s %-5s %-6s %-6s %s\n", "", "start", "", "", "0", "", nodeLabel(e.Hops[0].From))
+		}
+		for i, h := range e.Hops {
+			fmt.Printf("   %-3d %-8s %-6d %-5d %-6d %-6d %s\n", i+1, h.Edge.Type, h.BaseCost, h.Cost, h.G, h.H, nodeLabel(h.To))
+			if verbose {
+				for _, r := range h.Rejected {
+					cost := "-"
+					if r.Cost >= 0 {
+						cost = strconv.Itoa(r.Cost)
+					}
+					fmt.Printf("         ✗ %-8s %-6s %s: %s\n", r.Edge.Type, cost, nodeLabel(r.To), r.Reason)
+				}
+			}
+		}
+	}
+
+	if len(e.Alternatives) > 0 {
+		shown := e.Alternatives
+		if !verbose && len(shown) > routeAlternatives {
+			shown = shown[:routeAlternatives]
+		}
+		fmt.Printf("\n   Alternatives (%d of %d):\n", len(shown), len(e.Alternatives))
+		for _, a := range shown {
+			routes := strings.Join(a.Routes, " > ")
+			if routes == "" {
+				routes = "walk"
+			}
+			fmt.Printf("   cost %-6d %-30s to %s: %s\n", a.Cost, routes, nodeLabel(a.Nodes[len(a.Nodes)-1]), a.Reason)
+		}
+	}
+	fmt.Println()
+}
+
+func nodeLabel(n models.Node) string {
+	if n.StopName == n.StopID {
+		return fmt.Sprintf("%s [%s %s] #%d", n.StopID, n.Mode, n.RouteName, n.ID)
+	}
+	return fmt.Sprintf("%s (%s) [%s %s] #%d", n.StopName, n.StopID, n.Mode, n.RouteName, n.ID)
+}
+
+func meters(m float64) string {
+	if m < 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f m", m)
+}
+
+// parseLatLon parses "lat,lon"
+func parseLatLon(s string) (lat, lon float64, err error) {
+	latStr, lonStr, ok := strings.Cut(s, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("%q: expected lat,lon", s)
+	}
+	if lat, err = strconv.ParseFloat(strings.TrimSpace(latStr), 64); err != nil || lat < -90 || lat > 90 {
+		return 0, 0, fmt.Errorf("%q: invalid latitude", s)
+	}
+	if lon, err = strconv.ParseFloat(strings.TrimSpace(lonStr), 64); err != nil || lon < -180 || lon > 180 {
+		return 0, 0, fmt.Errorf("%q: invalid longitude", s)
+	}
+	return lat, lon, nil
+}
+
+func splitComma(s string) []string {
+	var parts []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
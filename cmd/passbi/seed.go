@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/gtfs"
+	"github.com/passbi/passbi_core/internal/importer"
+	"github.com/passbi/passbi_core/internal/logging"
+)
+
+var seedLogger = logging.For("seed")
+
+// runSeed writes the synthetic grid city feed and, with -import, imports it
+// and rebuilds the graph like passbi-import --rebuild-graph
+func runSeed(args []string) int {
+	defaults := gtfs.DefaultDemoOptions()
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	out := flags.String("out", "gridcity.zip", "Path of the GTFS zip written")
+	agencyID := flags.String("agency", defaults.AgencyID, "Agency ID of the feed")
+	rows := flags.Int("rows", defaults.Rows, "Streets of the grid, west-east")
+	cols := flags.Int("cols", defaults.Cols, "Avenues of the grid, south-north")
+	spacing := flags.Float64("spacing", defaults.SpacingM, "Meters between neighbouring stops")
+	headway := flags.Duration("headway", defaults.Headway, "Weekday headway of every line, doubled on weekends")
+	doImport := flags.Bool("import", false, "Import the feed into the database and rebuild the graph")
+	flags.Parse(args)
+
+	opts := defaults
+	opts.AgencyID, opts.Rows, opts.Cols, opts.SpacingM, opts.Headway = *agencyID, *rows, *cols, *spacing, *headway
+	feed, err := gtfs.GenerateDemo(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "passbi seed: %v\n", err)
+		return 2
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		seedLogger.Error("Failed to create the feed", "path", *out, "error", err)
+		return 1
+	}
+	if err := gtfs.WriteZip(f, feed); err != nil {
+		f.Close()
+		seedLogger.Error("Failed to write the feed", "path", *out, "error", err)
+		return 1
+	}
+	if err := f.Close(); err != nil {
+		seedLogger.Error("Failed to write the feed", "path", *out, "error", err)
+		return 1
+	}
+	fmt.Printf("Wrote %s: %d stops, %d routes, %d trips, %d stop times\n",
+		*out, len(feed.Stops), len(feed.Routes), len(feed.Trips), len(feed.StopTimes))
+
+	from, to := feed.Stops[0], feed.Stops[len(feed.Stops)-1]
+	search := fmt.Sprintf(`curl "http://localhost:8080/v2/route-search?from=%.5f,%.5f&to=%.5f,%.5f"`, from.Lat, from.Lon, to.Lat, to.Lon)
+
+	if !*doImport {
+		fmt.Println("\nServe it without a database:")
+		fmt.Printf("  EMBEDDED_GTFS=%s=%s go run cmd/api/main.go\n", *agencyID, *out)
+		fmt.Println("or import it with -import. Then search across the city:")
+		fmt.Printf("  %s\n", search)
+		return 0
+	}
+
+	pool, err := db.GetDB()
+	if err != nil {
+		seedLogger.Error("Failed to connect to database", "error", err)
+		return 1
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	result, err := importer.Run(ctx, pool, importer.Options{
+		AgencyID:     *agencyID,
+		GTFSPath:     *out,
+		RebuildGraph: true,
+		Progress: func(step int, description string) {
+			fmt.Printf("[%d/%d] %s\n", step, importer.Steps, description)
+		},
+	})
+	if err != nil {
+		seedLogger.Error("Import failed", "agency_id", *agencyID, "error", err)
+		return 1
+	}
+	fmt.Printf("Imported %s: %d nodes, %d edges in %s\n", *agencyID, result.Nodes, result.Edges, result.Duration.Round(time.Millisecond))
+	fmt.Println("\nStart the API (running instances reload the graph on their own) and search across the city:")
+	fmt.Printf("  %s\n", search)
+	return 0
+}
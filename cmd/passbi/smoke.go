@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/smoke"
+)
+
+// runSmoke checks every public read endpoint of a deployed API; it exits 1
+// when a check failed
+func runSmoke(args []string) int {
+	def := smoke.DefaultConfig()
+	flags := flag.NewFlagSet("smoke", flag.ExitOnError)
+	baseURL := flags.String("base-url", def.BaseURL, "Base URL of the API")
+	key := flags.String("key", os.Getenv("PASSBI_API_KEY"), "API key, sent as a bearer token (default $PASSBI_API_KEY)")
+	from := flags.String("from", def.From.String(), "Origin of the route search, and where stops are looked up, lat,lon")
+	to := flags.String("to", def.To.String(), "Destination of the route search, lat,lon")
+	query := flags.String("query", def.Query, "Stop name searched")
+	budget := flags.Duration("budget", def.Budget, "Latency allowed to a request")
+	searchBudget := flags.Duration("search-budget", def.SearchBudget, "Latency allowed to route searches and timetables")
+	timeout := flags.Duration("timeout", def.Timeout, "Timeout of each request")
+	asJSON := flags.Bool("json", false, "Print the report as JSON")
+	flags.Parse(args)
+
+	cfg := def
+	cfg.BaseURL, cfg.APIKey, cfg.Query = *baseURL, *key, *query
+	cfg.Budget, cfg.SearchBudget, cfg.Timeout = *budget, *searchBudget, *timeout
+	var err error
+	if cfg.From.Lat, cfg.From.Lon, err = parseLatLon(*from); err != nil {
+		fmt.Fprintf(os.Stderr, "passbi smoke: -from: %v\n", err)
+		return 2
+	}
+	if cfg.To.Lat, cfg.To.Lon, err = parseLatLon(*to); err != nil {
+		fmt.Fprintf(os.Stderr, "passbi smoke: -to: %v\n", err)
+		return 2
+	}
+	if !strings.HasPrefix(cfg.BaseURL, "http://") && !strings.HasPrefix(cfg.BaseURL, "https://") {
+		fmt.Fprintf(os.Stderr, "passbi smoke: -base-url %q: use http:// or https://\n", cfg.BaseURL)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	report := smoke.Run(ctx, cfg, nil)
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		printSmokeReport(report)
+	}
+	if report.Failed > 0 || ctx.Err() != nil {
+		return 1
+	}
+	return 0
+}
+
+func printSmokeReport(report *smoke.Report) {
+	fmt.Printf("Smoke test of %s\n\n", report.BaseURL)
+	for _, r := range report.Results {
+		switch {
+		case r.Skipped != "":
+			fmt.Printf("  -  %-28s skipped: %s\n", r.Name, r.Skipped)
+		case r.Passed():
+			fmt.Printf("  ✓  %-28s %3d %8s\n", r.Name, r.Status, r.Latency.Round(time.Millisecond))
+		default:
+			status := "---"
+			if r.Status > 0 {
+				status = fmt.Sprint(r.Status)
+			}
+			fmt.Printf("  ✗  %-28s %3s %8s  %s\n", r.Name, status, r.Latency.Round(time.Millisecond), r.URL)
+			for _, e := range r.Errors {
+				fmt.Printf("       %s\n", e)
+			}
+		}
+	}
+	fmt.Printf("\n%d passed, %d failed, %d skipped\n", report.Passed, report.Failed, report.Skipped)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/config"
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/errreport"
+	"github.com/passbi/passbi_core/internal/gtfsrt"
+	"github.com/passbi/passbi_core/internal/logging"
+	"github.com/passbi/passbi_core/internal/mqtt"
+	"github.com/passbi/passbi_core/internal/realtime"
+	"github.com/passbi/passbi_core/internal/retry"
+)
+
+var logger = logging.For("realtime")
+
+func main() {
+	// Settings from the PASSBI_CONFIG file, under the environment
+	config.MustSetup("realtime-ingest")
+
+	// Command-line flags
+	agencyID := flag.String("agency-id", "", "Agency ID the feed belongs to (required)")
+	feedURL := flag.String("url", os.Getenv("GTFS_RT_TRIP_UPDATES_URL"), "GTFS-Realtime TripUpdates feed URL")
+	positionsURL := flag.String("positions-url", os.Getenv("GTFS_RT_VEHICLE_POSITIONS_URL"), "GTFS-Realtime VehiclePositions feed URL (published to MQTT)")
+	interval := flag.Duration("interval", 30*time.Second, "Polling interval")
+	once := flag.Bool("once", false, "Fetch the feed once and exit")
+
+	flag.Parse()
+
+	if *agencyID == "" || (*feedURL == "" && *positionsURL == "") {
+		fmt.Println("Usage: passbi-realtime --agency-id=<id> [--url=<trip-updates-url>] [--positions-url=<vehicle-positions-url>] [--interval=30s] [--once]")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	logging.Setup("realtime-ingest")
+	errreport.Init("realtime-ingest")
+	errreport.SetTag("agency_id", *agencyID)
+	defer errreport.Flush(5 * time.Second)
+
+	logger.Info("Starting GTFS-Realtime ingestion", "agency_id", *agencyID,
+		"trip_updates_url", *feedURL, "vehicle_positions_url", *positionsURL)
+
+	pool, err := db.Connect(context.Background(), retry.StartupConfigFromEnv())
+	if err != nil {
+		logging.Fatal(logger, "Failed to connect to database", "error", err)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client := &http.Client{Timeout: 20 * time.Second}
+
+	publisher := mqtt.GetPublisher()
+	defer mqtt.Close()
+	if *positionsURL != "" && publisher == nil {
+		logger.Warn("MQTT_BROKER_URL is not set: vehicle positions will be fetched but not published")
+	}
+
+	if *once {
+		if err := pollAll(ctx, pool, client, publisher, *agencyID, *feedURL, *positionsURL); err != nil {
+			logging.Fatal(logger, "Ingestion failed", "error", err)
+		}
+		return
+	}
+
+	logger.Info("Polling feeds", "interval", interval.String())
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	lastPurge := time.Time{}
+	for {
+		if err := pollAll(ctx, pool, client, publisher, *agencyID, *feedURL, *positionsURL); err != nil {
+			logger.Error("Ingestion error", "error", err)
+		}
+
+		// Drop predictions from previous service days once an hour
+		if time.Since(lastPurge) > time.Hour {
+			yesterday := time.Now().UTC().AddDate(0, 0, -1)
+			if n, err := realtime.Purge(ctx, pool, yesterday); err != nil {
+				logger.Error("Failed to purge old trip updates", "error", err)
+			} else if n > 0 {
+				logger.Info("Purged old trip updates", "trip_updates", n)
+			}
+			lastPurge = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Info("Shutting down gracefully")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollAll fetches every configured feed once, returning the first error
+func pollAll(ctx context.Context, pool *pgxpool.Pool, client *http.Client, publisher *mqtt.Publisher, agencyID, feedURL, positionsURL string) error {
+	var firstErr error
+	if feedURL != "" {
+		if err := poll(ctx, pool, client, agencyID, feedURL); err != nil {
+			firstErr = err
+		}
+	}
+	if positionsURL != "" {
+		if err := pollPositions(ctx, client, publisher, agencyID, positionsURL); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func poll(ctx context.Context, pool *pgxpool.Pool, client *http.Client, agencyID, feedURL string) error {
+	start := time.Now()
+
+	feed, err := realtime.Fetch(ctx, client, feedURL)
+	if err != nil {
+		return err
+	}
+
+	stats, err := realtime.Ingest(ctx, pool, agencyID, feed)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Ingested trip updates", "agency_id", agencyID, "trips", stats.Trips, "stop_predictions", stats.Stops,
+		"canceled", stats.Canceled, "unknown_trips", stats.UnknownTrips, "duration", time.Since(start).Round(time.Millisecond).String())
+	return nil
+}
+
+func pollPositions(ctx context.Context, client *http.Client, publisher *mqtt.Publisher, agencyID, feedURL string) error {
+	feed, err := realtime.Fetch(ctx, client, feedURL)
+	if err != nil {
+		return err
+	}
+
+	positions := gtfsrt.VehiclePositions(feed, agencyID)
+	published := 0
+	for i := range positions {
+		if err := publisher.PublishPosition(&positions[i]); err != nil {
+			return fmt.Errorf("failed to publish position of %s: %w", positions[i].VehicleID, err)
+		}
+		published++
+	}
+
+	if publisher != nil {
+		logger.Info("Published vehicle positions", "agency_id", agencyID, "positions", published)
+	}
+	return nil
+}
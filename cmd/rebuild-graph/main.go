@@ -2,97 +2,110 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
+	"math"
 	"os"
 	"time"
 
+	"github.com/passbi/passbi_core/internal/cache"
+	"github.com/passbi/passbi_core/internal/config"
 	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/errreport"
 	"github.com/passbi/passbi_core/internal/graph"
+	"github.com/passbi/passbi_core/internal/logging"
 )
 
 func main() {
-	log.Println("🔄 PassBi Core - Graph Rebuild Tool")
-	log.Println("===================================")
+	// Settings from the PASSBI_CONFIG file, under the environment
+	config.MustSetup("rebuild-graph")
+
+	yes := flag.Bool("yes", false, "Skip the confirmation prompt (for scripts; the API offers POST /admin/graph/rebuild)")
+	flag.Parse()
+
+	logging.Setup("rebuild-graph")
+	logger := logging.For("graph")
+	errreport.Init("rebuild-graph")
+	defer errreport.Flush(5 * time.Second)
 
 	// Connect to database
-	log.Println("📡 Connecting to database...")
 	dbPool, err := db.GetDB()
 	if err != nil {
-		log.Fatalf("❌ Failed to connect to database: %v", err)
+		logging.Fatal(logger, "Failed to connect to database", "error", err)
 	}
 	defer db.Close()
 
-	log.Println("✅ Database connected")
-
 	ctx := context.Background()
 
 	// Check data availability
 	var stopCount, routeCount, tripCount int
 	err = dbPool.QueryRow(ctx, "SELECT COUNT(*) FROM stop").Scan(&stopCount)
 	if err != nil {
-		log.Fatalf("❌ Failed to count stops: %v", err)
+		logging.Fatal(logger, "Failed to count stops", "error", err)
 	}
 	err = dbPool.QueryRow(ctx, "SELECT COUNT(*) FROM route").Scan(&routeCount)
 	if err != nil {
-		log.Fatalf("❌ Failed to count routes: %v", err)
+		logging.Fatal(logger, "Failed to count routes", "error", err)
 	}
 	err = dbPool.QueryRow(ctx, "SELECT COUNT(*) FROM trip").Scan(&tripCount)
 	if err != nil {
-		log.Fatalf("❌ Failed to count trips: %v", err)
+		logging.Fatal(logger, "Failed to count trips", "error", err)
 	}
 
-	log.Printf("📊 Database statistics:")
-	log.Printf("   Stops: %d", stopCount)
-	log.Printf("   Routes: %d", routeCount)
-	log.Printf("   Trips: %d", tripCount)
+	logger.Info("Database statistics", "stops", stopCount, "routes", routeCount, "trips", tripCount)
 
 	if stopCount == 0 || routeCount == 0 || tripCount == 0 {
-		log.Fatalf("❌ No data found in database. Import GTFS data first!")
+		logging.Fatal(logger, "No data found in database; import GTFS data first")
 	}
 
 	// Confirm rebuild
-	fmt.Println()
-	fmt.Println("⚠️  This will DELETE all existing nodes and edges!")
-	fmt.Print("Continue? (yes/no): ")
-	var confirm string
-	fmt.Scanln(&confirm)
-
-	if confirm != "yes" && confirm != "y" {
-		log.Println("❌ Rebuild cancelled")
-		os.Exit(0)
+	if !*yes {
+		fmt.Println()
+		fmt.Println("⚠️  This will DELETE all existing nodes and edges!")
+		fmt.Print("Continue? (yes/no): ")
+		var confirm string
+		fmt.Scanln(&confirm)
+
+		if confirm != "yes" && confirm != "y" {
+			logger.Info("Rebuild cancelled")
+			os.Exit(0)
+		}
 	}
 
 	// Rebuild graph
-	fmt.Println()
-	log.Println("🔄 Starting graph rebuild...")
+	logger.Info("Starting graph rebuild")
 	startTime := time.Now()
 
 	builder := graph.NewBuilder(dbPool)
+	builder.Progress = func(step string, percent int) {
+		logger.Info("Graph rebuild progress", "step", step, "percent", percent)
+	}
 	err = builder.BuildGraphFromDB(ctx)
 	if err != nil {
-		log.Fatalf("❌ Failed to rebuild graph: %v", err)
+		logging.Fatal(logger, "Failed to rebuild graph", "error", err)
 	}
 
 	duration := time.Since(startTime)
 
+	if _, err := cache.BumpDataVersion(ctx); err != nil {
+		logger.Warn("Failed to invalidate cached responses (they expire with their TTL)", "error", err)
+	}
+	if err := graph.NotifyReload(ctx, dbPool, "rebuild", ""); err != nil {
+		logger.Warn("Failed to notify graph reload (restart API instances to load the new graph)", "error", err)
+	}
+
 	// Show results
 	var nodeCount, edgeCount int
 	err = dbPool.QueryRow(ctx, "SELECT COUNT(*) FROM node").Scan(&nodeCount)
 	if err != nil {
-		log.Printf("⚠️  Failed to count nodes: %v", err)
+		logger.Warn("Failed to count nodes", "error", err)
 	}
 	err = dbPool.QueryRow(ctx, "SELECT COUNT(*) FROM edge").Scan(&edgeCount)
 	if err != nil {
-		log.Printf("⚠️  Failed to count edges: %v", err)
+		logger.Warn("Failed to count edges", "error", err)
 	}
 
-	fmt.Println()
-	log.Println("✅ Graph rebuild completed!")
-	log.Printf("⏱️  Duration: %v", duration)
-	log.Printf("📊 Graph statistics:")
-	log.Printf("   Nodes: %d", nodeCount)
-	log.Printf("   Edges: %d", edgeCount)
+	stats := []any{"duration", duration.String(), "nodes", nodeCount, "edges", edgeCount}
 
 	// Check coverage
 	var stopsWithNodes int
@@ -101,9 +114,8 @@ func main() {
 	`).Scan(&stopsWithNodes)
 	if err == nil {
 		coverage := float64(stopsWithNodes) / float64(stopCount) * 100
-		log.Printf("   Stop coverage: %d/%d (%.1f%%)", stopsWithNodes, stopCount, coverage)
+		stats = append(stats, "stops_with_nodes", stopsWithNodes, "stop_coverage_pct", math.Round(coverage*10)/10)
 	}
 
-	fmt.Println()
-	log.Println("🚀 Graph is ready for routing!")
+	logger.Info("Graph rebuild completed; the graph is ready for routing", stats...)
 }
@@ -0,0 +1,418 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/models"
+)
+
+// ErrNotFound is returned when an alert ID does not exist
+var ErrNotFound = errors.New("alert not found")
+
+// ErrNotProvisional is returned when confirming an alert already confirmed
+// or created by staff
+var ErrNotProvisional = errors.New("alert is not provisional")
+
+// Sources of an alert
+const (
+	SourceManual     = "manual"     // created through /admin/alerts
+	SourceHeadway    = "headway"    // a route running bunched or with gaps
+	SourceDisruption = "disruption" // a route at a standstill or mostly cancelled
+)
+
+// Causes maps GTFS-Realtime Alert.Cause names to their enum values
+var Causes = map[string]int32{
+	"UNKNOWN_CAUSE":     1,
+	"OTHER_CAUSE":       2,
+	"TECHNICAL_PROBLEM": 3,
+	"STRIKE":            4,
+	"DEMONSTRATION":     5,
+	"ACCIDENT":          6,
+	"HOLIDAY":           7,
+	"WEATHER":           8,
+	"MAINTENANCE":       9,
+	"CONSTRUCTION":      10,
+	"POLICE_ACTIVITY":   11,
+	"MEDICAL_EMERGENCY": 12,
+}
+
+// Effects maps GTFS-Realtime Alert.Effect names to their enum values
+var Effects = map[string]int32{
+	"NO_SERVICE":          1,
+	"REDUCED_SERVICE":     2,
+	"SIGNIFICANT_DELAYS":  3,
+	"DETOUR":              4,
+	"ADDITIONAL_SERVICE":  5,
+	"MODIFIED_SERVICE":    6,
+	"OTHER_EFFECT":        7,
+	"UNKNOWN_EFFECT":      8,
+	"STOP_MOVED":          9,
+	"NO_EFFECT":           10,
+	"ACCESSIBILITY_ISSUE": 11,
+}
+
+// Filter narrows down an alert listing
+type Filter struct {
+	ActiveAt  *time.Time // only alerts whose window contains this instant (nil = any)
+	EndsAfter *time.Time // only alerts not yet ended at this instant, including upcoming ones
+	RouteIDs  []string   // alerts affecting any of these routes (or their agencies)
+	StopIDs   []string   // alerts affecting any of these stops
+	Severity  models.AlertSeverity
+	Source    string // only alerts from this source ("" = any)
+	// Only provisional alerts when true, only confirmed ones when false
+	Provisional *bool
+}
+
+// Normalize fills defaults and validates an alert before it is stored
+func Normalize(a *models.ServiceAlert) error {
+	a.Title = strings.TrimSpace(a.Title)
+	if a.Title == "" {
+		return fmt.Errorf("title is required")
+	}
+
+	if a.Severity == "" {
+		a.Severity = models.SeverityWarning
+	}
+	if a.Source == "" {
+		a.Source = SourceManual
+	}
+	switch a.Source {
+	case SourceManual, SourceHeadway, SourceDisruption:
+	default:
+		return fmt.Errorf("invalid source %q", a.Source)
+	}
+	switch a.Severity {
+	case models.SeverityInfo, models.SeverityWarning, models.SeveritySevere:
+	default:
+		return fmt.Errorf("invalid severity %q (use info, warning or severe)", a.Severity)
+	}
+
+	a.Cause = strings.ToUpper(strings.TrimSpace(a.Cause))
+	if a.Cause == "" {
+		a.Cause = "UNKNOWN_CAUSE"
+	}
+	if _, ok := Causes[a.Cause]; !ok {
+		return fmt.Errorf("invalid cause %q", a.Cause)
+	}
+
+	a.Effect = strings.ToUpper(strings.TrimSpace(a.Effect))
+	if a.Effect == "" {
+		a.Effect = "UNKNOWN_EFFECT"
+	}
+	if _, ok := Effects[a.Effect]; !ok {
+		return fmt.Errorf("invalid effect %q", a.Effect)
+	}
+
+	if a.StartsAt.IsZero() {
+		a.StartsAt = time.Now().UTC()
+	}
+	if a.EndsAt != nil && !a.EndsAt.After(a.StartsAt) {
+		return fmt.Errorf("ends_at must be after starts_at")
+	}
+
+	for i, e := range a.Entities {
+		if e.AgencyID == "" && e.RouteID == "" && e.StopID == "" {
+			return fmt.Errorf("entity %d must reference an agency, route or stop", i)
+		}
+	}
+	if a.Entities == nil {
+		a.Entities = []models.AlertEntity{}
+	}
+
+	return nil
+}
+
+// List returns alerts matching the filter, most severe first
+// Alerts without entities are network-wide and match any route/stop filter
+func List(ctx context.Context, db *pgxpool.Pool, f Filter) ([]models.ServiceAlert, error) {
+	routeIDs := f.RouteIDs
+	if routeIDs == nil {
+		routeIDs = []string{}
+	}
+	stopIDs := f.StopIDs
+	if stopIDs == nil {
+		stopIDs = []string{}
+	}
+	var severity *string
+	if f.Severity != "" {
+		s := string(f.Severity)
+		severity = &s
+	}
+	var source *string
+	if f.Source != "" {
+		source = &f.Source
+	}
+
+	query := `
+		SELECT a.id, a.title, COALESCE(a.description, ''), COALESCE(a.url, ''),
+			a.severity, a.cause, a.effect, a.starts_at, a.ends_at, a.source, a.provisional,
+			a.created_at, a.updated_at
+		FROM service_alert a
+		WHERE ($1::timestamptz IS NULL OR (a.starts_at <= $1 AND (a.ends_at IS NULL OR a.ends_at > $1)))
+		  AND ($2::text IS NULL OR a.severity = $2)
+		  AND ($5::timestamptz IS NULL OR a.ends_at IS NULL OR a.ends_at > $5)
+		  AND ($6::text IS NULL OR a.source = $6)
+		  AND ($7::boolean IS NULL OR a.provisional = $7)
+		  AND (
+			(cardinality($3::text[]) = 0 AND cardinality($4::text[]) = 0)
+			OR NOT EXISTS (SELECT 1 FROM service_alert_entity e WHERE e.alert_id = a.id)
+			OR EXISTS (
+				SELECT 1 FROM service_alert_entity e
+				WHERE e.alert_id = a.id
+				  AND (
+					e.route_id = ANY($3::text[])
+					OR e.stop_id = ANY($4::text[])
+					OR (e.route_id IS NULL AND e.stop_id IS NULL
+						AND e.agency_id IN (SELECT r.agency_id FROM route r WHERE r.id = ANY($3::text[])))
+				  )
+			)
+		  )
+		ORDER BY
+			CASE a.severity WHEN 'severe' THEN 0 WHEN 'warning' THEN 1 ELSE 2 END,
+			a.starts_at DESC
+	`
+
+	rows, err := db.Query(ctx, query, f.ActiveAt, severity, routeIDs, stopIDs, f.EndsAfter, source, f.Provisional)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alerts: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.ServiceAlert
+	index := make(map[int64]int)
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		index[a.ID] = len(result)
+		result = append(result, *a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(result) == 0 {
+		return []models.ServiceAlert{}, nil
+	}
+
+	ids := make([]int64, 0, len(result))
+	for _, a := range result {
+		ids = append(ids, a.ID)
+	}
+	entities, err := loadEntities(ctx, db, ids)
+	if err != nil {
+		return nil, err
+	}
+	for id, ents := range entities {
+		result[index[id]].Entities = ents
+	}
+
+	return result, nil
+}
+
+// Get returns a single alert with its entities
+func Get(ctx context.Context, db *pgxpool.Pool, id int64) (*models.ServiceAlert, error) {
+	row := db.QueryRow(ctx, `
+		SELECT id, title, COALESCE(description, ''), COALESCE(url, ''),
+			severity, cause, effect, starts_at, ends_at, source, provisional, created_at, updated_at
+		FROM service_alert
+		WHERE id = $1
+	`, id)
+
+	a, err := scanAlert(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entities, err := loadEntities(ctx, db, []int64{id})
+	if err != nil {
+		return nil, err
+	}
+	a.Entities = entities[id]
+
+	return a, nil
+}
+
+// Create inserts a new alert and its entities
+func Create(ctx context.Context, db *pgxpool.Pool, a *models.ServiceAlert) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := CreateTx(ctx, tx, a); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// CreateTx inserts a new alert and its entities within a transaction
+func CreateTx(ctx context.Context, tx pgx.Tx, a *models.ServiceAlert) error {
+	err := tx.QueryRow(ctx, `
+		INSERT INTO service_alert (title, description, url, severity, cause, effect, starts_at, ends_at, source, provisional)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6, $7, $8, COALESCE(NULLIF($9, ''), 'manual'), $10)
+		RETURNING id, created_at, updated_at
+	`, a.Title, a.Description, a.URL, a.Severity, a.Cause, a.Effect, a.StartsAt, a.EndsAt, a.Source, a.Provisional,
+	).Scan(&a.ID, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert alert: %w", err)
+	}
+
+	return insertEntities(ctx, tx, a.ID, a.Entities)
+}
+
+// Update replaces an alert's fields and entities; its source and whether it
+// is provisional are kept
+func Update(ctx context.Context, db *pgxpool.Pool, a *models.ServiceAlert) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		UPDATE service_alert
+		SET title = $2, description = NULLIF($3, ''), url = NULLIF($4, ''),
+		    severity = $5, cause = $6, effect = $7, starts_at = $8, ends_at = $9
+		WHERE id = $1
+		RETURNING source, provisional, created_at, updated_at
+	`, a.ID, a.Title, a.Description, a.URL, a.Severity, a.Cause, a.Effect, a.StartsAt, a.EndsAt,
+	).Scan(&a.Source, &a.Provisional, &a.CreatedAt, &a.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update alert: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM service_alert_entity WHERE alert_id = $1`, a.ID); err != nil {
+		return fmt.Errorf("failed to clear alert entities: %w", err)
+	}
+	if err := insertEntities(ctx, tx, a.ID, a.Entities); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Expire ends an alert's active window at the given time
+func Expire(ctx context.Context, db *pgxpool.Pool, id int64, at time.Time) error {
+	tag, err := db.Exec(ctx, `
+		UPDATE service_alert
+		SET ends_at = GREATEST($2, starts_at + INTERVAL '1 second')
+		WHERE id = $1
+	`, id, at)
+	if err != nil {
+		return fmt.Errorf("failed to expire alert: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Confirm marks a provisional alert as reviewed by staff: it stays up until
+// endsAt, or until ended when nil, and automatic detection no longer ends it
+func Confirm(ctx context.Context, db *pgxpool.Pool, id int64, endsAt *time.Time) error {
+	tag, err := db.Exec(ctx, `
+		UPDATE service_alert SET provisional = false, ends_at = $2
+		WHERE id = $1 AND provisional
+	`, id, endsAt)
+	if err != nil {
+		return fmt.Errorf("failed to confirm alert: %w", err)
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+
+	if _, err := Get(ctx, db, id); err != nil {
+		return err
+	}
+	return ErrNotProvisional
+}
+
+// Delete permanently removes an alert
+func Delete(ctx context.Context, db *pgxpool.Pool, id int64) error {
+	tag, err := db.Exec(ctx, `DELETE FROM service_alert WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete alert: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanAlert(row pgx.Row) (*models.ServiceAlert, error) {
+	var a models.ServiceAlert
+	var severity string
+	if err := row.Scan(&a.ID, &a.Title, &a.Description, &a.URL,
+		&severity, &a.Cause, &a.Effect, &a.StartsAt, &a.EndsAt, &a.Source, &a.Provisional,
+		&a.CreatedAt, &a.UpdatedAt); err != nil {
+		return nil, err
+	}
+	a.Severity = models.AlertSeverity(severity)
+	a.Entities = []models.AlertEntity{}
+	return &a, nil
+}
+
+func loadEntities(ctx context.Context, db *pgxpool.Pool, alertIDs []int64) (map[int64][]models.AlertEntity, error) {
+	rows, err := db.Query(ctx, `
+		SELECT alert_id, COALESCE(agency_id, ''), COALESCE(route_id, ''), COALESCE(stop_id, '')
+		FROM service_alert_entity
+		WHERE alert_id = ANY($1)
+		ORDER BY id
+	`, alertIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alert entities: %w", err)
+	}
+	defer rows.Close()
+
+	entities := make(map[int64][]models.AlertEntity)
+	for rows.Next() {
+		var alertID int64
+		var e models.AlertEntity
+		if err := rows.Scan(&alertID, &e.AgencyID, &e.RouteID, &e.StopID); err != nil {
+			return nil, err
+		}
+		entities[alertID] = append(entities[alertID], e)
+	}
+
+	return entities, rows.Err()
+}
+
+func insertEntities(ctx context.Context, tx pgx.Tx, alertID int64, entities []models.AlertEntity) error {
+	if len(entities) == 0 {
+		return nil
+	}
+
+	batch := &pgx.Batch{}
+	for _, e := range entities {
+		batch.Queue(`
+			INSERT INTO service_alert_entity (alert_id, agency_id, route_id, stop_id)
+			VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, ''))
+		`, alertID, e.AgencyID, e.RouteID, e.StopID)
+	}
+
+	results := tx.SendBatch(ctx, batch)
+	defer results.Close()
+
+	for i := 0; i < batch.Len(); i++ {
+		if _, err := results.Exec(); err != nil {
+			return fmt.Errorf("failed to insert alert entity %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	t.Run("Fills defaults", func(t *testing.T) {
+		a := &models.ServiceAlert{Title: "  Grève AFTU  "}
+		assert.NoError(t, Normalize(a))
+		assert.Equal(t, "Grève AFTU", a.Title)
+		assert.Equal(t, models.SeverityWarning, a.Severity)
+		assert.Equal(t, "UNKNOWN_CAUSE", a.Cause)
+		assert.Equal(t, "UNKNOWN_EFFECT", a.Effect)
+		assert.Equal(t, SourceManual, a.Source)
+		assert.False(t, a.StartsAt.IsZero())
+		assert.NotNil(t, a.Entities)
+	})
+
+	t.Run("Upper-cases cause and effect", func(t *testing.T) {
+		a := &models.ServiceAlert{Title: "Strike", Cause: "strike", Effect: "no_service"}
+		assert.NoError(t, Normalize(a))
+		assert.Equal(t, "STRIKE", a.Cause)
+		assert.Equal(t, "NO_SERVICE", a.Effect)
+	})
+
+	t.Run("Rejects missing title", func(t *testing.T) {
+		assert.Error(t, Normalize(&models.ServiceAlert{}))
+	})
+
+	t.Run("Rejects unknown severity", func(t *testing.T) {
+		assert.Error(t, Normalize(&models.ServiceAlert{Title: "x", Severity: "critical"}))
+	})
+
+	t.Run("Rejects unknown cause", func(t *testing.T) {
+		assert.Error(t, Normalize(&models.ServiceAlert{Title: "x", Cause: "ALIENS"}))
+	})
+
+	t.Run("Rejects unknown source", func(t *testing.T) {
+		assert.Error(t, Normalize(&models.ServiceAlert{Title: "x", Source: "twitter"}))
+	})
+
+	t.Run("Rejects inverted window", func(t *testing.T) {
+		start := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+		end := start.Add(-time.Hour)
+		assert.Error(t, Normalize(&models.ServiceAlert{Title: "x", StartsAt: start, EndsAt: &end}))
+	})
+
+	t.Run("Rejects empty entity", func(t *testing.T) {
+		a := &models.ServiceAlert{Title: "x", Entities: []models.AlertEntity{{}}}
+		assert.Error(t, Normalize(a))
+	})
+}
+
+func TestServiceAlertIsActive(t *testing.T) {
+	start := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+	a := &models.ServiceAlert{StartsAt: start, EndsAt: &end}
+
+	assert.False(t, a.IsActive(start.Add(-time.Minute)))
+	assert.True(t, a.IsActive(start))
+	assert.True(t, a.IsActive(start.Add(time.Hour)))
+	assert.False(t, a.IsActive(end))
+
+	a.EndsAt = nil
+	assert.True(t, a.IsActive(start.Add(1000*time.Hour)))
+}
@@ -0,0 +1,463 @@
+// Package anomaly flags API keys whose traffic looks abnormal (sudden volume
+// spikes, crawls through the stops, requests from many addresses) and can
+// suspend them until an admin reviews what happened
+package anomaly
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/passbi/passbi_core/internal/logging"
+)
+
+var logger = logging.For("anomaly")
+
+// ErrNotFound is returned when an anomaly ID does not exist
+var ErrNotFound = errors.New("anomaly not found")
+
+// ErrReviewed is returned when reviewing an anomaly that is no longer open
+var ErrReviewed = errors.New("anomaly already reviewed")
+
+// Kind is the pattern an anomaly matched
+type Kind string
+
+const (
+	KindVolumeSpike Kind = "volume_spike"
+	KindStopCrawl   Kind = "stop_crawl"
+	KindManyIPs     Kind = "many_ips"
+)
+
+// Status is where an anomaly is in review
+type Status string
+
+const (
+	StatusOpen      Status = "open"
+	StatusDismissed Status = "dismissed" // legitimate traffic; the key is restored
+	StatusConfirmed Status = "confirmed" // abuse; the key is revoked
+)
+
+// Anomaly is a key's abnormal traffic over a window
+type Anomaly struct {
+	ID           string                 `json:"id"`
+	PartnerID    string                 `json:"partner_id"`
+	APIKeyID     string                 `json:"api_key_id"`
+	KeyPrefix    string                 `json:"key_prefix"`
+	Kind         Kind                   `json:"kind"`
+	Details      map[string]interface{} `json:"details"`
+	WindowStart  time.Time              `json:"window_start"`
+	WindowEnd    time.Time              `json:"window_end"`
+	KeySuspended bool                   `json:"key_suspended"`
+	Status       Status                 `json:"status"`
+	ReviewNote   string                 `json:"review_note,omitempty"`
+	ReviewedBy   string                 `json:"reviewed_by,omitempty"`
+	ReviewedAt   *time.Time             `json:"reviewed_at,omitempty"`
+	DetectedAt   time.Time              `json:"detected_at"`
+}
+
+// Config holds the detection thresholds
+type Config struct {
+	Interval time.Duration // how often detection runs
+	Window   time.Duration // recent traffic examined on each run
+	Baseline time.Duration // history recent volume is compared to
+
+	SpikeFactor float64 // recent volume over the baseline rate that is a spike
+	MinRequests int     // smaller volumes are never spikes
+	CrawlStops  int     // distinct stops requested in a window that may be a crawl
+	CrawlOrder  float64 // share of consecutive stop requests in ID order that is a crawl
+	MaxIPs      int     // distinct client addresses in a window that is abnormal
+
+	AutoSuspend bool // suspend keys as soon as they are flagged
+}
+
+// DefaultConfig looks at the last hour every 5 minutes and only flags
+func DefaultConfig() Config {
+	return Config{
+		Interval:    5 * time.Minute,
+		Window:      time.Hour,
+		Baseline:    7 * 24 * time.Hour,
+		SpikeFactor: 10,
+		MinRequests: 1000,
+		CrawlStops:  200,
+		CrawlOrder:  0.8,
+		MaxIPs:      50,
+	}
+}
+
+// ConfigFromEnv returns the defaults overridden by ANOMALY_* variables
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	if d, err := time.ParseDuration(os.Getenv("ANOMALY_INTERVAL")); err == nil && d > 0 {
+		cfg.Interval = d
+	}
+	if f, err := strconv.ParseFloat(os.Getenv("ANOMALY_SPIKE_FACTOR"), 64); err == nil && f > 1 {
+		cfg.SpikeFactor = f
+	}
+	if n, err := strconv.Atoi(os.Getenv("ANOMALY_MIN_REQUESTS")); err == nil && n > 0 {
+		cfg.MinRequests = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("ANOMALY_CRAWL_STOPS")); err == nil && n > 0 {
+		cfg.CrawlStops = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("ANOMALY_MAX_IPS")); err == nil && n > 0 {
+		cfg.MaxIPs = n
+	}
+	if b, err := strconv.ParseBool(os.Getenv("ANOMALY_AUTO_SUSPEND")); err == nil {
+		cfg.AutoSuspend = b
+	}
+	return cfg
+}
+
+// keyStats is one key's traffic over a detection window
+type keyStats struct {
+	PartnerID string
+	APIKeyID  string
+	Requests  int
+	Baseline  int // requests over the baseline period before the window
+	IPs       int
+	Stops     int // distinct stops requested
+	StopPairs int // consecutive stop requests
+	Ascending int // consecutive stop requests moving up in ID order
+	Downward  int // consecutive stop requests moving down in ID order
+}
+
+// finding is a pattern matched by a key's traffic
+type finding struct {
+	Kind    Kind
+	Details map[string]interface{}
+}
+
+// evaluate returns the patterns a key's traffic matches
+func (cfg Config) evaluate(s keyStats) []finding {
+	var found []finding
+
+	// Keys without history have no rate to compare to
+	expected := float64(s.Baseline) * cfg.Window.Seconds() / cfg.Baseline.Seconds()
+	if s.Requests >= cfg.MinRequests && expected > 0 && float64(s.Requests) >= cfg.SpikeFactor*expected {
+		found = append(found, finding{KindVolumeSpike, map[string]interface{}{
+			"requests":          s.Requests,
+			"expected_requests": roundTo(expected, 1),
+			"factor":            roundTo(float64(s.Requests)/expected, 1),
+		}})
+	}
+
+	// Apps ask for the same few stops again and again; a scraper walks the
+	// stop IDs in order
+	if s.Stops >= cfg.CrawlStops && s.StopPairs > 0 {
+		ordered := float64(max(s.Ascending, s.Downward)) / float64(s.StopPairs)
+		if ordered >= cfg.CrawlOrder {
+			found = append(found, finding{KindStopCrawl, map[string]interface{}{
+				"distinct_stops": s.Stops,
+				"ordered_share":  roundTo(ordered, 2),
+			}})
+		}
+	}
+
+	if s.IPs >= cfg.MaxIPs {
+		found = append(found, finding{KindManyIPs, map[string]interface{}{
+			"distinct_ips": s.IPs,
+			"requests":     s.Requests,
+		}})
+	}
+
+	return found
+}
+
+func roundTo(v float64, decimals int) float64 {
+	p := 1.0
+	for i := 0; i < decimals; i++ {
+		p *= 10
+	}
+	return float64(int64(v*p+0.5)) / p
+}
+
+// Run flags abnormal keys every cfg.Interval until ctx is done
+// Several instances may run it; an open anomaly is only recorded once
+func Run(ctx context.Context, db *pgxpool.Pool, cfg Config) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			runCtx, cancel := context.WithTimeout(ctx, cfg.Interval)
+			flagged, err := Detect(runCtx, db, cfg, now)
+			cancel()
+			if err != nil {
+				logger.ErrorContext(ctx, "Anomaly detection failed", "error", err)
+				continue
+			}
+			for _, a := range flagged {
+				logger.Warn("Usage anomaly flagged", "anomaly_id", a.ID, "kind", a.Kind,
+					"key_prefix", a.KeyPrefix, "partner_id", a.PartnerID, "details", a.Details, "suspended", a.KeySuspended)
+			}
+		}
+	}
+}
+
+// Detect examines the traffic of the cfg.Window before now and records the
+// anomalies found; it returns those that were not already open
+func Detect(ctx context.Context, db *pgxpool.Pool, cfg Config, now time.Time) ([]Anomaly, error) {
+	windowStart := now.Add(-cfg.Window)
+	stats, err := loadStats(ctx, db, windowStart, now, now.Add(-cfg.Window-cfg.Baseline))
+	if err != nil {
+		return nil, err
+	}
+
+	flagged := []Anomaly{}
+	for _, s := range stats {
+		for _, f := range cfg.evaluate(s) {
+			a := &Anomaly{
+				PartnerID:   s.PartnerID,
+				APIKeyID:    s.APIKeyID,
+				Kind:        f.Kind,
+				Details:     f.Details,
+				WindowStart: windowStart,
+				WindowEnd:   now,
+			}
+			recorded, err := record(ctx, db, a, cfg.AutoSuspend)
+			if err != nil {
+				return flagged, err
+			}
+			if recorded {
+				flagged = append(flagged, *a)
+			}
+		}
+	}
+	return flagged, nil
+}
+
+// loadStats reads the traffic of every key active in [start, end)
+// Stop IDs are compared by length first so numeric IDs sort as numbers
+func loadStats(ctx context.Context, db *pgxpool.Pool, start, end, baselineStart time.Time) ([]keyStats, error) {
+	rows, err := db.Query(ctx, `
+		WITH recent AS (
+			SELECT api_key_id, partner_id, COUNT(*) AS requests, COUNT(DISTINCT ip_address) AS ips
+			FROM usage_log
+			WHERE timestamp >= $1 AND timestamp < $2
+			GROUP BY api_key_id, partner_id
+		),
+		baseline AS (
+			SELECT api_key_id, COUNT(*) AS requests
+			FROM usage_log
+			WHERE timestamp >= $3 AND timestamp < $1
+				AND api_key_id IN (SELECT api_key_id FROM recent)
+			GROUP BY api_key_id
+		),
+		stop_requests AS (
+			SELECT api_key_id, stop_id,
+				LAG(stop_id) OVER (PARTITION BY api_key_id ORDER BY timestamp, id) AS prev
+			FROM usage_log
+			WHERE timestamp >= $1 AND timestamp < $2 AND stop_id IS NOT NULL
+		),
+		stops AS (
+			SELECT api_key_id,
+				COUNT(DISTINCT stop_id) AS stops,
+				COUNT(prev) AS pairs,
+				COUNT(*) FILTER (WHERE (length(stop_id), stop_id) > (length(prev), prev)) AS ascending,
+				COUNT(*) FILTER (WHERE (length(stop_id), stop_id) < (length(prev), prev)) AS downward
+			FROM stop_requests
+			GROUP BY api_key_id
+		)
+		SELECT r.partner_id, r.api_key_id, r.requests, COALESCE(b.requests, 0), r.ips,
+			COALESCE(s.stops, 0), COALESCE(s.pairs, 0), COALESCE(s.ascending, 0), COALESCE(s.downward, 0)
+		FROM recent r
+		LEFT JOIN baseline b ON b.api_key_id = r.api_key_id
+		LEFT JOIN stops s ON s.api_key_id = r.api_key_id
+	`, start, end, baselineStart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key traffic: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []keyStats
+	for rows.Next() {
+		var s keyStats
+		if err := rows.Scan(&s.PartnerID, &s.APIKeyID, &s.Requests, &s.Baseline, &s.IPs,
+			&s.Stops, &s.StopPairs, &s.Ascending, &s.Downward); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// record stores an anomaly unless the key already has one of its kind open,
+// and suspends the key when asked
+func record(ctx context.Context, db *pgxpool.Pool, a *Anomaly, suspend bool) (bool, error) {
+	details, err := json.Marshal(a.Details)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO usage_anomaly (partner_id, api_key_id, kind, details, window_start, window_end, key_suspended)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (api_key_id, kind) WHERE status = 'open' DO NOTHING
+		RETURNING id, detected_at
+	`, a.PartnerID, a.APIKeyID, a.Kind, details, a.WindowStart, a.WindowEnd, suspend).Scan(&a.ID, &a.DetectedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to record anomaly: %w", err)
+	}
+
+	if suspend {
+		_, err = tx.Exec(ctx, `
+			UPDATE api_key
+			SET suspended_at = COALESCE(suspended_at, NOW()),
+				suspended_reason = COALESCE(suspended_reason, $2)
+			WHERE id = $1
+		`, a.APIKeyID, string(a.Kind))
+		if err != nil {
+			return false, fmt.Errorf("failed to suspend key: %w", err)
+		}
+	}
+
+	if err := tx.QueryRow(ctx, `SELECT key_prefix FROM api_key WHERE id = $1`, a.APIKeyID).Scan(&a.KeyPrefix); err != nil {
+		return false, err
+	}
+	a.KeySuspended = suspend
+	a.Status = StatusOpen
+	return true, tx.Commit(ctx)
+}
+
+// Filter narrows List
+type Filter struct {
+	Status    Status
+	Kind      Kind
+	PartnerID string
+	APIKeyID  string
+	Limit     int
+	Offset    int
+}
+
+const selectAnomaly = `
+	SELECT a.id, a.partner_id, a.api_key_id, ak.key_prefix, a.kind, a.details,
+		a.window_start, a.window_end, a.key_suspended, a.status, COALESCE(a.review_note, ''),
+		COALESCE(a.reviewed_by, ''), a.reviewed_at, a.detected_at
+	FROM usage_anomaly a
+	JOIN api_key ak ON ak.id = a.api_key_id
+`
+
+func scanAnomaly(row pgx.Row) (*Anomaly, error) {
+	a := &Anomaly{}
+	err := row.Scan(&a.ID, &a.PartnerID, &a.APIKeyID, &a.KeyPrefix, &a.Kind, &a.Details,
+		&a.WindowStart, &a.WindowEnd, &a.KeySuspended, &a.Status, &a.ReviewNote,
+		&a.ReviewedBy, &a.ReviewedAt, &a.DetectedAt)
+	return a, err
+}
+
+// List returns anomalies, newest first, and the total matching f
+func List(ctx context.Context, db *pgxpool.Pool, f Filter) ([]Anomaly, int, error) {
+	where := ` WHERE ($1 = '' OR a.status = $1)
+		AND ($2 = '' OR a.kind = $2)
+		AND ($3 = '' OR a.partner_id::text = $3)
+		AND ($4 = '' OR a.api_key_id::text = $4)`
+	args := []interface{}{string(f.Status), string(f.Kind), f.PartnerID, f.APIKeyID}
+
+	var total int
+	if err := db.QueryRow(ctx, `SELECT COUNT(*) FROM usage_anomaly a`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(ctx, selectAnomaly+where+` ORDER BY a.detected_at DESC LIMIT $5 OFFSET $6`,
+		append(args, f.Limit, f.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	list := []Anomaly{}
+	for rows.Next() {
+		a, err := scanAnomaly(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		list = append(list, *a)
+	}
+	return list, total, rows.Err()
+}
+
+// Get returns one anomaly
+func Get(ctx context.Context, db *pgxpool.Pool, id string) (*Anomaly, error) {
+	a, err := scanAnomaly(db.QueryRow(ctx, selectAnomaly+` WHERE a.id::text = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return a, err
+}
+
+// Review closes an open anomaly
+// Dismissing it lifts the key's suspension unless another open anomaly
+// suspended it too; confirming it revokes the key
+func Review(ctx context.Context, db *pgxpool.Pool, id string, status Status, note, reviewer string) (*Anomaly, error) {
+	if status != StatusDismissed && status != StatusConfirmed {
+		return nil, fmt.Errorf("invalid status %q (use dismissed or confirmed)", status)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var keyID string
+	var current Status
+	err = tx.QueryRow(ctx, `SELECT api_key_id, status FROM usage_anomaly WHERE id::text = $1 FOR UPDATE`, id).
+		Scan(&keyID, &current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if current != StatusOpen {
+		return nil, ErrReviewed
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE usage_anomaly
+		SET status = $2, review_note = NULLIF($3, ''), reviewed_by = NULLIF($4, ''), reviewed_at = NOW()
+		WHERE id::text = $1
+	`, id, status, note, reviewer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to review anomaly: %w", err)
+	}
+
+	if status == StatusConfirmed {
+		_, err = tx.Exec(ctx, `UPDATE api_key SET is_active = false WHERE id = $1`, keyID)
+	} else {
+		_, err = tx.Exec(ctx, `
+			UPDATE api_key SET suspended_at = NULL, suspended_reason = NULL
+			WHERE id = $1 AND NOT EXISTS (
+				SELECT 1 FROM usage_anomaly
+				WHERE api_key_id = $1 AND status = 'open' AND key_suspended
+			)
+		`, keyID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update key: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return Get(ctx, db, id)
+}
@@ -0,0 +1,65 @@
+package anomaly
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func kinds(found []finding) []Kind {
+	var k []Kind
+	for _, f := range found {
+		k = append(k, f.Kind)
+	}
+	return k
+}
+
+func TestEvaluateVolumeSpike(t *testing.T) {
+	cfg := DefaultConfig()
+
+	// 16,800 requests a week is 100 an hour
+	assert.Equal(t, []Kind{KindVolumeSpike}, kinds(cfg.evaluate(keyStats{Requests: 1000, Baseline: 16800})))
+	assert.Empty(t, cfg.evaluate(keyStats{Requests: 999, Baseline: 16800}), "under MinRequests")
+	assert.Empty(t, cfg.evaluate(keyStats{Requests: 5000, Baseline: 168000}), "5x is not a spike")
+	assert.Empty(t, cfg.evaluate(keyStats{Requests: 5000}), "no history")
+
+	f := cfg.evaluate(keyStats{Requests: 2000, Baseline: 16800})[0]
+	assert.Equal(t, 20.0, f.Details["factor"])
+}
+
+func TestEvaluateStopCrawl(t *testing.T) {
+	cfg := DefaultConfig()
+
+	crawl := keyStats{Requests: 300, Stops: 300, StopPairs: 299, Ascending: 290, Downward: 9}
+	assert.Equal(t, []Kind{KindStopCrawl}, kinds(cfg.evaluate(crawl)))
+
+	backwards := keyStats{Requests: 300, Stops: 300, StopPairs: 299, Downward: 299}
+	assert.Equal(t, []Kind{KindStopCrawl}, kinds(cfg.evaluate(backwards)))
+
+	// A busy app asks for many stops in no particular order
+	app := keyStats{Requests: 5000, Stops: 400, StopPairs: 4999, Ascending: 2400, Downward: 2300}
+	assert.Empty(t, cfg.evaluate(app))
+
+	few := keyStats{Requests: 100, Stops: 100, StopPairs: 99, Ascending: 99}
+	assert.Empty(t, cfg.evaluate(few), "under CrawlStops")
+}
+
+func TestEvaluateManyIPs(t *testing.T) {
+	cfg := DefaultConfig()
+
+	assert.Equal(t, []Kind{KindManyIPs}, kinds(cfg.evaluate(keyStats{Requests: 80, IPs: 50})))
+	assert.Empty(t, cfg.evaluate(keyStats{Requests: 80, IPs: 49}))
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("ANOMALY_INTERVAL", "1m")
+	t.Setenv("ANOMALY_MAX_IPS", "20")
+	t.Setenv("ANOMALY_AUTO_SUSPEND", "true")
+	t.Setenv("ANOMALY_SPIKE_FACTOR", "0.5")
+
+	cfg := ConfigFromEnv()
+	assert.Equal(t, "1m0s", cfg.Interval.String())
+	assert.Equal(t, 20, cfg.MaxIPs)
+	assert.True(t, cfg.AutoSuspend)
+	assert.Equal(t, 10.0, cfg.SpikeFactor, "a factor under 1 is ignored")
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/middleware"
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/passbi/passbi_core/internal/repository"
+)
+
+// Keys restricted to some agencies (api_key.allowed_agencies) only see those
+// agencies' routes, stops, departures and itineraries; routes of other
+// agencies answer 404 as if they did not exist
+
+// keyAgencies returns the agencies the calling key is restricted to, or nil
+// when it may see every agency's data
+func keyAgencies(c *fiber.Ctx) []string {
+	if partner, ok := c.Locals("partner").(*middleware.PartnerContext); ok {
+		return partner.Agencies
+	}
+	return nil
+}
+
+// agencyAllowed reports whether a restriction lets an agency through
+func agencyAllowed(agencies []string, agencyID string) bool {
+	if len(agencies) == 0 {
+		return true
+	}
+	for _, a := range agencies {
+		if a == agencyID {
+			return true
+		}
+	}
+	return false
+}
+
+// routeHidden reports whether a route belongs to an agency outside the
+// restriction; unknown routes are left to the handler's own 404
+func routeHidden(ctx context.Context, agencies []string, routeID string) bool {
+	if len(agencies) == 0 {
+		return false
+	}
+
+	pool, err := db.ReadDB()
+	if err != nil {
+		return true
+	}
+
+	route, err := repository.GetRoute(ctx, pool, routeID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Route agency query error", "error", err)
+		return true
+	}
+	return !agencyAllowed(agencies, route.AgencyID)
+}
+
+// stopHidden reports whether no route of the allowed agencies calls at a stop
+func stopHidden(ctx context.Context, agencies []string, stopID string) bool {
+	if len(agencies) == 0 {
+		return false
+	}
+
+	pool, err := db.ReadDB()
+	if err != nil {
+		return true
+	}
+
+	var served bool
+	err = pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM node n JOIN route r ON r.id = n.route_id
+			WHERE n.stop_id = $1 AND r.agency_id = ANY($2)
+		)
+	`, stopID, agencies).Scan(&served)
+	if err != nil {
+		logger.ErrorContext(ctx, "Stop agency query error", "error", err)
+		return true
+	}
+	return !served
+}
+
+// agencyRoutes returns the IDs of the routes of the given agencies
+func agencyRoutes(ctx context.Context, agencies []string) (map[string]bool, error) {
+	pool, err := db.ReadDB()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := pool.Query(ctx, `SELECT id FROM route WHERE agency_id = ANY($1)`, agencies)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	routes := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		routes[id] = true
+	}
+	return routes, rows.Err()
+}
+
+// stepsAllowed reports whether every ride of an itinerary is on one of the
+// allowed routes
+func stepsAllowed(steps []models.Step, routes map[string]bool) bool {
+	for _, step := range steps {
+		if step.Type == models.EdgeRide && !routes[step.Route] {
+			return false
+		}
+	}
+	return true
+}
+
+// scopeAlerts keeps the alerts a restricted key may see: network-wide ones,
+// and those informing an allowed agency, one of its routes or a stop, with
+// the entities of other agencies removed
+func scopeAlerts(list []models.ServiceAlert, agencies []string, routes map[string]bool) []models.ServiceAlert {
+	scoped := []models.ServiceAlert{}
+	for _, a := range list {
+		if len(a.Entities) == 0 {
+			scoped = append(scoped, a)
+			continue
+		}
+		var entities []models.AlertEntity
+		for _, e := range a.Entities {
+			switch {
+			case e.RouteID != "":
+				if routes[e.RouteID] {
+					entities = append(entities, e)
+				}
+			case e.AgencyID != "":
+				if agencyAllowed(agencies, e.AgencyID) {
+					entities = append(entities, e)
+				}
+			default:
+				entities = append(entities, e)
+			}
+		}
+		if len(entities) > 0 {
+			a.Entities = entities
+			scoped = append(scoped, a)
+		}
+	}
+	return scoped
+}
+
+// normalizeAgencies returns the agencies a key is restricted to sorted and
+// without duplicates, and those that have no routes; nil means no restriction
+func normalizeAgencies(ctx context.Context, pool *pgxpool.Pool, requested []string) (agencies, unknown []string, err error) {
+	seen := map[string]bool{}
+	for _, a := range requested {
+		a = strings.TrimSpace(a)
+		if a == "" || seen[a] {
+			continue
+		}
+		seen[a] = true
+		agencies = append(agencies, a)
+	}
+	if len(agencies) == 0 {
+		return nil, nil, nil
+	}
+	sort.Strings(agencies)
+
+	rows, err := pool.Query(ctx, `SELECT DISTINCT agency_id FROM route WHERE agency_id = ANY($1)`, agencies)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	known := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, nil, err
+		}
+		known[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	for _, a := range agencies {
+		if !known[a] {
+			unknown = append(unknown, a)
+		}
+	}
+	return agencies, unknown, nil
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgencyAllowed(t *testing.T) {
+	assert.True(t, agencyAllowed(nil, "DDD"), "unrestricted key")
+	assert.True(t, agencyAllowed([]string{"AFTU", "DDD"}, "DDD"))
+	assert.False(t, agencyAllowed([]string{"AFTU"}, "DDD"))
+}
+
+func TestStepsAllowed(t *testing.T) {
+	routes := map[string]bool{"DDD_1": true}
+	steps := []models.Step{
+		{Type: models.EdgeWalk},
+		{Type: models.EdgeRide, Route: "DDD_1"},
+		{Type: models.EdgeTransfer},
+	}
+	assert.True(t, stepsAllowed(steps, routes))
+
+	steps = append(steps, models.Step{Type: models.EdgeRide, Route: "AFTU_8"})
+	assert.False(t, stepsAllowed(steps, routes), "a ride on another agency's route")
+}
+
+func TestScopeAlerts(t *testing.T) {
+	list := []models.ServiceAlert{
+		{ID: 1},
+		{ID: 2, Entities: []models.AlertEntity{{AgencyID: "AFTU"}}},
+		{ID: 3, Entities: []models.AlertEntity{{RouteID: "DDD_1"}, {RouteID: "AFTU_8"}}},
+		{ID: 4, Entities: []models.AlertEntity{{AgencyID: "DDD", RouteID: "AFTU_8"}}},
+		{ID: 5, Entities: []models.AlertEntity{{StopID: "S1"}}},
+	}
+
+	scoped := scopeAlerts(list, []string{"DDD"}, map[string]bool{"DDD_1": true})
+	if !assert.Len(t, scoped, 3) {
+		return
+	}
+	assert.Equal(t, int64(1), scoped[0].ID, "network-wide")
+	assert.Equal(t, int64(3), scoped[1].ID)
+	assert.Equal(t, []models.AlertEntity{{RouteID: "DDD_1"}}, scoped[1].Entities)
+	assert.Equal(t, int64(5), scoped[2].ID, "stops are shared")
+	assert.Len(t, list[2].Entities, 2, "the input is left untouched")
+}
+
+func TestAgencyDepartures(t *testing.T) {
+	departures := []DepartureInfo{
+		{TripID: "t1", AgencyID: "AFTU"},
+		{TripID: "t2", AgencyID: "DDD"},
+		{TripID: "t3", AgencyID: "AFTU"},
+		{TripID: "t4", AgencyID: "DDD"},
+		{TripID: "t5", AgencyID: "DDD"},
+	}
+
+	kept := agencyDepartures(departures, []string{"DDD"}, 2)
+	if !assert.Len(t, kept, 2) {
+		return
+	}
+	assert.Equal(t, "t2", kept[0].TripID)
+	assert.Equal(t, "t4", kept[1].TripID)
+
+	assert.Empty(t, agencyDepartures(departures, []string{"TER"}, 10))
+}
@@ -0,0 +1,442 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/alerts"
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/passbi/passbi_core/internal/mqtt"
+)
+
+// AlertsResponse is the response for the public alerts endpoint
+type AlertsResponse struct {
+	Alerts []models.ServiceAlert `json:"alerts" fields:"items"`
+	Total  int                   `json:"total"`
+}
+
+// AlertRequest is the admin request body for creating or updating an alert
+type AlertRequest struct {
+	Title       string               `json:"title"`
+	Description string               `json:"description"`
+	URL         string               `json:"url"`
+	Severity    string               `json:"severity"`
+	Cause       string               `json:"cause"`
+	Effect      string               `json:"effect"`
+	StartsAt    *time.Time           `json:"starts_at"`
+	EndsAt      *time.Time           `json:"ends_at"`
+	Entities    []models.AlertEntity `json:"entities"`
+}
+
+// toAlert converts the request into a normalized alert
+func (r *AlertRequest) toAlert() (*models.ServiceAlert, error) {
+	a := &models.ServiceAlert{
+		Title:       r.Title,
+		Description: r.Description,
+		URL:         r.URL,
+		Severity:    models.AlertSeverity(strings.ToLower(r.Severity)),
+		Cause:       r.Cause,
+		Effect:      r.Effect,
+		EndsAt:      r.EndsAt,
+		Entities:    r.Entities,
+	}
+	if r.StartsAt != nil {
+		a.StartsAt = *r.StartsAt
+	}
+	if err := alerts.Normalize(a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// ListAlerts handles GET /v2/alerts?route=ID,ID&stop=ID&severity=warning
+// Returns currently active alerts, optionally scoped to routes/stops; keys
+// restricted to some agencies do not see the other agencies' alerts
+func ListAlerts(c *fiber.Ctx) error {
+	pool, err := db.ReadDB()
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Database error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	now := time.Now().UTC()
+	filter := alerts.Filter{
+		ActiveAt: &now,
+		RouteIDs: splitList(c.Query("route")),
+		StopIDs:  splitList(c.Query("stop")),
+		Severity: models.AlertSeverity(strings.ToLower(c.Query("severity"))),
+	}
+
+	list, err := alerts.List(c.UserContext(), pool, filter)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Alerts query error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+	if agencies := keyAgencies(c); len(agencies) > 0 {
+		routes, err := agencyRoutes(c.UserContext(), agencies)
+		if err != nil {
+			logger.ErrorContext(c.Context(), "Agency routes query error", "error", err)
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		list = scopeAlerts(list, agencies, routes)
+	}
+
+	return sendFields(c, AlertsResponse{
+		Alerts: list,
+		Total:  len(list),
+	})
+}
+
+// AdminListAlerts handles GET /admin/alerts?active=true
+// provisional=true lists the alerts raised automatically and waiting for
+// review; source=manual|headway|disruption filters on who raised them
+func AdminListAlerts(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	filter := alerts.Filter{
+		RouteIDs: splitList(c.Query("route")),
+		StopIDs:  splitList(c.Query("stop")),
+		Severity: models.AlertSeverity(strings.ToLower(c.Query("severity"))),
+		Source:   strings.ToLower(c.Query("source")),
+	}
+	if c.QueryBool("active", false) {
+		now := time.Now().UTC()
+		filter.ActiveAt = &now
+	}
+	if value := c.Query("provisional"); value != "" {
+		provisional, err := strconv.ParseBool(value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "invalid_request",
+				"message": "provisional must be true or false",
+			})
+		}
+		filter.Provisional = &provisional
+	}
+
+	list, err := alerts.List(c.UserContext(), pool, filter)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to list alerts", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to retrieve alerts",
+		})
+	}
+
+	return c.JSON(AlertsResponse{
+		Alerts: list,
+		Total:  len(list),
+	})
+}
+
+// AdminGetAlert handles GET /admin/alerts/:id
+func AdminGetAlert(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Alert ID must be numeric",
+		})
+	}
+
+	alert, err := alerts.Get(c.UserContext(), pool, id)
+	if err != nil {
+		return alertError(c, err, "Failed to retrieve alert")
+	}
+
+	return c.JSON(alert)
+}
+
+// AdminCreateAlert handles POST /admin/alerts
+func AdminCreateAlert(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	var req AlertRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Invalid request body",
+		})
+	}
+
+	alert, err := req.toAlert()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": err.Error(),
+		})
+	}
+
+	if err := alerts.Create(c.UserContext(), pool, alert); err != nil {
+		logger.ErrorContext(c.Context(), "Failed to create alert", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to create alert",
+		})
+	}
+
+	broadcastAlert(alert)
+	return c.Status(201).JSON(alert)
+}
+
+// AdminUpdateAlert handles PUT /admin/alerts/:id
+func AdminUpdateAlert(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Alert ID must be numeric",
+		})
+	}
+
+	var req AlertRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Invalid request body",
+		})
+	}
+
+	alert, err := req.toAlert()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": err.Error(),
+		})
+	}
+	alert.ID = id
+
+	if err := alerts.Update(c.UserContext(), pool, alert); err != nil {
+		return alertError(c, err, "Failed to update alert")
+	}
+
+	broadcastAlert(alert)
+	return c.JSON(alert)
+}
+
+// AdminExpireAlert handles POST /admin/alerts/:id/expire
+// Ends the alert now while keeping it for history
+func AdminExpireAlert(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Alert ID must be numeric",
+		})
+	}
+
+	ctx := c.UserContext()
+	if err := alerts.Expire(ctx, pool, id, time.Now().UTC()); err != nil {
+		return alertError(c, err, "Failed to expire alert")
+	}
+
+	alert, err := alerts.Get(ctx, pool, id)
+	if err != nil {
+		return alertError(c, err, "Failed to retrieve alert")
+	}
+
+	broadcastAlert(alert)
+	return c.JSON(alert)
+}
+
+// AlertConfirmRequest is the optional body of POST /admin/alerts/:id/confirm
+type AlertConfirmRequest struct {
+	EndsAt *time.Time `json:"ends_at"`
+}
+
+// AdminConfirmAlert handles POST /admin/alerts/:id/confirm
+// Confirms a provisional alert after review: it stays up until ends_at, or
+// until expired when none is given, and detection no longer ends it
+// Expire or delete a provisional alert to dismiss it instead
+func AdminConfirmAlert(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Alert ID must be numeric",
+		})
+	}
+
+	var req AlertConfirmRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "invalid_request",
+				"message": "Invalid request body",
+			})
+		}
+	}
+
+	ctx := c.UserContext()
+	alert, err := alerts.Get(ctx, pool, id)
+	if err != nil {
+		return alertError(c, err, "Failed to retrieve alert")
+	}
+	if req.EndsAt != nil && !req.EndsAt.After(alert.StartsAt) {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": "ends_at must be after starts_at",
+		})
+	}
+
+	if err := alerts.Confirm(ctx, pool, id, req.EndsAt); err != nil {
+		return alertError(c, err, "Failed to confirm alert")
+	}
+	alert.Provisional, alert.EndsAt = false, req.EndsAt
+
+	broadcastAlert(alert)
+	return c.JSON(alert)
+}
+
+// AdminDeleteAlert handles DELETE /admin/alerts/:id
+func AdminDeleteAlert(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Alert ID must be numeric",
+		})
+	}
+
+	if err := alerts.Delete(c.UserContext(), pool, id); err != nil {
+		return alertError(c, err, "Failed to delete alert")
+	}
+
+	if p := mqtt.GetPublisher(); p != nil {
+		go func() {
+			if err := p.ClearAlert(id); err != nil {
+				logger.ErrorContext(c.Context(), "MQTT alert clear error", "error", err)
+			}
+		}()
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Alert deleted successfully",
+		"id":      id,
+	})
+}
+
+// broadcastAlert pushes an alert change to MQTT subscribers in the background
+// Ended alerts are cleared from the broker instead of republished
+func broadcastAlert(alert *models.ServiceAlert) {
+	p := mqtt.GetPublisher()
+	if p == nil {
+		return
+	}
+
+	go func() {
+		var err error
+		if alert.EndsAt != nil && !alert.EndsAt.After(time.Now()) {
+			err = p.ClearAlert(alert.ID)
+		} else {
+			err = p.PublishAlert(alert)
+		}
+		if err != nil {
+			logger.Error("MQTT alert publish error", "error", err)
+		}
+	}()
+}
+
+// attachAlerts adds active alerts affecting each itinerary's routes and stops
+// Failures are logged and leave the itineraries untouched
+func attachAlerts(ctx context.Context, routes map[string]*RouteResult) {
+	pool, err := db.ReadDB()
+	if err != nil {
+		logger.WarnContext(ctx, "Skipping itinerary alerts", "error", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	for strategy, result := range routes {
+		routeIDs, stopIDs := stepScope(result.Steps)
+		list, err := alerts.List(ctx, pool, alerts.Filter{
+			ActiveAt: &now,
+			RouteIDs: routeIDs,
+			StopIDs:  stopIDs,
+		})
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to load itinerary alerts", "strategy", strategy, "error", err)
+			continue
+		}
+		if len(list) > 0 {
+			result.Alerts = list
+		}
+	}
+}
+
+// stepScope collects the distinct routes and stops an itinerary touches
+func stepScope(steps []models.Step) (routeIDs, stopIDs []string) {
+	seenRoutes := make(map[string]bool)
+	seenStops := make(map[string]bool)
+
+	addStop := func(id string) {
+		if id != "" && !seenStops[id] {
+			seenStops[id] = true
+			stopIDs = append(stopIDs, id)
+		}
+	}
+
+	for _, step := range steps {
+		if step.Type == models.EdgeRide && step.Route != "" && !seenRoutes[step.Route] {
+			seenRoutes[step.Route] = true
+			routeIDs = append(routeIDs, step.Route)
+		}
+		addStop(step.FromStop)
+		addStop(step.ToStop)
+	}
+
+	return routeIDs, stopIDs
+}
+
+// alertError maps alert store errors to HTTP responses
+func alertError(c *fiber.Ctx, err error, message string) error {
+	if errors.Is(err, alerts.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "not_found",
+			"message": "Alert not found",
+		})
+	}
+	if errors.Is(err, alerts.ErrNotProvisional) {
+		return c.Status(409).JSON(fiber.Map{
+			"error":   "conflict",
+			"message": "Alert is not provisional",
+		})
+	}
+
+	logger.ErrorContext(c.Context(), message, "error", err)
+	return c.Status(500).JSON(fiber.Map{
+		"error":   "internal_server_error",
+		"message": message,
+	})
+}
+
+// splitList parses a comma-separated query value into trimmed, non-empty items
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	var items []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			items = append(items, part)
+		}
+	}
+	return items
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/anomaly"
+	"github.com/passbi/passbi_core/internal/middleware"
+)
+
+// AnomalyListResponse is the admin listing of usage anomalies
+type AnomalyListResponse struct {
+	Anomalies []anomaly.Anomaly `json:"anomalies"`
+	Total     int               `json:"total"`
+}
+
+// AnomalyReviewRequest is the body of PATCH /admin/anomalies/:id
+type AnomalyReviewRequest struct {
+	Status string `json:"status"` // dismissed or confirmed
+	Note   string `json:"note"`
+}
+
+// AdminListAnomalies handles GET /admin/anomalies?status=&kind=&partner_id=&api_key_id=&limit=&offset=
+func AdminListAnomalies(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(c.Query("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	list, total, err := anomaly.List(c.UserContext(), pool, anomaly.Filter{
+		Status:    anomaly.Status(c.Query("status")),
+		Kind:      anomaly.Kind(c.Query("kind")),
+		PartnerID: c.Query("partner_id"),
+		APIKeyID:  c.Query("api_key_id"),
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to list anomalies", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to retrieve anomalies",
+		})
+	}
+
+	return c.JSON(AnomalyListResponse{Anomalies: list, Total: total})
+}
+
+// AdminGetAnomaly handles GET /admin/anomalies/:id
+func AdminGetAnomaly(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	a, err := anomaly.Get(c.UserContext(), pool, c.Params("id"))
+	if errors.Is(err, anomaly.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "not_found",
+			"message": "Anomaly not found",
+		})
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to get anomaly", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to retrieve anomaly",
+		})
+	}
+
+	return c.JSON(a)
+}
+
+// AdminReviewAnomaly handles PATCH /admin/anomalies/:id
+// Dismissing an anomaly restores a suspended key; confirming it revokes the key
+func AdminReviewAnomaly(c *fiber.Ctx) error {
+	admin := c.Locals("partner").(*middleware.PartnerContext)
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	var req AnomalyReviewRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Invalid request body",
+		})
+	}
+
+	status := anomaly.Status(strings.ToLower(strings.TrimSpace(req.Status)))
+	if status != anomaly.StatusDismissed && status != anomaly.StatusConfirmed {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": "status must be dismissed or confirmed",
+		})
+	}
+
+	a, err := anomaly.Review(c.UserContext(), pool, c.Params("id"), status, strings.TrimSpace(req.Note), admin.Email)
+	if errors.Is(err, anomaly.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "not_found",
+			"message": "Anomaly not found",
+		})
+	}
+	if errors.Is(err, anomaly.ErrReviewed) {
+		return c.Status(409).JSON(fiber.Map{
+			"error":   "already_reviewed",
+			"message": "Anomaly has already been reviewed",
+		})
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to review anomaly", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to review anomaly",
+		})
+	}
+
+	logger.InfoContext(c.Context(), "Anomaly reviewed", "anomaly_id", a.ID, "status", a.Status, "admin", admin.Email)
+	return c.JSON(a)
+}
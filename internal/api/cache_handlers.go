@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/passbi/passbi_core/internal/cache"
+	"github.com/passbi/passbi_core/internal/metrics"
+)
+
+// CacheClassStats is the cache activity of one key class
+type CacheClassStats struct {
+	cache.ClassStats
+	HitRate float64 `json:"hit_rate"`
+}
+
+// CacheStatsResponse is the payload of GET /admin/cache/stats
+// Counters are per instance and start at zero when it starts
+type CacheStatsResponse struct {
+	Since       time.Time         `json:"since"`
+	DataVersion int64             `json:"data_version"`
+	TTLs        map[string]string `json:"ttls"`
+	Total       CacheClassStats   `json:"total"`
+	Classes     []CacheClassStats `json:"classes"`
+	Redis       CacheStats        `json:"redis"`
+}
+
+// AdminCacheStats handles GET /admin/cache/stats
+// Hits, misses, sets and errors per key class (route, dep, sched, ...), to
+// judge whether each TTL earns its keep
+func AdminCacheStats(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 5*time.Second)
+	defer cancel()
+
+	classes, since := cache.ClassMetrics()
+	resp := CacheStatsResponse{
+		Since:       since.UTC(),
+		DataVersion: cache.DataVersion(ctx),
+		TTLs:        map[string]string{},
+		Total:       CacheClassStats{ClassStats: cache.ClassStats{Class: "all"}},
+		Classes:     make([]CacheClassStats, 0, len(classes)),
+	}
+
+	for class, ttl := range cache.TTLPolicy() {
+		resp.TTLs[class] = ttl.String()
+	}
+
+	for _, s := range classes {
+		resp.Classes = append(resp.Classes, withHitRate(s))
+
+		t := &resp.Total.ClassStats
+		t.Hits += s.Hits
+		t.LocalHits += s.LocalHits
+		t.RedisHits += s.RedisHits
+		t.Misses += s.Misses
+		t.Sets += s.Sets
+		t.Errors += s.Errors
+	}
+	resp.Total = withHitRate(resp.Total.ClassStats)
+
+	// Redis being unavailable should not hide this instance's counters
+	if hits, misses, err := cache.KeyspaceStats(ctx); err != nil {
+		logger.ErrorContext(c.Context(), "Failed to read Redis stats", "error", err)
+	} else {
+		resp.Redis.RedisHits = hits
+		resp.Redis.RedisMisses = misses
+		resp.Redis.RedisHitRate = percent(hits, hits+misses)
+	}
+
+	return c.JSON(resp)
+}
+
+// withHitRate adds the percentage of lookups answered from the cache
+func withHitRate(s cache.ClassStats) CacheClassStats {
+	return CacheClassStats{ClassStats: s, HitRate: percent(s.Hits, s.Hits+s.Misses)}
+}
+
+// cachePurgeScopes lists the scopes accepted by DELETE /admin/cache
+const cachePurgeScopes = "all, routes, departures, schedule, route, stop, geocode or pattern"
+
+// CachePurgeResponse reports what DELETE /admin/cache removed
+type CachePurgeResponse struct {
+	Scope       string   `json:"scope"`
+	Patterns    []string `json:"patterns,omitempty"`
+	Deleted     int64    `json:"deleted"`
+	DataVersion int64    `json:"data_version,omitempty"`
+}
+
+// AdminPurgeCache handles DELETE /admin/cache?scope=&stop_id=&route_id=&pattern=
+// Purges part of the cache during incidents instead of flushing Redis:
+//   - all: every data-derived entry, by bumping the data version
+//   - routes: all route-search results
+//   - departures, schedule: one stop's (stop_id) or route's (route_id), or all
+//   - route: a route's timetable, stop sequence and frequency (route_id)
+//   - stop: a stop's departures and routes (stop_id)
+//   - geocode: geocoded places and location labels
+//   - pattern: keys matching a Redis glob (pattern)
+func AdminPurgeCache(c *fiber.Ctx) error {
+	scope := c.Query("scope")
+	stopID := c.Query("stop_id")
+	routeID := c.Query("route_id")
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 30*time.Second)
+	defer cancel()
+
+	if scope == "all" {
+		version, err := cache.BumpDataVersion(ctx)
+		if err != nil {
+			logger.ErrorContext(c.Context(), "Cache purge error", "error", err)
+			return c.Status(503).JSON(fiber.Map{
+				"error":   "cache_unavailable",
+				"message": "Failed to purge the cache",
+			})
+		}
+		return c.JSON(CachePurgeResponse{Scope: scope, DataVersion: version})
+	}
+
+	patterns, msg := purgePatterns(scope, stopID, routeID, c.Query("pattern"))
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": msg,
+		})
+	}
+
+	resp := CachePurgeResponse{Scope: scope, Patterns: patterns}
+	for _, pattern := range patterns {
+		n, err := cache.Purge(ctx, pattern)
+		resp.Deleted += n
+		if err != nil {
+			logger.ErrorContext(c.Context(), "Cache purge error", "pattern", pattern, "error", err)
+			return c.Status(503).JSON(fiber.Map{
+				"error":   "cache_unavailable",
+				"message": "Failed to purge the cache",
+				"deleted": resp.Deleted,
+			})
+		}
+	}
+
+	logger.InfoContext(c.Context(), "Cache purged", "scope", scope, "patterns", patterns, "deleted", resp.Deleted)
+	return c.JSON(resp)
+}
+
+// purgePatterns returns the key patterns of a purge scope, or a validation
+// message; every data version is matched so older entries go too
+func purgePatterns(scope, stopID, routeID, pattern string) ([]string, string) {
+	or := func(id string) string {
+		if id == "" {
+			return "*"
+		}
+		return id
+	}
+	v := cache.AllVersions
+
+	switch scope {
+	case "routes":
+		return []string{cache.Pattern(v, cache.ClassRoute, "*")}, ""
+	case "departures":
+		return []string{cache.Pattern(v, cache.ClassDepartures, or(stopID), "*")}, ""
+	case "schedule":
+		return []string{cache.Pattern(v, cache.ClassSchedule, or(routeID), "*")}, ""
+	case "route":
+		if routeID == "" {
+			return nil, "route_id is required for scope=route"
+		}
+		return []string{
+			cache.Pattern(v, cache.ClassSchedule, routeID, "*"),
+			cache.Pattern(v, cache.ClassRouteStops, routeID, "*"),
+			cache.Pattern(v, cache.ClassRouteFrequency, routeID, "*"),
+		}, ""
+	case "stop":
+		if stopID == "" {
+			return nil, "stop_id is required for scope=stop"
+		}
+		return []string{
+			cache.Pattern(v, cache.ClassDepartures, stopID, "*"),
+			cache.Pattern(v, cache.ClassStopRoutes, stopID),
+		}, ""
+	case "geocode":
+		return []string{
+			cache.Pattern(cache.ClassGeocode, "*"),
+			cache.Pattern(cache.ClassReverseGeocode, "*"),
+		}, ""
+	case "pattern":
+		if pattern == "" || pattern == "*" {
+			return nil, "pattern is required for scope=pattern (use scope=all to purge everything)"
+		}
+		return []string{pattern}, ""
+	case "":
+		return nil, "scope is required: " + cachePurgeScopes
+	default:
+		return nil, "unknown scope '" + scope + "': use " + cachePurgeScopes
+	}
+}
+
+// Metrics handles GET /metrics in the Prometheus text format
+func Metrics(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	return c.SendString(metrics.Gather())
+}
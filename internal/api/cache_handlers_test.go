@@ -0,0 +1,31 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPurgePatterns(t *testing.T) {
+	patterns, msg := purgePatterns("departures", "S1", "", "")
+	assert.Empty(t, msg)
+	assert.Equal(t, []string{"v*:dep:S1:*"}, patterns)
+
+	patterns, _ = purgePatterns("departures", "", "", "")
+	assert.Equal(t, []string{"v*:dep:*:*"}, patterns)
+
+	patterns, _ = purgePatterns("route", "", "DDD_7", "")
+	assert.Equal(t, []string{"v*:sched:DDD_7:*", "v*:routestops:DDD_7:*", "v*:routefreq:DDD_7:*"}, patterns)
+
+	patterns, _ = purgePatterns("stop", "S1", "", "")
+	assert.Equal(t, []string{"v*:dep:S1:*", "v*:stoproutes:S1"}, patterns)
+
+	_, msg = purgePatterns("route", "", "", "")
+	assert.Contains(t, msg, "route_id is required")
+
+	_, msg = purgePatterns("pattern", "", "", "*")
+	assert.NotEmpty(t, msg)
+
+	_, msg = purgePatterns("everything", "", "", "")
+	assert.Contains(t, msg, "unknown scope")
+}
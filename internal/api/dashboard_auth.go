@@ -0,0 +1,338 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/middleware"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Dashboard passwords are stored as PBKDF2-SHA256 hashes
+// ("pbkdf2-sha256$<iterations>$<salt>$<hash>", base64) so the iteration count
+// can be raised later without invalidating existing passwords
+const (
+	passwordScheme     = "pbkdf2-sha256"
+	passwordIterations = 600000
+	passwordSaltSize   = 16
+	passwordKeySize    = 32
+	minPasswordLength  = 10
+)
+
+// Failed logins per email are limited to slow down password guessing, and
+// attempts per client IP so that rotating emails cannot keep the servers
+// hashing passwords
+const (
+	maxLoginFailures    = 10
+	loginFailuresWindow = 15 * time.Minute
+	maxLoginAttemptsIP  = 30
+)
+
+// errInvalidPasswordHash is returned for a stored hash in an unknown format
+var errInvalidPasswordHash = errors.New("invalid password hash")
+
+// LoginRequest is the body of POST /dashboard/login
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// LoginResponse carries a dashboard session token
+type LoginResponse struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type"`
+	ExpiresAt time.Time `json:"expires_at"`
+	ExpiresIn int64     `json:"expires_in"`
+}
+
+// ChangePasswordRequest is the body of PUT /dashboard/password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// DashboardLogin exchanges a dashboard user's email and password for a
+// short-lived session token accepted on /dashboard routes only
+func DashboardLogin(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+	rdb := c.Locals("redis").(*redis.Client)
+
+	var req LoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Invalid request body",
+		})
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if email == "" || req.Password == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": "email and password are required",
+		})
+	}
+
+	ctx := c.UserContext()
+	if !loginAttemptAllowed(ctx, rdb, middleware.ClientIP(c).String()) {
+		c.Set("Retry-After", strconv.Itoa(int(loginFailuresWindow.Seconds())))
+		return c.Status(429).JSON(fiber.Map{
+			"error":   "too_many_attempts",
+			"message": "Too many logins from this address. Try again later",
+		})
+	}
+
+	failuresKey := "login:failures:" + email
+	if failures, _ := rdb.Get(ctx, failuresKey).Int(); failures >= maxLoginFailures {
+		c.Set("Retry-After", strconv.Itoa(int(loginFailuresWindow.Seconds())))
+		return c.Status(429).JSON(fiber.Map{
+			"error":   "too_many_attempts",
+			"message": "Too many failed logins. Try again later",
+		})
+	}
+
+	var userID, partnerID, passwordHash string
+	err := pool.QueryRow(ctx, `
+		SELECT u.id, u.partner_id, COALESCE(u.password_hash, '')
+		FROM partner_user u
+		JOIN partner p ON p.id = u.partner_id
+		WHERE lower(u.email) = $1
+			AND p.status = 'active'
+	`, email).Scan(&userID, &partnerID, &passwordHash)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		logger.ErrorContext(c.Context(), "Failed to load user for login", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to log in",
+		})
+	}
+
+	valid := false
+	if passwordHash != "" {
+		valid = checkPassword(req.Password, passwordHash)
+	} else {
+		// Hash anyway so a login takes as long whether or not the account exists
+		hashPasswordWith(req.Password, make([]byte, passwordSaltSize), passwordIterations)
+	}
+	if !valid {
+		pipe := rdb.TxPipeline()
+		pipe.Incr(ctx, failuresKey)
+		pipe.Expire(ctx, failuresKey, loginFailuresWindow)
+		_, _ = pipe.Exec(ctx)
+
+		return c.Status(401).JSON(fiber.Map{
+			"error":   "invalid_credentials",
+			"message": "Invalid email or password",
+		})
+	}
+	rdb.Del(ctx, failuresKey)
+
+	if _, err := pool.Exec(ctx, `UPDATE partner_user SET last_login_at = NOW() WHERE id = $1`, userID); err != nil {
+		logger.ErrorContext(c.Context(), "Failed to record login", "error", err)
+	}
+
+	return sendSession(c, partnerID, userID)
+}
+
+// loginAttemptAllowed counts a login attempt from ip and reports whether it is
+// within maxLoginAttemptsIP for the window; without Redis attempts are allowed
+func loginAttemptAllowed(ctx context.Context, rdb *redis.Client, ip string) bool {
+	key := "login:ip:" + ip
+	attempts, err := rdb.Incr(ctx, key).Result()
+	if err != nil {
+		return true
+	}
+	if attempts == 1 {
+		rdb.Expire(ctx, key, loginFailuresWindow)
+	}
+	return attempts <= maxLoginAttemptsIP
+}
+
+// sendSession responds with a new session token for a dashboard user
+func sendSession(c *fiber.Ctx, partnerID, userID string) error {
+	now := time.Now()
+	token, expiresAt, err := middleware.IssueSession(partnerID, userID, now)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to issue dashboard session", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to log in",
+		})
+	}
+
+	return c.JSON(LoginResponse{
+		Token:     token,
+		TokenType: "Bearer",
+		ExpiresAt: expiresAt,
+		ExpiresIn: int64(expiresAt.Sub(now).Seconds()),
+	})
+}
+
+// ChangeDashboardPassword sets the calling user's dashboard password
+// The current password is required once one is set; changing it ends every
+// session of the user issued before. With an API key it sets the password of
+// the owner using the partner's email, which is how a partner's first login
+// is created
+func ChangeDashboardPassword(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*middleware.PartnerContext)
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	if partner.ImpersonationID != "" {
+		return c.Status(403).JSON(fiber.Map{
+			"error":   "impersonation_not_allowed",
+			"message": "The password cannot be changed while impersonating a partner",
+		})
+	}
+
+	var req ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Invalid request body",
+		})
+	}
+
+	if len(req.NewPassword) < minPasswordLength {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": fmt.Sprintf("new_password must be at least %d characters", minPasswordLength),
+		})
+	}
+
+	ctx := c.UserContext()
+	userID := partner.UserID
+	if userID == "" {
+		var err error
+		if userID, err = ownerUser(ctx, pool, partner); err != nil {
+			logger.ErrorContext(c.Context(), "Failed to load partner owner", "error", err)
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "internal_server_error",
+				"message": "Failed to change password",
+			})
+		}
+	}
+
+	var current string
+	err := pool.QueryRow(ctx,
+		`SELECT COALESCE(password_hash, '') FROM partner_user WHERE id = $1`, userID,
+	).Scan(&current)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to load partner password", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to change password",
+		})
+	}
+
+	if current != "" && !checkPassword(req.CurrentPassword, current) {
+		return c.Status(403).JSON(fiber.Map{
+			"error":   "invalid_credentials",
+			"message": "current_password is incorrect",
+		})
+	}
+
+	hash, err := hashPassword(req.NewPassword)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to hash password", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to change password",
+		})
+	}
+
+	// Stored in UTC seconds so sessions can compare it with their issue time
+	updatedAt := time.Now().UTC().Truncate(time.Second)
+	_, err = pool.Exec(ctx, `
+		UPDATE partner_user
+		SET password_hash = $2, password_updated_at = $3, updated_at = NOW()
+		WHERE id = $1
+	`, userID, hash, updatedAt)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to update password", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to change password",
+		})
+	}
+
+	return c.SendStatus(204)
+}
+
+// ownerUser returns the owner user with the partner's email, creating it for
+// partners set up without one
+func ownerUser(ctx context.Context, pool *pgxpool.Pool, partner *middleware.PartnerContext) (string, error) {
+	var id string
+	err := pool.QueryRow(ctx, `
+		WITH created AS (
+			INSERT INTO partner_user (partner_id, email, role)
+			VALUES ($1, $2, 'owner')
+			ON CONFLICT ((lower(email))) DO NOTHING
+			RETURNING id
+		)
+		SELECT id FROM created
+		UNION ALL
+		SELECT id FROM partner_user WHERE partner_id = $1 AND lower(email) = lower($2)
+	`, partner.PartnerID, partner.Email).Scan(&id)
+	return id, err
+}
+
+// hashPassword hashes a password with a random salt
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return hashPasswordWith(password, salt, passwordIterations), nil
+}
+
+// hashPasswordWith formats the PBKDF2 hash of a password
+func hashPasswordWith(password string, salt []byte, iterations int) string {
+	key := pbkdf2.Key([]byte(password), salt, iterations, passwordKeySize, sha256.New)
+	return fmt.Sprintf("%s$%d$%s$%s", passwordScheme, iterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+}
+
+// checkPassword reports whether password matches a stored hash
+func checkPassword(password, stored string) bool {
+	salt, iterations, key, err := parsePasswordHash(stored)
+	if err != nil {
+		return false
+	}
+	candidate := pbkdf2.Key([]byte(password), salt, iterations, len(key), sha256.New)
+	return subtle.ConstantTimeCompare(candidate, key) == 1
+}
+
+// parsePasswordHash splits a stored hash into its salt, iterations and key
+func parsePasswordHash(stored string) (salt []byte, iterations int, key []byte, err error) {
+	parts := strings.Split(stored, "$")
+	if len(parts) != 4 || parts[0] != passwordScheme {
+		return nil, 0, nil, errInvalidPasswordHash
+	}
+
+	iterations, err = strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return nil, 0, nil, errInvalidPasswordHash
+	}
+	salt, err = base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, 0, nil, errInvalidPasswordHash
+	}
+	key, err = base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return nil, 0, nil, errInvalidPasswordHash
+	}
+	return salt, iterations, key, nil
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordHash(t *testing.T) {
+	// Few iterations keep the test fast; the count is read back from the hash
+	hash := hashPasswordWith("correct horse battery", []byte("0123456789abcdef"), 1000)
+	assert.Contains(t, hash, "pbkdf2-sha256$1000$")
+
+	assert.True(t, checkPassword("correct horse battery", hash))
+	assert.False(t, checkPassword("correct horse battery!", hash))
+	assert.False(t, checkPassword("", hash))
+
+	assert.False(t, checkPassword("x", ""))
+	assert.False(t, checkPassword("x", "bcrypt$10$abc$def"))
+	assert.False(t, checkPassword("x", "pbkdf2-sha256$0$abc$def"))
+}
+
+func TestHashPasswordSalts(t *testing.T) {
+	a, err := hashPassword("same password")
+	if !assert.NoError(t, err) {
+		return
+	}
+	b, _ := hashPassword("same password")
+
+	assert.NotEqual(t, a, b)
+	assert.True(t, checkPassword("same password", a))
+}
@@ -0,0 +1,414 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/middleware"
+	"github.com/passbi/passbi_core/internal/notify"
+)
+
+// inviteTTL bounds how long an invitation can be accepted
+const inviteTTL = 7 * 24 * time.Hour
+
+// errLastOwner is returned when a change would leave a partner without owner
+var errLastOwner = errors.New("a partner needs at least one owner")
+
+// DashboardUser is a login of a partner account
+type DashboardUser struct {
+	ID              string     `json:"id"`
+	Email           string     `json:"email"`
+	Name            string     `json:"name,omitempty"`
+	Role            string     `json:"role"`
+	Status          string     `json:"status"` // active, or invited until the invitation is accepted
+	InviteExpiresAt *time.Time `json:"invite_expires_at,omitempty"`
+	LastLoginAt     *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// InviteUserRequest is the body of POST /dashboard/users
+type InviteUserRequest struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+	Role  string `json:"role"`
+}
+
+// InviteUserResponse carries the invitation token, shown once
+type InviteUserResponse struct {
+	User        DashboardUser `json:"user"`
+	InviteToken string        `json:"invite_token"`
+}
+
+// UpdateUserRequest is the body of PATCH /dashboard/users/:id
+type UpdateUserRequest struct {
+	Role string `json:"role"`
+}
+
+// AcceptInvitationRequest is the body of POST /dashboard/invitations/accept
+type AcceptInvitationRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+}
+
+const selectDashboardUser = `
+	SELECT id, email, COALESCE(name, ''), role,
+		CASE WHEN invite_token_hash IS NULL THEN 'active' ELSE 'invited' END,
+		invite_expires_at, last_login_at, created_at
+	FROM partner_user
+`
+
+func scanDashboardUser(row pgx.Row) (DashboardUser, error) {
+	var u DashboardUser
+	err := row.Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.Status, &u.InviteExpiresAt, &u.LastLoginAt, &u.CreatedAt)
+	return u, err
+}
+
+// GetDashboardUsers handles GET /dashboard/users
+func GetDashboardUsers(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*middleware.PartnerContext)
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	rows, err := pool.Query(c.UserContext(),
+		selectDashboardUser+` WHERE partner_id = $1 ORDER BY created_at`, partner.PartnerID)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to get dashboard users", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to retrieve users",
+		})
+	}
+	defer rows.Close()
+
+	users := []DashboardUser{}
+	for rows.Next() {
+		u, err := scanDashboardUser(rows)
+		if err != nil {
+			logger.ErrorContext(c.Context(), "Failed to scan dashboard user", "error", err)
+			continue
+		}
+		users = append(users, u)
+	}
+
+	return c.JSON(fiber.Map{
+		"users": users,
+		"total": len(users),
+	})
+}
+
+// InviteDashboardUser handles POST /dashboard/users
+// The invitation token is returned once and emailed when SMTP is set up; the
+// invited user sets a password with it at POST /dashboard/invitations/accept
+func InviteDashboardUser(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*middleware.PartnerContext)
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	if partner.ImpersonationID != "" {
+		return userManagementImpersonated(c)
+	}
+
+	var req InviteUserRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Invalid request body",
+		})
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": "email must be a valid email address",
+		})
+	}
+	if !middleware.ValidRole(req.Role) {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": "role must be owner, developer, billing or read_only",
+		})
+	}
+
+	token, tokenHash, err := generateInviteToken()
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to generate invite token", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to invite user",
+		})
+	}
+
+	ctx := c.UserContext()
+	user, err := scanDashboardUser(pool.QueryRow(ctx, `
+		INSERT INTO partner_user (partner_id, email, name, role, invite_token_hash, invite_expires_at, invited_by)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, NULLIF($7, '')::uuid)
+		RETURNING id, email, COALESCE(name, ''), role, 'invited', invite_expires_at, last_login_at, created_at
+	`, partner.PartnerID, email, strings.TrimSpace(req.Name), req.Role, tokenHash,
+		time.Now().Add(inviteTTL), partner.UserID))
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return c.Status(409).JSON(fiber.Map{
+			"error":   "user_exists",
+			"message": "A dashboard user with this email already exists",
+		})
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to invite dashboard user", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to invite user",
+		})
+	}
+
+	if mailer := notify.NewMailer(); mailer != nil {
+		go sendInvitation(mailer, email, partner.CompanyName, req.Role, token)
+	}
+
+	return c.Status(201).JSON(InviteUserResponse{User: user, InviteToken: token})
+}
+
+// UpdateDashboardUser handles PATCH /dashboard/users/:id
+// A role change applies from the user's next request
+func UpdateDashboardUser(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*middleware.PartnerContext)
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	if partner.ImpersonationID != "" {
+		return userManagementImpersonated(c)
+	}
+
+	var req UpdateUserRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Invalid request body",
+		})
+	}
+	if !middleware.ValidRole(req.Role) {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": "role must be owner, developer, billing or read_only",
+		})
+	}
+
+	var user DashboardUser
+	err := changeUsers(c.UserContext(), pool, partner.PartnerID, c.Params("id"), req.Role != middleware.RoleOwner,
+		func(tx pgx.Tx) error {
+			var err error
+			user, err = scanDashboardUser(tx.QueryRow(c.UserContext(), `
+				UPDATE partner_user SET role = $3, updated_at = NOW()
+				WHERE partner_id = $1 AND id::text = $2
+				RETURNING id, email, COALESCE(name, ''), role,
+					CASE WHEN invite_token_hash IS NULL THEN 'active' ELSE 'invited' END,
+					invite_expires_at, last_login_at, created_at
+			`, partner.PartnerID, c.Params("id"), req.Role))
+			return err
+		})
+	if err != nil {
+		return userChangeError(c, err, "Failed to update user")
+	}
+
+	return c.JSON(user)
+}
+
+// DeleteDashboardUser handles DELETE /dashboard/users/:id
+// The user's sessions end with it
+func DeleteDashboardUser(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*middleware.PartnerContext)
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	if partner.ImpersonationID != "" {
+		return userManagementImpersonated(c)
+	}
+
+	err := changeUsers(c.UserContext(), pool, partner.PartnerID, c.Params("id"), true,
+		func(tx pgx.Tx) error {
+			_, err := tx.Exec(c.UserContext(),
+				`DELETE FROM partner_user WHERE partner_id = $1 AND id::text = $2`, partner.PartnerID, c.Params("id"))
+			return err
+		})
+	if err != nil {
+		return userChangeError(c, err, "Failed to remove user")
+	}
+
+	return c.SendStatus(204)
+}
+
+// AcceptInvitation handles POST /dashboard/invitations/accept
+// The invited user chooses a password and is logged in
+func AcceptInvitation(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	var req AcceptInvitationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Invalid request body",
+		})
+	}
+	if len(req.Password) < minPasswordLength {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": fmt.Sprintf("password must be at least %d characters", minPasswordLength),
+		})
+	}
+
+	hash, err := hashPassword(req.Password)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to hash password", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to accept invitation",
+		})
+	}
+
+	sum := sha256.Sum256([]byte(strings.TrimSpace(req.Token)))
+	var userID, partnerID string
+	err = pool.QueryRow(c.UserContext(), `
+		UPDATE partner_user u
+		SET password_hash = $2, password_updated_at = $4,
+			name = COALESCE(NULLIF($3, ''), u.name),
+			invite_token_hash = NULL, invite_expires_at = NULL,
+			last_login_at = NOW(), updated_at = NOW()
+		FROM partner p
+		WHERE u.invite_token_hash = $1
+			AND u.invite_expires_at > NOW()
+			AND p.id = u.partner_id
+			AND p.status = 'active'
+		RETURNING u.id, u.partner_id
+	`, hex.EncodeToString(sum[:]), hash, strings.TrimSpace(req.Name), time.Now().UTC().Truncate(time.Second)).
+		Scan(&userID, &partnerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "invalid_invitation",
+			"message": "The invitation is invalid or has expired. Ask an owner to invite you again",
+		})
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to accept invitation", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to accept invitation",
+		})
+	}
+
+	return sendSession(c, partnerID, userID)
+}
+
+// changeUsers runs change on one of a partner's users, refusing it when it
+// would leave the partner without an owner; ownerLost tells whether the
+// change removes the user's owner role
+func changeUsers(ctx context.Context, pool *pgxpool.Pool, partnerID, userID string, ownerLost bool, change func(pgx.Tx) error) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the owners serializes concurrent changes to them
+	rows, err := tx.Query(ctx, `
+		SELECT id::text FROM partner_user
+		WHERE partner_id = $1 AND role = 'owner'
+		FOR UPDATE
+	`, partnerID)
+	if err != nil {
+		return err
+	}
+	var owners []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		owners = append(owners, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM partner_user WHERE partner_id = $1 AND id::text = $2)`,
+		partnerID, userID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return pgx.ErrNoRows
+	}
+
+	if ownerLost && len(owners) == 1 && owners[0] == userID {
+		return errLastOwner
+	}
+
+	if err := change(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func userChangeError(c *fiber.Ctx, err error, message string) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "not_found",
+			"message": "User not found",
+		})
+	}
+	if errors.Is(err, errLastOwner) {
+		return c.Status(409).JSON(fiber.Map{
+			"error":   "last_owner",
+			"message": "The last owner cannot be removed or given another role; make another user owner first",
+		})
+	}
+	logger.ErrorContext(c.Context(), message, "error", err)
+	return c.Status(500).JSON(fiber.Map{
+		"error":   "internal_server_error",
+		"message": message,
+	})
+}
+
+func userManagementImpersonated(c *fiber.Ctx) error {
+	return c.Status(403).JSON(fiber.Map{
+		"error":   "impersonation_not_allowed",
+		"message": "Users cannot be managed while impersonating a partner",
+	})
+}
+
+// generateInviteToken returns an invitation token and its SHA-256 hex hash
+func generateInviteToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = "inv_" + base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(token))
+	return token, hex.EncodeToString(sum[:]), nil
+}
+
+// sendInvitation emails an invitation token
+func sendInvitation(mailer *notify.Mailer, to, company, role, token string) {
+	subject := "You are invited to the PassBi dashboard"
+	body := fmt.Sprintf(`You have been invited to the PassBi dashboard of %s with the %s role.
+
+To accept, choose a password with this invitation token within 7 days:
+
+  POST /dashboard/invitations/accept
+  {"token": "%s", "password": "..."}
+`, company, role, token)
+
+	if err := mailer.Send(to, subject, body); err != nil {
+		logger.Error("Failed to email invitation", "to", to, "error", err)
+	}
+}
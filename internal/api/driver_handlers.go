@@ -0,0 +1,278 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/middleware"
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/passbi/passbi_core/internal/vehicles"
+)
+
+// DeviceAuth authenticates /driver requests with a device token
+// ("Authorization: Bearer pd_...") from POST /v2/driver/devices and stores the
+// device in locals
+func DeviceAuth(c *fiber.Ctx) error {
+	parts := strings.SplitN(c.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return c.Status(401).JSON(fiber.Map{"error": "device token is required. Use Authorization: Bearer pd_..."})
+	}
+
+	pool, err := db.GetDB()
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Database error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+	device, err := vehicles.AuthenticateDevice(c.UserContext(), pool, strings.TrimSpace(parts[1]))
+	if errors.Is(err, vehicles.ErrDeviceNotFound) {
+		return c.Status(401).JSON(fiber.Map{"error": "invalid or revoked device token"})
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Device authentication error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	c.Locals("device", device)
+	return c.Next()
+}
+
+// DriverPing is one GPS fix of the driver app, numbered by seq from 1 through
+// an app session
+type DriverPing struct {
+	Seq       int64    `json:"seq"`
+	Timestamp int64    `json:"ts"` // unix seconds, when the fix was taken
+	Lat       float64  `json:"lat"`
+	Lon       float64  `json:"lon"`
+	Speed     *float64 `json:"speed,omitempty"`    // meters per second
+	Bearing   *float64 `json:"bearing,omitempty"`  // degrees clockwise from north
+	Accuracy  *float64 `json:"accuracy,omitempty"` // meters
+	// A trip or route overrides the upload's, for pings buffered across a
+	// change of trip
+	TripID  string `json:"trip_id,omitempty"`
+	RouteID string `json:"route_id,omitempty"`
+	StopID  string `json:"stop_id,omitempty"`
+}
+
+// DriverPingsRequest is the body of POST /driver/pings
+type DriverPingsRequest struct {
+	Session string       `json:"session"`
+	TripID  string       `json:"trip_id"`
+	RouteID string       `json:"route_id"`
+	Pings   []DriverPing `json:"pings"`
+}
+
+// DriverPings handles POST /driver/pings
+// The driver app uploads the pings it buffered, oldest first, as its
+// connection allows; the response acknowledges every ping of the session up
+// to ack, which the app may then delete, whether it was stored, already
+// stored by an earlier upload, or dropped as invalid or inaccurate
+// Pings go to the vehicle the device is bound to, on the trip or route they
+// name, else the upload's, else the device's route
+func DriverPings(c *fiber.Ctx) error {
+	device, ok := c.Locals("device").(*vehicles.Device)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "device token is required"})
+	}
+
+	var req DriverPingsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	req.Session = strings.TrimSpace(req.Session)
+	if req.Session == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "session is required"})
+	}
+	cfg := vehiclesConfig()
+	if len(req.Pings) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "pings must not be empty"})
+	}
+	if len(req.Pings) > cfg.MaxPings {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("at most %d pings per request", cfg.MaxPings)})
+	}
+
+	pings, through, rejected := driverPings(device, &req, cfg, time.Now())
+	if through == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "pings must have a positive seq"})
+	}
+
+	pool, err := db.GetDB()
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Database error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+	result, err := vehicles.StorePings(c.UserContext(), pool, liveRedis(c), cfg, device, req.Session, through, pings)
+	if errors.Is(err, vehicles.ErrInvalid) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to store driver pings", "device_id", device.ID, "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	return c.JSON(fiber.Map{
+		"ack":        result.Ack,
+		"received":   len(req.Pings),
+		"stored":     result.Stored,
+		"duplicates": result.Duplicates,
+		"rejected":   rejected,
+		"live":       result.Live,
+	})
+}
+
+// driverPings turns an upload into normalized fixes of the device's vehicle
+// It returns the valid pings, the highest positive seq of the upload and how
+// many pings were dropped; pings must be dated, since buffered ones arrive
+// late
+func driverPings(device *vehicles.Device, req *DriverPingsRequest, cfg vehicles.Config, now time.Time) (pings []vehicles.Ping, through int64, rejected int) {
+	for _, p := range req.Pings {
+		if p.Seq <= 0 {
+			rejected++
+			continue
+		}
+		through = max(through, p.Seq)
+		if p.Timestamp <= 0 || (p.Accuracy != nil && *p.Accuracy > cfg.MaxAccuracy) {
+			rejected++
+			continue
+		}
+
+		position := models.VehiclePosition{
+			VehicleID: device.VehicleID,
+			AgencyID:  device.AgencyID,
+			TripID:    p.TripID,
+			RouteID:   p.RouteID,
+			StopID:    p.StopID,
+			Lat:       p.Lat,
+			Lon:       p.Lon,
+			Bearing:   p.Bearing,
+			Speed:     p.Speed,
+			Timestamp: time.Unix(p.Timestamp, 0),
+		}
+		if strings.TrimSpace(position.TripID) == "" && strings.TrimSpace(position.RouteID) == "" {
+			position.TripID, position.RouteID = req.TripID, req.RouteID
+		}
+		if strings.TrimSpace(position.TripID) == "" && strings.TrimSpace(position.RouteID) == "" {
+			position.RouteID = device.RouteID
+		}
+		if err := cfg.Normalize(&position, now); err != nil {
+			rejected++
+			continue
+		}
+		pings = append(pings, vehicles.Ping{Seq: p.Seq, Position: position})
+	}
+	return pings, through, rejected
+}
+
+// DriverDeviceRequest is the body of POST /v2/driver/devices
+type DriverDeviceRequest struct {
+	AgencyID  string `json:"agency_id"`
+	VehicleID string `json:"vehicle_id"`
+	RouteID   string `json:"route_id"`
+	Label     string `json:"label"`
+}
+
+// CreateDriverDevice handles POST /v2/driver/devices
+// Registers a driver app install for a vehicle and returns its device token,
+// shown only this once; agency_id defaults to the key's agency when it has a
+// single one
+func CreateDriverDevice(c *fiber.Ctx) error {
+	var req DriverDeviceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	agencies := keyAgencies(c)
+	if strings.TrimSpace(req.AgencyID) == "" && len(agencies) == 1 {
+		req.AgencyID = agencies[0]
+	}
+	if !agencyAllowed(agencies, strings.TrimSpace(req.AgencyID)) {
+		return c.Status(403).JSON(fiber.Map{"error": fmt.Sprintf("this API key cannot register devices for agency %s", req.AgencyID)})
+	}
+
+	pool, err := db.GetDB()
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Database error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	device := vehicles.Device{AgencyID: req.AgencyID, VehicleID: req.VehicleID, RouteID: req.RouteID, Label: req.Label}
+	token, err := vehicles.CreateDevice(c.UserContext(), pool, callerPartnerID(c), &device)
+	if errors.Is(err, vehicles.ErrInvalid) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to create driver device", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	resp := fiber.Map{
+		"device": device,
+		"token":  token,
+	}
+	setSecretlessReplay(c, resp, "token")
+	return c.Status(201).JSON(resp)
+}
+
+// DriverDevicesResponse lists the driver app devices of the caller
+type DriverDevicesResponse struct {
+	Devices []vehicles.Device `json:"devices" fields:"items"`
+	Total   int               `json:"total"`
+}
+
+// ListDriverDevices handles GET /v2/driver/devices
+// Lists the caller's devices on the agencies its key may see, revoked ones
+// included
+func ListDriverDevices(c *fiber.Ctx) error {
+	pool, err := db.ReadDB()
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Database error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+	devices, err := vehicles.ListDevices(c.UserContext(), pool, callerPartnerID(c))
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Driver devices query error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	agencies := keyAgencies(c)
+	resp := DriverDevicesResponse{Devices: []vehicles.Device{}}
+	for _, d := range devices {
+		if agencyAllowed(agencies, d.AgencyID) {
+			resp.Devices = append(resp.Devices, d)
+		}
+	}
+	resp.Total = len(resp.Devices)
+	return sendFields(c, resp)
+}
+
+// RevokeDriverDevice handles DELETE /v2/driver/devices/:id
+// The device's token stops working at once; its pings already stored stay
+func RevokeDriverDevice(c *fiber.Ctx) error {
+	pool, err := db.GetDB()
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Database error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+	id := c.Params("id")
+	err = vehicles.RevokeDevice(c.UserContext(), pool, callerPartnerID(c), id, keyAgencies(c))
+	if errors.Is(err, vehicles.ErrDeviceNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "device not found or already revoked"})
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to revoke driver device", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+	return c.JSON(fiber.Map{"id": id, "revoked": true})
+}
+
+// callerPartnerID returns the partner of the calling key, "" when
+// authentication is off
+func callerPartnerID(c *fiber.Ctx) string {
+	if partner, ok := c.Locals("partner").(*middleware.PartnerContext); ok {
+		return partner.PartnerID
+	}
+	return ""
+}
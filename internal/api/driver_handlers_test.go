@@ -0,0 +1,52 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/vehicles"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDriverPings(t *testing.T) {
+	cfg := vehicles.DefaultConfig()
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	device := &vehicles.Device{AgencyID: "aftu", VehicleID: "DK-4521-B", RouteID: "AFTU_23"}
+	accurate, vague := 12.0, 250.0
+
+	req := &DriverPingsRequest{
+		Session: "s1",
+		TripID:  "T_23_0815",
+		Pings: []DriverPing{
+			{Seq: 1, Timestamp: now.Add(-2 * time.Hour).Unix(), Lat: 14.7167, Lon: -17.4677, Accuracy: &accurate},
+			{Seq: 2, Timestamp: now.Unix(), Lat: 14.7169, Lon: -17.4669, RouteID: "AFTU_9"},
+			{Seq: 3, Timestamp: now.Unix(), Lat: 14.7171, Lon: -17.4661, Accuracy: &vague},
+			{Seq: 4, Lat: 14.7171, Lon: -17.4661},
+			{Seq: 6, Timestamp: now.Unix(), Lat: 0, Lon: 0},
+			{Seq: 0, Timestamp: now.Unix(), Lat: 14.7171, Lon: -17.4661},
+		},
+	}
+
+	pings, through, rejected := driverPings(device, req, cfg, now)
+	assert.Equal(t, int64(6), through, "dropped pings are acknowledged too")
+	assert.Equal(t, 4, rejected, "inaccurate, undated, null island and unnumbered pings")
+	if !assert.Len(t, pings, 2) {
+		return
+	}
+
+	p := pings[0].Position
+	assert.Equal(t, "DK-4521-B", p.VehicleID)
+	assert.Equal(t, "aftu", p.AgencyID)
+	assert.Equal(t, "T_23_0815", p.TripID, "the upload's trip")
+	assert.Equal(t, now.Add(-2*time.Hour), p.Timestamp, "buffered pings keep their time")
+
+	p = pings[1].Position
+	assert.Equal(t, "", p.TripID)
+	assert.Equal(t, "AFTU_9", p.RouteID, "a ping's route overrides the upload's trip")
+
+	req = &DriverPingsRequest{Session: "s1", Pings: []DriverPing{{Seq: 1, Timestamp: now.Unix(), Lat: 14.7, Lon: -17.4}}}
+	pings, _, _ = driverPings(device, req, cfg, now)
+	if assert.Len(t, pings, 1) {
+		assert.Equal(t, "AFTU_23", pings[0].Position.RouteID, "the device's route")
+	}
+}
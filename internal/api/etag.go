@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/errreport"
+	"github.com/passbi/passbi_core/internal/realtime"
+	"golang.org/x/sync/singleflight"
+)
+
+// versionTTL is how long the feed version is reused before re-reading it
+const versionTTL = 30 * time.Second
+
+var (
+	versionMu       sync.Mutex
+	cachedVersion   string
+	cachedVersionAt time.Time
+	// versionFlight runs one version query at a time; the lock is not held
+	// during it so requests with a fresh version never wait on the database
+	versionFlight singleflight.Group
+)
+
+// feedVersion identifies the currently imported GTFS data
+// It changes whenever an import completes successfully; empty means unknown
+func feedVersion(ctx context.Context) string {
+	versionMu.Lock()
+	version, at := cachedVersion, cachedVersionAt
+	versionMu.Unlock()
+	if version != "" && time.Since(at) < versionTTL {
+		return version
+	}
+
+	// Callers share the query, so it must not die with the first one's request
+	v, _, _ := versionFlight.Do("feed", func() (interface{}, error) {
+		return loadFeedVersion(context.WithoutCancel(ctx)), nil
+	})
+	return v.(string)
+}
+
+// loadFeedVersion reads the feed version and caches it
+func loadFeedVersion(ctx context.Context) string {
+	pool, err := db.GetDB()
+	if err != nil {
+		return ""
+	}
+
+	var id int64
+	var completedAt *time.Time
+	err = pool.QueryRow(ctx, `
+		SELECT COALESCE(MAX(id), 0), MAX(completed_at)
+		FROM import_log
+		WHERE status = 'success'
+	`).Scan(&id, &completedAt)
+	if err != nil {
+		logger.ErrorContext(ctx, "Feed version query error", "error", err)
+		return ""
+	}
+
+	version := strconv.FormatInt(id, 10)
+	if completedAt != nil {
+		version += "-" + strconv.FormatInt(completedAt.Unix(), 10)
+	}
+
+	versionMu.Lock()
+	cachedVersion = version
+	cachedVersionAt = time.Now()
+	versionMu.Unlock()
+
+	// Errors are tagged with the feed they were served from
+	errreport.SetTag("feed_version", version)
+	return version
+}
+
+// realtimeVersion identifies the latest fresh TripUpdates state
+// Responses that overlay realtime data include it in their ETag
+func realtimeVersion(ctx context.Context) string {
+	pool, err := db.GetDB()
+	if err != nil {
+		return ""
+	}
+
+	var updatedAt *time.Time
+	err = pool.QueryRow(ctx, `
+		SELECT MAX(updated_at) FROM trip_update WHERE updated_at > $1
+	`, time.Now().Add(-realtime.MaxAge)).Scan(&updatedAt)
+	if err != nil {
+		logger.ErrorContext(ctx, "Realtime version query error", "error", err)
+		return ""
+	}
+	if updatedAt == nil {
+		return "none"
+	}
+	return strconv.FormatInt(updatedAt.UnixNano(), 10)
+}
+
+// makeETag builds a weak ETag from version and cache key parts
+func makeETag(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "|")))
+	return `W/"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// notModified sets the ETag header and reports whether the client's
+// If-None-Match already holds it, in which case the handler should return 304
+// An empty version disables ETags so unknown data is never reported unchanged
+// Keys restricted to some agencies get their own tags
+func notModified(c *fiber.Ctx, version string, parts ...string) bool {
+	if version == "" {
+		return false
+	}
+
+	parts = append([]string{version}, parts...)
+	if agencies := keyAgencies(c); len(agencies) > 0 {
+		parts = append(parts, "agencies:"+strings.Join(agencies, ","))
+	}
+	tag := makeETag(parts...)
+	c.Set(fiber.HeaderETag, tag)
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+
+	return etagMatches(c.Get(fiber.HeaderIfNoneMatch), tag)
+}
+
+// etagMatches implements the weak comparison of If-None-Match (RFC 9110)
+func etagMatches(header, tag string) bool {
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	want := strings.TrimPrefix(tag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEtagMatches(t *testing.T) {
+	tag := makeETag("12-1700000000", "routes:list", "BUS", "", "100")
+
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{"empty header", "", false},
+		{"exact", tag, true},
+		{"strong form of weak tag", tag[2:], true},
+		{"in list", `"abc", ` + tag, true},
+		{"wildcard", "*", true},
+		{"other tag", `W/"0000000000000000"`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, etagMatches(tt.header, tag))
+		})
+	}
+}
+
+func TestMakeETagDependsOnVersion(t *testing.T) {
+	assert.NotEqual(t, makeETag("1", "sched:R1"), makeETag("2", "sched:R1"))
+	assert.Equal(t, makeETag("1", "sched:R1"), makeETag("1", "sched:R1"))
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/feedback"
+	"github.com/passbi/passbi_core/internal/middleware"
+	"github.com/passbi/passbi_core/internal/models"
+)
+
+// FeedbackRequest is the body of POST /v2/feedback
+type FeedbackRequest struct {
+	Kind        string   `json:"kind"`
+	Description string   `json:"description"`
+	StopID      string   `json:"stop_id"`
+	RouteID     string   `json:"route_id"`
+	TripID      string   `json:"trip_id"`
+	Lat         *float64 `json:"lat"`
+	Lon         *float64 `json:"lon"`
+	Contact     string   `json:"contact"`
+}
+
+// FeedbackListResponse is the admin listing of data reports
+type FeedbackListResponse struct {
+	Reports []models.FeedbackReport `json:"reports" fields:"items"`
+	Total   int                     `json:"total"`
+}
+
+// FeedbackTriageRequest is the body of PATCH /admin/feedback/:id
+type FeedbackTriageRequest struct {
+	Status     string  `json:"status"`
+	TriageNote *string `json:"triage_note"`
+}
+
+// SubmitFeedback handles POST /v2/feedback
+// Riders and partners report wrong stop locations, missing lines or incorrect
+// times; reports are stored with their geo context for the data team
+func SubmitFeedback(c *fiber.Ctx) error {
+	var req FeedbackRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	report := &models.FeedbackReport{
+		Kind:        models.FeedbackKind(req.Kind),
+		Description: req.Description,
+		StopID:      req.StopID,
+		RouteID:     req.RouteID,
+		TripID:      req.TripID,
+		Lat:         req.Lat,
+		Lon:         req.Lon,
+		Contact:     req.Contact,
+	}
+	if partner, ok := c.Locals("partner").(*middleware.PartnerContext); ok {
+		report.PartnerID = partner.PartnerID
+	}
+
+	if err := feedback.Normalize(report); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	pool, err := db.GetDB()
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Database error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	err = feedback.Create(c.UserContext(), pool, report)
+	if errors.Is(err, feedback.ErrUnknownReference) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to store feedback", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"id":         report.ID,
+		"kind":       report.Kind,
+		"status":     report.Status,
+		"created_at": report.CreatedAt,
+	})
+}
+
+// AdminListFeedback handles GET /admin/feedback?status=new&kind=&stop=&route=&limit=&offset=
+func AdminListFeedback(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(c.Query("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	reports, total, err := feedback.List(c.UserContext(), pool, feedback.Filter{
+		Status:  models.FeedbackStatus(strings.ToLower(c.Query("status"))),
+		Kind:    models.FeedbackKind(strings.ToLower(c.Query("kind"))),
+		StopID:  c.Query("stop"),
+		RouteID: c.Query("route"),
+		Limit:   limit,
+		Offset:  offset,
+	})
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to list feedback", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to retrieve feedback",
+		})
+	}
+
+	return c.JSON(FeedbackListResponse{Reports: reports, Total: total})
+}
+
+// AdminGetFeedback handles GET /admin/feedback/:id
+func AdminGetFeedback(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Feedback ID must be numeric",
+		})
+	}
+
+	report, err := feedback.Get(c.UserContext(), pool, id)
+	if errors.Is(err, feedback.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "not_found",
+			"message": "Feedback report not found",
+		})
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to get feedback", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to retrieve feedback",
+		})
+	}
+
+	return c.JSON(report)
+}
+
+// AdminTriageFeedback handles PATCH /admin/feedback/:id
+// Sets the triage status and optionally a note for the rest of the team
+func AdminTriageFeedback(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Feedback ID must be numeric",
+		})
+	}
+
+	var req FeedbackTriageRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Invalid request body",
+		})
+	}
+
+	status := models.FeedbackStatus(strings.ToLower(strings.TrimSpace(req.Status)))
+	if !feedback.Statuses[status] {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": "status must be new, triaged, resolved or rejected",
+		})
+	}
+
+	report, err := feedback.Triage(c.UserContext(), pool, id, status, req.TriageNote)
+	if errors.Is(err, feedback.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "not_found",
+			"message": "Feedback report not found",
+		})
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to triage feedback", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to update feedback",
+		})
+	}
+
+	return c.JSON(report)
+}
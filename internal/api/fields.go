@@ -0,0 +1,181 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Sparse fieldsets let clients trim list items with ?fields=id,name,routes.mode
+// Selection is driven by struct tags:
+//   - attributes are named by their json tag; dotted paths select inside
+//     nested objects and lists
+//   - `fields:"items"` marks the response field holding the list to trim;
+//     other response fields (totals, query echo...) are always kept
+//   - `fields:"always"` marks item attributes kept whatever the selection,
+//     typically identifiers
+
+// fieldSet is a parsed selection; a nil entry selects the whole value
+type fieldSet map[string]fieldSet
+
+// parseFields parses a comma-separated fields parameter; empty selects everything
+func parseFields(raw string) fieldSet {
+	paths := splitList(raw)
+	if len(paths) == 0 {
+		return nil
+	}
+
+	fs := fieldSet{}
+	for _, path := range paths {
+		fs.add(strings.Split(path, "."))
+	}
+	return fs
+}
+
+func (fs fieldSet) add(path []string) {
+	name := path[0]
+	if name == "" {
+		return
+	}
+
+	child, seen := fs[name]
+	if len(path) == 1 {
+		fs[name] = nil
+		return
+	}
+	if seen && child == nil {
+		return // whole value already selected
+	}
+	if child == nil {
+		child = fieldSet{}
+		fs[name] = child
+	}
+	child.add(path[1:])
+}
+
+// sendFields writes resp as JSON, trimmed to the request's ?fields= selection
+func sendFields(c *fiber.Ctx, resp interface{}) error {
+	fs := parseFields(c.Query("fields"))
+	if fs == nil {
+		return c.JSON(resp)
+	}
+	return c.JSON(applyFields(resp, fs))
+}
+
+// applyFields trims the list items of a response to the selected attributes
+// resp is either a list or a struct with a `fields:"items"` field
+func applyFields(resp interface{}, fs fieldSet) interface{} {
+	v := indirect(reflect.ValueOf(resp))
+	if !v.IsValid() {
+		return resp
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		return shapeValue(v, fs)
+	case reflect.Struct:
+		out := make(map[string]interface{})
+		eachJSONField(v, func(name string, f reflect.StructField, fv reflect.Value) {
+			if f.Tag.Get("fields") == "items" {
+				out[name] = shapeValue(fv, fs)
+			} else {
+				out[name] = fv.Interface()
+			}
+		})
+		return out
+	default:
+		return resp
+	}
+}
+
+var jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// shapeValue keeps the selected attributes of a struct, or of each list element
+func shapeValue(v reflect.Value, fs fieldSet) interface{} {
+	v = indirect(v)
+	if !v.IsValid() {
+		return nil
+	}
+	if fs == nil || v.Type().Implements(jsonMarshaler) {
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = shapeValue(v.Index(i), fs)
+		}
+		return items
+	case reflect.Struct:
+		out := make(map[string]interface{})
+		eachJSONField(v, func(name string, f reflect.StructField, fv reflect.Value) {
+			if child, ok := fs[name]; ok {
+				out[name] = shapeValue(fv, child)
+			} else if f.Tag.Get("fields") == "always" {
+				out[name] = fv.Interface()
+			}
+		})
+		return out
+	default:
+		return v.Interface()
+	}
+}
+
+// eachJSONField calls fn for every field encoding/json would emit for v
+func eachJSONField(v reflect.Value, fn func(name string, f reflect.StructField, fv reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		fv := v.Field(i)
+
+		if f.Anonymous && name == "" {
+			if inner := indirect(fv); inner.IsValid() && inner.Kind() == reflect.Struct {
+				eachJSONField(inner, fn)
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if strings.Contains(opts, "omitempty") && isEmptyValue(fv) {
+			continue
+		}
+
+		fn(name, f, fv)
+	}
+}
+
+// isEmptyValue mirrors the omitempty rule of encoding/json
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Struct:
+		return false
+	default:
+		return v.IsZero()
+	}
+}
+
+// indirect dereferences pointers and interfaces; nil yields an invalid Value
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
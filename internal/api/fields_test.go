@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func shapeJSON(t *testing.T, resp interface{}, fields string) string {
+	out, err := json.Marshal(applyFields(resp, parseFields(fields)))
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	return string(out)
+}
+
+func TestApplyFieldsTrimsItems(t *testing.T) {
+	resp := RoutesListResponse{
+		Routes: []RouteInfo{
+			{ID: "DDD_7", Name: "7", Mode: "BUS", AgencyID: "DDD", StopsCount: 31},
+		},
+		Total: 1,
+	}
+
+	// id is always kept and response-level fields are untouched
+	assert.JSONEq(t, `{"routes":[{"id":"DDD_7","mode":"BUS"}],"total":1}`, shapeJSON(t, resp, "mode"))
+	assert.JSONEq(t, `{"routes":[{"id":"DDD_7"}],"total":1}`, shapeJSON(t, resp, "unknown"))
+}
+
+func TestApplyFieldsNestedPaths(t *testing.T) {
+	resp := NearbyStopsResponse{
+		Stops: []NearbyStop{{
+			ID:        "S1",
+			Name:      "Colobane",
+			DistanceM: 120,
+			Routes: []NearbyRouteInfo{
+				{ID: "DDD_7", Name: "7", Mode: "BUS", AgencyID: "DDD"},
+			},
+		}},
+	}
+
+	assert.JSONEq(t,
+		`{"stops":[{"id":"S1","name":"Colobane","routes":[{"id":"DDD_7","mode":"BUS"}]}]}`,
+		shapeJSON(t, resp, "name,routes.mode"))
+
+	// Selecting a whole object wins over a nested path into it
+	assert.JSONEq(t,
+		`{"stops":[{"id":"S1","routes":[{"id":"DDD_7","name":"7","mode":"BUS","agency_id":"DDD","agency_name":""}]}]}`,
+		shapeJSON(t, resp, "routes.mode,routes"))
+}
+
+func TestApplyFieldsOmitEmptyAndLists(t *testing.T) {
+	delay := 90
+	deps := []DepartureInfo{
+		{TripID: "T1", RouteID: "R1", DelaySeconds: &delay},
+		{TripID: "T2", RouteID: "R1"},
+	}
+
+	assert.JSONEq(t,
+		`[{"trip_id":"T1","delay_seconds":90},{"trip_id":"T2"}]`,
+		shapeJSON(t, deps, "delay_seconds"))
+}
+
+func TestParseFields(t *testing.T) {
+	assert.Nil(t, parseFields(""))
+	assert.Nil(t, parseFields(" , "))
+	assert.Equal(t, fieldSet{"name": nil, "routes": fieldSet{"mode": nil}}, parseFields("name, routes.mode"))
+}
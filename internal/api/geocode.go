@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/passbi/passbi_core/internal/cache"
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/geocode"
+)
+
+// placePrefix marks a route-search endpoint given by name (from=place:Sandaga)
+const placePrefix = "place:"
+
+// errInvalidPlace is returned for an empty place: query
+var errInvalidPlace = errors.New("place name must not be empty")
+
+// resolveLocation turns a route-search endpoint into coordinates
+// "lat,lon" is parsed as is; "place:<name>" is geocoded and the match returned
+func resolveLocation(ctx context.Context, value string) (lat, lon float64, place *geocode.Place, err error) {
+	if !strings.HasPrefix(value, placePrefix) {
+		lat, lon, err = parseCoordinates(value)
+		return lat, lon, nil, err
+	}
+
+	name := strings.TrimSpace(strings.TrimPrefix(value, placePrefix))
+	if name == "" {
+		return 0, 0, nil, errInvalidPlace
+	}
+
+	place, err = geocodePlace(ctx, name)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	return place.Lat, place.Lon, place, nil
+}
+
+// geocodePlace resolves a place name with the configured geocoder, falling
+// back to stop names; matches are cached in Redis
+func geocodePlace(ctx context.Context, name string) (*geocode.Place, error) {
+	key := geocodeKey(name)
+
+	var cached geocode.Place
+	if err := cache.GetJSON(ctx, key, &cached); err == nil {
+		return &cached, nil
+	}
+
+	pool, err := db.ReadDB()
+	if err != nil {
+		return nil, err
+	}
+
+	place, err := geocode.Chain{geocode.Get(), geocode.NewStops(pool)}.Search(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cache.SetJSON(ctx, key, place, cache.TTL(cache.ClassGeocode)); err != nil {
+		logger.WarnContext(ctx, "Failed to cache geocoded place", "error", err)
+	}
+	return place, nil
+}
+
+// geocodeKey generates the cache key of a place name, ignoring case
+func geocodeKey(name string) string {
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(name))))
+	return fmt.Sprintf("geocode:%x", hash[:8])
+}
+
+// locationError converts a resolveLocation failure into a status and message
+func locationError(param, value string, err error) (int, string) {
+	switch {
+	case errors.Is(err, geocode.ErrNotFound):
+		return 404, fmt.Sprintf("no place found for '%s': %s", param, strings.TrimPrefix(value, placePrefix))
+	case errors.Is(err, errInvalidPlace):
+		return 400, fmt.Sprintf("invalid '%s' place: %v", param, err)
+	case strings.HasPrefix(value, placePrefix):
+		logger.Error("Geocoding failed", "place", strings.TrimPrefix(value, placePrefix), "error", err)
+		return 503, "geocoding is temporarily unavailable"
+	default:
+		return 400, fmt.Sprintf("invalid '%s' coordinates: %v", param, err)
+	}
+}
+
+// describeLocation labels a coordinate for display (landmark, neighborhood or
+// nearby stop); labels are cached by ~10 m cell and a failure only omits it
+func describeLocation(ctx context.Context, lat, lon float64) *geocode.Place {
+	key := fmt.Sprintf("revgeo:%.4f,%.4f", lat, lon)
+
+	var cached geocode.Place
+	if err := cache.GetJSON(ctx, key, &cached); err == nil {
+		cached.Lat, cached.Lon = lat, lon
+		return &cached
+	}
+
+	pool, err := db.ReadDB()
+	if err != nil {
+		return nil
+	}
+
+	place, err := geocode.Chain{geocode.Get(), geocode.NewStops(pool)}.Reverse(ctx, lat, lon)
+	if err != nil {
+		if !errors.Is(err, geocode.ErrNotFound) {
+			logger.ErrorContext(ctx, "Reverse geocoding failed", "lat", lat, "lon", lon, "error", err)
+		}
+		return nil
+	}
+
+	if err := cache.SetJSON(ctx, key, place, cache.TTL(cache.ClassReverseGeocode)); err != nil {
+		logger.WarnContext(ctx, "Failed to cache location label", "error", err)
+	}
+	return place
+}
+
+// placeName returns the name of a place, or "" when it is unknown
+func placeName(place *geocode.Place) string {
+	if place == nil {
+		return ""
+	}
+	return place.Name
+}
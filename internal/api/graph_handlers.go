@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/cache"
+	"github.com/passbi/passbi_core/internal/graph"
+	"github.com/passbi/passbi_core/internal/jobs"
+	"github.com/passbi/passbi_core/internal/middleware"
+)
+
+// GraphRebuildResult is stored on a finished graph rebuild job
+type GraphRebuildResult struct {
+	Nodes        int           `json:"nodes"`
+	Edges        int           `json:"edges"`
+	Stops        int           `json:"stops"`
+	StopsCovered int           `json:"stops_covered"`
+	Duration     time.Duration `json:"duration_ns"`
+}
+
+// AdminRebuildGraph handles POST /admin/graph/rebuild
+// Rebuilds nodes and edges from every agency's data in the background and
+// reloads the in-memory graph; the response carries the job to poll
+func AdminRebuildGraph(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+	ctx := c.UserContext()
+
+	// A second rebuild behind a pending one would redo the same work
+	active, err := jobs.Active(ctx, pool, jobs.KindGraphRebuild)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to check graph rebuild jobs", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to start graph rebuild",
+		})
+	}
+	if active != nil {
+		return c.Status(409).JSON(fiber.Map{
+			"error":   "rebuild_in_progress",
+			"message": "A graph rebuild is already queued or running",
+			"job":     active,
+		})
+	}
+
+	partnerID := ""
+	if partner, ok := c.Locals("partner").(*middleware.PartnerContext); ok {
+		partnerID = partner.PartnerID
+	}
+
+	job, err := jobs.GetRunner().Submit(ctx, pool, jobs.KindGraphRebuild, fiber.Map{}, partnerID,
+		func(ctx context.Context, report jobs.Reporter) (interface{}, error) {
+			return runGraphRebuild(ctx, pool, report)
+		})
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to submit graph rebuild job", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to start graph rebuild",
+		})
+	}
+
+	c.Location(strings.TrimSuffix(c.Path(), "/") + "/" + job.ID)
+	return c.Status(202).JSON(job)
+}
+
+// AdminListGraphRebuilds handles GET /admin/graph/rebuild?limit=
+func AdminListGraphRebuilds(c *fiber.Ctx) error {
+	return listJobs(c, jobs.KindGraphRebuild)
+}
+
+// AdminGetGraphRebuild handles GET /admin/graph/rebuild/:id
+func AdminGetGraphRebuild(c *fiber.Ctx) error {
+	return getJob(c, jobs.KindGraphRebuild)
+}
+
+// runGraphRebuild rebuilds the graph tables and swaps in the new graph
+func runGraphRebuild(ctx context.Context, pool *pgxpool.Pool, report jobs.Reporter) (*GraphRebuildResult, error) {
+	startTime := time.Now()
+
+	builder := graph.NewBuilder(pool)
+	builder.Progress = report
+	if err := builder.BuildGraphFromDB(ctx); err != nil {
+		return nil, err
+	}
+
+	report("Reloading in-memory graph", 95)
+	if err := graph.GetGraph().LoadFromDB(ctx, pool); err != nil {
+		return nil, fmt.Errorf("graph rebuilt but reload failed: %w", err)
+	}
+	bumpDataVersion(ctx)
+	if err := graph.NotifyReload(ctx, pool, "rebuild", ""); err != nil {
+		logger.WarnContext(ctx, "Failed to notify graph reload to other instances", "error", err)
+	}
+	WarmRouteCacheAsync(pool)
+
+	var result GraphRebuildResult
+	err := pool.QueryRow(ctx, `
+		SELECT (SELECT COUNT(*) FROM node),
+			(SELECT COUNT(*) FROM edge),
+			(SELECT COUNT(*) FROM stop),
+			(SELECT COUNT(DISTINCT stop_id) FROM node)
+	`).Scan(&result.Nodes, &result.Edges, &result.Stops, &result.StopsCovered)
+	if err != nil {
+		logger.WarnContext(ctx, "Failed to count graph", "error", err)
+	}
+	result.Duration = time.Since(startTime)
+
+	return &result, nil
+}
+
+// GraphReloaded returns what to do once a graph rebuilt by another process is
+// reloaded (graph.ListenForReloads): drop the routes cached from the old
+// graph since the rebuild, then warm the cache again
+func GraphReloaded(pool *pgxpool.Pool) func(context.Context, graph.ReloadNotice) {
+	return func(ctx context.Context, notice graph.ReloadNotice) {
+		bumpDataVersion(ctx)
+		WarmRouteCacheAsync(pool)
+	}
+}
+
+// bumpDataVersion invalidates cached routes, departures and schedules once
+// new data is live; a failure only leaves them to expire with their TTL
+func bumpDataVersion(ctx context.Context) {
+	if _, err := cache.BumpDataVersion(ctx); err != nil {
+		logger.WarnContext(ctx, "Failed to bump cache data version", "error", err)
+	}
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminRebuildGraphInProgress(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer pool.Close()
+
+	// A queued rebuild must not be followed by a second one
+	var queuedID string
+	err = pool.QueryRow(ctx, `
+		INSERT INTO admin_job (kind, params) VALUES ('graph_rebuild', '{}') RETURNING id::text
+	`).Scan(&queuedID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer pool.Exec(ctx, `DELETE FROM admin_job WHERE id = $1`, queuedID)
+
+	app := fiber.New()
+	app.Post("/admin/graph/rebuild", func(c *fiber.Ctx) error {
+		c.Locals("db", pool)
+		return c.Next()
+	}, AdminRebuildGraph)
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/admin/graph/rebuild", nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 409, resp.StatusCode)
+
+	var body struct {
+		Error string `json:"error"`
+		Job   struct {
+			ID string `json:"id"`
+		} `json:"job"`
+	}
+	if assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body)) {
+		assert.Equal(t, "rebuild_in_progress", body.Error)
+		assert.NotEmpty(t, body.Job.ID)
+	}
+}
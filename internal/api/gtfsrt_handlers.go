@@ -0,0 +1,72 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/passbi/passbi_core/internal/alerts"
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/gtfsrt"
+)
+
+// GTFSRTAlerts handles GET /gtfs-rt/alerts
+// Publishes current and upcoming alerts as a GTFS-Realtime ServiceAlerts feed
+// Keys restricted to some agencies get a feed of theirs only
+func GTFSRTAlerts(c *fiber.Ctx) error {
+	pool, err := db.ReadDB()
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Database error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	ctx := c.UserContext()
+	now := time.Now().UTC()
+
+	list, err := alerts.List(ctx, pool, alerts.Filter{EndsAfter: &now})
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Alerts query error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	agencies := keyAgencies(c)
+	if len(agencies) > 0 {
+		routes, err := agencyRoutes(ctx, agencies)
+		if err != nil {
+			logger.ErrorContext(c.Context(), "Agency routes query error", "error", err)
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		list = scopeAlerts(list, agencies, routes)
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT DISTINCT agency_id FROM route
+		WHERE $1::text[] IS NULL OR agency_id = ANY($1)
+		ORDER BY agency_id
+	`, agencies)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Agency query error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+	var agencyIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			logger.ErrorContext(c.Context(), "Agency scan error", "error", err)
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		agencyIDs = append(agencyIDs, id)
+	}
+	rows.Close()
+
+	feed := gtfsrt.AlertsFeed(list, agencyIDs, now)
+
+	c.Set("Content-Type", "application/x-protobuf")
+	if len(agencies) > 0 {
+		// Shared caches must not hand a restricted feed to other keys
+		c.Set("Cache-Control", "private, max-age=30")
+	} else {
+		c.Set("Cache-Control", "public, max-age=30")
+	}
+	return c.Send(feed.Marshal())
+}
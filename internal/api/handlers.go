@@ -3,7 +3,6 @@ package api
 import (
 	"context"
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 	"sync"
@@ -12,23 +11,33 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/passbi/passbi_core/internal/cache"
 	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/geocode"
+	"github.com/passbi/passbi_core/internal/graph"
+	"github.com/passbi/passbi_core/internal/logging"
 	"github.com/passbi/passbi_core/internal/models"
+	"github.com/passbi/passbi_core/internal/repository"
 	"github.com/passbi/passbi_core/internal/routing"
+	"github.com/passbi/passbi_core/internal/tracing"
 )
 
+var logger = logging.For("api")
+
 // RouteSearchResponse is the API response structure
 type RouteSearchResponse struct {
 	Routes        map[string]*RouteResult `json:"routes"`
 	DepartureTime string                  `json:"departure_time"`
+	From          *geocode.Place          `json:"from,omitempty"` // matched place or location label
+	To            *geocode.Place          `json:"to,omitempty"`
 }
 
 // RouteResult represents a single route option
 type RouteResult struct {
-	DurationSeconds int           `json:"duration_seconds"`
-	WalkDistanceM   int           `json:"walk_distance_meters"`
-	Transfers       int           `json:"transfers"`
-	ArrivalTime     string        `json:"arrival_time"`
-	Steps           []models.Step `json:"steps"`
+	DurationSeconds int                   `json:"duration_seconds"`
+	WalkDistanceM   int                   `json:"walk_distance_meters"`
+	Transfers       int                   `json:"transfers"`
+	ArrivalTime     string                `json:"arrival_time"`
+	Steps           []models.Step         `json:"steps"`
+	Alerts          []models.ServiceAlert `json:"alerts,omitempty"`
 }
 
 // RouteSearch handles the /v2/route-search endpoint
@@ -43,25 +52,25 @@ func RouteSearch(c *fiber.Ctx) error {
 		})
 	}
 
-	// Parse coordinates
-	fromLat, fromLon, err := parseCoordinates(fromStr)
+	// Parse coordinates, or geocode place:<name>
+	fromLat, fromLon, fromPlace, err := resolveLocation(c.UserContext(), fromStr)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": fmt.Sprintf("invalid 'from' coordinates: %v", err),
-		})
+		status, msg := locationError("from", fromStr, err)
+		return c.Status(status).JSON(fiber.Map{"error": msg})
 	}
 
-	toLat, toLon, err := parseCoordinates(toStr)
+	toLat, toLon, toPlace, err := resolveLocation(c.UserContext(), toStr)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": fmt.Sprintf("invalid 'to' coordinates: %v", err),
-		})
+		status, msg := locationError("to", toStr, err)
+		return c.Status(status).JSON(fiber.Map{"error": msg})
 	}
 
 	// Parse departure time (default: now, Dakar = UTC+0)
 	now := time.Now().UTC()
 	var baseTimeSecs int
 	timeStr := c.Query("time")
+	// Realtime delays only apply to trips about to run
+	leavingNow := timeStr == ""
 	if timeStr != "" {
 		parts := strings.Split(timeStr, ":")
 		if len(parts) >= 2 {
@@ -75,13 +84,30 @@ func RouteSearch(c *fiber.Ctx) error {
 	}
 
 	// Compute all 4 routes in parallel using in-memory graph
-	ctx := c.Context()
+	ctx := c.UserContext()
 	strategies := routing.GetAllStrategies()
+	agencies := keyAgencies(c)
+
+	// Label coordinate endpoints for display while routes are computed
+	var labels sync.WaitGroup
+	if fromPlace == nil {
+		labels.Add(1)
+		go func() {
+			defer labels.Done()
+			fromPlace = describeLocation(ctx, fromLat, fromLon)
+		}()
+	}
+	if toPlace == nil {
+		labels.Add(1)
+		go func() {
+			defer labels.Done()
+			toPlace = describeLocation(ctx, toLat, toLon)
+		}()
+	}
 
 	type routeResult struct {
 		strategy string
-		path     *models.Path
-		err      error
+		strategyRun
 	}
 
 	resultChan := make(chan routeResult, len(strategies))
@@ -91,11 +117,11 @@ func RouteSearch(c *fiber.Ctx) error {
 		wg.Add(1)
 		go func(strat routing.Strategy) {
 			defer wg.Done()
-			path, err := computeRoute(ctx, fromLat, fromLon, toLat, toLon, strat)
+			start := time.Now()
+			path, cached, err := computeRoute(ctx, fromLat, fromLon, toLat, toLon, strat, agencies)
 			resultChan <- routeResult{
-				strategy: strat.Name(),
-				path:     path,
-				err:      err,
+				strategy:    strat.Name(),
+				strategyRun: strategyRun{path: path, cached: cached, err: err, duration: time.Since(start)},
 			}
 		}(strategy)
 	}
@@ -107,20 +133,34 @@ func RouteSearch(c *fiber.Ctx) error {
 	}()
 
 	// Collect results
-	routes := make(map[string]*RouteResult)
+	runs := make(map[string]strategyRun, len(strategies))
 	for result := range resultChan {
+		runs[result.strategy] = result.strategyRun
+	}
+
+	// Count which strategies found an itinerary of their own
+	recordStrategies(runs)
+
+	routes := make(map[string]*RouteResult)
+	allCached := true
+	for name, result := range runs {
+		allCached = allCached && result.cached
 		if result.err != nil {
-			log.Printf("Route computation failed for strategy %s: %v", result.strategy, result.err)
+			logger.WarnContext(ctx, "Route computation failed", "strategy", name, "error", result.err)
 			// Still continue with other strategies
 			continue
 		}
 
 		if result.path != nil {
 			enrichStepsWithTimes(result.path.Steps, baseTimeSecs)
-			arrivalSecs := baseTimeSecs + result.path.TotalTime
+			duration := result.path.TotalTime
+			if leavingNow {
+				duration += applyRideDelays(ctx, result.path.Steps, baseTimeSecs, now)
+			}
+			arrivalSecs := baseTimeSecs + duration
 
-			routes[result.strategy] = &RouteResult{
-				DurationSeconds: result.path.TotalTime,
+			routes[name] = &RouteResult{
+				DurationSeconds: duration,
 				WalkDistanceM:   result.path.TotalWalk,
 				Transfers:       result.path.Transfers,
 				ArrivalTime:     formatSecondsToTime(arrivalSecs),
@@ -129,71 +169,63 @@ func RouteSearch(c *fiber.Ctx) error {
 		}
 	}
 
+	labels.Wait()
+
 	// Check if we got at least one route
 	if len(routes) == 0 {
+		// Where people search in vain is input for network planning
+		recordGap(fromLat, fromLon, toLat, toLon, runs)
 		return c.Status(404).JSON(fiber.Map{
 			"error": "no routes found between the specified locations",
 		})
 	}
 
+	// A search is a cache hit when no strategy had to be computed
+	c.Locals("cache_hit", allCached)
+
+	// Attach active service alerts affecting each itinerary
+	attachAlerts(ctx, routes)
+
+	// Crowding reported by drivers and riders, or typical for the time
+	attachCrowding(ctx, routes, leavingNow, now)
+
+	// Names and step instructions follow Accept-Language; cached paths stay untranslated
+	localizeRoutes(ctx, requestLang(c), routes)
+
 	return c.JSON(RouteSearchResponse{
 		Routes:        routes,
 		DepartureTime: timeStr,
+		From:          fromPlace,
+		To:            toPlace,
 	})
 }
 
 // computeRoute computes a route with caching
-func computeRoute(ctx context.Context, fromLat, fromLon, toLat, toLon float64, strategy routing.Strategy) (*models.Path, error) {
-	// Generate cache key
-	cacheKey := cache.RouteKey(fromLat, fromLon, toLat, toLon, strategy.Name())
-	lockKey := cache.LockKey(cacheKey)
-
-	// Try to get from cache
-	cachedPath, err := cache.GetRoute(ctx, cacheKey)
-	if err == nil && cachedPath != nil {
-		return cachedPath, nil
-	}
-
-	// Try to acquire lock
-	acquired, err := cache.AcquireLock(ctx, lockKey, 5*time.Second)
-	if err != nil {
-		log.Printf("Failed to acquire lock: %v", err)
-		// Continue without lock (degrade gracefully)
-	} else if !acquired {
-		// Another request is computing this route, wait for it
-		cachedPath, err := cache.WaitForLock(ctx, cacheKey, 3*time.Second)
-		if err == nil && cachedPath != nil {
-			return cachedPath, nil
-		}
-		// If waiting failed, compute anyway
-	}
+// cached reports whether the path came from Redis or a concurrent request
+// A non-empty agencies restricts the path to those agencies' routes
+func computeRoute(ctx context.Context, fromLat, fromLon, toLat, toLon float64, strategy routing.Strategy, agencies []string) (path *models.Path, cached bool, err error) {
+	cacheKey := cache.RouteKey(fromLat, fromLon, toLat, toLon, strategy.Name(), agencies)
 
-	// Ensure lock is released
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "route.strategy", tracing.String("routing.strategy", strategy.Name()))
 	defer func() {
-		if acquired {
-			cache.ReleaseLock(ctx, lockKey)
-		}
+		span.SetAttributes(tracing.Bool("passbi.cache_hit", cached))
+		span.RecordError(err)
+		span.End()
+		observeSearch(ctx, strategy.Name(), odPair{fromLat, fromLon, toLat, toLon}, time.Since(start), cached, err)
 	}()
 
 	// Compute route using in-memory graph (no database queries during routing)
-	router := routing.NewRouter()
-	path, err := router.FindPath(ctx, fromLat, fromLon, toLat, toLon, strategy)
-	if err != nil {
-		return nil, err
-	}
-
-	// Cache result
-	cacheTTL := 10 * time.Minute
-	if err := cache.SetRoute(ctx, cacheKey, path, cacheTTL); err != nil {
-		log.Printf("Failed to cache route: %v", err)
-	}
-
-	return path, nil
+	return cache.ComputeRoute(ctx, cacheKey, cache.TTL(cache.ClassRoute), cache.LockTTL(),
+		func(ctx context.Context) (*models.Path, error) {
+			return routing.NewRouter().WithAgencies(agencies).FindPath(ctx, fromLat, fromLon, toLat, toLon, strategy)
+		})
 }
 
 // Health handles the /health endpoint
+// Reports "degraded" (still 200) when the graph is empty or feed data is stale
 func Health(c *fiber.Ctx) error {
-	ctx := c.Context()
+	ctx := c.UserContext()
 
 	// Check database
 	dbErr := db.HealthCheck(ctx)
@@ -209,12 +241,27 @@ func Health(c *fiber.Ctx) error {
 		redisStatus = redisErr.Error()
 	}
 
+	// Data freshness: a running API with an empty graph or an expired feed
+	// still answers, but with wrong or no results
+	graphStats := graph.GetGraph().Stats()
+	var data *DataHealth
+	if dbErr == nil {
+		d, err := dataHealth(ctx, graphStats, time.Now().UTC())
+		if err != nil {
+			logger.ErrorContext(c.Context(), "Data health check failed", "error", err)
+		} else {
+			data = &d
+		}
+	}
+
 	// Overall status
 	status := "healthy"
 	httpStatus := 200
 	if dbErr != nil || redisErr != nil {
 		status = "unhealthy"
 		httpStatus = 503
+	} else if data == nil || len(data.Warnings) > 0 {
+		status = "degraded"
 	}
 
 	return c.Status(httpStatus).JSON(fiber.Map{
@@ -223,6 +270,8 @@ func Health(c *fiber.Ctx) error {
 			"database": dbStatus,
 			"redis":    redisStatus,
 		},
+		"graph": graphStats,
+		"data":  data,
 	})
 }
 
@@ -256,12 +305,12 @@ func parseCoordinates(coordStr string) (lat, lon float64, err error) {
 
 // NearbyStopsResponse represents the response for nearby stops
 type NearbyStopsResponse struct {
-	Stops []NearbyStop `json:"stops"`
+	Stops []NearbyStop `json:"stops" fields:"items"`
 }
 
 // NearbyRouteInfo represents a route serving a nearby stop
 type NearbyRouteInfo struct {
-	ID         string `json:"id"`
+	ID         string `json:"id" fields:"always"`
 	Name       string `json:"name"`
 	Mode       string `json:"mode"`
 	AgencyID   string `json:"agency_id"`
@@ -270,17 +319,59 @@ type NearbyRouteInfo struct {
 
 // NearbyStop represents a nearby stop with its routes
 type NearbyStop struct {
-	ID            string            `json:"id"`
+	ID            string            `json:"id" fields:"always"`
 	Name          string            `json:"name"`
 	Lat           float64           `json:"lat"`
 	Lon           float64           `json:"lon"`
 	DistanceM     int               `json:"distance_meters"`
+	WalkMinutes   int               `json:"walk_minutes"`
+	WalkSource    string            `json:"walk_source"`
 	Modes         []string          `json:"modes"`
 	Routes        []NearbyRouteInfo `json:"routes"`
 	RoutesCount   int               `json:"routes_count"`
 }
 
+// Nearby stop result limits
+const (
+	defaultNearbyLimit = 20
+	maxNearbyLimit     = 100
+)
+
+// transitModes lists the modes a route can have
+var transitModes = map[string]bool{
+	string(models.ModeBus):   true,
+	string(models.ModeBRT):   true,
+	string(models.ModeTER):   true,
+	string(models.ModeFerry): true,
+	string(models.ModeTram):  true,
+}
+
+// parseModes parses a comma-separated, case-insensitive mode filter
+// It returns nil when the filter is empty
+func parseModes(value string) ([]string, error) {
+	var modes []string
+	for _, m := range splitList(value) {
+		m = strings.ToUpper(m)
+		if !transitModes[m] {
+			return nil, fmt.Errorf("invalid mode %q (use BUS, BRT, TER, FERRY or TRAM)", m)
+		}
+		modes = append(modes, m)
+	}
+	return modes, nil
+}
+
+// WalkSourceStraightLine marks walk times estimated from the straight-line
+// distance; there is no pedestrian network to route on yet
+const WalkSourceStraightLine = "straight_line"
+
+// walkMinutes estimates the walk to a stop, rounded up to whole minutes
+func walkMinutes(distanceM int) (int, string) {
+	secs := graph.WalkSeconds(float64(distanceM))
+	return (secs + 59) / 60, WalkSourceStraightLine
+}
+
 // StopsNearby handles the /v2/stops/nearby endpoint
+// ?mode=BRT and ?route=R1,R2 keep only stops served by a matching route
 func StopsNearby(c *fiber.Ctx) error {
 	// Parse query parameters
 	latStr := c.Query("lat")
@@ -314,16 +405,32 @@ func StopsNearby(c *fiber.Ctx) error {
 		})
 	}
 
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(defaultNearbyLimit)))
+	if err != nil || limit < 1 || limit > maxNearbyLimit {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid limit (must be between 1 and %d)", maxNearbyLimit),
+		})
+	}
+
+	// Optional filters: only stops served by a route of these modes / IDs
+	modes, err := parseModes(c.Query("mode"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	routeIDs := splitList(c.Query("route"))
+
 	// Get database connection
-	pool, err := db.GetDB()
+	pool, err := db.ReadDB()
 	if err != nil {
-		log.Printf("Database error: %v", err)
+		logger.ErrorContext(c.Context(), "Database error", "error", err)
 		return c.Status(500).JSON(fiber.Map{
 			"error": "internal server error",
 		})
 	}
 
-	ctx := c.Context()
+	ctx := c.UserContext()
 
 	// Query nearby stops with their routes, modes, and agency info
 	query := `
@@ -352,6 +459,17 @@ func StopsNearby(c *fiber.Ctx) error {
 					))
 				)
 			) <= $3
+			AND (($4::text[] IS NULL AND $5::text[] IS NULL AND $7::text[] IS NULL) OR EXISTS (
+				SELECT 1
+				FROM node fn
+				JOIN route fr ON fr.id = fn.route_id
+				WHERE fn.stop_id = s.id
+					AND ($4::text[] IS NULL OR fr.mode = ANY($4))
+					AND ($5::text[] IS NULL OR fr.id = ANY($5))
+					AND ($7::text[] IS NULL OR fr.agency_id = ANY($7))
+			))
+			ORDER BY distance
+			LIMIT $6
 		)
 		SELECT
 			sd.id,
@@ -366,12 +484,13 @@ func StopsNearby(c *fiber.Ctx) error {
 		FROM stop_distances sd
 		LEFT JOIN node n ON n.stop_id = sd.id
 		LEFT JOIN route r ON r.id = n.route_id
+			AND ($7::text[] IS NULL OR r.agency_id = ANY($7))
 		ORDER BY sd.distance, r.mode, r.id
 	`
 
-	rows, err := pool.Query(ctx, query, lon, lat, radius)
+	rows, err := pool.Query(ctx, query, lon, lat, radius, modes, routeIDs, limit, keyAgencies(c))
 	if err != nil {
-		log.Printf("Query error: %v", err)
+		logger.ErrorContext(c.Context(), "Query error", "error", err)
 		return c.Status(500).JSON(fiber.Map{
 			"error": "internal server error",
 		})
@@ -393,7 +512,7 @@ func StopsNearby(c *fiber.Ctx) error {
 		var r stopRow
 		if err := rows.Scan(&r.id, &r.name, &r.lat, &r.lon, &r.distanceM,
 			&r.routeID, &r.routeName, &r.mode, &r.agency); err != nil {
-			log.Printf("Scan error: %v", err)
+			logger.ErrorContext(c.Context(), "Scan error", "error", err)
 			continue
 		}
 
@@ -408,6 +527,7 @@ func StopsNearby(c *fiber.Ctx) error {
 				Routes:    []NearbyRouteInfo{},
 				Modes:     []string{},
 			}
+			stop.WalkMinutes, stop.WalkSource = walkMinutes(r.distanceM)
 			stopMap[r.id] = stop
 			stopOrder = append(stopOrder, r.id)
 		}
@@ -436,12 +556,9 @@ func StopsNearby(c *fiber.Ctx) error {
 		}
 	}
 
-	// Build ordered result (limit 20 stops)
+	// Build ordered result (the query already limits the number of stops)
 	var stops []NearbyStop
-	for i, id := range stopOrder {
-		if i >= 20 {
-			break
-		}
+	for _, id := range stopOrder {
 		s := stopMap[id]
 		s.RoutesCount = len(s.Routes)
 		stops = append(stops, *s)
@@ -451,20 +568,22 @@ func StopsNearby(c *fiber.Ctx) error {
 		stops = []NearbyStop{}
 	}
 
-	return c.JSON(NearbyStopsResponse{
+	localizeNearby(ctx, requestLang(c), stops)
+
+	return sendFields(c, NearbyStopsResponse{
 		Stops: stops,
 	})
 }
 
 // RoutesListResponse represents the response for routes list
 type RoutesListResponse struct {
-	Routes []RouteInfo `json:"routes"`
+	Routes []RouteInfo `json:"routes" fields:"items"`
 	Total  int         `json:"total"`
 }
 
 // RouteInfo represents route information
 type RouteInfo struct {
-	ID         string `json:"id"`
+	ID         string `json:"id" fields:"always"`
 	Name       string `json:"name"`
 	Mode       string `json:"mode"`
 	AgencyID   string `json:"agency_id"`
@@ -489,94 +608,84 @@ func RoutesList(c *fiber.Ctx) error {
 		}
 	}
 
-	// Get database connection
-	pool, err := db.GetDB()
-	if err != nil {
-		log.Printf("Database error: %v", err)
-		return c.Status(500).JSON(fiber.Map{
-			"error": "internal server error",
-		})
-	}
-
-	ctx := c.Context()
-
-	// Build query with optional filters
-	query := `
-		SELECT
-			r.id,
-			COALESCE(r.short_name, r.long_name, r.id) AS name,
-			r.mode,
-			r.agency_id,
-			COUNT(DISTINCT n.stop_id) AS stops_count
-		FROM route r
-		LEFT JOIN node n ON n.route_id = r.id
-		WHERE 1=1
-	`
-
-	args := []interface{}{}
-	argCount := 0
-
-	if mode != "" {
-		argCount++
-		query += fmt.Sprintf(" AND UPPER(r.mode) = UPPER($%d)", argCount)
-		args = append(args, mode)
-	}
+	lang := requestLang(c)
 
-	if agency != "" {
-		argCount++
-		query += fmt.Sprintf(" AND r.agency_id = $%d", argCount)
-		args = append(args, agency)
+	// Route list only changes when a feed is imported
+	if notModified(c, feedVersion(c.UserContext()), "routes:list", lang, mode, agency, strconv.Itoa(limit), c.Query("fields")) {
+		return c.SendStatus(fiber.StatusNotModified)
 	}
 
-	query += `
-		GROUP BY r.id, r.short_name, r.long_name, r.mode, r.agency_id
-		ORDER BY r.id
-	`
-
-	// Add limit
-	argCount++
-	query += fmt.Sprintf(" LIMIT $%d", argCount)
-	args = append(args, limit)
+	ctx := c.UserContext()
 
-	rows, err := pool.Query(ctx, query, args...)
+	routes, err := listRoutes(ctx, routesQuery{Mode: mode, Agency: agency, Agencies: keyAgencies(c), Limit: limit})
 	if err != nil {
-		log.Printf("Query error: %v", err)
 		return c.Status(500).JSON(fiber.Map{
 			"error": "internal server error",
 		})
 	}
-	defer rows.Close()
 
-	var routes []RouteInfo
-	for rows.Next() {
-		var route RouteInfo
+	localizeRouteList(ctx, lang, routes)
 
-		if err := rows.Scan(&route.ID, &route.Name, &route.Mode, &route.AgencyID, &route.StopsCount); err != nil {
-			log.Printf("Scan error: %v", err)
-			continue
-		}
+	return sendFields(c, RoutesListResponse{
+		Routes: routes,
+		Total:  len(routes),
+	})
+}
 
-		routes = append(routes, route)
-	}
+// routesQuery holds the filters of a routes listing
+// After pages by route ID: only routes sorting after it are returned
+// Agencies is the calling key's restriction, applied on top of Agency
+type routesQuery struct {
+	Mode     string
+	Agency   string
+	Agencies []string
+	After    string
+	Limit    int
+}
 
-	if routes == nil {
-		routes = []RouteInfo{}
+// listRoutes returns routes ordered by ID with their stop counts
+func listRoutes(ctx context.Context, q routesQuery) ([]RouteInfo, error) {
+	// Get database connection
+	pool, err := db.ReadDB()
+	if err != nil {
+		logger.ErrorContext(ctx, "Database error", "error", err)
+		return nil, err
 	}
 
-	return c.JSON(RoutesListResponse{
-		Routes: routes,
-		Total:  len(routes),
+	found, err := repository.ListRoutes(ctx, pool, repository.RouteFilter{
+		Mode:     q.Mode,
+		AgencyID: q.Agency,
+		Agencies: q.Agencies,
+		After:    q.After,
+		Limit:    q.Limit,
 	})
+	if err != nil {
+		logger.ErrorContext(ctx, "Query error", "error", err)
+		return nil, err
+	}
+
+	routes := make([]RouteInfo, len(found))
+	for i, r := range found {
+		routes[i] = RouteInfo(r)
+	}
+	return routes, nil
 }
 
 // StopSearchResult represents a stop in search results
 type StopSearchResult struct {
-	ID   string  `json:"id"`
+	ID   string  `json:"id" fields:"always"`
 	Name string  `json:"name"`
 	Lat  float64 `json:"lat"`
 	Lon  float64 `json:"lon"`
 }
 
+// StopSearchResponse is the response for the stop search endpoint
+type StopSearchResponse struct {
+	Stops []StopSearchResult `json:"stops" fields:"items"`
+	Query string             `json:"query"`
+	Total int                `json:"total"`
+}
+
 // StopsSearch handles GET /v2/stops/search?q=petersen&limit=10
 func StopsSearch(c *fiber.Ctx) error {
 	query := c.Query("q")
@@ -596,16 +705,30 @@ func StopsSearch(c *fiber.Ctx) error {
 	sanitized = strings.ReplaceAll(sanitized, "_", "\\_")
 	pattern := "%" + sanitized + "%"
 
-	pool, err := db.GetDB()
+	lang := requestLang(c)
+
+	pool, err := db.ReadDB()
 	if err != nil {
-		log.Printf("Database error: %v", err)
+		logger.ErrorContext(c.Context(), "Database error", "error", err)
 		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
 	}
 
-	rows, err := pool.Query(c.Context(), `
+	// Match and rank on the name shown in the requested language
+	rows, err := pool.Query(c.UserContext(), `
 		SELECT id, name, lat, lon
-		FROM stop
+		FROM (
+			SELECT s.id, COALESCE(t.translation, s.name) AS name, s.lat, s.lon
+			FROM stop s
+			LEFT JOIN translation t ON t.table_name = 'stops' AND t.field_name = 'stop_name'
+				AND t.language = $4 AND t.record_id = s.id
+		) localized
 		WHERE name ILIKE $1
+			AND ($5::text[] IS NULL OR EXISTS (
+				SELECT 1
+				FROM node n
+				JOIN route r ON r.id = n.route_id
+				WHERE n.stop_id = localized.id AND r.agency_id = ANY($5)
+			))
 		ORDER BY
 			CASE WHEN lower(name) = lower($2) THEN 0
 				 WHEN lower(name) LIKE lower($2) || '%' THEN 1
@@ -613,9 +736,9 @@ func StopsSearch(c *fiber.Ctx) error {
 			END,
 			name
 		LIMIT $3
-	`, pattern, query, limit)
+	`, pattern, query, limit, lang, keyAgencies(c))
 	if err != nil {
-		log.Printf("Stop search query error: %v", err)
+		logger.ErrorContext(c.Context(), "Stop search query error", "error", err)
 		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
 	}
 	defer rows.Close()
@@ -624,7 +747,7 @@ func StopsSearch(c *fiber.Ctx) error {
 	for rows.Next() {
 		var s StopSearchResult
 		if err := rows.Scan(&s.ID, &s.Name, &s.Lat, &s.Lon); err != nil {
-			log.Printf("Scan error: %v", err)
+			logger.ErrorContext(c.Context(), "Scan error", "error", err)
 			continue
 		}
 		stops = append(stops, s)
@@ -634,10 +757,10 @@ func StopsSearch(c *fiber.Ctx) error {
 		stops = []StopSearchResult{}
 	}
 
-	return c.JSON(fiber.Map{
-		"stops": stops,
-		"query": query,
-		"total": len(stops),
+	return sendFields(c, StopSearchResponse{
+		Stops: stops,
+		Query: query,
+		Total: len(stops),
 	})
 }
 
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseModes(t *testing.T) {
+	modes, err := parseModes("")
+	assert.NoError(t, err)
+	assert.Nil(t, modes)
+
+	modes, err = parseModes("brt, TER")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"BRT", "TER"}, modes)
+
+	_, err = parseModes("BRT,metro")
+	assert.Error(t, err)
+}
+
+func TestWalkMinutes(t *testing.T) {
+	minutes, source := walkMinutes(0)
+	assert.Equal(t, 0, minutes)
+	assert.Equal(t, WalkSourceStraightLine, source)
+
+	// 1.4 m/s: 80m takes 58s, 90m takes 65s and rounds up to two minutes
+	minutes, _ = walkMinutes(80)
+	assert.Equal(t, 1, minutes)
+	minutes, _ = walkMinutes(90)
+	assert.Equal(t, 2, minutes)
+	minutes, _ = walkMinutes(300)
+	assert.Equal(t, 4, minutes)
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/headway"
+	"github.com/passbi/passbi_core/internal/repository"
+)
+
+var (
+	headwayConfigOnce sync.Once
+	headwayCfg        headway.Config
+)
+
+// headwayConfig returns the monitor settings, from HEADWAY_*
+func headwayConfig() headway.Config {
+	headwayConfigOnce.Do(func() {
+		headwayCfg = headway.ConfigFromEnv()
+	})
+	return headwayCfg
+}
+
+// RouteHeadwaysResponse is how regularly a route is running
+type RouteHeadwaysResponse struct {
+	Route          RouteBasic        `json:"route"`
+	Status         string            `json:"status"` // ok, bunched or gap
+	IrregularSince *time.Time        `json:"irregular_since,omitempty"`
+	AlertID        *int64            `json:"alert_id,omitempty"`
+	Bunched        int               `json:"bunched"`
+	Gaps           int               `json:"gaps"`
+	Headways       []headway.Headway `json:"headways" fields:"items"`
+	Total          int               `json:"total"`
+}
+
+// RouteHeadways handles GET /v2/routes/:id/headways
+// For operators: the headway of each vehicle of the route behind the one
+// ahead of it, measured by the last monitor pass, against the schedule, and
+// the alert riders see while the route runs irregularly
+func RouteHeadways(c *fiber.Ctx) error {
+	routeID := c.Params("id")
+	if routeID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "route ID is required"})
+	}
+	agencies := keyAgencies(c)
+	ctx := c.UserContext()
+	if routeHidden(ctx, agencies, routeID) {
+		return c.Status(404).JSON(fiber.Map{"error": "route not found"})
+	}
+
+	pool, err := db.ReadDB()
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Database error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+	route, err := repository.GetRoute(ctx, pool, routeID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "route not found"})
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Route query error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	headways, flag, err := headway.Route(ctx, pool, headwayConfig(), routeID, time.Now().UTC())
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Headways query error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	resp := RouteHeadwaysResponse{Route: RouteBasic(*route), Status: headway.StatusOK, Headways: []headway.Headway{}}
+	for _, h := range headways {
+		if !agencyAllowed(agencies, h.AgencyID) {
+			continue
+		}
+		switch h.Status {
+		case headway.StatusBunched:
+			resp.Bunched++
+		case headway.StatusGap:
+			resp.Gaps++
+		}
+		resp.Headways = append(resp.Headways, h)
+	}
+	if status, ok := headway.Irregular(resp.Headways)[routeID]; ok {
+		resp.Status = status
+	}
+	if flag != nil {
+		resp.IrregularSince, resp.AlertID = &flag.Since, flag.AlertID
+	}
+	resp.Total = len(resp.Headways)
+	return sendFields(c, resp)
+}
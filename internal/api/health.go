@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/passbi/passbi_core/internal/cache"
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/graph"
+)
+
+// Livez handles GET /livez
+// The process is up and serving HTTP; it checks no dependency so a slow
+// database or graph load never gets the process restarted
+func Livez(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(fiber.Map{"status": "alive"})
+}
+
+// Readyz handles GET /readyz
+// Ready means requests can be answered: database reachable and the routing
+// graph loaded into memory. Load balancers should only route traffic to ready
+// instances. Without Redis the instance still answers from its local cache,
+// so it is reported "degraded" but stays ready. In embedded mode there is no
+// database to check
+func Readyz(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	status, body := readiness(db.HealthCheck(ctx), cache.HealthCheck(ctx), graph.GetGraph().IsLoaded())
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(status).JSON(body)
+}
+
+// readiness turns the dependency checks of /readyz into its status and body
+func readiness(dbErr, redisErr error, graphLoaded bool) (int, fiber.Map) {
+	checks := fiber.Map{}
+	ready, degraded := true, false
+
+	if errors.Is(dbErr, db.ErrEmbedded) {
+		checks["database"] = "embedded"
+	} else if dbErr != nil {
+		checks["database"] = dbErr.Error()
+		ready = false
+	} else {
+		checks["database"] = "ok"
+	}
+
+	if redisErr != nil {
+		checks["redis"] = redisErr.Error()
+		degraded = true
+	} else {
+		checks["redis"] = "ok"
+	}
+
+	if graphLoaded {
+		checks["graph"] = "ok"
+	} else {
+		checks["graph"] = "not loaded"
+		ready = false
+	}
+
+	if !ready {
+		return 503, fiber.Map{"status": "not_ready", "checks": checks}
+	}
+	if degraded {
+		return 200, fiber.Map{"status": "degraded", "checks": checks}
+	}
+	return 200, fiber.Map{"status": "ready", "checks": checks}
+}
+
+// FeedStatus describes the imported data of one agency
+type FeedStatus struct {
+	AgencyID       string     `json:"agency_id"`
+	Version        string     `json:"version,omitempty"`
+	ImportedAt     *time.Time `json:"imported_at,omitempty"`
+	ServiceEndDate string     `json:"service_end_date,omitempty"`
+	DaysRemaining  *int       `json:"days_remaining,omitempty"`
+}
+
+// DataHealth is the data freshness section of /health
+type DataHealth struct {
+	FeedVersion string       `json:"feed_version"`
+	Feeds       []FeedStatus `json:"feeds"`
+	Warnings    []string     `json:"warnings,omitempty"`
+}
+
+var (
+	feedStatusMu sync.Mutex
+	feedStatus   []FeedStatus
+	feedStatusAt time.Time
+)
+
+// getMinServiceDays reads HEALTH_MIN_SERVICE_DAYS from env or returns default
+// Feeds with fewer days of service left make /health report degraded
+func getMinServiceDays() int {
+	if val := os.Getenv("HEALTH_MIN_SERVICE_DAYS"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			return n
+		}
+	}
+	return 7
+}
+
+// dataHealth reports the feed version and expiry of each agency's data
+// Health is probed often; the feed query is reused like the feed version
+func dataHealth(ctx context.Context, g graph.Stats, now time.Time) (DataHealth, error) {
+	feeds, err := loadFeedStatus(ctx, now)
+	if err != nil {
+		return DataHealth{}, err
+	}
+
+	return DataHealth{
+		FeedVersion: feedVersion(ctx),
+		Feeds:       feeds,
+		Warnings:    freshnessWarnings(g, feeds, getMinServiceDays()),
+	}, nil
+}
+
+// freshnessWarnings lists the reasons data is too stale to serve well
+func freshnessWarnings(g graph.Stats, feeds []FeedStatus, minDays int) []string {
+	var warnings []string
+	if !g.Loaded || g.Nodes == 0 {
+		warnings = append(warnings, "routing graph is empty")
+	}
+	if len(feeds) == 0 {
+		warnings = append(warnings, "no GTFS feed imported")
+	}
+	for _, f := range feeds {
+		switch {
+		case f.DaysRemaining == nil:
+			warnings = append(warnings, fmt.Sprintf("%s: no service calendar", f.AgencyID))
+		case *f.DaysRemaining <= 0:
+			warnings = append(warnings, fmt.Sprintf("%s: service ended on %s", f.AgencyID, f.ServiceEndDate))
+		case *f.DaysRemaining < minDays:
+			warnings = append(warnings, fmt.Sprintf("%s: service ends in %d days", f.AgencyID, *f.DaysRemaining))
+		}
+	}
+	return warnings
+}
+
+// loadFeedStatus reads each agency's last successful import and the last
+// date its calendar has service
+func loadFeedStatus(ctx context.Context, now time.Time) ([]FeedStatus, error) {
+	feedStatusMu.Lock()
+	defer feedStatusMu.Unlock()
+
+	if feedStatus != nil && time.Since(feedStatusAt) < versionTTL {
+		return withDaysRemaining(feedStatus, now), nil
+	}
+
+	pool, err := db.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := pool.Query(ctx, `
+		WITH agency AS (
+			SELECT DISTINCT agency_id FROM route
+		)
+		SELECT a.agency_id, last.id, last.completed_at,
+			to_char(GREATEST(
+				(SELECT MAX(end_date) FROM calendar c WHERE c.agency_id = a.agency_id),
+				(SELECT MAX(date) FROM calendar_date cd
+					WHERE cd.agency_id = a.agency_id AND cd.exception_type = 1)
+			), 'YYYY-MM-DD')
+		FROM agency a
+		LEFT JOIN LATERAL (
+			SELECT id, completed_at FROM import_log l
+			WHERE l.agency_id = a.agency_id AND l.status = 'success'
+			ORDER BY completed_at DESC NULLS LAST
+			LIMIT 1
+		) last ON true
+		ORDER BY a.agency_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feed status: %w", err)
+	}
+	defer rows.Close()
+
+	feeds := []FeedStatus{}
+	for rows.Next() {
+		var f FeedStatus
+		var importID *int64
+		var endDate *string
+		if err := rows.Scan(&f.AgencyID, &importID, &f.ImportedAt, &endDate); err != nil {
+			return nil, err
+		}
+		if importID != nil {
+			f.Version = strconv.FormatInt(*importID, 10)
+		}
+		if endDate != nil {
+			f.ServiceEndDate = *endDate
+		}
+		feeds = append(feeds, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	feedStatus = feeds
+	feedStatusAt = time.Now()
+	return withDaysRemaining(feeds, now), nil
+}
+
+// withDaysRemaining returns a copy of feeds with days of service left as of
+// now; the end date itself counts as a day of service (Dakar = UTC)
+func withDaysRemaining(feeds []FeedStatus, now time.Time) []FeedStatus {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	out := make([]FeedStatus, len(feeds))
+	for i, f := range feeds {
+		out[i] = f
+		out[i].DaysRemaining = nil
+		end, err := time.Parse("2006-01-02", f.ServiceEndDate)
+		if err != nil {
+			continue
+		}
+		days := int(end.Sub(today).Hours()/24) + 1
+		out[i].DaysRemaining = &days
+	}
+	return out
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/graph"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithDaysRemaining(t *testing.T) {
+	now := time.Date(2026, time.March, 10, 18, 30, 0, 0, time.UTC)
+	feeds := withDaysRemaining([]FeedStatus{
+		{AgencyID: "dakar_dem_dikk", ServiceEndDate: "2026-03-10"},
+		{AgencyID: "aftu", ServiceEndDate: "2026-03-20"},
+		{AgencyID: "ter", ServiceEndDate: "2026-03-09"},
+		{AgencyID: "brt"},
+	}, now)
+
+	if !assert.Len(t, feeds, 4) {
+		return
+	}
+	assert.Equal(t, 1, *feeds[0].DaysRemaining)
+	assert.Equal(t, 11, *feeds[1].DaysRemaining)
+	assert.Equal(t, 0, *feeds[2].DaysRemaining)
+	assert.Nil(t, feeds[3].DaysRemaining)
+}
+
+func TestFreshnessWarnings(t *testing.T) {
+	loaded := graph.Stats{Loaded: true, Nodes: 1200, Edges: 5400}
+	days := func(n int) *int { return &n }
+
+	assert.Empty(t, freshnessWarnings(loaded, []FeedStatus{
+		{AgencyID: "dakar_dem_dikk", DaysRemaining: days(30)},
+	}, 7))
+
+	assert.Equal(t, []string{"routing graph is empty", "no GTFS feed imported"},
+		freshnessWarnings(graph.Stats{}, nil, 7))
+
+	assert.Equal(t, []string{
+		"aftu: service ends in 3 days",
+		"ter: service ended on 2026-01-31",
+		"brt: no service calendar",
+	}, freshnessWarnings(loaded, []FeedStatus{
+		{AgencyID: "aftu", DaysRemaining: days(3)},
+		{AgencyID: "ter", ServiceEndDate: "2026-01-31", DaysRemaining: days(-5)},
+		{AgencyID: "brt"},
+	}, 7))
+}
+
+func TestLivez(t *testing.T) {
+	app := fiber.New()
+	app.Get("/livez", Livez)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/livez", nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "no-store", resp.Header.Get(fiber.HeaderCacheControl))
+	assert.JSONEq(t, `{"status":"alive"}`, string(body))
+}
+
+func TestReadiness(t *testing.T) {
+	down := errors.New("database ping failed: connection refused")
+	noRedis := errors.New("Redis ping failed: connection refused")
+
+	status, body := readiness(nil, nil, true)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "ready", body["status"])
+
+	status, body = readiness(nil, noRedis, true)
+	assert.Equal(t, 200, status, "the local cache still answers without Redis")
+	assert.Equal(t, "degraded", body["status"])
+	assert.Equal(t, noRedis.Error(), body["checks"].(fiber.Map)["redis"])
+
+	status, body = readiness(nil, nil, false)
+	assert.Equal(t, 503, status, "the graph is still loading")
+	assert.Equal(t, "not_ready", body["status"])
+	assert.Equal(t, "not loaded", body["checks"].(fiber.Map)["graph"])
+
+	status, body = readiness(down, nil, true)
+	assert.Equal(t, 503, status)
+	assert.Equal(t, down.Error(), body["checks"].(fiber.Map)["database"])
+
+	status, body = readiness(fmt.Errorf("database connection not initialized: %w", db.ErrEmbedded), nil, true)
+	assert.Equal(t, 200, status, "embedded mode has no database to wait for")
+	assert.Equal(t, "embedded", body["checks"].(fiber.Map)["database"])
+}
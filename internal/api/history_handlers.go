@@ -0,0 +1,81 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/history"
+)
+
+var (
+	historyConfigOnce sync.Once
+	historyCfg        history.Config
+)
+
+// historyConfig returns the archive settings, from HISTORY_*
+func historyConfig() history.Config {
+	historyConfigOnce.Do(func() {
+		historyCfg = history.ConfigFromEnv()
+	})
+	return historyCfg
+}
+
+// TripReplayResponse is what the vehicles of a trip did on a past day
+type TripReplayResponse struct {
+	TripID   string               `json:"trip_id"`
+	Date     string               `json:"date"`
+	Archived bool                 `json:"archived"`
+	Runs     []history.VehicleRun `json:"runs" fields:"items"`
+	Total    int                  `json:"total"`
+}
+
+// TripReplay handles GET /v2/trips/:id/replay
+// For operators: the path each vehicle of a trip followed on a day, with when
+// it reached each stop against the schedule
+func TripReplay(c *fiber.Ctx) error {
+	tripID := c.Params("id")
+	if tripID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "trip ID is required"})
+	}
+
+	// Dakar timezone = UTC+0, so service days start at UTC midnight
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	date := today
+	if dateStr := c.Query("date"); dateStr != "" {
+		parsed, err := time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid date format (use YYYY-MM-DD)"})
+		}
+		if parsed.After(today) {
+			return c.Status(400).JSON(fiber.Map{"error": "date must not be in the future"})
+		}
+		date = parsed
+	}
+
+	pool, err := db.ReadDB()
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Database error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+	replay, err := history.TripReplay(c.UserContext(), pool, historyConfig(), tripID, date)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Trip replay query error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	agencies := keyAgencies(c)
+	resp := TripReplayResponse{TripID: replay.TripID, Date: replay.Date, Archived: replay.Archived, Runs: []history.VehicleRun{}}
+	for _, r := range replay.Runs {
+		if agencyAllowed(agencies, r.AgencyID) {
+			resp.Runs = append(resp.Runs, r)
+		}
+	}
+	if len(resp.Runs) == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "no vehicle positions for this trip on that date"})
+	}
+	resp.Total = len(resp.Runs)
+	return sendFields(c, resp)
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/i18n"
+)
+
+// requestLang negotiates the response language from Accept-Language and
+// advertises it, so shared caches keep one copy per language
+func requestLang(c *fiber.Ctx) string {
+	lang := i18n.Negotiate(c.Get(fiber.HeaderAcceptLanguage))
+	c.Set(fiber.HeaderContentLanguage, lang)
+	c.Vary(fiber.HeaderAcceptLanguage)
+	return lang
+}
+
+// loadNames fetches stop/route name translations for a response
+// Localization is best-effort: failures are logged and return nil,
+// which leaves every name untranslated
+func loadNames(ctx context.Context, lang string, stopIDs, routeIDs []string) *i18n.Names {
+	pool, err := db.ReadDB()
+	if err != nil {
+		logger.WarnContext(ctx, "Skipping name translations", "error", err)
+		return nil
+	}
+
+	names, err := i18n.LoadNames(ctx, pool, lang, stopIDs, routeIDs)
+	if err != nil {
+		logger.ErrorContext(ctx, "Name translations error", "error", err)
+		return nil
+	}
+	return names
+}
+
+// localizeRoutes translates stop and route names in itineraries and
+// describes each step in the requested language
+func localizeRoutes(ctx context.Context, lang string, routes map[string]*RouteResult) {
+	var stopIDs, routeIDs []string
+	for _, result := range routes {
+		r, s := stepScope(result.Steps)
+		routeIDs = append(routeIDs, r...)
+		stopIDs = append(stopIDs, s...)
+		for _, step := range result.Steps {
+			for _, stop := range step.Stops {
+				stopIDs = append(stopIDs, stop.ID)
+			}
+		}
+	}
+
+	names := loadNames(ctx, lang, stopIDs, routeIDs)
+
+	for _, result := range routes {
+		for i := range result.Steps {
+			step := &result.Steps[i]
+			step.FromStopName = names.Stop(step.FromStop, step.FromStopName)
+			step.ToStopName = names.Stop(step.ToStop, step.ToStopName)
+			if step.Route != "" {
+				step.RouteName = names.Route(step.Route, step.RouteName)
+			}
+			for j := range step.Stops {
+				step.Stops[j].Name = names.Stop(step.Stops[j].ID, step.Stops[j].Name)
+			}
+			step.Instruction = i18n.Describe(lang, *step)
+		}
+	}
+}
+
+// localizeDepartures translates the stop and route names of a departures board
+func localizeDepartures(ctx context.Context, lang string, resp *DeparturesResponse) {
+	routeIDs := make([]string, 0, len(resp.Departures))
+	for _, d := range resp.Departures {
+		routeIDs = append(routeIDs, d.RouteID)
+	}
+
+	names := loadNames(ctx, lang, []string{resp.Stop.ID}, routeIDs)
+
+	resp.Stop.Name = names.Stop(resp.Stop.ID, resp.Stop.Name)
+	for i := range resp.Departures {
+		resp.Departures[i].RouteName = names.Route(resp.Departures[i].RouteID, resp.Departures[i].RouteName)
+	}
+}
+
+// localizeSchedule translates names and day labels of a timetable
+func localizeSchedule(ctx context.Context, lang string, resp *ScheduleResponse) {
+	stopIDs := make([]string, 0, len(resp.Stops))
+	for _, s := range resp.Stops {
+		stopIDs = append(stopIDs, s.ID)
+	}
+
+	names := loadNames(ctx, lang, stopIDs, []string{resp.Route.ID})
+
+	resp.Route.Name = names.Route(resp.Route.ID, resp.Route.Name)
+	for i := range resp.Stops {
+		resp.Stops[i].Name = names.Stop(resp.Stops[i].ID, resp.Stops[i].Name)
+	}
+	for i := range resp.Services {
+		resp.Services[i].DayLabels = i18n.DayNames(lang, resp.Services[i].Days)
+	}
+}
+
+// localizeTrips translates the route and stop names of trip details
+func localizeTrips(ctx context.Context, lang string, route *RouteBasic, trips []TripDetail) {
+	var stopIDs []string
+	for _, t := range trips {
+		for _, st := range t.Stops {
+			stopIDs = append(stopIDs, st.StopID)
+		}
+	}
+
+	names := loadNames(ctx, lang, stopIDs, []string{route.ID})
+
+	route.Name = names.Route(route.ID, route.Name)
+	for _, t := range trips {
+		for i := range t.Stops {
+			t.Stops[i].StopName = names.Stop(t.Stops[i].StopID, t.Stops[i].StopName)
+		}
+	}
+}
+
+// localizeNearby translates the names of nearby stops and their routes
+func localizeNearby(ctx context.Context, lang string, stops []NearbyStop) {
+	var stopIDs, routeIDs []string
+	for _, s := range stops {
+		stopIDs = append(stopIDs, s.ID)
+		for _, r := range s.Routes {
+			routeIDs = append(routeIDs, r.ID)
+		}
+	}
+
+	names := loadNames(ctx, lang, stopIDs, routeIDs)
+
+	for i := range stops {
+		stops[i].Name = names.Stop(stops[i].ID, stops[i].Name)
+		for j := range stops[i].Routes {
+			r := &stops[i].Routes[j]
+			r.Name = names.Route(r.ID, r.Name)
+		}
+	}
+}
+
+// localizeRouteList translates route names of the routes list
+func localizeRouteList(ctx context.Context, lang string, routes []RouteInfo) {
+	routeIDs := make([]string, 0, len(routes))
+	for _, r := range routes {
+		routeIDs = append(routeIDs, r.ID)
+	}
+
+	names := loadNames(ctx, lang, nil, routeIDs)
+
+	for i := range routes {
+		routes[i].Name = names.Route(routes[i].ID, routes[i].Name)
+	}
+}
+
+// localizeRouteStops translates the route and stop names of route stops
+func localizeRouteStops(ctx context.Context, lang string, resp *RouteStopsResponse) {
+	var stopIDs []string
+	for _, d := range resp.Directions {
+		for _, s := range d.Stops {
+			stopIDs = append(stopIDs, s.ID)
+		}
+	}
+
+	names := loadNames(ctx, lang, stopIDs, []string{resp.Route.ID})
+
+	resp.Route.Name = names.Route(resp.Route.ID, resp.Route.Name)
+	for _, d := range resp.Directions {
+		for i := range d.Stops {
+			d.Stops[i].Name = names.Stop(d.Stops[i].ID, d.Stops[i].Name)
+		}
+	}
+}
+
+// localizeStopRoutes translates the stop and route names of a stop's routes
+func localizeStopRoutes(ctx context.Context, lang string, resp *StopRoutesResponse) {
+	routeIDs := make([]string, 0, len(resp.Routes))
+	for _, r := range resp.Routes {
+		routeIDs = append(routeIDs, r.ID)
+	}
+
+	names := loadNames(ctx, lang, []string{resp.Stop.ID}, routeIDs)
+
+	resp.Stop.Name = names.Stop(resp.Stop.ID, resp.Stop.Name)
+	for i := range resp.Routes {
+		resp.Routes[i].Name = names.Route(resp.Routes[i].ID, resp.Routes[i].Name)
+	}
+}
+
+// localizeActiveServices translates the route names of an active services response
+func localizeActiveServices(ctx context.Context, lang string, resp *ActiveServicesResponse) {
+	routeIDs := make([]string, 0, len(resp.Routes))
+	for _, r := range resp.Routes {
+		routeIDs = append(routeIDs, r.ID)
+	}
+
+	names := loadNames(ctx, lang, nil, routeIDs)
+
+	for i := range resp.Routes {
+		resp.Routes[i].Name = names.Route(resp.Routes[i].ID, resp.Routes[i].Name)
+	}
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/i18n"
+	"github.com/passbi/passbi_core/internal/ical"
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/passbi/passbi_core/internal/repository"
+)
+
+// maxCalendarEvents bounds the size of a route's daily calendar
+const maxCalendarEvents = 200
+
+// RouteScheduleICS handles GET /v2/routes/:id/schedule.ics
+// Query: date=YYYY-MM-DD (default today), service, direction, trip, stop
+// Each trip running on date becomes an event from its departure (at stop,
+// when given) to its arrival at the terminus, so riders can add a departure
+// to their calendar
+func RouteScheduleICS(c *fiber.Ctx) error {
+	routeID := c.Params("id")
+	if routeID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "route ID is required"})
+	}
+	if routeHidden(c.UserContext(), keyAgencies(c), routeID) {
+		return c.Status(404).JSON(fiber.Map{"error": "route not found"})
+	}
+
+	// Dakar timezone = UTC+0, so service days start at UTC midnight
+	date := time.Now().UTC().Truncate(24 * time.Hour)
+	if dateStr := c.Query("date"); dateStr != "" {
+		parsed, err := time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid date format (use YYYY-MM-DD)"})
+		}
+		date = parsed
+	}
+
+	direction := -1
+	if dirStr := c.Query("direction"); dirStr != "" {
+		dir, err := strconv.Atoi(dirStr)
+		if err != nil || dir < 0 || dir > 1 {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid direction (use 0 or 1)"})
+		}
+		direction = dir
+	}
+
+	pool, err := db.ReadDB()
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Database error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	ctx := c.UserContext()
+	lang := requestLang(c)
+
+	found, err := repository.GetRoute(ctx, pool, routeID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "route not found"})
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Route query error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+	route := RouteBasic(*found)
+
+	// The boarding stop is the requested stop, or the first stop of the trip;
+	// trips that end at the requested stop have nothing to board
+	rows, err := pool.Query(ctx, `
+		WITH `+repository.ActiveServicesCTE(date, "$2")+`
+		SELECT t.trip_id, COALESCE(t.headsign, ''),
+			dep.stop_id, dep_stop.name, dep.departure_seconds,
+			arr.stop_id, arr_stop.name, arr.arrival_seconds,
+			(SELECT COUNT(*) FROM stop_time s
+			 WHERE s.trip_id = t.trip_id AND s.agency_id = t.agency_id
+			   AND s.stop_sequence > dep.stop_sequence) AS num_stops
+		FROM trip t
+		JOIN active_services a ON a.service_id = t.service_id AND a.agency_id = t.agency_id
+		JOIN LATERAL (
+			SELECT st.stop_id, st.stop_sequence,
+				COALESCE(st.departure_seconds, st.arrival_seconds) AS departure_seconds
+			FROM stop_time st
+			WHERE st.trip_id = t.trip_id AND st.agency_id = t.agency_id
+			  AND ($3 = '' OR st.stop_id = $3)
+			ORDER BY st.stop_sequence
+			LIMIT 1
+		) dep ON true
+		JOIN LATERAL (
+			SELECT st.stop_id, st.stop_sequence,
+				COALESCE(st.arrival_seconds, st.departure_seconds) AS arrival_seconds
+			FROM stop_time st
+			WHERE st.trip_id = t.trip_id AND st.agency_id = t.agency_id
+			ORDER BY st.stop_sequence DESC
+			LIMIT 1
+		) arr ON arr.stop_sequence > dep.stop_sequence
+		JOIN stop dep_stop ON dep_stop.id = dep.stop_id
+		JOIN stop arr_stop ON arr_stop.id = arr.stop_id
+		WHERE t.route_id = $1
+		  AND dep.departure_seconds IS NOT NULL
+		  AND ($4 = '' OR t.service_id = $4)
+		  AND ($5 = '' OR t.trip_id = $5)
+		  AND ($6 < 0 OR t.direction = $6)
+		ORDER BY dep.departure_seconds
+		LIMIT $7
+	`, routeID, date, c.Query("stop"), c.Query("service"), c.Query("trip"), direction, maxCalendarEvents)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Calendar trips query error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+	defer rows.Close()
+
+	// Each trip is described as the ride a rider would take
+	type calendarTrip struct {
+		tripID   string
+		headsign string
+		ride     models.Step
+		start    int
+		end      int
+	}
+
+	var trips []calendarTrip
+	var stopIDs []string
+	for rows.Next() {
+		var t calendarTrip
+		var arr *int
+		if err := rows.Scan(&t.tripID, &t.headsign,
+			&t.ride.FromStop, &t.ride.FromStopName, &t.start,
+			&t.ride.ToStop, &t.ride.ToStopName, &arr,
+			&t.ride.NumStops); err != nil {
+			logger.ErrorContext(c.Context(), "Calendar trip scan error", "error", err)
+			continue
+		}
+
+		t.ride.Type = models.EdgeRide
+		t.ride.Route = route.ID
+		t.ride.Mode = models.TransitMode(route.Mode)
+		t.end = t.start
+		if arr != nil {
+			t.end = *arr
+		}
+
+		trips = append(trips, t)
+		stopIDs = append(stopIDs, t.ride.FromStop, t.ride.ToStop)
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(c.Context(), "Calendar trips query error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	// Names follow Accept-Language like the JSON endpoints
+	names := loadNames(ctx, lang, stopIDs, []string{route.ID})
+	route.Name = names.Route(route.ID, route.Name)
+	mode := i18n.ModeName(lang, models.TransitMode(route.Mode))
+
+	cal := ical.Calendar{
+		Name:   mode + " " + route.Name,
+		Events: make([]ical.Event, 0, len(trips)),
+	}
+	for _, t := range trips {
+		ride := t.ride
+		ride.RouteName = route.Name
+		ride.FromStopName = names.Stop(ride.FromStop, ride.FromStopName)
+		ride.ToStopName = names.Stop(ride.ToStop, ride.ToStopName)
+
+		destination := t.headsign
+		if destination == "" {
+			destination = ride.ToStopName
+		}
+
+		cal.Events = append(cal.Events, ical.Event{
+			UID:         fmt.Sprintf("%s-%s-%s@passbi", t.tripID, ride.FromStop, date.Format("20060102")),
+			Summary:     fmt.Sprintf("%s %s → %s", mode, route.Name, destination),
+			Description: i18n.Describe(lang, ride),
+			Location:    ride.FromStopName,
+			Start:       date.Add(time.Duration(t.start) * time.Second),
+			End:         date.Add(time.Duration(t.end) * time.Second),
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, ical.MIMEType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="route-%s-%s.ics"`, fileSafe(route.ID), date.Format("2006-01-02")))
+	return c.Send(cal.Marshal(time.Now()))
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/impersonation"
+	"github.com/passbi/passbi_core/internal/middleware"
+)
+
+// ImpersonateRequest is the body of POST /admin/partners/:id/impersonate
+type ImpersonateRequest struct {
+	Reason   string `json:"reason"`
+	APIKeyID string `json:"api_key_id"` // key to act as on /v2 and /v3
+}
+
+// ImpersonateResponse carries the token acting as the partner
+type ImpersonateResponse struct {
+	Impersonation *impersonation.Impersonation `json:"impersonation"`
+	Token         string                       `json:"token"`
+	TokenType     string                       `json:"token_type"`
+	ExpiresAt     time.Time                    `json:"expires_at"`
+	ExpiresIn     int64                        `json:"expires_in"`
+}
+
+// ImpersonationListResponse is the admin listing of impersonations
+type ImpersonationListResponse struct {
+	Impersonations []impersonation.Impersonation `json:"impersonations"`
+	Total          int                           `json:"total"`
+}
+
+// AdminImpersonate handles POST /admin/partners/:id/impersonate
+// Support staff get a short-lived token that opens the partner's dashboard
+// and, with api_key_id, calls /v2 and /v3 as that key; every request made
+// with it is audited
+func AdminImpersonate(c *fiber.Ctx) error {
+	admin := c.Locals("partner").(*middleware.PartnerContext)
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	var req ImpersonateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Invalid request body",
+		})
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": "reason is required, e.g. the support ticket",
+		})
+	}
+
+	now := time.Now()
+	imp := &impersonation.Impersonation{
+		PartnerID:  c.Params("id"),
+		APIKeyID:   strings.TrimSpace(req.APIKeyID),
+		AdminKeyID: admin.APIKeyID,
+		AdminEmail: admin.Email,
+		Reason:     req.Reason,
+	}
+	err := impersonation.Start(c.UserContext(), pool, imp, middleware.ImpersonationTTL)
+	if errors.Is(err, impersonation.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "not_found",
+			"message": "Partner not found",
+		})
+	}
+	if errors.Is(err, impersonation.ErrUnknownKey) {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": "api_key_id is not a key of this partner",
+		})
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to start impersonation", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to start impersonation",
+		})
+	}
+
+	expiresAt := now.Add(middleware.ImpersonationTTL).Truncate(time.Second)
+	token, err := middleware.IssueImpersonationToken(imp.PartnerID, imp.APIKeyID, imp.ID, now, expiresAt)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to sign impersonation token", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to start impersonation",
+		})
+	}
+
+	logger.InfoContext(c.Context(), "Impersonation started", "impersonation_id", imp.ID, "admin", admin.Email, "impersonated_partner_id", imp.PartnerID, "reason", imp.Reason)
+
+	return c.Status(201).JSON(ImpersonateResponse{
+		Impersonation: imp,
+		Token:         token,
+		TokenType:     "Bearer",
+		ExpiresAt:     expiresAt,
+		ExpiresIn:     int64(expiresAt.Sub(now).Seconds()),
+	})
+}
+
+// AdminListImpersonations handles GET /admin/impersonations?partner_id=&active=&limit=&offset=
+func AdminListImpersonations(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(c.Query("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	list, total, err := impersonation.List(c.UserContext(), pool, impersonation.Filter{
+		PartnerID: c.Query("partner_id"),
+		Active:    c.QueryBool("active"),
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to list impersonations", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to retrieve impersonations",
+		})
+	}
+
+	return c.JSON(ImpersonationListResponse{Impersonations: list, Total: total})
+}
+
+// AdminGetImpersonation handles GET /admin/impersonations/:id
+// The response lists every request made with the impersonation token
+func AdminGetImpersonation(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	imp, err := impersonation.Get(c.UserContext(), pool, c.Params("id"))
+	return respondImpersonation(c, imp, err)
+}
+
+// AdminEndImpersonation handles POST /admin/impersonations/:id/end
+// The token stops working at once instead of at expiry
+func AdminEndImpersonation(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	imp, err := impersonation.End(c.UserContext(), pool, c.Params("id"))
+	return respondImpersonation(c, imp, err)
+}
+
+func respondImpersonation(c *fiber.Ctx, imp *impersonation.Impersonation, err error) error {
+	if errors.Is(err, impersonation.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "not_found",
+			"message": "Impersonation not found",
+		})
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to get impersonation", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to retrieve impersonation",
+		})
+	}
+
+	return c.JSON(imp)
+}
@@ -0,0 +1,304 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/graph"
+	"github.com/passbi/passbi_core/internal/importer"
+	"github.com/passbi/passbi_core/internal/jobs"
+	"github.com/passbi/passbi_core/internal/middleware"
+)
+
+// Feed downloads are bounded so a wrong URL cannot fill the disk or hang a job
+const (
+	maxFeedSize         = 512 << 20
+	feedDownloadTimeout = 10 * time.Minute
+	maxAgencyIDLength   = 64
+)
+
+// ImportRequest is the body of POST /admin/imports
+// Either URL is set or a GTFS zip is uploaded as the multipart field "file"
+type ImportRequest struct {
+	AgencyID        string  `json:"agency_id" form:"agency_id"`
+	URL             string  `json:"url" form:"url"`
+	RebuildGraph    bool    `json:"rebuild_graph" form:"rebuild_graph"`
+	DedupeThreshold float64 `json:"dedupe_threshold" form:"dedupe_threshold"`
+}
+
+// ImportParams are the parameters recorded on an import job
+type ImportParams struct {
+	AgencyID        string  `json:"agency_id"`
+	Source          string  `json:"source"`
+	RebuildGraph    bool    `json:"rebuild_graph"`
+	DedupeThreshold float64 `json:"dedupe_threshold"`
+}
+
+// validate checks an import request; hasFile tells whether a zip was uploaded
+func (r *ImportRequest) validate(hasFile bool) error {
+	r.AgencyID = strings.TrimSpace(r.AgencyID)
+	r.URL = strings.TrimSpace(r.URL)
+
+	if r.AgencyID == "" {
+		return fmt.Errorf("agency_id is required")
+	}
+	if len(r.AgencyID) > maxAgencyIDLength {
+		return fmt.Errorf("agency_id must be at most %d characters", maxAgencyIDLength)
+	}
+	for _, ch := range r.AgencyID {
+		if !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9' || ch == '_' || ch == '-') {
+			return fmt.Errorf("agency_id may only contain letters, digits, '_' and '-'")
+		}
+	}
+
+	switch {
+	case r.URL == "" && !hasFile:
+		return fmt.Errorf("provide a feed url or upload a GTFS zip as 'file'")
+	case r.URL != "" && hasFile:
+		return fmt.Errorf("provide either a feed url or a file, not both")
+	case r.URL != "":
+		u, err := url.Parse(r.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url must be an absolute http(s) URL")
+		}
+	}
+
+	if r.DedupeThreshold == 0 {
+		r.DedupeThreshold = importer.DefaultDedupeThreshold
+	}
+	if r.DedupeThreshold < 1 || r.DedupeThreshold > 500 {
+		return fmt.Errorf("dedupe_threshold must be between 1 and 500 meters")
+	}
+
+	return nil
+}
+
+// AdminCreateImport handles POST /admin/imports
+// The feed is imported in the background; the response carries the job to poll
+func AdminCreateImport(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	var req ImportRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Invalid request body",
+		})
+	}
+
+	upload, err := c.FormFile("file")
+	if err != nil {
+		upload = nil
+	}
+
+	if err := req.validate(upload != nil); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": err.Error(),
+		})
+	}
+
+	params := ImportParams{
+		AgencyID:        req.AgencyID,
+		Source:          req.URL,
+		RebuildGraph:    req.RebuildGraph,
+		DedupeThreshold: req.DedupeThreshold,
+	}
+
+	// Uploads are saved before responding, the request body does not outlive it
+	var gtfsPath string
+	if upload != nil {
+		params.Source = "upload:" + upload.Filename
+		gtfsPath, err = tempFeedPath()
+		if err == nil {
+			err = c.SaveFile(upload, gtfsPath)
+		}
+		if err != nil {
+			logger.ErrorContext(c.Context(), "Failed to store uploaded feed", "error", err)
+			os.Remove(gtfsPath)
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "internal_server_error",
+				"message": "Failed to store uploaded feed",
+			})
+		}
+	}
+
+	partnerID := ""
+	if partner, ok := c.Locals("partner").(*middleware.PartnerContext); ok {
+		partnerID = partner.PartnerID
+	}
+
+	job, err := jobs.GetRunner().Submit(c.UserContext(), pool, jobs.KindImport, params, partnerID,
+		func(ctx context.Context, report jobs.Reporter) (interface{}, error) {
+			return runImportJob(ctx, pool, params, gtfsPath, report)
+		})
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to submit import job", "error", err)
+		if gtfsPath != "" {
+			os.Remove(gtfsPath)
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to start import",
+		})
+	}
+
+	c.Location(strings.TrimSuffix(c.Path(), "/") + "/" + job.ID)
+	return c.Status(202).JSON(job)
+}
+
+// AdminListImports handles GET /admin/imports?limit=
+func AdminListImports(c *fiber.Ctx) error {
+	return listJobs(c, jobs.KindImport)
+}
+
+// AdminGetImport handles GET /admin/imports/:id
+func AdminGetImport(c *fiber.Ctx) error {
+	return getJob(c, jobs.KindImport)
+}
+
+// runImportJob downloads the feed when needed, runs the importer and, after a
+// graph rebuild, reloads this instance's in-memory graph
+func runImportJob(ctx context.Context, pool *pgxpool.Pool, params ImportParams, gtfsPath string, report jobs.Reporter) (*importer.Result, error) {
+	if gtfsPath == "" {
+		report("Downloading feed", 0)
+		path, err := downloadFeed(ctx, params.Source)
+		if err != nil {
+			return nil, err
+		}
+		gtfsPath = path
+	}
+	defer os.Remove(gtfsPath)
+
+	result, err := importer.Run(ctx, pool, importer.Options{
+		AgencyID:        params.AgencyID,
+		GTFSPath:        gtfsPath,
+		DedupeThreshold: params.DedupeThreshold,
+		RebuildGraph:    params.RebuildGraph,
+		Progress: func(step int, description string) {
+			report(description, (step-1)*100/importer.Steps)
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if params.RebuildGraph {
+		report("Reloading in-memory graph", 95)
+		if err := graph.GetGraph().LoadFromDB(ctx, pool); err != nil {
+			return nil, fmt.Errorf("import succeeded but graph reload failed: %w", err)
+		}
+		// The importer bumped the version before the reload; bump again so
+		// routes computed on the old graph in between are dropped as well
+		bumpDataVersion(ctx)
+		WarmRouteCacheAsync(pool)
+	}
+
+	return result, nil
+}
+
+// downloadFeed fetches a GTFS zip into a temporary file and returns its path
+func downloadFeed(ctx context.Context, feedURL string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, feedDownloadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid feed url: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to download feed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download feed: HTTP %d", resp.StatusCode)
+	}
+
+	path, err := tempFeedPath()
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create feed file: %w", err)
+	}
+
+	n, err := io.Copy(f, io.LimitReader(resp.Body, maxFeedSize+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > maxFeedSize {
+		err = fmt.Errorf("feed is larger than %d MB", maxFeedSize>>20)
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to download feed: %w", err)
+	}
+
+	return path, nil
+}
+
+// tempFeedPath reserves a temporary file name for a GTFS zip
+func tempFeedPath() (string, error) {
+	f, err := os.CreateTemp("", "passbi-gtfs-*.zip")
+	if err != nil {
+		return "", fmt.Errorf("failed to create feed file: %w", err)
+	}
+	f.Close()
+	return f.Name(), nil
+}
+
+// listJobs responds with the recent jobs of a kind
+func listJobs(c *fiber.Ctx, kind string) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	list, err := jobs.List(c.UserContext(), pool, kind, limit)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to list jobs", "kind", kind, "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to retrieve jobs",
+		})
+	}
+
+	return c.JSON(fiber.Map{"jobs": list})
+}
+
+// getJob responds with one job, which must be of the given kind
+func getJob(c *fiber.Ctx, kind string) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	job, err := jobs.Get(c.UserContext(), pool, c.Params("id"))
+	if errors.Is(err, jobs.ErrNotFound) || (err == nil && job.Kind != kind) {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "not_found",
+			"message": "Job not found",
+		})
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to get job", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to retrieve job",
+		})
+	}
+
+	return c.JSON(job)
+}
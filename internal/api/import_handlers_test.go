@@ -0,0 +1,37 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/passbi/passbi_core/internal/importer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportRequestValidate(t *testing.T) {
+	req := ImportRequest{AgencyID: " dakar_dem_dikk ", URL: "https://example.com/gtfs.zip"}
+	assert.NoError(t, req.validate(false))
+	assert.Equal(t, "dakar_dem_dikk", req.AgencyID)
+	assert.Equal(t, importer.DefaultDedupeThreshold, req.DedupeThreshold)
+
+	req = ImportRequest{AgencyID: "aftu", DedupeThreshold: 15}
+	assert.NoError(t, req.validate(true))
+
+	cases := map[string]struct {
+		req     ImportRequest
+		hasFile bool
+	}{
+		"missing agency":    {ImportRequest{URL: "https://example.com/gtfs.zip"}, false},
+		"bad agency":        {ImportRequest{AgencyID: "dem dikk", URL: "https://example.com/gtfs.zip"}, false},
+		"no source":         {ImportRequest{AgencyID: "aftu"}, false},
+		"both sources":      {ImportRequest{AgencyID: "aftu", URL: "https://example.com/gtfs.zip"}, true},
+		"non-http url":      {ImportRequest{AgencyID: "aftu", URL: "file:///etc/passwd"}, false},
+		"relative url":      {ImportRequest{AgencyID: "aftu", URL: "/gtfs.zip"}, false},
+		"threshold range":   {ImportRequest{AgencyID: "aftu", URL: "https://example.com/gtfs.zip", DedupeThreshold: 1000}, false},
+		"negative distance": {ImportRequest{AgencyID: "aftu", URL: "https://example.com/gtfs.zip", DedupeThreshold: -5}, false},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, tc.req.validate(tc.hasFile))
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/billing"
+	"github.com/passbi/passbi_core/internal/middleware"
+)
+
+// InvoiceListResponse lists a partner's invoices
+type InvoiceListResponse struct {
+	Invoices []billing.Invoice `json:"invoices"`
+}
+
+// GenerateInvoicesRequest is the body of POST /admin/invoices
+type GenerateInvoicesRequest struct {
+	Month string `json:"month"` // YYYY-MM, the previous month by default
+}
+
+// GetInvoices handles GET /dashboard/invoices
+func GetInvoices(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*middleware.PartnerContext)
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	invoices, err := billing.List(c.UserContext(), pool, partner.PartnerID)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to list invoices", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to retrieve invoices",
+		})
+	}
+
+	return c.JSON(InvoiceListResponse{Invoices: invoices})
+}
+
+// GetInvoice handles GET /dashboard/invoices/:id
+// The invoice comes with its usage by endpoint
+func GetInvoice(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*middleware.PartnerContext)
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Invoice ID must be numeric",
+		})
+	}
+
+	invoice, err := billing.Get(c.UserContext(), pool, partner.PartnerID, id)
+	if errors.Is(err, billing.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "not_found",
+			"message": "Invoice not found",
+		})
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to get invoice", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to retrieve invoice",
+		})
+	}
+
+	return c.JSON(invoice)
+}
+
+// AdminGenerateInvoices handles POST /admin/invoices
+// Generating a month again refreshes its invoices, so it can be rerun after
+// late usage is logged; the current month cannot be invoiced before it ends
+func AdminGenerateInvoices(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	var req GenerateInvoicesRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "invalid_request",
+				"message": "Invalid request body",
+			})
+		}
+	}
+
+	now := time.Now().UTC()
+	currentMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	month := currentMonth.AddDate(0, -1, 0)
+	if req.Month != "" {
+		var err error
+		if month, err = billing.ParseMonth(req.Month); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "validation_error",
+				"message": err.Error(),
+			})
+		}
+	}
+	if !month.Before(currentMonth) {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": "Only months that are over can be invoiced",
+		})
+	}
+
+	count, err := billing.Generate(c.UserContext(), pool, month)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to generate invoices", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to generate invoices",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"month":    month.Format(billing.MonthLayout),
+		"invoices": count,
+	})
+}
+
+// AdminExportInvoices handles GET /admin/invoices/export?month=YYYY-MM&format=csv|json
+// One row per partner for the finance team; CSV by default
+func AdminExportInvoices(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	month, err := billing.ParseMonth(c.Query("month"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": err.Error(),
+		})
+	}
+
+	invoices, err := billing.ListMonth(c.UserContext(), pool, month)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to export invoices", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to retrieve invoices",
+		})
+	}
+
+	if c.Query("format", formatCSV) == formatJSON {
+		return c.JSON(InvoiceListResponse{Invoices: invoices})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(utf8BOM)
+	if err := billing.WriteCSV(&buf, invoices); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to write invoices",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="invoices-%s.csv"`, month.Format(billing.MonthLayout)))
+	return c.Send(buf.Bytes())
+}
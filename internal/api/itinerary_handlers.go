@@ -0,0 +1,285 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/routing"
+)
+
+// itineraryTTL is how long a shared itinerary link stays valid
+const itineraryTTL = 30 * 24 * time.Hour
+
+// Share tokens use an alphabet without look-alike characters (0/O, 1/l/I)
+// so they survive being read out or retyped
+const (
+	tokenAlphabet = "23456789abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+	tokenLength   = 10
+)
+
+// ItineraryRequest is the body of POST /v2/itineraries
+// It takes the same parameters as a route search plus the chosen strategy
+type ItineraryRequest struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Time     string `json:"time"`
+	Strategy string `json:"strategy"`
+}
+
+// LatLon is a coordinate pair with an optional display label
+type LatLon struct {
+	Lat   float64 `json:"lat"`
+	Lon   float64 `json:"lon"`
+	Label string  `json:"label,omitempty"`
+}
+
+// SharedItinerary is a trip plan stored under a short token
+type SharedItinerary struct {
+	Token         string       `json:"token"`
+	URL           string       `json:"url"`
+	From          LatLon       `json:"from"`
+	To            LatLon       `json:"to"`
+	Strategy      string       `json:"strategy"`
+	DepartureTime string       `json:"departure_time"`
+	Itinerary     *RouteResult `json:"itinerary"`
+	CreatedAt     time.Time    `json:"created_at"`
+	ExpiresAt     time.Time    `json:"expires_at"`
+}
+
+// errTokenTaken is returned when a generated token already exists
+var errTokenTaken = errors.New("token already in use")
+
+// CreateItinerary handles POST /v2/itineraries
+// The route is computed server-side so a shared link always shows a real
+// PassBi itinerary rather than client-supplied content
+func CreateItinerary(c *fiber.Ctx) error {
+	var req ItineraryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	if req.From == "" || req.To == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "missing required fields: from and to"})
+	}
+
+	fromLat, fromLon, fromPlace, err := resolveLocation(c.UserContext(), req.From)
+	if err != nil {
+		status, msg := locationError("from", req.From, err)
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	toLat, toLon, toPlace, err := resolveLocation(c.UserContext(), req.To)
+	if err != nil {
+		status, msg := locationError("to", req.To, err)
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	if req.Strategy == "" {
+		req.Strategy = "simple"
+	}
+	strategy := findStrategy(req.Strategy)
+	if strategy == nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid strategy (use no_transfer, direct, simple or fast)"})
+	}
+
+	// Dakar timezone = UTC+0
+	baseTimeSecs := 0
+	now := time.Now().UTC()
+	leavingNow := req.Time == ""
+	if req.Time != "" {
+		secs, err := parseTimeStr(req.Time)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("invalid time format (use HH:MM): %v", err)})
+		}
+		baseTimeSecs = secs
+	} else {
+		baseTimeSecs = now.Hour()*3600 + now.Minute()*60 + now.Second()
+		req.Time = now.Format("15:04")
+	}
+
+	ctx := c.UserContext()
+	path, cached, err := computeRoute(ctx, fromLat, fromLon, toLat, toLon, strategy, keyAgencies(c))
+	if err != nil {
+		logger.WarnContext(ctx, "Route computation failed", "strategy", strategy.Name(), "error", err)
+		return c.Status(404).JSON(fiber.Map{"error": "no route found between the specified locations"})
+	}
+
+	c.Locals("cache_hit", cached)
+
+	// Labels are stored with the link; coordinates are described once here
+	if fromPlace == nil {
+		fromPlace = describeLocation(ctx, fromLat, fromLon)
+	}
+	if toPlace == nil {
+		toPlace = describeLocation(ctx, toLat, toLon)
+	}
+
+	enrichStepsWithTimes(path.Steps, baseTimeSecs)
+	duration := path.TotalTime
+	if leavingNow {
+		duration += applyRideDelays(ctx, path.Steps, baseTimeSecs, now)
+	}
+	shared := SharedItinerary{
+		From:          LatLon{Lat: fromLat, Lon: fromLon, Label: placeName(fromPlace)},
+		To:            LatLon{Lat: toLat, Lon: toLon, Label: placeName(toPlace)},
+		Strategy:      strategy.Name(),
+		DepartureTime: req.Time,
+		Itinerary: &RouteResult{
+			DurationSeconds: duration,
+			WalkDistanceM:   path.TotalWalk,
+			Transfers:       path.Transfers,
+			ArrivalTime:     formatSecondsToTime(baseTimeSecs + duration),
+			Steps:           path.Steps,
+		},
+	}
+
+	pool, err := db.GetDB()
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Database error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	// Collisions are unlikely with 56^10 tokens; retry a few times anyway
+	for attempt := 0; attempt < 3; attempt++ {
+		shared.Token, err = newShareToken()
+		if err == nil {
+			err = saveItinerary(ctx, pool, &shared)
+		}
+		if !errors.Is(err, errTokenTaken) {
+			break
+		}
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to save itinerary", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	shared.URL = c.BaseURL() + strings.TrimSuffix(c.Path(), "/") + "/" + shared.Token
+	c.Location(shared.URL)
+
+	respondItinerary(ctx, requestLang(c), &shared)
+	return c.Status(201).JSON(shared)
+}
+
+// GetItinerary handles GET /v2/itineraries/:token
+func GetItinerary(c *fiber.Ctx) error {
+	token := c.Params("token")
+	if token == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "token is required"})
+	}
+
+	pool, err := db.GetDB()
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Database error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	ctx := c.UserContext()
+	var shared SharedItinerary
+	var itinerary []byte
+	err = pool.QueryRow(ctx, `
+		SELECT token, from_lat, from_lon, COALESCE(from_label, ''),
+			to_lat, to_lon, COALESCE(to_label, ''), strategy,
+			departure_time, itinerary, created_at, expires_at
+		FROM shared_itinerary
+		WHERE token = $1 AND expires_at > NOW()
+	`, token).Scan(&shared.Token,
+		&shared.From.Lat, &shared.From.Lon, &shared.From.Label,
+		&shared.To.Lat, &shared.To.Lon, &shared.To.Label,
+		&shared.Strategy, &shared.DepartureTime, &itinerary,
+		&shared.CreatedAt, &shared.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(404).JSON(fiber.Map{"error": "itinerary not found or expired"})
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Itinerary query error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	if err := json.Unmarshal(itinerary, &shared.Itinerary); err != nil {
+		logger.ErrorContext(c.Context(), "Itinerary decode error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	// Keys restricted to some agencies cannot open links riding other agencies' routes
+	if agencies := keyAgencies(c); len(agencies) > 0 {
+		allowed, err := agencyRoutes(ctx, agencies)
+		if err != nil {
+			logger.ErrorContext(c.Context(), "Agency routes query error", "error", err)
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		if !stepsAllowed(shared.Itinerary.Steps, allowed) {
+			return c.Status(404).JSON(fiber.Map{"error": "itinerary not found or expired"})
+		}
+	}
+
+	shared.URL = c.BaseURL() + c.Path()
+
+	respondItinerary(ctx, requestLang(c), &shared)
+	return c.JSON(shared)
+}
+
+// respondItinerary attaches current alerts and localizes names
+// Both are applied per request, the stored itinerary stays as computed
+func respondItinerary(ctx context.Context, lang string, shared *SharedItinerary) {
+	routes := map[string]*RouteResult{shared.Strategy: shared.Itinerary}
+	attachAlerts(ctx, routes)
+	localizeRoutes(ctx, lang, routes)
+}
+
+// saveItinerary stores a shared itinerary and sets its timestamps
+func saveItinerary(ctx context.Context, pool *pgxpool.Pool, shared *SharedItinerary) error {
+	itinerary, err := json.Marshal(shared.Itinerary)
+	if err != nil {
+		return fmt.Errorf("failed to encode itinerary: %w", err)
+	}
+
+	err = pool.QueryRow(ctx, `
+		INSERT INTO shared_itinerary (token, from_lat, from_lon, from_label,
+			to_lat, to_lon, to_label, strategy, departure_time, itinerary, expires_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, NULLIF($7, ''), $8, $9, $10, $11)
+		ON CONFLICT (token) DO NOTHING
+		RETURNING created_at, expires_at
+	`, shared.Token, shared.From.Lat, shared.From.Lon, shared.From.Label,
+		shared.To.Lat, shared.To.Lon, shared.To.Label,
+		shared.Strategy, shared.DepartureTime, itinerary, time.Now().Add(itineraryTTL),
+	).Scan(&shared.CreatedAt, &shared.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errTokenTaken
+	}
+	return err
+}
+
+// newShareToken returns a random token drawn from tokenAlphabet
+func newShareToken() (string, error) {
+	base := big.NewInt(int64(len(tokenAlphabet)))
+	b := make([]byte, tokenLength)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, base)
+		if err != nil {
+			return "", err
+		}
+		b[i] = tokenAlphabet[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// findStrategy returns the routing strategy with the given name, or nil
+// Unlike routing.GetStrategy it does not fall back to the default
+func findStrategy(name string) routing.Strategy {
+	for _, s := range routing.GetAllStrategies() {
+		if s.Name() == name {
+			return s
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewShareToken(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		token, err := newShareToken()
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Len(t, token, tokenLength)
+		for _, r := range token {
+			assert.True(t, strings.ContainsRune(tokenAlphabet, r), "unexpected character %q", r)
+		}
+		assert.False(t, seen[token])
+		seen[token] = true
+	}
+}
+
+func TestFindStrategy(t *testing.T) {
+	assert.Equal(t, "fast", findStrategy("fast").Name())
+	assert.Equal(t, "no_transfer", findStrategy("no_transfer").Name())
+	assert.Nil(t, findStrategy("fastest"))
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/passbi/passbi_core/internal/middleware"
+	"github.com/redis/go-redis/v9"
+)
+
+// LimitsResponse is the calling key's rate-limit status
+type LimitsResponse struct {
+	Tier   string                 `json:"tier"`
+	Limits map[string]interface{} `json:"limits"`
+	// Weights lists the endpoints costing more than one unit of the daily
+	// and monthly quotas
+	Weights map[string]int `json:"endpoint_weights"`
+}
+
+// GetLimits handles GET /v2/limits
+// Partners poll it to self-throttle; the call itself is not counted
+func GetLimits(c *fiber.Ctx) error {
+	partner, ok := c.Locals("partner").(*middleware.PartnerContext)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "API key required"})
+	}
+	rdb, ok := c.Locals("redis").(*redis.Client)
+	if !ok {
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+	rateLimits, _ := c.Locals("rate_limits").(map[string]int)
+	weights, _ := c.Locals("endpoint_weights").(map[string]int)
+	if weights == nil {
+		weights = map[string]int{}
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(LimitsResponse{
+		Tier:    partner.Tier,
+		Limits:  middleware.GetRateLimitStatus(c.UserContext(), rdb, partner, rateLimits),
+		Weights: weights,
+	})
+}
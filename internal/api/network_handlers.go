@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/passbi/passbi_core/internal/cache"
+	"github.com/passbi/passbi_core/internal/db"
+)
+
+// coverageRadius is the walking distance a stop is considered to serve (meters)
+// 500 m is the usual catchment of a bus stop in planning studies
+const coverageRadius = 500
+
+// ModeStats is the network size of one transport mode
+type ModeStats struct {
+	Mode   string  `json:"mode"`
+	Routes int     `json:"routes"`
+	Stops  int     `json:"stops"`
+	LineKm float64 `json:"line_km"`
+}
+
+// NetworkStatsResponse is the response for the network statistics endpoint
+type NetworkStatsResponse struct {
+	Stops                int         `json:"stops"`
+	Routes               int         `json:"routes"`
+	Agencies             int         `json:"agencies"`
+	LineKm               float64     `json:"line_km"`
+	CoverageRadiusMeters int         `json:"coverage_radius_m"`
+	CoverageKm2          float64     `json:"coverage_km2"`
+	Modes                []ModeStats `json:"modes"`
+	GeneratedAt          time.Time   `json:"generated_at"`
+}
+
+// NetworkStats handles GET /v2/network/stats
+// Size of the network for planners and public reporting: stops, routes, line
+// length by mode and the area within walking distance of a stop
+// Keys restricted to some agencies get the statistics of theirs
+func NetworkStats(c *fiber.Ctx) error {
+	if notModified(c, feedVersion(c.UserContext()), "network:stats") {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	ctx := c.UserContext()
+	agencies := keyAgencies(c)
+	cacheKey := cache.NetworkStatsKey(agencies)
+
+	var resp NetworkStatsResponse
+	if err := cache.GetJSON(ctx, cacheKey, &resp); err != nil {
+		loaded, err := loadNetworkStats(ctx, agencies)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		resp = *loaded
+
+		if err := cache.SetJSON(ctx, cacheKey, resp, cache.TTL(cache.ClassNetworkStats)); err != nil {
+			logger.WarnContext(c.Context(), "Cache set error", "error", err)
+		}
+	}
+
+	return c.JSON(resp)
+}
+
+// loadNetworkStats computes network statistics from the database
+// Line length sums the distinct stop-to-stop hops of each route (the graph's
+// RIDE edges), both directions counted once, so a route running the same
+// street both ways is measured once and variants add only their extra hops
+// agencies, when set, limits the network to their routes and the stops these
+// serve
+func loadNetworkStats(ctx context.Context, agencies []string) (*NetworkStatsResponse, error) {
+	pool, err := db.ReadDB()
+	if err != nil {
+		logger.ErrorContext(ctx, "Database error", "error", err)
+		return nil, err
+	}
+
+	resp := &NetworkStatsResponse{
+		CoverageRadiusMeters: coverageRadius,
+		Modes:                []ModeStats{},
+		GeneratedAt:          time.Now().UTC(),
+	}
+
+	err = pool.QueryRow(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM stop s WHERE `+stopServedBy+`),
+			(SELECT COUNT(*) FROM route WHERE $1::text[] IS NULL OR agency_id = ANY($1)),
+			(SELECT COUNT(DISTINCT agency_id) FROM route WHERE $1::text[] IS NULL OR agency_id = ANY($1))
+	`, agencies).Scan(&resp.Stops, &resp.Routes, &resp.Agencies)
+	if err != nil {
+		logger.ErrorContext(ctx, "Network count query error", "error", err)
+		return nil, err
+	}
+
+	rows, err := pool.Query(ctx, `
+		WITH hop AS (
+			SELECT DISTINCT LEAST(e.from_node_id, e.to_node_id) AS a,
+				GREATEST(e.from_node_id, e.to_node_id) AS b
+			FROM edge e
+			JOIN node fn ON fn.id = e.from_node_id
+			JOIN route fr ON fr.id = fn.route_id
+			WHERE e.type = 'RIDE'
+				AND ($1::text[] IS NULL OR fr.agency_id = ANY($1))
+		),
+		line_length AS (
+			SELECT n1.mode, SUM(ST_Distance(n1.geom, n2.geom)) AS meters
+			FROM hop h
+			JOIN node n1 ON n1.id = h.a
+			JOIN node n2 ON n2.id = h.b
+			GROUP BY n1.mode
+		),
+		mode_size AS (
+			SELECT r.mode, COUNT(DISTINCT r.id) AS routes, COUNT(DISTINCT n.stop_id) AS stops
+			FROM route r
+			LEFT JOIN node n ON n.route_id = r.id
+			WHERE $1::text[] IS NULL OR r.agency_id = ANY($1)
+			GROUP BY r.mode
+		)
+		SELECT m.mode, m.routes, m.stops, COALESCE(l.meters, 0)
+		FROM mode_size m
+		LEFT JOIN line_length l ON l.mode = m.mode
+		ORDER BY m.routes DESC, m.mode
+	`, agencies)
+	if err != nil {
+		logger.ErrorContext(ctx, "Network mode query error", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totalMeters float64
+	for rows.Next() {
+		var m ModeStats
+		var meters float64
+		if err := rows.Scan(&m.Mode, &m.Routes, &m.Stops, &meters); err != nil {
+			logger.ErrorContext(ctx, "Network mode scan error", "error", err)
+			return nil, err
+		}
+		m.LineKm = roundKm(meters / 1000)
+		totalMeters += meters
+		resp.Modes = append(resp.Modes, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	resp.LineKm = roundKm(totalMeters / 1000)
+
+	// Overlapping catchments are merged so dense areas are not counted twice
+	var coverageM2 float64
+	err = pool.QueryRow(ctx, `
+		SELECT COALESCE(ST_Area(ST_Union(ST_Buffer(geom, $2)::geometry)::geography), 0)
+		FROM stop s
+		WHERE geom IS NOT NULL AND `+stopServedBy+`
+	`, agencies, coverageRadius).Scan(&coverageM2)
+	if err != nil {
+		logger.ErrorContext(ctx, "Network coverage query error", "error", err)
+		return nil, err
+	}
+	resp.CoverageKm2 = roundKm(coverageM2 / 1e6)
+
+	return resp, nil
+}
+
+// stopServedBy matches the stops s served by a route of the agencies in $1,
+// or every stop when $1 is NULL
+const stopServedBy = `($1::text[] IS NULL OR EXISTS (
+	SELECT 1 FROM node n JOIN route r ON r.id = n.route_id
+	WHERE n.stop_id = s.id AND r.agency_id = ANY($1)
+))`
+
+// roundKm rounds a distance or area to one decimal
+func roundKm(v float64) float64 {
+	return math.Round(v*10) / 10
+}
@@ -0,0 +1,14 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundKm(t *testing.T) {
+	assert.Equal(t, 12.3, roundKm(12.34))
+	assert.Equal(t, 12.4, roundKm(12.36))
+	assert.Equal(t, 0.0, roundKm(0.04), "a single short hop")
+	assert.Equal(t, 0.8, roundKm(785398.16/1e6), "the area of one 500 m catchment")
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/middleware"
+	"github.com/passbi/passbi_core/internal/notify"
+)
+
+// QuotaNotificationRequest is the body of PUT /dashboard/notifications/quota
+// Omitted fields keep their current value
+type QuotaNotificationRequest struct {
+	WebhookURL          *string  `json:"webhook_url"`
+	Email               *string  `json:"email"`
+	EmailEnabled        *bool    `json:"email_enabled"`
+	Thresholds          []int    `json:"thresholds"`
+	Windows             []string `json:"windows"`
+	RotateWebhookSecret bool     `json:"rotate_webhook_secret"`
+}
+
+// GetQuotaNotifications handles GET /dashboard/notifications/quota
+func GetQuotaNotifications(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*middleware.PartnerContext)
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	settings, err := notify.LoadQuotaSettings(c.UserContext(), pool, partner.PartnerID)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to get quota notifications", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to retrieve notification settings",
+		})
+	}
+
+	return c.JSON(settings)
+}
+
+// UpdateQuotaNotifications handles PUT /dashboard/notifications/quota
+// Setting a webhook URL creates its signing secret; rotate_webhook_secret
+// replaces it
+func UpdateQuotaNotifications(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*middleware.PartnerContext)
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	var req QuotaNotificationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Invalid request body",
+		})
+	}
+
+	ctx := c.UserContext()
+	settings, err := notify.LoadQuotaSettings(ctx, pool, partner.PartnerID)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to get quota notifications", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to retrieve notification settings",
+		})
+	}
+
+	if req.WebhookURL != nil {
+		settings.WebhookURL = strings.TrimSpace(*req.WebhookURL)
+	}
+	if req.Email != nil {
+		settings.Email = strings.TrimSpace(*req.Email)
+	}
+	if req.EmailEnabled != nil {
+		settings.EmailEnabled = *req.EmailEnabled
+	}
+	if req.Thresholds != nil {
+		settings.Thresholds = req.Thresholds
+	}
+	if req.Windows != nil {
+		settings.Windows = req.Windows
+	}
+	if err := settings.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": err.Error(),
+		})
+	}
+
+	if settings.WebhookURL != "" && (settings.WebhookSecret == "" || req.RotateWebhookSecret) {
+		secret := make([]byte, 24)
+		rand.Read(secret)
+		settings.WebhookSecret = "whsec_" + hex.EncodeToString(secret)
+	}
+
+	if err := notify.SaveQuotaSettings(ctx, pool, partner.PartnerID, settings); err != nil {
+		logger.ErrorContext(c.Context(), "Failed to save quota notifications", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to save notification settings",
+		})
+	}
+
+	return c.JSON(settings)
+}
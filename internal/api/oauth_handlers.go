@@ -0,0 +1,155 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/middleware"
+)
+
+// TokenRequest is the body of POST /oauth/token (RFC 6749 section 4.4)
+// Client credentials may also be sent with HTTP Basic authentication
+type TokenRequest struct {
+	GrantType    string `json:"grant_type" form:"grant_type"`
+	ClientID     string `json:"client_id" form:"client_id"`
+	ClientSecret string `json:"client_secret" form:"client_secret"`
+	Scope        string `json:"scope" form:"scope"`
+}
+
+// TokenResponse is a successful access token response
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// OAuthToken exchanges an OAuth client's credentials for a short-lived access
+// token carrying the requested scopes (all of the client's by default)
+// Errors use the OAuth2 format ({"error", "error_description"})
+func OAuthToken(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set("Pragma", "no-cache")
+
+	var req TokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return oauthError(c, 400, "invalid_request", "Invalid request body")
+	}
+
+	basic := false
+	if id, secret, ok := basicCredentials(c.Get(fiber.HeaderAuthorization)); ok {
+		req.ClientID, req.ClientSecret, basic = id, secret, true
+	}
+
+	if req.GrantType != "client_credentials" {
+		return oauthError(c, 400, "unsupported_grant_type", "grant_type must be client_credentials")
+	}
+	if req.ClientID == "" || req.ClientSecret == "" {
+		return oauthError(c, 400, "invalid_request", "client_id and client_secret are required")
+	}
+
+	hash := sha256.Sum256([]byte(req.ClientSecret))
+	var partnerID string
+	var clientScopes []string
+	err := pool.QueryRow(c.UserContext(), `
+		SELECT ak.partner_id, ak.scopes
+		FROM api_key ak
+		JOIN partner p ON p.id = ak.partner_id
+		WHERE ak.id::text = $1
+			AND ak.key_hash = $2
+			AND ak.kind = 'oauth_client'
+			AND ak.is_active = true
+			AND p.status = 'active'
+			AND (ak.expires_at IS NULL OR ak.expires_at > NOW())
+	`, req.ClientID, hex.EncodeToString(hash[:])).Scan(&partnerID, &clientScopes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if basic {
+			c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="passbi"`)
+		}
+		return oauthError(c, 401, "invalid_client", "Unknown client or wrong client_secret")
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to load OAuth client", "error", err)
+		return oauthError(c, 500, "server_error", "Failed to issue access token")
+	}
+
+	scopes, ok := requestedScopes(clientScopes, req.Scope)
+	if !ok {
+		return oauthError(c, 400, "invalid_scope", "The client is not allowed every requested scope")
+	}
+
+	now := time.Now()
+	token, expiresAt, err := middleware.IssueAccessToken(partnerID, req.ClientID, scopes, now)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to issue access token", "error", err)
+		return oauthError(c, 500, "server_error", "Failed to issue access token")
+	}
+
+	return c.JSON(TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(expiresAt.Sub(now).Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	})
+}
+
+// requestedScopes resolves the space-separated scope parameter against the
+// client's scopes; an empty request grants all of them
+func requestedScopes(clientScopes []string, scope string) ([]string, bool) {
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		return clientScopes, true
+	}
+
+	client := &middleware.PartnerContext{Scopes: clientScopes}
+	for _, s := range requested {
+		if !client.HasScope(s) {
+			return nil, false
+		}
+	}
+	return requested, true
+}
+
+// basicCredentials decodes HTTP Basic client credentials, which RFC 6749
+// form-encodes before base64
+func basicCredentials(header string) (id, secret string, ok bool) {
+	const prefix = "Basic "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(header[len(prefix):]))
+	if err != nil {
+		return "", "", false
+	}
+	id, secret, ok = strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", false
+	}
+
+	if id, err = url.QueryUnescape(id); err != nil {
+		return "", "", false
+	}
+	if secret, err = url.QueryUnescape(secret); err != nil {
+		return "", "", false
+	}
+	return id, secret, true
+}
+
+// oauthError writes an OAuth2 error response
+func oauthError(c *fiber.Ctx, status int, code, description string) error {
+	return c.Status(status).JSON(fiber.Map{
+		"error":             code,
+		"error_description": description,
+	})
+}
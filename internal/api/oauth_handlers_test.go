@@ -0,0 +1,36 @@
+package api
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestedScopes(t *testing.T) {
+	client := []string{"read:*", "write:alerts"}
+
+	scopes, ok := requestedScopes(client, "")
+	assert.True(t, ok)
+	assert.Equal(t, client, scopes)
+
+	scopes, ok = requestedScopes(client, "read:routes  write:alerts")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"read:routes", "write:alerts"}, scopes)
+
+	_, ok = requestedScopes(client, "read:routes admin:*")
+	assert.False(t, ok)
+}
+
+func TestBasicCredentials(t *testing.T) {
+	header := "Basic " + base64.StdEncoding.EncodeToString([]byte("client%3A1:cs_live_abc"))
+	id, secret, ok := basicCredentials(header)
+	assert.True(t, ok)
+	assert.Equal(t, "client:1", id)
+	assert.Equal(t, "cs_live_abc", secret)
+
+	_, _, ok = basicCredentials("Bearer pk_live_abc")
+	assert.False(t, ok)
+	_, _, ok = basicCredentials("Basic " + base64.StdEncoding.EncodeToString([]byte("no-colon")))
+	assert.False(t, ok)
+}
@@ -0,0 +1,290 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/middleware"
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/passbi/passbi_core/internal/occupancy"
+	"github.com/passbi/passbi_core/internal/repository"
+)
+
+var (
+	occupancyConfigOnce sync.Once
+	occupancyCfg        occupancy.Config
+)
+
+// occupancyConfig returns the report lifetimes, from OCCUPANCY_*
+func occupancyConfig() occupancy.Config {
+	occupancyConfigOnce.Do(func() {
+		occupancyCfg = occupancy.ConfigFromEnv()
+	})
+	return occupancyCfg
+}
+
+// OccupancyReportsRequest is the batch body of POST /v2/occupancy; a single
+// report may also be posted on its own
+type OccupancyReportsRequest struct {
+	Reports []models.OccupancyReport `json:"reports"`
+}
+
+// PostOccupancy handles POST /v2/occupancy
+// Drivers and riders report how full the vehicle they are on is, one or a
+// batch; a key restricted to agencies may only report on their trips, and
+// agency_id defaults to the key's agency when it has a single one
+// The whole batch is refused when a report is invalid, naming its index
+func PostOccupancy(c *fiber.Ctx) error {
+	var req OccupancyReportsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	if req.Reports == nil {
+		var single models.OccupancyReport
+		if err := c.BodyParser(&single); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid request body"})
+		}
+		req.Reports = []models.OccupancyReport{single}
+	}
+
+	cfg := occupancyConfig()
+	if len(req.Reports) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "reports must not be empty"})
+	}
+	if len(req.Reports) > cfg.MaxBatch {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("at most %d reports per request", cfg.MaxBatch)})
+	}
+
+	agencies := keyAgencies(c)
+	now := time.Now()
+	for i := range req.Reports {
+		r := &req.Reports[i]
+		if r.AgencyID == "" && len(agencies) == 1 {
+			r.AgencyID = agencies[0]
+		}
+		if err := cfg.Normalize(r, now); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("reports[%d]: %s", i, err), "index": i})
+		}
+		if !agencyAllowed(agencies, r.AgencyID) {
+			return c.Status(403).JSON(fiber.Map{"error": fmt.Sprintf("reports[%d]: this API key cannot report on agency %s", i, r.AgencyID), "index": i})
+		}
+	}
+
+	pool, err := db.GetDB()
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Database error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	var partnerID string
+	if partner, ok := c.Locals("partner").(*middleware.PartnerContext); ok {
+		partnerID = partner.PartnerID
+	}
+
+	stored, err := occupancy.Store(c.UserContext(), pool, partnerID, req.Reports)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to store occupancy reports", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	return c.Status(202).JSON(fiber.Map{
+		"received": len(req.Reports),
+		"stored":   stored,
+	})
+}
+
+// TripOccupancy is how full a trip of a route is now
+type TripOccupancy struct {
+	AgencyID string          `json:"agency_id"`
+	TripID   string          `json:"trip_id"`
+	Crowding models.Crowding `json:"crowding"`
+}
+
+// OccupancyBand is how full a route usually is during part of the day
+type OccupancyBand struct {
+	Days    string                `json:"days"` // "weekday" or "weekend"
+	Start   string                `json:"start"`
+	End     string                `json:"end"`
+	Level   models.OccupancyLevel `json:"level"`
+	Reports int                   `json:"reports"`
+}
+
+// RouteOccupancyResponse is the crowding of a route now and through the day
+type RouteOccupancyResponse struct {
+	Route RouteBasic `json:"route"`
+	// Current is the crowding of the route's vehicles from the last reports,
+	// or the typical one at this time when there are none
+	Current   *models.Crowding `json:"current,omitempty"`
+	Trips     []TripOccupancy  `json:"trips"`
+	Typical   []OccupancyBand  `json:"typical" fields:"items"`
+	Timestamp time.Time        `json:"timestamp"`
+}
+
+// RouteOccupancy handles GET /v2/routes/:id/occupancy
+// Lists the trips of the route reported on recently with their crowding, and
+// the route's typical crowding by band of the day
+func RouteOccupancy(c *fiber.Ctx) error {
+	routeID := c.Params("id")
+	if routeID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "route ID is required"})
+	}
+	agencies := keyAgencies(c)
+	ctx := c.UserContext()
+	if routeHidden(ctx, agencies, routeID) {
+		return c.Status(404).JSON(fiber.Map{"error": "route not found"})
+	}
+
+	pool, err := db.ReadDB()
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Database error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+	route, err := repository.GetRoute(ctx, pool, routeID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "route not found"})
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Route query error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	now := time.Now().UTC()
+	cfg := occupancyConfig()
+	trips, err := occupancy.RouteTripCrowding(ctx, pool, cfg, routeID, now)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Occupancy query error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+	routes, err := occupancy.RouteCrowding(ctx, pool, cfg, []string{routeID}, now)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Occupancy query error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	resp := RouteOccupancyResponse{
+		Route:     RouteBasic(*route),
+		Current:   routes[routeID],
+		Trips:     []TripOccupancy{},
+		Typical:   []OccupancyBand{},
+		Timestamp: now,
+	}
+	if resp.Current == nil {
+		resp.Current, _ = occupancy.Current().Typical(routeID, now)
+	}
+	for k, crowding := range trips {
+		if agencyAllowed(agencies, k.AgencyID) {
+			resp.Trips = append(resp.Trips, TripOccupancy{AgencyID: k.AgencyID, TripID: k.TripID, Crowding: *crowding})
+		}
+	}
+	sort.Slice(resp.Trips, func(i, j int) bool { return resp.Trips[i].TripID < resp.Trips[j].TripID })
+	for _, b := range occupancy.Current().Bands(routeID) {
+		days := "weekday"
+		if b.Weekend {
+			days = "weekend"
+		}
+		resp.Typical = append(resp.Typical, OccupancyBand{
+			Days:    days,
+			Start:   formatGTFSTime(b.Start),
+			End:     formatGTFSTime(b.End),
+			Level:   b.Level,
+			Reports: b.Reports,
+		})
+	}
+
+	return sendFields(c, resp)
+}
+
+// applyDepartureCrowding sets the crowding of departures: today, from the
+// last reports on their trip, otherwise how full their route usually is at
+// that time
+// Failures are logged and leave the reported crowding out
+func applyDepartureCrowding(ctx context.Context, q departuresQuery, resp *DeparturesResponse) {
+	for i := range resp.Departures {
+		resp.Departures[i].Crowding = nil
+	}
+	if len(resp.Departures) == 0 {
+		return
+	}
+
+	now := time.Now().UTC()
+	var reported map[occupancy.TripKey]*models.Crowding
+	if q.DateStr == now.Format("2006-01-02") {
+		pool, err := db.ReadDB()
+		if err != nil {
+			logger.WarnContext(ctx, "Skipping trip crowding", "error", err)
+		} else {
+			trips := make([]occupancy.TripKey, len(resp.Departures))
+			for i, d := range resp.Departures {
+				trips[i] = occupancy.TripKey{AgencyID: d.AgencyID, TripID: d.TripID}
+			}
+			reported, err = occupancy.TripCrowding(ctx, pool, occupancyConfig(), trips, now)
+			if err != nil {
+				logger.ErrorContext(ctx, "Trip crowding query error", "error", err)
+			}
+		}
+	}
+
+	model := occupancy.Current()
+	for i := range resp.Departures {
+		d := &resp.Departures[i]
+		if crowding, ok := reported[occupancy.TripKey{AgencyID: d.AgencyID, TripID: d.TripID}]; ok {
+			d.Crowding = crowding
+			continue
+		}
+		at := q.Date.Add(time.Duration(expectedSecs(*d)) * time.Second)
+		d.Crowding, _ = model.Typical(d.RouteID, at)
+	}
+}
+
+// attachCrowding sets the crowding of each ride of the itineraries: for a
+// search leaving now, from the last reports on the route's vehicles, and
+// otherwise how full the route usually is when the ride starts
+// Failures are logged and leave the reported crowding out
+func attachCrowding(ctx context.Context, routes map[string]*RouteResult, leavingNow bool, now time.Time) {
+	var reported map[string]*models.Crowding
+	if leavingNow {
+		var routeIDs []string
+		seen := make(map[string]bool)
+		for _, result := range routes {
+			for _, s := range result.Steps {
+				if s.Type == models.EdgeRide && s.Route != "" && !seen[s.Route] {
+					seen[s.Route] = true
+					routeIDs = append(routeIDs, s.Route)
+				}
+			}
+		}
+		pool, err := db.ReadDB()
+		if err != nil {
+			logger.WarnContext(ctx, "Skipping route crowding", "error", err)
+		} else if reported, err = occupancy.RouteCrowding(ctx, pool, occupancyConfig(), routeIDs, now); err != nil {
+			logger.ErrorContext(ctx, "Route crowding query error", "error", err)
+		}
+	}
+
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	model := occupancy.Current()
+	for _, result := range routes {
+		for i := range result.Steps {
+			s := &result.Steps[i]
+			if s.Type != models.EdgeRide || s.Route == "" {
+				continue
+			}
+			if crowding, ok := reported[s.Route]; ok {
+				s.Crowding = crowding
+				continue
+			}
+			secs, err := parseTimeStr(s.DepartureTime)
+			if err != nil {
+				continue
+			}
+			s.Crowding, _ = model.Typical(s.Route, day.Add(time.Duration(secs)*time.Second))
+		}
+	}
+}
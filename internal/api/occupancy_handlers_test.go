@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/passbi/passbi_core/internal/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func postOccupancy(t *testing.T, agencies []string, body string) (int, map[string]interface{}) {
+	app := fiber.New()
+	app.Post("/v2/occupancy", func(c *fiber.Ctx) error {
+		c.Locals("partner", &middleware.PartnerContext{PartnerID: "p1", Agencies: agencies})
+		return c.Next()
+	}, PostOccupancy)
+
+	req := httptest.NewRequest("POST", "/v2/occupancy", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if !assert.NoError(t, err) {
+		return 0, nil
+	}
+	var out map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+func TestPostOccupancyRejects(t *testing.T) {
+	status, out := postOccupancy(t, nil, `{"reports":[]}`)
+	assert.Equal(t, 400, status)
+	assert.Equal(t, "reports must not be empty", out["error"])
+
+	status, out = postOccupancy(t, nil, `{"reports":[
+		{"agency_id":"a","trip_id":"T1","level":"full"},
+		{"agency_id":"a","trip_id":"T2","level":"packed"}
+	]}`)
+	assert.Equal(t, 400, status)
+	assert.Equal(t, 1.0, out["index"])
+
+	status, out = postOccupancy(t, []string{"a"}, `{"agency_id":"b","route_id":"R1","level":"empty","reporter":"driver"}`)
+	assert.Equal(t, 403, status)
+	assert.Equal(t, 0.0, out["index"])
+}
@@ -1,18 +1,22 @@
 package api
 
 import (
-	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"log"
+	"maps"
+	"net/netip"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/passbi/passbi_core/internal/middleware"
+	"github.com/passbi/passbi_core/internal/notify"
+	"github.com/passbi/passbi_core/internal/repository"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -27,21 +31,34 @@ type Partner struct {
 	RateLimitPerSecond int        `json:"rate_limit_per_second"`
 	RateLimitPerDay    int        `json:"rate_limit_per_day"`
 	RateLimitPerMonth  int        `json:"rate_limit_per_month"`
+	RateLimitBurst     int        `json:"rate_limit_burst"`
 	CreatedAt          time.Time  `json:"created_at"`
 	LastActiveAt       *time.Time `json:"last_active_at,omitempty"`
+	// Role and capabilities of the calling dashboard user
+	Role         string   `json:"role"`
+	Capabilities []string `json:"capabilities"`
 }
 
 // APIKey represents an API key (sanitized for display)
+// For an OAuth client the ID is its client_id
 type APIKey struct {
 	ID          string     `json:"id"`
+	Kind        string     `json:"kind"`
+	Environment string     `json:"environment"` // live or test (sandbox)
 	Name        string     `json:"name"`
 	KeyPrefix   string     `json:"key_prefix"`
 	Description string     `json:"description,omitempty"`
 	Scopes      []string   `json:"scopes"`
+	AllowedIPs  []string   `json:"allowed_ips,omitempty"`
+	Agencies    []string   `json:"allowed_agencies,omitempty"`
+	Signing     string     `json:"signing"` // none, optional or required
 	IsActive    bool       `json:"is_active"`
 	CreatedAt   time.Time  `json:"created_at"`
 	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
 	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	SuspendedAt *time.Time `json:"suspended_at,omitempty"` // refused until an admin reviews its usage
+	// ExpiresInDays counts the days left for keys with an expiry date
+	ExpiresInDays *int `json:"expires_in_days,omitempty"`
 }
 
 // UsageStat represents usage statistics
@@ -60,31 +77,31 @@ func GetPartnerInfo(c *fiber.Ctx) error {
 	partner := c.Locals("partner").(*middleware.PartnerContext)
 	pool := c.Locals("db").(*pgxpool.Pool)
 
-	ctx := context.Background()
-	query := `
-		SELECT
-			id, name, email, COALESCE(company, ''), status, tier,
-			rate_limit_per_second, rate_limit_per_day, rate_limit_per_month,
-			created_at, last_active_at
-		FROM partner
-		WHERE id = $1
-	`
-
-	var p Partner
-	err := pool.QueryRow(ctx, query, partner.PartnerID).Scan(
-		&p.ID, &p.Name, &p.Email, &p.Company, &p.Status, &p.Tier,
-		&p.RateLimitPerSecond, &p.RateLimitPerDay, &p.RateLimitPerMonth,
-		&p.CreatedAt, &p.LastActiveAt,
-	)
-
+	found, err := repository.GetPartner(c.UserContext(), pool, partner.PartnerID)
 	if err != nil {
-		log.Printf("Failed to get partner info: %v", err)
+		logger.ErrorContext(c.Context(), "Failed to get partner info", "error", err)
 		return c.Status(500).JSON(fiber.Map{
 			"error":   "internal_server_error",
 			"message": "Failed to retrieve partner information",
 		})
 	}
 
+	p := Partner{
+		ID:                 found.ID,
+		Name:               found.Name,
+		Email:              found.Email,
+		Company:            found.Company,
+		Status:             found.Status,
+		Tier:               found.Tier,
+		RateLimitPerSecond: found.RateLimitPerSecond,
+		RateLimitPerDay:    found.RateLimitPerDay,
+		RateLimitPerMonth:  found.RateLimitPerMonth,
+		RateLimitBurst:     found.RateLimitBurst,
+		CreatedAt:          found.CreatedAt,
+		LastActiveAt:       found.LastActiveAt,
+		Role:               partner.Role,
+		Capabilities:       middleware.RoleCapabilities[partner.Role],
+	}
 	return c.JSON(p)
 }
 
@@ -93,11 +110,17 @@ func GetAPIKeys(c *fiber.Ctx) error {
 	partner := c.Locals("partner").(*middleware.PartnerContext)
 	pool := c.Locals("db").(*pgxpool.Pool)
 
-	ctx := context.Background()
+	ctx := c.UserContext()
 	query := `
 		SELECT
-			id, name, key_prefix, COALESCE(description, ''), scopes,
-			is_active, created_at, expires_at, last_used_at
+			id, kind, environment, name, key_prefix, COALESCE(description, ''), scopes, allowed_ips,
+			allowed_agencies,
+			CASE
+				WHEN signing_secret IS NULL THEN 'none'
+				WHEN require_signature THEN 'required'
+				ELSE 'optional'
+			END,
+			is_active, created_at, expires_at, last_used_at, suspended_at
 		FROM api_key
 		WHERE partner_id = $1
 		ORDER BY created_at DESC
@@ -105,7 +128,7 @@ func GetAPIKeys(c *fiber.Ctx) error {
 
 	rows, err := pool.Query(ctx, query, partner.PartnerID)
 	if err != nil {
-		log.Printf("Failed to get API keys: %v", err)
+		logger.ErrorContext(c.Context(), "Failed to get API keys", "error", err)
 		return c.Status(500).JSON(fiber.Map{
 			"error":   "internal_server_error",
 			"message": "Failed to retrieve API keys",
@@ -113,17 +136,24 @@ func GetAPIKeys(c *fiber.Ctx) error {
 	}
 	defer rows.Close()
 
+	now := time.Now()
 	var keys []APIKey
 	for rows.Next() {
 		var k APIKey
+		var allowedIPs []netip.Prefix
 		err := rows.Scan(
-			&k.ID, &k.Name, &k.KeyPrefix, &k.Description, &k.Scopes,
-			&k.IsActive, &k.CreatedAt, &k.ExpiresAt, &k.LastUsedAt,
+			&k.ID, &k.Kind, &k.Environment, &k.Name, &k.KeyPrefix, &k.Description, &k.Scopes, &allowedIPs, &k.Agencies, &k.Signing,
+			&k.IsActive, &k.CreatedAt, &k.ExpiresAt, &k.LastUsedAt, &k.SuspendedAt,
 		)
 		if err != nil {
-			log.Printf("Failed to scan API key: %v", err)
+			logger.ErrorContext(c.Context(), "Failed to scan API key", "error", err)
 			continue
 		}
+		k.AllowedIPs = formatPrefixes(allowedIPs)
+		if k.ExpiresAt != nil {
+			days := notify.DaysLeft(*k.ExpiresAt, now)
+			k.ExpiresInDays = &days
+		}
 		keys = append(keys, k)
 	}
 
@@ -132,16 +162,45 @@ func GetAPIKeys(c *fiber.Ctx) error {
 	}
 
 	return c.JSON(fiber.Map{
-		"api_keys": keys,
-		"total":    len(keys),
+		"api_keys":      keys,
+		"total":         len(keys),
+		"expiring_soon": expiringSoon(keys, now),
 	})
 }
 
+// expiringSoon returns the active keys expiring within the first expiry
+// reminder, soonest first
+func expiringSoon(keys []APIKey, now time.Time) []APIKey {
+	horizon := now.AddDate(0, 0, notify.KeyExpiryReminders[0])
+	soon := []APIKey{}
+	for _, k := range keys {
+		if k.IsActive && k.ExpiresAt != nil && k.ExpiresAt.After(now) && !k.ExpiresAt.After(horizon) {
+			soon = append(soon, k)
+		}
+	}
+	sort.Slice(soon, func(i, j int) bool { return soon[i].ExpiresAt.Before(*soon[j].ExpiresAt) })
+	return soon
+}
+
+// API key kinds: a bearer key (pk_...), or the credentials of an OAuth client
+// exchanged for short-lived access tokens at POST /oauth/token
+const (
+	KindAPIKey      = "api_key"
+	KindOAuthClient = "oauth_client"
+)
+
+// secretPrefixes are the prefixes of the secret of each kind of key
+var secretPrefixes = map[string]string{KindAPIKey: "pk", KindOAuthClient: "cs"}
+
 // CreateAPIKeyRequest represents the request body for creating an API key
 type CreateAPIKeyRequest struct {
+	Kind        string     `json:"kind"`        // api_key (default) or oauth_client
+	Environment string     `json:"environment"` // live (default) or test for a sandbox key
 	Name        string     `json:"name"`
 	Description string     `json:"description"`
 	Scopes      []string   `json:"scopes"`
+	AllowedIPs  []string   `json:"allowed_ips"`      // addresses or CIDR ranges, IPv4 or IPv6
+	Agencies    []string   `json:"allowed_agencies"` // agency IDs the key may see; all when empty
 	ExpiresAt   *time.Time `json:"expires_at"`
 }
 
@@ -166,12 +225,64 @@ func CreateAPIKey(c *fiber.Ctx) error {
 		})
 	}
 
+	if req.Kind == "" {
+		req.Kind = KindAPIKey
+	}
+	secretPrefix, ok := secretPrefixes[req.Kind]
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": "kind must be api_key or oauth_client",
+		})
+	}
+
+	if req.Environment == "" {
+		req.Environment = middleware.EnvironmentLive
+	}
+	if req.Environment != middleware.EnvironmentLive && req.Environment != middleware.EnvironmentTest {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": "environment must be live or test",
+		})
+	}
+
 	if len(req.Scopes) == 0 {
-		req.Scopes = []string{"read:routes"} // Default scope
+		req.Scopes = middleware.DefaultScopes
+	}
+	if invalid := middleware.InvalidPartnerScopes(req.Scopes); len(invalid) > 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error":          "validation_error",
+			"message":        fmt.Sprintf("Unknown or restricted scopes: %s", strings.Join(invalid, ", ")),
+			"allowed_scopes": middleware.PartnerScopes,
+		})
+	}
+
+	allowedIPs, err := middleware.ParsePrefixes(req.AllowedIPs)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": fmt.Sprintf("allowed_ips: %v", err),
+		})
+	}
+
+	ctx := c.UserContext()
+
+	agencies, unknown, err := normalizeAgencies(ctx, pool, req.Agencies)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to check agencies", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to create API key",
+		})
+	}
+	if len(unknown) > 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": fmt.Sprintf("allowed_agencies: unknown agencies %s", strings.Join(unknown, ", ")),
+		})
 	}
 
 	// Check if partner has reached their API key limit
-	ctx := context.Background()
 
 	// Get tier config
 	var maxKeys int
@@ -180,7 +291,7 @@ func CreateAPIKey(c *fiber.Ctx) error {
 		FROM tier_config
 		WHERE tier = (SELECT tier FROM partner WHERE id = $1)
 	`
-	err := pool.QueryRow(ctx, tierQuery, partner.PartnerID).Scan(&maxKeys)
+	err = pool.QueryRow(ctx, tierQuery, partner.PartnerID).Scan(&maxKeys)
 	if err == nil && maxKeys > 0 {
 		// Check current count
 		var currentCount int
@@ -196,40 +307,77 @@ func CreateAPIKey(c *fiber.Ctx) error {
 	}
 
 	// Generate a new API key
-	apiKey, keyHash, keyPrefix := generateAPIKey("live")
+	apiKey, keyHash, keyPrefix := generateAPIKey(secretPrefix, req.Environment)
 
 	// Insert into database
 	query := `
 		INSERT INTO api_key (
-			partner_id, key_hash, key_prefix, name, description, scopes, expires_at
+			partner_id, kind, environment, key_hash, key_prefix, name, description, scopes, allowed_ips,
+			allowed_agencies, expires_at
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 		RETURNING id, created_at
 	`
 
 	var keyID string
 	var createdAt time.Time
 	err = pool.QueryRow(ctx, query,
-		partner.PartnerID, keyHash, keyPrefix, req.Name, req.Description, req.Scopes, req.ExpiresAt,
+		partner.PartnerID, req.Kind, req.Environment, keyHash, keyPrefix, req.Name, req.Description, req.Scopes, allowedIPs,
+		agencies, req.ExpiresAt,
 	).Scan(&keyID, &createdAt)
 
 	if err != nil {
-		log.Printf("Failed to create API key: %v", err)
+		logger.ErrorContext(c.Context(), "Failed to create API key", "error", err)
 		return c.Status(500).JSON(fiber.Map{
 			"error":   "internal_server_error",
 			"message": "Failed to create API key",
 		})
 	}
 
-	return c.Status(201).JSON(fiber.Map{
-		"id":         keyID,
-		"api_key":    apiKey, // Show ONLY ONCE
-		"key_prefix": keyPrefix,
-		"name":       req.Name,
-		"scopes":     req.Scopes,
-		"created_at": createdAt,
-		"warning":    "⚠️ Save this key now. You won't be able to see it again!",
-	})
+	if req.Kind == KindOAuthClient {
+		resp := fiber.Map{
+			"id":               keyID,
+			"kind":             req.Kind,
+			"environment":      req.Environment,
+			"client_id":        keyID,
+			"client_secret":    apiKey, // Show ONLY ONCE
+			"key_prefix":       keyPrefix,
+			"name":             req.Name,
+			"scopes":           req.Scopes,
+			"allowed_ips":      formatPrefixes(allowedIPs),
+			"allowed_agencies": agencies,
+			"created_at":       createdAt,
+			"token_url":        "/oauth/token",
+			"warning":          "⚠️ Save this secret now. You won't be able to see it again!",
+		}
+		setSecretlessReplay(c, resp, "client_secret")
+		return c.Status(201).JSON(resp)
+	}
+
+	resp := fiber.Map{
+		"id":               keyID,
+		"kind":             req.Kind,
+		"environment":      req.Environment,
+		"api_key":          apiKey, // Show ONLY ONCE
+		"key_prefix":       keyPrefix,
+		"name":             req.Name,
+		"scopes":           req.Scopes,
+		"allowed_ips":      formatPrefixes(allowedIPs),
+		"allowed_agencies": agencies,
+		"created_at":       createdAt,
+		"warning":          "⚠️ Save this key now. You won't be able to see it again!",
+	}
+	setSecretlessReplay(c, resp, "api_key")
+	return c.Status(201).JSON(resp)
+}
+
+// setSecretlessReplay has an idempotent retry of a create request replay
+// resp without its one-time secret field, which is never kept server-side
+func setSecretlessReplay(c *fiber.Ctx, resp fiber.Map, secretField string) {
+	replay := maps.Clone(resp)
+	delete(replay, secretField)
+	replay["warning"] = "This request was already processed; its secret was only shown in the first response"
+	middleware.SetIdempotentReplay(c, replay)
 }
 
 // RevokeAPIKey revokes (deactivates) an API key
@@ -245,7 +393,7 @@ func RevokeAPIKey(c *fiber.Ctx) error {
 		})
 	}
 
-	ctx := context.Background()
+	ctx := c.UserContext()
 	query := `
 		UPDATE api_key
 		SET is_active = false
@@ -268,6 +416,125 @@ func RevokeAPIKey(c *fiber.Ctx) error {
 	})
 }
 
+// SigningSecretRequest is the body of POST /dashboard/api-keys/:id/signing-secret
+type SigningSecretRequest struct {
+	Required *bool `json:"required"` // reject unsigned requests (default true)
+}
+
+// CreateSigningSecret issues a new HMAC signing secret for an API key,
+// replacing any previous one
+func CreateSigningSecret(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*middleware.PartnerContext)
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	var req SigningSecretRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "invalid_request",
+				"message": "Invalid request body",
+			})
+		}
+	}
+	required := req.Required == nil || *req.Required
+
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		logger.ErrorContext(c.Context(), "Failed to generate signing secret", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to create signing secret",
+		})
+	}
+	secret := "ss_" + hex.EncodeToString(randomBytes)
+
+	ctx := c.UserContext()
+	query := `
+		UPDATE api_key
+		SET signing_secret = $3, require_signature = $4
+		WHERE id = $1 AND partner_id = $2 AND is_active = true
+		RETURNING id
+	`
+
+	var id string
+	err := pool.QueryRow(ctx, query, c.Params("id"), partner.PartnerID, secret, required).Scan(&id)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "not_found",
+			"message": "API key not found or revoked",
+		})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"id":                id,
+		"signing_secret":    secret, // Show ONLY ONCE
+		"require_signature": required,
+		"warning":           "⚠️ Save this secret now. You won't be able to see it again!",
+	})
+}
+
+// UpdateSigningSecret switches whether an API key requires signed requests,
+// keeping its secret
+func UpdateSigningSecret(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*middleware.PartnerContext)
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	var req SigningSecretRequest
+	if err := c.BodyParser(&req); err != nil || req.Required == nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": `Body must be {"required": true|false}`,
+		})
+	}
+
+	ctx := c.UserContext()
+	query := `
+		UPDATE api_key
+		SET require_signature = $3
+		WHERE id = $1 AND partner_id = $2 AND signing_secret IS NOT NULL
+		RETURNING id
+	`
+
+	var id string
+	err := pool.QueryRow(ctx, query, c.Params("id"), partner.PartnerID, *req.Required).Scan(&id)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "not_found",
+			"message": "API key not found or without a signing secret",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"id":                id,
+		"require_signature": *req.Required,
+	})
+}
+
+// DeleteSigningSecret stops signature checks for an API key
+func DeleteSigningSecret(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*middleware.PartnerContext)
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	ctx := c.UserContext()
+	query := `
+		UPDATE api_key
+		SET signing_secret = NULL, require_signature = false
+		WHERE id = $1 AND partner_id = $2
+		RETURNING id
+	`
+
+	var id string
+	err := pool.QueryRow(ctx, query, c.Params("id"), partner.PartnerID).Scan(&id)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "not_found",
+			"message": "API key not found",
+		})
+	}
+
+	return c.SendStatus(204)
+}
+
 // GetUsageStats returns usage statistics for the authenticated partner
 func GetUsageStats(c *fiber.Ctx) error {
 	partner := c.Locals("partner").(*middleware.PartnerContext)
@@ -280,7 +547,7 @@ func GetUsageStats(c *fiber.Ctx) error {
 		days = 30
 	}
 
-	ctx := context.Background()
+	ctx := c.UserContext()
 	query := `
 		SELECT
 			DATE(timestamp) as date,
@@ -298,7 +565,7 @@ func GetUsageStats(c *fiber.Ctx) error {
 
 	rows, err := pool.Query(ctx, query, partner.PartnerID, days)
 	if err != nil {
-		log.Printf("Failed to get usage stats: %v", err)
+		logger.ErrorContext(c.Context(), "Failed to get usage stats", "error", err)
 		return c.Status(500).JSON(fiber.Map{
 			"error":   "internal_server_error",
 			"message": "Failed to retrieve usage statistics",
@@ -312,7 +579,7 @@ func GetUsageStats(c *fiber.Ctx) error {
 		var date time.Time
 		err := rows.Scan(&date, &s.TotalRequests, &s.Successful, &s.Failed, &s.AvgResponseTime, &s.CacheHits)
 		if err != nil {
-			log.Printf("Failed to scan usage stat: %v", err)
+			logger.ErrorContext(c.Context(), "Failed to scan usage stat", "error", err)
 			continue
 		}
 		s.Date = date.Format("2006-01-02")
@@ -342,13 +609,13 @@ func GetQuotaUsage(c *fiber.Ctx) error {
 	pool := c.Locals("db").(*pgxpool.Pool)
 	rdb := c.Locals("redis").(*redis.Client)
 
-	ctx := context.Background()
+	ctx := c.UserContext()
 
 	// Get rate limits
 	rateLimits := c.Locals("rate_limits").(map[string]int)
 
 	// Get current usage from Redis
-	rateLimitStatus := middleware.GetRateLimitStatus(rdb, partner.PartnerID, rateLimits)
+	rateLimitStatus := middleware.GetRateLimitStatus(ctx, rdb, partner, rateLimits)
 
 	// Get daily quota from database
 	today := time.Now().Format("2006-01-02")
@@ -408,8 +675,9 @@ func GetQuotaUsage(c *fiber.Ctx) error {
 	})
 }
 
-// generateAPIKey generates a new API key with hash and prefix
-func generateAPIKey(env string) (key, hash, prefix string) {
+// generateAPIKey generates a new API key (or client secret, by its prefix)
+// with hash and prefix
+func generateAPIKey(kindPrefix, env string) (key, hash, prefix string) {
 	// Generate 32 random bytes
 	randomBytes := make([]byte, 32)
 	rand.Read(randomBytes)
@@ -420,18 +688,34 @@ func generateAPIKey(env string) (key, hash, prefix string) {
 	checksum := hex.EncodeToString(checksumBytes[:2])
 
 	// Construct the key
-	key = fmt.Sprintf("pk_%s_%s_%s", env, randomStr, checksum)
+	key = fmt.Sprintf("%s_%s_%s_%s", kindPrefix, env, randomStr, checksum)
 
 	// Hash for storage
 	hashBytes := sha256.Sum256([]byte(key))
 	hash = hex.EncodeToString(hashBytes[:])
 
 	// Prefix for display (first 12 chars after pk_env_)
-	prefix = fmt.Sprintf("pk_%s_%s...", env, randomStr[:8])
+	prefix = fmt.Sprintf("%s_%s_%s...", kindPrefix, env, randomStr[:8])
 
 	return
 }
 
+// formatPrefixes formats IP ranges, showing single hosts as plain addresses
+func formatPrefixes(prefixes []netip.Prefix) []string {
+	if len(prefixes) == 0 {
+		return nil
+	}
+	formatted := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		if p.IsSingleIP() {
+			formatted[i] = p.Addr().String()
+		} else {
+			formatted[i] = p.String()
+		}
+	}
+	return formatted
+}
+
 func maxInt64(a, b int64) int64 {
 	if a > b {
 		return a
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxProfileSeconds caps CPU profiles and execution traces, which hold the
+// request open for their whole duration
+const maxProfileSeconds = 120
+
+// PprofProfile is one runtime profile listed by GET /admin/debug/pprof
+type PprofProfile struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	Path  string `json:"path"`
+}
+
+// AdminPprofIndex handles GET /admin/debug/pprof
+// Lists the profiles this instance can produce, with their current counts
+func AdminPprofIndex(c *fiber.Ctx) error {
+	profiles := []PprofProfile{}
+	for _, p := range pprof.Profiles() {
+		profiles = append(profiles, PprofProfile{
+			Name:  p.Name(),
+			Count: p.Count(),
+			Path:  "/admin/debug/pprof/" + p.Name(),
+		})
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	return c.JSON(fiber.Map{
+		"profiles":   profiles,
+		"cpu":        "/admin/debug/pprof/profile?seconds=30",
+		"trace":      "/admin/debug/pprof/trace?seconds=1",
+		"goroutines": runtime.NumGoroutine(),
+		"heap_alloc": mem.HeapAlloc,
+		"heap_inuse": mem.HeapInuse,
+		"sys":        mem.Sys,
+		"num_gc":     mem.NumGC,
+	})
+}
+
+// AdminPprofLookup handles GET /admin/debug/pprof/:name
+// Writes a named profile (heap, goroutine, allocs, ...) in the pprof format,
+// or as text with ?debug=1 or 2. ?gc=1 runs a garbage collection before a
+// heap profile so it only shows live objects, such as the in-memory graph
+func AdminPprofLookup(c *fiber.Ctx) error {
+	name := c.Params("name")
+	profile := pprof.Lookup(name)
+	if profile == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "unknown_profile",
+			"message": fmt.Sprintf("No profile named %q; see /admin/debug/pprof", name),
+		})
+	}
+
+	debug := c.QueryInt("debug", 0)
+	if name == "heap" && c.QueryBool("gc", false) {
+		runtime.GC()
+	}
+
+	setProfileHeaders(c, name, debug > 0)
+	if err := profile.WriteTo(c.Response().BodyWriter(), debug); err != nil {
+		logger.ErrorContext(c.Context(), "Failed to write profile", "profile", name, "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "profile_failed",
+			"message": "Failed to write profile",
+		})
+	}
+	return nil
+}
+
+// AdminPprofCPU handles GET /admin/debug/pprof/profile?seconds=30
+// Profiles CPU usage for the given duration; one profile runs at a time
+func AdminPprofCPU(c *fiber.Ctx) error {
+	d, err := profileDuration(c, 30)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_seconds",
+			"message": err.Error(),
+		})
+	}
+
+	setProfileHeaders(c, "profile", false)
+	if err := pprof.StartCPUProfile(c.Response().BodyWriter()); err != nil {
+		return c.Status(409).JSON(fiber.Map{
+			"error":   "profile_in_progress",
+			"message": "A CPU profile is already running on this instance",
+		})
+	}
+	waitProfile(c, d)
+	pprof.StopCPUProfile()
+
+	return nil
+}
+
+// AdminPprofTrace handles GET /admin/debug/pprof/trace?seconds=1
+// Records an execution trace (go tool trace) for the given duration
+func AdminPprofTrace(c *fiber.Ctx) error {
+	d, err := profileDuration(c, 1)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_seconds",
+			"message": err.Error(),
+		})
+	}
+
+	setProfileHeaders(c, "trace", false)
+	if err := trace.Start(c.Response().BodyWriter()); err != nil {
+		return c.Status(409).JSON(fiber.Map{
+			"error":   "trace_in_progress",
+			"message": "An execution trace is already running on this instance",
+		})
+	}
+	waitProfile(c, d)
+	trace.Stop()
+
+	return nil
+}
+
+// profileDuration reads the seconds query parameter
+func profileDuration(c *fiber.Ctx, def int) (time.Duration, error) {
+	seconds := def
+	if s := c.Query("seconds"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxProfileSeconds {
+			return 0, fmt.Errorf("seconds must be between 1 and %d", maxProfileSeconds)
+		}
+		seconds = n
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// waitProfile waits for the profile duration, or until the server shuts down
+func waitProfile(c *fiber.Ctx, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-c.Context().Done():
+	}
+}
+
+func setProfileHeaders(c *fiber.Ctx, name string, text bool) {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set("X-Content-Type-Options", "nosniff")
+	if text {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+		return
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEOctetStream)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, name))
+}
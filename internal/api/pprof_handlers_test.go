@@ -0,0 +1,56 @@
+package api
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPprofTestApp() *fiber.App {
+	app := fiber.New()
+	app.Get("/debug/pprof", AdminPprofIndex)
+	app.Get("/debug/pprof/profile", AdminPprofCPU)
+	app.Get("/debug/pprof/:name", AdminPprofLookup)
+	return app
+}
+
+func TestPprofLookup(t *testing.T) {
+	app := newPprofTestApp()
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/debug/pprof/goroutine?debug=1", nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/plain")
+	assert.Contains(t, string(body), "goroutine profile")
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/debug/pprof/heap?gc=1", nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	body, _ = io.ReadAll(resp.Body)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "application/octet-stream", resp.Header.Get("Content-Type"))
+	assert.NotEmpty(t, body)
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/debug/pprof/nope", nil))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 404, resp.StatusCode)
+	}
+}
+
+func TestPprofCPUSeconds(t *testing.T) {
+	app := newPprofTestApp()
+
+	for _, s := range []string{"0", "abc", "121"} {
+		resp, err := app.Test(httptest.NewRequest("GET", "/debug/pprof/profile?seconds="+s, nil))
+		if assert.NoError(t, err) {
+			assert.Equal(t, 400, resp.StatusCode, s)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/passbi/passbi_core/internal/realtime"
+	"github.com/passbi/passbi_core/internal/repository"
+)
+
+// rideDelay is the predicted delay of the trip expected to serve a ride, at
+// the stops it is boarded and left at
+type rideDelay struct {
+	board  int
+	alight int
+}
+
+// applyRideDelays retimes the steps of an itinerary leaving now, already
+// timed by enrichStepsWithTimes, with the realtime delays of the trips
+// expected to serve its rides: a late trip is boarded later and its delay
+// carries to the following steps
+// It returns the seconds the arrival moved; failures are logged and leave
+// the scheduled times
+func applyRideDelays(ctx context.Context, steps []models.Step, baseTimeSecs int, now time.Time) int {
+	var rides []int
+	for i, s := range steps {
+		if s.Type == models.EdgeRide && s.Route != "" {
+			rides = append(rides, i)
+		}
+	}
+	if len(rides) == 0 {
+		return 0
+	}
+
+	pool, err := db.ReadDB()
+	if err != nil {
+		logger.WarnContext(ctx, "Skipping ride delays", "error", err)
+		return 0
+	}
+	delays, err := rideDelays(ctx, pool, steps, rides, baseTimeSecs, now)
+	if err != nil {
+		logger.ErrorContext(ctx, "Ride delays query error", "error", err)
+		return 0
+	}
+	return shiftSteps(steps, baseTimeSecs, delays)
+}
+
+// shiftSteps retimes steps from baseTimeSecs with the delays of their rides,
+// keyed by step index
+// A ride leaves when both its trip and the passenger are at the stop; when
+// the passenger is later than the trip, the ride is taken on arrival as
+// paths only exist where trips run often
+func shiftSteps(steps []models.Step, baseTimeSecs int, delays map[int]rideDelay) int {
+	if len(delays) == 0 {
+		return 0
+	}
+
+	scheduled, shift := baseTimeSecs, 0
+	for i := range steps {
+		departure := scheduled + shift
+		duration := steps[i].Duration
+		if d, ok := delays[i]; ok {
+			departure = scheduled + max(shift, d.board)
+			duration = max(duration+d.alight-d.board, 0)
+			delay := d.board
+			steps[i].DelaySeconds = &delay
+		}
+		steps[i].DepartureTime = formatSecondsToTime(departure)
+		steps[i].ArrivalTime = formatSecondsToTime(departure + duration)
+		scheduled += steps[i].Duration
+		shift = departure + duration - scheduled
+		steps[i].Duration = duration
+	}
+	return shift
+}
+
+// rideDelays finds, for each ride, the next trip of its route due at the
+// boarding stop at the ride's scheduled time, counting realtime delays, and
+// returns the delays of those trips that have fresh predictions
+func rideDelays(ctx context.Context, pool *pgxpool.Pool, steps []models.Step, rides []int, baseTimeSecs int, now time.Time) (map[int]rideDelay, error) {
+	idx := make([]int, 0, len(rides))
+	routes := make([]string, 0, len(rides))
+	from := make([]string, 0, len(rides))
+	to := make([]string, 0, len(rides))
+	secs := make([]int, 0, len(rides))
+
+	current, next := baseTimeSecs, 0
+	for i, s := range steps {
+		if next < len(rides) && rides[next] == i {
+			idx = append(idx, i)
+			routes = append(routes, s.Route)
+			from = append(from, s.FromStop)
+			to = append(to, s.ToStop)
+			secs = append(secs, current)
+			next++
+		}
+		current += s.Duration
+	}
+
+	rows, err := pool.Query(ctx, `
+		WITH `+repository.ActiveServicesCTE(now, "$1")+`
+		SELECT r.idx, n.board_delay, n.alight_delay
+		FROM unnest($2::int[], $3::text[], $4::text[], $5::text[], $6::int[]) AS r(idx, route_id, from_stop, to_stop, secs)
+		JOIN LATERAL (
+			SELECT COALESCE(bu.departure_delay, bu.arrival_delay) AS board_delay,
+				COALESCE(au.arrival_delay, au.departure_delay, bu.departure_delay, bu.arrival_delay) AS alight_delay
+			FROM stop_time b
+			JOIN trip t ON t.agency_id = b.agency_id AND t.trip_id = b.trip_id
+			JOIN active_services s ON s.service_id = t.service_id AND s.agency_id = t.agency_id
+			JOIN stop_time a ON a.agency_id = b.agency_id AND a.trip_id = b.trip_id
+				AND a.stop_id = r.to_stop AND a.stop_sequence > b.stop_sequence
+			LEFT JOIN stop_time_update bu ON bu.agency_id = b.agency_id AND bu.trip_id = b.trip_id
+				AND bu.service_date = $1::date AND bu.stop_sequence = b.stop_sequence AND bu.updated_at > $7
+			LEFT JOIN stop_time_update au ON au.agency_id = a.agency_id AND au.trip_id = a.trip_id
+				AND au.service_date = $1::date AND au.stop_sequence = a.stop_sequence AND au.updated_at > $7
+			WHERE t.route_id = r.route_id AND b.stop_id = r.from_stop
+			  AND COALESCE(bu.schedule_relationship, 'SCHEDULED') = 'SCHEDULED'
+			  AND COALESCE(b.departure_seconds, b.arrival_seconds)
+				+ COALESCE(bu.departure_delay, bu.arrival_delay, 0) >= r.secs
+			  AND NOT EXISTS (
+				SELECT 1 FROM trip_update tu
+				WHERE tu.agency_id = b.agency_id AND tu.trip_id = b.trip_id AND tu.service_date = $1::date
+				  AND tu.schedule_relationship IN ('CANCELED', 'DELETED') AND tu.updated_at > $7
+			  )
+			ORDER BY COALESCE(b.departure_seconds, b.arrival_seconds)
+				+ COALESCE(bu.departure_delay, bu.arrival_delay, 0), a.stop_sequence
+			LIMIT 1
+		) n ON true
+		WHERE n.board_delay IS NOT NULL
+	`, now, idx, routes, from, to, secs, now.Add(-realtime.MaxAge))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ride delays: %w", err)
+	}
+	defer rows.Close()
+
+	delays := make(map[int]rideDelay)
+	for rows.Next() {
+		var i int
+		var d rideDelay
+		if err := rows.Scan(&i, &d.board, &d.alight); err != nil {
+			return nil, err
+		}
+		delays[i] = d
+	}
+	return delays, rows.Err()
+}
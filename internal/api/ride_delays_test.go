@@ -0,0 +1,43 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShiftSteps(t *testing.T) {
+	base := 8 * 3600
+	steps := func() []models.Step {
+		return []models.Step{
+			{Type: models.EdgeWalk, Duration: 300},
+			{Type: models.EdgeRide, Route: "R1", Duration: 900},
+			{Type: models.EdgeTransfer, Duration: 120},
+			{Type: models.EdgeRide, Route: "R2", Duration: 600},
+		}
+	}
+
+	s := steps()
+	enrichStepsWithTimes(s, base)
+	assert.Equal(t, 0, shiftSteps(s, base, nil))
+	assert.Equal(t, "08:05", s[1].DepartureTime)
+
+	// R1 leaves 4 minutes late and makes up a minute; R2 is 2 minutes late,
+	// less than the passenger is by then
+	s = steps()
+	shift := shiftSteps(s, base, map[int]rideDelay{1: {board: 240, alight: 180}, 3: {board: 120, alight: 120}})
+	assert.Equal(t, 180, shift)
+	assert.Equal(t, "08:09", s[1].DepartureTime)
+	assert.Equal(t, 840, s[1].Duration)
+	assert.Equal(t, 240, *s[1].DelaySeconds)
+	assert.Equal(t, "08:25", s[2].ArrivalTime)
+	assert.Equal(t, "08:25", s[3].DepartureTime)
+	assert.Equal(t, "08:35", s[3].ArrivalTime)
+	assert.Nil(t, s[0].DelaySeconds)
+
+	// An early trip is not boarded before the passenger reaches the stop
+	s = steps()
+	assert.Equal(t, 0, shiftSteps(s, base, map[int]rideDelay{1: {board: -120, alight: -120}}))
+	assert.Equal(t, "08:05", s[1].DepartureTime)
+}
@@ -0,0 +1,315 @@
+package api
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/metrics"
+	"github.com/passbi/passbi_core/internal/routing"
+)
+
+// Why a route search returned no itinerary
+const (
+	gapNoOriginStop      = "no_origin_stop"      // no stop within walking distance of the origin
+	gapNoDestinationStop = "no_destination_stop" // no stop within walking distance of the destination
+	gapNoPath            = "no_path"             // stops on both ends, but not connected
+	gapSearchLimit       = "search_limit"        // the search gave up (MAX_EXPLORED_NODES, ROUTE_TIMEOUT)
+)
+
+// gapCellDegrees is the grid failed searches are snapped to before they are
+// stored (about 550 m at Dakar's latitude): the table keeps the areas people
+// search between, never their exact addresses
+const gapCellDegrees = 0.005
+
+// gapRetention is how long failed searches are kept
+const gapRetention = 365 * 24 * time.Hour
+
+// routeGap is a failed search, anonymized
+type routeGap struct {
+	day              string
+	fromLat, fromLon float64
+	toLat, toLon     float64
+	reason           string
+}
+
+var (
+	// gaps are the failed searches waiting to be written to route_gap
+	gaps        = make(chan routeGap, 1000)
+	gapsDropped atomic.Int64
+	gapsWritten atomic.Int64
+)
+
+func init() {
+	metrics.Register(func(w *metrics.Writer) {
+		w.Counter("passbi_route_gaps_written_total", "Failed route searches written to route_gap", float64(gapsWritten.Load()))
+		w.Counter("passbi_route_gaps_dropped_total", "Failed route searches not recorded because the writer fell behind", float64(gapsDropped.Load()))
+	})
+}
+
+// gapReason tells why no strategy found an itinerary, from the most to the
+// least actionable reason; "" when the failures are not about the network
+// (graph not loaded, ...)
+func gapReason(runs map[string]strategyRun) string {
+	seen := map[string]bool{}
+	for _, run := range runs {
+		seen[routing.OutcomeOf(run.err)] = true
+	}
+	switch {
+	case seen[routing.OutcomeNoStart]:
+		return gapNoOriginStop
+	case seen[routing.OutcomeNoGoal]:
+		return gapNoDestinationStop
+	case seen[routing.OutcomeNoPath]:
+		return gapNoPath
+	case seen[routing.OutcomeNodeLimit], seen[routing.OutcomeTimeout]:
+		return gapSearchLimit
+	}
+	return ""
+}
+
+// gapCell snaps a coordinate to the center of its grid cell
+func gapCell(v float64) float64 {
+	cell := (math.Floor(v/gapCellDegrees) + 0.5) * gapCellDegrees
+	return math.Round(cell*1e6) / 1e6
+}
+
+// recordGap queues a search that returned no itinerary; it never blocks
+func recordGap(fromLat, fromLon, toLat, toLon float64, runs map[string]strategyRun) {
+	reason := gapReason(runs)
+	if reason == "" {
+		return
+	}
+	g := routeGap{
+		day:     time.Now().UTC().Format("2006-01-02"),
+		fromLat: gapCell(fromLat),
+		fromLon: gapCell(fromLon),
+		toLat:   gapCell(toLat),
+		toLon:   gapCell(toLon),
+		reason:  reason,
+	}
+	select {
+	case gaps <- g:
+	default:
+		gapsDropped.Add(1)
+	}
+}
+
+// RunGapWriter writes failed route searches to route_gap until ctx is
+// canceled, and prunes those older than a year
+// Searches are counted per day and pair of cells, so the table holds no
+// individual request
+func RunGapWriter(ctx context.Context, pool *pgxpool.Pool) {
+	flush := time.NewTicker(30 * time.Second)
+	defer flush.Stop()
+	prune := time.NewTicker(24 * time.Hour)
+	defer prune.Stop()
+
+	pending := map[routeGap]int{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case g := <-gaps:
+			pending[g]++
+			continue
+		case <-prune.C:
+			cutoff := time.Now().Add(-gapRetention).Format("2006-01-02")
+			if _, err := pool.Exec(ctx, `DELETE FROM route_gap WHERE day < $1`, cutoff); err != nil {
+				logger.WarnContext(ctx, "Failed to prune route gaps", "error", err)
+			}
+			continue
+		case <-flush.C:
+		}
+
+		if len(pending) == 0 {
+			continue
+		}
+		n, err := writeGaps(ctx, pool, pending)
+		if err != nil {
+			gapsDropped.Add(int64(n))
+			logger.WarnContext(ctx, "Failed to write route gaps", "searches", n, "error", err)
+		} else {
+			gapsWritten.Add(int64(n))
+		}
+		pending = map[routeGap]int{}
+	}
+}
+
+// writeGaps adds pending searches to route_gap; it returns how many
+func writeGaps(ctx context.Context, pool *pgxpool.Pool, pending map[routeGap]int) (int, error) {
+	batch := &pgx.Batch{}
+	total := 0
+	for g, n := range pending {
+		total += n
+		batch.Queue(`
+			INSERT INTO route_gap (day, from_lat, from_lon, to_lat, to_lon, reason, searches)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (day, from_lat, from_lon, to_lat, to_lon, reason) DO UPDATE
+			SET searches = route_gap.searches + EXCLUDED.searches
+		`, g.day, g.fromLat, g.fromLon, g.toLat, g.toLon, g.reason, n)
+	}
+	return total, pool.SendBatch(ctx, batch).Close()
+}
+
+// GapArea is a grid cell where searches start or end without an itinerary
+type GapArea struct {
+	Lat           float64 `json:"lat"`
+	Lon           float64 `json:"lon"`
+	Searches      int64   `json:"searches"`
+	AsOrigin      int64   `json:"as_origin"`
+	AsDestination int64   `json:"as_destination"`
+	NoStopNearby  int64   `json:"no_stop_nearby"` // searches with no stop within walking distance of this cell
+}
+
+// GapPoint is the center of a grid cell
+type GapPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// GapPair is a pair of cells searched between without an itinerary
+type GapPair struct {
+	From     GapPoint         `json:"from"`
+	To       GapPoint         `json:"to"`
+	Searches int64            `json:"searches"`
+	Reasons  map[string]int64 `json:"reasons"`
+}
+
+// GapsResponse is the body of GET /admin/analytics/gaps
+type GapsResponse struct {
+	Since         string           `json:"since"`
+	CellDegrees   float64          `json:"cell_degrees"`
+	MinSearches   int              `json:"min_searches"`
+	TotalSearches int64            `json:"total_searches"`
+	Reasons       map[string]int64 `json:"reasons"`
+	Areas         []GapArea        `json:"areas"`
+	Pairs         []GapPair        `json:"pairs"`
+}
+
+// AdminRouteGaps handles GET /admin/analytics/gaps?days=&min_searches=&limit=
+// It ranks the areas and origin-destination pairs searched most often
+// without an itinerary. Cells searched fewer than min_searches times
+// (default 3) are left out, so a single user's trips are not shown
+func AdminRouteGaps(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	days, _ := strconv.Atoi(c.Query("days", "30"))
+	if days <= 0 || days > 365 {
+		days = 30
+	}
+	minSearches, _ := strconv.Atoi(c.Query("min_searches", "3"))
+	if minSearches < 1 {
+		minSearches = 3
+	}
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -days).Format("2006-01-02")
+	resp := GapsResponse{
+		Since:       since,
+		CellDegrees: gapCellDegrees,
+		MinSearches: minSearches,
+		Reasons:     map[string]int64{},
+		Areas:       []GapArea{},
+		Pairs:       []GapPair{},
+	}
+
+	if err := loadRouteGaps(c.UserContext(), pool, since, minSearches, limit, &resp); err != nil {
+		logger.ErrorContext(c.Context(), "Failed to load route gaps", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to retrieve route gaps",
+		})
+	}
+	return c.JSON(resp)
+}
+
+func loadRouteGaps(ctx context.Context, pool *pgxpool.Pool, since string, minSearches, limit int, resp *GapsResponse) error {
+	rows, err := pool.Query(ctx, `
+		SELECT reason, SUM(searches) FROM route_gap WHERE day >= $1 GROUP BY reason
+	`, since)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var reason string
+		var n int64
+		if err := rows.Scan(&reason, &n); err != nil {
+			rows.Close()
+			return err
+		}
+		resp.Reasons[reason] = n
+		resp.TotalSearches += n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = pool.Query(ctx, `
+		WITH ends AS (
+			SELECT from_lat AS lat, from_lon AS lon, searches AS origin, 0 AS destination,
+				CASE WHEN reason = 'no_origin_stop' THEN searches ELSE 0 END AS no_stop
+			FROM route_gap WHERE day >= $1
+			UNION ALL
+			SELECT to_lat, to_lon, 0, searches,
+				CASE WHEN reason = 'no_destination_stop' THEN searches ELSE 0 END
+			FROM route_gap WHERE day >= $1
+		)
+		SELECT lat, lon, SUM(origin + destination) AS searches, SUM(origin), SUM(destination), SUM(no_stop)
+		FROM ends
+		GROUP BY lat, lon
+		HAVING SUM(origin + destination) >= $2
+		ORDER BY searches DESC, lat, lon
+		LIMIT $3
+	`, since, minSearches, limit)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var a GapArea
+		if err := rows.Scan(&a.Lat, &a.Lon, &a.Searches, &a.AsOrigin, &a.AsDestination, &a.NoStopNearby); err != nil {
+			rows.Close()
+			return err
+		}
+		resp.Areas = append(resp.Areas, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = pool.Query(ctx, `
+		SELECT from_lat, from_lon, to_lat, to_lon, SUM(n) AS searches,
+			jsonb_object_agg(reason, n)
+		FROM (
+			SELECT from_lat, from_lon, to_lat, to_lon, reason, SUM(searches) AS n
+			FROM route_gap WHERE day >= $1
+			GROUP BY from_lat, from_lon, to_lat, to_lon, reason
+		) r
+		GROUP BY from_lat, from_lon, to_lat, to_lon
+		HAVING SUM(n) >= $2
+		ORDER BY searches DESC, from_lat, from_lon, to_lat, to_lon
+		LIMIT $3
+	`, since, minSearches, limit)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p GapPair
+		if err := rows.Scan(&p.From.Lat, &p.From.Lon, &p.To.Lat, &p.To.Lon, &p.Searches, &p.Reasons); err != nil {
+			return err
+		}
+		resp.Pairs = append(resp.Pairs, p)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/passbi/passbi_core/internal/routing"
+	"github.com/stretchr/testify/assert"
+)
+
+// searchError returns the error FindPath gives for an outcome
+func searchError(t *testing.T, outcome string) error {
+	err := &routing.SearchError{Outcome: outcome}
+	assert.Equal(t, outcome, routing.OutcomeOf(err))
+	return err
+}
+
+func TestGapReason(t *testing.T) {
+	assert.Equal(t, gapNoOriginStop, gapReason(map[string]strategyRun{
+		"fast":   {err: searchError(t, routing.OutcomeNoPath)},
+		"simple": {err: searchError(t, routing.OutcomeNoStart)},
+	}))
+	assert.Equal(t, gapNoPath, gapReason(map[string]strategyRun{
+		"fast":   {err: searchError(t, routing.OutcomeNodeLimit)},
+		"simple": {err: searchError(t, routing.OutcomeNoPath)},
+	}))
+	assert.Equal(t, gapSearchLimit, gapReason(map[string]strategyRun{
+		"fast": {err: searchError(t, routing.OutcomeTimeout)},
+	}))
+
+	// Not a gap in the network
+	assert.Equal(t, "", gapReason(map[string]strategyRun{
+		"fast": {err: errors.New("graph not loaded into memory")},
+	}))
+}
+
+func TestGapCell(t *testing.T) {
+	// Nearby points share a cell; the cell center hides where they were
+	assert.Equal(t, 14.6925, gapCell(14.6937))
+	assert.Equal(t, 14.6925, gapCell(14.6901))
+	assert.Equal(t, -17.4425, gapCell(-17.4441))
+	assert.NotEqual(t, gapCell(14.6937), gapCell(14.6951))
+}
+
+func TestRecordGap(t *testing.T) {
+	for len(gaps) > 0 {
+		<-gaps
+	}
+	recordGap(14.6937, -17.4441, 14.7645, -17.3660, map[string]strategyRun{
+		"fast": {err: searchError(t, routing.OutcomeNoGoal)},
+	})
+	recordGap(14.6937, -17.4441, 14.7645, -17.3660, map[string]strategyRun{
+		"fast": {err: errors.New("graph not loaded into memory")},
+	})
+
+	if assert.Len(t, gaps, 1) {
+		g := <-gaps
+		assert.Equal(t, gapNoDestinationStop, g.reason)
+		assert.Equal(t, 14.6925, g.fromLat)
+		assert.Equal(t, 14.7625, g.toLat)
+	}
+}
@@ -0,0 +1,612 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/passbi/passbi_core/internal/cache"
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/repository"
+)
+
+// RouteStop is a stop in a route's canonical sequence
+type RouteStop struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	Lat      float64 `json:"lat"`
+	Lon      float64 `json:"lon"`
+	Sequence int     `json:"sequence"` // 1-based position along the direction
+}
+
+// RouteDirection is the canonical stop sequence of one direction
+// It is the stop pattern run by the most trips; PatternTrips of TotalTrips
+// trips follow it exactly, the others are short turns or variants
+type RouteDirection struct {
+	Direction    int         `json:"direction"`
+	Headsign     string      `json:"headsign"`
+	Stops        []RouteStop `json:"stops"`
+	PatternTrips int         `json:"pattern_trips"`
+	TotalTrips   int         `json:"total_trips"`
+}
+
+// RouteStopsResponse is the response for the route stops endpoint
+type RouteStopsResponse struct {
+	Route      RouteBasic       `json:"route"`
+	Directions []RouteDirection `json:"directions"`
+}
+
+// RouteStops handles GET /v2/routes/:id/stops?direction=0
+// Returns the ordered stops of each direction with coordinates, so clients
+// no longer have to derive them from the schedule
+func RouteStops(c *fiber.Ctx) error {
+	routeID := c.Params("id")
+	if routeID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "route ID is required"})
+	}
+	if routeHidden(c.UserContext(), keyAgencies(c), routeID) {
+		return c.Status(404).JSON(fiber.Map{"error": "route not found"})
+	}
+
+	direction := c.Query("direction", "all")
+	if direction != "all" {
+		if _, err := strconv.Atoi(direction); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid direction (use 0, 1 or all)"})
+		}
+	}
+	lang := requestLang(c)
+
+	// Stop sequences only change when a feed is imported
+	if notModified(c, feedVersion(c.UserContext()), "route:stops", routeID, direction, lang) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	ctx := c.UserContext()
+	cacheKey := cache.RouteStopsKey(routeID, direction)
+
+	var resp RouteStopsResponse
+	if err := cache.GetJSON(ctx, cacheKey, &resp); err != nil {
+		loaded, err := loadRouteStops(ctx, routeID, direction)
+		if errors.Is(err, errRouteNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "route not found"})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		resp = *loaded
+
+		if err := cache.SetJSON(ctx, cacheKey, resp, cache.TTL(cache.ClassRouteStops)); err != nil {
+			logger.WarnContext(c.Context(), "Cache set error", "error", err)
+		}
+	}
+
+	localizeRouteStops(ctx, lang, &resp)
+	return c.JSON(resp)
+}
+
+// loadRouteStops picks the most common stop pattern of each direction
+// Ties go to the longer pattern, so a full run beats an equally common short turn
+func loadRouteStops(ctx context.Context, routeID, direction string) (*RouteStopsResponse, error) {
+	pool, err := db.ReadDB()
+	if err != nil {
+		logger.ErrorContext(ctx, "Database error", "error", err)
+		return nil, err
+	}
+
+	found, err := repository.GetRoute(ctx, pool, routeID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, errRouteNotFound
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Route query error", "error", err)
+		return nil, err
+	}
+	route := RouteBasic(*found)
+
+	var dirFilter *int
+	if direction != "all" {
+		dir, _ := strconv.Atoi(direction)
+		dirFilter = &dir
+	}
+
+	rows, err := pool.Query(ctx, `
+		WITH trip_pattern AS (
+			SELECT t.direction, t.trip_id, t.agency_id, COALESCE(t.headsign, '') AS headsign,
+				string_agg(st.stop_id, '|' ORDER BY st.stop_sequence) AS pattern,
+				COUNT(*) AS stop_count
+			FROM trip t
+			JOIN stop_time st ON st.trip_id = t.trip_id AND st.agency_id = t.agency_id
+			WHERE t.route_id = $1 AND ($2::int IS NULL OR t.direction = $2)
+			GROUP BY t.direction, t.trip_id, t.agency_id, t.headsign
+		),
+		pattern AS (
+			SELECT direction, pattern,
+				COUNT(*) AS trips,
+				MAX(stop_count) AS stop_count,
+				(array_agg(trip_id ORDER BY trip_id))[1] AS trip_id,
+				(array_agg(agency_id ORDER BY trip_id))[1] AS agency_id,
+				mode() WITHIN GROUP (ORDER BY headsign) AS headsign,
+				SUM(COUNT(*)) OVER (PARTITION BY direction) AS total_trips
+			FROM trip_pattern
+			GROUP BY direction, pattern
+		),
+		canonical AS (
+			SELECT DISTINCT ON (direction) direction, trip_id, agency_id, headsign, trips, total_trips
+			FROM pattern
+			ORDER BY direction, trips DESC, stop_count DESC, trip_id
+		)
+		SELECT c.direction, c.headsign, c.trips, c.total_trips::int,
+			s.id, s.name, s.lat, s.lon
+		FROM canonical c
+		JOIN stop_time st ON st.trip_id = c.trip_id AND st.agency_id = c.agency_id
+		JOIN stop s ON s.id = st.stop_id
+		ORDER BY c.direction, st.stop_sequence
+	`, routeID, dirFilter)
+	if err != nil {
+		logger.ErrorContext(ctx, "Route stops query error", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	directions := []RouteDirection{}
+	for rows.Next() {
+		var d RouteDirection
+		var s RouteStop
+		if err := rows.Scan(&d.Direction, &d.Headsign, &d.PatternTrips, &d.TotalTrips,
+			&s.ID, &s.Name, &s.Lat, &s.Lon); err != nil {
+			logger.ErrorContext(ctx, "Route stop scan error", "error", err)
+			return nil, err
+		}
+		directions = appendRouteStop(directions, d, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &RouteStopsResponse{Route: route, Directions: directions}, nil
+}
+
+// appendRouteStop adds the next stop of direction d, rows coming ordered by
+// direction then stop sequence, and numbers it within its direction
+func appendRouteStop(directions []RouteDirection, d RouteDirection, s RouteStop) []RouteDirection {
+	last := len(directions) - 1
+	if last < 0 || directions[last].Direction != d.Direction {
+		directions = append(directions, d)
+		last++
+	}
+	s.Sequence = len(directions[last].Stops) + 1
+	directions[last].Stops = append(directions[last].Stops, s)
+	return directions
+}
+
+// Typical headways are measured over the daytime service, when lines run
+// regularly; early and late trips would stretch the median
+const (
+	headwayWindowStart = 6 * 3600
+	headwayWindowEnd   = 20 * 3600
+)
+
+// StopRouteDirection is one direction of a route calling at a stop
+type StopRouteDirection struct {
+	Direction      int    `json:"direction"`
+	Headsign       string `json:"headsign"`
+	HeadwayMinutes *int   `json:"headway_minutes,omitempty"`
+	FirstDeparture string `json:"first_departure"`
+	LastDeparture  string `json:"last_departure"`
+}
+
+// StopRoute is a route serving a stop
+type StopRoute struct {
+	ID         string               `json:"id" fields:"always"`
+	Name       string               `json:"name"`
+	Mode       string               `json:"mode"`
+	AgencyID   string               `json:"agency_id"`
+	AgencyName string               `json:"agency_name"`
+	Directions []StopRouteDirection `json:"directions"`
+}
+
+// StopRoutesResponse is the response for the stop routes endpoint
+type StopRoutesResponse struct {
+	Stop   StopBasic   `json:"stop"`
+	Routes []StopRoute `json:"routes" fields:"items"`
+	Total  int         `json:"total"`
+}
+
+// StopRoutes handles GET /v2/stops/:id/routes
+// Lists the routes calling at a stop with their directions, headsigns and
+// typical daytime headway (median gap between departures of the route's
+// busiest service at this stop)
+func StopRoutes(c *fiber.Ctx) error {
+	stopID := c.Params("id")
+	if stopID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "stop ID is required"})
+	}
+	lang := requestLang(c)
+
+	agencies := keyAgencies(c)
+	if stopHidden(c.UserContext(), agencies, stopID) {
+		return c.Status(404).JSON(fiber.Map{"error": "stop not found"})
+	}
+
+	if notModified(c, feedVersion(c.UserContext()), "stop:routes", stopID, lang, c.Query("fields")) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	ctx := c.UserContext()
+	cacheKey := cache.StopRoutesKey(stopID)
+
+	var resp StopRoutesResponse
+	if err := cache.GetJSON(ctx, cacheKey, &resp); err != nil {
+		loaded, err := loadStopRoutes(ctx, stopID)
+		if errors.Is(err, errStopNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "stop not found"})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		resp = *loaded
+
+		if err := cache.SetJSON(ctx, cacheKey, resp, cache.TTL(cache.ClassStopRoutes)); err != nil {
+			logger.WarnContext(c.Context(), "Cache set error", "error", err)
+		}
+	}
+
+	// The cached list covers every agency
+	if len(agencies) > 0 {
+		routes := []StopRoute{}
+		for _, r := range resp.Routes {
+			if agencyAllowed(agencies, r.AgencyID) {
+				routes = append(routes, r)
+			}
+		}
+		resp.Routes = routes
+		resp.Total = len(routes)
+	}
+
+	localizeStopRoutes(ctx, lang, &resp)
+	return sendFields(c, resp)
+}
+
+// loadStopRoutes reads the routes and directions calling at a stop
+func loadStopRoutes(ctx context.Context, stopID string) (*StopRoutesResponse, error) {
+	pool, err := db.ReadDB()
+	if err != nil {
+		logger.ErrorContext(ctx, "Database error", "error", err)
+		return nil, err
+	}
+
+	found, err := repository.GetStop(ctx, pool, stopID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, errStopNotFound
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Stop query error", "error", err)
+		return nil, err
+	}
+	stop := StopBasic(*found)
+
+	rows, err := pool.Query(ctx, `
+		WITH dep AS (
+			SELECT t.route_id, t.direction, t.service_id,
+				COALESCE(t.headsign, '') AS headsign, st.departure_seconds AS secs
+			FROM stop_time st
+			JOIN trip t ON st.trip_id = t.trip_id AND st.agency_id = t.agency_id
+			WHERE st.stop_id = $1 AND st.departure_seconds IS NOT NULL
+		),
+		busiest AS (
+			SELECT DISTINCT ON (route_id, direction) route_id, direction, service_id
+			FROM dep
+			GROUP BY route_id, direction, service_id
+			ORDER BY route_id, direction, COUNT(*) DESC, service_id
+		),
+		gap AS (
+			SELECT d.route_id, d.direction,
+				d.secs - LAG(d.secs) OVER (PARTITION BY d.route_id, d.direction ORDER BY d.secs) AS secs
+			FROM dep d
+			JOIN busiest b ON b.route_id = d.route_id AND b.direction = d.direction
+				AND b.service_id = d.service_id
+			WHERE d.secs BETWEEN $2 AND $3
+		),
+		headway AS (
+			SELECT route_id, direction,
+				percentile_cont(0.5) WITHIN GROUP (ORDER BY secs) AS median_secs
+			FROM gap
+			WHERE secs > 0
+			GROUP BY route_id, direction
+		)
+		SELECT r.id, COALESCE(r.short_name, r.long_name, r.id), r.mode, r.agency_id,
+			d.direction, mode() WITHIN GROUP (ORDER BY d.headsign),
+			MIN(d.secs), MAX(d.secs), h.median_secs
+		FROM dep d
+		JOIN route r ON r.id = d.route_id
+		LEFT JOIN headway h ON h.route_id = d.route_id AND h.direction = d.direction
+		GROUP BY r.id, r.short_name, r.long_name, r.mode, r.agency_id, d.direction, h.median_secs
+		ORDER BY r.mode, r.id, d.direction
+	`, stopID, headwayWindowStart, headwayWindowEnd)
+	if err != nil {
+		logger.ErrorContext(ctx, "Stop routes query error", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	routes := []StopRoute{}
+	for rows.Next() {
+		var r StopRoute
+		var d StopRouteDirection
+		var first, last int
+		var medianSecs *float64
+		if err := rows.Scan(&r.ID, &r.Name, &r.Mode, &r.AgencyID,
+			&d.Direction, &d.Headsign, &first, &last, &medianSecs); err != nil {
+			logger.ErrorContext(ctx, "Stop route scan error", "error", err)
+			return nil, err
+		}
+		d.FirstDeparture = formatSecondsToTime(first)
+		d.LastDeparture = formatSecondsToTime(last)
+		d.HeadwayMinutes = headwayMinutes(medianSecs)
+
+		n := len(routes) - 1
+		if n < 0 || routes[n].ID != r.ID {
+			r.AgencyName = agencyDisplayName(r.AgencyID)
+			routes = append(routes, r)
+			n++
+		}
+		routes[n].Directions = append(routes[n].Directions, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &StopRoutesResponse{Stop: stop, Routes: routes, Total: len(routes)}, nil
+}
+
+// headwayMinutes rounds a median gap to whole minutes (at least 1)
+// nil means too few daytime departures to tell
+func headwayMinutes(medianSecs *float64) *int {
+	if medianSecs == nil {
+		return nil
+	}
+	minutes := int(math.Round(*medianSecs / 60))
+	if minutes < 1 {
+		minutes = 1
+	}
+	return &minutes
+}
+
+// dayTypes are the day types of a frequency summary, in display order
+var dayTypes = []string{"weekday", "saturday", "sunday"}
+
+// HourFrequency is the service of one hour of the day
+// Hour follows GTFS time, so trips after midnight have hours 24 and above
+type HourFrequency struct {
+	Hour              int      `json:"hour"`
+	Trips             int      `json:"trips"`
+	AvgHeadwayMinutes *float64 `json:"avg_headway_minutes,omitempty"`
+}
+
+// DayTypeFrequency summarizes one direction of a route on a day type
+type DayTypeFrequency struct {
+	DayType           string          `json:"day_type"`
+	Direction         int             `json:"direction"`
+	Trips             int             `json:"trips"`
+	FirstDeparture    string          `json:"first_departure"`
+	LastDeparture     string          `json:"last_departure"`
+	SpanMinutes       int             `json:"span_minutes"`
+	AvgHeadwayMinutes *float64        `json:"avg_headway_minutes,omitempty"`
+	Hours             []HourFrequency `json:"hours"`
+}
+
+// RouteFrequencyResponse is the response for the route frequency endpoint
+type RouteFrequencyResponse struct {
+	Route    RouteBasic         `json:"route"`
+	DayTypes []DayTypeFrequency `json:"day_types"`
+}
+
+// RouteFrequency handles GET /v2/routes/:id/frequency?direction=0
+// Summarizes how often a route runs, from trip start times at the first stop:
+// span of service and average headway per day type and hour of the day
+func RouteFrequency(c *fiber.Ctx) error {
+	routeID := c.Params("id")
+	if routeID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "route ID is required"})
+	}
+	if routeHidden(c.UserContext(), keyAgencies(c), routeID) {
+		return c.Status(404).JSON(fiber.Map{"error": "route not found"})
+	}
+
+	direction := c.Query("direction", "all")
+	if direction != "all" {
+		if _, err := strconv.Atoi(direction); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid direction (use 0, 1 or all)"})
+		}
+	}
+	lang := requestLang(c)
+
+	if notModified(c, feedVersion(c.UserContext()), "route:frequency", routeID, direction, lang) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	ctx := c.UserContext()
+	cacheKey := cache.RouteFrequencyKey(routeID, direction)
+
+	var resp RouteFrequencyResponse
+	if err := cache.GetJSON(ctx, cacheKey, &resp); err != nil {
+		loaded, err := loadRouteFrequency(ctx, routeID, direction)
+		if errors.Is(err, errRouteNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "route not found"})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		resp = *loaded
+
+		if err := cache.SetJSON(ctx, cacheKey, resp, cache.TTL(cache.ClassRouteFrequency)); err != nil {
+			logger.WarnContext(c.Context(), "Cache set error", "error", err)
+		}
+	}
+
+	names := loadNames(ctx, lang, nil, []string{resp.Route.ID})
+	resp.Route.Name = names.Route(resp.Route.ID, resp.Route.Name)
+	return c.JSON(resp)
+}
+
+// loadRouteFrequency reads trip start times per day type and summarizes them
+// Services are assigned day types from calendar and calendar_date; services
+// with neither run every day. Trips of several services leaving at the same
+// time on a day type (e.g. Mon-Thu and Friday variants) are counted once
+func loadRouteFrequency(ctx context.Context, routeID, direction string) (*RouteFrequencyResponse, error) {
+	pool, err := db.ReadDB()
+	if err != nil {
+		logger.ErrorContext(ctx, "Database error", "error", err)
+		return nil, err
+	}
+
+	found, err := repository.GetRoute(ctx, pool, routeID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, errRouteNotFound
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Route query error", "error", err)
+		return nil, err
+	}
+	route := RouteBasic(*found)
+
+	var dirFilter *int
+	if direction != "all" {
+		dir, _ := strconv.Atoi(direction)
+		dirFilter = &dir
+	}
+
+	rows, err := pool.Query(ctx, `
+		WITH trip_start AS (
+			SELECT t.agency_id, t.service_id, t.direction, MIN(st.departure_seconds) AS secs
+			FROM trip t
+			JOIN stop_time st ON st.trip_id = t.trip_id AND st.agency_id = t.agency_id
+			WHERE t.route_id = $1 AND ($2::int IS NULL OR t.direction = $2)
+			GROUP BY t.agency_id, t.trip_id, t.service_id, t.direction
+			HAVING MIN(st.departure_seconds) IS NOT NULL
+		),
+		service_day AS (
+			SELECT agency_id, service_id, 'weekday' AS day_type FROM calendar
+			WHERE monday OR tuesday OR wednesday OR thursday OR friday
+			UNION
+			SELECT agency_id, service_id, 'saturday' FROM calendar WHERE saturday
+			UNION
+			SELECT agency_id, service_id, 'sunday' FROM calendar WHERE sunday
+			UNION
+			SELECT agency_id, service_id,
+				CASE EXTRACT(ISODOW FROM date) WHEN 6 THEN 'saturday' WHEN 7 THEN 'sunday' ELSE 'weekday' END
+			FROM calendar_date WHERE exception_type = 1
+		)
+		SELECT sd.day_type, ts.direction, ts.secs
+		FROM trip_start ts
+		JOIN service_day sd ON sd.agency_id = ts.agency_id AND sd.service_id = ts.service_id
+		UNION
+		SELECT d.day_type, ts.direction, ts.secs
+		FROM trip_start ts
+		CROSS JOIN unnest($3::text[]) AS d(day_type)
+		WHERE NOT EXISTS (
+			SELECT 1 FROM service_day sd
+			WHERE sd.agency_id = ts.agency_id AND sd.service_id = ts.service_id
+		)
+		ORDER BY 2, 1, 3
+	`, routeID, dirFilter, dayTypes)
+	if err != nil {
+		logger.ErrorContext(ctx, "Route frequency query error", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	type key struct {
+		dayType   string
+		direction int
+	}
+	starts := map[key][]int{}
+	var directions []int
+	for rows.Next() {
+		var k key
+		var secs int
+		if err := rows.Scan(&k.dayType, &k.direction, &secs); err != nil {
+			logger.ErrorContext(ctx, "Route frequency scan error", "error", err)
+			return nil, err
+		}
+		if len(directions) == 0 || directions[len(directions)-1] != k.direction {
+			directions = append(directions, k.direction)
+		}
+		starts[k] = append(starts[k], secs)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	resp := &RouteFrequencyResponse{Route: route, DayTypes: []DayTypeFrequency{}}
+	for _, dir := range directions {
+		for _, dayType := range dayTypes {
+			if secs := starts[key{dayType, dir}]; len(secs) > 0 {
+				f := summarizeFrequency(secs)
+				f.DayType = dayType
+				f.Direction = dir
+				resp.DayTypes = append(resp.DayTypes, f)
+			}
+		}
+	}
+
+	return resp, nil
+}
+
+// summarizeFrequency computes span and headways from sorted departure times
+// An hour's headway averages the gaps ending in that hour, so the first
+// departure of the day has none
+func summarizeFrequency(secs []int) DayTypeFrequency {
+	first, last := secs[0], secs[len(secs)-1]
+	f := DayTypeFrequency{
+		Trips:          len(secs),
+		FirstDeparture: formatSecondsToTime(first),
+		LastDeparture:  formatSecondsToTime(last),
+		SpanMinutes:    (last - first) / 60,
+		Hours:          []HourFrequency{},
+	}
+	if len(secs) > 1 {
+		f.AvgHeadwayMinutes = roundedMinutes(float64(last-first) / float64(len(secs)-1))
+	}
+
+	for i, s := range secs {
+		hour := s / 3600
+		n := len(f.Hours) - 1
+		if n < 0 || f.Hours[n].Hour != hour {
+			f.Hours = append(f.Hours, HourFrequency{Hour: hour})
+			n++
+		}
+		f.Hours[n].Trips++
+
+		if i > 0 {
+			// Accumulate gap sums in seconds, averaged below
+			gap := float64(s - secs[i-1])
+			if f.Hours[n].AvgHeadwayMinutes == nil {
+				f.Hours[n].AvgHeadwayMinutes = new(float64)
+			}
+			*f.Hours[n].AvgHeadwayMinutes += gap
+		}
+	}
+
+	for i := range f.Hours {
+		h := &f.Hours[i]
+		if h.AvgHeadwayMinutes == nil {
+			continue
+		}
+		gaps := h.Trips
+		if h.Hour == first/3600 {
+			gaps-- // the first departure closes no gap
+		}
+		h.AvgHeadwayMinutes = roundedMinutes(*h.AvgHeadwayMinutes / float64(gaps))
+	}
+
+	return f
+}
+
+// roundedMinutes converts seconds to minutes with one decimal
+func roundedMinutes(secs float64) *float64 {
+	minutes := math.Round(secs/6) / 10
+	return &minutes
+}
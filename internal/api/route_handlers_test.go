@@ -0,0 +1,81 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeadwayMinutes(t *testing.T) {
+	secs := func(v float64) *float64 { return &v }
+
+	assert.Nil(t, headwayMinutes(nil))
+	assert.Equal(t, 12, *headwayMinutes(secs(720)))
+	assert.Equal(t, 8, *headwayMinutes(secs(450)))
+	assert.Equal(t, 1, *headwayMinutes(secs(20)))
+}
+
+func TestSummarizeFrequency(t *testing.T) {
+	// 06:00, 06:20, 06:40, 07:00, 07:30 and 24:10 (after midnight)
+	f := summarizeFrequency([]int{21600, 22800, 24000, 25200, 27000, 87000})
+
+	assert.Equal(t, 6, f.Trips)
+	assert.Equal(t, "06:00", f.FirstDeparture)
+	assert.Equal(t, "00:10", f.LastDeparture)
+	assert.Equal(t, 1090, f.SpanMinutes)
+	assert.Equal(t, 218.0, *f.AvgHeadwayMinutes)
+
+	if !assert.Len(t, f.Hours, 3) {
+		return
+	}
+	assert.Equal(t, HourFrequency{Hour: 6, Trips: 3, AvgHeadwayMinutes: f.Hours[0].AvgHeadwayMinutes}, f.Hours[0])
+	assert.Equal(t, 20.0, *f.Hours[0].AvgHeadwayMinutes)
+	assert.Equal(t, 7, f.Hours[1].Hour)
+	assert.Equal(t, 25.0, *f.Hours[1].AvgHeadwayMinutes)
+	assert.Equal(t, 24, f.Hours[2].Hour)
+	assert.Equal(t, 1000.0, *f.Hours[2].AvgHeadwayMinutes)
+
+	single := summarizeFrequency([]int{30000})
+	assert.Equal(t, 1, single.Trips)
+	assert.Nil(t, single.AvgHeadwayMinutes)
+	assert.Nil(t, single.Hours[0].AvgHeadwayMinutes)
+}
+
+func TestAppendRouteStop(t *testing.T) {
+	out := RouteDirection{Direction: 0, Headsign: "Grand Yoff", PatternTrips: 40, TotalTrips: 52}
+	back := RouteDirection{Direction: 1, Headsign: "Petersen", PatternTrips: 38, TotalTrips: 50}
+
+	var directions []RouteDirection
+	directions = appendRouteStop(directions, out, RouteStop{ID: "S1"})
+	directions = appendRouteStop(directions, out, RouteStop{ID: "S2"})
+	directions = appendRouteStop(directions, out, RouteStop{ID: "S3"})
+	directions = appendRouteStop(directions, back, RouteStop{ID: "S3"})
+	directions = appendRouteStop(directions, back, RouteStop{ID: "S1"})
+
+	if !assert.Len(t, directions, 2) {
+		return
+	}
+	assert.Equal(t, "Grand Yoff", directions[0].Headsign)
+	assert.Equal(t, 40, directions[0].PatternTrips)
+	assert.Equal(t, []RouteStop{{ID: "S1", Sequence: 1}, {ID: "S2", Sequence: 2}, {ID: "S3", Sequence: 3}}, directions[0].Stops)
+
+	// Sequences restart with each direction
+	assert.Equal(t, 1, directions[1].Direction)
+	assert.Equal(t, []RouteStop{{ID: "S3", Sequence: 1}, {ID: "S1", Sequence: 2}}, directions[1].Stops)
+}
+
+func TestRouteStopsInvalidDirection(t *testing.T) {
+	app := fiber.New()
+	app.Get("/v2/routes/:id/stops", RouteStops)
+
+	// Rejected before the database is reached
+	for _, direction := range []string{"north", "1.5"} {
+		resp, err := app.Test(httptest.NewRequest("GET", "/v2/routes/DDD_7/stops?direction="+direction, nil))
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, 400, resp.StatusCode, direction)
+	}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Schedule response formats accepted by ?format=
+const (
+	formatJSON = "json"
+	formatCSV  = "csv"
+)
+
+// utf8BOM makes spreadsheet software read accented stop names correctly
+const utf8BOM = "\ufeff"
+
+// sendSchedule writes a timetable in the requested format
+func sendSchedule(c *fiber.Ctx, format string, resp *ScheduleResponse) error {
+	if format != formatCSV {
+		return c.JSON(resp)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(utf8BOM)
+	if err := writeScheduleCSV(&buf, resp); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="schedule-%s.csv"`, fileSafe(resp.Route.ID)))
+	return c.Send(buf.Bytes())
+}
+
+// writeScheduleCSV lays a timetable out the way printed schedules read:
+// one row per stop and one column per trip, headed by its headsign
+// Trip times are positional, as in the JSON timetable
+func writeScheduleCSV(w io.Writer, resp *ScheduleResponse) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{"sequence", "stop_id", "stop_name"}
+	for _, t := range resp.Trips {
+		label := t.Headsign
+		if label == "" {
+			label = t.TripID
+		}
+		header = append(header, label)
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for i, s := range resp.Stops {
+		row := []string{fmt.Sprint(s.Sequence), s.ID, s.Name}
+		for _, t := range resp.Trips {
+			cell := ""
+			if i < len(t.Times) {
+				cell = clockTime(t.Times[i])
+			}
+			row = append(row, cell)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// clockTime trims seconds from GTFS times (07:05:00 -> 07:05)
+func clockTime(t string) string {
+	if strings.Count(t, ":") == 2 {
+		return t[:strings.LastIndex(t, ":")]
+	}
+	return t
+}
+
+// fileSafe keeps route IDs usable as download file names
+func fileSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteScheduleCSV(t *testing.T) {
+	resp := &ScheduleResponse{
+		Route: RouteBasic{ID: "DDD_7", Name: "7"},
+		Stops: []ScheduleStop{
+			{ID: "S1", Name: "Gare Routière, Colobane", Sequence: 1},
+			{ID: "S2", Name: "Petersen", Sequence: 2},
+		},
+		Trips: []ScheduleTrip{
+			{TripID: "T1", Headsign: "Petersen", Times: []string{"06:00:00", "06:12:00"}},
+			{TripID: "T2", Times: []string{"25:10:00"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeScheduleCSV(&buf, resp))
+	assert.Equal(t, "sequence,stop_id,stop_name,Petersen,T2\n"+
+		"1,S1,\"Gare Routière, Colobane\",06:00,25:10\n"+
+		"2,S2,Petersen,06:12,\n", buf.String())
+}
+
+func TestFileSafe(t *testing.T) {
+	assert.Equal(t, "DDD_7", fileSafe("DDD_7"))
+	assert.Equal(t, "a_b_c", fileSafe(`a"b/c`))
+}
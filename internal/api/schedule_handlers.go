@@ -1,8 +1,10 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -10,6 +12,10 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/passbi/passbi_core/internal/cache"
 	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/eta"
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/passbi/passbi_core/internal/realtime"
+	"github.com/passbi/passbi_core/internal/repository"
 )
 
 // --- Response types ---
@@ -26,20 +32,61 @@ type DepartureInfo struct {
 	DepartureTime string `json:"departure_time"`
 	DepartureSecs int    `json:"departure_seconds"`
 	MinutesUntil  int    `json:"minutes_until"`
-	TripID        string `json:"trip_id"`
+	TripID        string `json:"trip_id" fields:"always"`
+	StopSequence  int    `json:"stop_sequence"`
 	ServiceID     string `json:"service_id"`
 	ServiceActive bool   `json:"service_active"`
+	Realtime      bool   `json:"realtime"`
+	DelaySeconds  *int   `json:"delay_seconds,omitempty"`
+	PredictedTime string `json:"predicted_time,omitempty"`
+	PredictedSecs *int   `json:"predicted_seconds,omitempty"`
+	// PredictionSource is "trip_update" for predictions from a realtime feed,
+	// "gps" for a delay detected from the trip's GPS vehicle and decayed
+	// downstream, "learned" for those from the trip's GPS vehicle and learned
+	// segment times
+	PredictionSource string `json:"prediction_source,omitempty"`
+	// Crowding is how full the trip was last reported, or how full the
+	// route usually is at that time
+	Crowding *models.Crowding `json:"crowding,omitempty"`
 }
 
+// Sources of a departure prediction
+const (
+	PredictionTripUpdate = "trip_update"
+	PredictionGPS        = "gps"
+	PredictionLearned    = "learned"
+)
+
 // DeparturesResponse is the response for the departures endpoint
 type DeparturesResponse struct {
 	Stop        StopBasic       `json:"stop"`
-	Departures  []DepartureInfo `json:"departures"`
+	Departures  []DepartureInfo `json:"departures" fields:"items"`
 	CurrentTime string          `json:"current_time"`
 	Date        string          `json:"date"`
 	Total       int             `json:"total"`
 }
 
+// DepartureGroup is the next departures of one route and direction
+type DepartureGroup struct {
+	RouteID    string          `json:"route_id" fields:"always"`
+	RouteName  string          `json:"route_name"`
+	Mode       string          `json:"mode"`
+	AgencyID   string          `json:"agency_id"`
+	AgencyName string          `json:"agency_name"`
+	Headsign   string          `json:"headsign"`
+	Direction  int             `json:"direction" fields:"always"`
+	Departures []DepartureInfo `json:"departures"`
+}
+
+// GroupedDeparturesResponse is the departures response with grouped=true
+type GroupedDeparturesResponse struct {
+	Stop        StopBasic        `json:"stop"`
+	Groups      []DepartureGroup `json:"groups" fields:"items"`
+	CurrentTime string           `json:"current_time"`
+	Date        string           `json:"date"`
+	Total       int              `json:"total"`
+}
+
 // StopBasic represents minimal stop info
 type StopBasic struct {
 	ID   string  `json:"id"`
@@ -49,9 +96,11 @@ type StopBasic struct {
 }
 
 // ScheduleService represents a service pattern for a route
+// DayLabels are the localized names of Days and are never cached
 type ScheduleService struct {
 	ServiceID string   `json:"service_id"`
 	Days      []string `json:"days"`
+	DayLabels []string `json:"day_labels,omitempty"`
 	StartDate string   `json:"start_date,omitempty"`
 	EndDate   string   `json:"end_date,omitempty"`
 }
@@ -64,12 +113,16 @@ type ScheduleStop struct {
 }
 
 // ScheduleTrip represents a trip row in the timetable
+// Realtime fields reflect today's TripUpdates and are never cached
 type ScheduleTrip struct {
-	TripID    string   `json:"trip_id"`
-	ServiceID string   `json:"service_id"`
-	Headsign  string   `json:"headsign"`
-	Direction int      `json:"direction"`
-	Times     []string `json:"times"`
+	TripID       string   `json:"trip_id"`
+	ServiceID    string   `json:"service_id"`
+	Headsign     string   `json:"headsign"`
+	Direction    int      `json:"direction"`
+	Times        []string `json:"times"`
+	Realtime     bool     `json:"realtime"`
+	DelaySeconds *int     `json:"delay_seconds,omitempty"`
+	Canceled     bool     `json:"canceled,omitempty"`
 }
 
 // ScheduleResponse is the response for the schedule endpoint
@@ -91,7 +144,7 @@ type RouteBasic struct {
 
 // TripDetail represents a trip with its stop times
 type TripDetail struct {
-	TripID    string         `json:"trip_id"`
+	TripID    string         `json:"trip_id" fields:"always"`
 	ServiceID string         `json:"service_id"`
 	Headsign  string         `json:"headsign"`
 	Direction int            `json:"direction"`
@@ -110,7 +163,7 @@ type TripStopTime struct {
 // TripsResponse is the response for the trips endpoint
 type TripsResponse struct {
 	Route  RouteBasic   `json:"route"`
-	Trips  []TripDetail `json:"trips"`
+	Trips  []TripDetail `json:"trips" fields:"items"`
 	Total  int          `json:"total"`
 	Limit  int          `json:"limit"`
 	Offset int          `json:"offset"`
@@ -125,115 +178,202 @@ func StopDepartures(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "stop ID is required"})
 	}
 
+	q, err := parseDeparturesQuery(c.Query("date"), c.Query("time"), c.Query("limit", "10"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	lang := requestLang(c)
+
+	// Grouping needs enough departures to fill every route's next times
+	grouped := c.QueryBool("grouped")
+	if grouped {
+		q.Limit = groupedDeparturesFetch
+	}
+
+	q.Agencies = keyAgencies(c)
+	resp, err := getDepartures(c.UserContext(), stopID, q)
+	if errors.Is(err, errStopNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "stop not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	localizeDepartures(c.UserContext(), lang, resp)
+
+	if grouped {
+		groups := groupDepartures(resp.Departures, groupedDeparturesPerRoute)
+		return sendFields(c, GroupedDeparturesResponse{
+			Stop:        resp.Stop,
+			Groups:      groups,
+			CurrentTime: resp.CurrentTime,
+			Date:        resp.Date,
+			Total:       len(groups),
+		})
+	}
+	return sendFields(c, resp)
+}
+
+// Grouped departures list the next few departures of each route/direction
+const (
+	groupedDeparturesPerRoute = 3
+	groupedDeparturesFetch    = 200
+)
+
+// groupDepartures splits departures by route and direction, keeping the
+// first per of each; groups are ordered by their next departure
+func groupDepartures(departures []DepartureInfo, per int) []DepartureGroup {
+	groups := []DepartureGroup{}
+	index := map[string]int{}
+	for _, d := range departures {
+		key := d.RouteID + "\x00" + strconv.Itoa(d.Direction)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, DepartureGroup{
+				RouteID:    d.RouteID,
+				RouteName:  d.RouteName,
+				Mode:       d.Mode,
+				AgencyID:   d.AgencyID,
+				AgencyName: d.AgencyName,
+				Headsign:   d.Headsign,
+				Direction:  d.Direction,
+			})
+		}
+		if len(groups[i].Departures) < per {
+			groups[i].Departures = append(groups[i].Departures, d)
+		}
+	}
+	return groups
+}
+
+// departuresQuery holds the parsed parameters of a departures lookup
+type departuresQuery struct {
+	Date     time.Time
+	DateStr  string
+	TimeSecs int
+	TimeStr  string
+	Limit    int
+	Agencies []string // the calling key's restriction
+}
+
+// errStopNotFound is returned by getDepartures for unknown stop IDs
+var errStopNotFound = errors.New("stop not found")
+
+// parseDeparturesQuery parses date (YYYY-MM-DD), time (HH:MM) and limit,
+// defaulting to now and 10 departures
+func parseDeparturesQuery(dateStr, timeStr, limitStr string) (departuresQuery, error) {
 	// Dakar timezone = UTC+0
 	now := time.Now().UTC()
+	q := departuresQuery{DateStr: dateStr, TimeStr: timeStr}
 
 	// Parse time parameter (default: current time)
-	timeStr := c.Query("time")
-	var timeSecs int
 	if timeStr != "" {
 		parsed, err := parseTimeStr(timeStr)
 		if err != nil {
-			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("invalid time format (use HH:MM): %v", err)})
+			return q, fmt.Errorf("invalid time format (use HH:MM): %v", err)
 		}
-		timeSecs = parsed
+		q.TimeSecs = parsed
 	} else {
-		timeSecs = now.Hour()*3600 + now.Minute()*60 + now.Second()
-		timeStr = now.Format("15:04:05")
+		q.TimeSecs = now.Hour()*3600 + now.Minute()*60 + now.Second()
+		q.TimeStr = now.Format("15:04:05")
 	}
 
 	// Parse date parameter (default: today)
-	dateStr := c.Query("date")
-	var date time.Time
 	if dateStr != "" {
 		parsed, err := time.Parse("2006-01-02", dateStr)
 		if err != nil {
-			return c.Status(400).JSON(fiber.Map{"error": "invalid date format (use YYYY-MM-DD)"})
+			return q, fmt.Errorf("invalid date format (use YYYY-MM-DD)")
 		}
-		date = parsed
+		q.Date = parsed
 	} else {
-		date = now
-		dateStr = now.Format("2006-01-02")
+		q.Date = now
+		q.DateStr = now.Format("2006-01-02")
 	}
 
 	// Parse limit
-	limit, _ := strconv.Atoi(c.Query("limit", "10"))
-	if limit <= 0 || limit > 50 {
-		limit = 10
+	q.Limit, _ = strconv.Atoi(limitStr)
+	if q.Limit <= 0 || q.Limit > 50 {
+		q.Limit = 10
+	}
+
+	return q, nil
+}
+
+// getDepartures returns upcoming departures at a stop, shared by the JSON and SIRI endpoints
+// Realtime predictions are overlaid on the cached schedule on every call
+// Keys restricted to some agencies only see their departures, and stops
+// none of those agencies serve are not found
+func getDepartures(ctx context.Context, stopID string, q departuresQuery) (*DeparturesResponse, error) {
+	if stopHidden(ctx, q.Agencies, stopID) {
+		return nil, errStopNotFound
 	}
 
+	// Other agencies' departures are dropped, so read ahead to fill the limit
+	scheduled := q
+	if len(q.Agencies) > 0 && scheduled.Limit < groupedDeparturesFetch {
+		scheduled.Limit = groupedDeparturesFetch
+	}
+	resp, err := scheduledDepartures(ctx, stopID, scheduled)
+	if err != nil {
+		return nil, err
+	}
+	if len(q.Agencies) > 0 {
+		resp.Departures = agencyDepartures(resp.Departures, q.Agencies, q.Limit)
+		resp.Total = len(resp.Departures)
+	}
+
+	applyDepartureUpdates(ctx, q, resp)
+	applyDepartureCrowding(ctx, q, resp)
+	return resp, nil
+}
+
+// agencyDepartures keeps the first limit departures of the given agencies
+func agencyDepartures(departures []DepartureInfo, agencies []string, limit int) []DepartureInfo {
+	kept := []DepartureInfo{}
+	for _, d := range departures {
+		if len(kept) == limit {
+			break
+		}
+		if agencyAllowed(agencies, d.AgencyID) {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
+// scheduledDepartures returns the schedule-only departures at a stop
+func scheduledDepartures(ctx context.Context, stopID string, q departuresQuery) (*DeparturesResponse, error) {
 	// Check cache
-	cacheKey := cache.DeparturesKey(stopID, dateStr, timeSecs)
+	cacheKey := cache.DeparturesKey(stopID, q.DateStr, q.TimeSecs, q.Limit)
 	var cachedResp DeparturesResponse
-	if err := cache.GetJSON(c.Context(), cacheKey, &cachedResp); err == nil {
-		return c.JSON(cachedResp)
+	if err := cache.GetJSON(ctx, cacheKey, &cachedResp); err == nil {
+		return &cachedResp, nil
 	}
 
 	// Get DB
-	pool, err := db.GetDB()
+	pool, err := db.ReadDB()
 	if err != nil {
-		log.Printf("Database error: %v", err)
-		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		logger.ErrorContext(ctx, "Database error", "error", err)
+		return nil, err
 	}
 
-	ctx := c.Context()
-
 	// Get stop info
-	var stop StopBasic
-	err = pool.QueryRow(ctx, `SELECT id, name, lat, lon FROM stop WHERE id = $1`, stopID).
-		Scan(&stop.ID, &stop.Name, &stop.Lat, &stop.Lon)
+	found, err := repository.GetStop(ctx, pool, stopID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, errStopNotFound
+	}
 	if err != nil {
-		return c.Status(404).JSON(fiber.Map{"error": "stop not found"})
+		logger.ErrorContext(ctx, "Stop query error", "error", err)
+		return nil, err
 	}
+	stop := StopBasic(*found)
 
 	// Query departures with active service detection
-	// Map Go's Weekday() to the calendar column name
-	dayColumns := [7]string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
-	dayCol := dayColumns[date.Weekday()]
-
-	query := fmt.Sprintf(`
-		WITH active_services AS (
-			-- Tier 1: Valid calendars (date within range + day-of-week match)
-			SELECT DISTINCT c.service_id, c.agency_id
-			FROM calendar c
-			WHERE $2::date BETWEEN c.start_date AND c.end_date
-			  AND c.%s = true
-			  AND NOT EXISTS (
-				SELECT 1 FROM calendar_date cd
-				WHERE cd.service_id = c.service_id
-				  AND cd.agency_id = c.agency_id
-				  AND cd.date = $2::date
-				  AND cd.exception_type = 2
-			  )
-
-			UNION
-
-			-- Tier 2: Expired calendars - match day-of-week only (stale GTFS feeds still running)
-			SELECT DISTINCT c.service_id, c.agency_id
-			FROM calendar c
-			WHERE c.end_date < $2::date
-			  AND c.%s = true
-
-			UNION
-
-			-- Tier 3: calendar_date additions for today
-			SELECT cd.service_id, cd.agency_id
-			FROM calendar_date cd
-			WHERE cd.date = $2::date
-			  AND cd.exception_type = 1
-
-			UNION
-
-			-- Tier 4: Agencies with NO calendar (BRT) - derive DOW from calendar_dates pattern
-			SELECT DISTINCT cd.service_id, cd.agency_id
-			FROM calendar_date cd
-			WHERE cd.exception_type = 1
-			  AND EXTRACT(DOW FROM cd.date) = EXTRACT(DOW FROM $2::date)
-			  AND NOT EXISTS (
-				SELECT 1 FROM calendar c
-				WHERE c.service_id = cd.service_id AND c.agency_id = cd.agency_id
-			  )
-		)
+	query := `
+		WITH ` + repository.ActiveServicesCTE(q.Date, "$2") + `
 		SELECT
 			st.departure_time,
 			st.departure_seconds,
@@ -245,7 +385,8 @@ func StopDepartures(c *fiber.Ctx) error {
 			COALESCE(r.short_name, r.long_name, r.id) AS route_name,
 			r.mode,
 			r.agency_id,
-			CASE WHEN a.service_id IS NOT NULL THEN true ELSE false END AS service_active
+			CASE WHEN a.service_id IS NOT NULL THEN true ELSE false END AS service_active,
+			st.stop_sequence
 		FROM stop_time st
 		JOIN trip t ON st.trip_id = t.trip_id AND st.agency_id = t.agency_id
 		JOIN route r ON t.route_id = r.id
@@ -257,12 +398,12 @@ func StopDepartures(c *fiber.Ctx) error {
 			CASE WHEN a.service_id IS NOT NULL THEN 0 ELSE 1 END,
 			st.departure_seconds
 		LIMIT $4
-	`, dayCol, dayCol)
+	`
 
-	rows, err := pool.Query(ctx, query, stopID, date, timeSecs, limit)
+	rows, err := pool.Query(ctx, query, stopID, q.Date, q.TimeSecs, q.Limit)
 	if err != nil {
-		log.Printf("Departures query error: %v", err)
-		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		logger.ErrorContext(ctx, "Departures query error", "error", err)
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -273,16 +414,13 @@ func StopDepartures(c *fiber.Ctx) error {
 			&d.DepartureTime, &d.DepartureSecs,
 			&d.TripID, &d.ServiceID, &d.Headsign, &d.Direction,
 			&d.RouteID, &d.RouteName, &d.Mode, &d.AgencyID,
-			&d.ServiceActive,
+			&d.ServiceActive, &d.StopSequence,
 		); err != nil {
-			log.Printf("Scan error: %v", err)
+			logger.ErrorContext(ctx, "Scan error", "error", err)
 			continue
 		}
 		d.AgencyName = agencyDisplayName(d.AgencyID)
-		d.MinutesUntil = (d.DepartureSecs - timeSecs) / 60
-		if d.MinutesUntil < 0 {
-			d.MinutesUntil = 0
-		}
+		d.MinutesUntil = minutesUntil(d.DepartureSecs, q.TimeSecs)
 		departures = append(departures, d)
 	}
 
@@ -293,53 +431,72 @@ func StopDepartures(c *fiber.Ctx) error {
 	resp := DeparturesResponse{
 		Stop:        stop,
 		Departures:  departures,
-		CurrentTime: timeStr,
-		Date:        dateStr,
+		CurrentTime: q.TimeStr,
+		Date:        q.DateStr,
 		Total:       len(departures),
 	}
 
-	// Cache for 60 seconds
-	if err := cache.SetJSON(c.Context(), cacheKey, resp, 60*time.Second); err != nil {
-		log.Printf("Cache set error: %v", err)
+	// Cache for CACHE_TTL_DEPARTURES (default 60 seconds)
+	if err := cache.SetJSON(ctx, cacheKey, resp, cache.TTL(cache.ClassDepartures)); err != nil {
+		logger.WarnContext(ctx, "Cache set error", "error", err)
 	}
 
-	return c.JSON(resp)
+	return &resp, nil
 }
 
 // RouteSchedule handles GET /v2/routes/:id/schedule
+// format=csv exports the timetable for spreadsheets and printing
 func RouteSchedule(c *fiber.Ctx) error {
 	routeID := c.Params("id")
 	if routeID == "" {
 		return c.Status(400).JSON(fiber.Map{"error": "route ID is required"})
 	}
+	if routeHidden(c.UserContext(), keyAgencies(c), routeID) {
+		return c.Status(404).JSON(fiber.Map{"error": "route not found"})
+	}
 
 	direction := c.Query("direction", "all")
 	serviceFilter := c.Query("service", "")
+	lang := requestLang(c)
 
-	// Check cache
+	format := c.Query("format", formatJSON)
+	if format != formatJSON && format != formatCSV {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid format (use json or csv)"})
+	}
+
+	// The timetable changes with imports, its realtime overlay with trip updates
 	cacheKey := cache.ScheduleKey(routeID, direction, serviceFilter)
+	if version, rt := feedVersion(c.UserContext()), realtimeVersion(c.UserContext()); rt != "" &&
+		notModified(c, version, rt, lang, format, cacheKey) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	// Check cache
 	var cachedResp ScheduleResponse
-	if err := cache.GetJSON(c.Context(), cacheKey, &cachedResp); err == nil {
-		return c.JSON(cachedResp)
+	if err := cache.GetJSON(c.UserContext(), cacheKey, &cachedResp); err == nil {
+		applyTripUpdates(c.UserContext(), &cachedResp)
+		localizeSchedule(c.UserContext(), lang, &cachedResp)
+		return sendSchedule(c, format, &cachedResp)
 	}
 
-	pool, err := db.GetDB()
+	pool, err := db.ReadDB()
 	if err != nil {
-		log.Printf("Database error: %v", err)
+		logger.ErrorContext(c.Context(), "Database error", "error", err)
 		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
 	}
 
-	ctx := c.Context()
+	ctx := c.UserContext()
 
 	// Get route info
-	var route RouteBasic
-	err = pool.QueryRow(ctx, `
-		SELECT id, COALESCE(short_name, long_name, id), mode, agency_id
-		FROM route WHERE id = $1
-	`, routeID).Scan(&route.ID, &route.Name, &route.Mode, &route.AgencyID)
-	if err != nil {
+	found, err := repository.GetRoute(ctx, pool, routeID)
+	if errors.Is(err, repository.ErrNotFound) {
 		return c.Status(404).JSON(fiber.Map{"error": "route not found"})
 	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Route query error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+	route := RouteBasic(*found)
 
 	// Get services for this route
 	serviceRows, err := pool.Query(ctx, `
@@ -352,7 +509,7 @@ func RouteSchedule(c *fiber.Ctx) error {
 		ORDER BY t.service_id
 	`, routeID)
 	if err != nil {
-		log.Printf("Services query error: %v", err)
+		logger.ErrorContext(c.Context(), "Services query error", "error", err)
 		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
 	}
 	defer serviceRows.Close()
@@ -366,7 +523,7 @@ func RouteSchedule(c *fiber.Ctx) error {
 		if err := serviceRows.Scan(&svc.ServiceID,
 			&mon, &tue, &wed, &thu, &fri, &sat, &sun,
 			&startDate, &endDate); err != nil {
-			log.Printf("Service scan error: %v", err)
+			logger.ErrorContext(c.Context(), "Service scan error", "error", err)
 			continue
 		}
 
@@ -406,134 +563,268 @@ func RouteSchedule(c *fiber.Ctx) error {
 		services = []ScheduleService{}
 	}
 
-	// Get stop sequence from a representative trip
-	stopQuery := `
-		SELECT DISTINCT ON (st.stop_sequence) st.stop_id, s.name, st.stop_sequence
-		FROM stop_time st
-		JOIN trip t ON st.trip_id = t.trip_id AND st.agency_id = t.agency_id
-		JOIN stop s ON s.id = st.stop_id
-		WHERE t.route_id = $1
-	`
-	stopArgs := []interface{}{routeID}
-	argIdx := 1
-
+	filter := repository.TripFilter{RouteID: routeID, ServiceID: serviceFilter}
 	if direction != "all" {
-		argIdx++
-		stopQuery += fmt.Sprintf(" AND t.direction = $%d", argIdx)
 		dir, _ := strconv.Atoi(direction)
-		stopArgs = append(stopArgs, dir)
-	}
-	if serviceFilter != "" {
-		argIdx++
-		stopQuery += fmt.Sprintf(" AND t.service_id = $%d", argIdx)
-		stopArgs = append(stopArgs, serviceFilter)
+		filter.Direction = &dir
 	}
 
-	stopQuery += " ORDER BY st.stop_sequence LIMIT 100"
+	// Get stop sequence from a representative trip
+	sequence, err := repository.RouteStopSequence(ctx, pool, filter)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Stops query error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+	stops := make([]ScheduleStop, len(sequence))
+	for i, s := range sequence {
+		stops[i] = ScheduleStop(s)
+	}
 
-	stopRows, err := pool.Query(ctx, stopQuery, stopArgs...)
+	// Get trips ordered by first departure time
+	scheduled, err := repository.TripsByDeparture(ctx, pool, filter, 50)
 	if err != nil {
-		log.Printf("Stops query error: %v", err)
+		logger.ErrorContext(c.Context(), "Trips query error", "error", err)
 		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
 	}
-	defer stopRows.Close()
 
-	var stops []ScheduleStop
-	for stopRows.Next() {
-		var s ScheduleStop
-		if err := stopRows.Scan(&s.ID, &s.Name, &s.Sequence); err != nil {
-			log.Printf("Stop scan error: %v", err)
+	trips := []ScheduleTrip{}
+	for _, trip := range scheduled {
+		// Get departure times at each stop for this trip
+		stopTimes, err := repository.TripStopTimes(ctx, pool, trip.AgencyID, trip.TripID)
+		if err != nil {
+			logger.ErrorContext(c.Context(), "Trip times query error", "error", err)
 			continue
 		}
-		stops = append(stops, s)
+
+		times := make([]string, len(stopTimes))
+		for i, st := range stopTimes {
+			times[i] = st.DepartureTime
+		}
+		trips = append(trips, ScheduleTrip{
+			TripID:    trip.TripID,
+			ServiceID: trip.ServiceID,
+			Headsign:  trip.Headsign,
+			Direction: trip.Direction,
+			Times:     times,
+		})
 	}
-	if stops == nil {
-		stops = []ScheduleStop{}
+
+	resp := ScheduleResponse{
+		Route:    route,
+		Services: services,
+		Stops:    stops,
+		Trips:    trips,
+		Total:    len(trips),
 	}
 
-	// Get trips with first departure time for ordering
-	tripQuery := `
-		SELECT t.trip_id, t.service_id, COALESCE(t.headsign, ''), t.direction,
-			(SELECT st2.departure_time FROM stop_time st2
-			 WHERE st2.trip_id = t.trip_id AND st2.agency_id = t.agency_id
-			 ORDER BY st2.stop_sequence LIMIT 1) AS first_dep
-		FROM trip t
-		WHERE t.route_id = $1
-	`
-	tripArgs := []interface{}{routeID}
-	tripArgIdx := 1
+	// Cache for CACHE_TTL_SCHEDULE (default 1 hour)
+	if err := cache.SetJSON(c.UserContext(), cacheKey, resp, cache.TTL(cache.ClassSchedule)); err != nil {
+		logger.WarnContext(c.Context(), "Cache set error", "error", err)
+	}
 
-	if direction != "all" {
-		tripArgIdx++
-		tripQuery += fmt.Sprintf(" AND t.direction = $%d", tripArgIdx)
-		dir, _ := strconv.Atoi(direction)
-		tripArgs = append(tripArgs, dir)
+	applyTripUpdates(ctx, &resp)
+	localizeSchedule(ctx, lang, &resp)
+	return sendSchedule(c, format, &resp)
+}
+
+// applyTripUpdates overlays today's realtime trip state on a timetable
+// Failures are logged and leave the schedule-only response untouched
+func applyTripUpdates(ctx context.Context, resp *ScheduleResponse) {
+	if len(resp.Trips) == 0 {
+		return
 	}
-	if serviceFilter != "" {
-		tripArgIdx++
-		tripQuery += fmt.Sprintf(" AND t.service_id = $%d", tripArgIdx)
-		tripArgs = append(tripArgs, serviceFilter)
+
+	pool, err := db.ReadDB()
+	if err != nil {
+		logger.WarnContext(ctx, "Skipping trip updates", "error", err)
+		return
 	}
 
-	tripQuery += " ORDER BY first_dep LIMIT 50"
+	tripIDs := make([]string, 0, len(resp.Trips))
+	for _, t := range resp.Trips {
+		tripIDs = append(tripIDs, t.TripID)
+	}
 
-	tripRows, err := pool.Query(ctx, tripQuery, tripArgs...)
+	statuses, err := realtime.TripStatuses(ctx, pool, resp.Route.AgencyID, tripIDs, time.Now().UTC())
 	if err != nil {
-		log.Printf("Trips query error: %v", err)
-		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		logger.ErrorContext(ctx, "Trip updates query error", "error", err)
+		return
 	}
-	defer tripRows.Close()
 
-	var trips []ScheduleTrip
-	for tripRows.Next() {
-		var t ScheduleTrip
-		var firstDep *string
-		if err := tripRows.Scan(&t.TripID, &t.ServiceID, &t.Headsign, &t.Direction, &firstDep); err != nil {
-			log.Printf("Trip scan error: %v", err)
-			continue
+	for i := range resp.Trips {
+		if s, ok := statuses[resp.Trips[i].TripID]; ok {
+			resp.Trips[i].Realtime = true
+			resp.Trips[i].DelaySeconds = s.Delay
+			resp.Trips[i].Canceled = s.Canceled
 		}
+	}
+}
 
-		// Get departure times at each stop for this trip
-		timeRows, err := pool.Query(ctx, `
-			SELECT COALESCE(departure_time, '') FROM stop_time
-			WHERE trip_id = $1 AND agency_id = (SELECT agency_id FROM trip WHERE trip_id = $1 LIMIT 1)
-			ORDER BY stop_sequence
-		`, t.TripID)
+// applyDepartureUpdates overlays realtime predictions on scheduled departures
+// Failures are logged and leave the schedule-only response untouched
+func applyDepartureUpdates(ctx context.Context, q departuresQuery, resp *DeparturesResponse) {
+	if len(resp.Departures) == 0 {
+		return
+	}
+
+	pool, err := db.ReadDB()
+	if err != nil {
+		logger.WarnContext(ctx, "Skipping trip updates", "error", err)
+		return
+	}
+
+	predictions, err := realtime.StopPredictions(ctx, pool, resp.Stop.ID, q.Date)
+	if err != nil {
+		logger.ErrorContext(ctx, "Stop time updates query error", "error", err)
+		return
+	}
+
+	// Trip statuses are stored per agency; a stop is usually served by one or two
+	tripsByAgency := make(map[string][]string)
+	for _, d := range resp.Departures {
+		tripsByAgency[d.AgencyID] = append(tripsByAgency[d.AgencyID], d.TripID)
+	}
+	canceled := make(map[realtime.Call]bool)
+	for agencyID, tripIDs := range tripsByAgency {
+		statuses, err := realtime.TripStatuses(ctx, pool, agencyID, tripIDs, q.Date)
+		if err != nil {
+			logger.ErrorContext(ctx, "Trip updates query error", "error", err)
+			return
+		}
+		for tripID, s := range statuses {
+			if s.Canceled {
+				canceled[realtime.Call{AgencyID: agencyID, TripID: tripID}] = true
+			}
+		}
+	}
+
+	resp.Departures = mergeDepartures(resp.Departures, q.TimeSecs, predictions, canceled)
+
+	// Vehicles pushing GPS fixes are only where they are today
+	now := time.Now().UTC()
+	if q.DateStr == now.Format("2006-01-02") {
+		calls := make([]realtime.Call, 0, len(resp.Departures))
+		for _, d := range resp.Departures {
+			if d.PredictedSecs == nil || d.PredictionSource == PredictionGPS {
+				calls = append(calls, realtime.Call{AgencyID: d.AgencyID, TripID: d.TripID, Sequence: d.StopSequence})
+			}
+		}
+		learned, err := eta.Current().PredictCalls(ctx, pool, calls, q.Date, now)
 		if err != nil {
-			log.Printf("Trip times query error: %v", err)
+			logger.ErrorContext(ctx, "Learned predictions error", "error", err)
+		} else {
+			resp.Departures = mergeLearned(resp.Departures, q.TimeSecs, learned)
+		}
+	}
+	resp.Total = len(resp.Departures)
+}
+
+// mergeLearned applies learned predictions to the departures a realtime
+// feed did not predict; a detected delay gives way only to a prediction
+// that used learned segment times, as one from the schedule alone does not
+// let the vehicle recover
+func mergeLearned(departures []DepartureInfo, nowSecs int, learned map[realtime.Call]eta.Prediction) []DepartureInfo {
+	if len(learned) == 0 {
+		return departures
+	}
+	for i := range departures {
+		d := &departures[i]
+		if d.PredictedSecs != nil && d.PredictionSource != PredictionGPS {
+			continue
+		}
+		p, ok := learned[realtime.Call{AgencyID: d.AgencyID, TripID: d.TripID, Sequence: d.StopSequence}]
+		if !ok || (d.PredictedSecs != nil && !p.Learned) {
+			continue
+		}
+		predicted := p.DepartureSecs
+		delay := predicted - d.DepartureSecs
+		d.Realtime = true
+		d.DelaySeconds = &delay
+		d.PredictedSecs = &predicted
+		d.PredictedTime = formatGTFSTime(predicted)
+		d.PredictionSource = PredictionLearned
+		d.MinutesUntil = minutesUntil(predicted, nowSecs)
+	}
+	sortDepartures(departures)
+	return departures
+}
+
+// mergeDepartures applies predictions to departures, keeping the scheduled
+// departure_time and departure_seconds so clients can show both
+// Canceled trips (keyed without a sequence) and skipped stops are dropped,
+// and minutes_until follows the predicted time
+func mergeDepartures(departures []DepartureInfo, nowSecs int, predictions map[realtime.Call]realtime.StopPrediction, canceled map[realtime.Call]bool) []DepartureInfo {
+	merged := departures[:0]
+	for _, d := range departures {
+		if canceled[realtime.Call{AgencyID: d.AgencyID, TripID: d.TripID}] {
 			continue
 		}
 
-		var times []string
-		for timeRows.Next() {
-			var tm string
-			if err := timeRows.Scan(&tm); err == nil {
-				times = append(times, tm)
+		d.Realtime, d.DelaySeconds = false, nil
+		d.PredictedTime, d.PredictedSecs, d.PredictionSource = "", nil, ""
+
+		p, ok := predictions[realtime.Call{AgencyID: d.AgencyID, TripID: d.TripID, Sequence: d.StopSequence}]
+		if ok && p.Skipped {
+			continue
+		}
+		delay := p.DepartureDelay
+		if delay == nil {
+			delay = p.ArrivalDelay
+		}
+		if delay != nil {
+			predicted := d.DepartureSecs + *delay
+			d.Realtime = true
+			d.DelaySeconds = delay
+			d.PredictedSecs = &predicted
+			d.PredictedTime = formatGTFSTime(predicted)
+			d.PredictionSource = PredictionTripUpdate
+			if p.Source == realtime.SourceGPS {
+				d.PredictionSource = PredictionGPS
 			}
 		}
-		timeRows.Close()
+		d.MinutesUntil = minutesUntil(expectedSecs(d), nowSecs)
 
-		t.Times = times
-		trips = append(trips, t)
-	}
-	if trips == nil {
-		trips = []ScheduleTrip{}
+		merged = append(merged, d)
 	}
 
-	resp := ScheduleResponse{
-		Route:    route,
-		Services: services,
-		Stops:    stops,
-		Trips:    trips,
-		Total:    len(trips),
+	sortDepartures(merged)
+	return merged
+}
+
+// sortDepartures orders departures by expected time, since delays can
+// reorder them; inactive services stay last
+func sortDepartures(departures []DepartureInfo) {
+	sort.SliceStable(departures, func(i, j int) bool {
+		if departures[i].ServiceActive != departures[j].ServiceActive {
+			return departures[i].ServiceActive
+		}
+		return expectedSecs(departures[i]) < expectedSecs(departures[j])
+	})
+}
+
+// expectedSecs is the predicted departure when known, else the scheduled one
+func expectedSecs(d DepartureInfo) int {
+	if d.PredictedSecs != nil {
+		return *d.PredictedSecs
 	}
+	return d.DepartureSecs
+}
 
-	// Cache for 1 hour
-	if err := cache.SetJSON(c.Context(), cacheKey, resp, time.Hour); err != nil {
-		log.Printf("Cache set error: %v", err)
+// minutesUntil counts whole minutes from now to a departure, never negative
+func minutesUntil(departureSecs, nowSecs int) int {
+	if departureSecs <= nowSecs {
+		return 0
 	}
+	return (departureSecs - nowSecs) / 60
+}
 
-	return c.JSON(resp)
+// formatGTFSTime formats seconds since midnight as GTFS HH:MM:SS
+// Hours may exceed 23 for trips running past midnight
+func formatGTFSTime(secs int) string {
+	if secs < 0 {
+		secs = 0
+	}
+	return fmt.Sprintf("%02d:%02d:%02d", secs/3600, secs%3600/60, secs%60)
 }
 
 // RouteTrips handles GET /v2/routes/:id/trips
@@ -542,9 +833,10 @@ func RouteTrips(c *fiber.Ctx) error {
 	if routeID == "" {
 		return c.Status(400).JSON(fiber.Map{"error": "route ID is required"})
 	}
+	if routeHidden(c.UserContext(), keyAgencies(c), routeID) {
+		return c.Status(404).JSON(fiber.Map{"error": "route not found"})
+	}
 
-	serviceFilter := c.Query("service", "")
-	directionFilter := c.Query("direction", "")
 	limit, _ := strconv.Atoi(c.Query("limit", "20"))
 	offset, _ := strconv.Atoi(c.Query("offset", "0"))
 
@@ -555,129 +847,104 @@ func RouteTrips(c *fiber.Ctx) error {
 		offset = 0
 	}
 
-	pool, err := db.GetDB()
+	resp, err := listTrips(c.UserContext(), routeID, tripsQuery{
+		Service:   c.Query("service", ""),
+		Direction: c.Query("direction", ""),
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if errors.Is(err, errRouteNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "route not found"})
+	}
 	if err != nil {
-		log.Printf("Database error: %v", err)
 		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
 	}
 
-	ctx := c.Context()
-
-	// Get route info
-	var route RouteBasic
-	err = pool.QueryRow(ctx, `
-		SELECT id, COALESCE(short_name, long_name, id), mode, agency_id
-		FROM route WHERE id = $1
-	`, routeID).Scan(&route.ID, &route.Name, &route.Mode, &route.AgencyID)
-	if err != nil {
-		return c.Status(404).JSON(fiber.Map{"error": "route not found"})
-	}
+	localizeTrips(c.UserContext(), requestLang(c), &resp.Route, resp.Trips)
 
-	// Count total trips
-	countQuery := `SELECT COUNT(*) FROM trip WHERE route_id = $1`
-	countArgs := []interface{}{routeID}
-	countArgIdx := 1
+	return sendFields(c, resp)
+}
 
-	if serviceFilter != "" {
-		countArgIdx++
-		countQuery += fmt.Sprintf(" AND service_id = $%d", countArgIdx)
-		countArgs = append(countArgs, serviceFilter)
-	}
-	if directionFilter != "" {
-		countArgIdx++
-		countQuery += fmt.Sprintf(" AND direction = $%d", countArgIdx)
-		dir, _ := strconv.Atoi(directionFilter)
-		countArgs = append(countArgs, dir)
-	}
+// tripsQuery holds the filters and page of a trips listing
+// After pages by trip ID and may be combined with Offset
+type tripsQuery struct {
+	Service   string
+	Direction string
+	After     string
+	Limit     int
+	Offset    int
+}
 
-	var total int
-	pool.QueryRow(ctx, countQuery, countArgs...).Scan(&total)
+// errRouteNotFound is returned by listTrips for unknown route IDs
+var errRouteNotFound = errors.New("route not found")
 
-	// Get trips
-	tripQuery := `
-		SELECT trip_id, agency_id, service_id, COALESCE(headsign, ''), direction
-		FROM trip WHERE route_id = $1
-	`
-	tripArgs := []interface{}{routeID}
-	tripArgIdx := 1
+// listTrips returns a page of a route's trips, ordered by trip ID, with their stop times
+func listTrips(ctx context.Context, routeID string, q tripsQuery) (*TripsResponse, error) {
+	pool, err := db.ReadDB()
+	if err != nil {
+		logger.ErrorContext(ctx, "Database error", "error", err)
+		return nil, err
+	}
 
-	if serviceFilter != "" {
-		tripArgIdx++
-		tripQuery += fmt.Sprintf(" AND service_id = $%d", tripArgIdx)
-		tripArgs = append(tripArgs, serviceFilter)
+	// Get route info
+	found, err := repository.GetRoute(ctx, pool, routeID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, errRouteNotFound
 	}
-	if directionFilter != "" {
-		tripArgIdx++
-		tripQuery += fmt.Sprintf(" AND direction = $%d", tripArgIdx)
-		dir, _ := strconv.Atoi(directionFilter)
-		tripArgs = append(tripArgs, dir)
+	if err != nil {
+		logger.ErrorContext(ctx, "Route query error", "error", err)
+		return nil, err
 	}
 
-	tripArgIdx++
-	tripQuery += fmt.Sprintf(" ORDER BY trip_id LIMIT $%d", tripArgIdx)
-	tripArgs = append(tripArgs, limit)
-
-	tripArgIdx++
-	tripQuery += fmt.Sprintf(" OFFSET $%d", tripArgIdx)
-	tripArgs = append(tripArgs, offset)
+	filter := repository.TripFilter{RouteID: routeID, ServiceID: q.Service}
+	if q.Direction != "" {
+		dir, _ := strconv.Atoi(q.Direction)
+		filter.Direction = &dir
+	}
 
-	tripRows, err := pool.Query(ctx, tripQuery, tripArgs...)
+	// Count total trips
+	total, err := repository.CountTrips(ctx, pool, filter)
 	if err != nil {
-		log.Printf("Trips query error: %v", err)
-		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		logger.ErrorContext(ctx, "Trips count error", "error", err)
+		return nil, err
 	}
-	defer tripRows.Close()
 
-	var trips []TripDetail
-	for tripRows.Next() {
-		var t TripDetail
-		var agencyID string
-		if err := tripRows.Scan(&t.TripID, &agencyID, &t.ServiceID, &t.Headsign, &t.Direction); err != nil {
-			log.Printf("Trip scan error: %v", err)
-			continue
-		}
+	// Get trips
+	page, err := repository.ListTrips(ctx, pool, filter, repository.Page{After: q.After, Limit: q.Limit, Offset: q.Offset})
+	if err != nil {
+		logger.ErrorContext(ctx, "Trips query error", "error", err)
+		return nil, err
+	}
 
+	trips := []TripDetail{}
+	for _, trip := range page {
 		// Get stop times for this trip
-		stRows, err := pool.Query(ctx, `
-			SELECT st.stop_id, s.name, st.stop_sequence,
-				COALESCE(st.arrival_time, ''), COALESCE(st.departure_time, '')
-			FROM stop_time st
-			JOIN stop s ON s.id = st.stop_id
-			WHERE st.trip_id = $1 AND st.agency_id = $2
-			ORDER BY st.stop_sequence
-		`, t.TripID, agencyID)
+		stopTimes, err := repository.TripStopTimes(ctx, pool, trip.AgencyID, trip.TripID)
 		if err != nil {
-			log.Printf("Stop times query error: %v", err)
+			logger.ErrorContext(ctx, "Stop times query error", "error", err)
 			continue
 		}
 
-		var stops []TripStopTime
-		for stRows.Next() {
-			var s TripStopTime
-			if err := stRows.Scan(&s.StopID, &s.StopName, &s.Sequence, &s.ArrivalTime, &s.DepartureTime); err == nil {
-				stops = append(stops, s)
-			}
-		}
-		stRows.Close()
-
-		if stops == nil {
-			stops = []TripStopTime{}
+		stops := make([]TripStopTime, len(stopTimes))
+		for i, st := range stopTimes {
+			stops[i] = TripStopTime(st)
 		}
-		t.Stops = stops
-		trips = append(trips, t)
+		trips = append(trips, TripDetail{
+			TripID:    trip.TripID,
+			ServiceID: trip.ServiceID,
+			Headsign:  trip.Headsign,
+			Direction: trip.Direction,
+			Stops:     stops,
+		})
 	}
 
-	if trips == nil {
-		trips = []TripDetail{}
-	}
-
-	return c.JSON(TripsResponse{
-		Route:  route,
+	return &TripsResponse{
+		Route:  RouteBasic(*found),
 		Trips:  trips,
 		Total:  total,
-		Limit:  limit,
-		Offset: offset,
-	})
+		Limit:  q.Limit,
+		Offset: q.Offset,
+	}, nil
 }
 
 // parseTimeStr parses "HH:MM" or "HH:MM:SS" to seconds since midnight
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/passbi/passbi_core/internal/eta"
+	"github.com/passbi/passbi_core/internal/realtime"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeDepartures(t *testing.T) {
+	intp := func(v int) *int { return &v }
+	now := 7 * 3600
+
+	departures := []DepartureInfo{
+		{AgencyID: "ddd", TripID: "T1", StopSequence: 4, DepartureSecs: now + 120, ServiceActive: true},
+		{AgencyID: "ddd", TripID: "T2", StopSequence: 4, DepartureSecs: now + 300, ServiceActive: true},
+		{AgencyID: "ddd", TripID: "T3", StopSequence: 2, DepartureSecs: now + 600, ServiceActive: true},
+		{AgencyID: "ddd", TripID: "T4", StopSequence: 7, DepartureSecs: now + 900, ServiceActive: true},
+		{AgencyID: "ddd", TripID: "T5", StopSequence: 3, DepartureSecs: now + 1200, ServiceActive: true},
+	}
+	predictions := map[realtime.Call]realtime.StopPrediction{
+		{AgencyID: "ddd", TripID: "T1", Sequence: 4}: {Sequence: 4, DepartureDelay: intp(600)},
+		{AgencyID: "ddd", TripID: "T3", Sequence: 2}: {Sequence: 2, Skipped: true},
+		{AgencyID: "ddd", TripID: "T5", Sequence: 3}: {Sequence: 3, ArrivalDelay: intp(-60)},
+	}
+	canceled := map[realtime.Call]bool{
+		{AgencyID: "ddd", TripID: "T4"}: true,
+	}
+
+	merged := mergeDepartures(departures, now, predictions, canceled)
+
+	if !assert.Len(t, merged, 3) {
+		return
+	}
+
+	// T1 runs 10 minutes late and now leaves after T2
+	assert.Equal(t, "T2", merged[0].TripID)
+	assert.False(t, merged[0].Realtime)
+	assert.Nil(t, merged[0].PredictedSecs)
+	assert.Equal(t, 5, merged[0].MinutesUntil)
+
+	assert.Equal(t, "T1", merged[1].TripID)
+	assert.True(t, merged[1].Realtime)
+	assert.Equal(t, 600, *merged[1].DelaySeconds)
+	assert.Equal(t, now+720, *merged[1].PredictedSecs)
+	assert.Equal(t, "07:12:00", merged[1].PredictedTime)
+	assert.Equal(t, now+120, merged[1].DepartureSecs)
+	assert.Equal(t, 12, merged[1].MinutesUntil)
+
+	// Without a departure delay the arrival delay applies
+	assert.Equal(t, "T5", merged[2].TripID)
+	assert.Equal(t, now+1140, *merged[2].PredictedSecs)
+}
+
+func TestFormatGTFSTime(t *testing.T) {
+	assert.Equal(t, "07:05:09", formatGTFSTime(7*3600+5*60+9))
+	assert.Equal(t, "25:10:00", formatGTFSTime(25*3600+10*60))
+}
+
+func TestGroupDepartures(t *testing.T) {
+	dep := func(route string, dir, secs int) DepartureInfo {
+		return DepartureInfo{RouteID: route, Direction: dir, DepartureSecs: secs, TripID: route + strconv.Itoa(secs)}
+	}
+	departures := []DepartureInfo{
+		dep("7", 0, 100), dep("8", 0, 200), dep("7", 0, 300), dep("7", 1, 350),
+		dep("7", 0, 400), dep("7", 0, 500), dep("8", 0, 600),
+	}
+
+	groups := groupDepartures(departures, 3)
+	if !assert.Len(t, groups, 3) {
+		return
+	}
+	assert.Equal(t, "7", groups[0].RouteID)
+	assert.Equal(t, 0, groups[0].Direction)
+	assert.Equal(t, []int{100, 300, 400}, departureSecs(groups[0].Departures))
+	assert.Equal(t, "8", groups[1].RouteID)
+	assert.Equal(t, []int{200, 600}, departureSecs(groups[1].Departures))
+	assert.Equal(t, 1, groups[2].Direction)
+
+	assert.Empty(t, groupDepartures(nil, 3))
+}
+
+func departureSecs(departures []DepartureInfo) []int {
+	secs := make([]int, len(departures))
+	for i, d := range departures {
+		secs[i] = d.DepartureSecs
+	}
+	return secs
+}
+
+func TestMergeLearned(t *testing.T) {
+	now := 7 * 3600
+	predicted := now + 400
+	departures := []DepartureInfo{
+		{AgencyID: "ddd", TripID: "T1", StopSequence: 4, DepartureSecs: now + 120, ServiceActive: true},
+		{AgencyID: "ddd", TripID: "T2", StopSequence: 4, DepartureSecs: now + 300, ServiceActive: true,
+			Realtime: true, PredictedSecs: &predicted, PredictionSource: PredictionTripUpdate},
+		{AgencyID: "ddd", TripID: "T3", StopSequence: 4, DepartureSecs: now + 600, ServiceActive: true},
+	}
+	learned := map[realtime.Call]eta.Prediction{
+		{AgencyID: "ddd", TripID: "T1", Sequence: 4}: {ArrivalSecs: now + 480, DepartureSecs: now + 540},
+		{AgencyID: "ddd", TripID: "T2", Sequence: 4}: {ArrivalSecs: now + 100, DepartureSecs: now + 100},
+	}
+
+	merged := mergeLearned(departures, now, learned)
+
+	assert.Equal(t, "T2", merged[0].TripID)
+	assert.Equal(t, PredictionTripUpdate, merged[0].PredictionSource, "feed predictions win")
+	assert.Equal(t, now+400, *merged[0].PredictedSecs)
+
+	assert.Equal(t, "T1", merged[1].TripID)
+	assert.Equal(t, PredictionLearned, merged[1].PredictionSource)
+	assert.Equal(t, 420, *merged[1].DelaySeconds)
+	assert.Equal(t, 9, merged[1].MinutesUntil)
+
+	assert.Equal(t, "T3", merged[2].TripID)
+	assert.Nil(t, merged[2].PredictedSecs)
+
+	// Detected delays give way to learned segment times only
+	detected := now + 200
+	departures = []DepartureInfo{
+		{AgencyID: "ddd", TripID: "T1", StopSequence: 4, DepartureSecs: now + 120, ServiceActive: true,
+			Realtime: true, PredictedSecs: &detected, PredictionSource: PredictionGPS},
+		{AgencyID: "ddd", TripID: "T2", StopSequence: 4, DepartureSecs: now + 150, ServiceActive: true,
+			Realtime: true, PredictedSecs: &detected, PredictionSource: PredictionGPS},
+	}
+	learned = map[realtime.Call]eta.Prediction{
+		{AgencyID: "ddd", TripID: "T1", Sequence: 4}: {ArrivalSecs: now + 300, DepartureSecs: now + 300},
+		{AgencyID: "ddd", TripID: "T2", Sequence: 4}: {ArrivalSecs: now + 360, DepartureSecs: now + 360, Learned: true},
+	}
+
+	merged = mergeLearned(departures, now, learned)
+
+	assert.Equal(t, "T1", merged[0].TripID)
+	assert.Equal(t, PredictionGPS, merged[0].PredictionSource)
+	assert.Equal(t, "T2", merged[1].TripID)
+	assert.Equal(t, PredictionLearned, merged[1].PredictionSource)
+	assert.Equal(t, 210, *merged[1].DelaySeconds)
+}
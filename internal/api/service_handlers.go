@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/passbi/passbi_core/internal/cache"
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/repository"
+)
+
+// ActiveService is a GTFS service running on the requested date
+type ActiveService struct {
+	ServiceID string   `json:"service_id" fields:"always"`
+	AgencyID  string   `json:"agency_id" fields:"always"`
+	Trips     int      `json:"trips"`
+	RouteIDs  []string `json:"route_ids"`
+}
+
+// ActiveServicesResponse is the response for the active services endpoint
+type ActiveServicesResponse struct {
+	Date     string          `json:"date"`
+	Services []ActiveService `json:"services" fields:"items"`
+	Routes   []RouteBasic    `json:"routes"`
+	Total    int             `json:"total"`
+}
+
+// ActiveServices handles GET /v2/services?date=YYYY-MM-DD&agency_id=
+// Resolves calendar and calendar_dates into the services running on date
+// (default today) and the routes they serve, with the same rules as the
+// departure boards, so clients can filter trips of a timetable themselves
+// Keys restricted to some agencies only see theirs
+func ActiveServices(c *fiber.Ctx) error {
+	// Dakar timezone = UTC+0, so service days start at UTC midnight
+	date := time.Now().UTC().Truncate(24 * time.Hour)
+	if dateStr := c.Query("date"); dateStr != "" {
+		parsed, err := time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid date format (use YYYY-MM-DD)"})
+		}
+		date = parsed
+	}
+	dateStr := date.Format("2006-01-02")
+	agencyID := c.Query("agency_id")
+	agencies := keyAgencies(c)
+	if agencyID != "" && !agencyAllowed(agencies, agencyID) {
+		return c.Status(403).JSON(fiber.Map{"error": fmt.Sprintf("this API key cannot read agency %s", agencyID)})
+	}
+	lang := requestLang(c)
+
+	if notModified(c, feedVersion(c.UserContext()), "services", dateStr, agencyID, lang) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	ctx := c.UserContext()
+	cacheKey := cache.ServicesKey(dateStr, agencyID)
+
+	var resp ActiveServicesResponse
+	if err := cache.GetJSON(ctx, cacheKey, &resp); err != nil {
+		loaded, err := loadActiveServices(ctx, date, agencyID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		resp = *loaded
+
+		if err := cache.SetJSON(ctx, cacheKey, resp, cache.TTL(cache.ClassServices)); err != nil {
+			logger.WarnContext(c.Context(), "Cache set error", "error", err)
+		}
+	}
+
+	if len(agencies) > 0 {
+		resp = restrictActiveServices(resp, agencies)
+	}
+	localizeActiveServices(ctx, lang, &resp)
+	return sendFields(c, resp)
+}
+
+// restrictActiveServices keeps the services and routes of the allowed agencies
+func restrictActiveServices(resp ActiveServicesResponse, agencies []string) ActiveServicesResponse {
+	services := []ActiveService{}
+	for _, s := range resp.Services {
+		if agencyAllowed(agencies, s.AgencyID) {
+			services = append(services, s)
+		}
+	}
+	routes := []RouteBasic{}
+	for _, r := range resp.Routes {
+		if agencyAllowed(agencies, r.AgencyID) {
+			routes = append(routes, r)
+		}
+	}
+	resp.Services, resp.Routes, resp.Total = services, routes, len(services)
+	return resp
+}
+
+// loadActiveServices lists the services active on date with their routes
+func loadActiveServices(ctx context.Context, date time.Time, agencyID string) (*ActiveServicesResponse, error) {
+	pool, err := db.ReadDB()
+	if err != nil {
+		logger.ErrorContext(ctx, "Database error", "error", err)
+		return nil, err
+	}
+
+	rows, err := pool.Query(ctx, `
+		WITH `+repository.ActiveServicesCTE(date, "$1")+`
+		SELECT a.service_id, a.agency_id, t.route_id, COUNT(t.trip_id)::int,
+			COALESCE(r.short_name, r.long_name, r.id), r.mode, r.agency_id
+		FROM active_services a
+		JOIN trip t ON t.service_id = a.service_id AND t.agency_id = a.agency_id
+		JOIN route r ON r.id = t.route_id
+		WHERE $2 = '' OR a.agency_id = $2
+		GROUP BY a.service_id, a.agency_id, t.route_id, r.short_name, r.long_name, r.id, r.mode, r.agency_id
+		ORDER BY a.agency_id, a.service_id, t.route_id
+	`, date.Format("2006-01-02"), agencyID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Active services query error", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	resp := &ActiveServicesResponse{
+		Date:     date.Format("2006-01-02"),
+		Services: []ActiveService{},
+		Routes:   []RouteBasic{},
+	}
+	seenRoutes := map[string]bool{}
+	for rows.Next() {
+		var s ActiveService
+		var r RouteBasic
+		var trips int
+		if err := rows.Scan(&s.ServiceID, &s.AgencyID, &r.ID, &trips, &r.Name, &r.Mode, &r.AgencyID); err != nil {
+			logger.ErrorContext(ctx, "Active services scan error", "error", err)
+			return nil, err
+		}
+		addServiceRoute(resp, seenRoutes, s, r, trips)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(resp.Routes, func(i, j int) bool { return resp.Routes[i].ID < resp.Routes[j].ID })
+	resp.Total = len(resp.Services)
+	return resp, nil
+}
+
+// addServiceRoute records that service s runs trips on route r, rows coming
+// ordered by agency and service; each route is listed once however many
+// services run it
+func addServiceRoute(resp *ActiveServicesResponse, seenRoutes map[string]bool, s ActiveService, r RouteBasic, trips int) {
+	last := len(resp.Services) - 1
+	if last < 0 || resp.Services[last].ServiceID != s.ServiceID || resp.Services[last].AgencyID != s.AgencyID {
+		s.RouteIDs = []string{}
+		resp.Services = append(resp.Services, s)
+		last++
+	}
+	resp.Services[last].Trips += trips
+	resp.Services[last].RouteIDs = append(resp.Services[last].RouteIDs, r.ID)
+
+	if !seenRoutes[r.ID] {
+		seenRoutes[r.ID] = true
+		resp.Routes = append(resp.Routes, r)
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/passbi/passbi_core/internal/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddServiceRoute(t *testing.T) {
+	resp := &ActiveServicesResponse{Services: []ActiveService{}, Routes: []RouteBasic{}}
+	seen := map[string]bool{}
+	weekday := ActiveService{ServiceID: "weekday", AgencyID: "ddd"}
+	r7 := RouteBasic{ID: "DDD_7", AgencyID: "ddd"}
+	r8 := RouteBasic{ID: "DDD_8", AgencyID: "ddd"}
+
+	addServiceRoute(resp, seen, weekday, r7, 40)
+	addServiceRoute(resp, seen, weekday, r8, 12)
+	// Same service ID, other agency: a service of its own
+	addServiceRoute(resp, seen, ActiveService{ServiceID: "weekday", AgencyID: "aftu"}, RouteBasic{ID: "AFTU_1", AgencyID: "aftu"}, 5)
+	addServiceRoute(resp, seen, ActiveService{ServiceID: "school", AgencyID: "ddd"}, r7, 6)
+
+	if !assert.Len(t, resp.Services, 3) {
+		return
+	}
+	assert.Equal(t, 52, resp.Services[0].Trips)
+	assert.Equal(t, []string{"DDD_7", "DDD_8"}, resp.Services[0].RouteIDs)
+	assert.Equal(t, "aftu", resp.Services[1].AgencyID)
+	assert.Equal(t, []string{"DDD_7"}, resp.Services[2].RouteIDs)
+	assert.Len(t, resp.Routes, 3, "DDD_7 is listed once")
+}
+
+func TestRestrictActiveServices(t *testing.T) {
+	resp := restrictActiveServices(ActiveServicesResponse{
+		Date: "2026-03-02",
+		Services: []ActiveService{
+			{ServiceID: "weekday", AgencyID: "ddd"},
+			{ServiceID: "weekday", AgencyID: "aftu"},
+		},
+		Routes: []RouteBasic{{ID: "DDD_7", AgencyID: "ddd"}, {ID: "AFTU_1", AgencyID: "aftu"}},
+		Total:  2,
+	}, []string{"aftu"})
+
+	assert.Equal(t, "2026-03-02", resp.Date)
+	assert.Equal(t, []ActiveService{{ServiceID: "weekday", AgencyID: "aftu"}}, resp.Services)
+	assert.Equal(t, []RouteBasic{{ID: "AFTU_1", AgencyID: "aftu"}}, resp.Routes)
+	assert.Equal(t, 1, resp.Total)
+}
+
+func TestActiveServicesRejects(t *testing.T) {
+	app := fiber.New()
+	app.Get("/v2/services", func(c *fiber.Ctx) error {
+		c.Locals("partner", &middleware.PartnerContext{Agencies: []string{"aftu"}})
+		return c.Next()
+	}, ActiveServices)
+
+	// Each is answered before the database is reached
+	for _, tc := range []struct {
+		query  string
+		status int
+	}{
+		{"?date=02/03/2026", 400},
+		{"?date=2026-02-30", 400},
+		{"?agency_id=dakar_dem_dikk", 403},
+	} {
+		resp, err := app.Test(httptest.NewRequest("GET", "/v2/services"+tc.query, nil))
+		if assert.NoError(t, err) {
+			assert.Equal(t, tc.status, resp.StatusCode, tc.query)
+		}
+	}
+}
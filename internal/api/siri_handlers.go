@@ -0,0 +1,83 @@
+package api
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/passbi/passbi_core/internal/siri"
+)
+
+// SIRIStopMonitoring handles GET /v2/siri/stop-monitoring?MonitoringRef=ID
+// SIRI Lite StopMonitoring for integrators that do not consume the JSON API
+// Optional: MaximumStopVisits (default 10, max 50), StartTime (RFC3339, default now)
+func SIRIStopMonitoring(c *fiber.Ctx) error {
+	now := time.Now().UTC()
+
+	stopID := c.Query("MonitoringRef")
+	if stopID == "" {
+		return sendSIRI(c, 400, siri.StopMonitoringError("MonitoringRef is required", false, now))
+	}
+
+	var dateStr, timeStr string
+	if start := c.Query("StartTime"); start != "" {
+		t, err := time.Parse(time.RFC3339, start)
+		if err != nil {
+			return sendSIRI(c, 400, siri.StopMonitoringError("invalid StartTime (use RFC3339)", false, now))
+		}
+		t = t.UTC()
+		dateStr = t.Format("2006-01-02")
+		timeStr = t.Format("15:04:05")
+	}
+
+	q, err := parseDeparturesQuery(dateStr, timeStr, c.Query("MaximumStopVisits", "10"))
+	if err != nil {
+		return sendSIRI(c, 400, siri.StopMonitoringError(err.Error(), false, now))
+	}
+
+	q.Agencies = keyAgencies(c)
+	resp, err := getDepartures(c.UserContext(), stopID, q)
+	if errors.Is(err, errStopNotFound) {
+		return sendSIRI(c, 404, siri.StopMonitoringError("unknown stop "+stopID, true, now))
+	}
+	if err != nil {
+		return sendSIRI(c, 500, siri.StopMonitoringError("internal server error", false, now))
+	}
+
+	serviceDay := time.Date(q.Date.Year(), q.Date.Month(), q.Date.Day(), 0, 0, 0, 0, time.UTC)
+	visits := make([]siri.Visit, 0, len(resp.Departures))
+	for _, d := range resp.Departures {
+		aimed := serviceDay.Add(time.Duration(d.DepartureSecs) * time.Second)
+		v := siri.Visit{
+			StopID:         resp.Stop.ID,
+			StopName:       resp.Stop.Name,
+			LineRef:        d.RouteID,
+			LineName:       d.RouteName,
+			OperatorRef:    d.AgencyID,
+			Direction:      d.Direction,
+			TripID:         d.TripID,
+			ServiceDate:    serviceDay,
+			Destination:    d.Headsign,
+			AimedDeparture: aimed,
+		}
+		if d.Realtime && d.DelaySeconds != nil {
+			expected := aimed.Add(time.Duration(*d.DelaySeconds) * time.Second)
+			v.ExpectedDeparture = &expected
+		}
+		visits = append(visits, v)
+	}
+
+	return sendSIRI(c, 200, siri.StopMonitoring(resp.Stop.ID, visits, now))
+}
+
+// sendSIRI writes a SIRI document as XML
+func sendSIRI(c *fiber.Ctx, status int, doc *siri.Siri) error {
+	body, err := doc.Marshal()
+	if err != nil {
+		logger.ErrorContext(c.Context(), "SIRI marshal error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	c.Set("Content-Type", "application/xml; charset=utf-8")
+	return c.Status(status).Send(body)
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/metrics"
+	"github.com/passbi/passbi_core/internal/routing"
+)
+
+// defaultSlowSearch is the latency budget of one route-search strategy
+const defaultSlowSearch = time.Second
+
+var (
+	slowSearchOnce      sync.Once
+	slowSearchThreshold time.Duration
+
+	// slowSearches counts slow searches by strategy name
+	slowSearches sync.Map
+)
+
+func init() {
+	metrics.Register(func(w *metrics.Writer) {
+		for _, s := range routing.GetAllStrategies() {
+			var n int64
+			if v, ok := slowSearches.Load(s.Name()); ok {
+				n = v.(*atomic.Int64).Load()
+			}
+			w.Counter("passbi_route_search_slow_total", "Route searches over the SLOW_SEARCH_MS budget", float64(n), metrics.L("strategy", s.Name()))
+		}
+	})
+}
+
+// slowSearch returns the route-search latency budget, from SLOW_SEARCH_MS
+// (0 disables slow search logging)
+func slowSearch() time.Duration {
+	slowSearchOnce.Do(func() {
+		slowSearchThreshold = defaultSlowSearch
+		if v := os.Getenv("SLOW_SEARCH_MS"); v != "" {
+			if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+				slowSearchThreshold = time.Duration(n) * time.Millisecond
+			}
+		}
+	})
+	return slowSearchThreshold
+}
+
+// observeSearch logs and counts a strategy search that exceeded its budget,
+// with its origin-destination pair so it can be replayed
+func observeSearch(ctx context.Context, strategy string, od odPair, elapsed time.Duration, cached bool, err error) {
+	threshold := slowSearch()
+	if threshold == 0 || elapsed < threshold {
+		return
+	}
+
+	v, _ := slowSearches.LoadOrStore(strategy, &atomic.Int64{})
+	v.(*atomic.Int64).Add(1)
+
+	args := []any{
+		"strategy", strategy,
+		"from", formatCoord(od.FromLat, od.FromLon),
+		"to", formatCoord(od.ToLat, od.ToLon),
+		"duration_ms", elapsed.Milliseconds(),
+		"budget_ms", threshold.Milliseconds(),
+		"cached", cached,
+	}
+	if err != nil {
+		args = append(args, "error", err)
+	}
+	logger.WarnContext(ctx, "Slow route search", args...)
+}
+
+// formatCoord formats a point the way route-search accepts it
+func formatCoord(lat, lon float64) string {
+	return strconv.FormatFloat(lat, 'f', 6, 64) + "," + strconv.FormatFloat(lon, 'f', 6, 64)
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveSearch(t *testing.T) {
+	prev := slog.Default()
+	defer slog.SetDefault(prev)
+	var buf bytes.Buffer
+	logging.SetupWithConfig("api", &logging.Config{Level: slog.LevelInfo, Format: "text"}, &buf)
+
+	slowSearch()
+	defer func(d time.Duration) { slowSearchThreshold = d }(slowSearchThreshold)
+	slowSearchThreshold = 100 * time.Millisecond
+
+	od := odPair{14.6928, -17.4467, 14.7645, -17.3660}
+	count := func() int64 {
+		if v, ok := slowSearches.Load("fast"); ok {
+			return v.(*atomic.Int64).Load()
+		}
+		return 0
+	}
+	before := count()
+
+	observeSearch(context.Background(), "fast", od, 50*time.Millisecond, false, nil)
+	assert.Empty(t, buf.String())
+
+	observeSearch(context.Background(), "fast", od, 250*time.Millisecond, false, errors.New("no path"))
+	assert.Contains(t, buf.String(), "Slow route search")
+	assert.Contains(t, buf.String(), "from=14.692800,-17.446700")
+	assert.Contains(t, buf.String(), "to=14.764500,-17.366000")
+	assert.Contains(t, buf.String(), "duration_ms=250")
+	assert.Contains(t, buf.String(), `error="no path"`)
+	assert.Equal(t, before+1, count())
+}
@@ -0,0 +1,273 @@
+package api
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/cache"
+	"github.com/passbi/passbi_core/internal/graph"
+)
+
+// statsPeriods are the windows accepted by GET /admin/stats
+var statsPeriods = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+// topEndpointsLimit is how many endpoints the dashboard lists
+const topEndpointsLimit = 10
+
+// StatsResponse is the ops dashboard payload of GET /admin/stats
+type StatsResponse struct {
+	Period       string           `json:"period"`
+	Since        time.Time        `json:"since"`
+	GeneratedAt  time.Time        `json:"generated_at"`
+	Requests     RequestStats     `json:"requests"`
+	TopEndpoints []EndpointStats  `json:"top_endpoints"`
+	RouteSearch  RouteSearchStats `json:"route_search"`
+	Strategies   StrategyReport   `json:"strategies"`
+	Cache        CacheStats       `json:"cache"`
+	Graph        graph.Stats      `json:"graph"`
+	Feeds        []FeedFreshness  `json:"feeds"`
+}
+
+// RequestStats summarizes API traffic over the period
+type RequestStats struct {
+	Total          int64   `json:"total"`
+	Successful     int64   `json:"successful"`
+	ClientErrors   int64   `json:"client_errors"`
+	ServerErrors   int64   `json:"server_errors"`
+	AvgResponseMs  float64 `json:"avg_response_ms"`
+	P95ResponseMs  float64 `json:"p95_response_ms"`
+	ActivePartners int64   `json:"active_partners"`
+}
+
+// EndpointStats is the traffic of one route pattern
+type EndpointStats struct {
+	Endpoint      string  `json:"endpoint"`
+	Requests      int64   `json:"requests"`
+	ErrorRate     float64 `json:"error_rate"`
+	AvgResponseMs float64 `json:"avg_response_ms"`
+}
+
+// RouteSearchStats tells how often searches found an itinerary
+type RouteSearchStats struct {
+	Requests    int64   `json:"requests"`
+	Found       int64   `json:"found"`
+	NotFound    int64   `json:"not_found"`
+	Errors      int64   `json:"errors"`
+	SuccessRate float64 `json:"success_rate"`
+}
+
+// CacheStats combines route-search cache hits and Redis keyspace counters
+// Redis counters are cumulative since the Redis server started
+type CacheStats struct {
+	RouteSearchHitRate float64 `json:"route_search_hit_rate"`
+	RedisHits          int64   `json:"redis_hits"`
+	RedisMisses        int64   `json:"redis_misses"`
+	RedisHitRate       float64 `json:"redis_hit_rate"`
+}
+
+// FeedFreshness describes the data loaded for one agency
+type FeedFreshness struct {
+	AgencyID          string     `json:"agency_id"`
+	LastImportAt      *time.Time `json:"last_import_at,omitempty"`
+	LastImportStatus  string     `json:"last_import_status,omitempty"`
+	LastSuccessAt     *time.Time `json:"last_success_at,omitempty"`
+	AgeHours          *float64   `json:"age_hours,omitempty"`
+	ServiceEndDate    string     `json:"service_end_date,omitempty"`
+	RealtimeUpdatedAt *time.Time `json:"realtime_updated_at,omitempty"`
+}
+
+// AdminStats handles GET /admin/stats?period=24h
+// One payload for the ops dashboard: traffic, route-search outcomes, cache
+// efficiency, graph size and how fresh each agency's feed is
+func AdminStats(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	period := c.Query("period", "24h")
+	window, ok := statsPeriods[period]
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": "period must be 1h, 24h, 7d or 30d",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	resp := StatsResponse{
+		Period:      period,
+		Since:       now.Add(-window),
+		GeneratedAt: now,
+		Strategies:  strategyReport(),
+		Graph:       graph.GetGraph().Stats(),
+	}
+	hours := int(window.Hours())
+
+	if err := loadRequestStats(ctx, pool, hours, &resp); err != nil {
+		logger.ErrorContext(c.Context(), "Failed to load request stats", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to retrieve stats",
+		})
+	}
+
+	feeds, err := loadFeedFreshness(ctx, pool, now)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to load feed freshness", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to retrieve stats",
+		})
+	}
+	resp.Feeds = feeds
+
+	// Redis being unavailable should not hide the rest of the dashboard
+	if hits, misses, err := cache.KeyspaceStats(ctx); err != nil {
+		logger.ErrorContext(c.Context(), "Failed to read Redis stats", "error", err)
+	} else {
+		resp.Cache.RedisHits = hits
+		resp.Cache.RedisMisses = misses
+		resp.Cache.RedisHitRate = percent(hits, hits+misses)
+	}
+
+	return c.JSON(resp)
+}
+
+// loadRequestStats aggregates usage_log over the last hours
+func loadRequestStats(ctx context.Context, pool *pgxpool.Pool, hours int, resp *StatsResponse) error {
+	const window = `timestamp >= NOW() - make_interval(hours => $1)`
+
+	r := &resp.Requests
+	err := pool.QueryRow(ctx, `
+		SELECT COUNT(*),
+			COUNT(*) FILTER (WHERE response_status < 400),
+			COUNT(*) FILTER (WHERE response_status >= 400 AND response_status < 500),
+			COUNT(*) FILTER (WHERE response_status >= 500),
+			COALESCE(AVG(response_time_ms), 0),
+			COALESCE(percentile_cont(0.95) WITHIN GROUP (ORDER BY response_time_ms), 0),
+			COUNT(DISTINCT partner_id)
+		FROM usage_log
+		WHERE `+window, hours,
+	).Scan(&r.Total, &r.Successful, &r.ClientErrors, &r.ServerErrors,
+		&r.AvgResponseMs, &r.P95ResponseMs, &r.ActivePartners)
+	if err != nil {
+		return err
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT endpoint, COUNT(*),
+			COUNT(*) FILTER (WHERE response_status >= 400),
+			AVG(response_time_ms)
+		FROM usage_log
+		WHERE `+window+`
+		GROUP BY endpoint
+		ORDER BY COUNT(*) DESC, endpoint
+		LIMIT $2
+	`, hours, topEndpointsLimit)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	resp.TopEndpoints = []EndpointStats{}
+	for rows.Next() {
+		var e EndpointStats
+		var errCount int64
+		if err := rows.Scan(&e.Endpoint, &e.Requests, &errCount, &e.AvgResponseMs); err != nil {
+			return err
+		}
+		e.ErrorRate = percent(errCount, e.Requests)
+		resp.TopEndpoints = append(resp.TopEndpoints, e)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// 404 is the "no route found" answer; anything else non-2xx is an error
+	rs := &resp.RouteSearch
+	var cacheHits int64
+	err = pool.QueryRow(ctx, `
+		SELECT COUNT(*),
+			COUNT(*) FILTER (WHERE response_status < 300),
+			COUNT(*) FILTER (WHERE response_status = 404),
+			COUNT(*) FILTER (WHERE response_status >= 300 AND response_status <> 404),
+			COUNT(*) FILTER (WHERE cache_hit)
+		FROM usage_log
+		WHERE endpoint LIKE '%/route-search' AND `+window, hours,
+	).Scan(&rs.Requests, &rs.Found, &rs.NotFound, &rs.Errors, &cacheHits)
+	if err != nil {
+		return err
+	}
+	rs.SuccessRate = percent(rs.Found, rs.Requests)
+	resp.Cache.RouteSearchHitRate = percent(cacheHits, rs.Found)
+
+	return nil
+}
+
+// loadFeedFreshness reports the last import and service coverage per agency
+func loadFeedFreshness(ctx context.Context, pool *pgxpool.Pool, now time.Time) ([]FeedFreshness, error) {
+	rows, err := pool.Query(ctx, `
+		WITH agency AS (
+			SELECT agency_id FROM route
+			UNION
+			SELECT agency_id FROM import_log
+		)
+		SELECT a.agency_id, last.started_at, last.status,
+			(SELECT MAX(completed_at) FROM import_log l
+				WHERE l.agency_id = a.agency_id AND l.status = 'success'),
+			(SELECT to_char(MAX(end_date), 'YYYY-MM-DD') FROM calendar c WHERE c.agency_id = a.agency_id),
+			(SELECT MAX(updated_at) FROM stop_time_update u WHERE u.agency_id = a.agency_id)
+		FROM agency a
+		LEFT JOIN LATERAL (
+			SELECT started_at, status FROM import_log l
+			WHERE l.agency_id = a.agency_id
+			ORDER BY started_at DESC
+			LIMIT 1
+		) last ON true
+		ORDER BY a.agency_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	feeds := []FeedFreshness{}
+	for rows.Next() {
+		var f FeedFreshness
+		var status, endDate *string
+		if err := rows.Scan(&f.AgencyID, &f.LastImportAt, &status, &f.LastSuccessAt,
+			&endDate, &f.RealtimeUpdatedAt); err != nil {
+			return nil, err
+		}
+		if status != nil {
+			f.LastImportStatus = *status
+		}
+		if endDate != nil {
+			f.ServiceEndDate = *endDate
+		}
+		if f.LastSuccessAt != nil {
+			age := math.Round(now.Sub(*f.LastSuccessAt).Hours()*10) / 10
+			f.AgeHours = &age
+		}
+		feeds = append(feeds, f)
+	}
+
+	return feeds, rows.Err()
+}
+
+// percent returns part/total as a percentage, 0 when total is 0
+func percent(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
+}
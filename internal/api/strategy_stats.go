@@ -0,0 +1,164 @@
+package api
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/metrics"
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/passbi/passbi_core/internal/routing"
+)
+
+// Strategy outcomes of a route search
+const (
+	strategyResult    = "result"    // a distinct itinerary
+	strategyDuplicate = "duplicate" // the itinerary of a strategy listed before it
+	strategyFailure   = "failure"   // no itinerary (no path, limit, timeout)
+)
+
+// StrategyStats tells how often a strategy contributes an itinerary of its
+// own to /route-search, to judge whether it is worth its compute
+type StrategyStats struct {
+	Strategy      string  `json:"strategy"`
+	Searches      int64   `json:"searches"`
+	Results       int64   `json:"results"`
+	Duplicates    int64   `json:"duplicates"`
+	Failures      int64   `json:"failures"`
+	ResultRate    float64 `json:"result_rate"`
+	DuplicateRate float64 `json:"duplicate_rate"`
+	FailureRate   float64 `json:"failure_rate"`
+	CacheHits     int64   `json:"cache_hits"`
+	AvgComputeMs  float64 `json:"avg_compute_ms"` // searches not answered from the cache
+}
+
+// StrategyReport is the per-strategy section of GET /admin/stats
+// Counters are per instance and start at zero when it starts
+type StrategyReport struct {
+	Since      time.Time       `json:"since"`
+	Strategies []StrategyStats `json:"strategies"`
+}
+
+type strategyCounters struct {
+	results    atomic.Int64
+	duplicates atomic.Int64
+	failures   atomic.Int64
+	cacheHits  atomic.Int64
+	computed   atomic.Int64
+	computeNs  atomic.Int64
+}
+
+var (
+	// strategyOrder ranks strategies: an itinerary is a duplicate of the
+	// first strategy in this order that returned it
+	strategyOrder   = routing.GetAllStrategies()
+	strategyCounts  = map[string]*strategyCounters{}
+	strategiesSince = time.Now()
+)
+
+func init() {
+	for _, s := range strategyOrder {
+		strategyCounts[s.Name()] = &strategyCounters{}
+	}
+	metrics.Register(func(w *metrics.Writer) {
+		for _, s := range strategyOrder {
+			c := strategyCounts[s.Name()]
+			for _, o := range []struct {
+				outcome string
+				n       int64
+			}{
+				{strategyResult, c.results.Load()},
+				{strategyDuplicate, c.duplicates.Load()},
+				{strategyFailure, c.failures.Load()},
+			} {
+				w.Counter("passbi_route_search_strategy_total", "Route-search strategy outcomes (result, duplicate, failure)",
+					float64(o.n), metrics.L("strategy", s.Name()), metrics.L("outcome", o.outcome))
+			}
+		}
+	})
+}
+
+// strategyRun is what one strategy produced for a route search
+type strategyRun struct {
+	path     *models.Path
+	cached   bool
+	err      error
+	duration time.Duration
+}
+
+// recordStrategies counts the outcome of each strategy of one route search
+// and returns it by strategy name
+func recordStrategies(runs map[string]strategyRun) map[string]string {
+	outcomes := make(map[string]string, len(runs))
+	seen := map[string]bool{}
+
+	for _, s := range strategyOrder {
+		run, ok := runs[s.Name()]
+		if !ok {
+			continue
+		}
+		c := strategyCounts[s.Name()]
+
+		if run.cached {
+			c.cacheHits.Add(1)
+		} else {
+			c.computed.Add(1)
+			c.computeNs.Add(int64(run.duration))
+		}
+
+		switch {
+		case run.err != nil || run.path == nil:
+			outcomes[s.Name()] = strategyFailure
+			c.failures.Add(1)
+		case seen[itineraryKey(run.path)]:
+			outcomes[s.Name()] = strategyDuplicate
+			c.duplicates.Add(1)
+		default:
+			outcomes[s.Name()] = strategyResult
+			c.results.Add(1)
+			seen[itineraryKey(run.path)] = true
+		}
+	}
+	return outcomes
+}
+
+// itineraryKey identifies an itinerary by its legs: two strategies that ride
+// the same routes between the same stops return the same trip
+func itineraryKey(p *models.Path) string {
+	var b strings.Builder
+	for _, s := range p.Steps {
+		b.WriteString(string(s.Type))
+		b.WriteByte('|')
+		b.WriteString(s.Route)
+		b.WriteByte('|')
+		b.WriteString(s.FromStop)
+		b.WriteByte('|')
+		b.WriteString(s.ToStop)
+		b.WriteByte(';')
+	}
+	return b.String()
+}
+
+// strategyReport returns the counters of each strategy
+func strategyReport() StrategyReport {
+	report := StrategyReport{Since: strategiesSince.UTC(), Strategies: []StrategyStats{}}
+	for _, s := range strategyOrder {
+		c := strategyCounts[s.Name()]
+		st := StrategyStats{
+			Strategy:   s.Name(),
+			Results:    c.results.Load(),
+			Duplicates: c.duplicates.Load(),
+			Failures:   c.failures.Load(),
+			CacheHits:  c.cacheHits.Load(),
+		}
+		st.Searches = st.Results + st.Duplicates + st.Failures
+		st.ResultRate = percent(st.Results, st.Searches)
+		st.DuplicateRate = percent(st.Duplicates, st.Searches)
+		st.FailureRate = percent(st.Failures, st.Searches)
+		if n := c.computed.Load(); n > 0 {
+			st.AvgComputeMs = float64(c.computeNs.Load()) / float64(n) / 1e6
+		}
+		report.Strategies = append(report.Strategies, st)
+	}
+	return report
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordStrategies(t *testing.T) {
+	bus := &models.Path{Steps: []models.Step{
+		{Type: models.EdgeWalk, FromStop: "A", ToStop: "B"},
+		{Type: models.EdgeRide, Route: "DDD_7", FromStop: "B", ToStop: "C"},
+	}}
+	brt := &models.Path{Steps: []models.Step{
+		{Type: models.EdgeRide, Route: "BRT_1", FromStop: "A", ToStop: "C"},
+	}}
+	// Same legs, different timing: still the same itinerary
+	busAgain := &models.Path{TotalTime: 1200, Steps: []models.Step{
+		{Type: models.EdgeWalk, FromStop: "A", ToStop: "B", Duration: 60},
+		{Type: models.EdgeRide, Route: "DDD_7", FromStop: "B", ToStop: "C", Duration: 900},
+	}}
+
+	before := strategyReport()
+	outcomes := recordStrategies(map[string]strategyRun{
+		"fast":        {path: busAgain, duration: 40 * time.Millisecond},
+		"no_transfer": {path: bus, cached: true},
+		"direct":      {err: errors.New("explored too many nodes"), duration: 20 * time.Millisecond},
+		"simple":      {path: brt, duration: 30 * time.Millisecond},
+	})
+
+	assert.Equal(t, map[string]string{
+		"no_transfer": strategyResult,
+		"direct":      strategyFailure,
+		"simple":      strategyResult,
+		"fast":        strategyDuplicate,
+	}, outcomes)
+
+	after := strategyReport()
+	byName := func(r StrategyReport, name string) StrategyStats {
+		for _, s := range r.Strategies {
+			if s.Strategy == name {
+				return s
+			}
+		}
+		return StrategyStats{}
+	}
+	assert.Equal(t, int64(1), byName(after, "fast").Duplicates-byName(before, "fast").Duplicates)
+	assert.Equal(t, int64(1), byName(after, "direct").Failures-byName(before, "direct").Failures)
+	assert.Equal(t, int64(1), byName(after, "no_transfer").CacheHits-byName(before, "no_transfer").CacheHits)
+	assert.Greater(t, byName(after, "fast").AvgComputeMs, 0.0)
+}
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/middleware"
+)
+
+// Who changed a partner's tier
+const (
+	tierChangedByPartner = "partner"
+	tierChangedByAdmin   = "admin"
+)
+
+// selfServiceTiers are the tiers partners may switch to themselves;
+// enterprise is set by PassBi staff once a contract is signed
+var selfServiceTiers = map[string]bool{"free": true, "starter": true, "business": true}
+
+var (
+	errUnknownTier     = errors.New("unknown tier")
+	errPartnerNotFound = errors.New("partner not found")
+)
+
+// tooManyKeysError rejects a downgrade to a tier allowing fewer active keys
+type tooManyKeysError struct {
+	active, max int
+}
+
+func (e *tooManyKeysError) Error() string {
+	return fmt.Sprintf("%d active API keys, the tier allows %d", e.active, e.max)
+}
+
+// TierChangeRequest is the body of PUT /dashboard/tier and
+// PUT /admin/partners/:id/tier
+type TierChangeRequest struct {
+	Tier string `json:"tier"`
+}
+
+// TierChangeResponse is the partner's tier and limits after a change
+// MonthLimit is this month's prorated quota; RateLimits.per_month applies
+// from next month
+type TierChangeResponse struct {
+	PartnerID    string         `json:"partner_id"`
+	PreviousTier string         `json:"previous_tier"`
+	Tier         string         `json:"tier"`
+	RateLimits   map[string]int `json:"rate_limits"`
+	MonthLimit   int            `json:"month_limit"`
+	MaxAPIKeys   int            `json:"max_api_keys"`
+	ChangedAt    time.Time      `json:"changed_at"`
+}
+
+// ChangeTier handles PUT /dashboard/tier
+// Partners upgrade or downgrade between the self-service tiers; the new
+// limits apply to their next request
+func ChangeTier(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*middleware.PartnerContext)
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	var req TierChangeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Invalid request body",
+		})
+	}
+	req.Tier = strings.ToLower(strings.TrimSpace(req.Tier))
+	if !selfServiceTiers[req.Tier] {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": "tier must be free, starter or business; contact sales for enterprise",
+		})
+	}
+
+	return respondTierChange(c, pool, partner.PartnerID, req.Tier, tierChangedByPartner)
+}
+
+// AdminChangeTier handles PUT /admin/partners/:id/tier
+// Admins can set any tier, including enterprise
+func AdminChangeTier(c *fiber.Ctx) error {
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	var req TierChangeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Invalid request body",
+		})
+	}
+
+	return respondTierChange(c, pool, c.Params("id"), strings.ToLower(strings.TrimSpace(req.Tier)), tierChangedByAdmin)
+}
+
+// respondTierChange applies a tier change and writes its outcome
+func respondTierChange(c *fiber.Ctx, pool *pgxpool.Pool, partnerID, tier, changedBy string) error {
+	resp, err := changeTier(c.UserContext(), pool, partnerID, tier, changedBy, time.Now())
+
+	var tooMany *tooManyKeysError
+	switch {
+	case err == nil:
+		return c.JSON(resp)
+	case errors.Is(err, errUnknownTier):
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": fmt.Sprintf("Unknown tier %q", tier),
+		})
+	case errors.Is(err, errPartnerNotFound):
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "not_found",
+			"message": "Partner not found",
+		})
+	case errors.As(err, &tooMany):
+		return c.Status(409).JSON(fiber.Map{
+			"error":          "too_many_api_keys",
+			"message":        fmt.Sprintf("The %s tier allows %d active API keys; revoke %d before downgrading", tier, tooMany.max, tooMany.active-tooMany.max),
+			"active_keys":    tooMany.active,
+			"max_api_keys":   tooMany.max,
+			"requested_tier": tier,
+		})
+	default:
+		logger.ErrorContext(c.Context(), "Failed to change tier", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to change tier",
+		})
+	}
+}
+
+// changeTier copies a tier's limits from tier_config onto the partner and
+// prorates this month's quota between the old and new tier
+func changeTier(ctx context.Context, pool *pgxpool.Pool, partnerID, tier, changedBy string, now time.Time) (*TierChangeResponse, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	resp := &TierChangeResponse{PartnerID: partnerID, Tier: tier, RateLimits: map[string]int{}}
+
+	var currentMonthLimit int
+	err = tx.QueryRow(ctx, `
+		SELECT p.tier, CASE WHEN p.prorated_month = date_trunc('month', NOW())::date
+			THEN p.prorated_month_limit ELSE p.rate_limit_per_month END
+		FROM partner p
+		WHERE p.id::text = $1
+		FOR UPDATE
+	`, partnerID).Scan(&resp.PreviousTier, &currentMonthLimit)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errPartnerNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var perSecond, perDay, perMonth, burst int
+	err = tx.QueryRow(ctx, `
+		SELECT rate_limit_per_second, rate_limit_per_day, rate_limit_per_month, rate_limit_burst,
+			COALESCE((features->>'max_api_keys')::int, -1)
+		FROM tier_config
+		WHERE tier = $1
+	`, tier).Scan(&perSecond, &perDay, &perMonth, &burst, &resp.MaxAPIKeys)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errUnknownTier
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.MaxAPIKeys > 0 {
+		var active int
+		if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM api_key WHERE partner_id::text = $1 AND is_active = true`,
+			partnerID).Scan(&active); err != nil {
+			return nil, err
+		}
+		if active > resp.MaxAPIKeys {
+			return nil, &tooManyKeysError{active: active, max: resp.MaxAPIKeys}
+		}
+	}
+
+	resp.MonthLimit = currentMonthLimit
+	if tier != resp.PreviousTier {
+		resp.MonthLimit = proratedMonthLimit(currentMonthLimit, perMonth, now)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE partner
+		SET tier = $2,
+			rate_limit_per_second = $3,
+			rate_limit_per_day = $4,
+			rate_limit_per_month = $5,
+			rate_limit_burst = $6,
+			prorated_month = date_trunc('month', NOW())::date,
+			prorated_month_limit = $7
+		WHERE id::text = $1
+	`, partnerID, tier, perSecond, perDay, perMonth, burst, resp.MonthLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO partner_tier_change (partner_id, from_tier, to_tier, changed_by)
+		VALUES ($1::uuid, $2, $3, $4)
+		RETURNING changed_at
+	`, partnerID, resp.PreviousTier, tier, changedBy).Scan(&resp.ChangedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.RateLimits["per_second"] = perSecond
+	resp.RateLimits["burst"] = burst
+	resp.RateLimits["per_day"] = perDay
+	resp.RateLimits["per_month"] = perMonth
+	return resp, tx.Commit(ctx)
+}
+
+// proratedMonthLimit blends two monthly quotas by the share of the month
+// left at now: the old quota for the days past, the new one for the rest
+// An unlimited new quota (0 or less) applies at once; after an unlimited
+// one, the new quota applies to the whole month
+func proratedMonthLimit(oldLimit, newLimit int, now time.Time) int {
+	if newLimit <= 0 || oldLimit <= 0 {
+		return newLimit
+	}
+
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	end := start.AddDate(0, 1, 0)
+	remaining := float64(end.Sub(now)) / float64(end.Sub(start))
+
+	return int(math.Round(float64(oldLimit)*(1-remaining) + float64(newLimit)*remaining))
+}
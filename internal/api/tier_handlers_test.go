@@ -0,0 +1,20 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProratedMonthLimit(t *testing.T) {
+	// September has 30 days; the 16th at 00:00 leaves half of it
+	mid := time.Date(2026, time.September, 16, 0, 0, 0, 0, time.UTC)
+	start := time.Date(2026, time.September, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 275000, proratedMonthLimit(50000, 500000, mid), "upgrade halfway")
+	assert.Equal(t, 275000, proratedMonthLimit(500000, 50000, mid), "downgrade halfway")
+	assert.Equal(t, 500000, proratedMonthLimit(50000, 500000, start), "change on the 1st")
+	assert.Equal(t, -1, proratedMonthLimit(500000, -1, mid), "unlimited applies at once")
+	assert.Equal(t, 50000, proratedMonthLimit(-1, 50000, mid), "leaving unlimited")
+}
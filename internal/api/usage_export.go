@@ -0,0 +1,240 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/middleware"
+)
+
+// Usage exports are read in pages so a month of traffic is never held in
+// memory, and span at most maxUsageExportDays
+// Each page gets usageExportPageTimeout to be read and written: the server's
+// WriteTimeout would otherwise cut long exports short after their 200
+const (
+	usageExportPageSize    = 5000
+	maxUsageExportDays     = 92
+	usageExportPageTimeout = 30 * time.Second
+)
+
+// usageRow is one usage_log row as exported
+type usageRow struct {
+	ID             int64
+	Timestamp      time.Time
+	RequestID      string
+	APIKeyID       string
+	Method         string
+	Endpoint       string
+	ResponseStatus int
+	ResponseTimeMs int
+	CacheHit       bool
+	IPAddress      string
+	UserAgent      string
+	Sandbox        bool
+}
+
+// usageCursor is the position after the last exported row
+type usageCursor struct {
+	Timestamp time.Time
+	ID        int64
+}
+
+// usagePage fetches up to usageExportPageSize rows after a cursor
+type usagePage func(ctx context.Context, after *usageCursor) ([]usageRow, error)
+
+var usageCSVHeader = []string{
+	"timestamp", "request_id", "api_key_id", "method", "endpoint",
+	"response_status", "response_time_ms", "cache_hit", "ip_address", "user_agent", "sandbox",
+}
+
+// ExportUsage handles GET /dashboard/usage/export?from=&to=
+// Streams the partner's raw usage_log rows as CSV, oldest first
+// from and to are dates (2026-09-01, to inclusive) or RFC 3339 times; the
+// last 7 days by default
+func ExportUsage(c *fiber.Ctx) error {
+	partner := c.Locals("partner").(*middleware.PartnerContext)
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	from, to, err := usageExportRange(c.Query("from"), c.Query("to"), time.Now())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": err.Error(),
+		})
+	}
+
+	filename := fmt.Sprintf("usage-%s-%s.csv", from.Format("20060102"), to.Add(-time.Second).Format("20060102"))
+	streamUsageCSV(c, filename, usageLogPage(pool, partner.PartnerID, from, to))
+	return nil
+}
+
+// streamUsageCSV sends the pages of fetch as a CSV attachment
+// The body is written after the handler returns, when the request's deadline
+// has been canceled: the export keeps the request's values (request ID,
+// partner) and gives each page its own deadline, for the queries and for the
+// connection. A client that goes away fails the next write, which stops the
+// export; a server shutdown stops it too
+func streamUsageCSV(c *fiber.Ctx, filename string, fetch usagePage) {
+	ctx := context.WithoutCancel(c.UserContext())
+	server := c.Context()
+	conn := server.Conn()
+
+	paged := func(ctx context.Context, after *usageCursor) ([]usageRow, error) {
+		if conn != nil {
+			if err := conn.SetWriteDeadline(time.Now().Add(usageExportPageTimeout)); err != nil {
+				return nil, err
+			}
+		}
+		ctx, cancel := context.WithTimeout(ctx, usageExportPageTimeout)
+		defer cancel()
+		return fetch(ctx, after)
+	}
+
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+	server.SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stop := context.AfterFunc(server, cancel)
+		defer stop()
+
+		// The status is already sent: a failure can only cut the file short
+		if err := writeUsageCSV(ctx, w, paged); err != nil {
+			logger.ErrorContext(ctx, "Usage export stopped", "file", filename, "error", err)
+		}
+	})
+}
+
+// usageExportRange resolves the from/to parameters into [from, to)
+func usageExportRange(fromParam, toParam string, now time.Time) (from, to time.Time, err error) {
+	to = now
+	if toParam != "" {
+		if to, err = parseExportTime(toParam, true); err != nil {
+			return from, to, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	from = to.AddDate(0, 0, -7)
+	if fromParam != "" {
+		if from, err = parseExportTime(fromParam, false); err != nil {
+			return from, to, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from must be before to")
+	}
+	if to.Sub(from) > maxUsageExportDays*24*time.Hour {
+		return from, to, fmt.Errorf("the range must be at most %d days; export longer periods in parts", maxUsageExportDays)
+	}
+	return from, to, nil
+}
+
+// parseExportTime parses a date or an RFC 3339 time; a date ending a range
+// includes that whole day
+func parseExportTime(value string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.In(time.Local), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("use YYYY-MM-DD or an RFC 3339 time")
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// usageLogPage reads a partner's usage_log in (timestamp, id) order, each page
+// starting after the previous one so no connection is held between pages
+func usageLogPage(pool *pgxpool.Pool, partnerID string, from, to time.Time) usagePage {
+	return func(ctx context.Context, after *usageCursor) ([]usageRow, error) {
+		cursor := usageCursor{Timestamp: from, ID: 0}
+		if after != nil {
+			cursor = *after
+		}
+
+		rows, err := pool.Query(ctx, `
+			SELECT id, timestamp, COALESCE(request_id, ''), api_key_id::text, method, endpoint,
+				response_status, response_time_ms, COALESCE(cache_hit, false),
+				COALESCE(host(ip_address), ''), COALESCE(user_agent, ''), sandbox
+			FROM usage_log
+			WHERE partner_id = $1
+				AND timestamp >= $2
+				AND timestamp < $3
+				AND (timestamp, id) > ($4, $5)
+			ORDER BY timestamp, id
+			LIMIT $6
+		`, partnerID, from, to, cursor.Timestamp, cursor.ID, usageExportPageSize)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		page := make([]usageRow, 0, usageExportPageSize)
+		for rows.Next() {
+			var r usageRow
+			if err := rows.Scan(&r.ID, &r.Timestamp, &r.RequestID, &r.APIKeyID, &r.Method, &r.Endpoint,
+				&r.ResponseStatus, &r.ResponseTimeMs, &r.CacheHit, &r.IPAddress, &r.UserAgent, &r.Sandbox); err != nil {
+				return nil, err
+			}
+			// usage_log stores the server's wall-clock time without a zone
+			ts := r.Timestamp
+			r.Timestamp = time.Date(ts.Year(), ts.Month(), ts.Day(), ts.Hour(), ts.Minute(), ts.Second(), ts.Nanosecond(), time.Local)
+			page = append(page, r)
+		}
+		return page, rows.Err()
+	}
+}
+
+// writeUsageCSV writes the header, then page after page until a short page,
+// flushing each so the client receives the file as it is read
+func writeUsageCSV(ctx context.Context, w io.Writer, fetch usagePage) error {
+	if _, err := io.WriteString(w, utf8BOM); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(usageCSVHeader); err != nil {
+		return err
+	}
+
+	var after *usageCursor
+	for {
+		page, err := fetch(ctx, after)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range page {
+			if err := cw.Write([]string{
+				r.Timestamp.Format(time.RFC3339), r.RequestID, r.APIKeyID, r.Method, r.Endpoint,
+				strconv.Itoa(r.ResponseStatus), strconv.Itoa(r.ResponseTimeMs), strconv.FormatBool(r.CacheHit),
+				r.IPAddress, r.UserAgent, strconv.FormatBool(r.Sandbox),
+			}); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+		if f, ok := w.(interface{ Flush() error }); ok {
+			if err := f.Flush(); err != nil {
+				return err
+			}
+		}
+
+		if len(page) < usageExportPageSize {
+			return nil
+		}
+		last := page[len(page)-1]
+		after = &usageCursor{Timestamp: last.Timestamp, ID: last.ID}
+	}
+}
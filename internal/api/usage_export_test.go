@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteUsageCSVPages(t *testing.T) {
+	start := time.Date(2026, time.September, 1, 8, 0, 0, 0, time.UTC)
+	total := usageExportPageSize + 3
+
+	var cursors []*usageCursor
+	fetch := func(ctx context.Context, after *usageCursor) ([]usageRow, error) {
+		cursors = append(cursors, after)
+		first := 0
+		if after != nil {
+			first = int(after.ID)
+		}
+		var page []usageRow
+		for id := first + 1; id <= total && len(page) < usageExportPageSize; id++ {
+			page = append(page, usageRow{
+				ID: int64(id), Timestamp: start.Add(time.Duration(id) * time.Second),
+				Method: "GET", Endpoint: "/v2/route-search", ResponseStatus: 200, UserAgent: "app, v2",
+			})
+		}
+		return page, nil
+	}
+
+	var buf bytes.Buffer
+	err := writeUsageCSV(context.Background(), &buf, fetch)
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(strings.TrimPrefix(buf.String(), utf8BOM)), "\n")
+	assert.Len(t, lines, total+1)
+	assert.Equal(t, strings.Join(usageCSVHeader, ","), lines[0])
+	assert.Equal(t, `2026-09-01T08:00:01Z,,,GET,/v2/route-search,200,0,false,,"app, v2",false`, lines[1])
+
+	// The second page starts after the last row of the first
+	if assert.Len(t, cursors, 2) {
+		assert.Nil(t, cursors[0])
+		assert.Equal(t, int64(usageExportPageSize), cursors[1].ID)
+	}
+}
+
+func TestWriteUsageCSVError(t *testing.T) {
+	fetch := func(ctx context.Context, after *usageCursor) ([]usageRow, error) {
+		return nil, errors.New("connection lost")
+	}
+
+	var buf bytes.Buffer
+	assert.Error(t, writeUsageCSV(context.Background(), &buf, fetch))
+}
+
+func TestStreamUsageCSVOutlastsWriteTimeout(t *testing.T) {
+	// Pages read slower than the server's WriteTimeout, as a 92-day export does
+	const writeTimeout = 200 * time.Millisecond
+	const pages = 4
+	start := time.Date(2026, time.September, 1, 8, 0, 0, 0, time.UTC)
+	fetch := func(ctx context.Context, after *usageCursor) ([]usageRow, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			return nil, errors.New("page without a deadline")
+		}
+		time.Sleep(writeTimeout / 2)
+		first := int64(0)
+		if after != nil {
+			first = after.ID
+		}
+		size := usageExportPageSize
+		if first == int64((pages-1)*usageExportPageSize) {
+			size = 10
+		}
+		page := make([]usageRow, size)
+		for i := range page {
+			id := first + int64(i) + 1
+			page[i] = usageRow{ID: id, Timestamp: start.Add(time.Duration(id) * time.Second), Method: "GET"}
+		}
+		return page, nil
+	}
+
+	app := fiber.New(fiber.Config{WriteTimeout: writeTimeout, DisableStartupMessage: true})
+	app.Get("/export", func(c *fiber.Ctx) error {
+		// A canceled request deadline must not stop the stream
+		ctx, cancel := context.WithCancel(context.Background())
+		c.SetUserContext(ctx)
+		defer cancel()
+		streamUsageCSV(c, "usage.csv", fetch)
+		return nil
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/export")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, `attachment; filename="usage.csv"`, resp.Header.Get("Content-Disposition"))
+
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	assert.Len(t, lines, (pages-1)*usageExportPageSize+10+1)
+}
+
+func TestUsageExportRange(t *testing.T) {
+	now := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.Local)
+
+	from, to, err := usageExportRange("", "", now)
+	assert.NoError(t, err)
+	assert.Equal(t, now, to)
+	assert.Equal(t, now.AddDate(0, 0, -7), from)
+
+	// A date ending the range includes that day
+	from, to, err = usageExportRange("2026-09-01", "2026-09-30", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, time.September, 1, 0, 0, 0, 0, time.Local), from)
+	assert.Equal(t, time.Date(2026, time.October, 1, 0, 0, 0, 0, time.Local), to)
+
+	_, _, err = usageExportRange("2026-09-30", "2026-09-01", now)
+	assert.Error(t, err)
+	_, _, err = usageExportRange("2026-01-01", "2026-09-01", now)
+	assert.Error(t, err)
+	_, _, err = usageExportRange("yesterday", "", now)
+	assert.Error(t, err)
+}
@@ -0,0 +1,486 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/middleware"
+	"github.com/passbi/passbi_core/internal/repository"
+)
+
+// HeaderUserID carries the partner's opaque identifier of the app user
+const HeaderUserID = "X-User-ID"
+
+// maxUserRefLength bounds X-User-ID; partners usually send a UUID or hash
+const maxUserRefLength = 128
+
+// maxFavorites caps each favorites list per user
+const maxFavorites = 100
+
+// placeKinds are the saved places an app user can set
+var placeKinds = map[string]bool{"home": true, "work": true}
+
+// SavedPlace is a saved home or work location
+type SavedPlace struct {
+	Kind      string    `json:"kind"`
+	Label     string    `json:"label,omitempty"`
+	Lat       float64   `json:"lat"`
+	Lon       float64   `json:"lon"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// FavoriteStop is a stop saved by an app user
+type FavoriteStop struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Lat     float64   `json:"lat"`
+	Lon     float64   `json:"lon"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// FavoriteRoute is a line saved by an app user
+type FavoriteRoute struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Mode     string    `json:"mode"`
+	AgencyID string    `json:"agency_id"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
+// UserDataResponse is everything saved for one app user
+type UserDataResponse struct {
+	UserID string          `json:"user_id"`
+	Places []SavedPlace    `json:"places"`
+	Stops  []FavoriteStop  `json:"stops"`
+	Routes []FavoriteRoute `json:"routes"`
+}
+
+// PlaceRequest is the body of PUT /v2/me/places/:kind
+type PlaceRequest struct {
+	Label string   `json:"label"`
+	Lat   *float64 `json:"lat"`
+	Lon   *float64 `json:"lon"`
+}
+
+// userScope is the partner and app user that own the saved data
+type userScope struct {
+	PartnerID string
+	UserRef   string
+}
+
+// favoriteTable describes a favorites list; both lists share their handlers
+type favoriteTable struct {
+	table    string // user_favorite_stop or user_favorite_route
+	column   string // stop_id or route_id
+	exists   func(context.Context, repository.Querier, string) (bool, error)
+	notFound string // error code when it does not
+}
+
+var (
+	favoriteStops = favoriteTable{
+		table:    "user_favorite_stop",
+		column:   "stop_id",
+		exists:   repository.StopExists,
+		notFound: "stop_not_found",
+	}
+	favoriteRoutes = favoriteTable{
+		table:    "user_favorite_route",
+		column:   "route_id",
+		exists:   repository.RouteExists,
+		notFound: "route_not_found",
+	}
+)
+
+// resolveUser reads the authenticated partner and the X-User-ID header
+// Returns false and the already-written error response when either is missing
+func resolveUser(c *fiber.Ctx) (userScope, bool, error) {
+	partner, ok := c.Locals("partner").(*middleware.PartnerContext)
+	if !ok {
+		return userScope{}, false, c.Status(401).JSON(fiber.Map{
+			"error":   "unauthorized",
+			"message": "User data requires an API key",
+		})
+	}
+
+	ref := strings.TrimSpace(c.Get(HeaderUserID))
+	if err := validateUserRef(ref); err != nil {
+		return userScope{}, false, c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_user",
+			"message": err.Error(),
+		})
+	}
+
+	return userScope{PartnerID: partner.PartnerID, UserRef: ref}, true, nil
+}
+
+// validateUserRef checks the X-User-ID header value
+func validateUserRef(ref string) error {
+	if ref == "" {
+		return fmt.Errorf("%s header is required", HeaderUserID)
+	}
+	if len(ref) > maxUserRefLength {
+		return fmt.Errorf("%s must be at most %d characters", HeaderUserID, maxUserRefLength)
+	}
+	for _, r := range ref {
+		if r < 0x21 || r > 0x7e {
+			return fmt.Errorf("%s must be printable ASCII without spaces", HeaderUserID)
+		}
+	}
+	return nil
+}
+
+// GetUserData handles GET /v2/me
+// Returns the saved places and favorites of the app user in X-User-ID
+func GetUserData(c *fiber.Ctx) error {
+	user, ok, err := resolveUser(c)
+	if !ok {
+		return err
+	}
+	pool := c.Locals("db").(*pgxpool.Pool)
+	ctx := c.UserContext()
+
+	resp := UserDataResponse{UserID: user.UserRef}
+
+	resp.Places, err = loadPlaces(ctx, pool, user)
+	if err == nil {
+		resp.Stops, err = loadFavoriteStops(ctx, pool, user)
+	}
+	if err == nil {
+		resp.Routes, err = loadFavoriteRoutes(ctx, pool, user)
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to load user data", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to load saved data",
+		})
+	}
+
+	// Favorites show names in the rider's language like the public endpoints
+	lang := requestLang(c)
+	stopIDs := make([]string, 0, len(resp.Stops))
+	for _, s := range resp.Stops {
+		stopIDs = append(stopIDs, s.ID)
+	}
+	routeIDs := make([]string, 0, len(resp.Routes))
+	for _, r := range resp.Routes {
+		routeIDs = append(routeIDs, r.ID)
+	}
+	names := loadNames(ctx, lang, stopIDs, routeIDs)
+	for i := range resp.Stops {
+		resp.Stops[i].Name = names.Stop(resp.Stops[i].ID, resp.Stops[i].Name)
+	}
+	for i := range resp.Routes {
+		resp.Routes[i].Name = names.Route(resp.Routes[i].ID, resp.Routes[i].Name)
+	}
+
+	return c.JSON(resp)
+}
+
+// DeleteUserData handles DELETE /v2/me
+// Erases everything saved for the app user, e.g. when they delete their account
+func DeleteUserData(c *fiber.Ctx) error {
+	user, ok, err := resolveUser(c)
+	if !ok {
+		return err
+	}
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	err = pgx.BeginFunc(c.UserContext(), pool, func(tx pgx.Tx) error {
+		for _, table := range []string{"user_place", "user_favorite_stop", "user_favorite_route"} {
+			if _, err := tx.Exec(c.UserContext(),
+				`DELETE FROM `+table+` WHERE partner_id = $1 AND user_ref = $2`,
+				user.PartnerID, user.UserRef); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to delete user data", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to delete saved data",
+		})
+	}
+
+	return c.SendStatus(204)
+}
+
+// PutUserPlace handles PUT /v2/me/places/:kind (kind = home or work)
+func PutUserPlace(c *fiber.Ctx) error {
+	user, ok, err := resolveUser(c)
+	if !ok {
+		return err
+	}
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	kind := c.Params("kind")
+	if !placeKinds[kind] {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "not_found",
+			"message": "Place must be home or work",
+		})
+	}
+
+	var req PlaceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "invalid_request",
+			"message": "Invalid request body",
+		})
+	}
+	if req.Lat == nil || req.Lon == nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": "lat and lon are required",
+		})
+	}
+	if *req.Lat < -90 || *req.Lat > 90 || *req.Lon < -180 || *req.Lon > 180 {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "validation_error",
+			"message": "lat must be between -90 and 90 and lon between -180 and 180",
+		})
+	}
+
+	place := SavedPlace{Kind: kind, Label: strings.TrimSpace(req.Label), Lat: *req.Lat, Lon: *req.Lon}
+	err = pool.QueryRow(c.UserContext(), `
+		INSERT INTO user_place (partner_id, user_ref, kind, label, lat, lon)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)
+		ON CONFLICT (partner_id, user_ref, kind) DO UPDATE SET
+			label = EXCLUDED.label, lat = EXCLUDED.lat, lon = EXCLUDED.lon, updated_at = NOW()
+		RETURNING updated_at
+	`, user.PartnerID, user.UserRef, kind, place.Label, place.Lat, place.Lon).Scan(&place.UpdatedAt)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to save place", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to save place",
+		})
+	}
+
+	return c.JSON(place)
+}
+
+// DeleteUserPlace handles DELETE /v2/me/places/:kind
+func DeleteUserPlace(c *fiber.Ctx) error {
+	user, ok, err := resolveUser(c)
+	if !ok {
+		return err
+	}
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	tag, err := pool.Exec(c.UserContext(),
+		`DELETE FROM user_place WHERE partner_id = $1 AND user_ref = $2 AND kind = $3`,
+		user.PartnerID, user.UserRef, c.Params("kind"))
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to delete place", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to delete place",
+		})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "not_found",
+			"message": "Place not saved",
+		})
+	}
+
+	return c.SendStatus(204)
+}
+
+// PutFavoriteStop handles PUT /v2/me/stops/:id
+func PutFavoriteStop(c *fiber.Ctx) error {
+	return putFavorite(c, favoriteStops)
+}
+
+// DeleteFavoriteStop handles DELETE /v2/me/stops/:id
+func DeleteFavoriteStop(c *fiber.Ctx) error {
+	return deleteFavorite(c, favoriteStops)
+}
+
+// PutFavoriteRoute handles PUT /v2/me/routes/:id
+func PutFavoriteRoute(c *fiber.Ctx) error {
+	return putFavorite(c, favoriteRoutes)
+}
+
+// DeleteFavoriteRoute handles DELETE /v2/me/routes/:id
+func DeleteFavoriteRoute(c *fiber.Ctx) error {
+	return deleteFavorite(c, favoriteRoutes)
+}
+
+// errFavoritesFull is returned when a list already holds maxFavorites entries
+var errFavoritesFull = errors.New("favorites limit reached")
+
+// putFavorite adds an entity to a favorites list; adding it twice is a no-op
+func putFavorite(c *fiber.Ctx, fav favoriteTable) error {
+	user, ok, err := resolveUser(c)
+	if !ok {
+		return err
+	}
+	pool := c.Locals("db").(*pgxpool.Pool)
+	ctx := c.UserContext()
+	id := c.Params("id")
+
+	exists, err := fav.exists(ctx, pool, id)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to look up favorite", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to save favorite",
+		})
+	}
+	if !exists {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   fav.notFound,
+			"message": fmt.Sprintf("Unknown %s %q", strings.TrimSuffix(fav.column, "_id"), id),
+		})
+	}
+
+	err = pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		// Lock the user's list so concurrent adds cannot overshoot the cap
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1::text || ':' || $2::text))`,
+			user.PartnerID, user.UserRef); err != nil {
+			return err
+		}
+
+		var count int
+		if err := tx.QueryRow(ctx,
+			`SELECT COUNT(*) FROM `+fav.table+` WHERE partner_id = $1 AND user_ref = $2 AND `+fav.column+` <> $3`,
+			user.PartnerID, user.UserRef, id).Scan(&count); err != nil {
+			return err
+		}
+		if count >= maxFavorites {
+			return errFavoritesFull
+		}
+
+		_, err := tx.Exec(ctx,
+			`INSERT INTO `+fav.table+` (partner_id, user_ref, `+fav.column+`) VALUES ($1, $2, $3)
+			 ON CONFLICT DO NOTHING`,
+			user.PartnerID, user.UserRef, id)
+		return err
+	})
+	if errors.Is(err, errFavoritesFull) {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "limit_exceeded",
+			"message": fmt.Sprintf("A user can save at most %d favorites of each kind", maxFavorites),
+		})
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to save favorite", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to save favorite",
+		})
+	}
+
+	return c.SendStatus(204)
+}
+
+// deleteFavorite removes an entity from a favorites list
+func deleteFavorite(c *fiber.Ctx, fav favoriteTable) error {
+	user, ok, err := resolveUser(c)
+	if !ok {
+		return err
+	}
+	pool := c.Locals("db").(*pgxpool.Pool)
+
+	tag, err := pool.Exec(c.UserContext(),
+		`DELETE FROM `+fav.table+` WHERE partner_id = $1 AND user_ref = $2 AND `+fav.column+` = $3`,
+		user.PartnerID, user.UserRef, c.Params("id"))
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to delete favorite", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to delete favorite",
+		})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "not_found",
+			"message": "Favorite not saved",
+		})
+	}
+
+	return c.SendStatus(204)
+}
+
+func loadPlaces(ctx context.Context, pool *pgxpool.Pool, user userScope) ([]SavedPlace, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT kind, COALESCE(label, ''), lat, lon, updated_at
+		FROM user_place
+		WHERE partner_id = $1 AND user_ref = $2
+		ORDER BY kind
+	`, user.PartnerID, user.UserRef)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	places := []SavedPlace{}
+	for rows.Next() {
+		var p SavedPlace
+		if err := rows.Scan(&p.Kind, &p.Label, &p.Lat, &p.Lon, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		places = append(places, p)
+	}
+	return places, rows.Err()
+}
+
+// loadFavoriteStops skips favorites whose stop disappeared in a re-import
+func loadFavoriteStops(ctx context.Context, pool *pgxpool.Pool, user userScope) ([]FavoriteStop, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT s.id, s.name, s.lat, s.lon, f.created_at
+		FROM user_favorite_stop f
+		JOIN stop s ON s.id = f.stop_id
+		WHERE f.partner_id = $1 AND f.user_ref = $2
+		ORDER BY f.created_at
+	`, user.PartnerID, user.UserRef)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stops := []FavoriteStop{}
+	for rows.Next() {
+		var s FavoriteStop
+		if err := rows.Scan(&s.ID, &s.Name, &s.Lat, &s.Lon, &s.AddedAt); err != nil {
+			return nil, err
+		}
+		stops = append(stops, s)
+	}
+	return stops, rows.Err()
+}
+
+// loadFavoriteRoutes skips favorites whose route disappeared in a re-import
+func loadFavoriteRoutes(ctx context.Context, pool *pgxpool.Pool, user userScope) ([]FavoriteRoute, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT r.id, COALESCE(r.short_name, r.long_name, r.id), r.mode, r.agency_id, f.created_at
+		FROM user_favorite_route f
+		JOIN route r ON r.id = f.route_id
+		WHERE f.partner_id = $1 AND f.user_ref = $2
+		ORDER BY f.created_at
+	`, user.PartnerID, user.UserRef)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	routes := []FavoriteRoute{}
+	for rows.Next() {
+		var r FavoriteRoute
+		if err := rows.Scan(&r.ID, &r.Name, &r.Mode, &r.AgencyID, &r.AddedAt); err != nil {
+			return nil, err
+		}
+		routes = append(routes, r)
+	}
+	return routes, rows.Err()
+}
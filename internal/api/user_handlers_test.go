@@ -0,0 +1,18 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateUserRef(t *testing.T) {
+	assert.NoError(t, validateUserRef("3f2b9c1e-7a4d-4f7e-9b1a-2c8d5e6f7a8b"))
+	assert.NoError(t, validateUserRef("device:ab12"))
+
+	assert.Error(t, validateUserRef(""))
+	assert.Error(t, validateUserRef("user 42"))
+	assert.Error(t, validateUserRef("utilisé"))
+	assert.Error(t, validateUserRef(strings.Repeat("a", maxUserRefLength+1)))
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// API v3 differs from v2 only in its response format:
+//   - successful responses are wrapped as {"data": ..., "meta": {...}}
+//   - errors are RFC 7807 problem details (application/problem+json)
+//   - collections page with opaque cursors instead of offsets
+// Handlers are shared with v2; V3Envelope rewrites their responses
+
+// MIMEProblemJSON is the media type of RFC 7807 problem details
+const MIMEProblemJSON = "application/problem+json"
+
+// v3MetaKey is the Locals key handlers use to attach envelope meta
+const v3MetaKey = "v3_meta"
+
+// Envelope is the body of every successful v3 response
+type Envelope struct {
+	Data json.RawMessage `json:"data"`
+	Meta *PageMeta       `json:"meta,omitempty"`
+}
+
+// PageMeta describes a page of a cursor-paginated collection
+// NextCursor is empty on the last page
+type PageMeta struct {
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      *int   `json:"total,omitempty"`
+}
+
+// Problem is an RFC 7807 problem details object
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// V3Envelope converts responses of the handlers it wraps to the v3 format
+// It must run before authentication so their errors are converted too
+func V3Envelope(c *fiber.Ctx) error {
+	if err := c.Next(); err != nil {
+		var fe *fiber.Error
+		if errors.As(err, &fe) {
+			return sendProblem(c, fe.Code, fe.Message)
+		}
+		logger.ErrorContext(c.Context(), "Error", "error", err)
+		return sendProblem(c, fiber.StatusInternalServerError, "internal server error")
+	}
+
+	resp := c.Response()
+	status := resp.StatusCode()
+	if status == fiber.StatusNotModified || status == fiber.StatusNoContent ||
+		!strings.HasPrefix(string(resp.Header.ContentType()), fiber.MIMEApplicationJSON) {
+		return nil
+	}
+
+	if status >= 400 {
+		var body struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(resp.Body(), &body)
+
+		detail := body.Message
+		if detail == "" {
+			detail = body.Error
+		}
+		return sendProblem(c, status, detail)
+	}
+
+	env := Envelope{Data: append(json.RawMessage(nil), resp.Body()...)}
+	if meta, ok := c.Locals(v3MetaKey).(*PageMeta); ok {
+		env.Meta = meta
+	}
+	return c.JSON(env)
+}
+
+// sendProblem writes an RFC 7807 response for the current request
+func sendProblem(c *fiber.Ctx, status int, detail string) error {
+	body, err := json.Marshal(Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: c.Path(),
+	})
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderContentType, MIMEProblemJSON)
+	return c.Status(status).Send(body)
+}
+
+// encodeCursor makes an opaque page cursor from the last key of a page
+func encodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+// decodeCursor returns the key a cursor was made from; empty means first page
+func decodeCursor(cursor string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(key) == 0 {
+		return "", errors.New("invalid cursor")
+	}
+	return string(key), nil
+}
+
+// pageLimit parses a page size, falling back to def and capping at max
+func pageLimit(value string, def, max int) int {
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return def
+	}
+	if limit > max {
+		return max
+	}
+	return limit
+}
+
+// RoutesListV3 handles GET /v3/routes?mode=BUS&agency=ID&limit=100&cursor=...
+func RoutesListV3(c *fiber.Ctx) error {
+	after, err := decodeCursor(c.Query("cursor"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	limit := pageLimit(c.Query("limit"), 100, 1000)
+
+	// One extra row tells whether another page follows
+	routes, err := listRoutes(c.UserContext(), routesQuery{
+		Mode:     c.Query("mode"),
+		Agency:   c.Query("agency"),
+		Agencies: keyAgencies(c),
+		After:    after,
+		Limit:    limit + 1,
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	meta := &PageMeta{Limit: limit}
+	if len(routes) > limit {
+		routes = routes[:limit]
+		meta.NextCursor = encodeCursor(routes[limit-1].ID)
+	}
+
+	localizeRouteList(c.UserContext(), requestLang(c), routes)
+
+	c.Locals(v3MetaKey, meta)
+	return sendFields(c, routes)
+}
+
+// tripsPage is the data of a v3 trips page
+type tripsPage struct {
+	Route RouteBasic   `json:"route"`
+	Trips []TripDetail `json:"trips" fields:"items"`
+}
+
+// RouteTripsV3 handles GET /v3/routes/:id/trips?service=ID&direction=0&limit=20&cursor=...
+func RouteTripsV3(c *fiber.Ctx) error {
+	after, err := decodeCursor(c.Query("cursor"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	limit := pageLimit(c.Query("limit"), 20, 100)
+
+	if routeHidden(c.UserContext(), keyAgencies(c), c.Params("id")) {
+		return c.Status(404).JSON(fiber.Map{"error": "route not found"})
+	}
+
+	resp, err := listTrips(c.UserContext(), c.Params("id"), tripsQuery{
+		Service:   c.Query("service"),
+		Direction: c.Query("direction"),
+		After:     after,
+		Limit:     limit + 1,
+	})
+	if errors.Is(err, errRouteNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "route not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	meta := &PageMeta{Limit: limit, Total: &resp.Total}
+	if len(resp.Trips) > limit {
+		resp.Trips = resp.Trips[:limit]
+		meta.NextCursor = encodeCursor(resp.Trips[limit-1].TripID)
+	}
+
+	localizeTrips(c.UserContext(), requestLang(c), &resp.Route, resp.Trips)
+
+	c.Locals(v3MetaKey, meta)
+	return sendFields(c, tripsPage{
+		Route: resp.Route,
+		Trips: resp.Trips,
+	})
+}
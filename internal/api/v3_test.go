@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func newV3TestApp() *fiber.App {
+	app := fiber.New()
+	v3 := app.Group("/v3", V3Envelope)
+	v3.Get("/ok", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"stops": []string{"S1"}})
+	})
+	v3.Get("/page", func(c *fiber.Ctx) error {
+		c.Locals(v3MetaKey, &PageMeta{Limit: 1, NextCursor: encodeCursor("R1")})
+		return c.JSON([]string{"R1"})
+	})
+	v3.Get("/missing", func(c *fiber.Ctx) error {
+		return c.Status(404).JSON(fiber.Map{"error": "stop not found"})
+	})
+	v3.Get("/fails", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "graph not loaded")
+	})
+	return app
+}
+
+func TestV3EnvelopeWrapsData(t *testing.T) {
+	resp, err := newV3TestApp().Test(httptest.NewRequest("GET", "/v3/ok", nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	body, _ := io.ReadAll(resp.Body)
+
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.JSONEq(t, `{"data":{"stops":["S1"]}}`, string(body))
+}
+
+func TestV3EnvelopeAddsPageMeta(t *testing.T) {
+	resp, err := newV3TestApp().Test(httptest.NewRequest("GET", "/v3/page", nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var env struct {
+		Data []string `json:"data"`
+		Meta PageMeta `json:"meta"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&env))
+	assert.Equal(t, []string{"R1"}, env.Data)
+	assert.Equal(t, 1, env.Meta.Limit)
+
+	after, err := decodeCursor(env.Meta.NextCursor)
+	assert.NoError(t, err)
+	assert.Equal(t, "R1", after)
+}
+
+func TestV3EnvelopeProblemDetails(t *testing.T) {
+	tests := []struct {
+		path   string
+		status int
+		detail string
+	}{
+		{"/v3/missing", 404, "stop not found"},
+		{"/v3/fails", 503, "graph not loaded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := newV3TestApp().Test(httptest.NewRequest("GET", tt.path, nil))
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			var p Problem
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&p))
+			assert.Equal(t, tt.status, resp.StatusCode)
+			assert.Equal(t, MIMEProblemJSON, resp.Header.Get("Content-Type"))
+			assert.Equal(t, tt.status, p.Status)
+			assert.Equal(t, tt.detail, p.Detail)
+			assert.Equal(t, tt.path, p.Instance)
+			assert.Equal(t, "about:blank", p.Type)
+		})
+	}
+}
+
+func TestDecodeCursorRejectsGarbage(t *testing.T) {
+	_, err := decodeCursor("!!!")
+	assert.Error(t, err)
+
+	after, err := decodeCursor("")
+	assert.NoError(t, err)
+	assert.Empty(t, after)
+}
@@ -0,0 +1,411 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/passbi/passbi_core/internal/cache"
+	"github.com/passbi/passbi_core/internal/db"
+	"github.com/passbi/passbi_core/internal/middleware"
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/passbi/passbi_core/internal/realtime"
+	"github.com/passbi/passbi_core/internal/repository"
+	"github.com/passbi/passbi_core/internal/routing"
+	"github.com/passbi/passbi_core/internal/vehicles"
+)
+
+var (
+	vehicleConfigOnce sync.Once
+	vehicleConfig     vehicles.Config
+)
+
+// vehiclesConfig returns the position lifetimes, from VEHICLE_POSITION_*
+func vehiclesConfig() vehicles.Config {
+	vehicleConfigOnce.Do(func() {
+		vehicleConfig = vehicles.ConfigFromEnv()
+	})
+	return vehicleConfig
+}
+
+// VehiclePositionsRequest is the batch body of POST /v2/vehicles/positions;
+// a single fix may also be posted on its own
+type VehiclePositionsRequest struct {
+	Positions []models.VehiclePosition `json:"positions"`
+}
+
+// PushVehiclePositions handles POST /v2/vehicles/positions
+// Operator systems and the driver app push GPS fixes, one or a batch; a key
+// restricted to agencies may only push their vehicles, and agency_id
+// defaults to the key's agency when it has a single one
+// The whole batch is refused when a fix is invalid, naming its index
+func PushVehiclePositions(c *fiber.Ctx) error {
+	var req VehiclePositionsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	if req.Positions == nil {
+		var single models.VehiclePosition
+		if err := c.BodyParser(&single); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid request body"})
+		}
+		req.Positions = []models.VehiclePosition{single}
+	}
+
+	cfg := vehiclesConfig()
+	if len(req.Positions) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "positions must not be empty"})
+	}
+	if len(req.Positions) > cfg.MaxBatch {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("at most %d positions per request", cfg.MaxBatch)})
+	}
+
+	agencies := keyAgencies(c)
+	now := time.Now()
+	for i := range req.Positions {
+		p := &req.Positions[i]
+		if p.AgencyID == "" && len(agencies) == 1 {
+			p.AgencyID = agencies[0]
+		}
+		if err := cfg.Normalize(p, now); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("positions[%d]: %s", i, err), "index": i})
+		}
+		if !agencyAllowed(agencies, p.AgencyID) {
+			return c.Status(403).JSON(fiber.Map{"error": fmt.Sprintf("positions[%d]: this API key cannot push positions for agency %s", i, p.AgencyID), "index": i})
+		}
+	}
+
+	pool, err := db.GetDB()
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Database error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	var partnerID string
+	if partner, ok := c.Locals("partner").(*middleware.PartnerContext); ok {
+		partnerID = partner.PartnerID
+	}
+
+	result, err := vehicles.Store(c.UserContext(), pool, liveRedis(c), cfg, partnerID, req.Positions)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Failed to store vehicle positions", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	return c.Status(202).JSON(fiber.Map{
+		"received": len(req.Positions),
+		"stored":   result.Stored,
+		"live":     result.Live,
+	})
+}
+
+// liveRedis returns the client holding live vehicle positions, nil when
+// Redis is unavailable
+func liveRedis(c *fiber.Ctx) *redis.Client {
+	if rdb, ok := c.Locals("redis").(*redis.Client); ok && rdb != nil {
+		return rdb
+	}
+	rdb, err := cache.GetClient()
+	if err != nil {
+		return nil
+	}
+	return rdb
+}
+
+// Sources of a route vehicle's position
+const (
+	SourceGPS      = "gps"      // a fix pushed by the vehicle
+	SourceRealtime = "realtime" // the schedule shifted by a realtime trip update
+	SourceSchedule = "schedule" // the static schedule
+)
+
+// RouteVehicle is the current position of a vehicle on a route
+type RouteVehicle struct {
+	VehicleID string    `json:"vehicle_id,omitempty"`
+	TripID    string    `json:"trip_id,omitempty"`
+	AgencyID  string    `json:"agency_id"`
+	Lat       float64   `json:"lat"`
+	Lon       float64   `json:"lon"`
+	Bearing   *float64  `json:"bearing,omitempty"` // degrees clockwise from north
+	Speed     *float64  `json:"speed,omitempty"`   // meters per second
+	StopID    string    `json:"stop_id,omitempty"` // current or next stop
+	Estimated bool      `json:"estimated"`
+	Source    string    `json:"source"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// AgeSeconds is how old the fix or trip update behind the position is;
+	// 0 for schedule estimates
+	AgeSeconds int `json:"age_seconds"`
+}
+
+// RouteVehiclesResponse lists the vehicles currently on a route
+type RouteVehiclesResponse struct {
+	Route     RouteBasic     `json:"route"`
+	Vehicles  []RouteVehicle `json:"vehicles" fields:"items"`
+	Total     int            `json:"total"`
+	Timestamp time.Time      `json:"timestamp"`
+}
+
+// RouteVehicles handles GET /v2/routes/:id/vehicles?estimated=true
+// Vehicles pushing GPS fixes are listed where they are; trips in service
+// without one are placed along their stop times by the
+// VehiclePositionEstimator, shifted by their realtime delay when there is
+// one (estimated=false leaves them out)
+func RouteVehicles(c *fiber.Ctx) error {
+	routeID := c.Params("id")
+	if routeID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "route ID is required"})
+	}
+	agencies := keyAgencies(c)
+	ctx := c.UserContext()
+	if routeHidden(ctx, agencies, routeID) {
+		return c.Status(404).JSON(fiber.Map{"error": "route not found"})
+	}
+
+	pool, err := db.ReadDB()
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Database error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+	route, err := repository.GetRoute(ctx, pool, routeID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "route not found"})
+	}
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Route query error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	now := time.Now().UTC()
+	cfg := vehiclesConfig()
+	positions, err := livePositions(ctx, liveRedis(c), pool, routeID, cfg.LiveTTL, now)
+	if err != nil {
+		logger.ErrorContext(c.Context(), "Vehicle positions query error", "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	}
+
+	vehicleList := []RouteVehicle{}
+	tracked := make(map[[2]string]bool)
+	for _, p := range positions {
+		if !agencyAllowed(agencies, p.AgencyID) {
+			continue
+		}
+		if p.TripID != "" {
+			tracked[[2]string{p.AgencyID, p.TripID}] = true
+		}
+		vehicleList = append(vehicleList, RouteVehicle{
+			VehicleID:  p.VehicleID,
+			TripID:     p.TripID,
+			AgencyID:   p.AgencyID,
+			Lat:        p.Lat,
+			Lon:        p.Lon,
+			Bearing:    p.Bearing,
+			Speed:      p.Speed,
+			StopID:     p.StopID,
+			Source:     SourceGPS,
+			UpdatedAt:  p.Timestamp,
+			AgeSeconds: ageSeconds(now, p.Timestamp),
+		})
+	}
+	sort.Slice(vehicleList, func(i, j int) bool { return vehicleList[i].VehicleID < vehicleList[j].VehicleID })
+
+	if c.QueryBool("estimated", true) {
+		estimated, err := estimateRouteVehicles(ctx, pool, routeID, now, tracked)
+		if err != nil {
+			// GPS positions are still worth answering with
+			logger.WarnContext(c.Context(), "Failed to estimate vehicle positions", "route_id", routeID, "error", err)
+		}
+		for _, v := range estimated {
+			if agencyAllowed(agencies, v.AgencyID) {
+				vehicleList = append(vehicleList, v)
+			}
+		}
+	}
+
+	return sendFields(c, RouteVehiclesResponse{
+		Route:     RouteBasic(*route),
+		Vehicles:  vehicleList,
+		Total:     len(vehicleList),
+		Timestamp: now,
+	})
+}
+
+// livePositions reads a route's live vehicles from Redis, or from the
+// position history when Redis is unavailable
+func livePositions(ctx context.Context, rdb *redis.Client, pool *pgxpool.Pool, routeID string, ttl time.Duration, now time.Time) ([]models.VehiclePosition, error) {
+	if rdb != nil {
+		positions, err := vehicles.Live(ctx, rdb, routeID, ttl, now)
+		if err == nil {
+			return positions, nil
+		}
+		logger.WarnContext(ctx, "Falling back to the position history", "route_id", routeID, "error", err)
+	}
+	return vehicles.Recent(ctx, pool, routeID, now.Add(-ttl))
+}
+
+// estimateRouteVehicles places the trips of a route in service at now that
+// are not in tracked along their stop times
+func estimateRouteVehicles(ctx context.Context, pool *pgxpool.Pool, routeID string, now time.Time, tracked map[[2]string]bool) ([]RouteVehicle, error) {
+	trips, err := runningTrips(ctx, pool, routeID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	byAgency := make(map[string][]string)
+	for _, t := range trips {
+		byAgency[t.AgencyID] = append(byAgency[t.AgencyID], t.TripID)
+	}
+	statuses := make(map[[2]string]realtime.TripStatus)
+	for agencyID, tripIDs := range byAgency {
+		found, err := realtime.TripStatuses(ctx, pool, agencyID, tripIDs, now)
+		if err != nil {
+			logger.WarnContext(ctx, "Failed to load trip updates", "agency_id", agencyID, "error", err)
+			continue
+		}
+		for tripID, s := range found {
+			statuses[[2]string{agencyID, tripID}] = s
+		}
+	}
+
+	estimator := routing.NewVehiclePositionEstimator(pool)
+	nowSecs := now.Hour()*3600 + now.Minute()*60 + now.Second()
+	estimated := []RouteVehicle{}
+	for _, t := range trips {
+		key := [2]string{t.AgencyID, t.TripID}
+		if tracked[key] {
+			continue
+		}
+		v := RouteVehicle{TripID: t.TripID, AgencyID: t.AgencyID, Estimated: true, Source: SourceSchedule, UpdatedAt: now}
+		elapsed := nowSecs - t.Start
+		if s, ok := statuses[key]; ok {
+			if s.Canceled {
+				continue
+			}
+			if s.Delay != nil {
+				elapsed -= *s.Delay
+				v.Source = SourceRealtime
+				v.UpdatedAt = s.UpdatedAt
+				v.AgeSeconds = ageSeconds(now, s.UpdatedAt)
+			}
+		}
+		segment := routing.Segment(t.Path, elapsed)
+		if segment < 0 || segment >= len(t.Path.Edges) {
+			continue // not departed yet, or already arrived
+		}
+
+		v.Lat, v.Lon, err = estimator.EstimatePosition(ctx, t.Path, elapsed)
+		if err != nil {
+			logger.WarnContext(ctx, "Failed to estimate vehicle position", "trip_id", t.TripID, "error", err)
+			continue
+		}
+		v.StopID = t.Path.Nodes[segment+1].StopID
+		if bearing, ok := pathBearing(t.Path, segment); ok {
+			v.Bearing = &bearing
+		}
+		estimated = append(estimated, v)
+	}
+	sort.Slice(estimated, func(i, j int) bool { return estimated[i].TripID < estimated[j].TripID })
+	return estimated, nil
+}
+
+// pathBearing is the heading of a path's edge, or of the next edge that
+// moves when the vehicle is dwelling at a stop
+func pathBearing(path *models.Path, edge int) (float64, bool) {
+	for i := edge; i < len(path.Edges); i++ {
+		from, to := path.Nodes[i], path.Nodes[i+1]
+		if from.Lat != to.Lat || from.Lon != to.Lon {
+			return routing.Bearing(from.Lat, from.Lon, to.Lat, to.Lon), true
+		}
+	}
+	return 0, false
+}
+
+// runningTrip is a trip in service with its stop times as a path
+type runningTrip struct {
+	AgencyID string
+	TripID   string
+	Start    int // departure from the first stop, in seconds since midnight
+	Path     *models.Path
+}
+
+// runningTripsSlack keeps trips scheduled to have arrived this long ago, in
+// case they run late
+const runningTripsSlack = 30 * 60
+
+// runningTrips returns the trips of a route active on now's service day
+// whose schedule spans now, give or take runningTripsSlack
+// Trips of the previous service day running past midnight are not included
+func runningTrips(ctx context.Context, pool *pgxpool.Pool, routeID string, now time.Time) ([]runningTrip, error) {
+	nowSecs := now.Hour()*3600 + now.Minute()*60 + now.Second()
+	rows, err := pool.Query(ctx, `
+		WITH `+repository.ActiveServicesCTE(now, "$2")+`,
+		running AS (
+			SELECT st.agency_id, st.trip_id
+			FROM trip t
+			JOIN active_services a ON a.service_id = t.service_id AND a.agency_id = t.agency_id
+			JOIN stop_time st ON st.agency_id = t.agency_id AND st.trip_id = t.trip_id
+			WHERE t.route_id = $1
+			GROUP BY st.agency_id, st.trip_id
+			HAVING MIN(COALESCE(st.departure_seconds, st.arrival_seconds)) <= $3
+			   AND MAX(COALESCE(st.arrival_seconds, st.departure_seconds)) >= $3 - $4
+		)
+		SELECT st.agency_id, st.trip_id, st.stop_id, s.lat, s.lon,
+			COALESCE(st.arrival_seconds, st.departure_seconds),
+			COALESCE(st.departure_seconds, st.arrival_seconds)
+		FROM running r
+		JOIN stop_time st ON st.agency_id = r.agency_id AND st.trip_id = r.trip_id
+		JOIN stop s ON s.id = st.stop_id
+		WHERE COALESCE(st.arrival_seconds, st.departure_seconds) IS NOT NULL
+		ORDER BY st.agency_id, st.trip_id, st.stop_sequence
+	`, routeID, now, nowSecs, runningTripsSlack)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query running trips: %w", err)
+	}
+	defer rows.Close()
+
+	var trips []runningTrip
+	var current *runningTrip
+	var lastDeparture int
+	for rows.Next() {
+		var agencyID, tripID string
+		var stop models.Node
+		var arrival, departure int
+		if err := rows.Scan(&agencyID, &tripID, &stop.StopID, &stop.Lat, &stop.Lon, &arrival, &departure); err != nil {
+			return nil, err
+		}
+		if current == nil || current.AgencyID != agencyID || current.TripID != tripID {
+			trips = append(trips, runningTrip{AgencyID: agencyID, TripID: tripID, Start: departure,
+				Path: &models.Path{Nodes: []models.Node{stop}}})
+			current = &trips[len(trips)-1]
+		} else {
+			appendLeg(current.Path, stop, arrival-lastDeparture)
+			// Dwell at the stop is an edge that does not move
+			if departure > arrival {
+				appendLeg(current.Path, stop, departure-arrival)
+			}
+		}
+		lastDeparture = departure
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query running trips: %w", err)
+	}
+	return trips, nil
+}
+
+// appendLeg extends a path to stop over seconds
+func appendLeg(path *models.Path, stop models.Node, seconds int) {
+	seconds = max(seconds, 0)
+	path.Nodes = append(path.Nodes, stop)
+	path.Edges = append(path.Edges, models.Edge{Type: models.EdgeRide, CostTime: seconds})
+	path.TotalTime += seconds
+}
+
+func ageSeconds(now, at time.Time) int {
+	return max(int(now.Sub(at).Seconds()), 0)
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/passbi/passbi_core/internal/middleware"
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func pushPositions(t *testing.T, agencies []string, body string) (int, map[string]interface{}) {
+	app := fiber.New()
+	app.Post("/v2/vehicles/positions", func(c *fiber.Ctx) error {
+		c.Locals("partner", &middleware.PartnerContext{PartnerID: "p1", Agencies: agencies})
+		return c.Next()
+	}, PushVehiclePositions)
+
+	req := httptest.NewRequest("POST", "/v2/vehicles/positions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if !assert.NoError(t, err) {
+		return 0, nil
+	}
+	var out map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+func TestPushVehiclePositionsRejects(t *testing.T) {
+	status, out := pushPositions(t, nil, `{"positions":[]}`)
+	assert.Equal(t, 400, status)
+	assert.Equal(t, "positions must not be empty", out["error"])
+
+	status, out = pushPositions(t, nil, `{"positions":[
+		{"vehicle_id":"V1","route_id":"R1","agency_id":"a","lat":14.7,"lon":-17.4},
+		{"vehicle_id":"V2","route_id":"R1","agency_id":"a","lat":0,"lon":0}
+	]}`)
+	assert.Equal(t, 400, status)
+	assert.Equal(t, 1.0, out["index"])
+
+	status, _ = pushPositions(t, nil, `{"vehicle_id":"V1","route_id":"R1","lat":14.7,"lon":-17.4}`)
+	assert.Equal(t, 400, status, "agency_id is required without a single-agency key")
+
+	status, out = pushPositions(t, []string{"a"}, `{"vehicle_id":"V1","route_id":"R1","agency_id":"b","lat":14.7,"lon":-17.4}`)
+	assert.Equal(t, 403, status)
+	assert.Equal(t, 0.0, out["index"])
+}
+
+func TestAppendLegAndPathBearing(t *testing.T) {
+	a := models.Node{StopID: "A", Lat: 14.69, Lon: -17.44}
+	b := models.Node{StopID: "B", Lat: 14.70, Lon: -17.44}
+	c := models.Node{StopID: "C", Lat: 14.70, Lon: -17.43}
+
+	path := &models.Path{Nodes: []models.Node{a}}
+	appendLeg(path, b, 120)
+	appendLeg(path, b, 30) // dwell at B
+	appendLeg(path, c, -5)
+
+	assert.Equal(t, 150, path.TotalTime)
+	assert.Equal(t, 0, path.Edges[2].CostTime, "negative times from bad feeds are clamped")
+
+	bearing, ok := pathBearing(path, 0)
+	assert.True(t, ok)
+	assert.InDelta(t, 0, bearing, 0.01)
+
+	bearing, ok = pathBearing(path, 1)
+	assert.True(t, ok, "a dwelling vehicle faces its next leg")
+	assert.InDelta(t, 90, bearing, 0.1)
+
+	_, ok = pathBearing(&models.Path{Nodes: []models.Node{a, a}, Edges: []models.Edge{{CostTime: 10}}}, 0)
+	assert.False(t, ok)
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/routing"
+)
+
+const (
+	// defaultWarmPairs is how many popular searches are replayed after a reload
+	defaultWarmPairs = 100
+	// warmWindow is the search history popular pairs are taken from
+	warmWindow = 7 * 24 * time.Hour
+	// warmWorkers bounds concurrent route computations while warming, so a
+	// reload does not starve live requests
+	warmWorkers = 4
+	// warmTimeout bounds one warming run
+	warmTimeout = 10 * time.Minute
+)
+
+// odPair is a searched origin-destination pair
+type odPair struct {
+	FromLat, FromLon float64
+	ToLat, ToLon     float64
+}
+
+// WarmPairs returns how many popular pairs to warm, from CACHE_WARM_PAIRS
+// (0 disables warming)
+func WarmPairs() int {
+	if v := os.Getenv("CACHE_WARM_PAIRS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return defaultWarmPairs
+}
+
+// WarmRouteCacheAsync warms the route cache in the background
+// Call it once a graph has been (re)loaded and the data version bumped, so
+// the first searches of the morning peak hit a warm cache
+func WarmRouteCacheAsync(pool *pgxpool.Pool) {
+	limit := WarmPairs()
+	if limit == 0 {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), warmTimeout)
+		defer cancel()
+
+		start := time.Now()
+		warmed, err := WarmRouteCache(ctx, pool, limit)
+		if err != nil {
+			logger.WarnContext(ctx, "Route cache warming failed", "error", err)
+			return
+		}
+		if warmed > 0 {
+			logger.Info("Route cache warmed", "searches", warmed, "duration", time.Since(start).Round(time.Millisecond).String())
+		}
+	}()
+}
+
+// WarmRouteCache computes the routes of the limit most searched
+// origin-destination pairs of the last week with every strategy
+// Pairs are replayed with the exact coordinates partners sent, which are the
+// cache keys their next searches will use. Returns the number of pairs warmed
+func WarmRouteCache(ctx context.Context, pool *pgxpool.Pool, limit int) (int, error) {
+	pairs, err := popularPairs(ctx, pool, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	work := make(chan odPair)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	warmed := 0
+
+	for i := 0; i < warmWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range work {
+				ok := true
+				for _, strategy := range routing.GetAllStrategies() {
+					if _, _, err := computeRoute(ctx, p.FromLat, p.FromLon, p.ToLat, p.ToLon, strategy, nil); err != nil {
+						ok = false
+					}
+				}
+				if ok {
+					mu.Lock()
+					warmed++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, p := range pairs {
+		select {
+		case work <- p:
+		case <-ctx.Done():
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	return warmed, ctx.Err()
+}
+
+// popularPairs reads the most searched pairs from usage_log
+// Locations are stored as POINT(lon, lat)
+func popularPairs(ctx context.Context, pool *pgxpool.Pool, limit int) ([]odPair, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT from_location[1], from_location[0], to_location[1], to_location[0]
+		FROM usage_log
+		WHERE timestamp > $1
+			AND endpoint LIKE '%/route-search'
+			AND from_location IS NOT NULL
+			AND to_location IS NOT NULL
+			AND response_status < 500
+		GROUP BY 1, 2, 3, 4
+		ORDER BY COUNT(*) DESC
+		LIMIT $2
+	`, time.Now().Add(-warmWindow), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pairs []odPair
+	for rows.Next() {
+		var p odPair
+		if err := rows.Scan(&p.FromLat, &p.FromLon, &p.ToLat, &p.ToLon); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, p)
+	}
+	return pairs, rows.Err()
+}
@@ -0,0 +1,368 @@
+// Package billing turns a month of partner usage into invoices: the tier's
+// base price plus overage on the quota units used beyond the monthly limit
+package billing
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/middleware"
+)
+
+// ErrNotFound is returned when an invoice does not exist or belongs to
+// another partner
+var ErrNotFound = errors.New("invoice not found")
+
+// MonthLayout is how billing months are written in requests (2026-09)
+const MonthLayout = "2006-01"
+
+// Invoice is a partner's bill for one calendar month (UTC)
+// Units are requests weighted by tier_config.endpoint_weights, the same units
+// the monthly quota counts; IncludedUnits is -1 for unlimited tiers
+type Invoice struct {
+	ID            int64     `json:"id"`
+	PartnerID     string    `json:"partner_id"`
+	PartnerName   string    `json:"partner_name,omitempty"`
+	PartnerEmail  string    `json:"partner_email,omitempty"`
+	Month         string    `json:"month"`
+	PeriodStart   time.Time `json:"period_start"`
+	PeriodEnd     time.Time `json:"period_end"`
+	Tier          string    `json:"tier"`
+	Requests      int64     `json:"requests"`
+	Successful    int64     `json:"successful_requests"`
+	Failed        int64     `json:"failed_requests"`
+	Units         int64     `json:"units"`
+	IncludedUnits int64     `json:"included_units"`
+	OverageUnits  int64     `json:"overage_units"`
+	BaseCents     int64     `json:"base_cents"`
+	OverageCents  int64     `json:"overage_cents"`
+	TotalCents    int64     `json:"total_cents"`
+	Lines         []Line    `json:"lines,omitempty"`
+	GeneratedAt   time.Time `json:"generated_at"`
+}
+
+// Line is the usage of one endpoint on an invoice
+type Line struct {
+	Method   string `json:"method"`
+	Endpoint string `json:"endpoint"`
+	Requests int64  `json:"requests"`
+	Weight   int    `json:"weight"`
+	Units    int64  `json:"units"`
+}
+
+// Pricing is what a tier charges
+type Pricing struct {
+	BaseCents int64
+	// OverageCentsPer1000 is charged per thousand units beyond IncludedUnits
+	OverageCentsPer1000 int64
+	// IncludedUnits is the monthly quota, prorated in a month the tier
+	// changed; 0 or less is unlimited
+	IncludedUnits int64
+	Weights       map[string]int
+}
+
+// ParseMonth parses a billing month ("2026-09") into its first day in UTC
+func ParseMonth(month string) (time.Time, error) {
+	t, err := time.Parse(MonthLayout, month)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid month %q (use YYYY-MM)", month)
+	}
+	return t, nil
+}
+
+// Price fills an invoice's lines, units and amounts from its request counts
+// Requests missing from the per-endpoint lines (not logged) cost one unit
+func Price(inv *Invoice, lines []Line, p Pricing) {
+	var logged int64
+	inv.Units = 0
+	for i := range lines {
+		lines[i].Weight = middleware.EndpointWeight(p.Weights, lines[i].Method, lines[i].Endpoint)
+		lines[i].Units = lines[i].Requests * int64(lines[i].Weight)
+		logged += lines[i].Requests
+		inv.Units += lines[i].Units
+	}
+	if inv.Requests > logged {
+		inv.Units += inv.Requests - logged
+	}
+	inv.Lines = lines
+
+	inv.IncludedUnits = -1
+	inv.OverageUnits = 0
+	if p.IncludedUnits > 0 {
+		inv.IncludedUnits = p.IncludedUnits
+		if inv.Units > p.IncludedUnits {
+			inv.OverageUnits = inv.Units - p.IncludedUnits
+		}
+	}
+
+	inv.BaseCents = p.BaseCents
+	// Partial thousands are charged pro rata, rounding up to the cent
+	inv.OverageCents = (inv.OverageUnits*p.OverageCentsPer1000 + 999) / 1000
+	inv.TotalCents = inv.BaseCents + inv.OverageCents
+}
+
+// Generate creates or refreshes the invoices of a month for every partner
+// with usage that month or an active paid tier, and returns how many it wrote
+// The month should be over; generating it again replaces its invoices
+func Generate(ctx context.Context, db *pgxpool.Pool, month time.Time) (int, error) {
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	rows, err := db.Query(ctx, `
+		SELECT p.id, p.tier,
+			CASE WHEN p.prorated_month = $1 THEN p.prorated_month_limit ELSE p.rate_limit_per_month END,
+			COALESCE(tc.price_cents, 0), COALESCE(tc.overage_cents_per_1000, 0),
+			COALESCE(tc.endpoint_weights, '{}'::jsonb),
+			COALESCE(q.requests_count, 0), COALESCE(q.successful_requests, 0), COALESCE(q.failed_requests, 0)
+		FROM partner p
+		LEFT JOIN tier_config tc ON tc.tier = p.tier
+		LEFT JOIN quota_usage q ON q.partner_id = p.id
+			AND q.period_type = 'monthly'
+			AND q.period_start = $1
+		WHERE q.id IS NOT NULL
+			OR (p.status = 'active' AND tc.price_cents > 0 AND p.created_at < $2)
+	`, start, end)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query partners: %w", err)
+	}
+
+	type partnerUsage struct {
+		invoice Invoice
+		pricing Pricing
+	}
+	var usages []partnerUsage
+	for rows.Next() {
+		var u partnerUsage
+		var included int
+		if err := rows.Scan(&u.invoice.PartnerID, &u.invoice.Tier, &included,
+			&u.pricing.BaseCents, &u.pricing.OverageCentsPer1000, &u.pricing.Weights,
+			&u.invoice.Requests, &u.invoice.Successful, &u.invoice.Failed); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan partner: %w", err)
+		}
+		u.pricing.IncludedUnits = int64(included)
+		usages = append(usages, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to query partners: %w", err)
+	}
+
+	for _, u := range usages {
+		inv := u.invoice
+		inv.PeriodStart = start
+		inv.PeriodEnd = end.AddDate(0, 0, -1)
+
+		lines, err := endpointUsage(ctx, db, inv.PartnerID, start, end)
+		if err != nil {
+			return 0, err
+		}
+		Price(&inv, lines, u.pricing)
+
+		if err := save(ctx, db, &inv); err != nil {
+			return 0, err
+		}
+	}
+	return len(usages), nil
+}
+
+// endpointUsage counts a partner's logged requests by endpoint
+func endpointUsage(ctx context.Context, db *pgxpool.Pool, partnerID string, start, end time.Time) ([]Line, error) {
+	rows, err := db.Query(ctx, `
+		SELECT method, endpoint, COUNT(*)
+		FROM usage_log
+		WHERE partner_id = $1
+			AND timestamp >= $2
+			AND timestamp < $3
+			AND NOT sandbox
+		GROUP BY method, endpoint
+		ORDER BY COUNT(*) DESC, endpoint, method
+	`, partnerID, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %w", err)
+	}
+	defer rows.Close()
+
+	lines := []Line{}
+	for rows.Next() {
+		var l Line
+		if err := rows.Scan(&l.Method, &l.Endpoint, &l.Requests); err != nil {
+			return nil, fmt.Errorf("failed to scan usage: %w", err)
+		}
+		lines = append(lines, l)
+	}
+	return lines, rows.Err()
+}
+
+// save upserts an invoice and replaces its lines
+func save(ctx context.Context, db *pgxpool.Pool, inv *Invoice) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO invoice (partner_id, period_start, period_end, tier,
+			requests_count, successful_requests, failed_requests,
+			units, included_units, overage_units, base_cents, overage_cents, total_cents)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (partner_id, period_start) DO UPDATE SET
+			period_end = EXCLUDED.period_end,
+			tier = EXCLUDED.tier,
+			requests_count = EXCLUDED.requests_count,
+			successful_requests = EXCLUDED.successful_requests,
+			failed_requests = EXCLUDED.failed_requests,
+			units = EXCLUDED.units,
+			included_units = EXCLUDED.included_units,
+			overage_units = EXCLUDED.overage_units,
+			base_cents = EXCLUDED.base_cents,
+			overage_cents = EXCLUDED.overage_cents,
+			total_cents = EXCLUDED.total_cents,
+			generated_at = NOW()
+		RETURNING id
+	`, inv.PartnerID, inv.PeriodStart, inv.PeriodEnd, inv.Tier,
+		inv.Requests, inv.Successful, inv.Failed,
+		inv.Units, inv.IncludedUnits, inv.OverageUnits, inv.BaseCents, inv.OverageCents, inv.TotalCents,
+	).Scan(&inv.ID)
+	if err != nil {
+		return fmt.Errorf("failed to save invoice: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM invoice_line WHERE invoice_id = $1`, inv.ID); err != nil {
+		return fmt.Errorf("failed to clear invoice lines: %w", err)
+	}
+	batch := &pgx.Batch{}
+	for _, l := range inv.Lines {
+		batch.Queue(`
+			INSERT INTO invoice_line (invoice_id, method, endpoint, requests, weight, units)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, inv.ID, l.Method, l.Endpoint, l.Requests, l.Weight, l.Units)
+	}
+	if batch.Len() > 0 {
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return fmt.Errorf("failed to save invoice lines: %w", err)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// List returns a partner's invoices, newest month first, without lines
+func List(ctx context.Context, db *pgxpool.Pool, partnerID string) ([]Invoice, error) {
+	return query(ctx, db, selectInvoices+`
+		WHERE i.partner_id = $1
+		ORDER BY i.period_start DESC
+	`, partnerID)
+}
+
+// ListMonth returns every partner's invoice for a month, for the finance export
+func ListMonth(ctx context.Context, db *pgxpool.Pool, month time.Time) ([]Invoice, error) {
+	return query(ctx, db, selectInvoices+`
+		WHERE i.period_start = $1
+		ORDER BY p.name, i.partner_id
+	`, month)
+}
+
+// Get returns one of a partner's invoices with its lines
+func Get(ctx context.Context, db *pgxpool.Pool, partnerID string, id int64) (*Invoice, error) {
+	invoices, err := query(ctx, db, selectInvoices+`
+		WHERE i.id = $1 AND i.partner_id = $2
+	`, id, partnerID)
+	if err != nil {
+		return nil, err
+	}
+	if len(invoices) == 0 {
+		return nil, ErrNotFound
+	}
+	inv := &invoices[0]
+
+	rows, err := db.Query(ctx, `
+		SELECT method, endpoint, requests, weight, units
+		FROM invoice_line
+		WHERE invoice_id = $1
+		ORDER BY units DESC, endpoint, method
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invoice lines: %w", err)
+	}
+	defer rows.Close()
+
+	inv.Lines = []Line{}
+	for rows.Next() {
+		var l Line
+		if err := rows.Scan(&l.Method, &l.Endpoint, &l.Requests, &l.Weight, &l.Units); err != nil {
+			return nil, fmt.Errorf("failed to scan invoice line: %w", err)
+		}
+		inv.Lines = append(inv.Lines, l)
+	}
+	return inv, rows.Err()
+}
+
+const selectInvoices = `
+	SELECT i.id, i.partner_id, p.name, p.email, i.period_start, i.period_end, i.tier,
+		i.requests_count, i.successful_requests, i.failed_requests,
+		i.units, i.included_units, i.overage_units, i.base_cents, i.overage_cents, i.total_cents,
+		i.generated_at
+	FROM invoice i
+	JOIN partner p ON p.id = i.partner_id`
+
+func query(ctx context.Context, db *pgxpool.Pool, sql string, args ...interface{}) ([]Invoice, error) {
+	rows, err := db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invoices: %w", err)
+	}
+	defer rows.Close()
+
+	invoices := []Invoice{}
+	for rows.Next() {
+		var inv Invoice
+		if err := rows.Scan(&inv.ID, &inv.PartnerID, &inv.PartnerName, &inv.PartnerEmail,
+			&inv.PeriodStart, &inv.PeriodEnd, &inv.Tier,
+			&inv.Requests, &inv.Successful, &inv.Failed,
+			&inv.Units, &inv.IncludedUnits, &inv.OverageUnits, &inv.BaseCents, &inv.OverageCents, &inv.TotalCents,
+			&inv.GeneratedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan invoice: %w", err)
+		}
+		inv.Month = inv.PeriodStart.Format(MonthLayout)
+		invoices = append(invoices, inv)
+	}
+	return invoices, rows.Err()
+}
+
+// WriteCSV writes one row per invoice for the finance team
+// Amounts are in cents, as stored
+func WriteCSV(w io.Writer, invoices []Invoice) error {
+	cw := csv.NewWriter(w)
+	header := []string{
+		"invoice_id", "month", "partner_id", "partner_name", "partner_email", "tier",
+		"requests", "successful_requests", "failed_requests",
+		"units", "included_units", "overage_units",
+		"base_cents", "overage_cents", "total_cents",
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, inv := range invoices {
+		row := []string{
+			strconv.FormatInt(inv.ID, 10), inv.Month, inv.PartnerID, inv.PartnerName, inv.PartnerEmail, inv.Tier,
+			strconv.FormatInt(inv.Requests, 10), strconv.FormatInt(inv.Successful, 10), strconv.FormatInt(inv.Failed, 10),
+			strconv.FormatInt(inv.Units, 10), strconv.FormatInt(inv.IncludedUnits, 10), strconv.FormatInt(inv.OverageUnits, 10),
+			strconv.FormatInt(inv.BaseCents, 10), strconv.FormatInt(inv.OverageCents, 10), strconv.FormatInt(inv.TotalCents, 10),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
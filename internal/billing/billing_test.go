@@ -0,0 +1,80 @@
+package billing
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrice(t *testing.T) {
+	pricing := Pricing{
+		BaseCents:           4900,
+		OverageCentsPer1000: 50,
+		IncludedUnits:       1000,
+		Weights:             map[string]int{"GET /route-search": 5},
+	}
+	inv := &Invoice{Requests: 400}
+	lines := []Line{
+		{Method: "GET", Endpoint: "/v2/route-search", Requests: 200},
+		{Method: "GET", Endpoint: "/v2/stops/nearby", Requests: 150},
+	}
+
+	Price(inv, lines, pricing)
+
+	assert.Equal(t, 5, inv.Lines[0].Weight)
+	assert.Equal(t, int64(1000), inv.Lines[0].Units)
+	assert.Equal(t, int64(150), inv.Lines[1].Units)
+	// 50 requests were not logged and cost one unit each
+	assert.Equal(t, int64(1200), inv.Units)
+	assert.Equal(t, int64(200), inv.OverageUnits)
+	// 200 units at 50 cents per thousand
+	assert.Equal(t, int64(10), inv.OverageCents)
+	assert.Equal(t, int64(4910), inv.TotalCents)
+}
+
+func TestPriceUnlimited(t *testing.T) {
+	inv := &Invoice{Requests: 5_000_000}
+
+	Price(inv, nil, Pricing{OverageCentsPer1000: 50, IncludedUnits: -1})
+
+	assert.Equal(t, int64(-1), inv.IncludedUnits)
+	assert.Equal(t, int64(0), inv.OverageUnits)
+	assert.Equal(t, int64(0), inv.TotalCents)
+}
+
+func TestPriceRoundsUpPartialCents(t *testing.T) {
+	inv := &Invoice{Requests: 1001}
+
+	Price(inv, nil, Pricing{OverageCentsPer1000: 30, IncludedUnits: 1000})
+
+	assert.Equal(t, int64(1), inv.OverageUnits)
+	assert.Equal(t, int64(1), inv.OverageCents)
+}
+
+func TestParseMonth(t *testing.T) {
+	month, err := ParseMonth("2026-09")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, time.September, 1, 0, 0, 0, 0, time.UTC), month)
+
+	_, err = ParseMonth("09/2026")
+	assert.Error(t, err)
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteCSV(&buf, []Invoice{{
+		ID: 7, Month: "2026-09", PartnerID: "p1", PartnerName: "Dakar, Mobilité", Tier: "starter",
+		Requests: 10, Units: 12, IncludedUnits: 300000, BaseCents: 4900, TotalCents: 4900,
+	}})
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !assert.Len(t, lines, 2) {
+		return
+	}
+	assert.True(t, strings.HasPrefix(lines[0], "invoice_id,month,partner_id"))
+	assert.Equal(t, `7,2026-09,p1,"Dakar, Mobilité",,starter,10,0,0,12,300000,0,4900,0,4900`, lines[1])
+}
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressMinSize is the smallest value worth compressing; below it the
+// zstd frame overhead eats most of the gain
+const compressMinSize = 512
+
+// zstdMagic starts every zstd frame; JSON never does, so values written
+// before compression was enabled are still read as they are
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+var (
+	encoder     *zstd.Encoder
+	decoder     *zstd.Decoder
+	codecOnce   sync.Once
+	compression bool
+)
+
+func loadCodec() {
+	codecOnce.Do(func() {
+		switch mode := strings.ToLower(getEnv("CACHE_COMPRESSION", "zstd")); mode {
+		case "zstd":
+			compression = true
+		case "none", "off", "false":
+		default:
+			logger.Warn("Unknown CACHE_COMPRESSION, values are stored uncompressed", "value", mode)
+		}
+
+		// Both are safe for concurrent EncodeAll/DecodeAll calls
+		encoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+		decoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+	})
+}
+
+// encodeValue compresses a value for Redis when it is large enough
+func encodeValue(data []byte) []byte {
+	loadCodec()
+	if !compression || len(data) < compressMinSize {
+		return data
+	}
+	return encoder.EncodeAll(data, make([]byte, 0, len(data)/4))
+}
+
+// decodeValue restores a value read from Redis, compressed or not
+// Decoding does not depend on CACHE_COMPRESSION, so it can be turned off
+// while compressed values are still cached
+func decodeValue(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, zstdMagic) {
+		return data, nil
+	}
+
+	loadCodec()
+	out, err := decoder.DecodeAll(data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress cached value: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,33 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	large := []byte(`{"steps":[` + string(bytes.Repeat([]byte(`{"type":"RIDE","from_stop":"S1","to_stop":"S2"},`), 50)) + `{}]}`)
+
+	encoded := encodeValue(large)
+	assert.True(t, bytes.HasPrefix(encoded, zstdMagic))
+	assert.Less(t, len(encoded), len(large))
+
+	decoded, err := decodeValue(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, large, decoded)
+}
+
+func TestCodecSmallAndLegacyValues(t *testing.T) {
+	small := []byte(`{"id":"S1"}`)
+	assert.Equal(t, small, encodeValue(small))
+
+	// Values cached before compression are plain JSON
+	decoded, err := decodeValue(small)
+	assert.NoError(t, err)
+	assert.Equal(t, small, decoded)
+
+	_, err = decodeValue(append(append([]byte{}, zstdMagic...), 0x00, 0x01))
+	assert.Error(t, err)
+}
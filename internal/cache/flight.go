@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/passbi/passbi_core/internal/tracing"
+	"golang.org/x/sync/singleflight"
+)
+
+// routeFlight merges concurrent computations of the same route key within
+// this instance; the Redis lock does the same across instances
+var routeFlight singleflight.Group
+
+// flightResult is what a route computation hands to its followers
+type flightResult struct {
+	path   *models.Path
+	cached bool
+}
+
+// ComputeRoute returns the route cached under key, or computes it once
+// Concurrent callers in this instance share one computation; callers in other
+// instances wait for the lock holder's "done" notification instead of polling.
+// A waiter that hears nothing within lockTTL computes the route itself.
+// cached reports whether the path came from the cache or another computation
+func ComputeRoute(ctx context.Context, key string, ttl, lockTTL time.Duration,
+	compute func(context.Context) (*models.Path, error)) (path *models.Path, cached bool, err error) {
+	lookupCtx, lookup := tracing.Start(ctx, "cache.lookup")
+	path, err = GetRoute(lookupCtx, key)
+	lookup.SetAttributes(tracing.Bool("passbi.cache_hit", err == nil && path != nil))
+	lookup.End()
+	if err == nil && path != nil {
+		return path, true, nil
+	}
+
+	v, err, shared := routeFlight.Do(key, func() (interface{}, error) {
+		// A flight for key may have ended since the cache was read
+		if path, err := GetRoute(ctx, key); err == nil && path != nil {
+			return flightResult{path: path, cached: true}, nil
+		}
+		// Followers share this call, so it must not die with the leader's request
+		return computeOnce(context.WithoutCancel(ctx), key, ttl, lockTTL, compute)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	result := v.(flightResult)
+	if shared {
+		// Callers stamp their own departure time on the steps
+		return clonePath(result.path), true, nil
+	}
+	return result.path, result.cached, nil
+}
+
+// clonePath copies a path so that its steps can be modified independently
+// Callers translate stop names and attach delays and crowding in place, so
+// the stops and pointers of each step are copied too
+func clonePath(p *models.Path) *models.Path {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	c.Steps = append([]models.Step(nil), p.Steps...)
+	for i := range c.Steps {
+		step := &c.Steps[i]
+		step.Stops = append([]models.StopInfo(nil), step.Stops...)
+		if step.DelaySeconds != nil {
+			delay := *step.DelaySeconds
+			step.DelaySeconds = &delay
+		}
+		if step.Crowding != nil {
+			crowding := *step.Crowding
+			step.Crowding = &crowding
+		}
+	}
+	return &c
+}
+
+// computeOnce takes the cross-instance lock or waits for its holder
+func computeOnce(ctx context.Context, key string, ttl, lockTTL time.Duration,
+	compute func(context.Context) (*models.Path, error)) (flightResult, error) {
+	lockKey := LockKey(key)
+
+	acquired, err := AcquireLock(ctx, lockKey, lockTTL)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to acquire lock", "error", err)
+		acquired = true // compute without lock (degrade gracefully)
+	} else if !acquired {
+		if path := waitForRoute(ctx, key, lockTTL); path != nil {
+			return flightResult{path: path, cached: true}, nil
+		}
+		// The holder failed or is too slow; compute anyway
+	}
+
+	path, err := compute(ctx)
+
+	if err == nil {
+		if err := SetRoute(ctx, key, path, ttl); err != nil {
+			logger.WarnContext(ctx, "Failed to cache route", "error", err)
+		}
+	}
+	if acquired {
+		ReleaseLock(ctx, lockKey)
+		notifyDone(ctx, key)
+	}
+
+	if err != nil {
+		return flightResult{}, err
+	}
+	return flightResult{path: path}, nil
+}
+
+// doneChannel is the pub/sub channel announcing a computation of key ended
+func doneChannel(key string) string {
+	return fmt.Sprintf("done:%s", key)
+}
+
+// notifyDone wakes the instances waiting for key, whether it was cached or not
+func notifyDone(ctx context.Context, key string) {
+	c, err := redisClient()
+	if err != nil {
+		return
+	}
+	checkRedis(c.Publish(ctx, doneChannel(key), "1").Err())
+}
+
+// waitForRoute waits until the lock holder announces key is done, then reads
+// the cached route; it returns nil on timeout or when nothing was cached
+func waitForRoute(ctx context.Context, key string, maxWait time.Duration) *models.Path {
+	c, err := redisClient()
+	if err != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxWait)
+	defer cancel()
+
+	sub := c.Subscribe(ctx, doneChannel(key))
+	defer sub.Close()
+
+	// Wait for the subscription to be active, then check the cache once more
+	// in case the holder finished before we subscribed
+	if _, err := sub.Receive(ctx); err != nil {
+		checkRedis(err)
+		return nil
+	}
+	if path, err := GetRoute(ctx, key); err == nil && path != nil {
+		return path
+	}
+
+	select {
+	case <-sub.Channel():
+	case <-ctx.Done():
+		return nil
+	}
+
+	path, err := GetRoute(ctx, key)
+	if err != nil {
+		return nil
+	}
+	return path
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeRouteSharesComputation(t *testing.T) {
+	key := fmt.Sprintf("test:route:%d", time.Now().UnixNano())
+	release := make(chan struct{})
+	var calls atomic.Int32
+
+	compute := func(ctx context.Context) (*models.Path, error) {
+		calls.Add(1)
+		<-release
+		return &models.Path{TotalTime: 1200}, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*models.Path, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path, _, err := ComputeRoute(context.Background(), key, time.Minute, time.Second, compute)
+			assert.NoError(t, err)
+			results[i] = path
+		}(i)
+	}
+
+	// Let the callers pile up behind the first computation
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	for _, path := range results {
+		if assert.NotNil(t, path) {
+			assert.Equal(t, 1200, path.TotalTime)
+		}
+	}
+
+	// Later callers are served from the cache
+	path, cached, err := ComputeRoute(context.Background(), key, time.Minute, time.Second, compute)
+	assert.NoError(t, err)
+	assert.True(t, cached)
+	assert.Equal(t, 1200, path.TotalTime)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestClonePath(t *testing.T) {
+	delay := 60
+	p := &models.Path{TotalTime: 600, Steps: []models.Step{{
+		Duration:     600,
+		Stops:        []models.StopInfo{{ID: "S1", Name: "Gare"}},
+		DelaySeconds: &delay,
+		Crowding:     &models.Crowding{Source: "trip"},
+	}}}
+	c := clonePath(p)
+	c.Steps[0].DepartureTime = "08:00"
+	c.Steps[0].Stops[0].Name = "Station"
+	*c.Steps[0].DelaySeconds = 120
+	c.Steps[0].Crowding.Source = "route"
+
+	assert.Equal(t, "", p.Steps[0].DepartureTime)
+	assert.Equal(t, "Gare", p.Steps[0].Stops[0].Name)
+	assert.Equal(t, 60, *p.Steps[0].DelaySeconds)
+	assert.Equal(t, "trip", p.Steps[0].Crowding.Source)
+	assert.Equal(t, 600, c.TotalTime)
+	assert.Nil(t, clonePath(nil))
+}
@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// statsSample is how many keys of a namespace are sampled for size and TTL
+const statsSample = 200
+
+// Namespace is a group of Redis keys inspected and purged together
+type Namespace struct {
+	Name    string
+	Pattern string // Redis glob of its keys, in every data version
+	// ByID returns the glob of the keys of one stop, route or partner; nil
+	// when the keys do not name one
+	ByID func(id string) string
+}
+
+// Namespaces are the key groups of passbi cache, for on-call debugging
+// Rate limit counters (rl) are not cached responses: purging them resets
+// partners' limits
+var Namespaces = []Namespace{
+	{"route", Pattern(AllVersions, ClassRoute, "*"), nil},
+	{"departures", Pattern(AllVersions, ClassDepartures, "*"), func(stopID string) string {
+		return Pattern(AllVersions, ClassDepartures, stopID, "*")
+	}},
+	{"schedule", Pattern(AllVersions, ClassSchedule, "*"), func(routeID string) string {
+		return Pattern(AllVersions, ClassSchedule, routeID, "*")
+	}},
+	{"rl", "rl:*", func(partnerID string) string {
+		return Pattern("rl", "*", partnerID, "*")
+	}},
+}
+
+// NamespaceByName returns the namespace called name
+func NamespaceByName(name string) (Namespace, bool) {
+	for _, ns := range Namespaces {
+		if ns.Name == name {
+			return ns, true
+		}
+	}
+	return Namespace{}, false
+}
+
+// NamespaceStats describes the keys of a namespace
+// Sizes and TTLs are of a sample of the keys
+type NamespaceStats struct {
+	Namespace string        `json:"namespace"`
+	Keys      int64         `json:"keys"`
+	Current   int64         `json:"current"` // in the current data version; all of them for unversioned keys
+	Sampled   int           `json:"sampled"`
+	AvgBytes  int64         `json:"avg_bytes"`
+	MinTTL    time.Duration `json:"min_ttl"`
+	MaxTTL    time.Duration `json:"max_ttl"`
+	NoTTL     int           `json:"no_ttl"` // sampled keys that never expire
+}
+
+// Stats counts the keys of a namespace with SCAN, so Redis keeps serving
+// Keys of an older data version than version are never read again and wait
+// for their TTL
+func (ns Namespace) Stats(ctx context.Context, version int64) (NamespaceStats, error) {
+	stats := NamespaceStats{Namespace: ns.Name}
+	c, err := GetClient()
+	if err != nil {
+		return stats, err
+	}
+
+	current := versionedKey(version, "")
+	var sample []string
+	var cursor uint64
+	for {
+		keys, next, err := c.Scan(ctx, cursor, ns.Pattern, purgeBatch).Result()
+		if err != nil {
+			return stats, err
+		}
+		for _, key := range keys {
+			stats.Keys++
+			if !strings.HasPrefix(ns.Pattern, AllVersions) || strings.HasPrefix(key, current) {
+				stats.Current++
+			}
+			if len(sample) < statsSample {
+				sample = append(sample, key)
+			}
+		}
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+	if len(sample) == 0 {
+		return stats, nil
+	}
+
+	pipe := c.Pipeline()
+	sizes := make([]*redis.IntCmd, len(sample))
+	ttls := make([]*redis.DurationCmd, len(sample))
+	for i, key := range sample {
+		sizes[i] = pipe.MemoryUsage(ctx, key)
+		ttls[i] = pipe.PTTL(ctx, key)
+	}
+	// A key may expire between SCAN and the pipeline; its commands fail alone
+	pipe.Exec(ctx)
+
+	var total int64
+	for i := range sample {
+		size, err := sizes[i].Result()
+		if err != nil {
+			continue
+		}
+		ttl, err := ttls[i].Result()
+		if err != nil || ttl == -2 {
+			continue
+		}
+		stats.Sampled++
+		total += size
+		if ttl < 0 {
+			stats.NoTTL++
+			continue
+		}
+		if stats.MinTTL == 0 || ttl < stats.MinTTL {
+			stats.MinTTL = ttl
+		}
+		if ttl > stats.MaxTTL {
+			stats.MaxTTL = ttl
+		}
+	}
+	if stats.Sampled > 0 {
+		stats.AvgBytes = total / int64(stats.Sampled)
+	}
+	return stats, nil
+}
+
+// KeyInfo is a Redis key and its value
+type KeyInfo struct {
+	Key        string            `json:"key"`
+	Type       string            `json:"type"`
+	TTL        time.Duration     `json:"ttl"` // -1 when the key never expires
+	Bytes      int64             `json:"bytes"`
+	Compressed bool              `json:"compressed,omitempty"`
+	Value      json.RawMessage   `json:"value,omitempty"` // strings holding JSON
+	Text       string            `json:"text,omitempty"`  // other strings
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+// Inspect reads a key as stored in Redis, decompressing cached responses;
+// nil when the key does not exist
+func Inspect(ctx context.Context, key string) (*KeyInfo, error) {
+	c, err := GetClient()
+	if err != nil {
+		return nil, err
+	}
+	kind, err := c.Type(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if kind == "none" {
+		return nil, nil
+	}
+
+	info := &KeyInfo{Key: key, Type: kind}
+	if info.TTL, err = c.PTTL(ctx, key).Result(); err != nil {
+		return nil, err
+	}
+	// MEMORY USAGE is missing from some managed Redis
+	info.Bytes, _ = c.MemoryUsage(ctx, key).Result()
+
+	switch kind {
+	case "string":
+		raw, err := c.Get(ctx, key).Bytes()
+		if err != nil {
+			return nil, err
+		}
+		info.Compressed = bytes.HasPrefix(raw, zstdMagic)
+		data, err := decodeValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %s: %w", key, err)
+		}
+		if json.Valid(data) {
+			info.Value = data
+		} else {
+			info.Text = string(data)
+		}
+	case "hash":
+		if info.Fields, err = c.HGetAll(ctx, key).Result(); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// Keys returns up to limit keys matching a Redis glob, and whether there are
+// more
+func Keys(ctx context.Context, pattern string, limit int) ([]string, bool, error) {
+	c, err := GetClient()
+	if err != nil {
+		return nil, false, err
+	}
+	var found []string
+	var cursor uint64
+	for {
+		keys, next, err := c.Scan(ctx, cursor, pattern, purgeBatch).Result()
+		if err != nil {
+			return nil, false, err
+		}
+		for _, key := range keys {
+			if len(found) == limit {
+				return found, true, nil
+			}
+			found = append(found, key)
+		}
+		cursor = next
+		if cursor == 0 {
+			return found, false, nil
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespaces(t *testing.T) {
+	matches := func(pattern, key string) bool {
+		ok, _ := path.Match(pattern, key)
+		return ok
+	}
+
+	route, ok := NamespaceByName("route")
+	if assert.True(t, ok) {
+		assert.True(t, matches(route.Pattern, "v3:route:0a1b2c:fast"))
+		assert.False(t, matches(route.Pattern, "lock:v3:route:0a1b2c:fast"))
+		assert.Nil(t, route.ByID)
+	}
+
+	dep, _ := NamespaceByName("departures")
+	assert.True(t, matches(dep.Pattern, "v0:dep:S1:2026-10-16:28800:10"))
+	assert.True(t, matches(dep.ByID("S1"), "v12:dep:S1:2026-10-16:28800:10"))
+	assert.False(t, matches(dep.ByID("S1"), "v12:dep:S10:2026-10-16:28800:10"))
+	assert.Equal(t, `v*:dep:S\*1:*`, dep.ByID("S*1"))
+
+	rl, _ := NamespaceByName("rl")
+	assert.True(t, matches(rl.ByID("p1"), "rl:sandbox:p1:day:2026-10-16"))
+	assert.True(t, matches(rl.ByID("p1"), "rl:partner:p1:bucket"))
+	assert.False(t, matches(rl.ByID("p1"), "rl:partner:p12:bucket"))
+
+	_, ok = NamespaceByName("dep")
+	assert.False(t, ok)
+}
@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrUnavailable is returned when Redis cannot be reached and the local
+// cache does not hold the key either
+var ErrUnavailable = errors.New("cache unavailable")
+
+// redisRetryAfter is how long Redis is skipped after a connection error, so
+// an outage costs one timeout rather than one per request
+const redisRetryAfter = 10 * time.Second
+
+// lru is a size-bounded in-process cache whose entries also expire
+type lru struct {
+	mu      sync.Mutex
+	maxSize int
+	order   *list.List // front is the most recently used
+	items   map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func newLRU(maxSize int) *lru {
+	return &lru{
+		maxSize: maxSize,
+		order:   list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+// get returns the value of key unless it is missing or expired
+func (l *lru) get(key string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		l.order.Remove(el)
+		delete(l.items, key)
+		return nil, false
+	}
+	l.order.MoveToFront(el)
+	return entry.value, true
+}
+
+// set stores value for ttl, evicting the least recently used entry when full
+func (l *lru) set(key string, value []byte, ttl time.Duration) {
+	if l.maxSize <= 0 || ttl <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	expires := time.Now().Add(ttl)
+	if el, ok := l.items[key]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.value, entry.expires = value, expires
+		l.order.MoveToFront(el)
+		return
+	}
+
+	l.items[key] = l.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for l.order.Len() > l.maxSize {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// delete removes key
+func (l *lru) delete(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.items[key]; ok {
+		l.order.Remove(el)
+		delete(l.items, key)
+	}
+}
+
+var (
+	local     *lru
+	localTTL  time.Duration
+	localOnce sync.Once
+
+	redisMu        sync.Mutex
+	redisDownUntil time.Time
+)
+
+// localCache returns the in-process L1 cache
+func localCache() *lru {
+	localOnce.Do(func() {
+		config := LoadConfigFromEnv()
+		local = newLRU(config.LocalSize)
+		localTTL = config.LocalTTL
+	})
+	return local
+}
+
+// setLocal stores a value in L1 for at most the local TTL, so instances
+// converge on Redis' copy shortly after it changes
+func setLocal(key string, value []byte, ttl time.Duration) {
+	l := localCache()
+	if ttl > localTTL {
+		ttl = localTTL
+	}
+	l.set(key, value, ttl)
+}
+
+// redisClient returns the Redis client unless it is known to be unreachable
+func redisClient() (*redis.Client, error) {
+	redisMu.Lock()
+	down := time.Now().Before(redisDownUntil)
+	redisMu.Unlock()
+	if down {
+		return nil, ErrUnavailable
+	}
+
+	c, err := GetClient()
+	if err != nil {
+		return nil, ErrUnavailable
+	}
+	return c, nil
+}
+
+// checkRedis records a connection failure of a Redis command
+// Only network errors count; a missing key or canceled request does not
+func checkRedis(err error) error {
+	var netErr net.Error
+	if err == nil || !errors.As(err, &netErr) {
+		return err
+	}
+
+	redisMu.Lock()
+	if time.Now().After(redisDownUntil) {
+		logger.Warn("Redis unreachable, using the local cache", "retry_after", redisRetryAfter.String(), "error", err)
+	}
+	redisDownUntil = time.Now().Add(redisRetryAfter)
+	redisMu.Unlock()
+	return ErrUnavailable
+}
+
+// getBytes reads key from L1, then Redis, filling L1 on a Redis hit
+// L1 holds values uncompressed; only Redis copies are compressed
+func getBytes(ctx context.Context, key string) ([]byte, error) {
+	counters := countersFor(key)
+
+	if data, ok := localCache().get(key); ok {
+		counters.localHits.Add(1)
+		return data, nil
+	}
+
+	c, err := redisClient()
+	if err != nil {
+		counters.misses.Add(1)
+		return nil, err
+	}
+
+	data, err := c.Get(ctx, key).Bytes()
+	if err != nil {
+		counters.misses.Add(1)
+		if err != redis.Nil {
+			counters.errors.Add(1)
+		}
+		return nil, checkRedis(err)
+	}
+
+	data, err = decodeValue(data)
+	if err != nil {
+		counters.errors.Add(1)
+		return nil, err
+	}
+
+	counters.redisHits.Add(1)
+	setLocal(key, data, localTTL)
+	return data, nil
+}
+
+// setBytes writes key to L1 and Redis
+// The value is cached locally even when Redis is down, which is not an error
+func setBytes(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	counters := countersFor(key)
+	counters.sets.Add(1)
+	setLocal(key, data, ttl)
+
+	c, err := redisClient()
+	if err != nil {
+		return nil
+	}
+
+	if err := c.Set(ctx, key, encodeValue(data), ttl).Err(); err != nil {
+		counters.errors.Add(1)
+		if err := checkRedis(err); err != ErrUnavailable {
+			return err
+		}
+	}
+	return nil
+}
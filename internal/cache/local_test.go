@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	l := newLRU(2)
+	l.set("a", []byte("1"), time.Minute)
+	l.set("b", []byte("2"), time.Minute)
+
+	// Reading a makes b the least recently used
+	_, ok := l.get("a")
+	assert.True(t, ok)
+	l.set("c", []byte("3"), time.Minute)
+
+	_, ok = l.get("b")
+	assert.False(t, ok)
+	v, ok := l.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), v)
+	_, ok = l.get("c")
+	assert.True(t, ok)
+}
+
+func TestLRUExpiry(t *testing.T) {
+	l := newLRU(10)
+	l.set("a", []byte("1"), time.Millisecond)
+	l.set("b", []byte("2"), 0) // not cached
+
+	time.Sleep(5 * time.Millisecond)
+
+	_, ok := l.get("a")
+	assert.False(t, ok)
+	_, ok = l.get("b")
+	assert.False(t, ok)
+	assert.Equal(t, 0, l.order.Len())
+}
+
+func TestLRUUpdate(t *testing.T) {
+	l := newLRU(10)
+	l.set("a", []byte("1"), time.Minute)
+	l.set("a", []byte("2"), time.Minute)
+
+	v, ok := l.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("2"), v)
+	assert.Equal(t, 1, l.order.Len())
+
+	l.delete("a")
+	_, ok = l.get("a")
+	assert.False(t, ok)
+}
+
+func TestLRUDeleteMatching(t *testing.T) {
+	l := newLRU(10)
+	l.set("v1:dep:S1:2026-10-16:28800:10", []byte("1"), time.Minute)
+	l.set("v2:dep:S1:2026-10-16:28800:10", []byte("1"), time.Minute)
+	l.set("v2:dep:S2:2026-10-16:28800:10", []byte("1"), time.Minute)
+	l.set("v2:sched:S1:all:", []byte("1"), time.Minute)
+
+	l.deleteMatching(Pattern(AllVersions, ClassDepartures, "S1", "*"))
+
+	_, ok := l.get("v1:dep:S1:2026-10-16:28800:10")
+	assert.False(t, ok)
+	_, ok = l.get("v2:dep:S1:2026-10-16:28800:10")
+	assert.False(t, ok)
+	_, ok = l.get("v2:dep:S2:2026-10-16:28800:10")
+	assert.True(t, ok)
+	_, ok = l.get("v2:sched:S1:all:")
+	assert.True(t, ok)
+}
+
+func TestPattern(t *testing.T) {
+	assert.Equal(t, "v*:dep:S1:*", Pattern(AllVersions, ClassDepartures, "S1", "*"))
+	assert.Equal(t, `v*:sched:R\*1:*`, Pattern(AllVersions, ClassSchedule, "R*1", "*"))
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/metrics"
+)
+
+// ClassStats counts cache operations on one key class (route, dep, sched...)
+// Hits are split by the layer that answered: the in-process cache or Redis
+type ClassStats struct {
+	Class     string `json:"class"`
+	Hits      int64  `json:"hits"`
+	LocalHits int64  `json:"local_hits"`
+	RedisHits int64  `json:"redis_hits"`
+	Misses    int64  `json:"misses"`
+	Sets      int64  `json:"sets"`
+	Errors    int64  `json:"errors"`
+}
+
+type classCounters struct {
+	localHits atomic.Int64
+	redisHits atomic.Int64
+	misses    atomic.Int64
+	sets      atomic.Int64
+	errors    atomic.Int64
+}
+
+var (
+	classes sync.Map // class name -> *classCounters
+
+	// countersSince is when the counters started, i.e. the process start
+	countersSince = time.Now()
+)
+
+func init() {
+	metrics.Register(collectMetrics)
+}
+
+// keyClass is the kind of a cache key: its first segment after the data version
+func keyClass(key string) string {
+	if strings.HasPrefix(key, "v") {
+		if i := strings.IndexByte(key, ':'); i > 1 && isDigits(key[1:i]) {
+			key = key[i+1:]
+		}
+	}
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func countersFor(key string) *classCounters {
+	class := keyClass(key)
+	if c, ok := classes.Load(class); ok {
+		return c.(*classCounters)
+	}
+	c, _ := classes.LoadOrStore(class, &classCounters{})
+	return c.(*classCounters)
+}
+
+// ClassMetrics returns the counters of every key class seen since startup
+func ClassMetrics() (stats []ClassStats, since time.Time) {
+	classes.Range(func(k, v interface{}) bool {
+		c := v.(*classCounters)
+		s := ClassStats{
+			Class:     k.(string),
+			LocalHits: c.localHits.Load(),
+			RedisHits: c.redisHits.Load(),
+			Misses:    c.misses.Load(),
+			Sets:      c.sets.Load(),
+			Errors:    c.errors.Load(),
+		}
+		s.Hits = s.LocalHits + s.RedisHits
+		stats = append(stats, s)
+		return true
+	})
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Class < stats[j].Class })
+	return stats, countersSince
+}
+
+func collectMetrics(w *metrics.Writer) {
+	stats, _ := ClassMetrics()
+	for _, s := range stats {
+		w.Counter("passbi_cache_hits_total", "Cache lookups answered, by key class and layer",
+			float64(s.LocalHits), metrics.L("class", s.Class), metrics.L("layer", "local"))
+		w.Counter("passbi_cache_hits_total", "Cache lookups answered, by key class and layer",
+			float64(s.RedisHits), metrics.L("class", s.Class), metrics.L("layer", "redis"))
+	}
+	for _, s := range stats {
+		w.Counter("passbi_cache_misses_total", "Cache lookups not answered, by key class",
+			float64(s.Misses), metrics.L("class", s.Class))
+	}
+	for _, s := range stats {
+		w.Counter("passbi_cache_sets_total", "Values written to the cache, by key class",
+			float64(s.Sets), metrics.L("class", s.Class))
+	}
+	for _, s := range stats {
+		w.Counter("passbi_cache_errors_total", "Failed Redis reads and writes, by key class",
+			float64(s.Errors), metrics.L("class", s.Class))
+	}
+}
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// Key classes with their own TTL; each is the prefix of its cache keys
+const (
+	ClassRoute          = "route"
+	ClassDepartures     = "dep"
+	ClassSchedule       = "sched"
+	ClassRouteStops     = "routestops"
+	ClassStopRoutes     = "stoproutes"
+	ClassRouteFrequency = "routefreq"
+	ClassNetworkStats   = "network"
+	ClassServices       = "services"
+	ClassGeocode        = "geocode"
+	ClassReverseGeocode = "revgeo"
+)
+
+// ttlSetting is the TTL of a key class and the variable overriding it
+type ttlSetting struct {
+	class      string
+	env        string
+	defaultTTL time.Duration
+}
+
+// ttlSettings is the cache policy: how fresh each kind of response must be
+// Departures carry realtime-sensitive schedules; the rest only change with
+// imports, which invalidate them through the data version anyway
+var ttlSettings = []ttlSetting{
+	{ClassRoute, "CACHE_TTL", 10 * time.Minute},
+	{ClassDepartures, "CACHE_TTL_DEPARTURES", time.Minute},
+	{ClassSchedule, "CACHE_TTL_SCHEDULE", time.Hour},
+	{ClassRouteStops, "CACHE_TTL_ROUTE_STOPS", time.Hour},
+	{ClassStopRoutes, "CACHE_TTL_STOP_ROUTES", time.Hour},
+	{ClassRouteFrequency, "CACHE_TTL_ROUTE_FREQUENCY", time.Hour},
+	{ClassNetworkStats, "CACHE_TTL_NETWORK_STATS", time.Hour},
+	{ClassServices, "CACHE_TTL_SERVICES", time.Hour},
+	// Landmarks do not move, and public geocoders ask clients to cache
+	{ClassGeocode, "CACHE_TTL_GEOCODE", 7 * 24 * time.Hour},
+	{ClassReverseGeocode, "CACHE_TTL_GEOCODE", 7 * 24 * time.Hour},
+}
+
+var (
+	ttls     map[string]time.Duration
+	lockTTL  time.Duration
+	ttlsOnce sync.Once
+)
+
+func loadPolicy() {
+	ttlsOnce.Do(func() {
+		ttls = loadTTLs(os.Getenv)
+
+		lockTTL = LoadConfigFromEnv().MutexTTL
+		if lockTTL <= 0 {
+			lockTTL = 5 * time.Second
+		}
+	})
+}
+
+// TTL returns how long values of a key class are cached
+// Unknown classes get the route TTL
+func TTL(class string) time.Duration {
+	loadPolicy()
+	if ttl, ok := ttls[class]; ok {
+		return ttl
+	}
+	return ttls[ClassRoute]
+}
+
+// TTLPolicy returns the TTL of every key class, read once from the environment
+func TTLPolicy() map[string]time.Duration {
+	loadPolicy()
+	policy := make(map[string]time.Duration, len(ttls))
+	for class, ttl := range ttls {
+		policy[class] = ttl
+	}
+	return policy
+}
+
+// LockTTL bounds how long a route computation holds its lock (CACHE_MUTEX_TTL)
+// Waiters on other instances compute the route themselves after that
+func LockTTL() time.Duration {
+	loadPolicy()
+	return lockTTL
+}
+
+// loadTTLs applies overrides from getenv to the default TTLs
+// Invalid or non-positive values are logged and ignored
+func loadTTLs(getenv func(string) string) map[string]time.Duration {
+	policy := make(map[string]time.Duration, len(ttlSettings))
+	for _, s := range ttlSettings {
+		policy[s.class] = s.defaultTTL
+
+		value := getenv(s.env)
+		if value == "" {
+			continue
+		}
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			logger.Warn("Ignoring invalid cache TTL", "env", s.env, "value", value, "default", s.defaultTTL.String())
+			continue
+		}
+		policy[s.class] = ttl
+	}
+	return policy
+}
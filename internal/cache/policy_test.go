@@ -0,0 +1,27 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadTTLs(t *testing.T) {
+	env := map[string]string{
+		"CACHE_TTL":            "15m",
+		"CACHE_TTL_DEPARTURES": "30s",
+		"CACHE_TTL_SCHEDULE":   "soon", // invalid, default kept
+		"CACHE_TTL_SERVICES":   "-1h",  // not positive, default kept
+		"CACHE_TTL_GEOCODE":    "720h",
+	}
+	policy := loadTTLs(func(key string) string { return env[key] })
+
+	assert.Equal(t, 15*time.Minute, policy[ClassRoute])
+	assert.Equal(t, 30*time.Second, policy[ClassDepartures])
+	assert.Equal(t, time.Hour, policy[ClassSchedule])
+	assert.Equal(t, time.Hour, policy[ClassServices])
+	assert.Equal(t, time.Hour, policy[ClassRouteStops])
+	assert.Equal(t, 720*time.Hour, policy[ClassGeocode])
+	assert.Equal(t, 720*time.Hour, policy[ClassReverseGeocode])
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"context"
+	"path"
+	"strings"
+)
+
+// purgeBatch is how many keys are scanned and unlinked per round trip
+const purgeBatch = 1000
+
+// AllVersions matches a key class in every data version namespace
+// e.g. Pattern(AllVersions, ClassDepartures, "S1", "*")
+const AllVersions = "v*"
+
+// Pattern builds a Redis glob from key segments, escaping glob characters in
+// the segments that are not "*"
+func Pattern(segments ...string) string {
+	escaped := make([]string, len(segments))
+	for i, s := range segments {
+		if s == "*" || s == AllVersions {
+			escaped[i] = s
+			continue
+		}
+		escaped[i] = globEscaper.Replace(s)
+	}
+	return strings.Join(escaped, ":")
+}
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// Purge deletes every key matching a Redis glob pattern and returns how many
+// were deleted from Redis; this instance's local cache is purged too, other
+// instances' local copies expire within CACHE_LOCAL_TTL
+// Keys are found with SCAN, so Redis keeps serving while a purge runs
+func Purge(ctx context.Context, pattern string) (int64, error) {
+	localCache().deleteMatching(pattern)
+
+	c, err := redisClient()
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	var cursor uint64
+	for {
+		keys, next, err := c.Scan(ctx, cursor, pattern, purgeBatch).Result()
+		if err != nil {
+			return deleted, checkRedis(err)
+		}
+		if len(keys) > 0 {
+			n, err := c.Unlink(ctx, keys...).Result()
+			if err != nil {
+				return deleted, checkRedis(err)
+			}
+			deleted += n
+		}
+		cursor = next
+		if cursor == 0 {
+			return deleted, nil
+		}
+	}
+}
+
+// deleteMatching removes the entries whose key matches a glob pattern
+func (l *lru) deleteMatching(pattern string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, el := range l.items {
+		if ok, _ := path.Match(pattern, key); ok {
+			l.order.Remove(el)
+			delete(l.items, key)
+		}
+	}
+}
@@ -8,13 +8,19 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/passbi/passbi_core/internal/logging"
 	"github.com/passbi/passbi_core/internal/models"
+	"github.com/passbi/passbi_core/internal/retry"
+	"github.com/passbi/passbi_core/internal/tracing"
 	"github.com/redis/go-redis/v9"
 )
 
+var logger = logging.For("cache")
+
 var (
 	client     *redis.Client
 	clientOnce sync.Once
@@ -29,6 +35,10 @@ type Config struct {
 	DB       int
 	TTL      time.Duration
 	MutexTTL time.Duration
+
+	// In-process L1 cache, also used while Redis is unreachable
+	LocalSize int
+	LocalTTL  time.Duration
 }
 
 // LoadConfigFromEnv loads Redis configuration from environment variables
@@ -37,54 +47,83 @@ func LoadConfigFromEnv() *Config {
 	db, _ := strconv.Atoi(getEnv("REDIS_DB", "0"))
 	ttl, _ := time.ParseDuration(getEnv("CACHE_TTL", "10m"))
 	mutexTTL, _ := time.ParseDuration(getEnv("CACHE_MUTEX_TTL", "5s"))
+	localSize, _ := strconv.Atoi(getEnv("CACHE_LOCAL_SIZE", "1000"))
+	localTTL, err := time.ParseDuration(getEnv("CACHE_LOCAL_TTL", "1m"))
+	if err != nil {
+		localTTL = time.Minute
+	}
 
 	return &Config{
-		Host:     getEnv("REDIS_HOST", "localhost"),
-		Port:     port,
-		Password: getEnv("REDIS_PASSWORD", ""),
-		DB:       db,
-		TTL:      ttl,
-		MutexTTL: mutexTTL,
+		Host:      getEnv("REDIS_HOST", "localhost"),
+		Port:      port,
+		Password:  getEnv("REDIS_PASSWORD", ""),
+		DB:        db,
+		TTL:       ttl,
+		MutexTTL:  mutexTTL,
+		LocalSize: localSize,
+		LocalTTL:  localTTL,
 	}
 }
 
 // GetClient returns the global Redis client (singleton pattern)
 func GetClient() (*redis.Client, error) {
 	clientOnce.Do(func() {
-		config := LoadConfigFromEnv()
-
-		// Configure Redis options
-		opts := &redis.Options{
-			Addr:         fmt.Sprintf("%s:%d", config.Host, config.Port),
-			Password:     config.Password,
-			DB:           config.DB,
-			DialTimeout:  5 * time.Second,
-			ReadTimeout:  3 * time.Second,
-			WriteTimeout: 3 * time.Second,
-			PoolSize:     10,
-			MinIdleConns: 2,
+		client = newClient(LoadConfigFromEnv())
+		if err := ping(context.Background()); err != nil {
+			clientErr = fmt.Errorf("failed to connect to Redis: %w", err)
 		}
+	})
 
-		// Enable TLS if configured (required for Upstash)
-		if getEnv("REDIS_TLS_ENABLED", "false") == "true" {
-			opts.TLSConfig = &tls.Config{
-				MinVersion: tls.VersionTLS12,
-			}
-		}
+	return client, clientErr
+}
 
-		client = redis.NewClient(opts)
+// Connect creates the global client like GetClient, retrying with backoff
+// while Redis is unreachable. When it still is at the deadline, the error is
+// returned but the client is kept: the cache serves from its local L1 cache
+// and goes back to Redis once it answers
+// Call it before GetClient
+func Connect(ctx context.Context, r retry.Config) (*redis.Client, error) {
+	var err error
+	clientOnce.Do(func() {
+		client = newClient(LoadConfigFromEnv())
+		err = retry.Do(ctx, r, "redis", ping)
+		if err != nil {
+			checkRedis(err)
+		}
+	})
+	return client, err
+}
 
-		// Test connection
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
+func newClient(config *Config) *redis.Client {
+	// Configure Redis options
+	opts := &redis.Options{
+		Addr:         fmt.Sprintf("%s:%d", config.Host, config.Port),
+		Password:     config.Password,
+		DB:           config.DB,
+		DialTimeout:  5 * time.Second,
+		ReadTimeout:  3 * time.Second,
+		WriteTimeout: 3 * time.Second,
+		PoolSize:     10,
+		MinIdleConns: 2,
+	}
 
-		if err := client.Ping(ctx).Err(); err != nil {
-			clientErr = fmt.Errorf("failed to connect to Redis: %w", err)
-			return
+	// Enable TLS if configured (required for Upstash)
+	if getEnv("REDIS_TLS_ENABLED", "false") == "true" {
+		opts.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
 		}
-	})
+	}
 
-	return client, clientErr
+	c := redis.NewClient(opts)
+	c.AddHook(tracing.RedisHook{})
+	return c
+}
+
+// ping tests the connection of the global client
+func ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return client.Ping(ctx).Err()
 }
 
 // Close closes the Redis client
@@ -94,12 +133,29 @@ func Close() {
 	}
 }
 
+// timeBucketSize is the granularity of time-of-day in cache keys
+// Responses for departure times in the same bucket share a cache entry
+const timeBucketSize = 5 * time.Minute
+
+// timeBucket rounds seconds since midnight down to the start of their bucket
+func timeBucket(timeSeconds int) int {
+	size := int(timeBucketSize / time.Second)
+	return (timeSeconds / size) * size
+}
+
 // RouteKey generates a cache key for a route query
-func RouteKey(fromLat, fromLon, toLat, toLon float64, strategy string) string {
+// Routing is not schedule-aware: a path holds durations only and each request
+// stamps its own departure time on the steps, so the key has no date or time
+// bucket. Add them (as DeparturesKey does) once paths depend on departure time
+// Paths restricted to some agencies' routes hash them too
+func RouteKey(fromLat, fromLon, toLat, toLon float64, strategy string, agencies []string) string {
 	// Create deterministic hash of coordinates
 	data := fmt.Sprintf("%.6f,%.6f,%.6f,%.6f", fromLat, fromLon, toLat, toLon)
+	if len(agencies) > 0 {
+		data += "|" + strings.Join(agencies, ",")
+	}
 	hash := sha256.Sum256([]byte(data))
-	return fmt.Sprintf("route:%x:%s", hash[:8], strategy)
+	return dataKey(fmt.Sprintf("route:%x:%s", hash[:8], strategy))
 }
 
 // LockKey generates a mutex lock key
@@ -109,12 +165,7 @@ func LockKey(routeKey string) string {
 
 // GetRoute retrieves a cached route
 func GetRoute(ctx context.Context, key string) (*models.Path, error) {
-	client, err := GetClient()
-	if err != nil {
-		return nil, err
-	}
-
-	data, err := client.Get(ctx, key).Bytes()
+	data, err := getBytes(ctx, key)
 	if err == redis.Nil {
 		return nil, nil // cache miss
 	}
@@ -132,30 +183,29 @@ func GetRoute(ctx context.Context, key string) (*models.Path, error) {
 
 // SetRoute caches a route
 func SetRoute(ctx context.Context, key string, path *models.Path, ttl time.Duration) error {
-	client, err := GetClient()
-	if err != nil {
-		return err
-	}
-
 	data, err := json.Marshal(path)
 	if err != nil {
 		return fmt.Errorf("failed to marshal path: %w", err)
 	}
 
-	return client.Set(ctx, key, data, ttl).Err()
+	return setBytes(ctx, key, data, ttl)
 }
 
 // AcquireLock attempts to acquire a distributed lock
 // Returns true if lock was acquired, false if already locked
+// Without Redis there is nothing to coordinate with, so the caller proceeds
+// as the only holder
 func AcquireLock(ctx context.Context, key string, ttl time.Duration) (bool, error) {
-	client, err := GetClient()
+	client, err := redisClient()
 	if err != nil {
-		return false, err
+		return true, nil
 	}
 
 	// Try to set the lock key with NX (only if not exists)
 	ok, err := client.SetNX(ctx, key, "1", ttl).Result()
-	if err != nil {
+	if err := checkRedis(err); err == ErrUnavailable {
+		return true, nil
+	} else if err != nil {
 		return false, err
 	}
 
@@ -164,42 +214,12 @@ func AcquireLock(ctx context.Context, key string, ttl time.Duration) (bool, erro
 
 // ReleaseLock releases a distributed lock
 func ReleaseLock(ctx context.Context, key string) error {
-	client, err := GetClient()
-	if err != nil {
-		return err
-	}
-
-	return client.Del(ctx, key).Err()
-}
-
-// WaitForLock waits for a lock to be released and then retrieves the result
-// This implements the "wait for result" pattern to avoid thundering herd
-func WaitForLock(ctx context.Context, routeKey string, maxWait time.Duration) (*models.Path, error) {
-	client, err := GetClient()
+	client, err := redisClient()
 	if err != nil {
-		return nil, err
-	}
-
-	lockKey := LockKey(routeKey)
-	deadline := time.Now().Add(maxWait)
-
-	for time.Now().Before(deadline) {
-		// Check if lock is released
-		exists, err := client.Exists(ctx, lockKey).Result()
-		if err != nil {
-			return nil, err
-		}
-
-		if exists == 0 {
-			// Lock released, try to get cached result
-			return GetRoute(ctx, routeKey)
-		}
-
-		// Wait a bit before checking again
-		time.Sleep(100 * time.Millisecond)
+		return nil
 	}
 
-	return nil, fmt.Errorf("timeout waiting for lock")
+	return checkRedis(client.Del(ctx, key).Err())
 }
 
 // HealthCheck performs a health check on the Redis connection
@@ -241,46 +261,92 @@ func Stats(ctx context.Context) (map[string]interface{}, error) {
 	}, nil
 }
 
-// GetJSON retrieves a cached JSON value
-func GetJSON(ctx context.Context, key string, dest interface{}) error {
-	c, err := GetClient()
+// KeyspaceStats returns Redis keyspace hits and misses since the server started
+func KeyspaceStats(ctx context.Context) (hits, misses int64, err error) {
+	client, err := GetClient()
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
 
-	data, err := c.Get(ctx, key).Bytes()
+	info, err := client.Info(ctx, "stats").Result()
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
 
-	return json.Unmarshal(data, dest)
+	return infoInt(info, "keyspace_hits"), infoInt(info, "keyspace_misses"), nil
 }
 
-// SetJSON caches a value as JSON
-func SetJSON(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
-	c, err := GetClient()
+// infoInt reads an integer field from Redis INFO output
+func infoInt(info, field string) int64 {
+	for _, line := range strings.Split(info, "\n") {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if ok && name == field {
+			n, _ := strconv.ParseInt(value, 10, 64)
+			return n
+		}
+	}
+	return 0
+}
+
+// GetJSON retrieves a cached JSON value
+func GetJSON(ctx context.Context, key string, dest interface{}) error {
+	data, err := getBytes(ctx, key)
 	if err != nil {
 		return err
 	}
 
+	return json.Unmarshal(data, dest)
+}
+
+// SetJSON caches a value as JSON
+func SetJSON(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
 	data, err := json.Marshal(value)
 	if err != nil {
 		return err
 	}
 
-	return c.Set(ctx, key, data, ttl).Err()
+	return setBytes(ctx, key, data, ttl)
 }
 
 // DeparturesKey generates cache key for stop departures
-func DeparturesKey(stopID string, date string, timeSeconds int) string {
-	// Round time to 5-minute buckets for cache efficiency
-	bucket := (timeSeconds / 300) * 300
-	return fmt.Sprintf("dep:%s:%s:%d", stopID, date, bucket)
+func DeparturesKey(stopID string, date string, timeSeconds int, limit int) string {
+	// Round time to buckets for cache efficiency; the service date keeps
+	// same-time departures of different days apart
+	return dataKey(fmt.Sprintf("dep:%s:%s:%d:%d", stopID, date, timeBucket(timeSeconds), limit))
 }
 
 // ScheduleKey generates cache key for route schedule
 func ScheduleKey(routeID string, direction string, serviceID string) string {
-	return fmt.Sprintf("sched:%s:%s:%s", routeID, direction, serviceID)
+	return dataKey(fmt.Sprintf("sched:%s:%s:%s", routeID, direction, serviceID))
+}
+
+// RouteStopsKey generates cache key for a route's canonical stop sequences
+func RouteStopsKey(routeID string, direction string) string {
+	return dataKey(fmt.Sprintf("routestops:%s:%s", routeID, direction))
+}
+
+// StopRoutesKey generates cache key for the routes serving a stop
+func StopRoutesKey(stopID string) string {
+	return dataKey(fmt.Sprintf("stoproutes:%s", stopID))
+}
+
+// RouteFrequencyKey generates cache key for a route's frequency summary
+func RouteFrequencyKey(routeID string, direction string) string {
+	return dataKey(fmt.Sprintf("routefreq:%s:%s", routeID, direction))
+}
+
+// NetworkStatsKey generates cache key for the network statistics
+// Statistics restricted to some agencies are keyed by them
+func NetworkStatsKey(agencies []string) string {
+	if len(agencies) > 0 {
+		return dataKey("network:stats:" + strings.Join(agencies, ","))
+	}
+	return dataKey("network:stats")
+}
+
+// ServicesKey generates cache key for the services active on a date
+func ServicesKey(date, agencyID string) string {
+	return dataKey(fmt.Sprintf("services:%s:%s", date, agencyID))
 }
 
 func getEnv(key, defaultValue string) string {
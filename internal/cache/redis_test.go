@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInfoInt(t *testing.T) {
+	info := "# Stats\r\ntotal_connections_received:12\r\nkeyspace_hits:4031\r\nkeyspace_misses:977\r\n"
+
+	assert.Equal(t, int64(4031), infoInt(info, "keyspace_hits"))
+	assert.Equal(t, int64(977), infoInt(info, "keyspace_misses"))
+	assert.Equal(t, int64(0), infoInt(info, "evicted_keys"))
+}
+
+func TestVersionedKey(t *testing.T) {
+	assert.Equal(t, "v0:network:stats", versionedKey(0, "network:stats"))
+	assert.Equal(t, "v12:dep:S1:2026-10-16:28800:10", versionedKey(12, "dep:S1:2026-10-16:28800:10"))
+}
+
+func TestKeyClass(t *testing.T) {
+	assert.Equal(t, "route", keyClass("v3:route:0a1b2c:FAST"))
+	assert.Equal(t, "dep", keyClass("v0:dep:S1:2026-10-16:28800:10"))
+	assert.Equal(t, "geocode", keyClass("geocode:0a1b2c"))
+	assert.Equal(t, "network", keyClass("v12:network:stats"))
+	assert.Equal(t, "value", keyClass("value"))
+}
+
+func TestTimeBucket(t *testing.T) {
+	assert.Equal(t, 28800, timeBucket(28800))
+	assert.Equal(t, 28800, timeBucket(29099))
+	assert.Equal(t, 29100, timeBucket(29100))
+	assert.Equal(t, 90000, timeBucket(90120)) // 25:02, after midnight in GTFS time
+}
+
+// withDataVersion pins the data version so key builders never ask Redis
+func withDataVersion(t *testing.T, v int64) {
+	versionMu.Lock()
+	prev, prevAt := dataVersion, dataVersionAt
+	dataVersion, dataVersionAt = v, time.Now()
+	versionMu.Unlock()
+
+	t.Cleanup(func() {
+		versionMu.Lock()
+		dataVersion, dataVersionAt = prev, prevAt
+		versionMu.Unlock()
+	})
+}
+
+func TestNetworkStatsKey(t *testing.T) {
+	withDataVersion(t, 7)
+
+	assert.Equal(t, "v7:network:stats", NetworkStatsKey(nil))
+	// Keys restricted to some agencies never share the whole network's entry
+	assert.Equal(t, "v7:network:stats:aftu,dakar_dem_dikk", NetworkStatsKey([]string{"aftu", "dakar_dem_dikk"}))
+	assert.NotEqual(t, NetworkStatsKey([]string{"aftu"}), NetworkStatsKey([]string{"aftu", "dakar_dem_dikk"}))
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DataVersionKey holds the data version, a counter bumped after every import
+// and graph rebuild
+const DataVersionKey = "data:version"
+
+// versionRefresh is how long an instance reuses the data version it read
+// It bounds how long another instance keeps serving the previous version
+const versionRefresh = 5 * time.Second
+
+var (
+	versionMu     sync.Mutex
+	dataVersion   int64
+	dataVersionAt time.Time
+)
+
+// DataVersion returns the current data version (0 before the first bump)
+// When Redis is unreachable the last known version is kept
+func DataVersion(ctx context.Context) int64 {
+	versionMu.Lock()
+	defer versionMu.Unlock()
+
+	if !dataVersionAt.IsZero() && time.Since(dataVersionAt) < versionRefresh {
+		return dataVersion
+	}
+
+	c, err := redisClient()
+	if err != nil {
+		return dataVersion
+	}
+
+	v, err := c.Get(ctx, DataVersionKey).Int64()
+	if err != nil && err != redis.Nil {
+		if checkRedis(err) == ErrUnavailable {
+			return dataVersion
+		}
+		logger.ErrorContext(ctx, "Data version read error", "error", err)
+		return dataVersion
+	}
+
+	dataVersion = v
+	dataVersionAt = time.Now()
+	return dataVersion
+}
+
+// BumpDataVersion moves every data-derived cache key to a new namespace, so
+// routes, departures and schedules cached before an import are never served
+// again; the old entries expire with their TTL
+func BumpDataVersion(ctx context.Context) (int64, error) {
+	c, err := GetClient()
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := c.Incr(ctx, DataVersionKey).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	versionMu.Lock()
+	dataVersion = v
+	dataVersionAt = time.Now()
+	versionMu.Unlock()
+
+	return v, nil
+}
+
+// dataKey prefixes a key derived from transit data with the data version
+func dataKey(key string) string {
+	return versionedKey(DataVersion(context.Background()), key)
+}
+
+// versionedKey builds the key of a data version namespace
+func versionedKey(version int64, key string) string {
+	return fmt.Sprintf("v%d:%s", version, key)
+}
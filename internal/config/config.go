@@ -0,0 +1,240 @@
+// Package config loads the configuration file shared by the PassBi binaries
+// The file, named by PASSBI_CONFIG, is YAML: each of its settings stands for
+// the environment variable the packages read, and a variable already set in
+// the environment overrides it. Any other variable goes under env. Setup
+// validates the result before a binary starts
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PathEnv names the configuration file; without it, only the environment
+// configures the binaries
+const PathEnv = "PASSBI_CONFIG"
+
+// setting is a key of the file, section.name, and the variable it sets
+type setting struct {
+	key   string
+	env   string
+	check func(string) error // nil accepts any value
+}
+
+// settings are the keys of the file, by section
+var settings = []setting{
+	{"db.host", "DB_HOST", nil},
+	{"db.port", "DB_PORT", port},
+	{"db.name", "DB_NAME", nil},
+	{"db.user", "DB_USER", nil},
+	{"db.password", "DB_PASSWORD", nil},
+	{"db.sslmode", "DB_SSLMODE", oneOf("disable", "allow", "prefer", "require", "verify-ca", "verify-full")},
+	{"db.min_conns", "DB_MIN_CONNS", atLeast(0)},
+	{"db.max_conns", "DB_MAX_CONNS", atLeast(1)},
+	{"db.statement_timeout", "DB_STATEMENT_TIMEOUT", duration(0)},
+	{"db.slow_query_ms", "SLOW_QUERY_MS", atLeast(0)},
+	{"db.replica_dsn", "DB_REPLICA_DSN", nil},
+	{"db.replica_max_lag", "DB_REPLICA_MAX_LAG", duration(time.Nanosecond)},
+
+	{"redis.host", "REDIS_HOST", nil},
+	{"redis.port", "REDIS_PORT", port},
+	{"redis.password", "REDIS_PASSWORD", nil},
+	{"redis.db", "REDIS_DB", atLeast(0)},
+	{"redis.tls", "REDIS_TLS_ENABLED", boolean},
+
+	{"cache.ttl", "CACHE_TTL", duration(0)},
+	{"cache.mutex_ttl", "CACHE_MUTEX_TTL", duration(0)},
+	{"cache.local_size", "CACHE_LOCAL_SIZE", atLeast(0)},
+	{"cache.local_ttl", "CACHE_LOCAL_TTL", duration(0)},
+
+	{"api.port", "API_PORT", port},
+	{"api.request_timeout", "REQUEST_TIMEOUT", duration(0)},
+
+	{"routing.max_explored_nodes", "MAX_EXPLORED_NODES", atLeast(1)},
+	{"routing.timeout", "ROUTE_TIMEOUT", duration(time.Nanosecond)},
+
+	{"graph.max_walk_distance", "MAX_WALK_DISTANCE", positive},
+	{"graph.walking_speed", "WALKING_SPEED", positive},
+	{"graph.transfer_time", "TRANSFER_TIME", atLeast(0)},
+	{"graph.reload_on_notify", "GRAPH_RELOAD_ON_NOTIFY", boolean},
+
+	{"features.auth", "ENABLE_AUTH", boolean},
+	{"features.rate_limit", "ENABLE_RATE_LIMIT", boolean},
+	{"features.analytics", "ENABLE_ANALYTICS", boolean},
+	{"features.key_expiry_reminders", "KEY_EXPIRY_REMINDERS", boolean},
+	{"features.anomaly_detection", "ANOMALY_DETECTION", boolean},
+	{"features.headway_alerts", "HEADWAY_ALERTS", boolean},
+
+	{"log.level", "LOG_LEVEL", oneOfFold("debug", "info", "warn", "warning", "error")},
+	{"log.format", "LOG_FORMAT", oneOfFold("json", "text")},
+}
+
+// Parse returns the variables a configuration file sets, by name
+// Unknown keys are refused, so a misspelt setting is not silently ignored
+func Parse(data []byte) (map[string]string, error) {
+	var file map[string]map[string]string
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]string, len(settings))
+	for _, s := range settings {
+		keys[s.key] = s.env
+	}
+	vars := make(map[string]string)
+	var unknown []string
+	for section, values := range file {
+		for name, value := range values {
+			if section == "env" {
+				vars[name] = value
+				continue
+			}
+			env, ok := keys[section+"."+name]
+			if !ok {
+				unknown = append(unknown, section+"."+name)
+				continue
+			}
+			vars[env] = value
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown settings: %s", strings.Join(unknown, ", "))
+	}
+	return vars, nil
+}
+
+// Load sets the variables of the file at path that the environment does not
+// set already
+func Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	vars, err := Parse(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for name, value := range vars {
+		if _, ok := os.LookupEnv(name); !ok {
+			os.Setenv(name, value)
+		}
+	}
+	return nil
+}
+
+// Validate checks the values of the settings read by lookup, after Load
+func Validate(lookup func(string) (string, bool)) error {
+	var errs []error
+	for _, s := range settings {
+		v, ok := lookup(s.env)
+		if !ok || v == "" || s.check == nil {
+			continue
+		}
+		if err := s.check(v); err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s) = %q: %w", s.env, s.key, v, err))
+		}
+	}
+
+	minConns, errMin := strconv.Atoi(lookupOr(lookup, "DB_MIN_CONNS", "5"))
+	maxConns, errMax := strconv.Atoi(lookupOr(lookup, "DB_MAX_CONNS", "20"))
+	if errMin == nil && errMax == nil && minConns > maxConns {
+		errs = append(errs, fmt.Errorf("DB_MIN_CONNS (%d) is above DB_MAX_CONNS (%d)", minConns, maxConns))
+	}
+	return errors.Join(errs...)
+}
+
+func lookupOr(lookup func(string) (string, bool), name, defaultValue string) string {
+	if v, ok := lookup(name); ok && v != "" {
+		return v
+	}
+	return defaultValue
+}
+
+// Setup loads the file named by PASSBI_CONFIG, when set, and validates the
+// configuration
+func Setup() error {
+	if path := os.Getenv(PathEnv); path != "" {
+		if err := Load(path); err != nil {
+			return err
+		}
+	}
+	return Validate(os.LookupEnv)
+}
+
+// MustSetup runs Setup first thing in a binary, before logging is set up
+// from the configuration, and exits on error
+func MustSetup(binary string) {
+	if err := Setup(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: invalid configuration:\n%v\n", binary, err)
+		os.Exit(1)
+	}
+}
+
+func port(v string) error {
+	if n, err := strconv.Atoi(v); err != nil || n < 1 || n > 65535 {
+		return errors.New("must be a port number")
+	}
+	return nil
+}
+
+func atLeast(min int) func(string) error {
+	return func(v string) error {
+		if n, err := strconv.Atoi(v); err != nil || n < min {
+			return fmt.Errorf("must be a whole number of at least %d", min)
+		}
+		return nil
+	}
+}
+
+func positive(v string) error {
+	if f, err := strconv.ParseFloat(v, 64); err != nil || f <= 0 {
+		return errors.New("must be a positive number")
+	}
+	return nil
+}
+
+// duration accepts durations such as "30s" or "5m" of at least min
+func duration(min time.Duration) func(string) error {
+	return func(v string) error {
+		if d, err := time.ParseDuration(v); err != nil || d < min {
+			if min > 0 {
+				return errors.New(`must be a positive duration such as "30s" or "5m"`)
+			}
+			return errors.New(`must be a duration such as "30s" or "5m"`)
+		}
+		return nil
+	}
+}
+
+func boolean(v string) error {
+	if _, err := strconv.ParseBool(v); err != nil {
+		return errors.New(`must be "true" or "false"`)
+	}
+	return nil
+}
+
+func oneOf(values ...string) func(string) error {
+	return func(v string) error {
+		for _, allowed := range values {
+			if v == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(values, ", "))
+	}
+}
+
+// oneOfFold is oneOf for values read regardless of case
+func oneOfFold(values ...string) func(string) error {
+	return func(v string) error {
+		return oneOf(values...)(strings.ToLower(v))
+	}
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const sample = `
+db:
+  host: db.internal
+  port: 5433
+  sslmode: require
+redis:
+  tls: true
+routing:
+  timeout: 5s
+graph:
+  walking_speed: 1.2
+features:
+  rate_limit: false
+env:
+  HEADWAY_ALERT_AFTER: 10m
+`
+
+func TestParse(t *testing.T) {
+	vars, err := Parse([]byte(sample))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, map[string]string{
+		"DB_HOST":             "db.internal",
+		"DB_PORT":             "5433",
+		"DB_SSLMODE":          "require",
+		"REDIS_TLS_ENABLED":   "true",
+		"ROUTE_TIMEOUT":       "5s",
+		"WALKING_SPEED":       "1.2",
+		"ENABLE_RATE_LIMIT":   "false",
+		"HEADWAY_ALERT_AFTER": "10m",
+	}, vars)
+
+	_, err = Parse([]byte("db:\n  hots: localhost\nroutng:\n  timeout: 5s\n"))
+	assert.EqualError(t, err, "unknown settings: db.hots, routng.timeout")
+
+	_, err = Parse([]byte("db: localhost\n"))
+	assert.Error(t, err, "a section is a mapping")
+
+	vars, err = Parse(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, vars)
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passbi.yaml")
+	if !assert.NoError(t, os.WriteFile(path, []byte(sample), 0o600)) {
+		return
+	}
+	t.Setenv("DB_HOST", "override")
+	t.Setenv("DB_PORT", "")
+	os.Unsetenv("DB_PORT")
+	t.Setenv("ROUTE_TIMEOUT", "")
+	os.Unsetenv("ROUTE_TIMEOUT")
+
+	assert.NoError(t, Load(path))
+	assert.Equal(t, "override", os.Getenv("DB_HOST"), "the environment wins")
+	assert.Equal(t, "5433", os.Getenv("DB_PORT"))
+	assert.Equal(t, "5s", os.Getenv("ROUTE_TIMEOUT"))
+
+	assert.Error(t, Load(filepath.Join(t.TempDir(), "missing.yaml")))
+}
+
+func TestValidate(t *testing.T) {
+	env := map[string]string{
+		"DB_PORT":            "5432",
+		"DB_SSLMODE":         "required",
+		"DB_MIN_CONNS":       "30",
+		"ROUTE_TIMEOUT":      "0s",
+		"MAX_EXPLORED_NODES": "lots",
+		"ENABLE_AUTH":        "yes",
+		"LOG_LEVEL":          "DEBUG",
+		"WALKING_SPEED":      "",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	err := Validate(lookup)
+	if assert.Error(t, err) {
+		msg := err.Error()
+		assert.Contains(t, msg, `DB_SSLMODE (db.sslmode) = "required": must be one of`)
+		assert.Contains(t, msg, `ROUTE_TIMEOUT (routing.timeout) = "0s": must be a positive duration`)
+		assert.Contains(t, msg, `MAX_EXPLORED_NODES (routing.max_explored_nodes) = "lots"`)
+		assert.Contains(t, msg, `ENABLE_AUTH (features.auth) = "yes"`)
+		assert.Contains(t, msg, "DB_MIN_CONNS (30) is above DB_MAX_CONNS (20)")
+		assert.NotContains(t, msg, "DB_PORT")
+		assert.NotContains(t, msg, "LOG_LEVEL")
+		assert.NotContains(t, msg, "WALKING_SPEED")
+	}
+
+	assert.NoError(t, Validate(func(string) (string, bool) { return "", false }))
+}
+
+func TestExampleFile(t *testing.T) {
+	data, err := os.ReadFile("../../passbi.example.yaml")
+	if !assert.NoError(t, err) {
+		return
+	}
+	vars, err := Parse(data)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "5432", vars["DB_PORT"])
+	assert.NoError(t, Validate(func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}))
+}
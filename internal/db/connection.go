@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/retry"
+	"github.com/passbi/passbi_core/internal/tracing"
 )
 
 var (
@@ -28,6 +31,20 @@ type Config struct {
 	SSLMode  string
 	MinConns int32
 	MaxConns int32
+
+	// SlowQuery is the duration above which a query is logged (0 disables)
+	SlowQuery time.Duration
+	// QueryLogSample is the share of all queries logged with their duration,
+	// rows and caller (0 disables, 1 logs every query)
+	QueryLogSample float64
+	// StatementTimeout is the statement_timeout of every connection, which
+	// the server enforces even when the client is gone (0 disables)
+	StatementTimeout time.Duration
+
+	// ReplicaDSNs are read replicas serving ReadDB (none: the primary does)
+	ReplicaDSNs []string
+	// ReplicaMaxLag is the replication delay above which a replica is skipped
+	ReplicaMaxLag time.Duration
 }
 
 // LoadConfigFromEnv loads database configuration from environment variables
@@ -35,6 +52,26 @@ func LoadConfigFromEnv() *Config {
 	port, _ := strconv.Atoi(getEnv("DB_PORT", "5432"))
 	minConns, _ := strconv.Atoi(getEnv("DB_MIN_CONNS", "5"))
 	maxConns, _ := strconv.Atoi(getEnv("DB_MAX_CONNS", "20"))
+	slowMs, _ := strconv.Atoi(getEnv("SLOW_QUERY_MS", "500"))
+	querySample, err := strconv.ParseFloat(getEnv("DB_QUERY_LOG_SAMPLE", "0"), 64)
+	if err != nil || querySample < 0 {
+		querySample = 0
+	}
+	statementTimeout, err := time.ParseDuration(getEnv("DB_STATEMENT_TIMEOUT", "0"))
+	if err != nil || statementTimeout < 0 {
+		statementTimeout = 0
+	}
+	maxLag, err := time.ParseDuration(getEnv("DB_REPLICA_MAX_LAG", "10s"))
+	if err != nil || maxLag <= 0 {
+		maxLag = 10 * time.Second
+	}
+
+	var replicaDSNs []string
+	for _, dsn := range strings.Split(os.Getenv("DB_REPLICA_DSN"), ",") {
+		if dsn = strings.TrimSpace(dsn); dsn != "" {
+			replicaDSNs = append(replicaDSNs, dsn)
+		}
+	}
 
 	return &Config{
 		Host:     getEnv("DB_HOST", "localhost"),
@@ -45,6 +82,13 @@ func LoadConfigFromEnv() *Config {
 		SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		MinConns: int32(minConns),
 		MaxConns: int32(maxConns),
+
+		SlowQuery:        time.Duration(slowMs) * time.Millisecond,
+		QueryLogSample:   querySample,
+		StatementTimeout: statementTimeout,
+
+		ReplicaDSNs:   replicaDSNs,
+		ReplicaMaxLag: maxLag,
 	}
 }
 
@@ -57,6 +101,21 @@ func GetDB() (*pgxpool.Pool, error) {
 	return pool, poolErr
 }
 
+// Connect opens the global pool like GetDB, retrying with backoff while the
+// database is unreachable (a deploy restarting it along with the service)
+// Call it before GetDB
+func Connect(ctx context.Context, r retry.Config) (*pgxpool.Pool, error) {
+	poolOnce.Do(func() {
+		config := LoadConfigFromEnv()
+		poolErr = retry.Do(ctx, r, "database", func(context.Context) error {
+			var err error
+			pool, err = initPool(config)
+			return err
+		})
+	})
+	return pool, poolErr
+}
+
 // InitPoolWithConfig initializes the pool with a custom config (useful for testing)
 func InitPoolWithConfig(config *Config) (*pgxpool.Pool, error) {
 	return initPool(config)
@@ -73,7 +132,35 @@ func initPool(config *Config) (*pgxpool.Pool, error) {
 		config.Password,
 		config.SSLMode,
 	)
+	return openPool(connString, config)
+}
+
+// openPool connects a pool to connString with the pool settings of config
+func openPool(connString string, config *Config) (*pgxpool.Pool, error) {
+	poolConfig, err := newPoolConfig(connString, config)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create connection pool: %w", err)
+	}
+
+	// Test connection
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("unable to ping database: %w", err)
+	}
 
+	return pool, nil
+}
+
+// newPoolConfig parses connString and applies the pool settings of config
+func newPoolConfig(connString string, config *Config) (*pgxpool.Config, error) {
 	poolConfig, err := pgxpool.ParseConfig(connString)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse connection string: %w", err)
@@ -86,31 +173,36 @@ func initPool(config *Config) (*pgxpool.Pool, error) {
 	poolConfig.MaxConnIdleTime = 30 * time.Minute
 	poolConfig.HealthCheckPeriod = time.Minute
 
+	// Queries made within traced requests get their own span; every query is
+	// measured, and slow and sampled ones are logged with their caller
+	poolConfig.ConnConfig.Tracer = queryTracer{
+		slow:   config.SlowQuery,
+		sample: config.QueryLogSample,
+		next:   tracing.QueryTracer{},
+	}
+
 	// Disable prepared statements for Supabase pooler (transaction mode)
 	// This prevents "prepared statement already exists" errors
-	if config.Port == 6543 {
+	if poolConfig.ConnConfig.Port == 6543 {
 		poolConfig.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
-	if err != nil {
-		return nil, fmt.Errorf("unable to create connection pool: %w", err)
-	}
-
-	// Test connection
-	if err := pool.Ping(ctx); err != nil {
-		pool.Close()
-		return nil, fmt.Errorf("unable to ping database: %w", err)
+	// The transaction pooler rejects startup parameters; there the request
+	// deadlines (canceled queries) are the only timeout
+	if config.StatementTimeout > 0 {
+		if poolConfig.ConnConfig.Port == 6543 {
+			logger.Warn("DB_STATEMENT_TIMEOUT is ignored behind the transaction pooler")
+		} else {
+			poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(config.StatementTimeout.Milliseconds(), 10)
+		}
 	}
 
-	return pool, nil
+	return poolConfig, nil
 }
 
-// Close closes the database connection pool
+// Close closes the database connection pool and the replica pools
 func Close() {
+	closeReplicas()
 	if pool != nil {
 		pool.Close()
 	}
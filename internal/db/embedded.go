@@ -0,0 +1,73 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrEmbedded is returned for the pool in embedded mode, where there is no
+// database
+var ErrEmbedded = errors.New("no database in embedded mode")
+
+// EmbeddedConfig lists the GTFS feeds the embedded mode serves from memory
+type EmbeddedConfig struct {
+	Feeds map[string]string // agency ID -> GTFS zip path
+}
+
+// EmbeddedConfigFromEnv reads EMBEDDED_GTFS, a comma-separated list of
+// agency=path.zip; it returns nil when the variable is unset
+func EmbeddedConfigFromEnv() (*EmbeddedConfig, error) {
+	return parseEmbeddedFeeds(os.Getenv("EMBEDDED_GTFS"))
+}
+
+func parseEmbeddedFeeds(value string) (*EmbeddedConfig, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	config := &EmbeddedConfig{Feeds: make(map[string]string)}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		agencyID, path, ok := strings.Cut(entry, "=")
+		agencyID, path = strings.TrimSpace(agencyID), strings.TrimSpace(path)
+		if !ok || agencyID == "" || path == "" {
+			return nil, fmt.Errorf("invalid EMBEDDED_GTFS entry %q, expected agency=path.zip", entry)
+		}
+		if _, dup := config.Feeds[agencyID]; dup {
+			return nil, fmt.Errorf("agency %q is listed twice in EMBEDDED_GTFS", agencyID)
+		}
+		config.Feeds[agencyID] = path
+	}
+	return config, nil
+}
+
+// Agencies returns the agency IDs of the feeds, sorted
+func (c *EmbeddedConfig) Agencies() []string {
+	agencies := make([]string, 0, len(c.Feeds))
+	for agencyID := range c.Feeds {
+		agencies = append(agencies, agencyID)
+	}
+	sort.Strings(agencies)
+	return agencies
+}
+
+// UseEmbedded makes GetDB, ReadDB and Connect return ErrEmbedded instead of
+// connecting; call it before any of them
+func UseEmbedded() {
+	poolOnce.Do(func() {
+		poolErr = ErrEmbedded
+	})
+	replicasOnce.Do(func() {})
+}
+
+// Embedded reports whether UseEmbedded was called
+func Embedded() bool {
+	_, err := GetDB()
+	return errors.Is(err, ErrEmbedded)
+}
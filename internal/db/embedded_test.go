@@ -0,0 +1,28 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEmbeddedFeeds(t *testing.T) {
+	config, err := parseEmbeddedFeeds("")
+	assert.NoError(t, err)
+	assert.Nil(t, config)
+
+	config, err = parseEmbeddedFeeds(" ter = gtfs_folder/gtfs_TER.zip, ,brt=gtfs_folder/gtfs_BRT.zip")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, map[string]string{
+		"ter": "gtfs_folder/gtfs_TER.zip",
+		"brt": "gtfs_folder/gtfs_BRT.zip",
+	}, config.Feeds)
+	assert.Equal(t, []string{"brt", "ter"}, config.Agencies())
+
+	for _, value := range []string{"gtfs_TER.zip", "ter=", "=gtfs_TER.zip", "ter=a.zip,ter=b.zip"} {
+		_, err := parseEmbeddedFeeds(value)
+		assert.Error(t, err, value)
+	}
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/passbi/passbi_core/internal/logging"
+	"github.com/passbi/passbi_core/internal/metrics"
+	"github.com/passbi/passbi_core/internal/tracing"
+)
+
+var logger = logging.For("db")
+
+// queryOps are the SQL operations counted separately; others count as "other"
+var queryOps = []string{"SELECT", "INSERT", "UPDATE", "DELETE", "WITH", "other"}
+
+// opStats are the metrics of the queries of one operation
+type opStats struct {
+	duration *metrics.Histogram
+	rows     atomic.Int64
+	errors   atomic.Int64
+	slow     atomic.Int64
+	sampled  atomic.Int64
+}
+
+var statsByOp = map[string]*opStats{}
+
+func init() {
+	for _, op := range queryOps {
+		statsByOp[op] = &opStats{
+			duration: metrics.NewHistogram(0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5),
+		}
+	}
+	metrics.Register(func(w *metrics.Writer) {
+		for _, op := range queryOps {
+			s := statsByOp[op]
+			w.Histogram("passbi_db_query_seconds", "Query duration", s.duration, metrics.L("operation", op))
+		}
+		for _, op := range queryOps {
+			w.Counter("passbi_db_query_rows_total", "Rows returned or affected by queries", float64(statsByOp[op].rows.Load()), metrics.L("operation", op))
+		}
+		for _, op := range queryOps {
+			w.Counter("passbi_db_query_errors_total", "Queries that failed (no rows is not a failure)", float64(statsByOp[op].errors.Load()), metrics.L("operation", op))
+		}
+		for _, op := range queryOps {
+			w.Counter("passbi_db_slow_queries_total", "Queries slower than SLOW_QUERY_MS", float64(statsByOp[op].slow.Load()), metrics.L("operation", op))
+		}
+		for _, op := range queryOps {
+			w.Counter("passbi_db_queries_logged_total", "Queries logged by DB_QUERY_LOG_SAMPLE", float64(statsByOp[op].sampled.Load()), metrics.L("operation", op))
+		}
+	})
+}
+
+// statsFor returns the metrics of the operation of sql
+func statsFor(op string) *opStats {
+	if s, ok := statsByOp[op]; ok {
+		return s
+	}
+	return statsByOp["other"]
+}
+
+// queryTracer records the duration, rows and errors of every query, logs
+// queries slower than slow and a share sample of all queries with their
+// caller, then hands the query to next (query spans)
+type queryTracer struct {
+	slow   time.Duration
+	sample float64
+	next   pgx.QueryTracer
+}
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	at      time.Time
+	sql     string
+	sampled bool
+	pcs     [16]uintptr
+	npcs    int
+}
+
+// TraceQueryStart implements pgx.QueryTracer
+// The stack is captured here, where the caller is still on it, and only
+// resolved when the query is logged
+func (t queryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	start := &queryStart{at: time.Now(), sql: data.SQL, sampled: t.sample > 0 && rand.Float64() < t.sample}
+	if t.slow > 0 || start.sampled {
+		start.npcs = runtime.Callers(2, start.pcs[:])
+	}
+	ctx = context.WithValue(ctx, queryStartKey{}, start)
+	return t.next.TraceQueryStart(ctx, conn, data)
+}
+
+// TraceQueryEnd implements pgx.QueryTracer
+func (t queryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	t.next.TraceQueryEnd(ctx, conn, data)
+
+	start, ok := ctx.Value(queryStartKey{}).(*queryStart)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(start.at)
+	op := tracing.SQLOperation(start.sql)
+	stats := statsFor(op)
+	stats.duration.Observe(elapsed.Seconds())
+	stats.rows.Add(data.CommandTag.RowsAffected())
+	failed := data.Err != nil && data.Err != pgx.ErrNoRows
+	if failed {
+		stats.errors.Add(1)
+	}
+
+	slow := t.slow > 0 && elapsed >= t.slow
+	if !slow && !start.sampled {
+		return
+	}
+
+	args := []any{
+		"duration_ms", float64(elapsed.Microseconds()) / 1000,
+		"operation", op,
+		"rows", data.CommandTag.RowsAffected(),
+		"caller", queryCaller(start.pcs[:start.npcs]),
+		"statement", tracing.SQLStatement(start.sql),
+	}
+	if failed {
+		args = append(args, "error", data.Err)
+	}
+	if slow {
+		stats.slow.Add(1)
+		logger.WarnContext(ctx, "Slow query", append(args, "threshold_ms", t.slow.Milliseconds())...)
+		return
+	}
+	stats.sampled.Add(1)
+	logger.InfoContext(ctx, "Query", args...)
+}
+
+// queryCaller names the first function on pcs outside pgx and this package,
+// e.g. "api.StopDepartures (schedule_handlers.go:120)"
+func queryCaller(pcs []uintptr) string {
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		if f.Function != "" && !driverFrame(f.Function) {
+			name := f.Function
+			if i := strings.LastIndex(name, "/"); i >= 0 {
+				name = name[i+1:]
+			}
+			return fmt.Sprintf("%s (%s:%d)", name, filepath.Base(f.File), f.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+func driverFrame(function string) bool {
+	return strings.HasPrefix(function, "github.com/jackc/") ||
+		strings.HasPrefix(function, "runtime.") ||
+		strings.Contains(function, "/internal/db.")
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/passbi/passbi_core/internal/tracing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryTracerMetrics(t *testing.T) {
+	tracer := queryTracer{slow: time.Hour, sample: 1, next: tracing.QueryTracer{}}
+	stats := statsFor("UPDATE")
+	count, rows, errs, sampled := stats.duration.Count(), stats.rows.Load(), stats.errors.Load(), stats.sampled.Load()
+
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "UPDATE trip SET headsign = $1"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("UPDATE 3")})
+	ctx = tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "UPDATE trip SET headsign = $1"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("deadlock detected")})
+
+	assert.Equal(t, count+2, stats.duration.Count())
+	assert.Equal(t, rows+3, stats.rows.Load())
+	assert.Equal(t, errs+1, stats.errors.Load())
+	assert.Equal(t, sampled+2, stats.sampled.Load())
+
+	assert.Same(t, statsByOp["other"], statsFor("VACUUM"))
+}
+
+func TestQueryCaller(t *testing.T) {
+	var pcs [16]uintptr
+	n := runtime.Callers(1, pcs[:])
+	// This test is in package db, so the first frame outside it is the runner
+	assert.True(t, strings.HasPrefix(queryCaller(pcs[:n]), "testing.tRunner (testing.go:"), queryCaller(pcs[:n]))
+	assert.Equal(t, "unknown", queryCaller(nil))
+
+	assert.True(t, driverFrame("github.com/jackc/pgx/v5/pgxpool.(*Pool).QueryRow"))
+	assert.True(t, driverFrame("github.com/passbi/passbi_core/internal/db.GetDB"))
+	assert.False(t, driverFrame("github.com/passbi/passbi_core/internal/api.StopDepartures"))
+	assert.False(t, driverFrame("github.com/passbi/passbi_core/internal/dbsync.Run"))
+}
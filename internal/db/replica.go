@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/metrics"
+)
+
+// replicaCheckInterval is how often replicas are checked for health and lag
+const replicaCheckInterval = 5 * time.Second
+
+// replica is a read replica and its last health check
+type replica struct {
+	name    string // host:port, for logs and metrics
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+	lagNs   atomic.Int64
+}
+
+var (
+	replicas     []*replica
+	replicasOnce sync.Once
+	replicaNext  atomic.Uint64
+	replicaStop  = make(chan struct{})
+	replicaDone  sync.WaitGroup
+	stopReplicas sync.Once
+
+	readsPrimary atomic.Int64
+	readsReplica atomic.Int64
+)
+
+func init() {
+	metrics.Register(func(w *metrics.Writer) {
+		w.Counter("passbi_db_reads_total", "Read-only pools handed out by target", float64(readsPrimary.Load()), metrics.L("target", "primary"))
+		w.Counter("passbi_db_reads_total", "Read-only pools handed out by target", float64(readsReplica.Load()), metrics.L("target", "replica"))
+		replicas := loadReplicas()
+		for _, r := range replicas {
+			w.Gauge("passbi_db_replica_healthy", "Whether a read replica is reachable and within DB_REPLICA_MAX_LAG", boolGauge(r.healthy.Load()), metrics.L("replica", r.name))
+		}
+		for _, r := range replicas {
+			w.Gauge("passbi_db_replica_lag_seconds", "Replication delay of a read replica at its last check", time.Duration(r.lagNs.Load()).Seconds(), metrics.L("replica", r.name))
+		}
+	})
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// ReadDB returns a pool for read-only queries: a healthy replica, in turn,
+// or the primary when no replica is configured or healthy
+// Replicas may lag the primary by up to DB_REPLICA_MAX_LAG, so writes, and
+// reads that must see them, go through GetDB
+func ReadDB() (*pgxpool.Pool, error) {
+	replicas := loadReplicas()
+	if n := uint64(len(replicas)); n > 0 {
+		start := replicaNext.Add(1)
+		for i := uint64(0); i < n; i++ {
+			if r := replicas[(start+i)%n]; r.healthy.Load() {
+				readsReplica.Add(1)
+				return r.pool, nil
+			}
+		}
+	}
+
+	readsPrimary.Add(1)
+	return GetDB()
+}
+
+// loadReplicas returns the replicas, set up from the environment on first use
+func loadReplicas() []*replica {
+	replicasOnce.Do(func() {
+		initReplicas(LoadConfigFromEnv())
+	})
+	return replicas
+}
+
+// initReplicas creates the replica pools and starts checking them
+// Pools connect lazily and replicas are only used once a check passed, so
+// an unreachable replica never delays a request
+func initReplicas(config *Config) {
+	for _, dsn := range config.ReplicaDSNs {
+		poolConfig, err := newPoolConfig(dsn, config)
+		if err != nil {
+			logger.Warn("Ignoring read replica", "error", err)
+			continue
+		}
+		pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+		if err != nil {
+			logger.Warn("Ignoring read replica", "error", err)
+			continue
+		}
+		name := fmt.Sprintf("%s:%d", poolConfig.ConnConfig.Host, poolConfig.ConnConfig.Port)
+		replicas = append(replicas, &replica{name: name, pool: pool})
+	}
+	if len(replicas) == 0 {
+		return
+	}
+
+	logger.Info("Read replicas configured", "replicas", len(replicas), "max_lag", config.ReplicaMaxLag.String())
+	replicaDone.Add(1)
+	go func() {
+		defer replicaDone.Done()
+		ticker := time.NewTicker(replicaCheckInterval)
+		defer ticker.Stop()
+		for {
+			for _, r := range replicas {
+				r.check(config.ReplicaMaxLag)
+			}
+			select {
+			case <-replicaStop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// replicationLag is 0 when the replica has replayed all it received, so an
+// idle primary does not make its replicas look behind
+const replicationLag = `
+	SELECT CASE
+		WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END
+`
+
+// check marks the replica healthy when it answers and is within maxLag
+func (r *replica) check(maxLag time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var lagSeconds float64
+	err := r.pool.QueryRow(ctx, replicationLag).Scan(&lagSeconds)
+	lag := time.Duration(lagSeconds * float64(time.Second))
+	if err == nil {
+		r.lagNs.Store(int64(lag))
+	}
+
+	healthy := err == nil && lag <= maxLag
+	if was := r.healthy.Swap(healthy); was == healthy {
+		return
+	}
+	switch {
+	case healthy:
+		logger.Info("Read replica in use", "replica", r.name, "lag", lag.String())
+	case err != nil:
+		logger.Warn("Read replica unreachable, reading from the primary", "replica", r.name, "error", err)
+	default:
+		logger.Warn("Read replica lagging, reading from the primary", "replica", r.name, "lag", lag.String(), "max_lag", maxLag.String())
+	}
+}
+
+// closeReplicas stops the health checks and closes the replica pools
+func closeReplicas() {
+	// Replicas are no longer set up once closing
+	replicasOnce.Do(func() {})
+	stopReplicas.Do(func() {
+		close(replicaStop)
+		replicaDone.Wait()
+		for _, r := range replicas {
+			r.pool.Close()
+		}
+	})
+}
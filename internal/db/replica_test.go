@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfigReplicas(t *testing.T) {
+	t.Setenv("DB_REPLICA_DSN", " postgres://ro@replica-1:5432/passbi , ,host=replica-2 port=5433")
+	t.Setenv("DB_REPLICA_MAX_LAG", "30s")
+
+	config := LoadConfigFromEnv()
+	assert.Equal(t, []string{"postgres://ro@replica-1:5432/passbi", "host=replica-2 port=5433"}, config.ReplicaDSNs)
+	assert.Equal(t, 30*time.Second, config.ReplicaMaxLag)
+
+	t.Setenv("DB_REPLICA_DSN", "")
+	t.Setenv("DB_REPLICA_MAX_LAG", "soon")
+	config = LoadConfigFromEnv()
+	assert.Empty(t, config.ReplicaDSNs)
+	assert.Equal(t, 10*time.Second, config.ReplicaMaxLag)
+}
+
+func TestNewPoolConfig(t *testing.T) {
+	config := &Config{MinConns: 1, MaxConns: 4, SlowQuery: time.Second}
+
+	poolConfig, err := newPoolConfig("postgres://ro@replica-1:6543/passbi", config)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, int32(4), poolConfig.MaxConns)
+	assert.Equal(t, "replica-1", poolConfig.ConnConfig.Host)
+	assert.IsType(t, queryTracer{}, poolConfig.ConnConfig.Tracer)
+	// Pooler port: no prepared statements
+	assert.Equal(t, pgx.QueryExecModeSimpleProtocol, poolConfig.ConnConfig.DefaultQueryExecMode)
+
+	_, err = newPoolConfig("postgres://replica-1:notaport/passbi", config)
+	assert.Error(t, err)
+}
+
+func TestReadDBUsesHealthyReplicas(t *testing.T) {
+	// Pools without MinConns do not connect until used
+	newReplica := func(name string) *replica {
+		poolConfig, err := newPoolConfig("postgres://ro@"+name+":5432/passbi", &Config{MaxConns: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(pool.Close)
+		return &replica{name: name, pool: pool}
+	}
+	lagging, healthy := newReplica("replica-1"), newReplica("replica-2")
+	healthy.healthy.Store(true)
+
+	replicasOnce.Do(func() {})
+	replicas = []*replica{lagging, healthy}
+	defer func() { replicas = nil }()
+
+	for i := 0; i < 3; i++ {
+		pool, err := ReadDB()
+		assert.NoError(t, err)
+		assert.Same(t, healthy.pool, pool)
+	}
+}
@@ -0,0 +1,318 @@
+package disruption
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/passbi/passbi_core/internal/alerts"
+	"github.com/passbi/passbi_core/internal/mapmatch"
+	"github.com/passbi/passbi_core/internal/repository"
+)
+
+// Run checks the routes in service every cfg.Interval until ctx is done
+// Several instances may run it: one raises alerts at a time
+func Run(ctx context.Context, pool *pgxpool.Pool, cfg Config) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			runCtx, cancel := context.WithTimeout(ctx, cfg.Interval)
+			_, err := Detect(runCtx, pool, cfg, now)
+			cancel()
+			if err != nil {
+				logger.ErrorContext(ctx, "Disruption detection failed", "error", err)
+			}
+		}
+	}
+}
+
+// Detect finds the routes disrupted at now and keeps their provisional
+// alerts in step: a new disruption gets one, each pass extends it by a few
+// intervals while the disruption lasts, and it ends with the disruption
+// Alerts staff confirmed are theirs and left alone; one they dismissed is
+// not raised again until the disruption is over
+// It returns the disruptions found; it does nothing when another instance
+// is detecting
+func Detect(ctx context.Context, pool *pgxpool.Pool, cfg Config, now time.Time) ([]Disruption, error) {
+	services, err := routeServices(ctx, pool, cfg, now)
+	if err != nil {
+		return nil, err
+	}
+	disruptions := cfg.Classify(services)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var locked bool
+	if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock(hashtext('passbi:disruptions'))`).Scan(&locked); err != nil {
+		return nil, fmt.Errorf("failed to take the disruption lock: %w", err)
+	}
+	if !locked {
+		return nil, nil
+	}
+	if err := updateAlerts(ctx, tx, cfg, disruptions, now); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit disruptions: %w", err)
+	}
+	return disruptions, nil
+}
+
+// routeKey identifies a route of an agency
+type routeKey struct {
+	agencyID string
+	routeID  string
+}
+
+// routeServices returns the routes scheduled to run trips around now with
+// what their vehicles did
+func routeServices(ctx context.Context, pool *pgxpool.Pool, cfg Config, now time.Time) ([]RouteService, error) {
+	now = now.UTC()
+	nowSecs := now.Hour()*3600 + now.Minute()*60 + now.Second()
+	windowSecs := int(cfg.CancelWindow.Seconds())
+
+	rows, err := pool.Query(ctx, `
+		WITH `+repository.ActiveServicesCTE(now, "$1")+`,
+		spans AS (
+			SELECT t.agency_id, t.route_id, t.trip_id,
+				MIN(COALESCE(st.departure_seconds, st.arrival_seconds)) AS first_secs,
+				MAX(COALESCE(st.arrival_seconds, st.departure_seconds)) AS last_secs
+			FROM trip t
+			JOIN active_services a ON a.service_id = t.service_id AND a.agency_id = t.agency_id
+			JOIN stop_time st ON st.agency_id = t.agency_id AND st.trip_id = t.trip_id
+			GROUP BY t.agency_id, t.route_id, t.trip_id
+		)
+		SELECT s.agency_id, s.route_id,
+			COUNT(*) FILTER (WHERE s.first_secs <= $2 AND s.last_secs >= $2),
+			COUNT(*) FILTER (WHERE s.first_secs BETWEEN $2 - $3 AND $2 + $3),
+			COUNT(tu.trip_id) FILTER (WHERE s.first_secs BETWEEN $2 - $3 AND $2 + $3)
+		FROM spans s
+		LEFT JOIN trip_update tu ON tu.agency_id = s.agency_id AND tu.trip_id = s.trip_id
+			AND tu.service_date = $1::date AND tu.schedule_relationship IN ('CANCELED', 'DELETED')
+		WHERE (s.first_secs <= $2 AND s.last_secs >= $2) OR s.first_secs BETWEEN $2 - $3 AND $2 + $3
+		GROUP BY s.agency_id, s.route_id
+	`, now, nowSecs, windowSecs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scheduled trips: %w", err)
+	}
+	services := make(map[routeKey]*RouteService)
+	for rows.Next() {
+		s := &RouteService{}
+		if err := rows.Scan(&s.AgencyID, &s.RouteID, &s.Running, &s.Starting, &s.Cancelled); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		services[routeKey{s.AgencyID, s.RouteID}] = s
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query scheduled trips: %w", err)
+	}
+
+	// How far each vehicle got within the window, from the corners of the
+	// box its fixes fit in
+	rows, err = pool.Query(ctx, `
+		SELECT agency_id, route_id, MIN(lat), MAX(lat), MIN(lon), MAX(lon)
+		FROM vehicle_position
+		WHERE recorded_at >= $1 AND route_id IS NOT NULL
+		GROUP BY agency_id, route_id, vehicle_id
+	`, now.Add(-cfg.StallWindow))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query vehicle positions: %w", err)
+	}
+	activeAgencies := make(map[string]bool)
+	for rows.Next() {
+		var k routeKey
+		var minLat, maxLat, minLon, maxLon float64
+		if err := rows.Scan(&k.agencyID, &k.routeID, &minLat, &maxLat, &minLon, &maxLon); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		activeAgencies[k.agencyID] = true
+		if s, ok := services[k]; ok {
+			s.Vehicles++
+			if mapmatch.Distance(minLat, minLon, maxLat, maxLon) >= cfg.MinMovement {
+				s.Moving++
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query vehicle positions: %w", err)
+	}
+
+	// Only routes that might be stalled are checked for earlier fixes
+	var candidates []string
+	for _, s := range services {
+		s.AgencyActive = activeAgencies[s.AgencyID]
+		if s.Running >= cfg.MinRunning && s.Moving == 0 {
+			candidates = append(candidates, s.RouteID)
+		}
+	}
+	if len(candidates) > 0 {
+		rows, err = pool.Query(ctx, `
+			SELECT r.route_id FROM unnest($1::text[]) AS r(route_id)
+			WHERE EXISTS (
+				SELECT 1 FROM vehicle_position vp WHERE vp.route_id = r.route_id AND vp.recorded_at >= $2
+			)
+		`, candidates, now.Add(-cfg.Tracked))
+		if err != nil {
+			return nil, fmt.Errorf("failed to query tracked routes: %w", err)
+		}
+		tracked := make(map[string]bool)
+		for rows.Next() {
+			var routeID string
+			if err := rows.Scan(&routeID); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			tracked[routeID] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to query tracked routes: %w", err)
+		}
+		for _, s := range services {
+			s.Tracked = tracked[s.RouteID]
+		}
+	}
+
+	list := make([]RouteService, 0, len(services))
+	for _, s := range services {
+		list = append(list, *s)
+	}
+	return list, nil
+}
+
+// disruptionKey identifies a kind of disruption on a route
+type disruptionKey struct {
+	routeID string
+	kind    string
+}
+
+// known is a disruption found by an earlier pass and its alert
+type known struct {
+	alertID     *int64
+	provisional bool
+}
+
+// updateAlerts raises, extends and ends the provisional alerts of the
+// disruptions found at now
+func updateAlerts(ctx context.Context, tx pgx.Tx, cfg Config, disruptions []Disruption, now time.Time) error {
+	rows, err := tx.Query(ctx, `
+		SELECT d.route_id, d.kind, d.alert_id, COALESCE(a.provisional, false)
+		FROM route_disruption d
+		LEFT JOIN service_alert a ON a.id = d.alert_id
+		FOR UPDATE OF d
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query disruptions: %w", err)
+	}
+	previous := make(map[disruptionKey]known)
+	for rows.Next() {
+		var k disruptionKey
+		var d known
+		if err := rows.Scan(&k.routeID, &k.kind, &d.alertID, &d.provisional); err != nil {
+			rows.Close()
+			return err
+		}
+		previous[k] = d
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query disruptions: %w", err)
+	}
+
+	current := make(map[disruptionKey]bool, len(disruptions))
+	for _, d := range disruptions {
+		current[disruptionKey{d.RouteID, d.Kind}] = true
+	}
+	ended := make([]disruptionKey, 0, len(previous))
+	for k := range previous {
+		if !current[k] {
+			ended = append(ended, k)
+		}
+	}
+	sort.Slice(ended, func(i, j int) bool {
+		if ended[i].routeID != ended[j].routeID {
+			return ended[i].routeID < ended[j].routeID
+		}
+		return ended[i].kind < ended[j].kind
+	})
+	for _, k := range ended {
+		if d := previous[k]; d.alertID != nil && d.provisional {
+			if _, err := tx.Exec(ctx, `
+				UPDATE service_alert SET ends_at = GREATEST($2, starts_at + INTERVAL '1 second')
+				WHERE id = $1 AND (ends_at IS NULL OR ends_at > $2)
+			`, *d.alertID, now); err != nil {
+				return fmt.Errorf("failed to end disruption alert: %w", err)
+			}
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM route_disruption WHERE route_id = $1 AND kind = $2`, k.routeID, k.kind); err != nil {
+			return fmt.Errorf("failed to clear disruption: %w", err)
+		}
+		logger.Info("Disruption over", "route_id", k.routeID, "kind", k.kind)
+	}
+	if len(disruptions) == 0 {
+		return nil
+	}
+
+	routeIDs := make([]string, len(disruptions))
+	for i, d := range disruptions {
+		routeIDs[i] = d.RouteID
+	}
+	names, err := repository.RouteNames(ctx, tx, routeIDs)
+	if err != nil {
+		return fmt.Errorf("failed to query route names: %w", err)
+	}
+
+	ends := now.Add(3 * cfg.Interval)
+	for _, d := range disruptions {
+		k := disruptionKey{d.RouteID, d.Kind}
+		p, seen := previous[k]
+		switch {
+		case !seen:
+			alert := routeAlert(d, names[d.RouteID], cfg, now, ends)
+			if err := alerts.Normalize(&alert); err != nil {
+				return err
+			}
+			if err := alerts.CreateTx(ctx, tx, &alert); err != nil {
+				return err
+			}
+			p.alertID = &alert.ID
+			logger.Warn("Disruption detected", "route_id", d.RouteID, "kind", d.Kind,
+				"scheduled", d.Scheduled, "affected", d.Affected, "alert_id", alert.ID)
+		case p.alertID != nil && p.provisional:
+			alert := routeAlert(d, names[d.RouteID], cfg, now, ends)
+			if _, err := tx.Exec(ctx, `
+				UPDATE service_alert SET description = $2, ends_at = $3
+				WHERE id = $1 AND (ends_at IS NULL OR ends_at > $4)
+			`, *p.alertID, alert.Description, ends, now); err != nil {
+				return fmt.Errorf("failed to extend disruption alert: %w", err)
+			}
+		}
+
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO route_disruption (route_id, kind, agency_id, detected_at, updated_at, scheduled, affected, alert_id)
+			VALUES ($1, $2, $3, $4, $4, $5, $6, $7)
+			ON CONFLICT (route_id, kind) DO UPDATE
+			SET updated_at = EXCLUDED.updated_at, scheduled = EXCLUDED.scheduled, affected = EXCLUDED.affected
+		`, d.RouteID, d.Kind, d.AgencyID, now, d.Scheduled, d.Affected, p.alertID); err != nil {
+			return fmt.Errorf("failed to store disruption: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// Package disruption watches the routes in service hours for signs of a
+// disruption, such as a strike or a flood: no vehicle moving, or most trips
+// cancelled by a feed. It raises a provisional service alert for staff to
+// review, so riders hear about it before anyone writes one
+package disruption
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/alerts"
+	"github.com/passbi/passbi_core/internal/logging"
+	"github.com/passbi/passbi_core/internal/models"
+)
+
+var logger = logging.For("disruption")
+
+// Kinds of a Disruption
+const (
+	KindStalled   = "stalled"   // no vehicle of the route moved
+	KindCancelled = "cancelled" // most trips of the route cancelled
+)
+
+// Config holds the detection settings
+type Config struct {
+	Interval     time.Duration // how often routes are checked
+	StallWindow  time.Duration // how long no vehicle of a route may move before it is stalled
+	MinMovement  float64       // meters a vehicle must cover within StallWindow to be moving
+	Tracked      time.Duration // how recently a route must have sent fixes for its standstill to count
+	MinRunning   int           // trips a route must be running for a standstill to count
+	CancelWindow time.Duration // trips starting this close to now are counted for cancellations
+	CancelRatio  float64       // share of those trips cancelled at which a route is disrupted
+	MinCancelled int           // cancelled trips needed as well
+}
+
+// DefaultConfig checks every five minutes for routes running two trips or
+// more without a vehicle moving 200 m in 20 minutes, or with at least three
+// and half of the trips starting within the hour either side cancelled
+func DefaultConfig() Config {
+	return Config{
+		Interval:     5 * time.Minute,
+		StallWindow:  20 * time.Minute,
+		MinMovement:  200,
+		Tracked:      24 * time.Hour,
+		MinRunning:   2,
+		CancelWindow: time.Hour,
+		CancelRatio:  0.5,
+		MinCancelled: 3,
+	}
+}
+
+// ConfigFromEnv returns the defaults overridden by DISRUPTION_* variables
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	if d, err := time.ParseDuration(os.Getenv("DISRUPTION_INTERVAL")); err == nil && d > 0 {
+		cfg.Interval = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("DISRUPTION_STALL_WINDOW")); err == nil && d > 0 {
+		cfg.StallWindow = d
+	}
+	if f, err := strconv.ParseFloat(os.Getenv("DISRUPTION_MIN_MOVEMENT"), 64); err == nil && f > 0 {
+		cfg.MinMovement = f
+	}
+	if d, err := time.ParseDuration(os.Getenv("DISRUPTION_TRACKED")); err == nil && d > 0 {
+		cfg.Tracked = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("DISRUPTION_MIN_RUNNING")); err == nil && n > 0 {
+		cfg.MinRunning = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("DISRUPTION_CANCEL_WINDOW")); err == nil && d > 0 {
+		cfg.CancelWindow = d
+	}
+	if f, err := strconv.ParseFloat(os.Getenv("DISRUPTION_CANCEL_RATIO"), 64); err == nil && f > 0 && f <= 1 {
+		cfg.CancelRatio = f
+	}
+	if n, err := strconv.Atoi(os.Getenv("DISRUPTION_MIN_CANCELLED")); err == nil && n > 0 {
+		cfg.MinCancelled = n
+	}
+	return cfg
+}
+
+// RouteService is what a route is scheduled to run around now and what its
+// vehicles did
+type RouteService struct {
+	AgencyID  string
+	RouteID   string
+	Running   int  // trips scheduled to be running now
+	Starting  int  // trips scheduled to start within CancelWindow of now
+	Cancelled int  // of those, cancelled by a feed
+	Tracked   bool // the route sent fixes within Tracked
+	Vehicles  int  // vehicles of the route seen within StallWindow
+	Moving    int  // of those, the ones that moved MinMovement
+	// Whether any vehicle of the agency was seen within StallWindow; when
+	// none was, its fixes stopped coming in, which says nothing of service
+	AgencyActive bool
+}
+
+// Disruption is a route found disrupted
+type Disruption struct {
+	AgencyID  string
+	RouteID   string
+	Kind      string
+	Scheduled int // trips running now when stalled, starting around now when cancelled
+	Affected  int // vehicles standing still when stalled, trips cancelled when cancelled
+}
+
+// Classify returns the disrupted routes among services, by route and kind
+func (cfg Config) Classify(services []RouteService) []Disruption {
+	var disruptions []Disruption
+	for _, s := range services {
+		if s.Tracked && s.Running >= cfg.MinRunning && s.Moving == 0 && (s.Vehicles > 0 || s.AgencyActive) {
+			disruptions = append(disruptions, Disruption{AgencyID: s.AgencyID, RouteID: s.RouteID,
+				Kind: KindStalled, Scheduled: s.Running, Affected: s.Vehicles})
+		}
+		if s.Cancelled >= cfg.MinCancelled && float64(s.Cancelled) >= cfg.CancelRatio*float64(s.Starting) {
+			disruptions = append(disruptions, Disruption{AgencyID: s.AgencyID, RouteID: s.RouteID,
+				Kind: KindCancelled, Scheduled: s.Starting, Affected: s.Cancelled})
+		}
+	}
+	sort.Slice(disruptions, func(i, j int) bool {
+		if disruptions[i].RouteID != disruptions[j].RouteID {
+			return disruptions[i].RouteID < disruptions[j].RouteID
+		}
+		return disruptions[i].Kind < disruptions[j].Kind
+	})
+	return disruptions
+}
+
+// routeAlert is the provisional alert riders of a disrupted route see until
+// staff confirm or dismiss it
+func routeAlert(d Disruption, name string, cfg Config, starts, ends time.Time) models.ServiceAlert {
+	if name == "" {
+		name = d.RouteID
+	}
+	a := models.ServiceAlert{
+		Title: fmt.Sprintf("Service disrupted on line %s", name),
+		Description: fmt.Sprintf("No vehicle on this line has moved in the past %d minutes: service may be suspended. "+
+			"This notice was raised automatically and is not confirmed yet.", int(cfg.StallWindow.Minutes())),
+		Severity:    models.SeveritySevere,
+		Cause:       "UNKNOWN_CAUSE",
+		Effect:      "NO_SERVICE",
+		Source:      alerts.SourceDisruption,
+		Provisional: true,
+		StartsAt:    starts,
+		EndsAt:      &ends,
+		Entities:    []models.AlertEntity{{RouteID: d.RouteID}},
+	}
+	if d.Kind == KindCancelled {
+		a.Title = fmt.Sprintf("Trips cancelled on line %s", name)
+		a.Description = fmt.Sprintf("%d of the %d trips scheduled around now are cancelled. "+
+			"This notice was raised automatically and is not confirmed yet.", d.Affected, d.Scheduled)
+		a.Severity = models.SeverityWarning
+		a.Effect = "REDUCED_SERVICE"
+	}
+	return a
+}
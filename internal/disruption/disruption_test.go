@@ -0,0 +1,71 @@
+package disruption
+
+import (
+	"testing"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/alerts"
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	cfg := DefaultConfig()
+	services := []RouteService{
+		// Every vehicle stands still
+		{AgencyID: "ddd", RouteID: "R1", Running: 4, Tracked: true, Vehicles: 3, AgencyActive: true},
+		// No fix since yesterday while the agency's other routes report
+		{AgencyID: "ddd", RouteID: "R2", Running: 3, Tracked: true, AgencyActive: true},
+		// The agency's fixes stopped coming in altogether
+		{AgencyID: "aftu", RouteID: "R3", Running: 3, Tracked: true},
+		// Never tracked
+		{AgencyID: "ddd", RouteID: "R4", Running: 3, AgencyActive: true},
+		// One vehicle moves
+		{AgencyID: "ddd", RouteID: "R5", Running: 3, Tracked: true, Vehicles: 3, Moving: 1, AgencyActive: true},
+		// A single trip running
+		{AgencyID: "ddd", RouteID: "R6", Running: 1, Tracked: true, AgencyActive: true},
+		// Most trips cancelled, vehicles moving
+		{AgencyID: "ddd", RouteID: "R7", Running: 2, Tracked: true, Vehicles: 2, Moving: 2, Starting: 6, Cancelled: 4},
+		// A few cancelled
+		{AgencyID: "ddd", RouteID: "R8", Starting: 10, Cancelled: 3},
+		{AgencyID: "ddd", RouteID: "R9", Starting: 2, Cancelled: 2},
+	}
+
+	got := cfg.Classify(services)
+	assert.Equal(t, []Disruption{
+		{AgencyID: "ddd", RouteID: "R1", Kind: KindStalled, Scheduled: 4, Affected: 3},
+		{AgencyID: "ddd", RouteID: "R2", Kind: KindStalled, Scheduled: 3, Affected: 0},
+		{AgencyID: "ddd", RouteID: "R7", Kind: KindCancelled, Scheduled: 6, Affected: 4},
+	}, got)
+}
+
+func TestRouteAlert(t *testing.T) {
+	cfg := DefaultConfig()
+	starts := time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC)
+	ends := starts.Add(15 * time.Minute)
+
+	a := routeAlert(Disruption{RouteID: "R1", Kind: KindStalled}, "12", cfg, starts, ends)
+	assert.Equal(t, "Service disrupted on line 12", a.Title)
+	assert.Contains(t, a.Description, "20 minutes")
+	assert.Equal(t, models.SeveritySevere, a.Severity)
+	assert.Equal(t, alerts.SourceDisruption, a.Source)
+	assert.True(t, a.Provisional)
+	assert.Equal(t, []models.AlertEntity{{RouteID: "R1"}}, a.Entities)
+	assert.NoError(t, alerts.Normalize(&a))
+
+	a = routeAlert(Disruption{RouteID: "R7", Kind: KindCancelled, Scheduled: 6, Affected: 4}, "", cfg, starts, ends)
+	assert.Equal(t, "Trips cancelled on line R7", a.Title)
+	assert.Contains(t, a.Description, "4 of the 6 trips")
+	assert.Equal(t, "REDUCED_SERVICE", a.Effect)
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("DISRUPTION_STALL_WINDOW", "30m")
+	t.Setenv("DISRUPTION_CANCEL_RATIO", "1.5")
+	t.Setenv("DISRUPTION_MIN_CANCELLED", "5")
+
+	cfg := ConfigFromEnv()
+	assert.Equal(t, 30*time.Minute, cfg.StallWindow)
+	assert.Equal(t, 0.5, cfg.CancelRatio, "a ratio above 1 is ignored")
+	assert.Equal(t, 5, cfg.MinCancelled)
+}
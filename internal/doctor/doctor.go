@@ -0,0 +1,172 @@
+// Package doctor checks that the environment, database, Redis and routing
+// graph are ready to serve PassBi, and says how to fix what is not
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/cache"
+	"github.com/passbi/passbi_core/internal/db"
+)
+
+// Status is the outcome of a check
+type Status string
+
+const (
+	StatusOK   Status = "ok"
+	StatusWarn Status = "warn" // PassBi runs, degraded or slower
+	StatusFail Status = "fail" // PassBi cannot serve until fixed
+	StatusSkip Status = "skip" // not checked, an earlier check failed
+)
+
+// Result is the outcome of one check
+type Result struct {
+	Check  string `json:"check"`
+	Status Status `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Fix    string `json:"fix,omitempty"` // what to do about a warning or failure
+}
+
+// Report lists the results in the order the checks ran
+type Report struct {
+	Results []Result `json:"results"`
+}
+
+// Failed reports whether a check failed
+func (r *Report) Failed() bool {
+	for _, res := range r.Results {
+		if res.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Report) add(res ...Result) {
+	r.Results = append(r.Results, res...)
+}
+
+// Options configures Run
+type Options struct {
+	// MigrationsDir holds the migration files the schema is compared with
+	// ("" or a missing directory skips the comparison)
+	MigrationsDir string
+	// Timeout bounds each network check
+	Timeout time.Duration
+}
+
+// Run runs every check; checks that need the database are skipped when it
+// cannot be reached
+func Run(ctx context.Context, opts Options) *Report {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	report := &Report{}
+	report.add(checkConfig(lookupEnv))
+	report.add(CheckEnv(lookupEnv)...)
+
+	pool, res := connect(ctx, opts.Timeout)
+	report.add(res)
+	if pool == nil {
+		for _, name := range []string{"postgis", "migrations", "tables", "indexes", "graph"} {
+			report.add(Result{Check: name, Status: StatusSkip, Detail: "database unreachable"})
+		}
+	} else {
+		defer pool.Close()
+		report.add(checkPostGIS(ctx, pool))
+		report.add(checkMigrations(ctx, pool, opts.MigrationsDir))
+		report.add(checkTables(ctx, pool))
+		report.add(checkIndexes(ctx, pool))
+		report.add(checkGraph(ctx, pool))
+	}
+
+	report.add(checkRedis(ctx, opts.Timeout))
+	return report
+}
+
+// connect opens a pool with the API's settings, without the retries of startup
+func connect(ctx context.Context, timeout time.Duration) (*pgxpool.Pool, Result) {
+	config := db.LoadConfigFromEnv()
+	target := fmt.Sprintf("%s@%s:%d/%s", config.User, config.Host, config.Port, config.Database)
+
+	pool, err := db.InitPoolWithConfig(config)
+	if err != nil {
+		return nil, Result{Check: "database", Status: StatusFail,
+			Detail: fmt.Sprintf("cannot connect to %s: %v", target, err),
+			Fix:    "Check that PostgreSQL is running and reachable, and DB_HOST, DB_PORT, DB_USER, DB_PASSWORD, DB_NAME and DB_SSLMODE (Supabase needs DB_SSLMODE=require)"}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var version string
+	if err := pool.QueryRow(ctx, `SHOW server_version`).Scan(&version); err != nil {
+		version = "unknown version"
+	}
+	return pool, Result{Check: "database", Status: StatusOK,
+		Detail: fmt.Sprintf("connected to %s (PostgreSQL %s)", target, version)}
+}
+
+func checkPostGIS(ctx context.Context, pool *pgxpool.Pool) Result {
+	var version string
+	if err := pool.QueryRow(ctx, `SELECT PostGIS_Version()`).Scan(&version); err != nil {
+		return Result{Check: "postgis", Status: StatusFail,
+			Detail: "PostGIS is not installed in the database",
+			Fix:    "Run CREATE EXTENSION postgis; as a superuser (on Supabase: Database > Extensions > postgis)"}
+	}
+	return Result{Check: "postgis", Status: StatusOK, Detail: "PostGIS " + version}
+}
+
+func checkRedis(ctx context.Context, timeout time.Duration) Result {
+	config := cache.LoadConfigFromEnv()
+	target := fmt.Sprintf("%s:%d", config.Host, config.Port)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	client, err := cache.GetClient()
+	if err == nil {
+		err = client.Ping(ctx).Err()
+	}
+	if err != nil {
+		return Result{Check: "redis", Status: StatusWarn,
+			Detail: fmt.Sprintf("cannot reach %s: %v; the API runs degraded, caching in memory only", target, err),
+			Fix:    "Check REDIS_HOST, REDIS_PORT and REDIS_PASSWORD (Upstash needs REDIS_TLS_ENABLED=true)"}
+	}
+	return Result{Check: "redis", Status: StatusOK, Detail: "connected to " + target}
+}
+
+// checkGraph checks that transit data was imported and the graph built
+func checkGraph(ctx context.Context, pool *pgxpool.Pool) Result {
+	var stops, trips, stopTimes, nodes, edges int64
+	err := pool.QueryRow(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM stop),
+			(SELECT COUNT(*) FROM trip),
+			(SELECT COUNT(*) FROM (SELECT 1 FROM stop_time LIMIT 1) s),
+			(SELECT COUNT(*) FROM node),
+			(SELECT COUNT(*) FROM edge)
+	`).Scan(&stops, &trips, &stopTimes, &nodes, &edges)
+	if err != nil {
+		return Result{Check: "graph", Status: StatusFail, Detail: "cannot count the graph: " + err.Error(),
+			Fix: "Apply the migrations (see the tables check)"}
+	}
+
+	switch {
+	case stops == 0 || trips == 0:
+		return Result{Check: "graph", Status: StatusFail, Detail: "no transit data imported",
+			Fix: "Import a feed: go run ./cmd/importer --agency-id=<agency> --gtfs=<feed.zip> --rebuild-graph"}
+	case nodes == 0 || edges == 0:
+		return Result{Check: "graph", Status: StatusFail,
+			Detail: fmt.Sprintf("%d stops and %d trips imported but the graph is empty", stops, trips),
+			Fix:    "Build it: go run ./cmd/rebuild-graph --yes"}
+	case stopTimes == 0:
+		return Result{Check: "graph", Status: StatusWarn,
+			Detail: fmt.Sprintf("%d nodes and %d edges, but no stop_times: departures and schedules are empty", nodes, edges),
+			Fix:    "Reimport the feeds with their stop_times.txt"}
+	}
+	return Result{Check: "graph", Status: StatusOK,
+		Detail: fmt.Sprintf("%d stops, %d trips, %d nodes, %d edges", stops, trips, nodes, edges)}
+}
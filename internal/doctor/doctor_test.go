@@ -0,0 +1,111 @@
+package doctor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func envOf(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+}
+
+func TestCheckEnv(t *testing.T) {
+	t.Run("Accepts a complete environment", func(t *testing.T) {
+		results := CheckEnv(envOf(map[string]string{
+			"DB_HOST": "db.example.supabase.co", "DB_NAME": "postgres", "DB_USER": "postgres",
+			"DB_PASSWORD": "secret", "DB_PORT": "5432", "DB_SSLMODE": "require",
+			"REQUEST_TIMEOUT": "30s", "GRAPH_RELOAD_ON_NOTIFY": "false",
+		}))
+		if assert.Len(t, results, 1) {
+			assert.Equal(t, StatusOK, results[0].Status)
+		}
+	})
+
+	t.Run("Warns about connection defaults", func(t *testing.T) {
+		results := CheckEnv(envOf(map[string]string{"DB_HOST": "db", "DB_USER": "passbi"}))
+		if assert.Len(t, results, 1) {
+			assert.Equal(t, StatusWarn, results[0].Status)
+			assert.Contains(t, results[0].Detail, "DB_NAME, DB_PASSWORD")
+		}
+	})
+
+	t.Run("Fails on malformed values", func(t *testing.T) {
+		results := CheckEnv(envOf(map[string]string{
+			"DB_HOST": "db", "DB_NAME": "passbi", "DB_USER": "passbi", "DB_PASSWORD": "secret",
+			"DB_PORT": "five", "CACHE_TTL": "10", "REDIS_TLS_ENABLED": "yes", "DB_SSLMODE": "on",
+		}))
+		var failed []string
+		for _, r := range results {
+			if assert.Equal(t, StatusFail, r.Status) {
+				failed = append(failed, r.Detail)
+				assert.NotEmpty(t, r.Fix)
+			}
+		}
+		assert.Equal(t, []string{
+			`CACHE_TTL="10" is not valid and is ignored`,
+			`DB_PORT="five" is not valid and is ignored`,
+			`DB_SSLMODE="on" is not valid and is ignored`,
+			`REDIS_TLS_ENABLED="yes" is not valid and is ignored`,
+		}, failed)
+	})
+
+	t.Run("Warns about the transaction pooler", func(t *testing.T) {
+		results := CheckEnv(envOf(map[string]string{
+			"DB_HOST": "pooler.supabase.com", "DB_NAME": "postgres", "DB_USER": "postgres",
+			"DB_PASSWORD": "secret", "DB_PORT": "6543",
+		}))
+		if assert.Len(t, results, 1) {
+			assert.Equal(t, StatusWarn, results[0].Status)
+			assert.Contains(t, results[0].Detail, "6543")
+		}
+	})
+}
+
+func TestNewestMigration(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"001_initial_schema.up.sql", "001_initial_schema.down.sql",
+		"012_usage.up.sql", "032_partition_stop_time.up.sql", "033_next.down.sql", "README.md",
+	} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+
+	newest, err := NewestMigration(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(32), newest)
+
+	newest, err = NewestMigration("")
+	assert.NoError(t, err)
+	assert.Zero(t, newest)
+
+	_, err = NewestMigration(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestReportFailed(t *testing.T) {
+	report := &Report{}
+	report.add(Result{Check: "env", Status: StatusWarn}, Result{Check: "graph", Status: StatusSkip})
+	assert.False(t, report.Failed())
+	report.add(Result{Check: "database", Status: StatusFail})
+	assert.True(t, report.Failed())
+}
+
+func TestCheckConfig(t *testing.T) {
+	res := checkConfig(envOf(map[string]string{"DB_PORT": "5432"}))
+	assert.Equal(t, StatusOK, res.Status)
+	assert.Contains(t, res.Detail, "PASSBI_CONFIG not set")
+
+	res = checkConfig(envOf(map[string]string{"PASSBI_CONFIG": filepath.Join(t.TempDir(), "missing.yaml")}))
+	assert.Equal(t, StatusFail, res.Status)
+	assert.Contains(t, res.Detail, "cannot load the configuration file")
+
+	res = checkConfig(envOf(map[string]string{"ROUTE_TIMEOUT": "soon", "REDIS_PORT": "70000"}))
+	assert.Equal(t, StatusFail, res.Status)
+	assert.Contains(t, res.Detail, `REDIS_PORT (redis.port) = "70000": must be a port number; ROUTE_TIMEOUT`)
+}
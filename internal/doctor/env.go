@@ -0,0 +1,134 @@
+package doctor
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/config"
+)
+
+// lookupEnv is os.LookupEnv, replaced in tests
+var lookupEnv = os.LookupEnv
+
+// connectionVars default to a local development database when unset, which
+// is rarely what a deployment wants
+var connectionVars = []string{"DB_HOST", "DB_NAME", "DB_USER", "DB_PASSWORD"}
+
+// Variables whose malformed values are silently replaced by their default
+var (
+	intVars = []string{
+		"DB_PORT", "DB_MIN_CONNS", "DB_MAX_CONNS", "SLOW_QUERY_MS", "SLOW_SEARCH_MS",
+		"REDIS_PORT", "REDIS_DB", "CACHE_LOCAL_SIZE", "API_PORT", "SMTP_PORT",
+		"USAGE_LOG_BATCH", "USAGE_LOG_BUFFER",
+	}
+	durationVars = []string{
+		"DB_STATEMENT_TIMEOUT", "DB_REPLICA_MAX_LAG", "CACHE_TTL", "CACHE_MUTEX_TTL",
+		"CACHE_LOCAL_TTL", "REQUEST_TIMEOUT", "ROUTE_TIMEOUT", "STARTUP_RETRY_DEADLINE",
+		"STARTUP_RETRY_MAX_WAIT", "GEOCODER_TIMEOUT", "ANOMALY_INTERVAL", "USAGE_LOG_FLUSH",
+		"USAGE_LOG_ENQUEUE_WAIT", "MQTT_KEEPALIVE",
+	}
+	boolVars = []string{"GRAPH_RELOAD_ON_NOTIFY", "ANOMALY_AUTO_SUSPEND", "REDIS_TLS_ENABLED"}
+)
+
+// sslModes are the values libpq accepts for DB_SSLMODE
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// CheckEnv checks the environment variables read by lookup
+func CheckEnv(lookup func(string) (string, bool)) []Result {
+	var results []Result
+
+	var unset []string
+	for _, name := range connectionVars {
+		if v, ok := lookup(name); !ok || v == "" {
+			unset = append(unset, name)
+		}
+	}
+	if len(unset) > 0 {
+		results = append(results, Result{Check: "env", Status: StatusWarn,
+			Detail: strings.Join(unset, ", ") + " not set; using the local development defaults",
+			Fix:    "Set them in the environment or .env (see .env.example)"})
+	}
+
+	invalid := map[string]string{}
+	for _, name := range intVars {
+		if v, ok := lookup(name); ok && v != "" {
+			if _, err := strconv.Atoi(v); err != nil {
+				invalid[name] = "a whole number"
+			}
+		}
+	}
+	for _, name := range durationVars {
+		if v, ok := lookup(name); ok && v != "" {
+			if _, err := time.ParseDuration(v); err != nil {
+				invalid[name] = `a duration such as "30s" or "5m"`
+			}
+		}
+	}
+	for _, name := range boolVars {
+		if v, ok := lookup(name); ok && v != "" {
+			if _, err := strconv.ParseBool(v); err != nil {
+				invalid[name] = `"true" or "false"`
+			}
+		}
+	}
+	if v, ok := lookup("DB_SSLMODE"); ok && v != "" && !contains(sslModes, v) {
+		invalid["DB_SSLMODE"] = "one of " + strings.Join(sslModes, ", ")
+	}
+	names := make([]string, 0, len(invalid))
+	for name := range invalid {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v, _ := lookup(name)
+		results = append(results, Result{Check: "env", Status: StatusFail,
+			Detail: fmt.Sprintf("%s=%q is not valid and is ignored", name, v),
+			Fix:    fmt.Sprintf("Set %s to %s, or unset it", name, invalid[name])})
+	}
+
+	// The transaction pooler cannot hold a session
+	if v, _ := lookup("DB_PORT"); v == "6543" {
+		results = append(results, Result{Check: "env", Status: StatusWarn,
+			Detail: "DB_PORT=6543 is the Supabase transaction pooler: graph reload notifications and DB_STATEMENT_TIMEOUT are disabled",
+			Fix:    "Use the session port (5432) for the API, and keep 6543 for short-lived jobs"})
+	}
+
+	if len(results) == 0 {
+		results = append(results, Result{Check: "env", Status: StatusOK, Detail: "environment variables are valid"})
+	}
+	return results
+}
+
+// checkConfig loads the configuration file named by PASSBI_CONFIG, so the
+// other checks see its settings, and validates the configuration the way the
+// binaries do at startup
+func checkConfig(lookup func(string) (string, bool)) Result {
+	source := "the environment (" + config.PathEnv + " not set)"
+	if path, ok := lookup(config.PathEnv); ok && path != "" {
+		if err := config.Load(path); err != nil {
+			return Result{Check: "config", Status: StatusFail,
+				Detail: "cannot load the configuration file: " + err.Error(),
+				Fix:    "Fix the file, or unset " + config.PathEnv + " to configure PassBi from the environment only"}
+		}
+		source = path + " and the environment"
+	}
+	if err := config.Validate(lookup); err != nil {
+		return Result{Check: "config", Status: StatusFail,
+			Detail: "the binaries refuse to start: " + strings.ReplaceAll(err.Error(), "\n", "; "),
+			Fix:    "Correct these settings in the configuration file or the environment, which overrides it"}
+	}
+	return Result{Check: "config", Status: StatusOK, Detail: "configured from " + source}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
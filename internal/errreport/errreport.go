@@ -0,0 +1,324 @@
+// Package errreport sends errors to an error tracker (Sentry, or any
+// Reporter set with SetReporter)
+// Errors are reported from the logs: every record at error level or above
+// becomes an event, with the record's attributes, its stack and the global
+// tags (service, release, feed version). Installing Handler in the logger is
+// thus enough to capture handler 5xx errors, recovered panics and failed
+// imports, wherever they are logged
+package errreport
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/metrics"
+)
+
+// Event is an error reported to the tracker
+type Event struct {
+	Time      time.Time
+	Level     string // error or fatal
+	Message   string
+	Error     string  // text of the error attribute, if any
+	ErrorType string  // Go type of the error, or "panic"
+	Stack     []Frame // innermost last
+	Tags      map[string]string
+	Extra     map[string]any
+}
+
+// Frame is a stack frame
+type Frame struct {
+	Function string
+	Module   string
+	File     string
+	Line     int
+}
+
+// Reporter delivers events to an error tracker
+type Reporter interface {
+	// Report queues an event; it must not block the caller
+	Report(e *Event)
+	// Flush waits until queued events are sent, or the timeout elapses
+	Flush(timeout time.Duration)
+}
+
+// tagAttrs are the record attributes sent as (searchable) tags rather than
+// extra data
+var tagAttrs = map[string]bool{
+	"service":    true,
+	"component":  true,
+	"request_id": true,
+	"partner_id": true,
+	"job_id":     true,
+	"agency_id":  true,
+	"strategy":   true,
+	"method":     true,
+	"route":      true,
+}
+
+// unreported are components whose error records are not reported: the
+// access log ("http") repeats failures already logged where they happened
+var unreported = map[string]bool{
+	"http": true,
+}
+
+var (
+	current atomic.Pointer[reporterBox]
+
+	tagsMu sync.RWMutex
+	tags   = map[string]string{}
+
+	eventsReported atomic.Int64
+)
+
+type reporterBox struct{ r Reporter }
+
+func init() {
+	metrics.Register(func(w *metrics.Writer) {
+		w.Counter("passbi_errors_reported_total", "Errors sent to the error tracker", float64(eventsReported.Load()))
+	})
+}
+
+// Init configures reporting for a service from the environment
+// SENTRY_DSN enables the Sentry reporter; without it events are dropped
+// The release is SENTRY_RELEASE, or the VCS revision the binary was built from
+func Init(service string) {
+	SetTag("service", service)
+	if release := release(); release != "" {
+		SetTag("release", release)
+	}
+
+	dsn := os.Getenv("SENTRY_DSN")
+	if dsn == "" {
+		return
+	}
+	r, err := NewSentry(dsn, getEnv("SENTRY_ENVIRONMENT", "production"))
+	if err != nil {
+		slog.Warn("Error reporting disabled", "component", "errreport", "error", err)
+		return
+	}
+	SetReporter(r)
+}
+
+// SetReporter installs the reporter events are sent to (nil disables)
+func SetReporter(r Reporter) {
+	if r == nil {
+		current.Store(nil)
+		return
+	}
+	current.Store(&reporterBox{r})
+}
+
+// Enabled reports whether a reporter is installed
+func Enabled() bool {
+	return current.Load() != nil
+}
+
+// SetTag sets a tag attached to every event, e.g. the feed version served
+func SetTag(key, value string) {
+	tagsMu.Lock()
+	defer tagsMu.Unlock()
+	if value == "" {
+		delete(tags, key)
+		return
+	}
+	tags[key] = value
+}
+
+// Flush waits until queued events are sent; call it before exiting
+func Flush(timeout time.Duration) {
+	if b := current.Load(); b != nil {
+		b.r.Flush(timeout)
+	}
+}
+
+// report fills the global tags in and hands the event to the reporter
+func report(e *Event) {
+	b := current.Load()
+	if b == nil {
+		return
+	}
+
+	tagsMu.RLock()
+	for k, v := range tags {
+		if _, ok := e.Tags[k]; !ok {
+			e.Tags[k] = v
+		}
+	}
+	tagsMu.RUnlock()
+
+	eventsReported.Add(1)
+	b.r.Report(e)
+}
+
+// Handler wraps a log handler so records at error level and above are also
+// reported. Records are passed on to next unchanged
+func Handler(next slog.Handler) slog.Handler {
+	return &handler{next: next}
+}
+
+type handler struct {
+	next  slog.Handler
+	attrs []slog.Attr
+	group string
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelError || h.next.Enabled(ctx, level)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelError && Enabled() {
+		if e := h.event(r); !unreported[e.Tags["component"]] {
+			report(e)
+		}
+	}
+	if !h.next.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if h.group != "" {
+		// Grouped attributes stay in the log output only
+		return &handler{next: h.next.WithAttrs(attrs), attrs: h.attrs, group: h.group}
+	}
+	return &handler{
+		next:  h.next.WithAttrs(attrs),
+		attrs: append(append([]slog.Attr(nil), h.attrs...), attrs...),
+	}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{next: h.next.WithGroup(name), attrs: h.attrs, group: name}
+}
+
+// event builds the event of a log record
+func (h *handler) event(r slog.Record) *Event {
+	e := &Event{
+		Time:    r.Time,
+		Level:   "error",
+		Message: r.Message,
+		Tags:    map[string]string{},
+		Extra:   map[string]any{},
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	add := func(a slog.Attr) bool {
+		v := a.Value.Resolve()
+		switch {
+		case a.Key == "error":
+			if err, ok := v.Any().(error); ok {
+				e.Error = err.Error()
+				e.ErrorType = fmt.Sprintf("%T", err)
+			} else {
+				e.Error = v.String()
+			}
+		case a.Key == "panic":
+			e.Error = v.String()
+			e.ErrorType = "panic"
+			e.Level = "fatal"
+		case a.Key == "stack":
+			// Already captured as frames
+		case tagAttrs[a.Key]:
+			e.Tags[a.Key] = v.String()
+		default:
+			switch v.Kind() {
+			case slog.KindInt64, slog.KindUint64, slog.KindFloat64, slog.KindBool:
+				e.Extra[a.Key] = v.Any()
+			default:
+				e.Extra[a.Key] = v.String()
+			}
+		}
+		return true
+	}
+	for _, a := range h.attrs {
+		add(a)
+	}
+	r.Attrs(add)
+
+	if !unreported[e.Tags["component"]] {
+		e.Stack = callers()
+	}
+	return e
+}
+
+// callers returns the stack of the logging call, without the frames of the
+// logging machinery. Called while a panic is being recovered, it still
+// includes the frames that panicked
+func callers() []Frame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var stack []Frame
+	for {
+		f, more := frames.Next()
+		if !internalFrame(f.Function) {
+			module, function := splitFunction(f.Function)
+			stack = append(stack, Frame{Function: function, Module: module, File: f.File, Line: f.Line})
+		}
+		if !more {
+			break
+		}
+	}
+
+	// Trackers expect the innermost frame last
+	for i, j := 0, len(stack)-1; i < j; i, j = i+1, j-1 {
+		stack[i], stack[j] = stack[j], stack[i]
+	}
+	return stack
+}
+
+func internalFrame(function string) bool {
+	return strings.HasPrefix(function, "log/slog.") ||
+		strings.HasPrefix(function, "runtime.") ||
+		strings.Contains(function, "/internal/logging.") ||
+		strings.Contains(function, "/internal/errreport.(*handler).") ||
+		strings.HasSuffix(function, "/internal/errreport.callers")
+}
+
+// splitFunction splits "github.com/x/pkg.(*T).Method" into package and name
+func splitFunction(name string) (module, function string) {
+	slash := strings.LastIndex(name, "/")
+	if dot := strings.Index(name[slash+1:], "."); dot >= 0 {
+		return name[:slash+1+dot], name[slash+1+dot+1:]
+	}
+	return "", name
+}
+
+// release identifies the deployed build
+func release() string {
+	if r := os.Getenv("SENTRY_RELEASE"); r != "" {
+		return r
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+			return s.Value[:12]
+		}
+	}
+	return ""
+}
+
+// getEnv retrieves an environment variable with a fallback default value
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
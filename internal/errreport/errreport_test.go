@@ -0,0 +1,161 @@
+package errreport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memReporter struct {
+	mu     sync.Mutex
+	events []*Event
+}
+
+func (m *memReporter) Report(e *Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, e)
+}
+
+func (m *memReporter) Flush(time.Duration) {}
+
+func useReporter(t *testing.T) *memReporter {
+	m := &memReporter{}
+	SetReporter(m)
+	t.Cleanup(func() { SetReporter(nil) })
+	return m
+}
+
+func importFeed() error {
+	return errors.New("stop_times.txt: missing column")
+}
+
+func TestHandlerReportsErrors(t *testing.T) {
+	m := useReporter(t)
+	SetTag("feed_version", "42-1700000000")
+	defer SetTag("feed_version", "")
+
+	var buf bytes.Buffer
+	logger := slog.New(Handler(slog.NewJSONHandler(&buf, nil))).With("component", "importer")
+
+	logger.Warn("Skipping invalid row")
+	logger.Error("Import failed", "agency_id", "DDD", "rows", 12, "error", importFeed())
+
+	assert.Equal(t, 2, strings.Count(buf.String(), "\n"), "records are still logged")
+	if !assert.Len(t, m.events, 1) {
+		return
+	}
+	e := m.events[0]
+	assert.Equal(t, "Import failed", e.Message)
+	assert.Equal(t, "error", e.Level)
+	assert.Equal(t, "stop_times.txt: missing column", e.Error)
+	assert.Equal(t, "*errors.errorString", e.ErrorType)
+	assert.Equal(t, "importer", e.Tags["component"])
+	assert.Equal(t, "DDD", e.Tags["agency_id"])
+	assert.Equal(t, "42-1700000000", e.Tags["feed_version"])
+	assert.Equal(t, int64(12), e.Extra["rows"])
+
+	// The innermost frame is the logging call, not slog or this package
+	if assert.NotEmpty(t, e.Stack) {
+		last := e.Stack[len(e.Stack)-1]
+		assert.Equal(t, "TestHandlerReportsErrors", last.Function)
+		assert.True(t, strings.HasSuffix(last.Module, "/internal/errreport"), last.Module)
+	}
+}
+
+func TestHandlerSkipsAccessLog(t *testing.T) {
+	m := useReporter(t)
+
+	logger := slog.New(Handler(slog.NewJSONHandler(io.Discard, nil)))
+	logger.With("component", "http").Error("request", "status", 500)
+	logger.With("component", "api").Error("Database error", "panic", "boom")
+
+	if assert.Len(t, m.events, 1) {
+		assert.Equal(t, "fatal", m.events[0].Level)
+		assert.Equal(t, "panic", m.events[0].ErrorType)
+	}
+}
+
+func TestHandlerReportsBelowLogLevel(t *testing.T) {
+	m := useReporter(t)
+
+	var buf bytes.Buffer
+	logger := slog.New(Handler(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.Level(12)})))
+	logger.ErrorContext(context.Background(), "Graph load failed")
+
+	assert.Empty(t, buf.String())
+	assert.Len(t, m.events, 1)
+}
+
+func TestSentryEnvelope(t *testing.T) {
+	var mu sync.Mutex
+	var auth string
+	var lines []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, "/api/7/envelope/", r.URL.Path)
+		auth = r.Header.Get("X-Sentry-Auth")
+		s := bufio.NewScanner(r.Body)
+		s.Buffer(make([]byte, 1<<20), 1<<20)
+		for s.Scan() {
+			lines = append(lines, s.Text())
+		}
+	}))
+	defer srv.Close()
+
+	s, err := NewSentry(strings.Replace(srv.URL, "http://", "http://publickey@", 1)+"/7", "staging")
+	if !assert.NoError(t, err) {
+		return
+	}
+	s.Report(&Event{
+		Time:      time.Now(),
+		Level:     "error",
+		Message:   "Failed to fetch stops",
+		Error:     "timeout",
+		ErrorType: "*net.OpError",
+		Stack:     []Frame{{Function: "RouteSearch", Module: "github.com/passbi/passbi_core/internal/api", File: "handlers.go", Line: 42}},
+		Tags:      map[string]string{"release": "abc123", "request_id": "req-1"},
+		Extra:     map[string]any{},
+	})
+	s.Flush(2 * time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Contains(t, auth, "sentry_key=publickey")
+	if !assert.Len(t, lines, 3) {
+		return
+	}
+	var event map[string]any
+	if !assert.NoError(t, json.Unmarshal([]byte(lines[2]), &event)) {
+		return
+	}
+	assert.Equal(t, "abc123", event["release"])
+	assert.Equal(t, "staging", event["environment"])
+	assert.Equal(t, "req-1", event["tags"].(map[string]any)["request_id"])
+
+	exc := event["exception"].(map[string]any)["values"].([]any)[0].(map[string]any)
+	assert.Equal(t, "*net.OpError", exc["type"])
+	assert.Equal(t, "Failed to fetch stops: timeout", exc["value"])
+	frame := exc["stacktrace"].(map[string]any)["frames"].([]any)[0].(map[string]any)
+	assert.Equal(t, true, frame["in_app"])
+}
+
+func TestNewSentryInvalidDSN(t *testing.T) {
+	for _, dsn := range []string{"not a url", "https://sentry.io/7", "https://key@sentry.io/"} {
+		_, err := NewSentry(dsn, "production")
+		assert.Error(t, err, dsn)
+	}
+}
@@ -0,0 +1,217 @@
+package errreport
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/metrics"
+)
+
+// sentryQueueSize bounds the events waiting to be sent; more are dropped
+const sentryQueueSize = 100
+
+var (
+	sentrySent    atomic.Int64
+	sentryDropped atomic.Int64
+)
+
+func init() {
+	metrics.Register(func(w *metrics.Writer) {
+		w.Counter("passbi_sentry_events_sent_total", "Events delivered to Sentry", float64(sentrySent.Load()))
+		w.Counter("passbi_sentry_events_dropped_total", "Events dropped because the queue was full or Sentry failed", float64(sentryDropped.Load()))
+	})
+}
+
+// Sentry sends events to a Sentry project through its envelope endpoint
+// Events are sent by a background goroutine, so reporting never waits on
+// Sentry; when it falls behind, events are dropped
+type Sentry struct {
+	endpoint    string
+	auth        string
+	environment string
+	serverName  string
+	client      *http.Client
+
+	queue   chan *Event
+	pending sync.WaitGroup
+}
+
+// NewSentry creates a reporter from a DSN (https://<key>@<host>/<project>)
+func NewSentry(dsn, environment string) (*Sentry, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SENTRY_DSN: %w", err)
+	}
+	project := strings.Trim(u.Path, "/")
+	if u.User == nil || u.User.Username() == "" || u.Host == "" || project == "" {
+		return nil, fmt.Errorf("invalid SENTRY_DSN: expected https://<key>@<host>/<project>")
+	}
+
+	// Self-hosted Sentry may live under a path prefix
+	prefix := ""
+	if i := strings.LastIndex(project, "/"); i >= 0 {
+		prefix, project = "/"+project[:i], project[i+1:]
+	}
+
+	host, _ := os.Hostname()
+	s := &Sentry{
+		endpoint:    fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, prefix, project),
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_client=passbi/1.0, sentry_key=%s", u.User.Username()),
+		environment: environment,
+		serverName:  host,
+		client:      &http.Client{Timeout: 5 * time.Second},
+		queue:       make(chan *Event, sentryQueueSize),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Report implements Reporter
+func (s *Sentry) Report(e *Event) {
+	s.pending.Add(1)
+	select {
+	case s.queue <- e:
+	default:
+		s.pending.Done()
+		sentryDropped.Add(1)
+	}
+}
+
+// Flush implements Reporter
+func (s *Sentry) Flush(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		s.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+func (s *Sentry) run() {
+	for e := range s.queue {
+		if err := s.send(e); err != nil {
+			sentryDropped.Add(1)
+			// Logged below error level, so it is not reported in turn
+			slog.Warn("Failed to send error to Sentry", "component", "errreport", "error", err)
+		} else {
+			sentrySent.Add(1)
+		}
+		s.pending.Done()
+	}
+}
+
+func (s *Sentry) send(e *Event) error {
+	body, err := s.envelope(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("sentry returned %s", resp.Status)
+	}
+	return nil
+}
+
+// sentryFrame is a frame in Sentry's event format
+type sentryFrame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+// envelope encodes an event as a Sentry envelope: a header line, an item
+// header line and the event
+func (s *Sentry) envelope(e *Event) ([]byte, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	eventID := hex.EncodeToString(id)
+
+	frames := make([]sentryFrame, 0, len(e.Stack))
+	for _, f := range e.Stack {
+		frames = append(frames, sentryFrame{
+			Function: f.Function,
+			Module:   f.Module,
+			AbsPath:  f.File,
+			Lineno:   f.Line,
+			InApp:    strings.HasPrefix(f.Module, "github.com/passbi/"),
+		})
+	}
+
+	event := map[string]any{
+		"event_id":    eventID,
+		"timestamp":   e.Time.UTC().Format(time.RFC3339Nano),
+		"level":       e.Level,
+		"platform":    "go",
+		"logger":      e.Tags["component"],
+		"environment": s.environment,
+		"server_name": s.serverName,
+		"tags":        e.Tags,
+		"extra":       e.Extra,
+		"message":     map[string]string{"formatted": e.Message},
+	}
+	if release := e.Tags["release"]; release != "" {
+		event["release"] = release
+	}
+
+	// The error becomes the exception, grouped by type and stack; records
+	// without one are grouped by message
+	if e.Error != "" {
+		typ := e.ErrorType
+		if typ == "" {
+			typ = e.Message
+		}
+		event["exception"] = map[string]any{
+			"values": []map[string]any{{
+				"type":       typ,
+				"value":      e.Message + ": " + e.Error,
+				"stacktrace": map[string]any{"frames": frames},
+			}},
+		}
+	} else {
+		event["threads"] = map[string]any{
+			"values": []map[string]any{{"stacktrace": map[string]any{"frames": frames}}},
+		}
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `{"event_id":%q,"sent_at":%q}`+"\n", eventID, time.Now().UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(&b, `{"type":"event","length":%d}`+"\n", len(payload))
+	b.Write(payload)
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
@@ -0,0 +1,124 @@
+package eta
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/passbi/passbi_core/internal/mapmatch"
+	"github.com/passbi/passbi_core/internal/realtime"
+)
+
+// maxDetectedDelay bounds the delays believed from positions; a vehicle
+// further off its schedule is on another trip than the one it reports
+const maxDetectedDelay = 2 * time.Hour
+
+// RunDelays detects the delays of trips from their vehicles' positions every
+// cfg.DelayInterval until ctx is done
+func RunDelays(ctx context.Context, pool *pgxpool.Pool, cfg Config) {
+	ticker := time.NewTicker(cfg.DelayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			runCtx, cancel := context.WithTimeout(ctx, cfg.DelayInterval)
+			_, err := DetectDelays(runCtx, pool, cfg, now)
+			cancel()
+			if err != nil {
+				logger.ErrorContext(ctx, "Delay detection failed", "error", err)
+			}
+		}
+	}
+}
+
+// DetectDelays compares where each trip's vehicle was last seen within
+// cfg.AnchorMaxAge, its latest fix snapped to the trip's line or else the
+// furthest stop it was near, with where the schedule has it then, and stores
+// the difference, decayed over the distance to each following stop, as the
+// trip's realtime update so departures and routing pick it up
+// It returns how many trips were stored; trips a feed updated recently keep
+// the feed's update
+func DetectDelays(ctx context.Context, pool *pgxpool.Pool, cfg Config, now time.Time) (int, error) {
+	keys, trips, located, err := locateTrips(ctx, pool, cfg, now)
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+
+	detected := make([]realtime.Detected, 0, len(keys))
+	for _, k := range keys {
+		if d, ok := detectDelay(k, trips[k], located[k], cfg); ok {
+			detected = append(detected, d)
+		}
+	}
+	return realtime.StoreDetected(ctx, pool, detected)
+}
+
+// detectDelay works out a trip's delay where it was last seen: at the stop
+// of its last visit, or between that stop and the next one, where the
+// schedule runs from the departure of one to the arrival at the other
+func detectDelay(k tripKey, t scheduledTrip, v visit, cfg Config) (realtime.Detected, bool) {
+	from := -1
+	for i, s := range t.stops {
+		if s.Sequence == v.sequence {
+			from = i
+			break
+		}
+	}
+	if from < 0 {
+		return realtime.Detected{}, false
+	}
+
+	scheduled := ScheduledAt(t.stops, from, v.progress)
+	next := from
+	if v.progress > 0 && from+1 < len(t.stops) {
+		next = from + 1
+	}
+
+	at := v.at.UTC()
+	day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+	delay := int(at.Sub(day).Seconds()) - scheduled
+	// Past midnight, trips of the previous service day run beyond 24:00:00
+	if delay < -12*3600 {
+		day = day.AddDate(0, 0, -1)
+		delay += 24 * 3600
+	}
+	if time.Duration(abs(delay))*time.Second > maxDetectedDelay {
+		return realtime.Detected{}, false
+	}
+
+	// Distances run along the trip's line once matchLines has set it
+	stops := make([]realtime.ScheduledStop, len(t.stops))
+	distances := t.distances
+	if len(distances) != len(t.stops) {
+		distances = make([]float64, len(t.stops))
+		for i := 1; i < len(t.stops); i++ {
+			prev, s := t.stops[i-1], t.stops[i]
+			distances[i] = distances[i-1] + mapmatch.Distance(prev.Lat, prev.Lon, s.Lat, s.Lon)
+		}
+	}
+	for i, s := range t.stops {
+		stops[i] = realtime.ScheduledStop{Sequence: s.Sequence, StopID: s.StopID, ArrivalSecs: s.ArrivalSecs, DepartureSecs: s.DepartureSecs}
+	}
+
+	return realtime.Detected{
+		AgencyID:    k.agencyID,
+		TripID:      k.tripID,
+		RouteID:     t.routeID,
+		VehicleID:   v.vehicleID,
+		ServiceDate: day,
+		Delay:       delay,
+		ObservedAt:  at,
+		Predictions: realtime.DecayDelay(stops, distances, next, delay, cfg.DecayDistance, int(cfg.MinDelay.Seconds())),
+	}, true
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,210 @@
+// Package eta predicts arrivals at stops from where vehicles were last seen
+// and how long the segments ahead of them took at the same hour on previous
+// days, learned from the GPS fixes pushed to the vehicles package
+package eta
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/logging"
+)
+
+var logger = logging.For("eta")
+
+// maxSegmentTime bounds the travel times learned between two stops; longer
+// gaps are a vehicle out of service, not traffic
+const maxSegmentTime = time.Hour
+
+// Config holds the learner settings
+type Config struct {
+	Interval      time.Duration // how often arrivals are recorded and segments relearned
+	History       time.Duration // observed arrivals kept and learned from
+	MinSamples    int           // observations a segment needs before it replaces the schedule
+	ArrivalRadius float64       // meters from a stop at which a fix counts as an arrival
+	AnchorMaxAge  time.Duration // how recent a vehicle's last arrival must be to predict from
+	DelayInterval time.Duration // how often delays are detected from vehicle positions
+	DecayDistance float64       // meters over which a detected delay halves downstream
+	MinDelay      time.Duration // detected delays smaller than this are not propagated
+	MatchOffset   float64       // meters from its trip's line beyond which a fix is not snapped to it
+}
+
+// DefaultConfig learns from four weeks of arrivals every 15 minutes and
+// detects delays every 30 seconds
+func DefaultConfig() Config {
+	return Config{
+		Interval:      15 * time.Minute,
+		History:       28 * 24 * time.Hour,
+		MinSamples:    5,
+		ArrivalRadius: 40,
+		AnchorMaxAge:  15 * time.Minute,
+		DelayInterval: 30 * time.Second,
+		DecayDistance: 5000,
+		MinDelay:      time.Minute,
+		MatchOffset:   50,
+	}
+}
+
+// ConfigFromEnv returns the defaults overridden by ETA_* variables
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	if d, err := time.ParseDuration(os.Getenv("ETA_LEARN_INTERVAL")); err == nil && d > 0 {
+		cfg.Interval = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("ETA_HISTORY")); err == nil && d > 0 {
+		cfg.History = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("ETA_MIN_SAMPLES")); err == nil && n > 0 {
+		cfg.MinSamples = n
+	}
+	if f, err := strconv.ParseFloat(os.Getenv("ETA_ARRIVAL_RADIUS"), 64); err == nil && f > 0 {
+		cfg.ArrivalRadius = f
+	}
+	if d, err := time.ParseDuration(os.Getenv("ETA_ANCHOR_MAX_AGE")); err == nil && d > 0 {
+		cfg.AnchorMaxAge = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("ETA_DELAY_INTERVAL")); err == nil && d > 0 {
+		cfg.DelayInterval = d
+	}
+	// Zero is allowed: delays then carry over to the terminus
+	if f, err := strconv.ParseFloat(os.Getenv("ETA_DELAY_DECAY_DISTANCE"), 64); err == nil && f >= 0 {
+		cfg.DecayDistance = f
+	}
+	if d, err := time.ParseDuration(os.Getenv("ETA_DELAY_MIN")); err == nil && d > 0 {
+		cfg.MinDelay = d
+	}
+	if f, err := strconv.ParseFloat(os.Getenv("ETA_MATCH_MAX_OFFSET"), 64); err == nil && f > 0 {
+		cfg.MatchOffset = f
+	}
+	return cfg
+}
+
+// SegmentKey identifies the trips of a route leaving a stop for the next one
+// during an hour of the day (UTC)
+type SegmentKey struct {
+	RouteID    string
+	FromStopID string
+	ToStopID   string
+	Hour       int
+}
+
+// SegmentStats is the distribution of the arrival-to-arrival times observed
+// on a segment
+type SegmentStats struct {
+	Samples int
+	Median  int // seconds
+	P85     int // seconds
+}
+
+// Model is the learned segment times; segments it has not learned yet are
+// predicted from the schedule
+type Model struct {
+	segments      map[SegmentKey]SegmentStats
+	minSamples    int
+	anchorAge     time.Duration
+	arrivalRadius float64
+	matchOffset   float64
+}
+
+// NewModel returns a model over learned segments
+func NewModel(segments map[SegmentKey]SegmentStats, cfg Config) *Model {
+	return &Model{segments: segments, minSamples: cfg.MinSamples, anchorAge: cfg.AnchorMaxAge,
+		arrivalRadius: cfg.ArrivalRadius, matchOffset: cfg.MatchOffset}
+}
+
+var current atomic.Pointer[Model]
+
+// Current returns the model loaded by Run, nil before the first load
+func Current() *Model {
+	return current.Load()
+}
+
+// Segments is the number of segments the model learned
+func (m *Model) Segments() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.segments)
+}
+
+// travel returns the time to expect from one stop to the next when leaving
+// at secs (since midnight): the learned median when the segment has enough
+// samples at that hour, else the scheduled time
+func (m *Model) travel(routeID string, from, to Stop, secs int) (int, bool) {
+	// Learned times run from arrival to arrival, so they include the dwell
+	scheduled := max(to.ArrivalSecs-from.ArrivalSecs, 0)
+	if m == nil {
+		return scheduled, false
+	}
+	hour := (secs / 3600) % 24
+	s, ok := m.segments[SegmentKey{RouteID: routeID, FromStopID: from.StopID, ToStopID: to.StopID, Hour: hour}]
+	if !ok || s.Samples < m.minSamples {
+		return scheduled, false
+	}
+	return s.Median, true
+}
+
+// Stop is a scheduled call of a trip, in seconds since midnight of the
+// service day
+type Stop struct {
+	Sequence      int
+	StopID        string
+	ArrivalSecs   int
+	DepartureSecs int
+	Lat, Lon      float64
+}
+
+// Anchor is the last stop a trip's vehicle was seen at, and when
+// A vehicle seen between stops has the share of the way to the next stop it
+// already travelled as Progress
+type Anchor struct {
+	Sequence int
+	Secs     int // seconds since midnight of the service day
+	Progress float64
+}
+
+// Prediction is the expected call of a trip at a stop
+type Prediction struct {
+	ArrivalSecs   int
+	DepartureSecs int
+	// Learned is set when at least one segment used learned times rather
+	// than the schedule
+	Learned bool
+}
+
+// Predict walks a trip's stops from its anchor to the stop with sequence
+// target, adding up the expected time of each segment at the hour the
+// vehicle will reach it; of the anchor's segment, only the part the vehicle
+// has not travelled yet counts
+// It returns false when the vehicle has already passed target, or when
+// either stop is not in stops
+func (m *Model) Predict(routeID string, stops []Stop, anchor Anchor, target int) (Prediction, bool) {
+	from := -1
+	for i, s := range stops {
+		if s.Sequence == anchor.Sequence {
+			from = i
+		}
+		if s.Sequence == target {
+			if from < 0 || i == from {
+				return Prediction{}, false
+			}
+			p := Prediction{ArrivalSecs: anchor.Secs}
+			for j := from; j < i; j++ {
+				secs, learned := m.travel(routeID, stops[j], stops[j+1], p.ArrivalSecs)
+				// A vehicle between stops is done dwelling at the first
+				if j == from && anchor.Progress > 0 {
+					moving := max(secs-(stops[j].DepartureSecs-stops[j].ArrivalSecs), 0)
+					secs = int(math.Round(float64(moving) * (1 - min(anchor.Progress, 1))))
+				}
+				p.ArrivalSecs += secs
+				p.Learned = p.Learned || learned
+			}
+			p.DepartureSecs = p.ArrivalSecs + max(s.DepartureSecs-s.ArrivalSecs, 0)
+			return p, true
+		}
+	}
+	return Prediction{}, false
+}
@@ -0,0 +1,185 @@
+package eta
+
+import (
+	"testing"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/mapmatch"
+	"github.com/stretchr/testify/assert"
+)
+
+// Stops at 7:00, 7:05 (one minute dwell), 7:10 and 7:20
+var tripStops = []Stop{
+	{Sequence: 1, StopID: "A", ArrivalSecs: 25200, DepartureSecs: 25200},
+	{Sequence: 2, StopID: "B", ArrivalSecs: 25500, DepartureSecs: 25560},
+	{Sequence: 3, StopID: "C", ArrivalSecs: 25800, DepartureSecs: 25800},
+	{Sequence: 4, StopID: "D", ArrivalSecs: 26400, DepartureSecs: 26460},
+}
+
+func TestPredictFromSchedule(t *testing.T) {
+	m := NewModel(nil, DefaultConfig())
+
+	// Two minutes late at B, the lateness carries on
+	p, ok := m.Predict("R7", tripStops, Anchor{Sequence: 2, Secs: 25620}, 4)
+	assert.True(t, ok)
+	assert.False(t, p.Learned)
+	assert.Equal(t, 26520, p.ArrivalSecs)
+	assert.Equal(t, 26580, p.DepartureSecs, "the scheduled dwell is kept")
+}
+
+func TestPredictLearned(t *testing.T) {
+	cfg := DefaultConfig()
+	m := NewModel(map[SegmentKey]SegmentStats{
+		{RouteID: "R7", FromStopID: "B", ToStopID: "C", Hour: 7}: {Samples: 20, Median: 540, P85: 700},
+		{RouteID: "R7", FromStopID: "C", ToStopID: "D", Hour: 7}: {Samples: 3, Median: 900, P85: 1000},
+		{RouteID: "R7", FromStopID: "C", ToStopID: "D", Hour: 8}: {Samples: 9, Median: 120, P85: 200},
+	}, cfg)
+
+	// B to C takes 9 minutes at 7h; C to D has too few samples at 7h, so
+	// the schedule's 10 minutes apply
+	p, ok := m.Predict("R7", tripStops, Anchor{Sequence: 2, Secs: 25500}, 4)
+	assert.True(t, ok)
+	assert.True(t, p.Learned)
+	assert.Equal(t, 25500+540+600, p.ArrivalSecs)
+
+	// Reaching C after 8h uses the 8h time of C to D
+	p, _ = m.Predict("R7", tripStops, Anchor{Sequence: 3, Secs: 8*3600 + 60}, 4)
+	assert.Equal(t, 8*3600+60+120, p.ArrivalSecs)
+
+	// Another route over the same stops learns nothing from R7
+	p, _ = m.Predict("R8", tripStops, Anchor{Sequence: 2, Secs: 25500}, 3)
+	assert.False(t, p.Learned)
+}
+
+func TestPredictPassed(t *testing.T) {
+	m := NewModel(nil, DefaultConfig())
+
+	_, ok := m.Predict("R7", tripStops, Anchor{Sequence: 3, Secs: 25800}, 2)
+	assert.False(t, ok, "the vehicle is past the stop")
+	_, ok = m.Predict("R7", tripStops, Anchor{Sequence: 3, Secs: 25800}, 3)
+	assert.False(t, ok, "the vehicle is at the stop")
+	_, ok = m.Predict("R7", tripStops, Anchor{Sequence: 9, Secs: 25800}, 4)
+	assert.False(t, ok, "unknown anchor")
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("ETA_HISTORY", "336h")
+	t.Setenv("ETA_MIN_SAMPLES", "10")
+	t.Setenv("ETA_ARRIVAL_RADIUS", "-3")
+
+	cfg := ConfigFromEnv()
+	assert.Equal(t, 14*24*time.Hour, cfg.History)
+	assert.Equal(t, 10, cfg.MinSamples)
+	assert.Equal(t, DefaultConfig().ArrivalRadius, cfg.ArrivalRadius)
+}
+
+func TestDetectDelay(t *testing.T) {
+	cfg := DefaultConfig()
+	// Stops about 1.1 km apart heading north
+	stops := make([]Stop, len(tripStops))
+	for i, s := range tripStops {
+		s.Lat, s.Lon = 14.70+0.01*float64(i), -17.44
+		stops[i] = s
+	}
+	trip := scheduledTrip{routeID: "R7", stops: stops}
+	key := tripKey{"ddd", "T1"}
+
+	// Reached B at 7:09, four minutes late
+	at := time.Date(2024, 3, 4, 7, 9, 0, 0, time.UTC)
+	d, ok := detectDelay(key, trip, visit{vehicleID: "V1", sequence: 2, at: at}, cfg)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, 240, d.Delay)
+	assert.Equal(t, "V1", d.VehicleID)
+	assert.Equal(t, time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), d.ServiceDate)
+	if assert.Len(t, d.Predictions, 3) {
+		assert.Equal(t, 240, *d.Predictions[0].ArrivalDelay)
+		assert.InDelta(t, 205, *d.Predictions[1].ArrivalDelay, 2, "1.1 km of a 5 km half distance")
+		assert.InDelta(t, 176, *d.Predictions[2].ArrivalDelay, 2)
+	}
+
+	// A trip scheduled at 24:10 seen at 00:12 belongs to the previous day
+	late := scheduledTrip{routeID: "R7", stops: []Stop{{Sequence: 1, StopID: "A", ArrivalSecs: 87000}}}
+	d, ok = detectDelay(key, late, visit{sequence: 1, at: time.Date(2024, 3, 5, 0, 12, 0, 0, time.UTC)}, cfg)
+	assert.True(t, ok)
+	assert.Equal(t, 120, d.Delay)
+	assert.Equal(t, time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), d.ServiceDate)
+
+	_, ok = detectDelay(key, trip, visit{sequence: 2, at: at.Add(3 * time.Hour)}, cfg)
+	assert.False(t, ok, "hours off is another trip")
+	_, ok = detectDelay(key, trip, visit{sequence: 9, at: at}, cfg)
+	assert.False(t, ok)
+}
+
+func TestPredictProgress(t *testing.T) {
+	m := NewModel(nil, DefaultConfig())
+
+	// A quarter of the way from B to C at 7:07: three quarters of the
+	// scheduled 4 minutes (from B's departure) are left
+	p, ok := m.Predict("R7", tripStops, Anchor{Sequence: 2, Secs: 25620, Progress: 0.25}, 3)
+	assert.True(t, ok)
+	assert.Equal(t, 25620+180, p.ArrivalSecs)
+
+	_, ok = m.Predict("R7", tripStops, Anchor{Sequence: 2, Secs: 25620, Progress: 0.25}, 2)
+	assert.False(t, ok, "the vehicle left the stop")
+}
+
+// lineTrip is tripStops about 1.1 km apart heading north, with the line
+// through them
+func lineTrip() scheduledTrip {
+	stops := make([]Stop, len(tripStops))
+	lats, lons := make([]float64, len(tripStops)), make([]float64, len(tripStops))
+	for i, s := range tripStops {
+		s.Lat, s.Lon = 14.70+0.01*float64(i), -17.44
+		stops[i] = s
+		lats[i], lons[i] = s.Lat, s.Lon
+	}
+	line := mapmatch.NewLine(lats, lons)
+	return scheduledTrip{routeID: "R7", stops: stops, line: line, distances: line.StopDistances(lats, lons)}
+}
+
+func TestLocate(t *testing.T) {
+	trip := lineTrip()
+	at := time.Date(2024, 3, 4, 7, 7, 0, 0, time.UTC)
+	seenAtB := visit{vehicleID: "V1", sequence: 2, at: at.Add(-time.Minute)}
+
+	// 20 m off the road, a quarter of the way from B to C
+	f := fix{vehicleID: "V1", lat: 14.7125, lon: -17.44018, at: at}
+	v, ok := trip.locate(seenAtB, true, f, true, 50)
+	if assert.True(t, ok) {
+		assert.Equal(t, 2, v.sequence)
+		assert.InDelta(t, 0.25, v.progress, 0.01)
+		assert.Equal(t, at, v.at)
+	}
+
+	v, ok = trip.locate(visit{}, false, f, true, 50)
+	assert.True(t, ok, "a fix on the line anchors without a stop visit")
+	assert.Equal(t, 2, v.sequence)
+
+	far := fix{lat: 14.7125, lon: -17.445, at: at}
+	v, _ = trip.locate(seenAtB, true, far, true, 50)
+	assert.Equal(t, seenAtB, v, "a fix off the line keeps the stop visit")
+	_, ok = trip.locate(visit{}, false, far, true, 50)
+	assert.False(t, ok)
+
+	stale := fix{lat: 14.7125, lon: -17.44, at: at.Add(-time.Hour)}
+	v, _ = trip.locate(seenAtB, true, stale, true, 50)
+	assert.Equal(t, seenAtB, v, "a fix older than the visit")
+}
+
+func TestDetectDelayBetweenStops(t *testing.T) {
+	trip := lineTrip()
+
+	// Halfway from B to C at 7:10, scheduled at 7:08
+	at := time.Date(2024, 3, 4, 7, 10, 0, 0, time.UTC)
+	d, ok := detectDelay(tripKey{"ddd", "T1"}, trip, visit{vehicleID: "V1", sequence: 2, at: at, progress: 0.5}, DefaultConfig())
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, 120, d.Delay)
+	if assert.Len(t, d.Predictions, 2, "from C on") {
+		assert.Equal(t, 3, d.Predictions[0].Sequence)
+		assert.Equal(t, 120, *d.Predictions[0].ArrivalDelay)
+	}
+}
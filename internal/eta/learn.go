@@ -0,0 +1,339 @@
+package eta
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/passbi/passbi_core/internal/mapmatch"
+	"github.com/passbi/passbi_core/internal/realtime"
+)
+
+// Run records the stop arrivals of recent GPS fixes and relearns the segment
+// times every cfg.Interval until ctx is done, then loads them as the
+// Current model
+// Several instances may run it: one relearns at a time, all reload
+func Run(ctx context.Context, pool *pgxpool.Pool, cfg Config) {
+	if err := Reload(ctx, pool, cfg); err != nil {
+		logger.ErrorContext(ctx, "Failed to load learned segment times", "error", err)
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	// Fixes may arrive a little after they were recorded, so each pass looks
+	// back over two intervals; arrivals already recorded are kept
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			runCtx, cancel := context.WithTimeout(ctx, cfg.Interval)
+			err := Learn(runCtx, pool, cfg, now.Add(-2*cfg.Interval), now)
+			if err == nil {
+				err = Reload(runCtx, pool, cfg)
+			}
+			cancel()
+			if err != nil {
+				logger.ErrorContext(ctx, "ETA learning failed", "error", err)
+			}
+		}
+	}
+}
+
+// Learn records the stop arrivals of the fixes recorded since the given
+// time, then recomputes the segment times from the arrivals of the last
+// cfg.History and forgets older ones
+// It does nothing when another instance is learning
+func Learn(ctx context.Context, pool *pgxpool.Pool, cfg Config, since, now time.Time) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var locked bool
+	if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock(hashtext('passbi:eta-learn'))`).Scan(&locked); err != nil {
+		return fmt.Errorf("failed to take the learner lock: %w", err)
+	}
+	if !locked {
+		return nil
+	}
+
+	// The first fix within the radius of each stop of the trip is its
+	// arrival; a loop trip visiting a stop twice gets the same fix for both
+	arrivals, err := tx.Exec(ctx, `
+		INSERT INTO stop_arrival
+			(agency_id, trip_id, service_date, stop_sequence, stop_id, route_id, vehicle_id, arrived_at)
+		SELECT DISTINCT ON (vp.agency_id, vp.trip_id, (vp.recorded_at AT TIME ZONE 'UTC')::date, st.stop_sequence)
+			vp.agency_id, vp.trip_id, (vp.recorded_at AT TIME ZONE 'UTC')::date, st.stop_sequence,
+			st.stop_id, t.route_id, vp.vehicle_id, vp.recorded_at
+		FROM vehicle_position vp
+		JOIN trip t ON t.agency_id = vp.agency_id AND t.trip_id = vp.trip_id
+		JOIN stop_time st ON st.agency_id = vp.agency_id AND st.trip_id = vp.trip_id
+		JOIN stop s ON s.id = st.stop_id
+		WHERE vp.recorded_at >= $1 AND vp.recorded_at < $2
+		  AND ST_DWithin(s.geom, ST_SetSRID(ST_MakePoint(vp.lon, vp.lat), 4326)::geography, $3)
+		ORDER BY vp.agency_id, vp.trip_id, (vp.recorded_at AT TIME ZONE 'UTC')::date, st.stop_sequence, vp.recorded_at
+		ON CONFLICT (agency_id, trip_id, service_date, stop_sequence) DO UPDATE
+		SET arrived_at = EXCLUDED.arrived_at, vehicle_id = EXCLUDED.vehicle_id
+		WHERE EXCLUDED.arrived_at < stop_arrival.arrived_at
+	`, since, now, cfg.ArrivalRadius)
+	if err != nil {
+		return fmt.Errorf("failed to record stop arrivals: %w", err)
+	}
+
+	start := now.Add(-cfg.History)
+	if _, err := tx.Exec(ctx, `DELETE FROM stop_arrival WHERE service_date < $1::date`, start); err != nil {
+		return fmt.Errorf("failed to purge stop arrivals: %w", err)
+	}
+
+	// Only arrivals at consecutive stops of the trip make a segment; a stop
+	// the vehicle passed without a fix nearby breaks the chain
+	segments, err := tx.Exec(ctx, `
+		WITH observed AS (
+			SELECT a.route_id, a.stop_id AS from_stop_id, b.stop_id AS to_stop_id,
+				EXTRACT(HOUR FROM a.arrived_at AT TIME ZONE 'UTC')::smallint AS hour,
+				EXTRACT(EPOCH FROM b.arrived_at - a.arrived_at) AS secs
+			FROM stop_arrival a
+			JOIN LATERAL (
+				SELECT st.stop_sequence FROM stop_time st
+				WHERE st.agency_id = a.agency_id AND st.trip_id = a.trip_id AND st.stop_sequence > a.stop_sequence
+				ORDER BY st.stop_sequence
+				LIMIT 1
+			) following ON true
+			JOIN stop_arrival b ON b.agency_id = a.agency_id AND b.trip_id = a.trip_id
+				AND b.service_date = a.service_date AND b.stop_sequence = following.stop_sequence
+		)
+		INSERT INTO segment_travel_time (route_id, from_stop_id, to_stop_id, hour, samples, median_secs, p85_secs, updated_at)
+		SELECT route_id, from_stop_id, to_stop_id, hour, COUNT(*),
+			ROUND(percentile_cont(0.5) WITHIN GROUP (ORDER BY secs)),
+			ROUND(percentile_cont(0.85) WITHIN GROUP (ORDER BY secs)),
+			$1
+		FROM observed
+		WHERE secs > 0 AND secs <= $2
+		GROUP BY route_id, from_stop_id, to_stop_id, hour
+		ON CONFLICT (route_id, from_stop_id, to_stop_id, hour) DO UPDATE
+		SET samples = EXCLUDED.samples, median_secs = EXCLUDED.median_secs,
+			p85_secs = EXCLUDED.p85_secs, updated_at = EXCLUDED.updated_at
+	`, now, maxSegmentTime.Seconds())
+	if err != nil {
+		return fmt.Errorf("failed to learn segment times: %w", err)
+	}
+	// Segments without arrivals left in the history are forgotten
+	if _, err := tx.Exec(ctx, `DELETE FROM segment_travel_time WHERE updated_at < $1`, now); err != nil {
+		return fmt.Errorf("failed to purge segment times: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit learned segment times: %w", err)
+	}
+	logger.Info("Learned segment times", "arrivals", arrivals.RowsAffected(), "segments", segments.RowsAffected())
+	return nil
+}
+
+// Reload makes the segment times in the database the Current model
+func Reload(ctx context.Context, pool *pgxpool.Pool, cfg Config) error {
+	rows, err := pool.Query(ctx, `
+		SELECT route_id, from_stop_id, to_stop_id, hour, samples, median_secs, p85_secs
+		FROM segment_travel_time
+		WHERE samples >= $1
+	`, cfg.MinSamples)
+	if err != nil {
+		return fmt.Errorf("failed to load segment times: %w", err)
+	}
+	defer rows.Close()
+
+	segments := make(map[SegmentKey]SegmentStats)
+	for rows.Next() {
+		var k SegmentKey
+		var s SegmentStats
+		if err := rows.Scan(&k.RouteID, &k.FromStopID, &k.ToStopID, &k.Hour, &s.Samples, &s.Median, &s.P85); err != nil {
+			return err
+		}
+		segments[k] = s
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load segment times: %w", err)
+	}
+
+	current.Store(NewModel(segments, cfg))
+	return nil
+}
+
+// PredictCalls predicts the calls of trips whose vehicle was seen within the
+// model's anchor age of now, from where its latest fix is along the trip, or
+// else from the furthest stop it was near; calls of other trips, or already
+// passed, are left out
+// Anchors come straight from the fixes, not stop_arrival, so predictions
+// follow vehicles between two learner passes
+func (m *Model) PredictCalls(ctx context.Context, pool *pgxpool.Pool, calls []realtime.Call, serviceDate, now time.Time) (map[realtime.Call]Prediction, error) {
+	predictions := make(map[realtime.Call]Prediction)
+	if m == nil || len(calls) == 0 {
+		return predictions, nil
+	}
+
+	keys := make([]tripKey, len(calls))
+	for i, c := range calls {
+		keys[i] = tripKey{c.AgencyID, c.TripID}
+	}
+	since := now.Add(-m.anchorAge)
+	visits, err := lastVisits(ctx, pool, since, m.arrivalRadius, keys)
+	if err != nil {
+		return nil, err
+	}
+	fixes, err := latestFixes(ctx, pool, since, keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(visits) == 0 && len(fixes) == 0 {
+		return predictions, nil
+	}
+
+	keys = keys[:0]
+	for k := range fixes {
+		keys = append(keys, k)
+	}
+	for k := range visits {
+		if _, ok := fixes[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	trips, err := loadTrips(ctx, pool, keys)
+	if err != nil {
+		return nil, err
+	}
+	if err := matchLines(ctx, pool, trips); err != nil {
+		return nil, err
+	}
+
+	day := time.Date(serviceDate.Year(), serviceDate.Month(), serviceDate.Day(), 0, 0, 0, 0, time.UTC)
+	for _, c := range calls {
+		k := tripKey{c.AgencyID, c.TripID}
+		v, visited := visits[k]
+		f, fixed := fixes[k]
+		v, ok := trips[k].locate(v, visited, f, fixed, m.matchOffset)
+		if !ok {
+			continue
+		}
+		anchor := Anchor{Sequence: v.sequence, Secs: int(v.at.Sub(day).Seconds()), Progress: v.progress}
+		if p, ok := m.Predict(trips[k].routeID, trips[k].stops, anchor, c.Sequence); ok {
+			predictions[c] = p
+		}
+	}
+	return predictions, nil
+}
+
+// tripKey identifies a trip of an agency
+type tripKey struct{ agencyID, tripID string }
+
+// visit is the furthest stop of its trip a vehicle was seen near, and the
+// first fix there; a vehicle located between stops by locate has the share
+// of the way to the next stop it travelled as progress
+type visit struct {
+	vehicleID string
+	sequence  int
+	at        time.Time
+	progress  float64
+}
+
+// lastVisits returns the last visit of each trip with a fix within radius of
+// one of its stops since the given time; a nil trips looks at every trip
+func lastVisits(ctx context.Context, pool *pgxpool.Pool, since time.Time, radius float64, trips []tripKey) (map[tripKey]visit, error) {
+	var agencyIDs, tripIDs []string
+	if trips != nil {
+		agencyIDs, tripIDs = make([]string, len(trips)), make([]string, len(trips))
+		for i, k := range trips {
+			agencyIDs[i], tripIDs[i] = k.agencyID, k.tripID
+		}
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT DISTINCT ON (vp.agency_id, vp.trip_id)
+			vp.agency_id, vp.trip_id, vp.vehicle_id, st.stop_sequence, vp.recorded_at
+		FROM vehicle_position vp
+		JOIN stop_time st ON st.agency_id = vp.agency_id AND st.trip_id = vp.trip_id
+		JOIN stop s ON s.id = st.stop_id
+		WHERE vp.recorded_at >= $1
+		  AND ST_DWithin(s.geom, ST_SetSRID(ST_MakePoint(vp.lon, vp.lat), 4326)::geography, $2)
+		  AND ($3::text[] IS NULL OR (vp.agency_id, vp.trip_id) IN (SELECT * FROM unnest($3::text[], $4::text[])))
+		ORDER BY vp.agency_id, vp.trip_id, st.stop_sequence DESC, vp.recorded_at
+	`, since, radius, agencyIDs, tripIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query vehicle positions: %w", err)
+	}
+	defer rows.Close()
+
+	visits := make(map[tripKey]visit)
+	for rows.Next() {
+		var k tripKey
+		var v visit
+		if err := rows.Scan(&k.agencyID, &k.tripID, &v.vehicleID, &v.sequence, &v.at); err != nil {
+			return nil, err
+		}
+		visits[k] = v
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query vehicle positions: %w", err)
+	}
+	return visits, nil
+}
+
+// scheduledTrip is a trip's route and timed stops in sequence order
+// matchLines sets the line it follows and the distance of each stop along it
+type scheduledTrip struct {
+	routeID   string
+	shapeID   string
+	direction int
+	stops     []Stop
+	line      *mapmatch.Line
+	distances []float64
+}
+
+// loadTrips returns the scheduled stops of trips
+func loadTrips(ctx context.Context, pool *pgxpool.Pool, keys []tripKey) (map[tripKey]scheduledTrip, error) {
+	agencyIDs, tripIDs := make([]string, len(keys)), make([]string, len(keys))
+	for i, k := range keys {
+		agencyIDs[i], tripIDs[i] = k.agencyID, k.tripID
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT st.agency_id, st.trip_id, t.route_id, COALESCE(t.shape_id, ''), t.direction, st.stop_sequence, st.stop_id,
+			COALESCE(st.arrival_seconds, st.departure_seconds),
+			COALESCE(st.departure_seconds, st.arrival_seconds),
+			s.lat, s.lon
+		FROM stop_time st
+		JOIN unnest($1::text[], $2::text[]) AS c(agency_id, trip_id)
+			ON st.agency_id = c.agency_id AND st.trip_id = c.trip_id
+		JOIN trip t ON t.agency_id = st.agency_id AND t.trip_id = st.trip_id
+		JOIN stop s ON s.id = st.stop_id
+		WHERE COALESCE(st.arrival_seconds, st.departure_seconds) IS NOT NULL
+		ORDER BY st.agency_id, st.trip_id, st.stop_sequence
+	`, agencyIDs, tripIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stop times: %w", err)
+	}
+	defer rows.Close()
+
+	trips := make(map[tripKey]scheduledTrip)
+	for rows.Next() {
+		var k tripKey
+		var routeID, shapeID string
+		var direction int
+		var s Stop
+		if err := rows.Scan(&k.agencyID, &k.tripID, &routeID, &shapeID, &direction, &s.Sequence, &s.StopID,
+			&s.ArrivalSecs, &s.DepartureSecs, &s.Lat, &s.Lon); err != nil {
+			return nil, err
+		}
+		t := trips[k]
+		t.routeID, t.shapeID, t.direction = routeID, shapeID, direction
+		t.stops = append(t.stops, s)
+		trips[k] = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query stop times: %w", err)
+	}
+	return trips, nil
+}
@@ -0,0 +1,247 @@
+package eta
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/passbi/passbi_core/internal/mapmatch"
+)
+
+// fix is the latest GPS fix of a trip's vehicle
+type fix struct {
+	vehicleID string
+	lat, lon  float64
+	at        time.Time
+}
+
+// latestFixes returns the latest fix of each trip recorded since the given
+// time; a nil trips looks at every trip
+func latestFixes(ctx context.Context, pool *pgxpool.Pool, since time.Time, trips []tripKey) (map[tripKey]fix, error) {
+	var agencyIDs, tripIDs []string
+	if trips != nil {
+		agencyIDs, tripIDs = make([]string, len(trips)), make([]string, len(trips))
+		for i, k := range trips {
+			agencyIDs[i], tripIDs[i] = k.agencyID, k.tripID
+		}
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT DISTINCT ON (agency_id, trip_id) agency_id, trip_id, vehicle_id, lat, lon, recorded_at
+		FROM vehicle_position
+		WHERE recorded_at >= $1 AND trip_id IS NOT NULL
+		  AND ($2::text[] IS NULL OR (agency_id, trip_id) IN (SELECT * FROM unnest($2::text[], $3::text[])))
+		ORDER BY agency_id, trip_id, recorded_at DESC
+	`, since, agencyIDs, tripIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query vehicle positions: %w", err)
+	}
+	defer rows.Close()
+
+	fixes := make(map[tripKey]fix)
+	for rows.Next() {
+		var k tripKey
+		var f fix
+		if err := rows.Scan(&k.agencyID, &k.tripID, &f.vehicleID, &f.lat, &f.lon, &f.at); err != nil {
+			return nil, err
+		}
+		fixes[k] = f
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query vehicle positions: %w", err)
+	}
+	return fixes, nil
+}
+
+// matchLines gives each trip the line it follows, its shape or else the legs
+// between its stops, and where its stops are along it
+func matchLines(ctx context.Context, pool *pgxpool.Pool, trips map[tripKey]scheduledTrip) error {
+	var keys []mapmatch.ShapeKey
+	for k, t := range trips {
+		if t.shapeID != "" {
+			keys = append(keys, mapmatch.ShapeKey{AgencyID: k.agencyID, ShapeID: t.shapeID})
+		}
+	}
+	shapes, err := mapmatch.LoadShapes(ctx, pool, keys)
+	if err != nil {
+		return err
+	}
+
+	for k, t := range trips {
+		lats, lons := make([]float64, len(t.stops)), make([]float64, len(t.stops))
+		for i, s := range t.stops {
+			lats[i], lons[i] = s.Lat, s.Lon
+		}
+		t.line = shapes[mapmatch.ShapeKey{AgencyID: k.agencyID, ShapeID: t.shapeID}]
+		if t.line == nil {
+			t.line = mapmatch.NewLine(lats, lons)
+		}
+		if t.line != nil {
+			t.distances = t.line.StopDistances(lats, lons)
+		}
+		trips[k] = t
+	}
+	return nil
+}
+
+// locate tells where a trip's vehicle is along its stops: at the last stop
+// it was seen near, or, when its latest fix is newer and close enough to the
+// trip's line, part of the way from the stop before that fix to the next
+// The fix is snapped no earlier than the stop last visited, so a road the
+// trip drives both ways matches the right way
+func (t scheduledTrip) locate(v visit, visited bool, f fix, fixed bool, maxOffset float64) (visit, bool) {
+	from := -1
+	if visited {
+		for i, s := range t.stops {
+			if s.Sequence == v.sequence {
+				from = i
+				break
+			}
+		}
+		if from < 0 {
+			visited = false
+		}
+	}
+	if !fixed || t.line == nil || len(t.distances) != len(t.stops) || (visited && !f.at.After(v.at)) {
+		return v, visited
+	}
+
+	minDistance := 0.0
+	if from >= 0 {
+		minDistance = max(t.distances[from]-maxOffset, 0)
+	}
+	m, ok := t.line.Locate(f.lat, f.lon, minDistance)
+	if !ok || m.Offset > maxOffset {
+		return v, visited
+	}
+
+	i := max(from, 0)
+	for i+1 < len(t.stops) && t.distances[i+1] <= m.Distance {
+		i++
+	}
+	located := visit{vehicleID: f.vehicleID, sequence: t.stops[i].Sequence, at: f.at}
+	if i+1 < len(t.stops) {
+		if leg := t.distances[i+1] - t.distances[i]; leg > 0 {
+			located.progress = max(m.Distance-t.distances[i], 0) / leg
+		}
+	}
+	return located, true
+}
+
+// locateTrips finds where the vehicle of each trip seen within
+// cfg.AnchorMaxAge of now is; it returns the located trips sorted, so
+// instances storing them at the same time lock them in the same order
+func locateTrips(ctx context.Context, pool *pgxpool.Pool, cfg Config, now time.Time) ([]tripKey, map[tripKey]scheduledTrip, map[tripKey]visit, error) {
+	since := now.Add(-cfg.AnchorMaxAge)
+	visits, err := lastVisits(ctx, pool, since, cfg.ArrivalRadius, nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	fixes, err := latestFixes(ctx, pool, since, nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(visits) == 0 && len(fixes) == 0 {
+		return nil, nil, nil, nil
+	}
+
+	keys := make([]tripKey, 0, len(fixes))
+	for k := range fixes {
+		keys = append(keys, k)
+	}
+	for k := range visits {
+		if _, ok := fixes[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	trips, err := loadTrips(ctx, pool, keys)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := matchLines(ctx, pool, trips); err != nil {
+		return nil, nil, nil, err
+	}
+
+	located := make(map[tripKey]visit, len(keys))
+	for _, k := range keys {
+		t, ok := trips[k]
+		if !ok {
+			continue
+		}
+		v, visited := visits[k]
+		f, fixed := fixes[k]
+		if v, ok = t.locate(v, visited, f, fixed, cfg.MatchOffset); ok {
+			located[k] = v
+		}
+	}
+
+	keys = keys[:0]
+	for k := range located {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].agencyID != keys[j].agencyID {
+			return keys[i].agencyID < keys[j].agencyID
+		}
+		return keys[i].tripID < keys[j].tripID
+	})
+	return keys, trips, located, nil
+}
+
+// Position is where a trip's vehicle was last seen along the trip
+type Position struct {
+	AgencyID  string
+	TripID    string
+	RouteID   string
+	Direction int
+	VehicleID string
+	At        time.Time // when the vehicle was seen there
+	Stops     []Stop    // the trip's scheduled stops
+	Index     int       // the stop of Stops last passed
+	Progress  float64   // the part of the way from that stop to the next
+}
+
+// ScheduledSecs is when the trip's schedule has it where the vehicle is,
+// in seconds since midnight of its service day
+func (p Position) ScheduledSecs() int {
+	return ScheduledAt(p.Stops, p.Index, p.Progress)
+}
+
+// ScheduledAt is when a trip's schedule has it the given part of the way
+// from stops[i] to the next stop, from the departure of one to the arrival
+// at the other
+func ScheduledAt(stops []Stop, i int, progress float64) int {
+	if progress <= 0 || i+1 >= len(stops) {
+		return stops[i].ArrivalSecs
+	}
+	leg := max(stops[i+1].ArrivalSecs-stops[i].DepartureSecs, 0)
+	return stops[i].DepartureSecs + int(math.Round(progress*float64(leg)))
+}
+
+// Locate returns where the vehicle of each trip seen within cfg.AnchorMaxAge
+// of now is, the same way DetectDelays finds it
+func Locate(ctx context.Context, pool *pgxpool.Pool, cfg Config, now time.Time) ([]Position, error) {
+	keys, trips, located, err := locateTrips(ctx, pool, cfg, now)
+	if err != nil {
+		return nil, err
+	}
+
+	positions := make([]Position, 0, len(keys))
+	for _, k := range keys {
+		t, v := trips[k], located[k]
+		for i, s := range t.stops {
+			if s.Sequence == v.sequence {
+				positions = append(positions, Position{
+					AgencyID: k.agencyID, TripID: k.tripID, RouteID: t.routeID, Direction: t.direction,
+					VehicleID: v.vehicleID, At: v.at, Stops: t.stops, Index: i, Progress: v.progress,
+				})
+				break
+			}
+		}
+	}
+	return positions, nil
+}
@@ -0,0 +1,279 @@
+// Package feedback stores crowdsourced reports of wrong or missing transit
+// data and the data team's triage of them
+package feedback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/passbi/passbi_core/internal/repository"
+)
+
+// ErrNotFound is returned when a report ID does not exist
+var ErrNotFound = errors.New("feedback report not found")
+
+// ErrUnknownReference is returned when a report names a stop, route or trip
+// that is not in the database
+var ErrUnknownReference = errors.New("unknown reference")
+
+// Length limits keep reports readable and bound what the public endpoint stores
+const (
+	MaxDescriptionLength = 2000
+	MaxContactLength     = 200
+)
+
+// Kinds lists the accepted report kinds
+var Kinds = map[models.FeedbackKind]bool{
+	models.FeedbackWrongStopLocation: true,
+	models.FeedbackMissingStop:       true,
+	models.FeedbackMissingLine:       true,
+	models.FeedbackIncorrectTime:     true,
+	models.FeedbackOther:             true,
+}
+
+// Statuses lists the triage states
+var Statuses = map[models.FeedbackStatus]bool{
+	models.FeedbackNew:      true,
+	models.FeedbackTriaged:  true,
+	models.FeedbackResolved: true,
+	models.FeedbackRejected: true,
+}
+
+// Filter narrows down a report listing
+type Filter struct {
+	Status  models.FeedbackStatus
+	Kind    models.FeedbackKind
+	StopID  string
+	RouteID string
+	Limit   int
+	Offset  int
+}
+
+// Normalize trims and validates a report before it is stored
+// Each kind requires the context the data team needs to act on it
+func Normalize(r *models.FeedbackReport) error {
+	r.Kind = models.FeedbackKind(strings.ToLower(strings.TrimSpace(string(r.Kind))))
+	if !Kinds[r.Kind] {
+		return fmt.Errorf("invalid kind %q (use wrong_stop_location, missing_stop, missing_line, incorrect_time or other)", r.Kind)
+	}
+
+	r.Description = strings.TrimSpace(r.Description)
+	if r.Description == "" {
+		return fmt.Errorf("description is required")
+	}
+	if len([]rune(r.Description)) > MaxDescriptionLength {
+		return fmt.Errorf("description must be at most %d characters", MaxDescriptionLength)
+	}
+
+	r.Contact = strings.TrimSpace(r.Contact)
+	if len([]rune(r.Contact)) > MaxContactLength {
+		return fmt.Errorf("contact must be at most %d characters", MaxContactLength)
+	}
+
+	r.StopID = strings.TrimSpace(r.StopID)
+	r.RouteID = strings.TrimSpace(r.RouteID)
+	r.TripID = strings.TrimSpace(r.TripID)
+
+	if (r.Lat == nil) != (r.Lon == nil) {
+		return fmt.Errorf("lat and lon must be given together")
+	}
+	hasLocation := r.Lat != nil
+	if hasLocation {
+		if *r.Lat < -90 || *r.Lat > 90 {
+			return fmt.Errorf("lat must be between -90 and 90")
+		}
+		if *r.Lon < -180 || *r.Lon > 180 {
+			return fmt.Errorf("lon must be between -180 and 180")
+		}
+	}
+
+	switch r.Kind {
+	case models.FeedbackWrongStopLocation:
+		if r.StopID == "" || !hasLocation {
+			return fmt.Errorf("wrong_stop_location requires stop_id and the correct lat/lon")
+		}
+	case models.FeedbackMissingStop:
+		if !hasLocation {
+			return fmt.Errorf("missing_stop requires the stop's lat/lon")
+		}
+	case models.FeedbackIncorrectTime:
+		if r.StopID == "" && r.RouteID == "" && r.TripID == "" {
+			return fmt.Errorf("incorrect_time requires a stop_id, route_id or trip_id")
+		}
+	}
+
+	r.Status = models.FeedbackNew
+	return nil
+}
+
+// Create stores a normalized report and fills its geo context: the distance
+// from the reported location to the named stop and the nearest known stop
+func Create(ctx context.Context, db *pgxpool.Pool, r *models.FeedbackReport) error {
+	if err := checkReferences(ctx, db, r); err != nil {
+		return err
+	}
+
+	var nearestStopID *string
+	var status string
+	err := db.QueryRow(ctx, `
+		WITH point AS (
+			SELECT CASE WHEN $6::float8 IS NULL THEN NULL
+				ELSE ST_SetSRID(ST_MakePoint($7::float8, $6::float8), 4326)::geography END AS geom
+		)
+		INSERT INTO data_feedback (kind, description, stop_id, route_id, trip_id, lat, lon, geom,
+			stop_distance_meters, nearest_stop_id, nearest_stop_distance_meters, contact, partner_id)
+		SELECT $1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6, $7, p.geom,
+			(SELECT ROUND(ST_Distance(s.geom, p.geom))::int FROM stop s WHERE s.id = NULLIF($3, '')),
+			n.id, n.distance, NULLIF($8, ''), NULLIF($9, '')::uuid
+		FROM point p
+		LEFT JOIN LATERAL (
+			SELECT s.id, ROUND(ST_Distance(s.geom, p.geom))::int AS distance
+			FROM stop s
+			WHERE p.geom IS NOT NULL
+			ORDER BY s.geom <-> p.geom
+			LIMIT 1
+		) n ON true
+		RETURNING id, status, stop_distance_meters, nearest_stop_id, nearest_stop_distance_meters,
+			created_at, updated_at
+	`, r.Kind, r.Description, r.StopID, r.RouteID, r.TripID, r.Lat, r.Lon, r.Contact, r.PartnerID,
+	).Scan(&r.ID, &status, &r.StopDistanceM, &nearestStopID, &r.NearestStopDistanceM,
+		&r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert feedback: %w", err)
+	}
+	r.Status = models.FeedbackStatus(status)
+	if nearestStopID != nil {
+		r.NearestStopID = *nearestStopID
+	}
+
+	return nil
+}
+
+// checkReferences rejects reports naming stops, routes or trips we do not know
+// missing_line and missing_stop reports are about data we lack, so their
+// route and stop IDs are free text from the reporter
+func checkReferences(ctx context.Context, db *pgxpool.Pool, r *models.FeedbackReport) error {
+	type reference struct {
+		kind, id string
+		exists   func(context.Context, repository.Querier, string) (bool, error)
+	}
+	var refs []reference
+	if r.StopID != "" && r.Kind != models.FeedbackMissingStop {
+		refs = append(refs, reference{"stop", r.StopID, repository.StopExists})
+	}
+	if r.RouteID != "" && r.Kind != models.FeedbackMissingLine {
+		refs = append(refs, reference{"route", r.RouteID, repository.RouteExists})
+	}
+	if r.TripID != "" {
+		refs = append(refs, reference{"trip", r.TripID, repository.TripExists})
+	}
+
+	for _, ref := range refs {
+		exists, err := ref.exists(ctx, db, ref.id)
+		if err != nil {
+			return fmt.Errorf("failed to check %s: %w", ref.kind, err)
+		}
+		if !exists {
+			return fmt.Errorf("%w: %s %q", ErrUnknownReference, ref.kind, ref.id)
+		}
+	}
+	return nil
+}
+
+// List returns reports matching the filter, newest first, and the total
+// number of matches ignoring Limit and Offset
+func List(ctx context.Context, db *pgxpool.Pool, f Filter) ([]models.FeedbackReport, int, error) {
+	limit := f.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+
+	rows, err := db.Query(ctx, selectReports+`
+		WHERE ($1 = '' OR status = $1)
+		  AND ($2 = '' OR kind = $2)
+		  AND ($3 = '' OR stop_id = $3 OR nearest_stop_id = $3)
+		  AND ($4 = '' OR route_id = $4)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $5 OFFSET $6
+	`, string(f.Status), string(f.Kind), f.StopID, f.RouteID, limit, f.Offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query feedback: %w", err)
+	}
+	defer rows.Close()
+
+	reports := []models.FeedbackReport{}
+	total := 0
+	for rows.Next() {
+		r, err := scanReport(rows, &total)
+		if err != nil {
+			return nil, 0, err
+		}
+		reports = append(reports, *r)
+	}
+
+	return reports, total, rows.Err()
+}
+
+// Get returns a single report
+func Get(ctx context.Context, db *pgxpool.Pool, id int64) (*models.FeedbackReport, error) {
+	var total int
+	r, err := scanReport(db.QueryRow(ctx, selectReports+` WHERE id = $1`, id), &total)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return r, err
+}
+
+// Triage sets a report's status and, when note is not nil, its triage note
+func Triage(ctx context.Context, db *pgxpool.Pool, id int64, status models.FeedbackStatus, note *string) (*models.FeedbackReport, error) {
+	if !Statuses[status] {
+		return nil, fmt.Errorf("invalid status %q (use new, triaged, resolved or rejected)", status)
+	}
+
+	tag, err := db.Exec(ctx, `
+		UPDATE data_feedback
+		SET status = $2, triage_note = CASE WHEN $3::boolean THEN NULLIF($4, '') ELSE triage_note END
+		WHERE id = $1
+	`, id, status, note != nil, deref(note))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update feedback: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrNotFound
+	}
+
+	return Get(ctx, db, id)
+}
+
+const selectReports = `
+	SELECT id, kind, description, COALESCE(stop_id, ''), COALESCE(route_id, ''), COALESCE(trip_id, ''),
+		lat, lon, stop_distance_meters, COALESCE(nearest_stop_id, ''), nearest_stop_distance_meters,
+		COALESCE(contact, ''), COALESCE(partner_id::text, ''), status, COALESCE(triage_note, ''),
+		created_at, updated_at, COUNT(*) OVER ()
+	FROM data_feedback`
+
+func scanReport(row pgx.Row, total *int) (*models.FeedbackReport, error) {
+	var r models.FeedbackReport
+	var kind, status string
+	if err := row.Scan(&r.ID, &kind, &r.Description, &r.StopID, &r.RouteID, &r.TripID,
+		&r.Lat, &r.Lon, &r.StopDistanceM, &r.NearestStopID, &r.NearestStopDistanceM,
+		&r.Contact, &r.PartnerID, &status, &r.TriageNote,
+		&r.CreatedAt, &r.UpdatedAt, total); err != nil {
+		return nil, err
+	}
+	r.Kind = models.FeedbackKind(kind)
+	r.Status = models.FeedbackStatus(status)
+	return &r, nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return strings.TrimSpace(*s)
+}
@@ -0,0 +1,45 @@
+package feedback
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	lat, lon := 14.6928, -17.4467
+
+	t.Run("Accepts a wrong stop location", func(t *testing.T) {
+		r := &models.FeedbackReport{
+			Kind:        " Wrong_Stop_Location ",
+			Description: "  L'arrêt est de l'autre côté du rond-point  ",
+			StopID:      "DDD_123",
+			Lat:         &lat,
+			Lon:         &lon,
+		}
+		assert.NoError(t, Normalize(r))
+		assert.Equal(t, models.FeedbackWrongStopLocation, r.Kind)
+		assert.Equal(t, "L'arrêt est de l'autre côté du rond-point", r.Description)
+		assert.Equal(t, models.FeedbackNew, r.Status)
+	})
+
+	t.Run("Requires the context of each kind", func(t *testing.T) {
+		assert.Error(t, Normalize(&models.FeedbackReport{Kind: "wrong_stop_location", Description: "x", StopID: "S1"}))
+		assert.Error(t, Normalize(&models.FeedbackReport{Kind: "missing_stop", Description: "x"}))
+		assert.Error(t, Normalize(&models.FeedbackReport{Kind: "incorrect_time", Description: "x"}))
+		assert.NoError(t, Normalize(&models.FeedbackReport{Kind: "incorrect_time", Description: "x", TripID: "T1"}))
+		assert.NoError(t, Normalize(&models.FeedbackReport{Kind: "missing_line", Description: "Ligne 54 absente"}))
+	})
+
+	t.Run("Rejects invalid input", func(t *testing.T) {
+		assert.Error(t, Normalize(&models.FeedbackReport{Kind: "spam", Description: "x"}))
+		assert.Error(t, Normalize(&models.FeedbackReport{Kind: "other", Description: "   "}))
+		assert.Error(t, Normalize(&models.FeedbackReport{Kind: "other", Description: strings.Repeat("é", MaxDescriptionLength+1)}))
+		assert.Error(t, Normalize(&models.FeedbackReport{Kind: "other", Description: "x", Lat: &lat}))
+
+		bad := 120.0
+		assert.Error(t, Normalize(&models.FeedbackReport{Kind: "other", Description: "x", Lat: &bad, Lon: &lon}))
+	})
+}
@@ -0,0 +1,184 @@
+// Package geocode turns place names such as landmarks and neighborhoods into
+// coordinates, behind an interface so the provider (Nominatim, Pelias, or
+// PassBi's own stop names) can be swapped by configuration
+package geocode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/logging"
+)
+
+var logger = logging.For("geocode")
+
+// ErrNotFound is returned when no place matches a query
+var ErrNotFound = errors.New("place not found")
+
+// Place is a geocoded location
+type Place struct {
+	Name   string  `json:"name"`
+	Lat    float64 `json:"lat"`
+	Lon    float64 `json:"lon"`
+	Source string  `json:"source"`
+}
+
+// Geocoder resolves a free-text place name to its best match
+type Geocoder interface {
+	Search(ctx context.Context, query string) (*Place, error)
+}
+
+// Reverser describes a coordinate with a human-readable label, such as the
+// landmark or neighborhood it lies in
+type Reverser interface {
+	Reverse(ctx context.Context, lat, lon float64) (*Place, error)
+}
+
+// Config holds geocoder provider configuration
+type Config struct {
+	Provider  string // nominatim, pelias, or empty to disable
+	URL       string
+	APIKey    string
+	UserAgent string
+	Country   string // ISO 3166-1 alpha-2 code results are restricted to
+	Timeout   time.Duration
+}
+
+// LoadConfigFromEnv loads geocoder configuration from environment variables
+func LoadConfigFromEnv() *Config {
+	timeout, err := time.ParseDuration(getEnv("GEOCODER_TIMEOUT", "3s"))
+	if err != nil {
+		timeout = 3 * time.Second
+	}
+
+	return &Config{
+		Provider:  strings.ToLower(getEnv("GEOCODER_PROVIDER", "")),
+		URL:       getEnv("GEOCODER_URL", ""),
+		APIKey:    getEnv("GEOCODER_API_KEY", ""),
+		UserAgent: getEnv("GEOCODER_USER_AGENT", "PassBi/2.0 (+https://passbi.com)"),
+		Country:   strings.ToLower(getEnv("GEOCODER_COUNTRY", "sn")),
+		Timeout:   timeout,
+	}
+}
+
+// New creates the geocoder of the configured provider
+func New(cfg *Config) (Geocoder, error) {
+	switch cfg.Provider {
+	case "nominatim":
+		return NewNominatim(cfg), nil
+	case "pelias":
+		if cfg.URL == "" {
+			return nil, errors.New("GEOCODER_URL is required for pelias")
+		}
+		return NewPelias(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown geocoder provider %q", cfg.Provider)
+	}
+}
+
+var (
+	geocoder     Geocoder
+	geocoderOnce sync.Once
+)
+
+// Get returns the configured external geocoder, or nil when
+// GEOCODER_PROVIDER is unset or invalid
+func Get() Geocoder {
+	geocoderOnce.Do(func() {
+		cfg := LoadConfigFromEnv()
+		if cfg.Provider == "" {
+			return
+		}
+		g, err := New(cfg)
+		if err != nil {
+			logger.Error("Geocoder disabled", "error", err)
+			return
+		}
+		geocoder = g
+		logger.Info("Geocoding enabled", "provider", cfg.Provider)
+	})
+	return geocoder
+}
+
+// Chain tries each geocoder in order and returns the first match
+// Nil entries are skipped, so optional providers can be listed unconditionally
+type Chain []Geocoder
+
+// Search implements Geocoder
+// A provider failing does not stop the chain; its error is only returned when
+// no later provider finds the place either
+func (ch Chain) Search(ctx context.Context, query string) (*Place, error) {
+	var firstErr error
+	for _, g := range ch {
+		if g == nil {
+			continue
+		}
+		place, err := g.Search(ctx, query)
+		if err == nil {
+			return place, nil
+		}
+		if !errors.Is(err, ErrNotFound) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return nil, ErrNotFound
+}
+
+// Reverse implements Reverser with the members that support it
+func (ch Chain) Reverse(ctx context.Context, lat, lon float64) (*Place, error) {
+	var firstErr error
+	for _, g := range ch {
+		r, ok := g.(Reverser)
+		if !ok {
+			continue
+		}
+		place, err := r.Reverse(ctx, lat, lon)
+		if err == nil {
+			return place, nil
+		}
+		if !errors.Is(err, ErrNotFound) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return nil, ErrNotFound
+}
+
+// label joins the distinct non-empty parts of a place description
+func label(parts ...string) string {
+	var kept []string
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		dup := false
+		for _, k := range kept {
+			if strings.EqualFold(k, p) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, ", ")
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,119 @@
+package geocode
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNominatimSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/search", r.URL.Path)
+		assert.Equal(t, "Sandaga", r.URL.Query().Get("q"))
+		assert.Equal(t, "sn", r.URL.Query().Get("countrycodes"))
+		assert.Equal(t, "PassBi-test", r.Header.Get("User-Agent"))
+		w.Write([]byte(`[{"name":"Marché Sandaga","display_name":"Marché Sandaga, Dakar","lat":"14.6704","lon":"-17.4383"}]`))
+	}))
+	defer srv.Close()
+
+	n := NewNominatim(&Config{URL: srv.URL, UserAgent: "PassBi-test", Country: "sn", Timeout: time.Second})
+	place, err := n.Search(context.Background(), "Sandaga")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &Place{Name: "Marché Sandaga", Lat: 14.6704, Lon: -17.4383, Source: "nominatim"}, place)
+}
+
+func TestPeliasSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/search", r.URL.Path)
+		assert.Equal(t, "SN", r.URL.Query().Get("boundary.country"))
+		if r.URL.Query().Get("text") == "nowhere" {
+			w.Write([]byte(`{"features":[]}`))
+			return
+		}
+		w.Write([]byte(`{"features":[{"geometry":{"coordinates":[-17.4383,14.6704]},"properties":{"label":"Sandaga, Dakar"}}]}`))
+	}))
+	defer srv.Close()
+
+	p := NewPelias(&Config{URL: srv.URL, Country: "sn", Timeout: time.Second})
+	place, err := p.Search(context.Background(), "Sandaga")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &Place{Name: "Sandaga, Dakar", Lat: 14.6704, Lon: -17.4383, Source: "pelias"}, place)
+
+	_, err = p.Search(context.Background(), "nowhere")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+type fakeGeocoder struct {
+	place *Place
+	err   error
+}
+
+func (f fakeGeocoder) Search(ctx context.Context, query string) (*Place, error) {
+	return f.place, f.err
+}
+
+func TestChain(t *testing.T) {
+	found := &Place{Name: "Petersen", Source: "stops"}
+	down := errors.New("provider down")
+
+	place, err := Chain{nil, fakeGeocoder{err: ErrNotFound}, fakeGeocoder{place: found}}.Search(context.Background(), "x")
+	assert.NoError(t, err)
+	assert.Equal(t, found, place)
+
+	// A failing provider does not hide a later match
+	place, err = Chain{fakeGeocoder{err: down}, fakeGeocoder{place: found}}.Search(context.Background(), "x")
+	assert.NoError(t, err)
+	assert.Equal(t, found, place)
+
+	_, err = Chain{fakeGeocoder{err: down}, fakeGeocoder{err: ErrNotFound}}.Search(context.Background(), "x")
+	assert.Equal(t, down, err)
+
+	_, err = Chain{nil}.Search(context.Background(), "x")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestNominatimReverse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/reverse", r.URL.Path)
+		assert.Equal(t, "14.670400", r.URL.Query().Get("lat"))
+		w.Write([]byte(`{"name":"Marché Sandaga","address":{"road":"Avenue Lamine Guèye","suburb":"Plateau","city":"Dakar"}}`))
+	}))
+	defer srv.Close()
+
+	n := NewNominatim(&Config{URL: srv.URL, Timeout: time.Second})
+	place, err := n.Reverse(context.Background(), 14.6704, -17.4383)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &Place{Name: "Marché Sandaga, Plateau", Lat: 14.6704, Lon: -17.4383, Source: "nominatim"}, place)
+}
+
+func TestPeliasReverse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/reverse", r.URL.Path)
+		w.Write([]byte(`{"features":[{"properties":{"name":"Rond-point Liberté 6","neighbourhood":"Liberté 6"}}]}`))
+	}))
+	defer srv.Close()
+
+	p := NewPelias(&Config{URL: srv.URL, Timeout: time.Second})
+	place, err := p.Reverse(context.Background(), 14.7253, -17.4637)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Rond-point Liberté 6, Liberté 6", place.Name)
+}
+
+func TestLabel(t *testing.T) {
+	assert.Equal(t, "Colobane", label("Colobane", "colobane"))
+	assert.Equal(t, "Route de Ouakam, Mermoz", label("", "Route de Ouakam", " ", "Mermoz"))
+	assert.Equal(t, "", label("", ""))
+}
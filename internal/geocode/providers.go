@@ -0,0 +1,257 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// maxResponseSize bounds geocoder responses; one result is a few KB
+const maxResponseSize = 1 << 20
+
+// Nominatim queries an OpenStreetMap Nominatim server
+// The public server requires a descriptive User-Agent and at most one request
+// per second, which the API's result cache keeps us well under
+type Nominatim struct {
+	baseURL   string
+	userAgent string
+	country   string
+	client    *http.Client
+}
+
+// NewNominatim creates a Nominatim geocoder; URL defaults to the public server
+func NewNominatim(cfg *Config) *Nominatim {
+	baseURL := cfg.URL
+	if baseURL == "" {
+		baseURL = "https://nominatim.openstreetmap.org"
+	}
+	return &Nominatim{
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		userAgent: cfg.UserAgent,
+		country:   cfg.Country,
+		client:    &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// Search implements Geocoder
+func (n *Nominatim) Search(ctx context.Context, query string) (*Place, error) {
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("format", "jsonv2")
+	params.Set("limit", "1")
+	if n.country != "" {
+		params.Set("countrycodes", n.country)
+	}
+
+	var results []struct {
+		Name        string `json:"name"`
+		DisplayName string `json:"display_name"`
+		Lat         string `json:"lat"`
+		Lon         string `json:"lon"`
+	}
+	if err := getJSON(ctx, n.client, n.baseURL+"/search?"+params.Encode(), n.userAgent, &results); err != nil {
+		return nil, fmt.Errorf("nominatim: %w", err)
+	}
+	if len(results) == 0 {
+		return nil, ErrNotFound
+	}
+
+	r := results[0]
+	lat, err := strconv.ParseFloat(r.Lat, 64)
+	if err != nil {
+		return nil, fmt.Errorf("nominatim: invalid latitude %q", r.Lat)
+	}
+	lon, err := strconv.ParseFloat(r.Lon, 64)
+	if err != nil {
+		return nil, fmt.Errorf("nominatim: invalid longitude %q", r.Lon)
+	}
+
+	name := r.Name
+	if name == "" {
+		name = r.DisplayName
+	}
+	return &Place{Name: name, Lat: lat, Lon: lon, Source: "nominatim"}, nil
+}
+
+// Reverse implements Reverser
+// The label is the nearest named feature (or road) and its neighborhood
+func (n *Nominatim) Reverse(ctx context.Context, lat, lon float64) (*Place, error) {
+	params := url.Values{}
+	params.Set("lat", strconv.FormatFloat(lat, 'f', 6, 64))
+	params.Set("lon", strconv.FormatFloat(lon, 'f', 6, 64))
+	params.Set("format", "jsonv2")
+	params.Set("zoom", "17")
+	params.Set("addressdetails", "1")
+
+	var result struct {
+		Error   string `json:"error"`
+		Name    string `json:"name"`
+		Address struct {
+			Road          string `json:"road"`
+			Neighbourhood string `json:"neighbourhood"`
+			Quarter       string `json:"quarter"`
+			Suburb        string `json:"suburb"`
+			CityDistrict  string `json:"city_district"`
+			City          string `json:"city"`
+		} `json:"address"`
+	}
+	if err := getJSON(ctx, n.client, n.baseURL+"/reverse?"+params.Encode(), n.userAgent, &result); err != nil {
+		return nil, fmt.Errorf("nominatim: %w", err)
+	}
+	if result.Error != "" {
+		return nil, ErrNotFound
+	}
+
+	a := result.Address
+	name := label(firstNonEmpty(result.Name, a.Road),
+		firstNonEmpty(a.Neighbourhood, a.Quarter, a.Suburb, a.CityDistrict, a.City))
+	if name == "" {
+		return nil, ErrNotFound
+	}
+	return &Place{Name: name, Lat: lat, Lon: lon, Source: "nominatim"}, nil
+}
+
+// Pelias queries a Pelias server (self-hosted or geocode.earth)
+type Pelias struct {
+	baseURL   string
+	apiKey    string
+	userAgent string
+	country   string
+	client    *http.Client
+}
+
+// NewPelias creates a Pelias geocoder
+func NewPelias(cfg *Config) *Pelias {
+	return &Pelias{
+		baseURL:   strings.TrimSuffix(cfg.URL, "/"),
+		apiKey:    cfg.APIKey,
+		userAgent: cfg.UserAgent,
+		country:   cfg.Country,
+		client:    &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// Search implements Geocoder
+func (p *Pelias) Search(ctx context.Context, query string) (*Place, error) {
+	params := url.Values{}
+	params.Set("text", query)
+	params.Set("size", "1")
+	if p.country != "" {
+		params.Set("boundary.country", strings.ToUpper(p.country))
+	}
+	if p.apiKey != "" {
+		params.Set("api_key", p.apiKey)
+	}
+
+	var collection struct {
+		Features []struct {
+			Geometry struct {
+				Coordinates []float64 `json:"coordinates"` // lon, lat
+			} `json:"geometry"`
+			Properties struct {
+				Name  string `json:"name"`
+				Label string `json:"label"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := getJSON(ctx, p.client, p.baseURL+"/v1/search?"+params.Encode(), p.userAgent, &collection); err != nil {
+		return nil, fmt.Errorf("pelias: %w", err)
+	}
+	if len(collection.Features) == 0 {
+		return nil, ErrNotFound
+	}
+
+	f := collection.Features[0]
+	if len(f.Geometry.Coordinates) < 2 {
+		return nil, fmt.Errorf("pelias: feature without coordinates")
+	}
+
+	name := f.Properties.Name
+	if name == "" {
+		name = f.Properties.Label
+	}
+	return &Place{
+		Name:   name,
+		Lat:    f.Geometry.Coordinates[1],
+		Lon:    f.Geometry.Coordinates[0],
+		Source: "pelias",
+	}, nil
+}
+
+// Reverse implements Reverser
+func (p *Pelias) Reverse(ctx context.Context, lat, lon float64) (*Place, error) {
+	params := url.Values{}
+	params.Set("point.lat", strconv.FormatFloat(lat, 'f', 6, 64))
+	params.Set("point.lon", strconv.FormatFloat(lon, 'f', 6, 64))
+	params.Set("size", "1")
+	if p.apiKey != "" {
+		params.Set("api_key", p.apiKey)
+	}
+
+	var collection struct {
+		Features []struct {
+			Properties struct {
+				Name          string `json:"name"`
+				Neighbourhood string `json:"neighbourhood"`
+				Borough       string `json:"borough"`
+				Locality      string `json:"locality"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := getJSON(ctx, p.client, p.baseURL+"/v1/reverse?"+params.Encode(), p.userAgent, &collection); err != nil {
+		return nil, fmt.Errorf("pelias: %w", err)
+	}
+	if len(collection.Features) == 0 {
+		return nil, ErrNotFound
+	}
+
+	props := collection.Features[0].Properties
+	name := label(props.Name, firstNonEmpty(props.Neighbourhood, props.Borough, props.Locality))
+	if name == "" {
+		return nil, ErrNotFound
+	}
+	return &Place{Name: name, Lat: lat, Lon: lon, Source: "pelias"}, nil
+}
+
+// firstNonEmpty returns the first non-empty string
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// getJSON fetches url and decodes its JSON body into dest
+func getJSON(ctx context.Context, client *http.Client, rawURL, userAgent string, dest interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dest)
+}
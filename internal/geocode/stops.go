@@ -0,0 +1,91 @@
+package geocode
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// stopLabelRadius is how far a stop may be to name a location (meters)
+const stopLabelRadius = 300
+
+// Stops resolves place names against PassBi's own stop names
+// Many landmarks (Sandaga, Petersen, Colobane) are also stop names, so this
+// works without any external provider and is the fallback when one is set;
+// likewise a coordinate is labeled with the closest stop within stopLabelRadius
+type Stops struct {
+	pool *pgxpool.Pool
+}
+
+// NewStops creates a stop-name geocoder
+func NewStops(pool *pgxpool.Pool) *Stops {
+	return &Stops{pool: pool}
+}
+
+// Search implements Geocoder
+// Exact names win over prefixes, prefixes over substrings, then shorter names
+func (s *Stops) Search(ctx context.Context, query string) (*Place, error) {
+	query = strings.TrimSpace(query)
+	if len(query) < 2 {
+		return nil, ErrNotFound
+	}
+
+	sanitized := strings.ReplaceAll(query, "%", "\\%")
+	sanitized = strings.ReplaceAll(sanitized, "_", "\\_")
+
+	var place Place
+	err := s.pool.QueryRow(ctx, `
+		SELECT name, lat, lon
+		FROM stop
+		WHERE name ILIKE $1
+		ORDER BY
+			CASE WHEN lower(name) = lower($2) THEN 0
+				 WHEN lower(name) LIKE lower($2) || '%' THEN 1
+				 ELSE 2
+			END,
+			length(name),
+			name
+		LIMIT 1
+	`, "%"+sanitized+"%", query).Scan(&place.Name, &place.Lat, &place.Lon)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	place.Source = "stops"
+	return &place, nil
+}
+
+// Reverse implements Reverser
+func (s *Stops) Reverse(ctx context.Context, lat, lon float64) (*Place, error) {
+	var name string
+	err := s.pool.QueryRow(ctx, `
+		SELECT name
+		FROM (
+			SELECT name,
+				6371000 * acos(LEAST(1.0, GREATEST(-1.0,
+					cos(radians($1)) * cos(radians(lat)) * cos(radians(lon) - radians($2)) +
+					sin(radians($1)) * sin(radians(lat))
+				))) AS distance
+			FROM stop
+			WHERE lat BETWEEN $1 - 0.01 AND $1 + 0.01
+				AND lon BETWEEN $2 - 0.01 AND $2 + 0.01
+		) nearby
+		WHERE distance <= $3
+		ORDER BY distance
+		LIMIT 1
+	`, lat, lon, stopLabelRadius).Scan(&name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Place{Name: name, Lat: lat, Lon: lon, Source: "stops"}, nil
+}
@@ -3,7 +3,7 @@ package graph
 import (
 	"context"
 	"fmt"
-	"log"
+	"math"
 	"sort"
 
 	"github.com/jackc/pgx/v5"
@@ -13,15 +13,22 @@ import (
 )
 
 const (
-	maxWalkDistance  = 500  // meters
-	walkingSpeed     = 1.4  // meters per second
-	transferTime     = 180  // seconds (3 minutes)
 	batchSize        = 1000 // batch insert size
 )
 
+// WalkSeconds estimates the time to walk a straight-line distance, using the
+// same walking speed as WALK edges so estimates match itineraries
+func WalkSeconds(distanceM float64) int {
+	return int(math.Ceil(distanceM / walkingSpeed()))
+}
+
 // Builder constructs the routing graph from GTFS data
 type Builder struct {
 	db *pgxpool.Pool
+
+	// Progress, when set, is called as each stage of BuildGraphFromDB starts
+	// with a description and an estimated completion percentage
+	Progress func(step string, percent int)
 }
 
 // NewBuilder creates a new graph builder
@@ -32,28 +39,28 @@ func NewBuilder(db *pgxpool.Pool) *Builder {
 // BuildGraph constructs the complete routing graph
 // This includes nodes (stop × route) and edges (RIDE, WALK, TRANSFER)
 func (b *Builder) BuildGraph(ctx context.Context, feed *gtfs.GTFSFeed) error {
-	log.Println("Starting graph construction...")
+	logger.Info("Starting graph construction")
 
 	// Build nodes first
 	nodeCount, err := b.BuildNodes(ctx, feed)
 	if err != nil {
 		return fmt.Errorf("failed to build nodes: %w", err)
 	}
-	log.Printf("Created %d nodes", nodeCount)
+	logger.Info("Created nodes", "nodes", nodeCount)
 
 	// Build edges
 	edgeCount, err := b.BuildEdges(ctx, feed)
 	if err != nil {
 		return fmt.Errorf("failed to build edges: %w", err)
 	}
-	log.Printf("Created %d edges", edgeCount)
+	logger.Info("Created edges", "edges", edgeCount)
 
 	// Analyze tables for query optimization
 	if err := b.analyzeGraph(ctx); err != nil {
-		log.Printf("Warning: failed to analyze tables: %v", err)
+		logger.WarnContext(ctx, "Failed to analyze tables", "error", err)
 	}
 
-	log.Println("Graph construction completed successfully")
+	logger.Info("Graph construction completed")
 	return nil
 }
 
@@ -93,7 +100,7 @@ func (b *Builder) BuildNodes(ctx context.Context, feed *gtfs.GTFSFeed) (int, err
 		nodeSet[key] = true
 	}
 
-	log.Printf("Found %d unique (stop, route) pairs", len(nodeSet))
+	logger.Debug("Found unique (stop, route) pairs", "pairs", len(nodeSet))
 
 	// Batch insert nodes
 	batch := &pgx.Batch{}
@@ -107,7 +114,7 @@ func (b *Builder) BuildNodes(ctx context.Context, feed *gtfs.GTFSFeed) (int, err
 
 		coords, ok := stopCoords[key.stopID]
 		if !ok {
-			log.Printf("Warning: stop %s not found in stops, skipping node", key.stopID)
+			logger.Warn("Stop not found in stops, skipping node", "stop_id", key.stopID)
 			continue
 		}
 
@@ -147,7 +154,7 @@ func (b *Builder) BuildEdges(ctx context.Context, feed *gtfs.GTFSFeed) (int, err
 		return 0, fmt.Errorf("failed to build ride edges: %w", err)
 	}
 	totalEdges += rideEdges
-	log.Printf("Created %d RIDE edges", rideEdges)
+	logger.Info("Created RIDE edges", "edges", rideEdges)
 
 	// 2. Build WALK edges (nearby stops)
 	walkEdges, err := b.buildWalkEdges(ctx)
@@ -155,7 +162,7 @@ func (b *Builder) BuildEdges(ctx context.Context, feed *gtfs.GTFSFeed) (int, err
 		return 0, fmt.Errorf("failed to build walk edges: %w", err)
 	}
 	totalEdges += walkEdges
-	log.Printf("Created %d WALK edges", walkEdges)
+	logger.Info("Created WALK edges", "edges", walkEdges)
 
 	// 3. Build TRANSFER edges (same stop, different routes)
 	transferEdges, err := b.buildTransferEdges(ctx)
@@ -163,7 +170,7 @@ func (b *Builder) BuildEdges(ctx context.Context, feed *gtfs.GTFSFeed) (int, err
 		return 0, fmt.Errorf("failed to build transfer edges: %w", err)
 	}
 	totalEdges += transferEdges
-	log.Printf("Created %d TRANSFER edges", transferEdges)
+	logger.Info("Created TRANSFER edges", "edges", transferEdges)
 
 	return totalEdges, nil
 }
@@ -171,52 +178,71 @@ func (b *Builder) BuildEdges(ctx context.Context, feed *gtfs.GTFSFeed) (int, err
 // BuildGraphFromDB builds the complete routing graph from PostgreSQL database
 // This reads ALL agencies' data and reconstructs the entire graph
 func (b *Builder) BuildGraphFromDB(ctx context.Context) error {
-	log.Println("🔄 Building complete routing graph from database...")
+	logger.Info("Building complete routing graph from database")
+
+	// Refuse to wipe a working graph when there is nothing to rebuild it from
+	var hasSchedules bool
+	if err := b.db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM stop_time)").Scan(&hasSchedules); err != nil {
+		return fmt.Errorf("failed to check schedule data: %w", err)
+	}
+	if !hasSchedules {
+		return fmt.Errorf("no schedule data in database, import GTFS data first")
+	}
 
 	// 1. Clear existing graph
+	b.report("Clearing existing graph", 0)
 	if err := b.clearGraph(ctx); err != nil {
 		return fmt.Errorf("failed to clear graph: %w", err)
 	}
 
 	// 2. Build nodes from database
+	b.report("Building nodes", 5)
 	nodeCount, err := b.buildNodesFromDB(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to build nodes: %w", err)
 	}
-	log.Printf("✅ Created %d nodes", nodeCount)
+	logger.Info("Created nodes", "nodes", nodeCount)
 
 	// 3. Build edges from database
 	edgeCount, err := b.buildEdgesFromDB(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to build edges: %w", err)
 	}
-	log.Printf("✅ Created %d edges", edgeCount)
+	logger.Info("Created edges", "edges", edgeCount)
 
 	// 4. Analyze tables for query optimization
+	b.report("Analyzing tables", 90)
 	if err := b.analyzeGraph(ctx); err != nil {
 		return fmt.Errorf("failed to analyze graph: %w", err)
 	}
 
-	log.Println("✅ Graph rebuild complete!")
+	logger.Info("Graph rebuild complete")
 	return nil
 }
 
+// report forwards a stage to the Progress callback, if any
+func (b *Builder) report(step string, percent int) {
+	if b.Progress != nil {
+		b.Progress(step, percent)
+	}
+}
+
 // clearGraph removes all nodes and edges
 func (b *Builder) clearGraph(ctx context.Context) error {
-	log.Println("Clearing existing graph...")
+	logger.Info("Clearing existing graph")
 
 	_, err := b.db.Exec(ctx, "TRUNCATE TABLE edge, node CASCADE")
 	if err != nil {
 		return err
 	}
 
-	log.Println("Graph cleared")
+	logger.Info("Graph cleared")
 	return nil
 }
 
 // buildNodesFromDB creates nodes from all routes and stops in the database
 func (b *Builder) buildNodesFromDB(ctx context.Context) (int, error) {
-	log.Println("Building nodes from database...")
+	logger.Info("Building nodes from database")
 
 	// Get all unique (stop_id, route_id, lat, lon) combinations
 	// This ensures we have nodes for all stop × route pairs
@@ -228,7 +254,7 @@ func (b *Builder) buildNodesFromDB(ctx context.Context) (int, error) {
 			s.lat,
 			s.lon
 		FROM stop_time st
-		JOIN trip t ON st.trip_id = t.trip_id
+		JOIN trip t ON st.trip_id = t.trip_id AND st.agency_id = t.agency_id
 		JOIN stop s ON st.stop_id = s.stop_id
 		WHERE s.lat IS NOT NULL AND s.lon IS NOT NULL
 		ON CONFLICT (stop_id, route_id) DO NOTHING
@@ -247,35 +273,38 @@ func (b *Builder) buildEdgesFromDB(ctx context.Context) (int, error) {
 	totalEdges := 0
 
 	// 1. Build RIDE edges
+	b.report("Building RIDE edges", 20)
 	rideEdges, err := b.buildRideEdgesFromDB(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("failed to build ride edges: %w", err)
 	}
 	totalEdges += rideEdges
-	log.Printf("Created %d RIDE edges", rideEdges)
+	logger.Info("Created RIDE edges", "edges", rideEdges)
 
 	// 2. Build WALK edges
+	b.report("Building WALK edges", 50)
 	walkEdges, err := b.buildWalkEdges(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("failed to build walk edges: %w", err)
 	}
 	totalEdges += walkEdges
-	log.Printf("Created %d WALK edges", walkEdges)
+	logger.Info("Created WALK edges", "edges", walkEdges)
 
 	// 3. Build TRANSFER edges
+	b.report("Building TRANSFER edges", 80)
 	transferEdges, err := b.buildTransferEdges(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("failed to build transfer edges: %w", err)
 	}
 	totalEdges += transferEdges
-	log.Printf("Created %d TRANSFER edges", transferEdges)
+	logger.Info("Created TRANSFER edges", "edges", transferEdges)
 
 	return totalEdges, nil
 }
 
 // buildRideEdgesFromDB creates RIDE edges from stop_times in database
 func (b *Builder) buildRideEdgesFromDB(ctx context.Context) (int, error) {
-	log.Println("Building RIDE edges from database...")
+	logger.Info("Building RIDE edges from database")
 
 	// Create edges between consecutive stops on each trip
 	query := `
@@ -297,8 +326,9 @@ func (b *Builder) buildRideEdgesFromDB(ctx context.Context) (int, error) {
 			st1.trip_id,
 			st1.stop_sequence as sequence
 		FROM stop_time st1
-		JOIN stop_time st2 ON st1.trip_id = st2.trip_id AND st2.stop_sequence = st1.stop_sequence + 1
-		JOIN trip t ON st1.trip_id = t.trip_id
+		JOIN stop_time st2 ON st2.agency_id = st1.agency_id AND st2.trip_id = st1.trip_id
+			AND st2.stop_sequence = st1.stop_sequence + 1
+		JOIN trip t ON st1.trip_id = t.trip_id AND st1.agency_id = t.agency_id
 		JOIN node n1 ON n1.stop_id = st1.stop_id AND n1.route_id = t.route_id
 		JOIN node n2 ON n2.stop_id = st2.stop_id AND n2.route_id = t.route_id
 		ON CONFLICT DO NOTHING
@@ -398,7 +428,7 @@ func (b *Builder) buildRideEdges(ctx context.Context, feed *gtfs.GTFSFeed) (int,
 
 // buildWalkEdges creates walking edges between nearby stops
 func (b *Builder) buildWalkEdges(ctx context.Context) (int, error) {
-	log.Printf("Building WALK edges for stops within %d meters...", maxWalkDistance)
+	logger.Info("Building WALK edges", "max_walk_distance_m", maxWalkDistance())
 
 	// Simplified version without PostGIS - uses Haversine formula
 	// Note: This is less efficient than PostGIS spatial indexes but works without the extension
@@ -434,7 +464,7 @@ func (b *Builder) buildWalkEdges(ctx context.Context) (int, error) {
 		ON CONFLICT DO NOTHING
 	`
 
-	result, err := b.db.Exec(ctx, query, walkingSpeed, float64(maxWalkDistance))
+	result, err := b.db.Exec(ctx, query, walkingSpeed(), maxWalkDistance())
 	if err != nil {
 		return 0, err
 	}
@@ -444,7 +474,7 @@ func (b *Builder) buildWalkEdges(ctx context.Context) (int, error) {
 
 // buildTransferEdges creates transfer edges between different routes at the same stop
 func (b *Builder) buildTransferEdges(ctx context.Context) (int, error) {
-	log.Println("Building TRANSFER edges for same-stop transfers...")
+	logger.Info("Building TRANSFER edges for same-stop transfers")
 
 	query := `
 		INSERT INTO edge (from_node_id, to_node_id, type, cost_time, cost_walk, cost_transfer)
@@ -460,7 +490,7 @@ func (b *Builder) buildTransferEdges(ctx context.Context) (int, error) {
 		ON CONFLICT DO NOTHING
 	`
 
-	result, err := b.db.Exec(ctx, query, transferTime)
+	result, err := b.db.Exec(ctx, query, transferTime())
 	if err != nil {
 		return 0, err
 	}
@@ -491,7 +521,7 @@ func (b *Builder) analyzeGraph(ctx context.Context) error {
 		if err != nil {
 			return err
 		}
-		log.Printf("Analyzed table: %s", table)
+		logger.Debug("Analyzed table", "table", table)
 	}
 
 	return nil
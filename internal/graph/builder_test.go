@@ -0,0 +1,24 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilderReport(t *testing.T) {
+	b := NewBuilder(nil)
+	assert.NotPanics(t, func() { b.report("Building nodes", 5) }, "no Progress callback")
+
+	var steps []string
+	var percents []int
+	b.Progress = func(step string, percent int) {
+		steps = append(steps, step)
+		percents = append(percents, percent)
+	}
+	b.report("Clearing existing graph", 0)
+	b.report("Building RIDE edges", 20)
+
+	assert.Equal(t, []string{"Clearing existing graph", "Building RIDE edges"}, steps)
+	assert.Equal(t, []int{0, 20}, percents)
+}
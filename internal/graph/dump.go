@@ -0,0 +1,323 @@
+package graph
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DumpFormat is the COPY format of the tables in a graph dump
+// Binary is faster and exact but needs the same column types (and PostGIS
+// version) on restore; CSV restores into any compatible schema
+type DumpFormat string
+
+const (
+	FormatBinary DumpFormat = "binary"
+	FormatCSV    DumpFormat = "csv"
+)
+
+// dumpTables are the tables of a dump, in restore order
+var dumpTables = []string{"node", "edge"}
+
+// manifestName is the first entry of a dump; each table follows as
+// <table>.copy
+const manifestName = "manifest.json"
+
+// ErrSchemaMismatch is returned when a dump was taken at another migration
+// version than the database it is restored into
+var ErrSchemaMismatch = errors.New("dump was taken at another schema version")
+
+// DumpTable describes a table in a dump
+type DumpTable struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Rows    int64    `json:"rows"`
+}
+
+// DumpManifest describes a graph dump
+type DumpManifest struct {
+	Format        DumpFormat  `json:"format"`
+	SchemaVersion int64       `json:"schema_version"`
+	CreatedAt     time.Time   `json:"created_at"`
+	Tables        []DumpTable `json:"tables"`
+}
+
+// RestoreOptions tunes Restore
+type RestoreOptions struct {
+	// IgnoreSchemaVersion restores a dump taken at another migration version,
+	// as long as its columns still exist
+	IgnoreSchemaVersion bool
+}
+
+// Dump writes the node and edge tables to w as a gzipped tar of COPY
+// streams, read from a single snapshot
+func Dump(ctx context.Context, pool *pgxpool.Pool, w io.Writer, format DumpFormat) (*DumpManifest, error) {
+	if format != FormatBinary && format != FormatCSV {
+		return nil, fmt.Errorf("unknown dump format %q (binary or csv)", format)
+	}
+
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	manifest := &DumpManifest{Format: format, CreatedAt: time.Now().UTC()}
+	if manifest.SchemaVersion, err = schemaVersion(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	// COPY streams have no known length until they end, and tar entries need
+	// one up front
+	files := make([]*os.File, 0, len(dumpTables))
+	defer func() {
+		for _, f := range files {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	for _, table := range dumpTables {
+		columns, err := tableColumns(ctx, tx, table)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.CreateTemp("", "passbi-graph-"+table+"-*")
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+
+		tag, err := tx.Conn().PgConn().CopyTo(ctx, f, copySQL(table, columns, "TO STDOUT", format))
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy %s: %w", table, err)
+		}
+		manifest.Tables = append(manifest.Tables, DumpTable{Name: table, Columns: columns, Rows: tag.RowsAffected()})
+		logger.InfoContext(ctx, "Dumped graph table", "table", table, "rows", tag.RowsAffected())
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeEntry(tw, manifestName, int64(len(data)), bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	for i, f := range files {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if err := writeEntry(tw, dumpTables[i]+".copy", info.Size(), f); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func writeEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: size, ModTime: time.Now()}); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, r)
+	return err
+}
+
+// Restore replaces the node and edge tables with a dump written by Dump, in
+// one transaction: on any error the graph is left as it was
+// The stops and routes the nodes refer to must already be imported
+func Restore(ctx context.Context, pool *pgxpool.Pool, r io.Reader, opts RestoreOptions) (*DumpManifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a graph dump: %w", err)
+	}
+	tr := tar.NewReader(gz)
+	manifest, err := readManifest(tr)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	version, err := schemaVersion(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string][]string, len(dumpTables))
+	for _, table := range dumpTables {
+		if current[table], err = tableColumns(ctx, tx, table); err != nil {
+			return nil, err
+		}
+	}
+	if err := manifest.check(version, current, opts); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, `TRUNCATE TABLE edge, node`); err != nil {
+		return nil, fmt.Errorf("failed to clear graph: %w", err)
+	}
+	for _, table := range manifest.Tables {
+		hdr, err := tr.Next()
+		if err != nil {
+			return nil, fmt.Errorf("dump ends before table %s: %w", table.Name, err)
+		}
+		if hdr.Name != table.Name+".copy" {
+			return nil, fmt.Errorf("dump has %s where %s.copy was expected", hdr.Name, table.Name)
+		}
+		tag, err := tx.Conn().PgConn().CopyFrom(ctx, tr, copySQL(table.Name, table.Columns, "FROM STDIN", manifest.Format))
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore %s: %w", table.Name, err)
+		}
+		if tag.RowsAffected() != table.Rows {
+			return nil, fmt.Errorf("restored %d rows of %s, the dump lists %d", tag.RowsAffected(), table.Name, table.Rows)
+		}
+		logger.InfoContext(ctx, "Restored graph table", "table", table.Name, "rows", table.Rows)
+
+		// Nodes and edges built after the restore must not reuse its IDs
+		if _, err := tx.Exec(ctx, fmt.Sprintf(
+			`SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE((SELECT MAX(id) FROM %[1]s), 0) + 1, false)`,
+			table.Name)); err != nil {
+			return nil, fmt.Errorf("failed to reset the %s id sequence: %w", table.Name, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit restore: %w", err)
+	}
+
+	if _, err := pool.Exec(ctx, `ANALYZE node, edge`); err != nil {
+		logger.WarnContext(ctx, "Failed to analyze restored graph", "error", err)
+	}
+	return manifest, nil
+}
+
+// readManifest reads the first entry of a dump
+func readManifest(tr *tar.Reader) (*DumpManifest, error) {
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("not a graph dump: %w", err)
+	}
+	if hdr.Name != manifestName {
+		return nil, fmt.Errorf("not a graph dump: first entry is %s, not %s", hdr.Name, manifestName)
+	}
+	var manifest DumpManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid dump manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// check verifies a dump can be restored into a database at version whose
+// graph tables have the columns current
+func (m *DumpManifest) check(version int64, current map[string][]string, opts RestoreOptions) error {
+	if m.Format != FormatBinary && m.Format != FormatCSV {
+		return fmt.Errorf("unknown dump format %q", m.Format)
+	}
+	if len(m.Tables) != len(dumpTables) {
+		return fmt.Errorf("dump has %d tables, expected %s", len(m.Tables), strings.Join(dumpTables, ", "))
+	}
+	for i, table := range m.Tables {
+		if table.Name != dumpTables[i] {
+			return fmt.Errorf("dump has table %s where %s was expected", table.Name, dumpTables[i])
+		}
+		have := make(map[string]bool, len(current[table.Name]))
+		for _, c := range current[table.Name] {
+			have[c] = true
+		}
+		for _, c := range table.Columns {
+			if !have[c] {
+				return fmt.Errorf("column %s.%s of the dump does not exist in the database", table.Name, c)
+			}
+		}
+	}
+	if m.SchemaVersion != version && !opts.IgnoreSchemaVersion {
+		return fmt.Errorf("%w: dump at %d, database at %d", ErrSchemaMismatch, m.SchemaVersion, version)
+	}
+	return nil
+}
+
+// copySQL is the COPY statement of columns of table in direction
+// ("TO STDOUT" or "FROM STDIN")
+func copySQL(table string, columns []string, direction string, format DumpFormat) string {
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = pgx.Identifier{c}.Sanitize()
+	}
+	return fmt.Sprintf("COPY %s (%s) %s (FORMAT %s)",
+		pgx.Identifier{table}.Sanitize(), strings.Join(quoted, ", "), direction, format)
+}
+
+// tableColumns lists the stored columns of table in order
+func tableColumns(ctx context.Context, tx pgx.Tx, table string) ([]string, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1 AND is_generated = 'NEVER'
+		ORDER BY ordinal_position
+	`, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s columns: %w", table, err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list %s columns: %w", table, err)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s does not exist", table)
+	}
+	return columns, nil
+}
+
+// schemaVersion is the migration version golang-migrate recorded, 0 when
+// none was
+func schemaVersion(ctx context.Context, tx pgx.Tx) (int64, error) {
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+	var version int64
+	err := tx.QueryRow(ctx, `SELECT version FROM schema_migrations LIMIT 1`).Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
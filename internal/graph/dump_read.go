@@ -0,0 +1,303 @@
+package graph
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/models"
+)
+
+// LoadFromDump loads the graph from a dump written by Dump, without a
+// database, for debugging a graph away from where it was built
+// A dump holds the node and edge tables only: nodes are named by their stop
+// and route IDs, and have no agency
+func (g *InMemoryGraph) LoadFromDump(ctx context.Context, r io.Reader) (manifest *DumpManifest, err error) {
+	startTime := time.Now()
+	defer func() {
+		if err != nil {
+			loadsFailed.Add(1)
+		}
+	}()
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a graph dump: %w", err)
+	}
+	tr := tar.NewReader(gz)
+	if manifest, err = readManifest(tr); err != nil {
+		return nil, err
+	}
+	if manifest.Format != FormatBinary && manifest.Format != FormatCSV {
+		return nil, fmt.Errorf("unknown dump format %q", manifest.Format)
+	}
+
+	nodes := make(map[int64]models.Node)
+	stopNodes := make(map[string][]int64)
+	edges := make(map[int64][]models.Edge)
+	edgeCount := 0
+
+	for _, table := range manifest.Tables {
+		hdr, err := tr.Next()
+		if err != nil {
+			return nil, fmt.Errorf("dump ends before table %s: %w", table.Name, err)
+		}
+		if hdr.Name != table.Name+".copy" {
+			return nil, fmt.Errorf("dump has %s where %s.copy was expected", hdr.Name, table.Name)
+		}
+
+		var add func(dumpRow) error
+		switch table.Name {
+		case "node":
+			add = func(row dumpRow) error {
+				node, err := row.node()
+				if err != nil {
+					return err
+				}
+				nodes[node.ID] = node
+				stopNodes[node.StopID] = append(stopNodes[node.StopID], node.ID)
+				return nil
+			}
+		case "edge":
+			add = func(row dumpRow) error {
+				edge, err := row.edge()
+				if err != nil {
+					return err
+				}
+				edges[edge.FromNodeID] = append(edges[edge.FromNodeID], edge)
+				edgeCount++
+				return nil
+			}
+		default:
+			continue
+		}
+		if err := readDumpRows(tr, manifest.Format, table.Columns, add); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", table.Name, err)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, errors.New("the dump has no nodes")
+	}
+
+	g.swap(ctx, nodes, edges, stopNodes, edgeCount, startTime)
+	return manifest, nil
+}
+
+// dumpRow is a row of a COPY stream, as sent: binary or CSV text
+type dumpRow struct {
+	format  DumpFormat
+	columns map[string]int
+	values  [][]byte // nil for NULL
+}
+
+func (r dumpRow) value(column string) []byte {
+	i, ok := r.columns[column]
+	if !ok || i >= len(r.values) {
+		return nil
+	}
+	return r.values[i]
+}
+
+func (r dumpRow) text(column string) string {
+	return string(r.value(column))
+}
+
+// int reads an integer column, 0 when NULL
+func (r dumpRow) int(column string) (int64, error) {
+	v := r.value(column)
+	if len(v) == 0 {
+		return 0, nil
+	}
+	if r.format == FormatCSV {
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("column %s: %w", column, err)
+		}
+		return n, nil
+	}
+	switch len(v) {
+	case 8:
+		return int64(binary.BigEndian.Uint64(v)), nil
+	case 4:
+		return int64(int32(binary.BigEndian.Uint32(v))), nil
+	case 2:
+		return int64(int16(binary.BigEndian.Uint16(v))), nil
+	}
+	return 0, fmt.Errorf("column %s: %d bytes is not an integer", column, len(v))
+}
+
+// point reads a PostGIS point column, EWKB in binary and hex EWKB in CSV
+func (r dumpRow) point(column string) (lat, lon float64, err error) {
+	v := r.value(column)
+	if len(v) == 0 {
+		return 0, 0, nil
+	}
+	if r.format == FormatCSV {
+		if v, err = hex.DecodeString(string(v)); err != nil {
+			return 0, 0, fmt.Errorf("column %s: %w", column, err)
+		}
+	}
+	lon, lat, err = parseEWKBPoint(v)
+	if err != nil {
+		return 0, 0, fmt.Errorf("column %s: %w", column, err)
+	}
+	return lat, lon, nil
+}
+
+func (r dumpRow) node() (models.Node, error) {
+	var node models.Node
+	var err error
+	if node.ID, err = r.int("id"); err != nil {
+		return node, err
+	}
+	node.StopID, node.RouteID = r.text("stop_id"), r.text("route_id")
+	node.StopName, node.RouteName = node.StopID, node.RouteID
+	node.Mode = models.TransitMode(r.text("mode"))
+	node.Lat, node.Lon, err = r.point("geom")
+	return node, err
+}
+
+func (r dumpRow) edge() (models.Edge, error) {
+	var edge models.Edge
+	ints := []struct {
+		column string
+		set    func(int64)
+	}{
+		{"id", func(n int64) { edge.ID = n }},
+		{"from_node_id", func(n int64) { edge.FromNodeID = n }},
+		{"to_node_id", func(n int64) { edge.ToNodeID = n }},
+		{"cost_time", func(n int64) { edge.CostTime = int(n) }},
+		{"cost_walk", func(n int64) { edge.CostWalk = int(n) }},
+		{"cost_transfer", func(n int64) { edge.CostTransfer = int(n) }},
+		{"sequence", func(n int64) { edge.Sequence = int(n) }},
+	}
+	for _, c := range ints {
+		n, err := r.int(c.column)
+		if err != nil {
+			return edge, err
+		}
+		c.set(n)
+	}
+	edge.Type = models.EdgeType(r.text("type"))
+	edge.TripID = r.text("trip_id")
+	return edge, nil
+}
+
+// readDumpRows calls add with each row of a COPY stream of columns
+func readDumpRows(r io.Reader, format DumpFormat, columns []string, add func(dumpRow) error) error {
+	index := make(map[string]int, len(columns))
+	for i, c := range columns {
+		index[c] = i
+	}
+	if format == FormatCSV {
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = len(columns)
+		cr.ReuseRecord = true
+		for {
+			record, err := cr.Read()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			values := make([][]byte, len(record))
+			for i, v := range record {
+				if v != "" {
+					values[i] = []byte(v)
+				}
+			}
+			if err := add(dumpRow{format: format, columns: index, values: values}); err != nil {
+				return err
+			}
+		}
+	}
+	return readBinaryCopy(r, func(values [][]byte) error {
+		return add(dumpRow{format: format, columns: index, values: values})
+	})
+}
+
+// copySignature starts a binary COPY stream
+var copySignature = []byte("PGCOPY\n\xff\r\n\x00")
+
+// readBinaryCopy calls add with the fields of each tuple of a binary COPY
+// stream
+func readBinaryCopy(r io.Reader, add func([][]byte) error) error {
+	header := make([]byte, len(copySignature)+8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("not a binary COPY stream: %w", err)
+	}
+	if !bytes.Equal(header[:len(copySignature)], copySignature) {
+		return errors.New("not a binary COPY stream")
+	}
+	extension := binary.BigEndian.Uint32(header[len(copySignature)+4:])
+	if _, err := io.CopyN(io.Discard, r, int64(extension)); err != nil {
+		return err
+	}
+
+	var buf [4]byte
+	for {
+		if _, err := io.ReadFull(r, buf[:2]); err != nil {
+			return fmt.Errorf("binary COPY stream ends without its trailer: %w", err)
+		}
+		count := int16(binary.BigEndian.Uint16(buf[:2]))
+		if count == -1 {
+			return nil
+		}
+		values := make([][]byte, count)
+		for i := range values {
+			if _, err := io.ReadFull(r, buf[:4]); err != nil {
+				return err
+			}
+			size := int32(binary.BigEndian.Uint32(buf[:4]))
+			if size < 0 {
+				continue
+			}
+			values[i] = make([]byte, size)
+			if _, err := io.ReadFull(r, values[i]); err != nil {
+				return err
+			}
+		}
+		if err := add(values); err != nil {
+			return err
+		}
+	}
+}
+
+// parseEWKBPoint reads the coordinates of a point in (E)WKB
+func parseEWKBPoint(b []byte) (x, y float64, err error) {
+	if len(b) < 5 {
+		return 0, 0, errors.New("truncated WKB")
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if b[0] == 1 {
+		order = binary.LittleEndian
+	}
+	kind := order.Uint32(b[1:5])
+	offset := 5
+	if kind&0x20000000 != 0 { // SRID follows
+		offset += 4
+	}
+	if kind&0x0fffffff != 1 {
+		return 0, 0, fmt.Errorf("WKB geometry type %d is not a point", kind&0x0fffffff)
+	}
+	if len(b) < offset+16 {
+		return 0, 0, errors.New("truncated WKB point")
+	}
+	x = math.Float64frombits(order.Uint64(b[offset:]))
+	y = math.Float64frombits(order.Uint64(b[offset+8:]))
+	return x, y, nil
+}
@@ -0,0 +1,175 @@
+package graph
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopySQL(t *testing.T) {
+	assert.Equal(t, `COPY "edge" ("id", "from_node_id", "type") TO STDOUT (FORMAT binary)`,
+		copySQL("edge", []string{"id", "from_node_id", "type"}, "TO STDOUT", FormatBinary))
+	assert.Equal(t, `COPY "node" ("id", "stop_id") FROM STDIN (FORMAT csv)`,
+		copySQL("node", []string{"id", "stop_id"}, "FROM STDIN", FormatCSV))
+}
+
+func TestReadManifest(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	manifest := `{"format":"csv","schema_version":32,"tables":[{"name":"node","columns":["id"],"rows":2}]}`
+	assert.NoError(t, writeEntry(tw, manifestName, int64(len(manifest)), strings.NewReader(manifest)))
+	assert.NoError(t, tw.Close())
+
+	m, err := readManifest(tar.NewReader(&buf))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, FormatCSV, m.Format)
+	assert.Equal(t, int64(32), m.SchemaVersion)
+	assert.Equal(t, []DumpTable{{Name: "node", Columns: []string{"id"}, Rows: 2}}, m.Tables)
+
+	buf.Reset()
+	tw = tar.NewWriter(&buf)
+	assert.NoError(t, writeEntry(tw, "node.copy", 0, strings.NewReader("")))
+	assert.NoError(t, tw.Close())
+	_, err = readManifest(tar.NewReader(&buf))
+	assert.ErrorContains(t, err, "not a graph dump")
+}
+
+func TestDumpManifestCheck(t *testing.T) {
+	current := map[string][]string{
+		"node": {"id", "stop_id", "route_id", "mode", "geom", "created_at"},
+		"edge": {"id", "from_node_id", "to_node_id", "type", "cost_time"},
+	}
+	manifest := func() *DumpManifest {
+		return &DumpManifest{Format: FormatBinary, SchemaVersion: 32, Tables: []DumpTable{
+			{Name: "node", Columns: []string{"id", "stop_id", "route_id", "mode"}},
+			{Name: "edge", Columns: []string{"id", "from_node_id", "to_node_id", "type", "cost_time"}},
+		}}
+	}
+
+	assert.NoError(t, manifest().check(32, current, RestoreOptions{}))
+
+	err := manifest().check(33, current, RestoreOptions{})
+	assert.True(t, errors.Is(err, ErrSchemaMismatch))
+	assert.NoError(t, manifest().check(33, current, RestoreOptions{IgnoreSchemaVersion: true}))
+
+	m := manifest()
+	m.Tables[0].Columns = append(m.Tables[0].Columns, "lat")
+	assert.ErrorContains(t, m.check(32, current, RestoreOptions{IgnoreSchemaVersion: true}), "node.lat")
+
+	m = manifest()
+	m.Tables[0], m.Tables[1] = m.Tables[1], m.Tables[0]
+	assert.Error(t, m.check(32, current, RestoreOptions{}))
+
+	m = manifest()
+	m.Format = "sql"
+	assert.Error(t, m.check(32, current, RestoreOptions{}))
+}
+
+// testDump writes a dump of the given table streams
+func testDump(t *testing.T, format DumpFormat, tables []DumpTable, streams [][]byte) *bytes.Buffer {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	manifest, _ := json.Marshal(DumpManifest{Format: format, SchemaVersion: 41, Tables: tables})
+	assert.NoError(t, writeEntry(tw, manifestName, int64(len(manifest)), bytes.NewReader(manifest)))
+	for i, table := range tables {
+		assert.NoError(t, writeEntry(tw, table.Name+".copy", int64(len(streams[i])), bytes.NewReader(streams[i])))
+	}
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	return &buf
+}
+
+// ewkbPoint is a point with SRID 4326 as PostGIS sends it
+func ewkbPoint(lon, lat float64) []byte {
+	b := []byte{1}
+	b = binary.LittleEndian.AppendUint32(b, 0x20000001)
+	b = binary.LittleEndian.AppendUint32(b, 4326)
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(lon))
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(lat))
+}
+
+// binaryCopy encodes tuples as a binary COPY stream; nil fields are NULL
+func binaryCopy(tuples ...[][]byte) []byte {
+	b := append([]byte(nil), copySignature...)
+	b = binary.BigEndian.AppendUint32(b, 0)
+	b = binary.BigEndian.AppendUint32(b, 0)
+	for _, fields := range tuples {
+		b = binary.BigEndian.AppendUint16(b, uint16(len(fields)))
+		for _, f := range fields {
+			if f == nil {
+				b = binary.BigEndian.AppendUint32(b, math.MaxUint32)
+				continue
+			}
+			b = binary.BigEndian.AppendUint32(b, uint32(len(f)))
+			b = append(b, f...)
+		}
+	}
+	return binary.BigEndian.AppendUint16(b, math.MaxUint16)
+}
+
+func TestLoadFromDump(t *testing.T) {
+	nodeColumns := []string{"id", "stop_id", "route_id", "mode", "geom", "created_at"}
+	edgeColumns := []string{"id", "from_node_id", "to_node_id", "type", "cost_time", "cost_walk", "cost_transfer", "trip_id", "sequence"}
+	tables := []DumpTable{{Name: "node", Columns: nodeColumns, Rows: 2}, {Name: "edge", Columns: edgeColumns, Rows: 1}}
+
+	check := func(t *testing.T, g *InMemoryGraph) {
+		assert.Equal(t, 2, g.Stats().Nodes)
+		assert.Equal(t, 1, g.Stats().Edges)
+		n, ok := g.GetNode(7)
+		if assert.True(t, ok) {
+			assert.Equal(t, "S1", n.StopName)
+			assert.Equal(t, "R1", n.RouteName)
+			assert.Equal(t, models.ModeBRT, n.Mode)
+			assert.InDelta(t, 14.69, n.Lat, 1e-9)
+			assert.InDelta(t, -17.44, n.Lon, 1e-9)
+		}
+		edges := g.GetEdges(7)
+		if assert.Len(t, edges, 1) {
+			assert.Equal(t, models.Edge{ID: 3, FromNodeID: 7, ToNodeID: 8, Type: models.EdgeRide, CostTime: 120, TripID: "T1", Sequence: 4}, edges[0])
+		}
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		point := strings.ToUpper(hex.EncodeToString(ewkbPoint(-17.44, 14.69)))
+		nodes := "7,S1,R1,BRT," + point + ",2026-03-02 07:00:00+00\n8,S2,R1,BRT,,\n"
+		edges := "3,7,8,RIDE,120,0,0,T1,4\n"
+		g := &InMemoryGraph{}
+		_, err := g.LoadFromDump(context.Background(), testDump(t, FormatCSV, tables, [][]byte{[]byte(nodes), []byte(edges)}))
+		if assert.NoError(t, err) {
+			check(t, g)
+		}
+	})
+
+	t.Run("binary", func(t *testing.T) {
+		i64 := func(n int64) []byte { return binary.BigEndian.AppendUint64(nil, uint64(n)) }
+		i32 := func(n int32) []byte { return binary.BigEndian.AppendUint32(nil, uint32(n)) }
+		nodes := binaryCopy(
+			[][]byte{i64(7), []byte("S1"), []byte("R1"), []byte("BRT"), ewkbPoint(-17.44, 14.69), i64(0)},
+			[][]byte{i64(8), []byte("S2"), []byte("R1"), []byte("BRT"), nil, nil},
+		)
+		edges := binaryCopy([][]byte{i64(3), i64(7), i64(8), []byte("RIDE"), i32(120), i32(0), i32(0), []byte("T1"), i32(4)})
+		g := &InMemoryGraph{}
+		_, err := g.LoadFromDump(context.Background(), testDump(t, FormatBinary, tables, [][]byte{nodes, edges}))
+		if assert.NoError(t, err) {
+			check(t, g)
+		}
+	})
+
+	g := &InMemoryGraph{}
+	_, err := g.LoadFromDump(context.Background(), strings.NewReader("not gzip"))
+	assert.ErrorContains(t, err, "not a graph dump")
+}
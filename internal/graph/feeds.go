@@ -0,0 +1,258 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/gtfs"
+	"github.com/passbi/passbi_core/internal/models"
+)
+
+// metersPerDegreeLat bounds the latitude window searched for walkable stops
+const metersPerDegreeLat = 111320
+
+// LoadFromFeeds builds the graph from parsed GTFS feeds, keyed by agency ID,
+// without a database: nodes and edges follow the rules of Builder, except
+// that a pair of consecutive stops gets one RIDE edge, the fastest
+// It is the embedded mode's replacement for an import and LoadFromDB
+func (g *InMemoryGraph) LoadFromFeeds(ctx context.Context, feeds map[string]*gtfs.GTFSFeed) (err error) {
+	startTime := time.Now()
+	logger.Info("Building graph from GTFS feeds", "feeds", len(feeds))
+	defer func() {
+		if err != nil {
+			loadsFailed.Add(1)
+		}
+	}()
+
+	b := newFeedBuilder()
+	agencies := make([]string, 0, len(feeds))
+	for agencyID := range feeds {
+		agencies = append(agencies, agencyID)
+	}
+	sort.Strings(agencies)
+	for _, agencyID := range agencies {
+		b.addFeed(agencyID, feeds[agencyID])
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	if len(b.nodes) == 0 {
+		return fmt.Errorf("no stop is served by a trip in %d feeds", len(feeds))
+	}
+
+	b.addWalkEdges()
+	b.addTransferEdges()
+
+	g.swap(ctx, b.nodes, b.edges, b.stopNodes, b.edgeCount, startTime)
+	return nil
+}
+
+// feedBuilder accumulates the nodes and edges of one or more feeds
+type feedBuilder struct {
+	nodes     map[int64]models.Node
+	edges     map[int64][]models.Edge
+	stopNodes map[string][]int64
+	edgeCount int
+
+	nodeIDs map[feedNodeKey]int64
+	rides   map[[2]int64]int // (from, to) -> index in edges[from]
+	nextID  int64
+}
+
+type feedNodeKey struct {
+	stopID  string
+	routeID string
+}
+
+func newFeedBuilder() *feedBuilder {
+	return &feedBuilder{
+		nodes:     make(map[int64]models.Node),
+		edges:     make(map[int64][]models.Edge),
+		stopNodes: make(map[string][]int64),
+		nodeIDs:   make(map[feedNodeKey]int64),
+		rides:     make(map[[2]int64]int),
+	}
+}
+
+// addFeed adds a node per (stop, route) served by a trip and the RIDE edges
+// between consecutive stops of each trip
+func (b *feedBuilder) addFeed(agencyID string, feed *gtfs.GTFSFeed) {
+	stops := make(map[string]models.GTFSStop, len(feed.Stops))
+	for _, s := range feed.Stops {
+		stops[s.StopID] = s
+	}
+	routes := make(map[string]models.GTFSRoute, len(feed.Routes))
+	for _, r := range feed.Routes {
+		routes[r.RouteID] = r
+	}
+	tripRoutes := make(map[string]string, len(feed.Trips))
+	for _, t := range feed.Trips {
+		tripRoutes[t.TripID] = t.RouteID
+	}
+
+	tripStops := make(map[string][]models.GTFSStopTime)
+	for _, st := range feed.StopTimes {
+		if _, ok := tripRoutes[st.TripID]; ok {
+			tripStops[st.TripID] = append(tripStops[st.TripID], st)
+		}
+	}
+	tripIDs := make([]string, 0, len(tripStops))
+	for tripID := range tripStops {
+		tripIDs = append(tripIDs, tripID)
+	}
+	sort.Strings(tripIDs)
+
+	node := func(stopID, routeID string) (int64, bool) {
+		key := feedNodeKey{stopID, routeID}
+		if id, ok := b.nodeIDs[key]; ok {
+			return id, true
+		}
+		stop, ok := stops[stopID]
+		if !ok {
+			return 0, false
+		}
+		route := routes[routeID]
+		mode := gtfs.InferMode(route)
+		if mode == "" {
+			mode = models.ModeBus
+		}
+
+		b.nextID++
+		b.nodeIDs[key] = b.nextID
+		b.nodes[b.nextID] = models.Node{
+			ID: b.nextID, StopID: stopID, StopName: stop.StopName,
+			RouteID: routeID, RouteName: firstNonEmpty(route.ShortName, route.LongName, routeID),
+			AgencyID: agencyID, Mode: mode, Lat: stop.Lat, Lon: stop.Lon,
+		}
+		b.stopNodes[stopID] = append(b.stopNodes[stopID], b.nextID)
+		return b.nextID, true
+	}
+
+	for _, tripID := range tripIDs {
+		routeID := tripRoutes[tripID]
+		sts := tripStops[tripID]
+		sort.Slice(sts, func(i, j int) bool { return sts[i].StopSequence < sts[j].StopSequence })
+
+		for i := range sts {
+			from, ok := node(sts[i].StopID, routeID)
+			if !ok || i == len(sts)-1 {
+				continue
+			}
+			to, ok := node(sts[i+1].StopID, routeID)
+			if !ok {
+				continue
+			}
+			b.addRide(from, to, rideSeconds(sts[i], sts[i+1]), tripID, sts[i].StopSequence)
+		}
+	}
+}
+
+// rideSeconds is the scheduled time between two stops, 5 minutes when it is
+// unknown and at least a minute
+func rideSeconds(from, to models.GTFSStopTime) int {
+	cost := 300
+	if from.DepartureTime != "" && to.ArrivalTime != "" {
+		dep, err1 := gtfs.ParseTimeToSeconds(from.DepartureTime)
+		arr, err2 := gtfs.ParseTimeToSeconds(to.ArrivalTime)
+		if err1 == nil && err2 == nil && arr > dep {
+			cost = arr - dep
+		}
+	}
+	if cost < 60 {
+		cost = 60
+	}
+	return cost
+}
+
+// addRide adds a RIDE edge, or lowers the cost of the existing one
+func (b *feedBuilder) addRide(from, to int64, cost int, tripID string, sequence int) {
+	if i, ok := b.rides[[2]int64{from, to}]; ok {
+		if e := &b.edges[from][i]; cost < e.CostTime {
+			e.CostTime, e.TripID, e.Sequence = cost, tripID, sequence
+		}
+		return
+	}
+	b.rides[[2]int64{from, to}] = len(b.edges[from])
+	b.addEdge(models.Edge{FromNodeID: from, ToNodeID: to, Type: models.EdgeRide,
+		CostTime: cost, TripID: tripID, Sequence: sequence})
+}
+
+func (b *feedBuilder) addEdge(e models.Edge) {
+	b.edgeCount++
+	e.ID = int64(b.edgeCount)
+	b.edges[e.FromNodeID] = append(b.edges[e.FromNodeID], e)
+}
+
+// addWalkEdges links the nodes of stops up to maxWalkDistance apart
+// Stops are sorted by latitude so only a narrow band is compared
+func (b *feedBuilder) addWalkEdges() {
+	type stopPoint struct {
+		id       string
+		lat, lon float64
+	}
+	points := make([]stopPoint, 0, len(b.stopNodes))
+	for stopID, ids := range b.stopNodes {
+		n := b.nodes[ids[0]]
+		points = append(points, stopPoint{stopID, n.Lat, n.Lon})
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].lat != points[j].lat {
+			return points[i].lat < points[j].lat
+		}
+		return points[i].id < points[j].id
+	})
+
+	maxDistance := maxWalkDistance()
+	band := maxDistance / metersPerDegreeLat
+	for i, p := range points {
+		for j := i + 1; j < len(points) && points[j].lat-p.lat <= band; j++ {
+			q := points[j]
+			dist := haversineDistanceFast(p.lat, p.lon, q.lat, q.lon)
+			if dist > maxDistance {
+				continue
+			}
+			walk := models.Edge{Type: models.EdgeWalk, CostTime: WalkSeconds(dist), CostWalk: int(math.Ceil(dist))}
+			for _, from := range b.stopNodes[p.id] {
+				for _, to := range b.stopNodes[q.id] {
+					walk.FromNodeID, walk.ToNodeID = from, to
+					b.addEdge(walk)
+					walk.FromNodeID, walk.ToNodeID = to, from
+					b.addEdge(walk)
+				}
+			}
+		}
+	}
+}
+
+// addTransferEdges links the nodes of different routes at the same stop
+func (b *feedBuilder) addTransferEdges() {
+	stopIDs := make([]string, 0, len(b.stopNodes))
+	for stopID := range b.stopNodes {
+		stopIDs = append(stopIDs, stopID)
+	}
+	sort.Strings(stopIDs)
+
+	for _, stopID := range stopIDs {
+		ids := b.stopNodes[stopID]
+		for _, from := range ids {
+			for _, to := range ids {
+				if from != to {
+					b.addEdge(models.Edge{FromNodeID: from, ToNodeID: to, Type: models.EdgeTransfer,
+						CostTime: transferTime(), CostTransfer: 1})
+				}
+			}
+		}
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
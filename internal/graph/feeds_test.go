@@ -0,0 +1,89 @@
+package graph
+
+import (
+	"context"
+	"testing"
+
+	"github.com/passbi/passbi_core/internal/gtfs"
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadFromFeeds(t *testing.T) {
+	// Stops A and B are ~110 m apart, C is ~1.1 km further; line 1 runs
+	// A -> C twice, line 2 (a BRT) runs B -> C
+	feed := &gtfs.GTFSFeed{
+		Stops: []models.GTFSStop{
+			{StopID: "A", StopName: "Sandaga", Lat: 14.6700, Lon: -17.4400},
+			{StopID: "B", StopName: "Kermel", Lat: 14.6710, Lon: -17.4400},
+			{StopID: "C", StopName: "Colobane", Lat: 14.6810, Lon: -17.4400},
+		},
+		Routes: []models.GTFSRoute{
+			{RouteID: "1", ShortName: "1", RouteType: 3},
+			{RouteID: "2", LongName: "BRT Petersen", RouteType: 3},
+		},
+		Trips: []models.GTFSTrip{
+			{RouteID: "1", TripID: "1a"}, {RouteID: "1", TripID: "1b"}, {RouteID: "2", TripID: "2a"},
+		},
+		StopTimes: []models.GTFSStopTime{
+			{TripID: "1a", StopID: "C", StopSequence: 2, ArrivalTime: "08:10:00"},
+			{TripID: "1a", StopID: "A", StopSequence: 1, DepartureTime: "08:00:00"},
+			{TripID: "1b", StopID: "A", StopSequence: 1, DepartureTime: "09:00:00"},
+			{TripID: "1b", StopID: "C", StopSequence: 2, ArrivalTime: "09:08:00"},
+			{TripID: "2a", StopID: "B", StopSequence: 1},
+			{TripID: "2a", StopID: "C", StopSequence: 2},
+			{TripID: "2a", StopID: "X", StopSequence: 3}, // not in stops.txt
+		},
+	}
+
+	g := &InMemoryGraph{}
+	if !assert.NoError(t, g.LoadFromFeeds(context.Background(), map[string]*gtfs.GTFSFeed{"dakar_dem_dikk": feed})) {
+		return
+	}
+
+	stats := g.Stats()
+	assert.True(t, stats.Loaded)
+	assert.Equal(t, 4, stats.Nodes) // A/1, C/1, B/2, C/2
+	assert.Equal(t, 3, stats.Stops)
+
+	edges := map[models.EdgeType][]models.Edge{}
+	nodeOf := map[string]models.Node{}
+	for _, n := range g.Nodes {
+		nodeOf[n.StopID+"/"+n.RouteID] = n
+		assert.Equal(t, "dakar_dem_dikk", n.AgencyID)
+		for _, e := range g.Edges[n.ID] {
+			edges[e.Type] = append(edges[e.Type], e)
+		}
+	}
+	assert.Equal(t, "BRT Petersen", nodeOf["B/2"].RouteName)
+	assert.Equal(t, "Kermel", nodeOf["B/2"].StopName)
+
+	// One RIDE edge per pair of stops, the fastest trip
+	if assert.Len(t, edges[models.EdgeRide], 2) {
+		for _, e := range edges[models.EdgeRide] {
+			if e.FromNodeID == nodeOf["A/1"].ID {
+				assert.Equal(t, 480, e.CostTime)
+				assert.Equal(t, "1b", e.TripID)
+			} else {
+				assert.Equal(t, 300, e.CostTime) // no times
+			}
+		}
+	}
+
+	// A and B are within walking distance both ways; C is not
+	if assert.Len(t, edges[models.EdgeWalk], 2) {
+		for _, e := range edges[models.EdgeWalk] {
+			assert.Equal(t, 112, e.CostWalk)
+			assert.Equal(t, WalkSeconds(111.2), e.CostTime)
+		}
+	}
+
+	// C is served by both lines
+	if assert.Len(t, edges[models.EdgeTransfer], 2) {
+		assert.Equal(t, transferTime(), edges[models.EdgeTransfer][0].CostTime)
+	}
+	assert.Equal(t, 6, stats.Edges)
+
+	assert.Error(t, g.LoadFromFeeds(context.Background(), map[string]*gtfs.GTFSFeed{"empty": {}}))
+	assert.Equal(t, 4, g.Stats().Nodes)
+}
@@ -3,15 +3,18 @@ package graph
 import (
 	"context"
 	"fmt"
-	"log"
 	"math"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/logging"
 	"github.com/passbi/passbi_core/internal/models"
 )
 
+var logger = logging.For("graph")
+
 // InMemoryGraph holds the entire routing graph in memory for fast A* lookups
 type InMemoryGraph struct {
 	mu        sync.RWMutex
@@ -19,6 +22,24 @@ type InMemoryGraph struct {
 	Edges     map[int64][]models.Edge   // fromNodeID -> []Edge
 	StopNodes map[string][]int64        // stopID -> []nodeID
 	loaded    bool
+	edgeCount int
+	loadedAt  time.Time
+
+	loadDuration   time.Duration
+	estimatedBytes int64
+	shrunk         bool // the last reload lost more than GRAPH_SHRINK_ALERT of the graph
+}
+
+// Stats describes the graph currently held in memory
+type Stats struct {
+	Loaded   bool       `json:"loaded"`
+	Nodes    int        `json:"nodes"`
+	Edges    int        `json:"edges"`
+	Stops    int        `json:"stops"`
+	LoadedAt *time.Time `json:"loaded_at,omitempty"`
+
+	LoadSeconds    float64 `json:"load_seconds,omitempty"`
+	EstimatedBytes int64   `json:"estimated_bytes,omitempty"` // heap held by the graph, approximately
 }
 
 var (
@@ -39,12 +60,16 @@ func GetGraph() *InMemoryGraph {
 }
 
 // LoadFromDB loads the entire graph from PostgreSQL into memory
-func (g *InMemoryGraph) LoadFromDB(ctx context.Context, db *pgxpool.Pool) error {
-	g.mu.Lock()
-	defer g.mu.Unlock()
-
+// The graph is read without holding the lock; readers keep using the previous
+// graph (or see it as not loaded) until the new one is swapped in
+func (g *InMemoryGraph) LoadFromDB(ctx context.Context, db *pgxpool.Pool) (err error) {
 	startTime := time.Now()
-	log.Println("Loading graph into memory...")
+	logger.Info("Loading graph into memory")
+	defer func() {
+		if err != nil {
+			loadsFailed.Add(1)
+		}
+	}()
 
 	// 1. Load all nodes
 	nodes := make(map[int64]models.Node)
@@ -53,7 +78,7 @@ func (g *InMemoryGraph) LoadFromDB(ctx context.Context, db *pgxpool.Pool) error
 	nodeRows, err := db.Query(ctx, `
 		SELECT n.id, n.stop_id, s.name, n.route_id,
 		       COALESCE(rt.short_name, rt.long_name, rt.id) as route_name,
-		       n.mode, s.lat, s.lon
+		       COALESCE(rt.agency_id, ''), n.mode, s.lat, s.lon
 		FROM node n
 		JOIN stop s ON s.id = n.stop_id
 		LEFT JOIN route rt ON rt.id = n.route_id
@@ -66,15 +91,15 @@ func (g *InMemoryGraph) LoadFromDB(ctx context.Context, db *pgxpool.Pool) error
 	for nodeRows.Next() {
 		var node models.Node
 		if err := nodeRows.Scan(&node.ID, &node.StopID, &node.StopName, &node.RouteID,
-			&node.RouteName, &node.Mode, &node.Lat, &node.Lon); err != nil {
-			log.Printf("Warning: failed to scan node: %v", err)
+			&node.RouteName, &node.AgencyID, &node.Mode, &node.Lat, &node.Lon); err != nil {
+			logger.WarnContext(ctx, "Failed to scan node", "error", err)
 			continue
 		}
 		nodes[node.ID] = node
 		stopNodes[node.StopID] = append(stopNodes[node.StopID], node.ID)
 	}
 
-	log.Printf("  Loaded %d nodes", len(nodes))
+	logger.Debug("Loaded nodes", "nodes", len(nodes))
 
 	// 2. Load all edges grouped by from_node_id
 	edges := make(map[int64][]models.Edge)
@@ -94,25 +119,51 @@ func (g *InMemoryGraph) LoadFromDB(ctx context.Context, db *pgxpool.Pool) error
 		var edge models.Edge
 		if err := edgeRows.Scan(&edge.ID, &edge.FromNodeID, &edge.ToNodeID, &edge.Type,
 			&edge.CostTime, &edge.CostWalk, &edge.CostTransfer); err != nil {
-			log.Printf("Warning: failed to scan edge: %v", err)
+			logger.WarnContext(ctx, "Failed to scan edge", "error", err)
 			continue
 		}
 		edges[edge.FromNodeID] = append(edges[edge.FromNodeID], edge)
 		edgeCount++
 	}
 
-	log.Printf("  Loaded %d edges", edgeCount)
+	logger.Debug("Loaded edges", "edges", edgeCount)
 
-	// Swap in the new data
+	g.swap(ctx, nodes, edges, stopNodes, edgeCount, startTime)
+	return nil
+}
+
+// swap replaces the graph held in memory with a newly loaded one
+func (g *InMemoryGraph) swap(ctx context.Context, nodes map[int64]models.Node, edges map[int64][]models.Edge,
+	stopNodes map[string][]int64, edgeCount int, startTime time.Time) {
+	estimated := estimateBytes(nodes, edges, stopNodes)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	prevLoaded, prevNodes, prevEdges := g.loaded, len(g.Nodes), g.edgeCount
 	g.Nodes = nodes
 	g.Edges = edges
 	g.StopNodes = stopNodes
 	g.loaded = true
+	g.edgeCount = edgeCount
+	g.loadedAt = time.Now()
 
 	duration := time.Since(startTime)
-	log.Printf("Graph loaded in %v (%d nodes, %d edges)", duration, len(nodes), edgeCount)
-
-	return nil
+	g.loadDuration = duration
+	g.estimatedBytes = estimated
+	loadsSucceeded.Add(1)
+	logger.Info("Graph loaded", "duration", duration.String(), "nodes", len(nodes), "edges", edgeCount,
+		"estimated_mb", estimated>>20)
+
+	// A reload that loses much of the graph usually follows a bad import;
+	// the graph is still served, but the error is reported
+	threshold := shrinkThreshold()
+	g.shrunk = prevLoaded && (shrank(prevNodes, len(nodes), threshold) || shrank(prevEdges, edgeCount, threshold))
+	if g.shrunk {
+		loadsShrunk.Add(1)
+		logger.ErrorContext(ctx, "Graph shrank on reload, check the last import",
+			"nodes_before", prevNodes, "nodes", len(nodes), "edges_before", prevEdges, "edges", edgeCount,
+			"threshold_pct", threshold*100)
+	}
 }
 
 // IsLoaded returns true if the graph has been loaded
@@ -122,6 +173,26 @@ func (g *InMemoryGraph) IsLoaded() bool {
 	return g.loaded
 }
 
+// Stats returns the size of the loaded graph
+func (g *InMemoryGraph) Stats() Stats {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	stats := Stats{
+		Loaded: g.loaded,
+		Nodes:  len(g.Nodes),
+		Edges:  g.edgeCount,
+		Stops:  len(g.StopNodes),
+	}
+	if g.loaded {
+		loadedAt := g.loadedAt
+		stats.LoadedAt = &loadedAt
+		stats.LoadSeconds = g.loadDuration.Seconds()
+		stats.EstimatedBytes = g.estimatedBytes
+	}
+	return stats
+}
+
 // GetNode returns a node by ID (in-memory lookup)
 func (g *InMemoryGraph) GetNode(nodeID int64) (models.Node, bool) {
 	g.mu.RLock()
@@ -137,6 +208,36 @@ func (g *InMemoryGraph) GetEdges(nodeID int64) []models.Edge {
 	return g.Edges[nodeID]
 }
 
+// GetStopNodes returns the nodes of a stop, one per route serving it
+func (g *InMemoryGraph) GetStopNodes(stopID string) []models.Node {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	var nodes []models.Node
+	for _, id := range g.StopNodes[stopID] {
+		if node, ok := g.Nodes[id]; ok {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// GetEdgesTo returns the incoming edges of a node
+// It scans every edge: for diagnostics, not for searches
+func (g *InMemoryGraph) GetEdgesTo(nodeID int64) []models.Edge {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	var in []models.Edge
+	for _, edges := range g.Edges {
+		for _, e := range edges {
+			if e.ToNodeID == nodeID {
+				in = append(in, e)
+			}
+		}
+	}
+	sort.Slice(in, func(i, j int) bool { return in[i].ID < in[j].ID })
+	return in
+}
+
 // FindNearestNodes finds the N nearest nodes to coordinates using in-memory search
 // All stops (including BRT/TER) are searched within a 500m radius
 func (g *InMemoryGraph) FindNearestNodes(lat, lon float64, limit int) []models.Node {
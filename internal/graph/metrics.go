@@ -0,0 +1,103 @@
+package graph
+
+import (
+	"os"
+	"strconv"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/passbi/passbi_core/internal/metrics"
+	"github.com/passbi/passbi_core/internal/models"
+)
+
+var (
+	loadsSucceeded atomic.Int64
+	loadsFailed    atomic.Int64
+	loadsShrunk    atomic.Int64
+)
+
+func init() {
+	metrics.Register(collectMetrics)
+}
+
+func collectMetrics(w *metrics.Writer) {
+	g := GetGraph()
+	g.mu.RLock()
+	loaded, nodes, edges, stops := g.loaded, len(g.Nodes), g.edgeCount, len(g.StopNodes)
+	loadedAt, loadSeconds, bytes, shrunk := g.loadedAt, g.loadDuration.Seconds(), g.estimatedBytes, g.shrunk
+	g.mu.RUnlock()
+
+	w.Counter("passbi_graph_loads_total", "Graph loads into memory by outcome", float64(loadsSucceeded.Load()), metrics.L("outcome", "success"))
+	w.Counter("passbi_graph_loads_total", "Graph loads into memory by outcome", float64(loadsFailed.Load()), metrics.L("outcome", "failed"))
+	w.Counter("passbi_graph_shrinks_total", "Graph reloads that lost more than GRAPH_SHRINK_ALERT of its nodes or edges", float64(loadsShrunk.Load()))
+	w.Counter("passbi_graph_notify_reloads_total", "Graph reloads triggered by a rebuild in another process", float64(notifyReloads.Load()), metrics.L("outcome", "success"))
+	w.Counter("passbi_graph_notify_reloads_total", "Graph reloads triggered by a rebuild in another process", float64(notifyFailures.Load()), metrics.L("outcome", "failed"))
+	w.Gauge("passbi_graph_loaded", "Whether the routing graph is in memory", boolGauge(loaded))
+	if !loaded {
+		return
+	}
+	w.Gauge("passbi_graph_nodes", "Nodes of the graph in memory", float64(nodes))
+	w.Gauge("passbi_graph_edges", "Edges of the graph in memory", float64(edges))
+	w.Gauge("passbi_graph_stops", "Stops of the graph in memory", float64(stops))
+	w.Gauge("passbi_graph_estimated_bytes", "Estimated heap held by the graph in memory", float64(bytes))
+	w.Gauge("passbi_graph_load_duration_seconds", "Duration of the last graph load", loadSeconds)
+	w.Gauge("passbi_graph_last_load_timestamp_seconds", "Unix time of the last graph load", float64(loadedAt.Unix()))
+	w.Gauge("passbi_graph_shrunk", "1 when the last reload lost more than GRAPH_SHRINK_ALERT of the graph (bad import?)", boolGauge(shrunk))
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// shrinkThreshold is the share of nodes or edges a reload may lose before it
+// is reported, from GRAPH_SHRINK_ALERT in percent (default 20, 0 disables)
+func shrinkThreshold() float64 {
+	if v := os.Getenv("GRAPH_SHRINK_ALERT"); v != "" {
+		if pct, err := strconv.ParseFloat(v, 64); err == nil && pct >= 0 && pct <= 100 {
+			return pct / 100
+		}
+	}
+	return 0.2
+}
+
+// shrank reports whether going from before to after lost more than threshold
+// of the graph
+func shrank(before, after int, threshold float64) bool {
+	return threshold > 0 && before > 0 && float64(after) < float64(before)*(1-threshold)
+}
+
+// Go maps keep about 6.5 entries per 8 bucket slots, plus a byte of hash
+// per slot
+const mapOverhead = 8.0 / 6.5
+
+// estimateBytes approximates the heap held by the graph's maps: entries,
+// slice backing arrays and the bytes of their strings
+// It ignores allocator rounding, so the heap in use is somewhat larger
+func estimateBytes(nodes map[int64]models.Node, edges map[int64][]models.Edge, stopNodes map[string][]int64) int64 {
+	var total float64
+
+	nodeEntry := float64(unsafe.Sizeof(int64(0)) + unsafe.Sizeof(models.Node{}) + 1)
+	for _, n := range nodes {
+		total += nodeEntry*mapOverhead +
+			float64(len(n.StopID)+len(n.StopName)+len(n.RouteID)+len(n.RouteName)+len(n.AgencyID)+len(n.Mode))
+	}
+
+	edgeListEntry := float64(unsafe.Sizeof(int64(0)) + unsafe.Sizeof([]models.Edge{}) + 1)
+	edgeSize := float64(unsafe.Sizeof(models.Edge{}))
+	for _, list := range edges {
+		total += edgeListEntry*mapOverhead + float64(cap(list))*edgeSize
+		for _, e := range list {
+			total += float64(len(e.Type) + len(e.TripID))
+		}
+	}
+
+	stopEntry := float64(unsafe.Sizeof("") + unsafe.Sizeof([]int64{}) + 1)
+	for stopID, ids := range stopNodes {
+		total += stopEntry*mapOverhead + float64(len(stopID)) + float64(cap(ids))*8
+	}
+
+	return int64(total)
+}
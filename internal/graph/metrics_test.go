@@ -0,0 +1,43 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShrank(t *testing.T) {
+	assert.False(t, shrank(0, 0, 0.2), "first load")
+	assert.False(t, shrank(1000, 850, 0.2))
+	assert.False(t, shrank(1000, 1500, 0.2))
+	assert.True(t, shrank(1000, 700, 0.2))
+	assert.False(t, shrank(1000, 10, 0), "disabled")
+}
+
+func TestShrinkThreshold(t *testing.T) {
+	assert.Equal(t, 0.2, shrinkThreshold())
+	t.Setenv("GRAPH_SHRINK_ALERT", "50")
+	assert.Equal(t, 0.5, shrinkThreshold())
+	t.Setenv("GRAPH_SHRINK_ALERT", "150")
+	assert.Equal(t, 0.2, shrinkThreshold())
+}
+
+func TestEstimateBytes(t *testing.T) {
+	nodes := map[int64]models.Node{}
+	edges := map[int64][]models.Edge{}
+	stopNodes := map[string][]int64{}
+
+	small := estimateBytes(nodes, edges, stopNodes)
+	for i := int64(0); i < 1000; i++ {
+		nodes[i] = models.Node{ID: i, StopID: "S1", StopName: "Place de l'Indépendance"}
+		edges[i] = []models.Edge{{FromNodeID: i, ToNodeID: i + 1, Type: "RIDE"}}
+		stopNodes["S1"] = append(stopNodes["S1"], i)
+	}
+	large := estimateBytes(nodes, edges, stopNodes)
+
+	assert.Zero(t, small)
+	// At least the structs themselves, at most a few times them
+	assert.Greater(t, large, int64(1000*(128+96)))
+	assert.Less(t, large, int64(1000*(128+96)*4))
+}
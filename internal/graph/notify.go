@@ -0,0 +1,168 @@
+package graph
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ReloadChannel is the PostgreSQL channel a rebuilt graph is announced on
+const ReloadChannel = "passbi_graph_reload"
+
+const (
+	// reloadDebounce lets a burst of notifications (several imports in a
+	// row) end in a single reload
+	reloadDebounce = 2 * time.Second
+	// listenRetryMax bounds the wait between attempts to listen again after
+	// the connection is lost
+	listenRetryMax = 30 * time.Second
+)
+
+// ReloadNotice is the payload of a notification on ReloadChannel
+type ReloadNotice struct {
+	Source   string `json:"source"` // "import", "rebuild" or "restore"
+	AgencyID string `json:"agency_id,omitempty"`
+	Instance string `json:"instance"` // process that sent it
+}
+
+// instanceID identifies this process, so it ignores its own notifications:
+// the process that rebuilt the graph has already reloaded it
+var instanceID = newInstanceID()
+
+func newInstanceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+var (
+	notifyReloads  atomic.Int64
+	notifyFailures atomic.Int64
+)
+
+// ReloadOnNotify reports whether API instances reload their graph when it is
+// rebuilt elsewhere, from GRAPH_RELOAD_ON_NOTIFY (default true)
+func ReloadOnNotify() bool {
+	if v := os.Getenv("GRAPH_RELOAD_ON_NOTIFY"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return true
+}
+
+// NotifyReload announces that the graph tables were rebuilt, so listening API
+// instances reload their in-memory graph
+// The notification is delivered when the caller's transaction commits, so
+// call it once the rebuild is committed
+func NotifyReload(ctx context.Context, pool *pgxpool.Pool, source, agencyID string) error {
+	payload, err := json.Marshal(ReloadNotice{Source: source, AgencyID: agencyID, Instance: instanceID})
+	if err != nil {
+		return err
+	}
+	_, err = pool.Exec(ctx, `SELECT pg_notify($1, $2)`, ReloadChannel, string(payload))
+	return err
+}
+
+// parseNotice decodes a notification payload; ok is false for notices this
+// process sent itself
+func parseNotice(payload string) (notice ReloadNotice, ok bool) {
+	if err := json.Unmarshal([]byte(payload), &notice); err != nil {
+		// Sent by hand (NOTIFY passbi_graph_reload): reload all the same
+		return ReloadNotice{Source: payload}, true
+	}
+	return notice, notice.Instance != instanceID
+}
+
+// ListenForReloads reloads the in-memory graph from pool whenever another
+// process announces a rebuild on ReloadChannel, then calls reloaded (when not
+// nil), until ctx is canceled
+// LISTEN holds a connection of the pool, which a transaction pooler cannot
+// provide: behind the Supabase pooler (port 6543) it logs a warning and returns
+func ListenForReloads(ctx context.Context, pool *pgxpool.Pool, reloaded func(context.Context, ReloadNotice)) {
+	if pool.Config().ConnConfig.Port == 6543 {
+		logger.WarnContext(ctx, "Graph reload notifications need a session connection; not listening behind the transaction pooler")
+		return
+	}
+
+	wait := time.Second
+	for {
+		err := listen(ctx, pool, reloaded)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.WarnContext(ctx, "Graph reload listener lost its connection, retrying",
+			"error", err, "retry_in", wait.String())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, listenRetryMax)
+	}
+}
+
+// listen runs one LISTEN session until its connection fails
+func listen(ctx context.Context, pool *pgxpool.Pool, reloaded func(context.Context, ReloadNotice)) error {
+	pooled, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The session's LISTEN must not follow the connection back into the pool
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+ReloadChannel); err != nil {
+		return err
+	}
+	logger.InfoContext(ctx, "Listening for graph reload notifications", "channel", ReloadChannel)
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		notice, ok := parseNotice(n.Payload)
+		if !ok {
+			continue
+		}
+
+		// Later notifications of the burst are covered by this reload
+		for {
+			wait, cancel := context.WithTimeout(ctx, reloadDebounce)
+			_, err := conn.WaitForNotification(wait)
+			cancel()
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if !errors.Is(err, context.DeadlineExceeded) {
+					return err
+				}
+				break
+			}
+		}
+
+		logger.InfoContext(ctx, "Graph rebuilt elsewhere, reloading",
+			"source", notice.Source, "agency_id", notice.AgencyID)
+		if err := GetGraph().LoadFromDB(ctx, pool); err != nil {
+			notifyFailures.Add(1)
+			logger.ErrorContext(ctx, "Graph reload on notification failed", "error", err)
+			continue
+		}
+		notifyReloads.Add(1)
+		if reloaded != nil {
+			reloaded(ctx, notice)
+		}
+	}
+}
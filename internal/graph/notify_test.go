@@ -0,0 +1,38 @@
+package graph
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNotice(t *testing.T) {
+	own, _ := json.Marshal(ReloadNotice{Source: "import", AgencyID: "ddd", Instance: instanceID})
+	_, ok := parseNotice(string(own))
+	assert.False(t, ok, "a process ignores its own notices")
+
+	other, _ := json.Marshal(ReloadNotice{Source: "import", AgencyID: "ddd", Instance: "elsewhere"})
+	notice, ok := parseNotice(string(other))
+	assert.True(t, ok)
+	assert.Equal(t, "import", notice.Source)
+	assert.Equal(t, "ddd", notice.AgencyID)
+
+	// NOTIFY passbi_graph_reload, 'manual' from psql
+	notice, ok = parseNotice("manual")
+	assert.True(t, ok)
+	assert.Equal(t, "manual", notice.Source)
+
+	notice, ok = parseNotice("")
+	assert.True(t, ok)
+	assert.Equal(t, "", notice.Source)
+}
+
+func TestReloadOnNotify(t *testing.T) {
+	t.Setenv("GRAPH_RELOAD_ON_NOTIFY", "")
+	assert.True(t, ReloadOnNotify())
+	t.Setenv("GRAPH_RELOAD_ON_NOTIFY", "false")
+	assert.False(t, ReloadOnNotify())
+	t.Setenv("GRAPH_RELOAD_ON_NOTIFY", "nope")
+	assert.True(t, ReloadOnNotify())
+}
@@ -0,0 +1,45 @@
+package graph
+
+import (
+	"os"
+	"strconv"
+)
+
+// Defaults of the settings the graph is built with; a change takes effect
+// once the graph is rebuilt
+const (
+	defaultMaxWalkDistance = 500.0 // meters
+	defaultWalkingSpeed    = 1.4   // meters per second
+	defaultTransferTime    = 180   // seconds (3 minutes)
+)
+
+// maxWalkDistance reads MAX_WALK_DISTANCE, the farthest apart two stops get
+// a WALK edge, in meters
+func maxWalkDistance() float64 {
+	if v := os.Getenv("MAX_WALK_DISTANCE"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f > 0 {
+			return f
+		}
+	}
+	return defaultMaxWalkDistance
+}
+
+// walkingSpeed reads WALKING_SPEED, in meters per second
+func walkingSpeed() float64 {
+	if v := os.Getenv("WALKING_SPEED"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f > 0 {
+			return f
+		}
+	}
+	return defaultWalkingSpeed
+}
+
+// transferTime reads TRANSFER_TIME, the cost of a TRANSFER edge in seconds
+func transferTime() int {
+	if v := os.Getenv("TRANSFER_TIME"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return defaultTransferTime
+}
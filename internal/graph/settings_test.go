@@ -0,0 +1,19 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettings(t *testing.T) {
+	assert.Equal(t, 500.0, maxWalkDistance())
+	assert.Equal(t, 72, WalkSeconds(100))
+
+	t.Setenv("MAX_WALK_DISTANCE", "800")
+	t.Setenv("WALKING_SPEED", "1")
+	t.Setenv("TRANSFER_TIME", "-5")
+	assert.Equal(t, 800.0, maxWalkDistance())
+	assert.Equal(t, 100, WalkSeconds(100))
+	assert.Equal(t, 180, transferTime(), "a negative time is ignored")
+}
@@ -0,0 +1,188 @@
+package gtfs
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/models"
+)
+
+// DemoOptions shapes the synthetic city of GenerateDemo
+type DemoOptions struct {
+	AgencyID  string
+	Rows      int     // streets running west-east
+	Cols      int     // avenues running south-north
+	SpacingM  float64 // between neighbouring stops
+	OriginLat float64 // south-west corner
+	OriginLon float64
+	Headway   time.Duration // weekdays; doubled on weekends
+	FirstTrip time.Duration // since midnight
+	LastTrip  time.Duration
+	StartDate time.Time // services run for a year from it
+}
+
+// DefaultDemoOptions is a 7x7 grid city in Dakar
+func DefaultDemoOptions() DemoOptions {
+	return DemoOptions{
+		AgencyID:  "gridcity",
+		Rows:      7,
+		Cols:      7,
+		SpacingM:  400,
+		OriginLat: 14.6800,
+		OriginLon: -17.4700,
+		Headway:   15 * time.Minute,
+		FirstTrip: 6 * time.Hour,
+		LastTrip:  22 * time.Hour,
+		StartDate: time.Now().UTC().Truncate(24 * time.Hour),
+	}
+}
+
+// Bus and rail speeds of the demo feed, in m/s
+const (
+	demoBusSpeed  = 5.5  // ~20 km/h
+	demoRailSpeed = 13.9 // ~50 km/h
+)
+
+// GenerateDemo builds a small synthetic feed: a grid of stops, a bus line
+// along every other street and avenue and the last ones, and a rail line
+// along the diagonal stopping at every other crossing
+// The feed depends on the options only, so tests and CI can rely on it
+func GenerateDemo(opts DemoOptions) (*GTFSFeed, error) {
+	if opts.Rows < 2 || opts.Cols < 2 {
+		return nil, fmt.Errorf("the grid needs at least 2x2 stops, got %dx%d", opts.Rows, opts.Cols)
+	}
+	if opts.SpacingM <= 0 || opts.Headway <= 0 || opts.LastTrip < opts.FirstTrip {
+		return nil, fmt.Errorf("invalid spacing, headway or service hours")
+	}
+	if opts.AgencyID == "" {
+		return nil, fmt.Errorf("an agency ID is required")
+	}
+
+	feed := &GTFSFeed{
+		Agencies: []models.GTFSAgency{{
+			AgencyID: opts.AgencyID, AgencyName: "Grid City Transit",
+			AgencyURL: "https://example.com", Timezone: "Africa/Dakar",
+		}},
+	}
+
+	// Degrees per meter at the origin
+	dLat := 1 / 111320.0
+	dLon := 1 / (111320.0 * math.Cos(opts.OriginLat*math.Pi/180))
+	stopID := func(row, col int) string { return fmt.Sprintf("S%02d%02d", row, col) }
+	for row := 0; row < opts.Rows; row++ {
+		for col := 0; col < opts.Cols; col++ {
+			feed.Stops = append(feed.Stops, models.GTFSStop{
+				StopID:   stopID(row, col),
+				StopName: fmt.Sprintf("Avenue %c / Rue %d", 'A'+col%26, row+1),
+				Lat:      opts.OriginLat + float64(row)*opts.SpacingM*dLat,
+				Lon:      opts.OriginLon + float64(col)*opts.SpacingM*dLon,
+			})
+		}
+	}
+
+	type line struct {
+		route models.GTFSRoute
+		stops []string
+		hopS  int // seconds between consecutive stops
+	}
+	busHop := int(opts.SpacingM / demoBusSpeed)
+	var lines []line
+	for _, row := range lineIndexes(opts.Rows) {
+		l := line{route: models.GTFSRoute{RouteID: fmt.Sprintf("R%d", row+1), AgencyID: opts.AgencyID,
+			ShortName: fmt.Sprintf("R%d", row+1), LongName: fmt.Sprintf("Rue %d", row+1), RouteType: 3, RouteColor: "1E88E5"}, hopS: busHop}
+		for col := 0; col < opts.Cols; col++ {
+			l.stops = append(l.stops, stopID(row, col))
+		}
+		lines = append(lines, l)
+	}
+	for _, col := range lineIndexes(opts.Cols) {
+		l := line{route: models.GTFSRoute{RouteID: fmt.Sprintf("A%c", 'A'+col%26), AgencyID: opts.AgencyID,
+			ShortName: fmt.Sprintf("A%c", 'A'+col%26), LongName: fmt.Sprintf("Avenue %c", 'A'+col%26), RouteType: 3, RouteColor: "43A047"}, hopS: busHop}
+		for row := 0; row < opts.Rows; row++ {
+			l.stops = append(l.stops, stopID(row, col))
+		}
+		lines = append(lines, l)
+	}
+	rail := line{route: models.GTFSRoute{RouteID: "X", AgencyID: opts.AgencyID,
+		ShortName: "X", LongName: "Diagonal Express", RouteType: 2, RouteColor: "E53935"},
+		hopS: int(2 * math.Sqrt2 * opts.SpacingM / demoRailSpeed)}
+	for i := 0; i < min(opts.Rows, opts.Cols); i += 2 {
+		rail.stops = append(rail.stops, stopID(i, i))
+	}
+	if len(rail.stops) >= 2 {
+		lines = append(lines, rail)
+	}
+
+	start := opts.StartDate.Format("20060102")
+	end := opts.StartDate.AddDate(1, 0, 0).Format("20060102")
+	services := []struct {
+		id      string
+		headway time.Duration
+	}{{"WEEK", opts.Headway}, {"WKND", 2 * opts.Headway}}
+	feed.Calendars = []models.GTFSCalendar{
+		{ServiceID: "WEEK", Monday: true, Tuesday: true, Wednesday: true, Thursday: true, Friday: true, StartDate: start, EndDate: end},
+		{ServiceID: "WKND", Saturday: true, Sunday: true, StartDate: start, EndDate: end},
+	}
+
+	for _, l := range lines {
+		feed.Routes = append(feed.Routes, l.route)
+		for direction := 0; direction < 2; direction++ {
+			stops := l.stops
+			if direction == 1 {
+				stops = reversed(stops)
+			}
+			headsign := stopName(feed.Stops, stops[len(stops)-1])
+			for _, svc := range services {
+				for dep := opts.FirstTrip; dep <= opts.LastTrip; dep += svc.headway {
+					tripID := fmt.Sprintf("%s-%d-%s-%s", l.route.RouteID, direction, svc.id, gtfsTime(dep)[:5])
+					feed.Trips = append(feed.Trips, models.GTFSTrip{RouteID: l.route.RouteID, ServiceID: svc.id,
+						TripID: tripID, Headsign: headsign, Direction: direction})
+					for i, s := range stops {
+						t := gtfsTime(dep + time.Duration(i*l.hopS)*time.Second)
+						feed.StopTimes = append(feed.StopTimes, models.GTFSStopTime{TripID: tripID,
+							ArrivalTime: t, DepartureTime: t, StopID: s, StopSequence: i + 1})
+					}
+				}
+			}
+		}
+	}
+	return feed, nil
+}
+
+// lineIndexes returns every other index of n and the last one, so every stop
+// is at most a block from a line and the corners are served
+func lineIndexes(n int) []int {
+	var indexes []int
+	for i := 0; i < n; i += 2 {
+		indexes = append(indexes, i)
+	}
+	if indexes[len(indexes)-1] != n-1 {
+		indexes = append(indexes, n-1)
+	}
+	return indexes
+}
+
+func reversed(s []string) []string {
+	r := make([]string, len(s))
+	for i, v := range s {
+		r[len(s)-1-i] = v
+	}
+	return r
+}
+
+func stopName(stops []models.GTFSStop, stopID string) string {
+	for _, s := range stops {
+		if s.StopID == stopID {
+			return s.StopName
+		}
+	}
+	return stopID
+}
+
+// gtfsTime formats a time since midnight as HH:MM:SS, past 24:00 after
+// midnight as GTFS does
+func gtfsTime(d time.Duration) string {
+	s := int(d / time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", s/3600, s/60%60, s%60)
+}
@@ -0,0 +1,60 @@
+package gtfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateDemo(t *testing.T) {
+	opts := DefaultDemoOptions()
+	opts.StartDate = time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+	feed, err := GenerateDemo(opts)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Len(t, feed.Stops, 49)
+	assert.Len(t, feed.Routes, 9) // 4 streets, 4 avenues, the express
+	assert.Equal(t, "R7", feed.Routes[3].RouteID)
+	assert.Equal(t, "X", feed.Routes[8].RouteID)
+	assert.Equal(t, "20260105", feed.Calendars[0].StartDate)
+	assert.Equal(t, "20270105", feed.Calendars[0].EndDate)
+	// 65 weekday and 33 weekend departures each way
+	assert.Len(t, feed.Trips, 9*2*(65+33))
+	assert.Equal(t, "R1-0-WEEK-06:00", feed.Trips[0].TripID)
+	assert.Equal(t, "06:00:00", feed.StopTimes[0].DepartureTime)
+	assert.Equal(t, "06:01:12", feed.StopTimes[1].ArrivalTime) // 400 m at 5.5 m/s
+
+	again, _ := GenerateDemo(opts)
+	assert.Equal(t, feed, again)
+
+	assert.Equal(t, []int{0, 2, 4, 5}, lineIndexes(6))
+	_, err = GenerateDemo(DemoOptions{Rows: 1, Cols: 4})
+	assert.Error(t, err)
+
+	// ParseGTFSZip reads back what WriteZip wrote
+	path := filepath.Join(t.TempDir(), "demo.zip")
+	f, err := os.Create(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, WriteZip(f, feed))
+	assert.NoError(t, f.Close())
+
+	parsed, err := ParseGTFSZip(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, feed.Agencies, parsed.Agencies)
+	assert.Equal(t, feed.Stops[7].StopID, parsed.Stops[7].StopID)
+	assert.InDelta(t, feed.Stops[7].Lat, parsed.Stops[7].Lat, 1e-6)
+	assert.Equal(t, feed.Routes, parsed.Routes)
+	assert.Equal(t, feed.Trips, parsed.Trips)
+	assert.Equal(t, feed.StopTimes, parsed.StopTimes)
+	assert.Equal(t, feed.Calendars, parsed.Calendars)
+	assert.Empty(t, parsed.CalendarDates)
+}
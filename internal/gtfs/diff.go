@@ -0,0 +1,325 @@
+package gtfs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/passbi/passbi_core/internal/models"
+)
+
+// stopMoveThresholdM is how far a stop must move to be reported as changed
+const stopMoveThresholdM = 10
+
+// FeedDiff is what replacing a feed with a new one changes, for review before
+// an import
+type FeedDiff struct {
+	Stops    EntityDiff `json:"stops"`
+	Routes   EntityDiff `json:"routes"`
+	Trips    EntityDiff `json:"trips"`
+	Services EntityDiff `json:"services"`
+	// RouteService lists the routes whose trip count or span of day changed
+	RouteService []RouteService `json:"route_service"`
+	OldSpan      DateSpan       `json:"old_span"`
+	NewSpan      DateSpan       `json:"new_span"`
+}
+
+// EntityDiff is the IDs of a table added, removed and changed, sorted
+type EntityDiff struct {
+	Added     []string `json:"added"`
+	Removed   []string `json:"removed"`
+	Changed   []Change `json:"changed"`
+	Unchanged int      `json:"unchanged"`
+}
+
+// Change is a record present in both feeds and how it differs
+type Change struct {
+	ID      string   `json:"id"`
+	Details []string `json:"details"`
+}
+
+// RouteService is a route's trips and span of day in both feeds; an empty
+// span when the feed has no trip of the route
+type RouteService struct {
+	RouteID  string `json:"route_id"`
+	OldTrips int    `json:"old_trips"`
+	NewTrips int    `json:"new_trips"`
+	OldFirst string `json:"old_first,omitempty"`
+	OldLast  string `json:"old_last,omitempty"`
+	NewFirst string `json:"new_first,omitempty"`
+	NewLast  string `json:"new_last,omitempty"`
+}
+
+// DateSpan is the first and last day a feed has service, YYYYMMDD
+type DateSpan struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// Empty reports whether the diff has no change
+func (d *FeedDiff) Empty() bool {
+	for _, e := range []EntityDiff{d.Stops, d.Routes, d.Trips, d.Services} {
+		if len(e.Added)+len(e.Removed)+len(e.Changed) > 0 {
+			return false
+		}
+	}
+	return len(d.RouteService) == 0 && d.OldSpan == d.NewSpan
+}
+
+// Diff compares two parsed feeds
+func Diff(old, new *GTFSFeed) *FeedDiff {
+	d := &FeedDiff{OldSpan: serviceSpan(old), NewSpan: serviceSpan(new)}
+
+	d.Stops = diffEntities(keyed(old.Stops, func(s models.GTFSStop) string { return s.StopID }),
+		keyed(new.Stops, func(s models.GTFSStop) string { return s.StopID }),
+		func(a, b models.GTFSStop) []string {
+			var details []string
+			details = appendChange(details, "name", a.StopName, b.StopName)
+			if m := haversineDistance(a.Lat, a.Lon, b.Lat, b.Lon); m > stopMoveThresholdM {
+				details = append(details, fmt.Sprintf("moved %.0f m", m))
+			}
+			return details
+		})
+
+	d.Routes = diffEntities(keyed(old.Routes, func(r models.GTFSRoute) string { return r.RouteID }),
+		keyed(new.Routes, func(r models.GTFSRoute) string { return r.RouteID }),
+		func(a, b models.GTFSRoute) []string {
+			var details []string
+			details = appendChange(details, "short name", a.ShortName, b.ShortName)
+			details = appendChange(details, "long name", a.LongName, b.LongName)
+			details = appendChange(details, "agency", a.AgencyID, b.AgencyID)
+			details = appendChange(details, "type", fmt.Sprint(a.RouteType), fmt.Sprint(b.RouteType))
+			details = appendChange(details, "color", a.RouteColor, b.RouteColor)
+			return details
+		})
+
+	oldTrips, newTrips := tripsOf(old), tripsOf(new)
+	d.Trips = diffEntities(oldTrips, newTrips, func(a, b feedTrip) []string {
+		var details []string
+		details = appendChange(details, "route", a.RouteID, b.RouteID)
+		details = appendChange(details, "service", a.ServiceID, b.ServiceID)
+		details = appendChange(details, "headsign", a.Headsign, b.Headsign)
+		details = appendChange(details, "direction", fmt.Sprint(a.Direction), fmt.Sprint(b.Direction))
+		if strings.Join(a.stops, ",") != strings.Join(b.stops, ",") {
+			details = append(details, fmt.Sprintf("stops: %d -> %d, pattern changed", len(a.stops), len(b.stops)))
+		} else if strings.Join(a.times, ",") != strings.Join(b.times, ",") {
+			details = append(details, fmt.Sprintf("times: %s-%s -> %s-%s", a.first(), a.last(), b.first(), b.last()))
+		}
+		return details
+	})
+
+	d.Services = diffEntities(servicesOf(old), servicesOf(new), func(a, b feedService) []string {
+		var details []string
+		details = appendChange(details, "days", a.days, b.days)
+		details = appendChange(details, "start", a.start, b.start)
+		details = appendChange(details, "end", a.end, b.end)
+		details = appendChange(details, "added dates", fmt.Sprint(a.added), fmt.Sprint(b.added))
+		details = appendChange(details, "removed dates", fmt.Sprint(a.removed), fmt.Sprint(b.removed))
+		return details
+	})
+
+	d.RouteService = diffRouteService(oldTrips, newTrips)
+	return d
+}
+
+// diffEntities compares two tables keyed by ID; changed returns the
+// differences of a record present in both, none when it is unchanged
+func diffEntities[T any](old, new map[string]T, changed func(a, b T) []string) EntityDiff {
+	d := EntityDiff{Added: []string{}, Removed: []string{}, Changed: []Change{}}
+	for id, a := range old {
+		b, ok := new[id]
+		if !ok {
+			d.Removed = append(d.Removed, id)
+			continue
+		}
+		if details := changed(a, b); len(details) > 0 {
+			d.Changed = append(d.Changed, Change{ID: id, Details: details})
+		} else {
+			d.Unchanged++
+		}
+	}
+	for id := range new {
+		if _, ok := old[id]; !ok {
+			d.Added = append(d.Added, id)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Slice(d.Changed, func(i, j int) bool { return d.Changed[i].ID < d.Changed[j].ID })
+	return d
+}
+
+func keyed[T any](records []T, id func(T) string) map[string]T {
+	m := make(map[string]T, len(records))
+	for _, r := range records {
+		m[id(r)] = r
+	}
+	return m
+}
+
+func appendChange(details []string, field, a, b string) []string {
+	if a == b {
+		return details
+	}
+	return append(details, fmt.Sprintf("%s: %q -> %q", field, a, b))
+}
+
+// feedTrip is a trip with its stops and departure times in sequence
+type feedTrip struct {
+	models.GTFSTrip
+	stops []string
+	times []string
+}
+
+func (t feedTrip) first() string {
+	if len(t.times) == 0 {
+		return ""
+	}
+	return t.times[0]
+}
+
+func (t feedTrip) last() string {
+	if len(t.times) == 0 {
+		return ""
+	}
+	return t.times[len(t.times)-1]
+}
+
+func tripsOf(feed *GTFSFeed) map[string]feedTrip {
+	trips := make(map[string]feedTrip, len(feed.Trips))
+	for _, t := range feed.Trips {
+		trips[t.TripID] = feedTrip{GTFSTrip: t}
+	}
+	byTrip := make(map[string][]models.GTFSStopTime)
+	for _, st := range feed.StopTimes {
+		byTrip[st.TripID] = append(byTrip[st.TripID], st)
+	}
+	for tripID, sts := range byTrip {
+		t, ok := trips[tripID]
+		if !ok {
+			continue
+		}
+		sort.Slice(sts, func(i, j int) bool { return sts[i].StopSequence < sts[j].StopSequence })
+		for _, st := range sts {
+			t.stops = append(t.stops, st.StopID)
+			t.times = append(t.times, firstNonEmptyTime(st.DepartureTime, st.ArrivalTime))
+		}
+		trips[tripID] = t
+	}
+	return trips
+}
+
+func firstNonEmptyTime(times ...string) string {
+	for _, t := range times {
+		if t != "" {
+			return t
+		}
+	}
+	return ""
+}
+
+// feedService is a service's calendar and exceptions
+type feedService struct {
+	days           string // e.g. "MTWTF--"
+	start, end     string
+	added, removed int
+}
+
+func servicesOf(feed *GTFSFeed) map[string]feedService {
+	services := make(map[string]feedService)
+	for _, c := range feed.Calendars {
+		days := []byte("-------")
+		for i, on := range []bool{c.Monday, c.Tuesday, c.Wednesday, c.Thursday, c.Friday, c.Saturday, c.Sunday} {
+			if on {
+				days[i] = "MTWTFSS"[i]
+			}
+		}
+		s := services[c.ServiceID]
+		s.days, s.start, s.end = string(days), c.StartDate, c.EndDate
+		services[c.ServiceID] = s
+	}
+	for _, cd := range feed.CalendarDates {
+		s := services[cd.ServiceID]
+		if cd.ExceptionType == 1 {
+			s.added++
+		} else {
+			s.removed++
+		}
+		services[cd.ServiceID] = s
+	}
+	return services
+}
+
+// serviceSpan is the first and last day of calendar.txt, extended by the
+// dates calendar_dates.txt adds
+func serviceSpan(feed *GTFSFeed) DateSpan {
+	var span DateSpan
+	extend := func(start, end string) {
+		if start != "" && (span.Start == "" || start < span.Start) {
+			span.Start = start
+		}
+		if end != "" && end > span.End {
+			span.End = end
+		}
+	}
+	for _, c := range feed.Calendars {
+		extend(c.StartDate, c.EndDate)
+	}
+	for _, cd := range feed.CalendarDates {
+		if cd.ExceptionType == 1 {
+			extend(cd.Date, cd.Date)
+		}
+	}
+	return span
+}
+
+// diffRouteService compares each route's trip count and first and last
+// departure
+func diffRouteService(old, new map[string]feedTrip) []RouteService {
+	type side struct {
+		trips       *int
+		first, last *string
+	}
+	byRoute := make(map[string]*RouteService)
+	tally := func(trips map[string]feedTrip, of func(*RouteService) side) {
+		for _, t := range trips {
+			rs, ok := byRoute[t.RouteID]
+			if !ok {
+				rs = &RouteService{RouteID: t.RouteID}
+				byRoute[t.RouteID] = rs
+			}
+			s := of(rs)
+			*s.trips++
+			if dep := t.first(); dep != "" {
+				if *s.first == "" || compareTimes(dep, *s.first) < 0 {
+					*s.first = dep
+				}
+				if *s.last == "" || compareTimes(dep, *s.last) > 0 {
+					*s.last = dep
+				}
+			}
+		}
+	}
+	tally(old, func(rs *RouteService) side { return side{&rs.OldTrips, &rs.OldFirst, &rs.OldLast} })
+	tally(new, func(rs *RouteService) side { return side{&rs.NewTrips, &rs.NewFirst, &rs.NewLast} })
+
+	var changed []RouteService
+	for _, rs := range byRoute {
+		if rs.OldTrips != rs.NewTrips || rs.OldFirst != rs.NewFirst || rs.OldLast != rs.NewLast {
+			changed = append(changed, *rs)
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].RouteID < changed[j].RouteID })
+	return changed
+}
+
+// compareTimes orders GTFS times, which may be past 24:00 and lack a leading
+// zero
+func compareTimes(a, b string) int {
+	sa, errA := ParseTimeToSeconds(a)
+	sb, errB := ParseTimeToSeconds(b)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	return sa - sb
+}
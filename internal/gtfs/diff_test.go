@@ -0,0 +1,74 @@
+package gtfs
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	opts := DefaultDemoOptions()
+	opts.StartDate = time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+	old, _ := GenerateDemo(opts)
+	assert.True(t, Diff(old, old).Empty())
+
+	next, _ := GenerateDemo(opts)
+	next.Stops[0].StopName = "Place de l'Indépendance"
+	next.Stops[1].Lat += 0.001 // ~111 m north
+	next.Stops[2].Lon += 0.00001
+	next.Stops = append(next.Stops, models.GTFSStop{StopID: "S9999", StopName: "Port", Lat: 14.67, Lon: -17.43})
+	next.Routes[8].RouteColor = "000000"
+	next.Calendars[0].EndDate = "20270701"
+	next.CalendarDates = append(next.CalendarDates, models.GTFSCalendarDate{ServiceID: "WKND", Date: "20270801", ExceptionType: 1})
+
+	// The express loses its trips from 21:00 towards the north-east, and its
+	// first one leaves 5 minutes later
+	var trips []models.GTFSTrip
+	for _, trip := range next.Trips {
+		if !strings.HasPrefix(trip.TripID, "X-0-") || trip.TripID[len(trip.TripID)-5:] < "21:00" {
+			trips = append(trips, trip)
+		}
+	}
+	next.Trips = trips
+	for i, st := range next.StopTimes {
+		if st.TripID == "X-0-WEEK-06:00" {
+			secs, _ := ParseTimeToSeconds(st.DepartureTime)
+			next.StopTimes[i].DepartureTime = gtfsTime(time.Duration(secs)*time.Second + 5*time.Minute)
+		}
+	}
+
+	d := Diff(old, next)
+	assert.False(t, d.Empty())
+	assert.Equal(t, []string{"S9999"}, d.Stops.Added)
+	assert.Empty(t, d.Stops.Removed)
+	if assert.Len(t, d.Stops.Changed, 2) {
+		assert.Equal(t, Change{ID: "S0000", Details: []string{`name: "Avenue A / Rue 1" -> "Place de l'Indépendance"`}}, d.Stops.Changed[0])
+		assert.Equal(t, Change{ID: "S0001", Details: []string{"moved 111 m"}}, d.Stops.Changed[1])
+	}
+	assert.Equal(t, 47, d.Stops.Unchanged) // S0002 moved ~1 m
+
+	if assert.Len(t, d.Routes.Changed, 1) {
+		assert.Equal(t, []string{`color: "E53935" -> "000000"`}, d.Routes.Changed[0].Details)
+	}
+
+	assert.Equal(t, []string{"X-0-WEEK-21:00", "X-0-WEEK-21:15", "X-0-WEEK-21:30", "X-0-WEEK-21:45", "X-0-WEEK-22:00", "X-0-WKND-21:00", "X-0-WKND-21:30", "X-0-WKND-22:00"}, d.Trips.Removed)
+	if assert.Len(t, d.Trips.Changed, 1) {
+		assert.Equal(t, "X-0-WEEK-06:00", d.Trips.Changed[0].ID)
+		assert.Equal(t, []string{"times: 06:00:00-06:04:03 -> 06:05:00-06:09:03"}, d.Trips.Changed[0].Details)
+	}
+
+	if assert.Len(t, d.Services.Changed, 2) {
+		assert.Equal(t, []string{`end: "20270105" -> "20270701"`}, d.Services.Changed[0].Details)
+		assert.Equal(t, []string{`added dates: "0" -> "1"`}, d.Services.Changed[1].Details)
+	}
+	assert.Equal(t, DateSpan{"20260105", "20270105"}, d.OldSpan)
+	assert.Equal(t, DateSpan{"20260105", "20270801"}, d.NewSpan)
+
+	if assert.Len(t, d.RouteService, 1) {
+		assert.Equal(t, RouteService{RouteID: "X", OldTrips: 196, NewTrips: 188,
+			OldFirst: "06:00:00", OldLast: "22:00:00", NewFirst: "06:00:00", NewLast: "22:00:00"}, d.RouteService[0])
+	}
+}
@@ -3,7 +3,6 @@ package gtfs
 import (
 	"context"
 	"fmt"
-	"log"
 	"math"
 	"strings"
 
@@ -82,16 +81,16 @@ func DeduplicateStops(ctx context.Context, db *pgxpool.Pool, stops []models.GTFS
 			)
 
 			if distance < thresholdMeters {
-				log.Printf("Deduplicating stop %s (duplicate of %s, distance: %.2fm)",
-					stops[j].StopID, currentStop.StopID, distance)
+				logger.Debug("Deduplicating stop", "stop_id", stops[j].StopID,
+					"duplicate_of", currentStop.StopID, "distance_m", distance)
 				skipIndices[j] = true
 				stopMapping[stops[j].StopID] = currentStop.StopID // map duplicate to original
 			}
 		}
 	}
 
-	log.Printf("Deduplicated %d stops to %d (removed %d duplicates)",
-		len(stops), len(deduplicated), len(stops)-len(deduplicated))
+	logger.Info("Deduplicated stops", "stops", len(stops), "kept", len(deduplicated),
+		"removed", len(stops)-len(deduplicated))
 
 	return deduplicated, stopMapping, nil
 }
@@ -166,7 +165,7 @@ func InterpolateStopTimes(stopTimes []models.GTFSStopTime) []models.GTFSStopTime
 		}
 
 		if firstValid == -1 || lastValid == -1 {
-			log.Printf("Warning: trip %s has no valid times, skipping interpolation", tripID)
+			logger.Warn("Trip has no valid times, skipping interpolation", "trip_id", tripID)
 			interpolated = append(interpolated, times...)
 			continue
 		}
@@ -220,15 +219,15 @@ func ValidateAndCleanStops(stops []models.GTFSStop) []models.GTFSStop {
 	for _, stop := range stops {
 		// Check for valid coordinates
 		if stop.Lat < -90 || stop.Lat > 90 {
-			log.Printf("Warning: invalid latitude for stop %s: %f", stop.StopID, stop.Lat)
+			logger.Warn("Invalid stop latitude", "stop_id", stop.StopID, "lat", stop.Lat)
 			continue
 		}
 		if stop.Lon < -180 || stop.Lon > 180 {
-			log.Printf("Warning: invalid longitude for stop %s: %f", stop.StopID, stop.Lon)
+			logger.Warn("Invalid stop longitude", "stop_id", stop.StopID, "lon", stop.Lon)
 			continue
 		}
 		if stop.Lat == 0 && stop.Lon == 0 {
-			log.Printf("Warning: stop %s has null island coordinates, skipping", stop.StopID)
+			logger.Warn("Stop has null island coordinates, skipping", "stop_id", stop.StopID)
 			continue
 		}
 
@@ -236,8 +235,67 @@ func ValidateAndCleanStops(stops []models.GTFSStop) []models.GTFSStop {
 	}
 
 	if len(cleaned) < len(stops) {
-		log.Printf("Cleaned stops: removed %d invalid stops", len(stops)-len(cleaned))
+		logger.Info("Cleaned stops", "removed", len(stops)-len(cleaned))
 	}
 
 	return cleaned
 }
+
+// translatedFields lists the translations.txt fields PassBi serves
+var translatedFields = map[string]map[string]bool{
+	"stops":  {"stop_name": true},
+	"routes": {"route_short_name": true, "route_long_name": true},
+}
+
+// ResolveTranslations keeps the stop and route name translations and keys
+// them all by record_id; rows given by field_value are expanded to every
+// record of the feed whose field currently holds that value
+// Languages are reduced to their lowercase primary subtag (wo-SN -> wo)
+func ResolveTranslations(translations []models.GTFSTranslation, stops []models.GTFSStop, routes []models.GTFSRoute) []models.GTFSTranslation {
+	var resolved []models.GTFSTranslation
+
+	for _, tr := range translations {
+		if !translatedFields[tr.TableName][tr.FieldName] {
+			continue
+		}
+
+		tr.Language = strings.ToLower(strings.SplitN(tr.Language, "-", 2)[0])
+		if tr.RecordID != "" {
+			tr.FieldValue = ""
+			resolved = append(resolved, tr)
+			continue
+		}
+
+		for _, id := range recordsWithValue(tr.TableName, tr.FieldName, tr.FieldValue, stops, routes) {
+			expanded := tr
+			expanded.RecordID = id
+			expanded.FieldValue = ""
+			resolved = append(resolved, expanded)
+		}
+	}
+
+	return resolved
+}
+
+// recordsWithValue returns the IDs of the stops or routes whose field equals value
+func recordsWithValue(table, field, value string, stops []models.GTFSStop, routes []models.GTFSRoute) []string {
+	var ids []string
+
+	switch table {
+	case "stops":
+		for _, s := range stops {
+			if s.StopName == value {
+				ids = append(ids, s.StopID)
+			}
+		}
+	case "routes":
+		for _, r := range routes {
+			if (field == "route_short_name" && r.ShortName == value) ||
+				(field == "route_long_name" && r.LongName == value) {
+				ids = append(ids, r.RouteID)
+			}
+		}
+	}
+
+	return ids
+}
@@ -201,3 +201,30 @@ func TestValidateAndCleanStops(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveTranslations(t *testing.T) {
+	stops := []models.GTFSStop{
+		{StopID: "S1", StopName: "Gare Routière"},
+		{StopID: "S2", StopName: "Gare Routière"},
+		{StopID: "S3", StopName: "Colobane"},
+	}
+	routes := []models.GTFSRoute{
+		{RouteID: "R1", ShortName: "7", LongName: "Ligne 7"},
+	}
+
+	translations := []models.GTFSTranslation{
+		{TableName: "stops", FieldName: "stop_name", Language: "en", Translation: "Bus Station", FieldValue: "Gare Routière"},
+		{TableName: "stops", FieldName: "stop_name", Language: "wo-SN", Translation: "Kolobaan", RecordID: "S3"},
+		{TableName: "routes", FieldName: "route_long_name", Language: "EN", Translation: "Line 7", FieldValue: "Ligne 7"},
+		{TableName: "agency", FieldName: "agency_name", Language: "en", Translation: "Dakar Dem Dikk", RecordID: "DDD"},
+	}
+
+	resolved := ResolveTranslations(translations, stops, routes)
+
+	assert.Equal(t, []models.GTFSTranslation{
+		{TableName: "stops", FieldName: "stop_name", Language: "en", Translation: "Bus Station", RecordID: "S1"},
+		{TableName: "stops", FieldName: "stop_name", Language: "en", Translation: "Bus Station", RecordID: "S2"},
+		{TableName: "stops", FieldName: "stop_name", Language: "wo", Translation: "Kolobaan", RecordID: "S3"},
+		{TableName: "routes", FieldName: "route_long_name", Language: "en", Translation: "Line 7", RecordID: "R1"},
+	}, resolved)
+}
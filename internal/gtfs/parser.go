@@ -5,15 +5,17 @@ import (
 	"encoding/csv"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 
+	"github.com/passbi/passbi_core/internal/logging"
 	"github.com/passbi/passbi_core/internal/models"
 )
 
+var logger = logging.For("gtfs")
+
 // GTFSFeed represents a parsed GTFS feed
 type GTFSFeed struct {
 	Agencies      []models.GTFSAgency
@@ -23,6 +25,8 @@ type GTFSFeed struct {
 	StopTimes     []models.GTFSStopTime
 	Calendars     []models.GTFSCalendar
 	CalendarDates []models.GTFSCalendarDate
+	Translations  []models.GTFSTranslation
+	Shapes        []models.GTFSShapePoint
 }
 
 // ParseGTFSZip extracts and parses a GTFS ZIP file
@@ -45,9 +49,9 @@ func ParseGTFSZip(zipPath string) (*GTFSFeed, error) {
 	// Parse agencies (optional)
 	if agencies, err := ParseAgencies(filepath.Join(tempDir, "agency.txt")); err == nil {
 		feed.Agencies = agencies
-		log.Printf("Parsed %d agencies", len(agencies))
+		logger.Info("Parsed agencies", "agencies", len(agencies))
 	} else {
-		log.Printf("Warning: failed to parse agencies: %v", err)
+		logger.Warn("Failed to parse agencies", "error", err)
 	}
 
 	// Parse stops (required)
@@ -56,7 +60,7 @@ func ParseGTFSZip(zipPath string) (*GTFSFeed, error) {
 		return nil, fmt.Errorf("failed to parse stops (required): %w", err)
 	}
 	feed.Stops = stops
-	log.Printf("Parsed %d stops", len(stops))
+	logger.Info("Parsed stops", "stops", len(stops))
 
 	// Parse routes (required)
 	routes, err := ParseRoutes(filepath.Join(tempDir, "routes.txt"))
@@ -64,7 +68,7 @@ func ParseGTFSZip(zipPath string) (*GTFSFeed, error) {
 		return nil, fmt.Errorf("failed to parse routes (required): %w", err)
 	}
 	feed.Routes = routes
-	log.Printf("Parsed %d routes", len(routes))
+	logger.Info("Parsed routes", "routes", len(routes))
 
 	// Parse trips (required)
 	trips, err := ParseTrips(filepath.Join(tempDir, "trips.txt"))
@@ -72,7 +76,7 @@ func ParseGTFSZip(zipPath string) (*GTFSFeed, error) {
 		return nil, fmt.Errorf("failed to parse trips (required): %w", err)
 	}
 	feed.Trips = trips
-	log.Printf("Parsed %d trips", len(trips))
+	logger.Info("Parsed trips", "trips", len(trips))
 
 	// Parse stop_times (required)
 	stopTimes, err := ParseStopTimes(filepath.Join(tempDir, "stop_times.txt"))
@@ -80,22 +84,38 @@ func ParseGTFSZip(zipPath string) (*GTFSFeed, error) {
 		return nil, fmt.Errorf("failed to parse stop_times (required): %w", err)
 	}
 	feed.StopTimes = stopTimes
-	log.Printf("Parsed %d stop_times", len(stopTimes))
+	logger.Info("Parsed stop_times", "stop_times", len(stopTimes))
 
 	// Parse calendar (optional)
 	if calendars, err := ParseCalendar(filepath.Join(tempDir, "calendar.txt")); err == nil {
 		feed.Calendars = calendars
-		log.Printf("Parsed %d calendar entries", len(calendars))
+		logger.Info("Parsed calendar", "calendar", len(calendars))
 	} else {
-		log.Printf("Warning: failed to parse calendar: %v", err)
+		logger.Warn("Failed to parse calendar", "error", err)
 	}
 
 	// Parse calendar_dates (optional)
 	if calDates, err := ParseCalendarDates(filepath.Join(tempDir, "calendar_dates.txt")); err == nil {
 		feed.CalendarDates = calDates
-		log.Printf("Parsed %d calendar_dates entries", len(calDates))
+		logger.Info("Parsed calendar_dates", "calendar_dates", len(calDates))
+	} else {
+		logger.Warn("Failed to parse calendar_dates", "error", err)
+	}
+
+	// Parse translations (optional)
+	if translations, err := ParseTranslations(filepath.Join(tempDir, "translations.txt")); err == nil {
+		feed.Translations = translations
+		logger.Info("Parsed translations", "translations", len(translations))
 	} else {
-		log.Printf("Warning: failed to parse calendar_dates: %v", err)
+		logger.Warn("Failed to parse translations", "error", err)
+	}
+
+	// Parse shapes (optional)
+	if shapes, err := ParseShapes(filepath.Join(tempDir, "shapes.txt")); err == nil {
+		feed.Shapes = shapes
+		logger.Info("Parsed shapes", "shape_points", len(shapes))
+	} else {
+		logger.Warn("Failed to parse shapes", "error", err)
 	}
 
 	return feed, nil
@@ -131,7 +151,7 @@ func parseAgenciesFromReader(reader io.Reader) ([]models.GTFSAgency, error) {
 			break
 		}
 		if err != nil {
-			log.Printf("Warning: skipping malformed agency row: %v", err)
+			logger.Warn("Skipping malformed agency row", "error", err)
 			continue
 		}
 
@@ -177,7 +197,7 @@ func parseStopsFromReader(reader io.Reader) ([]models.GTFSStop, error) {
 			break
 		}
 		if err != nil {
-			log.Printf("Warning: skipping malformed stop row: %v", err)
+			logger.Warn("Skipping malformed stop row", "error", err)
 			continue
 		}
 
@@ -188,19 +208,19 @@ func parseStopsFromReader(reader io.Reader) ([]models.GTFSStop, error) {
 
 		// Skip stops without required fields
 		if stopID == "" || latStr == "" || lonStr == "" {
-			log.Printf("Warning: skipping stop with missing required fields: %s", stopID)
+			logger.Warn("Skipping stop with missing required fields", "stop_id", stopID)
 			continue
 		}
 
 		lat, err := strconv.ParseFloat(latStr, 64)
 		if err != nil {
-			log.Printf("Warning: invalid latitude for stop %s: %v", stopID, err)
+			logger.Warn("Invalid stop latitude", "stop_id", stopID, "error", err)
 			continue
 		}
 
 		lon, err := strconv.ParseFloat(lonStr, 64)
 		if err != nil {
-			log.Printf("Warning: invalid longitude for stop %s: %v", stopID, err)
+			logger.Warn("Invalid stop longitude", "stop_id", stopID, "error", err)
 			continue
 		}
 
@@ -246,7 +266,7 @@ func parseRoutesFromReader(reader io.Reader) ([]models.GTFSRoute, error) {
 			break
 		}
 		if err != nil {
-			log.Printf("Warning: skipping malformed route row: %v", err)
+			logger.Warn("Skipping malformed route row", "error", err)
 			continue
 		}
 
@@ -302,7 +322,7 @@ func parseTripsFromReader(reader io.Reader) ([]models.GTFSTrip, error) {
 			break
 		}
 		if err != nil {
-			log.Printf("Warning: skipping malformed trip row: %v", err)
+			logger.Warn("Skipping malformed trip row", "error", err)
 			continue
 		}
 
@@ -322,6 +342,7 @@ func parseTripsFromReader(reader io.Reader) ([]models.GTFSTrip, error) {
 			TripID:    tripID,
 			Headsign:  getField(record, colMap, "trip_headsign"),
 			Direction: direction,
+			ShapeID:   getField(record, colMap, "shape_id"),
 		}
 
 		trips = append(trips, trip)
@@ -359,7 +380,7 @@ func parseStopTimesFromReader(reader io.Reader) ([]models.GTFSStopTime, error) {
 			break
 		}
 		if err != nil {
-			log.Printf("Warning: skipping malformed stop_time row: %v", err)
+			logger.Warn("Skipping malformed stop_time row", "error", err)
 			continue
 		}
 
@@ -373,7 +394,7 @@ func parseStopTimesFromReader(reader io.Reader) ([]models.GTFSStopTime, error) {
 
 		sequence, err := strconv.Atoi(seqStr)
 		if err != nil {
-			log.Printf("Warning: invalid sequence for trip %s: %v", tripID, err)
+			logger.Warn("Invalid stop sequence", "trip_id", tripID, "error", err)
 			continue
 		}
 
@@ -408,6 +429,58 @@ func getField(record []string, colMap map[string]int, fieldName string) string {
 	return ""
 }
 
+// ParseShapes parses shapes.txt
+func ParseShapes(filePath string) ([]models.GTFSShapePoint, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseShapesFromReader(file)
+}
+
+func parseShapesFromReader(reader io.Reader) ([]models.GTFSShapePoint, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.TrimLeadingSpace = true
+
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	colMap := makeColumnMap(header)
+	var points []models.GTFSShapePoint
+
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logger.Warn("Skipping malformed shape row", "error", err)
+			continue
+		}
+
+		shapeID := getField(record, colMap, "shape_id")
+		lat, latErr := strconv.ParseFloat(getField(record, colMap, "shape_pt_lat"), 64)
+		lon, lonErr := strconv.ParseFloat(getField(record, colMap, "shape_pt_lon"), 64)
+		sequence, seqErr := strconv.Atoi(getField(record, colMap, "shape_pt_sequence"))
+		if shapeID == "" || latErr != nil || lonErr != nil || seqErr != nil {
+			continue
+		}
+
+		points = append(points, models.GTFSShapePoint{
+			ShapeID:  shapeID,
+			Lat:      lat,
+			Lon:      lon,
+			Sequence: sequence,
+		})
+	}
+
+	return points, nil
+}
+
 // ParseCalendar parses calendar.txt
 func ParseCalendar(filePath string) ([]models.GTFSCalendar, error) {
 	file, err := os.Open(filePath)
@@ -433,7 +506,7 @@ func ParseCalendar(filePath string) ([]models.GTFSCalendar, error) {
 			break
 		}
 		if err != nil {
-			log.Printf("Warning: skipping malformed calendar row: %v", err)
+			logger.Warn("Skipping malformed calendar row", "error", err)
 			continue
 		}
 
@@ -498,7 +571,7 @@ func ParseCalendarDates(filePath string) ([]models.GTFSCalendarDate, error) {
 			break
 		}
 		if err != nil {
-			log.Printf("Warning: skipping malformed calendar_dates row: %v", err)
+			logger.Warn("Skipping malformed calendar_dates row", "error", err)
 			continue
 		}
 
@@ -512,7 +585,7 @@ func ParseCalendarDates(filePath string) ([]models.GTFSCalendarDate, error) {
 
 		exType, err := strconv.Atoi(exTypeStr)
 		if err != nil {
-			log.Printf("Warning: invalid exception_type for service %s: %v", serviceID, err)
+			logger.Warn("Invalid exception_type", "service_id", serviceID, "error", err)
 			continue
 		}
 
@@ -526,6 +599,67 @@ func ParseCalendarDates(filePath string) ([]models.GTFSCalendarDate, error) {
 	return calDates, nil
 }
 
+// ParseTranslations parses translations.txt
+// Only the current table_name/field_name format is supported; the legacy
+// trans_id/lang layout is rejected
+func ParseTranslations(filePath string) ([]models.GTFSTranslation, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseTranslationsFromReader(file)
+}
+
+func parseTranslationsFromReader(reader io.Reader) ([]models.GTFSTranslation, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.TrimLeadingSpace = true
+
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	colMap := makeColumnMap(header)
+	if _, ok := colMap["table_name"]; !ok {
+		return nil, fmt.Errorf("unsupported translations.txt format: missing table_name column")
+	}
+
+	var translations []models.GTFSTranslation
+
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logger.Warn("Skipping malformed translation row", "error", err)
+			continue
+		}
+
+		tr := models.GTFSTranslation{
+			TableName:   getField(record, colMap, "table_name"),
+			FieldName:   getField(record, colMap, "field_name"),
+			Language:    getField(record, colMap, "language"),
+			Translation: getField(record, colMap, "translation"),
+			RecordID:    getField(record, colMap, "record_id"),
+			FieldValue:  getField(record, colMap, "field_value"),
+		}
+
+		if tr.TableName == "" || tr.FieldName == "" || tr.Language == "" || tr.Translation == "" {
+			continue
+		}
+		if tr.RecordID == "" && tr.FieldValue == "" {
+			continue
+		}
+
+		translations = append(translations, tr)
+	}
+
+	return translations, nil
+}
+
 func extractZip(zipPath, destDir string) error {
 	reader, err := zip.OpenReader(zipPath)
 	if err != nil {
@@ -0,0 +1,80 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// WriteZip writes a feed as a GTFS ZIP that ParseGTFSZip reads back
+// Empty optional tables are left out
+func WriteZip(w io.Writer, feed *GTFSFeed) error {
+	zw := zip.NewWriter(w)
+
+	files := []struct {
+		name     string
+		optional bool
+		header   []string
+		rows     [][]string
+	}{
+		{"agency.txt", true, []string{"agency_id", "agency_name", "agency_url", "agency_timezone"}, nil},
+		{"stops.txt", false, []string{"stop_id", "stop_name", "stop_lat", "stop_lon"}, nil},
+		{"routes.txt", false, []string{"route_id", "agency_id", "route_short_name", "route_long_name", "route_type", "route_color"}, nil},
+		{"trips.txt", false, []string{"route_id", "service_id", "trip_id", "trip_headsign", "direction_id", "shape_id"}, nil},
+		{"stop_times.txt", false, []string{"trip_id", "arrival_time", "departure_time", "stop_id", "stop_sequence"}, nil},
+		{"calendar.txt", true, []string{"service_id", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday", "start_date", "end_date"}, nil},
+		{"calendar_dates.txt", true, []string{"service_id", "date", "exception_type"}, nil},
+		{"shapes.txt", true, []string{"shape_id", "shape_pt_lat", "shape_pt_lon", "shape_pt_sequence"}, nil},
+	}
+	coord := func(f float64) string { return strconv.FormatFloat(f, 'f', 6, 64) }
+	flag := func(b bool) string {
+		if b {
+			return "1"
+		}
+		return "0"
+	}
+	for _, a := range feed.Agencies {
+		files[0].rows = append(files[0].rows, []string{a.AgencyID, a.AgencyName, a.AgencyURL, a.Timezone})
+	}
+	for _, s := range feed.Stops {
+		files[1].rows = append(files[1].rows, []string{s.StopID, s.StopName, coord(s.Lat), coord(s.Lon)})
+	}
+	for _, r := range feed.Routes {
+		files[2].rows = append(files[2].rows, []string{r.RouteID, r.AgencyID, r.ShortName, r.LongName, strconv.Itoa(r.RouteType), r.RouteColor})
+	}
+	for _, t := range feed.Trips {
+		files[3].rows = append(files[3].rows, []string{t.RouteID, t.ServiceID, t.TripID, t.Headsign, strconv.Itoa(t.Direction), t.ShapeID})
+	}
+	for _, st := range feed.StopTimes {
+		files[4].rows = append(files[4].rows, []string{st.TripID, st.ArrivalTime, st.DepartureTime, st.StopID, strconv.Itoa(st.StopSequence)})
+	}
+	for _, c := range feed.Calendars {
+		files[5].rows = append(files[5].rows, []string{c.ServiceID, flag(c.Monday), flag(c.Tuesday), flag(c.Wednesday),
+			flag(c.Thursday), flag(c.Friday), flag(c.Saturday), flag(c.Sunday), c.StartDate, c.EndDate})
+	}
+	for _, d := range feed.CalendarDates {
+		files[6].rows = append(files[6].rows, []string{d.ServiceID, d.Date, strconv.Itoa(d.ExceptionType)})
+	}
+	for _, p := range feed.Shapes {
+		files[7].rows = append(files[7].rows, []string{p.ShapeID, coord(p.Lat), coord(p.Lon), strconv.Itoa(p.Sequence)})
+	}
+
+	for _, f := range files {
+		if f.optional && len(f.rows) == 0 {
+			continue
+		}
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		cw := csv.NewWriter(fw)
+		cw.Write(f.header)
+		cw.WriteAll(f.rows)
+		if err := cw.Error(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", f.name, err)
+		}
+	}
+	return zw.Close()
+}
@@ -0,0 +1,87 @@
+package gtfsrt
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/alerts"
+	"github.com/passbi/passbi_core/internal/models"
+)
+
+// DefaultLanguage is the language tag of alert texts stored in PassBi
+const DefaultLanguage = "fr"
+
+// AlertsFeed builds a full-dataset ServiceAlerts feed from stored alerts
+// Network-wide alerts are published against every agency in agencyIDs
+func AlertsFeed(list []models.ServiceAlert, agencyIDs []string, now time.Time) *FeedMessage {
+	feed := &FeedMessage{
+		Header: FeedHeader{
+			Version:        Version,
+			Incrementality: FullDataset,
+			Timestamp:      uint64(now.Unix()),
+		},
+		Entities: make([]FeedEntity, 0, len(list)),
+	}
+
+	for i := range list {
+		feed.Entities = append(feed.Entities, FeedEntity{
+			ID:    "alert-" + strconv.FormatInt(list[i].ID, 10),
+			Alert: toAlert(&list[i], agencyIDs),
+		})
+	}
+
+	return feed
+}
+
+// toAlert maps a PassBi alert onto the GTFS-Realtime Alert message
+func toAlert(a *models.ServiceAlert, agencyIDs []string) *Alert {
+	period := TimeRange{Start: uint64(a.StartsAt.Unix())}
+	if a.EndsAt != nil {
+		period.End = uint64(a.EndsAt.Unix())
+	}
+
+	rt := &Alert{
+		ActivePeriods: []TimeRange{period},
+		Cause:         alerts.Causes[a.Cause],
+		Effect:        alerts.Effects[a.Effect],
+		HeaderText:    TranslatedString{{Text: a.Title, Language: DefaultLanguage}},
+		SeverityLevel: severityLevel(a.Severity),
+	}
+	if a.Description != "" {
+		rt.DescriptionText = TranslatedString{{Text: a.Description, Language: DefaultLanguage}}
+	}
+	if a.URL != "" {
+		rt.URL = TranslatedString{{Text: a.URL}}
+	}
+
+	for _, ent := range a.Entities {
+		rt.InformedEntities = append(rt.InformedEntities, EntitySelector{
+			AgencyID: ent.AgencyID,
+			RouteID:  ent.RouteID,
+			StopID:   ent.StopID,
+		})
+	}
+
+	// GTFS-RT requires at least one informed entity; network-wide alerts
+	// have none in PassBi, so they are published against every agency
+	if len(rt.InformedEntities) == 0 {
+		for _, id := range agencyIDs {
+			rt.InformedEntities = append(rt.InformedEntities, EntitySelector{AgencyID: id})
+		}
+	}
+
+	return rt
+}
+
+func severityLevel(s models.AlertSeverity) int32 {
+	switch s {
+	case models.SeverityInfo:
+		return SeverityInfo
+	case models.SeverityWarning:
+		return SeverityWarning
+	case models.SeveritySevere:
+		return SeveritySevere
+	default:
+		return SeverityUnknown
+	}
+}
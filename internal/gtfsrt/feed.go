@@ -0,0 +1,171 @@
+package gtfsrt
+
+// Version is the gtfs_realtime_version advertised in feed headers
+const Version = "2.0"
+
+// Incrementality of a feed (FeedHeader.incrementality)
+const (
+	FullDataset  int32 = 0
+	Differential int32 = 1
+)
+
+// SeverityLevel values of Alert.severity_level
+const (
+	SeverityUnknown int32 = 1
+	SeverityInfo    int32 = 2
+	SeverityWarning int32 = 3
+	SeveritySevere  int32 = 4
+)
+
+// FeedMessage is the top-level GTFS-Realtime message
+type FeedMessage struct {
+	Header   FeedHeader
+	Entities []FeedEntity
+}
+
+// FeedHeader carries feed metadata
+type FeedHeader struct {
+	Version        string
+	Incrementality int32
+	Timestamp      uint64 // POSIX seconds
+}
+
+// FeedEntity wraps a single trip update, vehicle position or alert
+type FeedEntity struct {
+	ID         string
+	IsDeleted  bool
+	TripUpdate *TripUpdate
+	Vehicle    *VehiclePosition
+	Alert      *Alert
+}
+
+// Alert mirrors transit_realtime.Alert
+type Alert struct {
+	ActivePeriods    []TimeRange
+	InformedEntities []EntitySelector
+	Cause            int32
+	Effect           int32
+	URL              TranslatedString
+	HeaderText       TranslatedString
+	DescriptionText  TranslatedString
+	SeverityLevel    int32
+}
+
+// TimeRange is an active period in POSIX seconds; zero means open-ended
+type TimeRange struct {
+	Start uint64
+	End   uint64
+}
+
+// EntitySelector identifies the agency/route/stop an alert applies to
+type EntitySelector struct {
+	AgencyID string
+	RouteID  string
+	StopID   string
+}
+
+// TranslatedString holds per-language variants of a text
+type TranslatedString []Translation
+
+// Translation is a single language variant; empty Language means default
+type Translation struct {
+	Text     string
+	Language string
+}
+
+// Marshal encodes the feed in protobuf binary format
+func (m *FeedMessage) Marshal() []byte {
+	var e encoder
+	e.messageField(1, m.Header.encode)
+	for i := range m.Entities {
+		e.messageField(2, m.Entities[i].encode)
+	}
+	return e.buf
+}
+
+func (h *FeedHeader) encode(e *encoder) {
+	version := h.Version
+	if version == "" {
+		version = Version
+	}
+	e.stringField(1, version)
+	e.int32Field(2, h.Incrementality)
+	if h.Timestamp > 0 {
+		e.uint64Field(3, h.Timestamp)
+	}
+}
+
+func (f *FeedEntity) encode(e *encoder) {
+	e.stringField(1, f.ID)
+	if f.IsDeleted {
+		e.boolField(2, true)
+	}
+	if f.TripUpdate != nil {
+		e.messageField(3, f.TripUpdate.encode)
+	}
+	if f.Vehicle != nil {
+		e.messageField(4, f.Vehicle.encode)
+	}
+	if f.Alert != nil {
+		e.messageField(5, f.Alert.encode)
+	}
+}
+
+func (a *Alert) encode(e *encoder) {
+	for i := range a.ActivePeriods {
+		e.messageField(1, a.ActivePeriods[i].encode)
+	}
+	for i := range a.InformedEntities {
+		e.messageField(5, a.InformedEntities[i].encode)
+	}
+	if a.Cause != 0 {
+		e.int32Field(6, a.Cause)
+	}
+	if a.Effect != 0 {
+		e.int32Field(7, a.Effect)
+	}
+	if len(a.URL) > 0 {
+		e.messageField(8, a.URL.encode)
+	}
+	if len(a.HeaderText) > 0 {
+		e.messageField(10, a.HeaderText.encode)
+	}
+	if len(a.DescriptionText) > 0 {
+		e.messageField(11, a.DescriptionText.encode)
+	}
+	if a.SeverityLevel != 0 {
+		e.int32Field(14, a.SeverityLevel)
+	}
+}
+
+func (t *TimeRange) encode(e *encoder) {
+	if t.Start > 0 {
+		e.uint64Field(1, t.Start)
+	}
+	if t.End > 0 {
+		e.uint64Field(2, t.End)
+	}
+}
+
+func (s *EntitySelector) encode(e *encoder) {
+	if s.AgencyID != "" {
+		e.stringField(1, s.AgencyID)
+	}
+	if s.RouteID != "" {
+		e.stringField(2, s.RouteID)
+	}
+	if s.StopID != "" {
+		e.stringField(5, s.StopID)
+	}
+}
+
+func (t TranslatedString) encode(e *encoder) {
+	for _, tr := range t {
+		e.messageField(1, func(e *encoder) {
+			e.stringField(1, tr.Text)
+			if tr.Language != "" {
+				e.stringField(2, tr.Language)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package gtfsrt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeedHeaderEncoding(t *testing.T) {
+	feed := &FeedMessage{Header: FeedHeader{Version: Version, Timestamp: 150}}
+
+	// header(1) len=8 { version(1)="2.0", incrementality(2)=0, timestamp(3)=150 }
+	want := []byte{0x0a, 0x0a, 0x0a, 0x03, '2', '.', '0', 0x10, 0x00, 0x18, 0x96, 0x01}
+	assert.Equal(t, want, feed.Marshal())
+}
+
+func TestInt32FieldNegative(t *testing.T) {
+	var e encoder
+	e.int32Field(1, -1)
+
+	want := []byte{0x08, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}
+	assert.Equal(t, want, e.buf)
+}
+
+func TestAlertsFeed(t *testing.T) {
+	start := time.Unix(1000, 0)
+	end := time.Unix(2000, 0)
+	now := time.Unix(1500, 0)
+
+	list := []models.ServiceAlert{
+		{
+			ID:       7,
+			Title:    "Travaux",
+			Severity: models.SeveritySevere,
+			Cause:    "CONSTRUCTION",
+			Effect:   "DETOUR",
+			StartsAt: start,
+			EndsAt:   &end,
+			Entities: []models.AlertEntity{{RouteID: "DDD_1"}},
+		},
+		{
+			ID:       8,
+			Title:    "Grève",
+			Severity: models.SeverityInfo,
+			Cause:    "STRIKE",
+			Effect:   "REDUCED_SERVICE",
+			StartsAt: start,
+		},
+	}
+
+	feed := AlertsFeed(list, []string{"AFTU", "DDD"}, now)
+
+	assert.Equal(t, uint64(1500), feed.Header.Timestamp)
+	assert.Len(t, feed.Entities, 2)
+
+	first := feed.Entities[0]
+	assert.Equal(t, "alert-7", first.ID)
+	assert.Equal(t, []TimeRange{{Start: 1000, End: 2000}}, first.Alert.ActivePeriods)
+	assert.Equal(t, []EntitySelector{{RouteID: "DDD_1"}}, first.Alert.InformedEntities)
+	assert.Equal(t, int32(10), first.Alert.Cause)
+	assert.Equal(t, int32(4), first.Alert.Effect)
+	assert.Equal(t, SeveritySevere, first.Alert.SeverityLevel)
+
+	second := feed.Entities[1]
+	assert.Equal(t, []TimeRange{{Start: 1000}}, second.Alert.ActivePeriods)
+	assert.Equal(t, []EntitySelector{{AgencyID: "AFTU"}, {AgencyID: "DDD"}}, second.Alert.InformedEntities)
+	assert.Empty(t, second.Alert.DescriptionText)
+}
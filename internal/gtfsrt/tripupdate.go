@@ -0,0 +1,305 @@
+package gtfsrt
+
+import "fmt"
+
+// TripDescriptor.schedule_relationship values
+const (
+	TripScheduled   int32 = 0
+	TripAdded       int32 = 1
+	TripUnscheduled int32 = 2
+	TripCanceled    int32 = 3
+	TripReplacement int32 = 5
+	TripDuplicated  int32 = 6
+	TripDeleted     int32 = 7
+)
+
+// StopTimeUpdate.schedule_relationship values
+const (
+	StopScheduled   int32 = 0
+	StopSkipped     int32 = 1
+	StopNoData      int32 = 2
+	StopUnscheduled int32 = 3
+)
+
+// TripUpdate mirrors transit_realtime.TripUpdate
+type TripUpdate struct {
+	Trip            TripDescriptor
+	VehicleID       string
+	StopTimeUpdates []StopTimeUpdate
+	Timestamp       uint64
+	Delay           *int32 // trip-level delay in seconds, used when no stop updates are given
+}
+
+// TripDescriptor identifies the scheduled trip an update applies to
+type TripDescriptor struct {
+	TripID               string
+	RouteID              string
+	DirectionID          int32
+	StartTime            string // HH:MM:SS
+	StartDate            string // YYYYMMDD
+	ScheduleRelationship int32
+}
+
+// StopTimeUpdate is a prediction for one stop of a trip
+// StopSequence or StopID (or both) identify the stop
+type StopTimeUpdate struct {
+	StopSequence         *uint32
+	StopID               string
+	Arrival              *StopTimeEvent
+	Departure            *StopTimeEvent
+	ScheduleRelationship int32
+}
+
+// StopTimeEvent carries either a delay relative to the schedule or an absolute time
+type StopTimeEvent struct {
+	Delay       *int32 // seconds, positive = late
+	Time        *int64 // POSIX seconds
+	Uncertainty int32
+}
+
+func (u *TripUpdate) encode(e *encoder) {
+	e.messageField(1, u.Trip.encode)
+	for i := range u.StopTimeUpdates {
+		e.messageField(2, u.StopTimeUpdates[i].encode)
+	}
+	if u.VehicleID != "" {
+		e.messageField(3, func(e *encoder) { e.stringField(1, u.VehicleID) })
+	}
+	if u.Timestamp > 0 {
+		e.uint64Field(4, u.Timestamp)
+	}
+	if u.Delay != nil {
+		e.int32Field(5, *u.Delay)
+	}
+}
+
+func (t *TripDescriptor) encode(e *encoder) {
+	if t.TripID != "" {
+		e.stringField(1, t.TripID)
+	}
+	if t.StartTime != "" {
+		e.stringField(2, t.StartTime)
+	}
+	if t.StartDate != "" {
+		e.stringField(3, t.StartDate)
+	}
+	if t.ScheduleRelationship != TripScheduled {
+		e.int32Field(4, t.ScheduleRelationship)
+	}
+	if t.RouteID != "" {
+		e.stringField(5, t.RouteID)
+	}
+	if t.DirectionID != 0 {
+		e.uint64Field(6, uint64(t.DirectionID))
+	}
+}
+
+func (s *StopTimeUpdate) encode(e *encoder) {
+	if s.StopSequence != nil {
+		e.uint64Field(1, uint64(*s.StopSequence))
+	}
+	if s.Arrival != nil {
+		e.messageField(2, s.Arrival.encode)
+	}
+	if s.Departure != nil {
+		e.messageField(3, s.Departure.encode)
+	}
+	if s.StopID != "" {
+		e.stringField(4, s.StopID)
+	}
+	if s.ScheduleRelationship != StopScheduled {
+		e.int32Field(5, s.ScheduleRelationship)
+	}
+}
+
+func (t *StopTimeEvent) encode(e *encoder) {
+	if t.Delay != nil {
+		e.int32Field(1, *t.Delay)
+	}
+	if t.Time != nil {
+		e.int64Field(2, *t.Time)
+	}
+	if t.Uncertainty != 0 {
+		e.int32Field(3, t.Uncertainty)
+	}
+}
+
+// Unmarshal decodes a protobuf FeedMessage
+// Only the header, TripUpdate and VehiclePosition entities are read; alerts
+// in the feed are skipped
+func Unmarshal(data []byte) (*FeedMessage, error) {
+	var m FeedMessage
+	d := decoder{buf: data}
+	for {
+		field, wt, ok := d.next()
+		if !ok {
+			break
+		}
+		switch {
+		case field == 1 && wt == wireBytes:
+			d.message(m.Header.decode)
+		case field == 2 && wt == wireBytes:
+			var ent FeedEntity
+			d.message(ent.decode)
+			m.Entities = append(m.Entities, ent)
+		default:
+			d.skip(wt)
+		}
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("failed to decode feed: %w", d.err)
+	}
+	return &m, nil
+}
+
+func (h *FeedHeader) decode(d *decoder) {
+	for {
+		field, wt, ok := d.next()
+		if !ok {
+			return
+		}
+		switch {
+		case field == 1 && wt == wireBytes:
+			h.Version = d.string()
+		case field == 2 && wt == wireVarint:
+			h.Incrementality = int32(d.varint())
+		case field == 3 && wt == wireVarint:
+			h.Timestamp = d.varint()
+		default:
+			d.skip(wt)
+		}
+	}
+}
+
+func (f *FeedEntity) decode(d *decoder) {
+	for {
+		field, wt, ok := d.next()
+		if !ok {
+			return
+		}
+		switch {
+		case field == 1 && wt == wireBytes:
+			f.ID = d.string()
+		case field == 2 && wt == wireVarint:
+			f.IsDeleted = d.varint() != 0
+		case field == 3 && wt == wireBytes:
+			f.TripUpdate = &TripUpdate{}
+			d.message(f.TripUpdate.decode)
+		case field == 4 && wt == wireBytes:
+			f.Vehicle = &VehiclePosition{}
+			d.message(f.Vehicle.decode)
+		default:
+			d.skip(wt)
+		}
+	}
+}
+
+func (u *TripUpdate) decode(d *decoder) {
+	for {
+		field, wt, ok := d.next()
+		if !ok {
+			return
+		}
+		switch {
+		case field == 1 && wt == wireBytes:
+			d.message(u.Trip.decode)
+		case field == 2 && wt == wireBytes:
+			var s StopTimeUpdate
+			d.message(s.decode)
+			u.StopTimeUpdates = append(u.StopTimeUpdates, s)
+		case field == 3 && wt == wireBytes:
+			d.message(func(d *decoder) {
+				for {
+					field, wt, ok := d.next()
+					if !ok {
+						return
+					}
+					if field == 1 && wt == wireBytes {
+						u.VehicleID = d.string()
+					} else {
+						d.skip(wt)
+					}
+				}
+			})
+		case field == 4 && wt == wireVarint:
+			u.Timestamp = d.varint()
+		case field == 5 && wt == wireVarint:
+			v := int32(d.varint())
+			u.Delay = &v
+		default:
+			d.skip(wt)
+		}
+	}
+}
+
+func (t *TripDescriptor) decode(d *decoder) {
+	for {
+		field, wt, ok := d.next()
+		if !ok {
+			return
+		}
+		switch {
+		case field == 1 && wt == wireBytes:
+			t.TripID = d.string()
+		case field == 2 && wt == wireBytes:
+			t.StartTime = d.string()
+		case field == 3 && wt == wireBytes:
+			t.StartDate = d.string()
+		case field == 4 && wt == wireVarint:
+			t.ScheduleRelationship = int32(d.varint())
+		case field == 5 && wt == wireBytes:
+			t.RouteID = d.string()
+		case field == 6 && wt == wireVarint:
+			t.DirectionID = int32(d.varint())
+		default:
+			d.skip(wt)
+		}
+	}
+}
+
+func (s *StopTimeUpdate) decode(d *decoder) {
+	for {
+		field, wt, ok := d.next()
+		if !ok {
+			return
+		}
+		switch {
+		case field == 1 && wt == wireVarint:
+			v := uint32(d.varint())
+			s.StopSequence = &v
+		case field == 2 && wt == wireBytes:
+			s.Arrival = &StopTimeEvent{}
+			d.message(s.Arrival.decode)
+		case field == 3 && wt == wireBytes:
+			s.Departure = &StopTimeEvent{}
+			d.message(s.Departure.decode)
+		case field == 4 && wt == wireBytes:
+			s.StopID = d.string()
+		case field == 5 && wt == wireVarint:
+			s.ScheduleRelationship = int32(d.varint())
+		default:
+			d.skip(wt)
+		}
+	}
+}
+
+func (t *StopTimeEvent) decode(d *decoder) {
+	for {
+		field, wt, ok := d.next()
+		if !ok {
+			return
+		}
+		switch {
+		case field == 1 && wt == wireVarint:
+			v := int32(d.varint())
+			t.Delay = &v
+		case field == 2 && wt == wireVarint:
+			v := int64(d.varint())
+			t.Time = &v
+		case field == 3 && wt == wireVarint:
+			t.Uncertainty = int32(d.varint())
+		default:
+			d.skip(wt)
+		}
+	}
+}
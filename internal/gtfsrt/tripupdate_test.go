@@ -0,0 +1,96 @@
+package gtfsrt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTripUpdateRoundTrip(t *testing.T) {
+	seq := uint32(3)
+	delay := int32(-45)
+	at := int64(1700000000)
+
+	feed := &FeedMessage{
+		Header: FeedHeader{Version: Version, Incrementality: FullDataset, Timestamp: 1700000000},
+		Entities: []FeedEntity{{
+			ID: "tu-1",
+			TripUpdate: &TripUpdate{
+				Trip: TripDescriptor{TripID: "T1", RouteID: "DDD_1", StartDate: "20231114", ScheduleRelationship: TripScheduled},
+				StopTimeUpdates: []StopTimeUpdate{
+					{StopSequence: &seq, Arrival: &StopTimeEvent{Delay: &delay}},
+					{StopID: "S9", Departure: &StopTimeEvent{Time: &at}, ScheduleRelationship: StopSkipped},
+				},
+				VehicleID: "bus-42",
+				Timestamp: 1700000000,
+			},
+		}},
+	}
+
+	decoded, err := Unmarshal(feed.Marshal())
+	assert.NoError(t, err)
+	assert.Equal(t, feed, decoded)
+}
+
+func TestUnmarshalSkipsUnknownFields(t *testing.T) {
+	var e encoder
+	e.messageField(1, func(e *encoder) { e.stringField(1, Version) })
+	e.messageField(2, func(e *encoder) {
+		e.stringField(1, "a-1")
+		// alert entity and an unknown fixed64 extension field
+		e.messageField(5, func(e *encoder) { e.int32Field(6, 4) })
+		e.tag(1000, wireFixed64)
+		e.buf = append(e.buf, 1, 2, 3, 4, 5, 6, 7, 8)
+	})
+
+	feed, err := Unmarshal(e.buf)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, Version, feed.Header.Version)
+	if !assert.Len(t, feed.Entities, 1) {
+		return
+	}
+	assert.Equal(t, "a-1", feed.Entities[0].ID)
+	assert.Nil(t, feed.Entities[0].TripUpdate)
+	assert.Nil(t, feed.Entities[0].Alert)
+}
+
+func TestVehiclePositions(t *testing.T) {
+	bearing := float32(90)
+	feed := &FeedMessage{
+		Header: FeedHeader{Version: Version, Timestamp: 1700000000},
+		Entities: []FeedEntity{
+			{ID: "v-1", Vehicle: &VehiclePosition{
+				Trip:      TripDescriptor{TripID: "T1", RouteID: "BRT_B1"},
+				VehicleID: "bus-7",
+				Position:  &Position{Latitude: 14.6928, Longitude: -17.4467, Bearing: &bearing},
+			}},
+			{ID: "v-2", Vehicle: &VehiclePosition{VehicleLabel: "no fix"}},
+		},
+	}
+
+	decoded, err := Unmarshal(feed.Marshal())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, feed, decoded)
+
+	positions := VehiclePositions(decoded, "BRT")
+	if !assert.Len(t, positions, 1) {
+		return
+	}
+	assert.Equal(t, "bus-7", positions[0].VehicleID)
+	assert.Equal(t, "BRT_B1", positions[0].RouteID)
+	assert.InDelta(t, 14.6928, positions[0].Lat, 1e-5)
+	assert.InDelta(t, 90.0, *positions[0].Bearing, 1e-9)
+	assert.Equal(t, int64(1700000000), positions[0].Timestamp.Unix())
+}
+
+func TestUnmarshalTruncated(t *testing.T) {
+	feed := &FeedMessage{Header: FeedHeader{Version: Version, Timestamp: 150}}
+	data := feed.Marshal()
+
+	_, err := Unmarshal(data[:len(data)-2])
+	assert.ErrorIs(t, err, ErrTruncated)
+}
@@ -0,0 +1,176 @@
+package gtfsrt
+
+import (
+	"time"
+
+	"github.com/passbi/passbi_core/internal/models"
+)
+
+// VehiclePosition mirrors transit_realtime.VehiclePosition
+type VehiclePosition struct {
+	Trip                TripDescriptor
+	VehicleID           string
+	VehicleLabel        string
+	Position            *Position
+	CurrentStopSequence *uint32
+	StopID              string
+	Timestamp           uint64
+}
+
+// Position is a WGS84 fix; bearing is degrees from north, speed is m/s
+type Position struct {
+	Latitude  float32
+	Longitude float32
+	Bearing   *float32
+	Speed     *float32
+}
+
+// VehiclePositions extracts the vehicle positions of a feed for one agency
+// Entities without a position or vehicle identifier are skipped
+func VehiclePositions(feed *FeedMessage, agencyID string) []models.VehiclePosition {
+	feedTime := time.Unix(int64(feed.Header.Timestamp), 0).UTC()
+
+	var positions []models.VehiclePosition
+	for _, ent := range feed.Entities {
+		v := ent.Vehicle
+		if v == nil || v.Position == nil || ent.IsDeleted {
+			continue
+		}
+
+		id := v.VehicleID
+		if id == "" {
+			id = v.VehicleLabel
+		}
+		if id == "" {
+			continue
+		}
+
+		pos := models.VehiclePosition{
+			VehicleID: id,
+			TripID:    v.Trip.TripID,
+			RouteID:   v.Trip.RouteID,
+			AgencyID:  agencyID,
+			Lat:       float64(v.Position.Latitude),
+			Lon:       float64(v.Position.Longitude),
+			StopID:    v.StopID,
+			Timestamp: feedTime,
+		}
+		if v.Position.Bearing != nil {
+			b := float64(*v.Position.Bearing)
+			pos.Bearing = &b
+		}
+		if v.Position.Speed != nil {
+			s := float64(*v.Position.Speed)
+			pos.Speed = &s
+		}
+		if v.Timestamp > 0 {
+			pos.Timestamp = time.Unix(int64(v.Timestamp), 0).UTC()
+		}
+
+		positions = append(positions, pos)
+	}
+
+	return positions
+}
+
+func (v *VehiclePosition) encode(e *encoder) {
+	e.messageField(1, v.Trip.encode)
+	if v.Position != nil {
+		e.messageField(2, v.Position.encode)
+	}
+	if v.CurrentStopSequence != nil {
+		e.uint64Field(3, uint64(*v.CurrentStopSequence))
+	}
+	if v.Timestamp > 0 {
+		e.uint64Field(5, v.Timestamp)
+	}
+	if v.StopID != "" {
+		e.stringField(7, v.StopID)
+	}
+	if v.VehicleID != "" || v.VehicleLabel != "" {
+		e.messageField(8, func(e *encoder) {
+			if v.VehicleID != "" {
+				e.stringField(1, v.VehicleID)
+			}
+			if v.VehicleLabel != "" {
+				e.stringField(2, v.VehicleLabel)
+			}
+		})
+	}
+}
+
+func (p *Position) encode(e *encoder) {
+	e.floatField(1, p.Latitude)
+	e.floatField(2, p.Longitude)
+	if p.Bearing != nil {
+		e.floatField(3, *p.Bearing)
+	}
+	if p.Speed != nil {
+		e.floatField(5, *p.Speed)
+	}
+}
+
+func (v *VehiclePosition) decode(d *decoder) {
+	for {
+		field, wt, ok := d.next()
+		if !ok {
+			return
+		}
+		switch {
+		case field == 1 && wt == wireBytes:
+			d.message(v.Trip.decode)
+		case field == 2 && wt == wireBytes:
+			v.Position = &Position{}
+			d.message(v.Position.decode)
+		case field == 3 && wt == wireVarint:
+			seq := uint32(d.varint())
+			v.CurrentStopSequence = &seq
+		case field == 5 && wt == wireVarint:
+			v.Timestamp = d.varint()
+		case field == 7 && wt == wireBytes:
+			v.StopID = d.string()
+		case field == 8 && wt == wireBytes:
+			d.message(func(d *decoder) {
+				for {
+					field, wt, ok := d.next()
+					if !ok {
+						return
+					}
+					switch {
+					case field == 1 && wt == wireBytes:
+						v.VehicleID = d.string()
+					case field == 2 && wt == wireBytes:
+						v.VehicleLabel = d.string()
+					default:
+						d.skip(wt)
+					}
+				}
+			})
+		default:
+			d.skip(wt)
+		}
+	}
+}
+
+func (p *Position) decode(d *decoder) {
+	for {
+		field, wt, ok := d.next()
+		if !ok {
+			return
+		}
+		switch {
+		case field == 1 && wt == wireFixed32:
+			p.Latitude = d.float()
+		case field == 2 && wt == wireFixed32:
+			p.Longitude = d.float()
+		case field == 3 && wt == wireFixed32:
+			b := d.float()
+			p.Bearing = &b
+		case field == 5 && wt == wireFixed32:
+			s := d.float()
+			p.Speed = &s
+		default:
+			d.skip(wt)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package gtfsrt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Protobuf wire types used by GTFS-Realtime
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// ErrTruncated is returned when a protobuf message ends mid-field
+var ErrTruncated = errors.New("gtfsrt: truncated message")
+
+// encoder appends protobuf wire-format fields to a byte buffer
+// Only the field types used by gtfs-realtime.proto are supported
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) varint(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+func (e *encoder) tag(field, wireType int) {
+	e.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (e *encoder) uint64Field(field int, v uint64) {
+	e.tag(field, wireVarint)
+	e.varint(v)
+}
+
+func (e *encoder) int32Field(field int, v int32) {
+	e.tag(field, wireVarint)
+	// Negative int32 values are sign-extended to 10 bytes per the protobuf spec
+	e.varint(uint64(int64(v)))
+}
+
+func (e *encoder) int64Field(field int, v int64) {
+	e.tag(field, wireVarint)
+	e.varint(uint64(v))
+}
+
+func (e *encoder) floatField(field int, v float32) {
+	e.tag(field, wireFixed32)
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, math.Float32bits(v))
+}
+
+func (e *encoder) boolField(field int, v bool) {
+	e.tag(field, wireVarint)
+	if v {
+		e.varint(1)
+	} else {
+		e.varint(0)
+	}
+}
+
+func (e *encoder) stringField(field int, s string) {
+	e.tag(field, wireBytes)
+	e.varint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// messageField encodes a nested message written by fn as a length-delimited field
+func (e *encoder) messageField(field int, fn func(*encoder)) {
+	var nested encoder
+	fn(&nested)
+	e.tag(field, wireBytes)
+	e.varint(uint64(len(nested.buf)))
+	e.buf = append(e.buf, nested.buf...)
+}
+
+// decoder reads protobuf wire-format fields from a byte buffer
+// The first error sticks; callers check err once after the read loop
+type decoder struct {
+	buf []byte
+	err error
+}
+
+// next reads the next field tag, returning false at the end of input or on error
+func (d *decoder) next() (field, wireType int, ok bool) {
+	if d.err != nil || len(d.buf) == 0 {
+		return 0, 0, false
+	}
+	key := d.varint()
+	if d.err != nil {
+		return 0, 0, false
+	}
+	return int(key >> 3), int(key & 7), true
+}
+
+func (d *decoder) varint() uint64 {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail(ErrTruncated)
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.varint()
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.buf)) {
+		d.fail(ErrTruncated)
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) float() float32 {
+	if len(d.buf) < 4 {
+		d.fail(ErrTruncated)
+		return 0
+	}
+	v := math.Float32frombits(binary.LittleEndian.Uint32(d.buf))
+	d.buf = d.buf[4:]
+	return v
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+// skip discards the value of a field this package does not read
+func (d *decoder) skip(wireType int) {
+	switch wireType {
+	case wireVarint:
+		d.varint()
+	case wireFixed64:
+		d.advance(8)
+	case wireBytes:
+		d.bytes()
+	case wireFixed32:
+		d.advance(4)
+	default:
+		d.fail(fmt.Errorf("gtfsrt: unsupported wire type %d", wireType))
+	}
+}
+
+func (d *decoder) advance(n int) {
+	if n > len(d.buf) {
+		d.fail(ErrTruncated)
+		return
+	}
+	d.buf = d.buf[n:]
+}
+
+// message decodes a nested length-delimited message with fn
+func (d *decoder) message(fn func(*decoder)) {
+	b := d.bytes()
+	if d.err != nil {
+		return
+	}
+	nested := decoder{buf: b}
+	fn(&nested)
+	if nested.err != nil {
+		d.fail(nested.err)
+	}
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+	d.buf = nil
+}
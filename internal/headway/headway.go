@@ -0,0 +1,245 @@
+// Package headway measures the time between consecutive vehicles of a route
+// from where they were last seen, flags bunched vehicles and gaps against
+// the scheduled headway, and alerts riders of the routes running irregularly
+package headway
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/eta"
+	"github.com/passbi/passbi_core/internal/logging"
+)
+
+var logger = logging.For("headway")
+
+// Statuses of a Headway
+const (
+	StatusOK      = "ok"
+	StatusBunched = "bunched"
+	StatusGap     = "gap"
+)
+
+// maxScheduled bounds the scheduled headways measured against; trips
+// further apart are not running one behind the other
+const maxScheduled = 2 * time.Hour
+
+// Config holds the monitor settings
+type Config struct {
+	Interval   time.Duration // how often headways are measured
+	MaxAge     time.Duration // how recent a vehicle's position must be to be measured
+	BunchRatio float64       // share of the scheduled headway at or below which a vehicle is bunched
+	GapRatio   float64       // multiple of the scheduled headway at or above which a vehicle trails a gap
+	MinGap     time.Duration // how much longer than scheduled a gap must also be
+	Alerts     bool          // whether irregular routes get a service alert
+	AlertAfter time.Duration // how long a route stays irregular before it is alerted
+	Locate     eta.Config    // how vehicles are located along their trips
+}
+
+// DefaultConfig measures every minute, flags a vehicle closer than a
+// quarter of the scheduled headway behind the one ahead, or more than twice
+// and five minutes further, and alerts routes irregular for five minutes
+func DefaultConfig() Config {
+	return Config{
+		Interval:   time.Minute,
+		MaxAge:     5 * time.Minute,
+		BunchRatio: 0.25,
+		GapRatio:   2,
+		MinGap:     5 * time.Minute,
+		Alerts:     true,
+		AlertAfter: 5 * time.Minute,
+		Locate:     eta.DefaultConfig(),
+	}
+}
+
+// ConfigFromEnv returns the defaults overridden by HEADWAY_* variables;
+// vehicles are located with the ETA_* settings
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	cfg.Locate = eta.ConfigFromEnv()
+	if d, err := time.ParseDuration(os.Getenv("HEADWAY_INTERVAL")); err == nil && d > 0 {
+		cfg.Interval = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("HEADWAY_MAX_AGE")); err == nil && d > 0 {
+		cfg.MaxAge = d
+	}
+	if f, err := strconv.ParseFloat(os.Getenv("HEADWAY_BUNCH_RATIO"), 64); err == nil && f > 0 && f < 1 {
+		cfg.BunchRatio = f
+	}
+	if f, err := strconv.ParseFloat(os.Getenv("HEADWAY_GAP_RATIO"), 64); err == nil && f > 1 {
+		cfg.GapRatio = f
+	}
+	if d, err := time.ParseDuration(os.Getenv("HEADWAY_MIN_GAP")); err == nil && d >= 0 {
+		cfg.MinGap = d
+	}
+	if b, err := strconv.ParseBool(os.Getenv("HEADWAY_ALERTS")); err == nil {
+		cfg.Alerts = b
+	}
+	if d, err := time.ParseDuration(os.Getenv("HEADWAY_ALERT_AFTER")); err == nil && d >= 0 {
+		cfg.AlertAfter = d
+	}
+	return cfg
+}
+
+// Headway is the time between a vehicle and the one ahead of it on the same
+// route and direction, where the vehicle is
+type Headway struct {
+	AgencyID        string    `json:"agency_id"`
+	RouteID         string    `json:"route_id"`
+	Direction       int       `json:"direction"`
+	TripID          string    `json:"trip_id"`
+	VehicleID       string    `json:"vehicle_id"`
+	LeaderTripID    string    `json:"leader_trip_id"`
+	LeaderVehicleID string    `json:"leader_vehicle_id"`
+	StopID          string    `json:"stop_id"`        // stop last passed by the vehicle
+	Headway         int       `json:"headway_secs"`   // since the vehicle ahead passed there
+	Scheduled       int       `json:"scheduled_secs"` // between the two trips there on the schedule
+	Status          string    `json:"status"`
+	ObservedAt      time.Time `json:"observed_at"`
+}
+
+// status compares a headway with the scheduled one
+func (cfg Config) status(headway, scheduled int) string {
+	switch {
+	case float64(headway) <= cfg.BunchRatio*float64(scheduled):
+		return StatusBunched
+	case float64(headway) >= cfg.GapRatio*float64(scheduled) && headway-scheduled >= int(cfg.MinGap.Seconds()):
+		return StatusGap
+	}
+	return StatusOK
+}
+
+// groupKey identifies the vehicles running one behind the other
+type groupKey struct {
+	agencyID  string
+	routeID   string
+	direction int
+}
+
+// Measure returns the headway of each vehicle seen within cfg.MaxAge of now
+// behind the one ahead of it, by route, direction and trip
+func Measure(positions []eta.Position, cfg Config, now time.Time) []Headway {
+	groups := make(map[groupKey][]eta.Position)
+	for _, p := range positions {
+		if now.Sub(p.At) > cfg.MaxAge || len(p.Stops) == 0 {
+			continue
+		}
+		k := groupKey{p.AgencyID, p.RouteID, p.Direction}
+		groups[k] = append(groups[k], p)
+	}
+
+	headways := []Headway{}
+	for _, group := range groups {
+		headways = append(headways, measureGroup(group, cfg)...)
+	}
+	sort.Slice(headways, func(i, j int) bool {
+		a, b := headways[i], headways[j]
+		if a.RouteID != b.RouteID {
+			return a.RouteID < b.RouteID
+		}
+		if a.Direction != b.Direction {
+			return a.Direction < b.Direction
+		}
+		return a.TripID < b.TripID
+	})
+	return headways
+}
+
+// measureGroup orders the vehicles of a route and direction along the trip
+// calling at the most stops, on which the others' stops are looked up, and
+// measures each behind the one before it
+func measureGroup(group []eta.Position, cfg Config) []Headway {
+	ref := group[0].Stops
+	for _, p := range group {
+		if len(p.Stops) > len(ref) {
+			ref = p.Stops
+		}
+	}
+
+	type along struct {
+		position eta.Position
+		at       float64 // stops of ref passed
+	}
+	ordered := make([]along, 0, len(group))
+	for _, p := range group {
+		stopID := p.Stops[p.Index].StopID
+		for i, s := range ref {
+			if s.StopID == stopID {
+				ordered = append(ordered, along{p, float64(i) + p.Progress})
+				break
+			}
+		}
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].at != ordered[j].at {
+			return ordered[i].at > ordered[j].at
+		}
+		return ordered[i].position.TripID < ordered[j].position.TripID
+	})
+
+	var headways []Headway
+	for i := 1; i < len(ordered); i++ {
+		if h, ok := measure(ordered[i-1].position, ordered[i].position, cfg); ok {
+			headways = append(headways, h)
+		}
+	}
+	return headways
+}
+
+// measure works out when the leader passed where the follower is, from the
+// scheduled running time between there and where the leader was seen, and
+// compares the time since with the schedule of both trips there
+func measure(leader, follower eta.Position, cfg Config) (Headway, bool) {
+	stopID := follower.Stops[follower.Index].StopID
+	at := -1
+	for i := leader.Index; i >= 0; i-- {
+		if leader.Stops[i].StopID == stopID {
+			at = i
+			break
+		}
+	}
+	if at < 0 || (at == leader.Index && leader.Progress < follower.Progress) {
+		return Headway{}, false
+	}
+
+	leaderThere := eta.ScheduledAt(leader.Stops, at, follower.Progress)
+	ahead := time.Duration(leader.ScheduledSecs()-leaderThere) * time.Second
+	headway := int(follower.At.Sub(leader.At.Add(-ahead)).Seconds())
+	scheduled := follower.ScheduledSecs() - leaderThere
+	if scheduled <= 0 || time.Duration(scheduled)*time.Second > maxScheduled {
+		return Headway{}, false
+	}
+	headway = max(headway, 0)
+
+	return Headway{
+		AgencyID:        follower.AgencyID,
+		RouteID:         follower.RouteID,
+		Direction:       follower.Direction,
+		TripID:          follower.TripID,
+		VehicleID:       follower.VehicleID,
+		LeaderTripID:    leader.TripID,
+		LeaderVehicleID: leader.VehicleID,
+		StopID:          stopID,
+		Headway:         headway,
+		Scheduled:       scheduled,
+		Status:          cfg.status(headway, scheduled),
+		ObservedAt:      follower.At,
+	}, true
+}
+
+// Irregular returns the routes with a bunched vehicle or a gap and how;
+// bunching wins, as the gap behind bunched vehicles follows from it
+func Irregular(headways []Headway) map[string]string {
+	routes := make(map[string]string)
+	for _, h := range headways {
+		switch {
+		case h.Status == StatusBunched:
+			routes[h.RouteID] = StatusBunched
+		case h.Status == StatusGap && routes[h.RouteID] == "":
+			routes[h.RouteID] = StatusGap
+		}
+	}
+	return routes
+}
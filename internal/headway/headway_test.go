@@ -0,0 +1,122 @@
+package headway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/alerts"
+	"github.com/passbi/passbi_core/internal/eta"
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// tripStops calls at A, B, C and D five minutes apart from start (seconds
+// since midnight)
+func tripStops(start int) []eta.Stop {
+	stops := make([]eta.Stop, 4)
+	for i, id := range []string{"A", "B", "C", "D"} {
+		secs := start + 300*i
+		stops[i] = eta.Stop{Sequence: i + 1, StopID: id, ArrivalSecs: secs, DepartureSecs: secs}
+	}
+	return stops
+}
+
+func position(tripID string, start, index int, progress float64, at time.Time) eta.Position {
+	return eta.Position{
+		AgencyID: "dakar_dem_dikk", TripID: tripID, RouteID: "R1", VehicleID: "V" + tripID,
+		At: at, Stops: tripStops(start), Index: index, Progress: progress,
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	cfg := DefaultConfig()
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	at := func(h, m int) time.Time { return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute) }
+	now := at(7, 15)
+
+	// T1 left at 7:00 and runs five minutes late at C; T2, ten minutes
+	// behind, runs early halfway from B to C: T1 passed there 150 s ago
+	headways := Measure([]eta.Position{
+		position("T2", 7*3600+600, 1, 0.5, now),
+		position("T1", 7*3600, 2, 0, now),
+	}, cfg, now)
+	if assert.Len(t, headways, 1) {
+		h := headways[0]
+		assert.Equal(t, "T2", h.TripID)
+		assert.Equal(t, "T1", h.LeaderTripID)
+		assert.Equal(t, "VT1", h.LeaderVehicleID)
+		assert.Equal(t, "B", h.StopID)
+		assert.Equal(t, 150, h.Headway)
+		assert.Equal(t, 600, h.Scheduled)
+		assert.Equal(t, StatusBunched, h.Status)
+	}
+
+	// T1, two minutes late at D, passed A at 7:02; T2 reaches A eleven
+	// minutes late
+	now = at(7, 21)
+	headways = Measure([]eta.Position{
+		position("T1", 7*3600, 3, 0, at(7, 17)),
+		position("T2", 7*3600+600, 0, 0, now),
+	}, cfg, now)
+	if assert.Len(t, headways, 1) {
+		assert.Equal(t, 1140, headways[0].Headway)
+		assert.Equal(t, StatusOK, headways[0].Status, "not twice the schedule")
+	}
+	// Five minutes behind on the schedule, T2 trails a gap of fifteen
+	headways = Measure([]eta.Position{
+		position("T1", 7*3600, 3, 0, now),
+		position("T2", 7*3600+300, 0, 0, now),
+	}, cfg, now)
+	if assert.Len(t, headways, 1) {
+		assert.Equal(t, 900, headways[0].Headway)
+		assert.Equal(t, 300, headways[0].Scheduled)
+		assert.Equal(t, StatusGap, headways[0].Status)
+	}
+
+	// Vehicles in the other direction, or seen too long ago, are not paired
+	other := position("T3", 7*3600+600, 1, 0, now)
+	other.Direction = 1
+	stale := position("T4", 7*3600+1200, 0, 0, now.Add(-cfg.MaxAge-time.Second))
+	headways = Measure([]eta.Position{position("T1", 7*3600, 2, 0, now), other, stale}, cfg, now)
+	assert.Empty(t, headways)
+}
+
+func TestIrregular(t *testing.T) {
+	routes := Irregular([]Headway{
+		{RouteID: "R1", Status: StatusGap},
+		{RouteID: "R1", Status: StatusBunched},
+		{RouteID: "R1", Status: StatusGap},
+		{RouteID: "R2", Status: StatusGap},
+		{RouteID: "R3", Status: StatusOK},
+	})
+	assert.Equal(t, map[string]string{"R1": StatusBunched, "R2": StatusGap}, routes)
+}
+
+func TestRouteAlert(t *testing.T) {
+	starts := time.Date(2026, 3, 2, 7, 15, 0, 0, time.UTC)
+	a := routeAlert("R1", "12", StatusBunched, starts, starts.Add(3*time.Minute))
+	assert.Equal(t, "Irregular service on line 12", a.Title)
+	assert.Equal(t, alerts.SourceHeadway, a.Source)
+	assert.Equal(t, []models.AlertEntity{{RouteID: "R1"}}, a.Entities)
+	if assert.NotNil(t, a.EndsAt) {
+		assert.Equal(t, starts.Add(3*time.Minute), *a.EndsAt)
+	}
+
+	a = routeAlert("R1", "", StatusGap, starts, starts.Add(time.Minute))
+	assert.Equal(t, "Longer waits on line R1", a.Title)
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("HEADWAY_INTERVAL", "30s")
+	t.Setenv("HEADWAY_BUNCH_RATIO", "1.5")
+	t.Setenv("HEADWAY_GAP_RATIO", "3")
+	t.Setenv("HEADWAY_ALERTS", "false")
+	t.Setenv("ETA_MATCH_MAX_OFFSET", "80")
+
+	cfg := ConfigFromEnv()
+	assert.Equal(t, 30*time.Second, cfg.Interval)
+	assert.Equal(t, 0.25, cfg.BunchRatio, "a ratio of 1 or more is ignored")
+	assert.Equal(t, 3.0, cfg.GapRatio)
+	assert.False(t, cfg.Alerts)
+	assert.Equal(t, 80.0, cfg.Locate.MatchOffset)
+}
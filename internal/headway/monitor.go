@@ -0,0 +1,269 @@
+package headway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/passbi/passbi_core/internal/alerts"
+	"github.com/passbi/passbi_core/internal/eta"
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/passbi/passbi_core/internal/repository"
+)
+
+// Run measures the headways of the vehicles in service every cfg.Interval
+// until ctx is done
+// Several instances may run it: one measures at a time
+func Run(ctx context.Context, pool *pgxpool.Pool, cfg Config) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			runCtx, cancel := context.WithTimeout(ctx, cfg.Interval)
+			_, err := Monitor(runCtx, pool, cfg, now)
+			cancel()
+			if err != nil {
+				logger.ErrorContext(ctx, "Headway monitoring failed", "error", err)
+			}
+		}
+	}
+}
+
+var headwayColumns = []string{
+	"agency_id", "trip_id", "route_id", "direction", "vehicle_id", "leader_trip_id",
+	"leader_vehicle_id", "stop_id", "headway_secs", "scheduled_secs", "status", "observed_at",
+}
+
+// Monitor measures the headways of the vehicles seen within cfg.MaxAge of
+// now, stores them in place of the previous pass and, with cfg.Alerts,
+// raises or lifts the alerts of irregular routes
+// It returns how many headways were measured; it does nothing when another
+// instance is measuring
+func Monitor(ctx context.Context, pool *pgxpool.Pool, cfg Config, now time.Time) (int, error) {
+	positions, err := eta.Locate(ctx, pool, cfg.Locate, now)
+	if err != nil {
+		return 0, err
+	}
+	headways := Measure(positions, cfg, now)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var locked bool
+	if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock(hashtext('passbi:headways'))`).Scan(&locked); err != nil {
+		return 0, fmt.Errorf("failed to take the headway lock: %w", err)
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM route_headway`); err != nil {
+		return 0, fmt.Errorf("failed to clear headways: %w", err)
+	}
+	rows := make([][]any, len(headways))
+	for i, h := range headways {
+		rows[i] = []any{h.AgencyID, h.TripID, h.RouteID, h.Direction, h.VehicleID, h.LeaderTripID,
+			h.LeaderVehicleID, h.StopID, h.Headway, h.Scheduled, h.Status, h.ObservedAt}
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"route_headway"}, headwayColumns, pgx.CopyFromRows(rows)); err != nil {
+		return 0, fmt.Errorf("failed to store headways: %w", err)
+	}
+
+	if cfg.Alerts {
+		if err := updateAlerts(ctx, tx, cfg, Irregular(headways), now); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit headways: %w", err)
+	}
+	return len(headways), nil
+}
+
+// flag is a route found irregular and the alert raised for it
+type flag struct {
+	status  string
+	since   time.Time
+	alertID *int64
+}
+
+// updateAlerts keeps track of the irregular routes: a route irregular for
+// cfg.AlertAfter gets an alert, which each pass extends while the route stays
+// irregular and ends once it is regular again
+// Alerts end on their own a few intervals after the last pass, and one an
+// operator expired early stays expired
+func updateAlerts(ctx context.Context, tx pgx.Tx, cfg Config, irregular map[string]string, now time.Time) error {
+	rows, err := tx.Query(ctx, `SELECT route_id, status, flagged_since, alert_id FROM headway_alert FOR UPDATE`)
+	if err != nil {
+		return fmt.Errorf("failed to query headway alerts: %w", err)
+	}
+	flags := make(map[string]flag)
+	for rows.Next() {
+		var routeID string
+		var f flag
+		if err := rows.Scan(&routeID, &f.status, &f.since, &f.alertID); err != nil {
+			rows.Close()
+			return err
+		}
+		flags[routeID] = f
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query headway alerts: %w", err)
+	}
+
+	for routeID, f := range flags {
+		if _, ok := irregular[routeID]; ok {
+			continue
+		}
+		if f.alertID != nil {
+			if _, err := tx.Exec(ctx, `
+				UPDATE service_alert SET ends_at = GREATEST($2, starts_at + INTERVAL '1 second')
+				WHERE id = $1 AND (ends_at IS NULL OR ends_at > $2)
+			`, *f.alertID, now); err != nil {
+				return fmt.Errorf("failed to end headway alert: %w", err)
+			}
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM headway_alert WHERE route_id = $1`, routeID); err != nil {
+			return fmt.Errorf("failed to clear headway alert: %w", err)
+		}
+	}
+	if len(irregular) == 0 {
+		return nil
+	}
+
+	routeIDs := make([]string, 0, len(irregular))
+	for routeID := range irregular {
+		routeIDs = append(routeIDs, routeID)
+	}
+	sort.Strings(routeIDs)
+	names, err := repository.RouteNames(ctx, tx, routeIDs)
+	if err != nil {
+		return fmt.Errorf("failed to query route names: %w", err)
+	}
+
+	ends := now.Add(3 * cfg.Interval)
+	for _, routeID := range routeIDs {
+		status := irregular[routeID]
+		f, ok := flags[routeID]
+		if !ok {
+			f = flag{since: now}
+		}
+		alert := routeAlert(routeID, names[routeID], status, now, ends)
+
+		switch {
+		case f.alertID != nil:
+			if _, err := tx.Exec(ctx, `
+				UPDATE service_alert SET title = $2, description = $3, ends_at = $4
+				WHERE id = $1 AND (ends_at IS NULL OR ends_at > $5)
+			`, *f.alertID, alert.Title, alert.Description, ends, now); err != nil {
+				return fmt.Errorf("failed to extend headway alert: %w", err)
+			}
+		case now.Sub(f.since) >= cfg.AlertAfter:
+			if err := alerts.Normalize(&alert); err != nil {
+				return err
+			}
+			if err := alerts.CreateTx(ctx, tx, &alert); err != nil {
+				return err
+			}
+			f.alertID = &alert.ID
+			logger.Info("Raised headway alert", "route_id", routeID, "status", status, "alert_id", alert.ID)
+		}
+
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO headway_alert (route_id, status, flagged_since, alert_id, updated_at)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (route_id) DO UPDATE
+			SET status = EXCLUDED.status, alert_id = EXCLUDED.alert_id, updated_at = EXCLUDED.updated_at
+		`, routeID, status, f.since, f.alertID, now); err != nil {
+			return fmt.Errorf("failed to store headway alert: %w", err)
+		}
+	}
+	return nil
+}
+
+// routeAlert is the alert riders of an irregular route see
+func routeAlert(routeID, name, status string, starts, ends time.Time) models.ServiceAlert {
+	if name == "" {
+		name = routeID
+	}
+	a := models.ServiceAlert{
+		Title:       fmt.Sprintf("Longer waits on line %s", name),
+		Description: "Vehicles on this line are further apart than scheduled: expect a longer wait than usual.",
+		Severity:    models.SeverityWarning,
+		Cause:       "UNKNOWN_CAUSE",
+		Effect:      "SIGNIFICANT_DELAYS",
+		Source:      alerts.SourceHeadway,
+		StartsAt:    starts,
+		EndsAt:      &ends,
+		Entities:    []models.AlertEntity{{RouteID: routeID}},
+	}
+	if status == StatusBunched {
+		a.Title = fmt.Sprintf("Irregular service on line %s", name)
+		a.Description = "Vehicles on this line are running bunched together: expect a longer wait than usual, then several vehicles close behind each other."
+	}
+	return a
+}
+
+// RouteFlag is how a route has been irregular, with the alert raised for it
+type RouteFlag struct {
+	Status  string
+	Since   time.Time
+	AlertID *int64
+}
+
+// Route returns the headways of a route measured by the last pass, unless
+// they are older than a pass should leave them, and how the route has been
+// irregular, nil when it is not
+func Route(ctx context.Context, pool *pgxpool.Pool, cfg Config, routeID string, now time.Time) ([]Headway, *RouteFlag, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT agency_id, trip_id, route_id, direction, vehicle_id, leader_trip_id, leader_vehicle_id,
+			stop_id, headway_secs, scheduled_secs, status, observed_at
+		FROM route_headway
+		WHERE route_id = $1 AND observed_at > $2
+		ORDER BY direction, trip_id
+	`, routeID, now.Add(-cfg.MaxAge-cfg.Interval))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query headways: %w", err)
+	}
+	defer rows.Close()
+
+	headways := []Headway{}
+	for rows.Next() {
+		var h Headway
+		if err := rows.Scan(&h.AgencyID, &h.TripID, &h.RouteID, &h.Direction, &h.VehicleID, &h.LeaderTripID,
+			&h.LeaderVehicleID, &h.StopID, &h.Headway, &h.Scheduled, &h.Status, &h.ObservedAt); err != nil {
+			return nil, nil, err
+		}
+		headways = append(headways, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to query headways: %w", err)
+	}
+
+	var f RouteFlag
+	err = pool.QueryRow(ctx, `
+		SELECT status, flagged_since, alert_id FROM headway_alert
+		WHERE route_id = $1 AND updated_at > $2
+	`, routeID, now.Add(-cfg.MaxAge-cfg.Interval)).Scan(&f.Status, &f.Since, &f.AlertID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return headways, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query headway alert: %w", err)
+	}
+	return headways, &f, nil
+}
@@ -0,0 +1,248 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Run archives the days over every cfg.Interval until ctx is done
+// Several instances may run it: one archives a day at a time
+func Run(ctx context.Context, pool *pgxpool.Pool, cfg Config) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := Archive(ctx, pool, cfg, now); err != nil {
+				logger.ErrorContext(ctx, "Vehicle position archive failed", "error", err)
+			}
+			if cfg.Retention > 0 {
+				if _, err := Purge(ctx, pool, now.Add(-cfg.Retention)); err != nil {
+					logger.ErrorContext(ctx, "Vehicle history retention failed", "error", err)
+				}
+			}
+		}
+	}
+}
+
+// arrivalsQuery selects the first fix of each vehicle and trip recorded in
+// [$1, $2) within $3 meters of each stop of the trip, for trip $4 or every
+// trip when NULL; a loop trip visiting a stop twice gets the same fix for both
+const arrivalsQuery = `
+	SELECT DISTINCT ON (vp.agency_id, vp.trip_id, vp.vehicle_id, st.stop_sequence)
+		vp.agency_id, vp.trip_id, vp.vehicle_id, st.stop_sequence, st.stop_id, vp.recorded_at
+	FROM vehicle_position vp
+	JOIN stop_time st ON st.agency_id = vp.agency_id AND st.trip_id = vp.trip_id
+	JOIN stop s ON s.id = st.stop_id
+	WHERE vp.recorded_at >= $1 AND vp.recorded_at < $2
+	  AND ($4::text IS NULL OR vp.trip_id = $4)
+	  AND ST_DWithin(s.geom, ST_SetSRID(ST_MakePoint(vp.lon, vp.lat), 4326)::geography, $3)
+	ORDER BY vp.agency_id, vp.trip_id, vp.vehicle_id, st.stop_sequence, vp.recorded_at
+`
+
+var historyColumns = []string{
+	"agency_id", "trip_id", "service_date", "vehicle_id", "route_id",
+	"recorded_at", "lats", "lons", "speeds", "fixes",
+}
+
+// Archive archives each day over cfg.Delay before now whose positions are
+// not archived yet, oldest first
+// It returns how many days it archived; days another instance is archiving
+// are left to it
+func Archive(ctx context.Context, pool *pgxpool.Pool, cfg Config, now time.Time) (int, error) {
+	last := now.Add(-cfg.Delay).UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	rows, err := pool.Query(ctx, `
+		SELECT d::date FROM generate_series(
+			(SELECT (MIN(recorded_at) AT TIME ZONE 'UTC')::date FROM vehicle_position),
+			$1::date, INTERVAL '1 day') AS d
+		WHERE NOT EXISTS (SELECT 1 FROM vehicle_history_day h WHERE h.service_date = d::date)
+		ORDER BY d
+	`, last)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query days to archive: %w", err)
+	}
+	var days []time.Time
+	for rows.Next() {
+		var day time.Time
+		if err := rows.Scan(&day); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		days = append(days, day)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to query days to archive: %w", err)
+	}
+
+	archived := 0
+	for _, day := range days {
+		ok, err := archiveDay(ctx, pool, cfg, day)
+		if err != nil {
+			return archived, err
+		}
+		if !ok {
+			break
+		}
+		archived++
+	}
+	return archived, nil
+}
+
+// archiveDay downsamples the positions of the trips of day into
+// vehicle_trip_history and records their stop arrivals
+// It returns false when another instance is archiving or archived the day
+func archiveDay(ctx context.Context, pool *pgxpool.Pool, cfg Config, day time.Time) (bool, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var locked bool
+	if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock(hashtext('passbi:history-archive'))`).Scan(&locked); err != nil {
+		return false, fmt.Errorf("failed to take the archive lock: %w", err)
+	}
+	if !locked {
+		return false, nil
+	}
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO vehicle_history_day (service_date, trips, fixes, points) VALUES ($1, 0, 0, 0)
+		ON CONFLICT (service_date) DO NOTHING
+	`, day)
+	if err != nil {
+		return false, fmt.Errorf("failed to record archived day: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	start, end := day, day.AddDate(0, 0, 1)
+	paths, err := loadPaths(ctx, pool, start, end, nil)
+	if err != nil {
+		return false, err
+	}
+	rows := make([][]any, len(paths))
+	fixes, points := 0, 0
+	for i, p := range paths {
+		kept := Downsample(p.points, cfg)
+		at, lats, lons, speeds := make([]time.Time, len(kept)), make([]float64, len(kept)), make([]float64, len(kept)), make([]*float64, len(kept))
+		for j, pt := range kept {
+			at[j], lats[j], lons[j], speeds[j] = pt.At, pt.Lat, pt.Lon, pt.Speed
+		}
+		var routeID *string
+		if p.routeID != "" {
+			routeID = &p.routeID
+		}
+		rows[i] = []any{p.agencyID, p.tripID, day, p.vehicleID, routeID, at, lats, lons, speeds, len(p.points)}
+		fixes += len(p.points)
+		points += len(kept)
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"vehicle_trip_history"}, historyColumns, pgx.CopyFromRows(rows)); err != nil {
+		return false, fmt.Errorf("failed to archive vehicle paths: %w", err)
+	}
+
+	arrivals, err := tx.Exec(ctx, `
+		INSERT INTO vehicle_trip_arrival (agency_id, trip_id, service_date, vehicle_id, stop_sequence, stop_id, arrived_at)
+		SELECT a.agency_id, a.trip_id, $5::date, a.vehicle_id, a.stop_sequence, a.stop_id, a.recorded_at
+		FROM (`+arrivalsQuery+`) a
+	`, start, end, cfg.ArrivalRadius, nil, day)
+	if err != nil {
+		return false, fmt.Errorf("failed to archive stop arrivals: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE vehicle_history_day SET trips = $2, fixes = $3, points = $4, archived_at = NOW()
+		WHERE service_date = $1
+	`, day, len(paths), fixes, points); err != nil {
+		return false, fmt.Errorf("failed to record archived day: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit archived day: %w", err)
+	}
+	logger.Info("Archived vehicle positions", "date", day.Format("2006-01-02"), "trips", len(paths),
+		"fixes", fixes, "points", points, "arrivals", arrivals.RowsAffected())
+	return true, nil
+}
+
+// path is the fixes of a vehicle on a trip, in time order
+type path struct {
+	agencyID  string
+	tripID    string
+	vehicleID string
+	routeID   string
+	points    []Point
+}
+
+// loadPaths returns the paths of the fixes recorded in [start, end), of trip
+// tripID or every trip when nil, by agency, trip and vehicle
+func loadPaths(ctx context.Context, pool *pgxpool.Pool, start, end time.Time, tripID *string) ([]path, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT agency_id, trip_id, vehicle_id, COALESCE(route_id, ''), lat, lon, speed, recorded_at
+		FROM vehicle_position
+		WHERE recorded_at >= $1 AND recorded_at < $2 AND trip_id IS NOT NULL
+		  AND ($3::text IS NULL OR trip_id = $3)
+		ORDER BY agency_id, trip_id, vehicle_id, recorded_at
+	`, start, end, tripID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query vehicle positions: %w", err)
+	}
+	defer rows.Close()
+
+	var paths []path
+	for rows.Next() {
+		var agencyID, trip, vehicleID, routeID string
+		var p Point
+		if err := rows.Scan(&agencyID, &trip, &vehicleID, &routeID, &p.Lat, &p.Lon, &p.Speed, &p.At); err != nil {
+			return nil, err
+		}
+		n := len(paths)
+		if n == 0 || paths[n-1].agencyID != agencyID || paths[n-1].tripID != trip || paths[n-1].vehicleID != vehicleID {
+			paths = append(paths, path{agencyID: agencyID, tripID: trip, vehicleID: vehicleID})
+			n++
+		}
+		if routeID != "" {
+			paths[n-1].routeID = routeID
+		}
+		paths[n-1].points = append(paths[n-1].points, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query vehicle positions: %w", err)
+	}
+	return paths, nil
+}
+
+// Purge deletes the paths and arrivals archived for days before the given
+// time
+func Purge(ctx context.Context, pool *pgxpool.Pool, before time.Time) (int64, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `DELETE FROM vehicle_trip_history WHERE service_date < $1::date`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge vehicle history: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM vehicle_trip_arrival WHERE service_date < $1::date`, before); err != nil {
+		return 0, fmt.Errorf("failed to purge vehicle history: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM vehicle_history_day WHERE service_date < $1::date`, before); err != nil {
+		return 0, fmt.Errorf("failed to purge vehicle history: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit vehicle history purge: %w", err)
+	}
+	if n := tag.RowsAffected(); n > 0 {
+		logger.Info("Purged old vehicle history", "paths", n)
+	}
+	return tag.RowsAffected(), nil
+}
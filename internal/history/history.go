@@ -0,0 +1,154 @@
+// Package history archives the vehicle positions the API drops after
+// VEHICLE_POSITION_RETENTION: once a day is over, the path of each vehicle on
+// each trip is downsampled and kept with the time it reached each stop, for
+// operator performance reports and ETA training. It replays a trip's path and
+// timings for a past date
+package history
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/eta"
+	"github.com/passbi/passbi_core/internal/logging"
+	"github.com/passbi/passbi_core/internal/mapmatch"
+)
+
+var logger = logging.For("history")
+
+// Config holds the archive settings
+type Config struct {
+	Interval      time.Duration // how often days over are archived
+	Delay         time.Duration // how long after the end of a day (UTC) it is archived, for late fixes
+	Spacing       time.Duration // least time between archived points of a path
+	MinMovement   float64       // meters a vehicle must move from the last point for the next to be kept
+	IdleSpacing   time.Duration // time after which a standing vehicle gets a point anyway
+	Retention     time.Duration // how long archived paths are kept, 0 for ever
+	ArrivalRadius float64       // meters from a stop at which a fix counts as reaching it
+}
+
+// DefaultConfig archives each day two hours after it ended, keeping a point
+// every 30 seconds while the vehicle moves and every 5 minutes while it
+// stands, for a year
+func DefaultConfig() Config {
+	return Config{
+		Interval:      time.Hour,
+		Delay:         2 * time.Hour,
+		Spacing:       30 * time.Second,
+		MinMovement:   20,
+		IdleSpacing:   5 * time.Minute,
+		Retention:     365 * 24 * time.Hour,
+		ArrivalRadius: eta.DefaultConfig().ArrivalRadius,
+	}
+}
+
+// ConfigFromEnv returns the defaults overridden by HISTORY_* variables; the
+// arrival radius is ETA_ARRIVAL_RADIUS, as for learned arrivals
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	if d, err := time.ParseDuration(os.Getenv("HISTORY_INTERVAL")); err == nil && d > 0 {
+		cfg.Interval = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("HISTORY_DELAY")); err == nil && d >= 0 {
+		cfg.Delay = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("HISTORY_SPACING")); err == nil && d >= 0 {
+		cfg.Spacing = d
+	}
+	if f, err := strconv.ParseFloat(os.Getenv("HISTORY_MIN_MOVEMENT"), 64); err == nil && f >= 0 {
+		cfg.MinMovement = f
+	}
+	if d, err := time.ParseDuration(os.Getenv("HISTORY_IDLE_SPACING")); err == nil && d > 0 {
+		cfg.IdleSpacing = d
+	}
+	// Zero is allowed: archived paths are then kept for ever
+	if d, err := time.ParseDuration(os.Getenv("HISTORY_RETENTION")); err == nil && d >= 0 {
+		cfg.Retention = d
+	}
+	cfg.ArrivalRadius = eta.ConfigFromEnv().ArrivalRadius
+	return cfg
+}
+
+// Point is a position of a vehicle on its path
+type Point struct {
+	At    time.Time `json:"at"`
+	Lat   float64   `json:"lat"`
+	Lon   float64   `json:"lon"`
+	Speed *float64  `json:"speed,omitempty"` // m/s
+}
+
+// Downsample keeps the points of a path, in time order, at least
+// cfg.Spacing apart that moved cfg.MinMovement from the last one kept, or
+// cfg.IdleSpacing apart when the vehicle stood; the first and last points are
+// always kept
+func Downsample(points []Point, cfg Config) []Point {
+	if len(points) <= 2 {
+		return points
+	}
+	kept := []Point{points[0]}
+	for _, p := range points[1 : len(points)-1] {
+		last := kept[len(kept)-1]
+		elapsed := p.At.Sub(last.At)
+		if elapsed >= cfg.IdleSpacing ||
+			(elapsed >= cfg.Spacing && mapmatch.Distance(last.Lat, last.Lon, p.Lat, p.Lon) >= cfg.MinMovement) {
+			kept = append(kept, p)
+		}
+	}
+	return append(kept, points[len(points)-1])
+}
+
+// Call is a scheduled stop of a trip, in seconds since midnight of its
+// service day
+type Call struct {
+	Sequence int
+	StopID   string
+	Secs     int
+}
+
+// Arrival is when a vehicle reached a stop of its trip
+type Arrival struct {
+	Sequence int
+	StopID   string
+	At       time.Time
+}
+
+// StopTiming compares when a vehicle reached a stop with the schedule
+// A stop without arrival was passed without a fix nearby, or not reached;
+// one without schedule is no longer in the trip since the feed changed
+type StopTiming struct {
+	Sequence  int        `json:"stop_sequence"`
+	StopID    string     `json:"stop_id"`
+	Scheduled *time.Time `json:"scheduled_at,omitempty"`
+	Arrived   *time.Time `json:"arrived_at,omitempty"`
+	Delay     *int       `json:"delay_secs,omitempty"`
+}
+
+// Timings lines up the arrivals of a vehicle with the calls of its trip on
+// date, in sequence order
+func Timings(calls []Call, arrivals []Arrival, date time.Time) []StopTiming {
+	bySequence := make(map[int]Arrival, len(arrivals))
+	for _, a := range arrivals {
+		bySequence[a.Sequence] = a
+	}
+
+	timings := make([]StopTiming, 0, len(calls)+len(arrivals))
+	for _, c := range calls {
+		scheduled := date.Add(time.Duration(c.Secs) * time.Second)
+		t := StopTiming{Sequence: c.Sequence, StopID: c.StopID, Scheduled: &scheduled}
+		if a, ok := bySequence[c.Sequence]; ok {
+			arrived := a.At
+			delay := int(arrived.Sub(scheduled).Seconds())
+			t.Arrived, t.Delay = &arrived, &delay
+			delete(bySequence, c.Sequence)
+		}
+		timings = append(timings, t)
+	}
+	for _, a := range bySequence {
+		arrived := a.At
+		timings = append(timings, StopTiming{Sequence: a.Sequence, StopID: a.StopID, Arrived: &arrived})
+	}
+	sort.Slice(timings, func(i, j int) bool { return timings[i].Sequence < timings[j].Sequence })
+	return timings
+}
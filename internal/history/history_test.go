@@ -0,0 +1,81 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownsample(t *testing.T) {
+	cfg := DefaultConfig()
+	start := time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC)
+	at := func(secs int) time.Time { return start.Add(time.Duration(secs) * time.Second) }
+
+	// A fix every 10 s: moving about 100 m each for a minute, then standing
+	// for ten minutes, then one last move
+	var points []Point
+	for i := 0; i <= 6; i++ {
+		points = append(points, Point{At: at(10 * i), Lat: 14.69 + 0.001*float64(i), Lon: -17.44})
+	}
+	for i := 7; i <= 66; i++ {
+		points = append(points, Point{At: at(10 * i), Lat: 14.696, Lon: -17.44})
+	}
+	points = append(points, Point{At: at(670), Lat: 14.697, Lon: -17.44})
+
+	kept := Downsample(points, cfg)
+	var secs []int
+	for _, p := range kept {
+		secs = append(secs, int(p.At.Sub(start).Seconds()))
+	}
+	// Every 30 s while moving, every 5 minutes standing, and the last fix
+	assert.Equal(t, []int{0, 30, 60, 360, 660, 670}, secs)
+
+	assert.Len(t, Downsample(points[:2], cfg), 2)
+	assert.Empty(t, Downsample(nil, cfg))
+}
+
+func TestTimings(t *testing.T) {
+	date := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	calls := []Call{
+		{Sequence: 1, StopID: "A", Secs: 7 * 3600},
+		{Sequence: 2, StopID: "B", Secs: 7*3600 + 300},
+		{Sequence: 3, StopID: "C", Secs: 7*3600 + 600},
+	}
+	arrivals := []Arrival{
+		{Sequence: 3, StopID: "C", At: date.Add(7*time.Hour + 12*time.Minute)},
+		{Sequence: 1, StopID: "A", At: date.Add(7*time.Hour + 30*time.Second)},
+		// No longer in the trip
+		{Sequence: 4, StopID: "D", At: date.Add(7*time.Hour + 15*time.Minute)},
+	}
+
+	timings := Timings(calls, arrivals, date)
+	if !assert.Len(t, timings, 4) {
+		return
+	}
+	assert.Equal(t, "A", timings[0].StopID)
+	if assert.NotNil(t, timings[0].Delay) {
+		assert.Equal(t, 30, *timings[0].Delay)
+	}
+	assert.Equal(t, date.Add(7*time.Hour+5*time.Minute), *timings[1].Scheduled)
+	assert.Nil(t, timings[1].Arrived, "passed without a fix nearby")
+	if assert.NotNil(t, timings[2].Delay) {
+		assert.Equal(t, 120, *timings[2].Delay)
+	}
+	assert.Equal(t, 4, timings[3].Sequence)
+	assert.Nil(t, timings[3].Scheduled)
+	assert.NotNil(t, timings[3].Arrived)
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("HISTORY_SPACING", "1m")
+	t.Setenv("HISTORY_RETENTION", "0")
+	t.Setenv("HISTORY_IDLE_SPACING", "-1m")
+	t.Setenv("ETA_ARRIVAL_RADIUS", "60")
+
+	cfg := ConfigFromEnv()
+	assert.Equal(t, time.Minute, cfg.Spacing)
+	assert.Equal(t, time.Duration(0), cfg.Retention, "zero keeps paths for ever")
+	assert.Equal(t, 5*time.Minute, cfg.IdleSpacing)
+	assert.Equal(t, 60.0, cfg.ArrivalRadius)
+}
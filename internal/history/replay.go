@@ -0,0 +1,196 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Replay is what the vehicles of a trip did on a day
+type Replay struct {
+	TripID   string       `json:"trip_id"`
+	Date     string       `json:"date"`
+	Archived bool         `json:"archived"` // false while the day is still read from the recent positions
+	Runs     []VehicleRun `json:"runs"`
+}
+
+// VehicleRun is the path of one vehicle on the trip and when it reached its
+// stops
+type VehicleRun struct {
+	AgencyID  string       `json:"agency_id"`
+	RouteID   string       `json:"route_id,omitempty"`
+	VehicleID string       `json:"vehicle_id"`
+	Fixes     int          `json:"fixes"` // recorded before downsampling
+	Points    []Point      `json:"points"`
+	Stops     []StopTiming `json:"stops"`
+}
+
+// TripReplay returns the runs of trip tripID on date (midnight UTC), from the
+// archive once the day is archived and from the positions still kept before
+// The trip is matched in every agency; a trip without any position that day
+// has no runs
+func TripReplay(ctx context.Context, pool *pgxpool.Pool, cfg Config, tripID string, date time.Time) (*Replay, error) {
+	replay := &Replay{TripID: tripID, Date: date.Format("2006-01-02"), Runs: []VehicleRun{}}
+	if err := pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM vehicle_history_day WHERE service_date = $1::date)
+	`, date).Scan(&replay.Archived); err != nil {
+		return nil, fmt.Errorf("failed to query archived days: %w", err)
+	}
+
+	var arrivals map[runKey][]Arrival
+	var err error
+	if replay.Archived {
+		replay.Runs, arrivals, err = archivedRuns(ctx, pool, tripID, date)
+	} else {
+		replay.Runs, arrivals, err = recentRuns(ctx, pool, cfg, tripID, date)
+	}
+	if err != nil || len(replay.Runs) == 0 {
+		return replay, err
+	}
+
+	calls, err := tripCalls(ctx, pool, tripID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range replay.Runs {
+		r := &replay.Runs[i]
+		r.Stops = Timings(calls[r.AgencyID], arrivals[runKey{r.AgencyID, r.VehicleID}], date)
+	}
+	return replay, nil
+}
+
+// runKey identifies a run of a trip by its agency and vehicle
+type runKey struct {
+	agencyID  string
+	vehicleID string
+}
+
+// archivedRuns reads the runs of a trip archived for date
+func archivedRuns(ctx context.Context, pool *pgxpool.Pool, tripID string, date time.Time) ([]VehicleRun, map[runKey][]Arrival, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT agency_id, vehicle_id, COALESCE(route_id, ''), recorded_at, lats, lons, speeds, fixes
+		FROM vehicle_trip_history
+		WHERE trip_id = $1 AND service_date = $2::date
+		ORDER BY agency_id, vehicle_id
+	`, tripID, date)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query vehicle history: %w", err)
+	}
+	runs := []VehicleRun{}
+	for rows.Next() {
+		var r VehicleRun
+		var at []time.Time
+		var lats, lons []float64
+		var speeds []*float64
+		if err := rows.Scan(&r.AgencyID, &r.VehicleID, &r.RouteID, &at, &lats, &lons, &speeds, &r.Fixes); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		r.Points = make([]Point, len(at))
+		for i := range at {
+			r.Points[i] = Point{At: at[i], Lat: lats[i], Lon: lons[i], Speed: speeds[i]}
+		}
+		runs = append(runs, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to query vehicle history: %w", err)
+	}
+	if len(runs) == 0 {
+		return runs, nil, nil
+	}
+
+	rows, err = pool.Query(ctx, `
+		SELECT agency_id, vehicle_id, stop_sequence, stop_id, arrived_at
+		FROM vehicle_trip_arrival
+		WHERE trip_id = $1 AND service_date = $2::date
+	`, tripID, date)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query stop arrivals: %w", err)
+	}
+	defer rows.Close()
+
+	arrivals := make(map[runKey][]Arrival)
+	for rows.Next() {
+		var k runKey
+		var a Arrival
+		if err := rows.Scan(&k.agencyID, &k.vehicleID, &a.Sequence, &a.StopID, &a.At); err != nil {
+			return nil, nil, err
+		}
+		arrivals[k] = append(arrivals[k], a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to query stop arrivals: %w", err)
+	}
+	return runs, arrivals, nil
+}
+
+// recentRuns builds the runs of a trip on date from vehicle_position, the
+// way the archive will
+func recentRuns(ctx context.Context, pool *pgxpool.Pool, cfg Config, tripID string, date time.Time) ([]VehicleRun, map[runKey][]Arrival, error) {
+	start, end := date, date.AddDate(0, 0, 1)
+	paths, err := loadPaths(ctx, pool, start, end, &tripID)
+	if err != nil {
+		return nil, nil, err
+	}
+	runs := make([]VehicleRun, len(paths))
+	for i, p := range paths {
+		runs[i] = VehicleRun{AgencyID: p.agencyID, RouteID: p.routeID, VehicleID: p.vehicleID,
+			Fixes: len(p.points), Points: Downsample(p.points, cfg)}
+	}
+	if len(runs) == 0 {
+		return runs, nil, nil
+	}
+
+	rows, err := pool.Query(ctx, arrivalsQuery, start, end, cfg.ArrivalRadius, tripID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query stop arrivals: %w", err)
+	}
+	defer rows.Close()
+
+	arrivals := make(map[runKey][]Arrival)
+	for rows.Next() {
+		var k runKey
+		var trip string
+		var a Arrival
+		if err := rows.Scan(&k.agencyID, &trip, &k.vehicleID, &a.Sequence, &a.StopID, &a.At); err != nil {
+			return nil, nil, err
+		}
+		arrivals[k] = append(arrivals[k], a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to query stop arrivals: %w", err)
+	}
+	return runs, arrivals, nil
+}
+
+// tripCalls returns the scheduled stops of a trip by agency, in sequence
+// order
+func tripCalls(ctx context.Context, pool *pgxpool.Pool, tripID string) (map[string][]Call, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT agency_id, stop_sequence, stop_id, COALESCE(arrival_seconds, departure_seconds)
+		FROM stop_time
+		WHERE trip_id = $1 AND COALESCE(arrival_seconds, departure_seconds) IS NOT NULL
+		ORDER BY agency_id, stop_sequence
+	`, tripID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stop times: %w", err)
+	}
+	defer rows.Close()
+
+	calls := make(map[string][]Call)
+	for rows.Next() {
+		var agencyID string
+		var c Call
+		if err := rows.Scan(&agencyID, &c.Sequence, &c.StopID, &c.Secs); err != nil {
+			return nil, err
+		}
+		calls[agencyID] = append(calls[agencyID], c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query stop times: %w", err)
+	}
+	return calls, nil
+}
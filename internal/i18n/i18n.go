@@ -0,0 +1,205 @@
+// Package i18n localizes API responses for the languages spoken on the
+// network: French (default), Wolof and English
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/passbi/passbi_core/internal/models"
+)
+
+// Supported languages, as lowercase primary subtags
+const (
+	French  = "fr"
+	Wolof   = "wo"
+	English = "en"
+)
+
+// Default is used when the client expresses no usable preference
+const Default = French
+
+var supported = map[string]bool{French: true, Wolof: true, English: true}
+
+// Negotiate picks the best supported language from an Accept-Language header
+// Region subtags are ignored (fr-SN matches fr); q=0 excludes a language
+func Negotiate(header string) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if v, ok := strings.CutPrefix(param, "q="); ok {
+				parsed, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					parsed = 0
+				}
+				q = parsed
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		lang := strings.SplitN(tag, "-", 2)[0]
+		if tag == "*" {
+			lang = Default
+		}
+		if supported[lang] {
+			candidates = append(candidates, candidate{lang: lang, q: q})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return Default
+	}
+
+	// Stable sort keeps header order between equal weights
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	return candidates[0].lang
+}
+
+// dayNames are indexed by time.Weekday (Sunday = 0)
+var dayNames = map[string][7]string{
+	French:  {"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+	Wolof:   {"Dibéer", "Altine", "Talaata", "Àllarba", "Alxamis", "Àjjuma", "Gaawu"},
+	English: {"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+}
+
+// dayIndex maps the English day keys used in API payloads to time.Weekday
+var dayIndex = map[string]int{
+	"sunday": 0, "monday": 1, "tuesday": 2, "wednesday": 3,
+	"thursday": 4, "friday": 5, "saturday": 6,
+}
+
+// DayName returns the localized name of a day key such as "monday"
+// Unknown keys are returned unchanged
+func DayName(lang, day string) string {
+	idx, ok := dayIndex[strings.ToLower(day)]
+	if !ok {
+		return day
+	}
+	return catalog(dayNames, lang)[idx]
+}
+
+// DayNames localizes a list of day keys
+func DayNames(lang string, days []string) []string {
+	labels := make([]string, len(days))
+	for i, d := range days {
+		labels[i] = DayName(lang, d)
+	}
+	return labels
+}
+
+// modeNames are how riders refer to each mode in everyday speech
+var modeNames = map[string]map[models.TransitMode]string{
+	French: {
+		models.ModeBus: "bus", models.ModeBRT: "BRT", models.ModeTER: "TER",
+		models.ModeFerry: "chaloupe", models.ModeTram: "tram",
+	},
+	Wolof: {
+		models.ModeBus: "bis", models.ModeBRT: "BRT", models.ModeTER: "TER",
+		models.ModeFerry: "gaal", models.ModeTram: "tram",
+	},
+	English: {
+		models.ModeBus: "bus", models.ModeBRT: "BRT", models.ModeTER: "TER",
+		models.ModeFerry: "ferry", models.ModeTram: "tram",
+	},
+}
+
+// ModeName returns how riders call a transit mode in lang
+func ModeName(lang string, mode models.TransitMode) string {
+	if name := catalog(modeNames, lang)[mode]; name != "" {
+		return name
+	}
+	return strings.ToLower(string(mode))
+}
+
+// stepTemplates hold the humanized instruction of each step type
+// Ride templates take mode, route, origin, destination and stop count
+type stepTemplates struct {
+	walk, ride, transfer string
+	stop, stops          string
+}
+
+var templates = map[string]stepTemplates{
+	French: {
+		walk:     "Marchez %d m jusqu'à %s",
+		ride:     "Prenez le %s %s de %s à %s (%s)",
+		transfer: "Correspondance à %s",
+		stop:     "arrêt",
+		stops:    "arrêts",
+	},
+	Wolof: {
+		walk:     "Doxal %d m ba %s",
+		ride:     "Jëlal %s %s ci %s ba %s (%s)",
+		transfer: "Soppil ci %s",
+		stop:     "taxawaay",
+		stops:    "taxawaay",
+	},
+	English: {
+		walk:     "Walk %d m to %s",
+		ride:     "Take %s %s from %s to %s (%s)",
+		transfer: "Transfer at %s",
+		stop:     "stop",
+		stops:    "stops",
+	},
+}
+
+// Describe returns a humanized instruction for an itinerary step
+func Describe(lang string, step models.Step) string {
+	t := templates[Default]
+	if tl, ok := templates[lang]; ok {
+		t = tl
+	}
+
+	to := nameOr(step.ToStopName, step.ToStop)
+
+	switch step.Type {
+	case models.EdgeWalk:
+		return fmt.Sprintf(t.walk, step.Distance, to)
+	case models.EdgeRide:
+		mode := ModeName(lang, step.Mode)
+		count := t.stops
+		if step.NumStops == 1 {
+			count = t.stop
+		}
+		return fmt.Sprintf(t.ride, mode, nameOr(step.RouteName, step.Route),
+			nameOr(step.FromStopName, step.FromStop), to,
+			strconv.Itoa(step.NumStops)+" "+count)
+	case models.EdgeTransfer:
+		return fmt.Sprintf(t.transfer, nameOr(step.FromStopName, step.FromStop))
+	default:
+		return ""
+	}
+}
+
+// catalog returns the entry for lang, falling back to the default language
+func catalog[V any](entries map[string]V, lang string) V {
+	if v, ok := entries[lang]; ok {
+		return v
+	}
+	return entries[Default]
+}
+
+func nameOr(name, fallback string) string {
+	if name != "" {
+		return name
+	}
+	return fallback
+}
@@ -0,0 +1,73 @@
+package i18n
+
+import (
+	"testing"
+
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected string
+	}{
+		{"", French},
+		{"en", English},
+		{"en-US,en;q=0.9", English},
+		{"wo-SN, fr;q=0.8", Wolof},
+		{"de, en;q=0.5", English},
+		{"fr;q=0.3, en;q=0.7", English},
+		{"en;q=0, wo", Wolof},
+		{"de, it", French},
+		{"*", French},
+		{"en;q=abc, wo;q=0.1", Wolof},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Negotiate(tt.header))
+		})
+	}
+}
+
+func TestDayNames(t *testing.T) {
+	days := []string{"monday", "saturday", "sunday"}
+
+	assert.Equal(t, []string{"lundi", "samedi", "dimanche"}, DayNames(French, days))
+	assert.Equal(t, []string{"Altine", "Gaawu", "Dibéer"}, DayNames(Wolof, days))
+	assert.Equal(t, []string{"Monday", "Saturday", "Sunday"}, DayNames(English, days))
+	assert.Equal(t, "lundi", DayName("de", "monday"))
+	assert.Equal(t, "holiday", DayName(English, "holiday"))
+}
+
+func TestDescribe(t *testing.T) {
+	walk := models.Step{Type: models.EdgeWalk, ToStop: "S1", ToStopName: "Colobane", Distance: 250}
+	ride := models.Step{
+		Type: models.EdgeRide, FromStop: "S1", FromStopName: "Colobane",
+		ToStop: "S9", ToStopName: "Petersen", Route: "DDD_7", RouteName: "7",
+		Mode: models.ModeBus, NumStops: 4,
+	}
+	transfer := models.Step{Type: models.EdgeTransfer, FromStop: "S9", FromStopName: "Petersen"}
+
+	assert.Equal(t, "Walk 250 m to Colobane", Describe(English, walk))
+	assert.Equal(t, "Take bus 7 from Colobane to Petersen (4 stops)", Describe(English, ride))
+	assert.Equal(t, "Transfer at Petersen", Describe(English, transfer))
+
+	assert.Equal(t, "Marchez 250 m jusqu'à Colobane", Describe(French, walk))
+	assert.Equal(t, "Prenez le bus 7 de Colobane à Petersen (4 arrêts)", Describe(French, ride))
+	assert.Equal(t, "Correspondance à Petersen", Describe(French, transfer))
+
+	assert.Equal(t, "Doxal 250 m ba Colobane", Describe(Wolof, walk))
+	assert.Equal(t, "Jëlal bis 7 ci Colobane ba Petersen (4 taxawaay)", Describe(Wolof, ride))
+
+	ride.NumStops = 1
+	ride.RouteName = ""
+	assert.Equal(t, "Take bus DDD_7 from Colobane to Petersen (1 stop)", Describe(English, ride))
+}
+
+func TestNilNames(t *testing.T) {
+	var names *Names
+	assert.Equal(t, "Colobane", names.Stop("S1", "Colobane"))
+	assert.Equal(t, "7", names.Route("DDD_7", "7"))
+}
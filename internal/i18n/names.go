@@ -0,0 +1,81 @@
+package i18n
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Names holds translated stop and route names for one language
+// A nil *Names translates nothing, so callers can skip lookups for
+// untranslated languages without branching
+type Names struct {
+	stops  map[string]string
+	routes map[string]string
+}
+
+// LoadNames fetches translations for the given stops and routes
+// Routes are displayed as COALESCE(short_name, long_name), so only the
+// translation of the displayed field is used
+func LoadNames(ctx context.Context, db *pgxpool.Pool, lang string, stopIDs, routeIDs []string) (*Names, error) {
+	n := &Names{
+		stops:  make(map[string]string),
+		routes: make(map[string]string),
+	}
+	if len(stopIDs) == 0 && len(routeIDs) == 0 {
+		return n, nil
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT t.table_name, t.record_id, t.translation
+		FROM translation t
+		LEFT JOIN route r ON t.table_name = 'routes' AND r.id = t.record_id
+		WHERE t.language = $1
+		  AND ((t.table_name = 'stops' AND t.field_name = 'stop_name' AND t.record_id = ANY($2))
+		    OR (t.table_name = 'routes' AND t.record_id = ANY($3)
+		        AND t.field_name = CASE WHEN r.short_name IS NOT NULL
+		                                THEN 'route_short_name' ELSE 'route_long_name' END))
+	`, lang, stopIDs, routeIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query translations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table, id, text string
+		if err := rows.Scan(&table, &id, &text); err != nil {
+			return nil, fmt.Errorf("failed to scan translation: %w", err)
+		}
+
+		if table == "stops" {
+			n.stops[id] = text
+		} else {
+			n.routes[id] = text
+		}
+	}
+
+	return n, rows.Err()
+}
+
+// Stop returns the translated name of a stop, or fallback
+func (n *Names) Stop(id, fallback string) string {
+	if n == nil {
+		return fallback
+	}
+	if name, ok := n.stops[id]; ok {
+		return name
+	}
+	return fallback
+}
+
+// Route returns the translated display name of a route, or fallback
+func (n *Names) Route(id, fallback string) string {
+	if n == nil {
+		return fallback
+	}
+	if name, ok := n.routes[id]; ok {
+		return name
+	}
+	return fallback
+}
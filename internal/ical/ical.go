@@ -0,0 +1,108 @@
+// Package ical encodes iCalendar (RFC 5545) files with one-off events
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MIMEType is the media type of iCalendar files
+const MIMEType = "text/calendar; charset=utf-8"
+
+// Calendar is a VCALENDAR holding a list of events
+type Calendar struct {
+	ProdID string // defaults to -//PassBi//PassBi Core//EN
+	Name   string // X-WR-CALNAME, shown by most calendar apps
+	Events []Event
+}
+
+// Event is a VEVENT; times are written in UTC
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Start       time.Time
+	End         time.Time
+}
+
+// Marshal encodes the calendar; now is used as every event's DTSTAMP
+func (c *Calendar) Marshal(now time.Time) []byte {
+	var w writer
+
+	prodID := c.ProdID
+	if prodID == "" {
+		prodID = "-//PassBi//PassBi Core//EN"
+	}
+
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", prodID)
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		w.line("X-WR-CALNAME", escape(c.Name))
+	}
+
+	for _, e := range c.Events {
+		w.line("BEGIN", "VEVENT")
+		w.line("UID", escape(e.UID))
+		w.line("DTSTAMP", formatTime(now))
+		w.line("DTSTART", formatTime(e.Start))
+		if !e.End.IsZero() {
+			w.line("DTEND", formatTime(e.End))
+		}
+		w.line("SUMMARY", escape(e.Summary))
+		if e.Description != "" {
+			w.line("DESCRIPTION", escape(e.Description))
+		}
+		if e.Location != "" {
+			w.line("LOCATION", escape(e.Location))
+		}
+		w.line("END", "VEVENT")
+	}
+
+	w.line("END", "VCALENDAR")
+	return w.buf.Bytes()
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// escape encodes a TEXT value (RFC 5545 section 3.3.11)
+func escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// writer emits content lines folded at 75 octets, as RFC 5545 requires
+type writer struct {
+	buf bytes.Buffer
+}
+
+const maxLineOctets = 75
+
+func (w *writer) line(name, value string) {
+	s := name + ":" + value
+	width := 0
+	for len(s) > 0 {
+		_, size := utf8.DecodeRuneInString(s)
+		if width+size > maxLineOctets {
+			// Continuation lines start with a space that counts toward the limit
+			w.buf.WriteString("\r\n ")
+			width = 1
+		}
+		w.buf.WriteString(s[:size])
+		width += size
+		s = s[size:]
+	}
+	w.buf.WriteString("\r\n")
+}
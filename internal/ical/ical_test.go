@@ -0,0 +1,52 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshal(t *testing.T) {
+	start := time.Date(2026, 10, 16, 7, 5, 0, 0, time.UTC)
+	cal := Calendar{
+		Name: "Ligne 7",
+		Events: []Event{{
+			UID:      "T1-20261016@passbi",
+			Summary:  "7 → Petersen",
+			Location: "Gare Routière, Colobane",
+			Start:    start,
+			End:      start.Add(25 * time.Minute),
+		}},
+	}
+
+	out := string(cal.Marshal(start))
+
+	assert.True(t, strings.HasPrefix(out, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	assert.Contains(t, out, "\r\nDTSTART:20261016T070500Z\r\n")
+	assert.Contains(t, out, "\r\nDTEND:20261016T073000Z\r\n")
+	assert.Contains(t, out, "\r\nLOCATION:Gare Routière\\, Colobane\r\n")
+	assert.True(t, strings.HasSuffix(out, "END:VEVENT\r\nEND:VCALENDAR\r\n"))
+}
+
+func TestLineFolding(t *testing.T) {
+	var w writer
+	w.line("DESCRIPTION", strings.Repeat("é", 60))
+
+	lines := strings.Split(strings.TrimSuffix(w.buf.String(), "\r\n"), "\r\n")
+	assert.Greater(t, len(lines), 1)
+	for i, l := range lines {
+		assert.LessOrEqual(t, len(l), maxLineOctets)
+		if i > 0 {
+			assert.True(t, strings.HasPrefix(l, " "))
+		}
+	}
+
+	unfolded := strings.ReplaceAll(strings.TrimSuffix(w.buf.String(), "\r\n"), "\r\n ", "")
+	assert.Equal(t, "DESCRIPTION:"+strings.Repeat("é", 60), unfolded)
+}
+
+func TestEscape(t *testing.T) {
+	assert.Equal(t, `a\;b\,c\\d\ne`, escape("a;b,c\\d\ne"))
+}
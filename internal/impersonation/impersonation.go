@@ -0,0 +1,165 @@
+// Package impersonation stores the sessions in which PassBi admins act on
+// behalf of a partner, and the audit trail of what they did
+package impersonation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/repository"
+)
+
+// ErrNotFound is returned when an impersonation or its partner does not exist
+var ErrNotFound = errors.New("impersonation not found")
+
+// ErrUnknownKey is returned when the key to act as is not the partner's
+var ErrUnknownKey = errors.New("api key does not belong to the partner")
+
+// Impersonation is an admin acting as a partner until ExpiresAt or EndedAt
+type Impersonation struct {
+	ID           string       `json:"id"`
+	PartnerID    string       `json:"partner_id"`
+	APIKeyID     string       `json:"api_key_id,omitempty"`
+	AdminKeyID   string       `json:"admin_key_id,omitempty"`
+	AdminEmail   string       `json:"admin_email"`
+	Reason       string       `json:"reason"`
+	StartedAt    time.Time    `json:"started_at"`
+	ExpiresAt    time.Time    `json:"expires_at"`
+	EndedAt      *time.Time   `json:"ended_at,omitempty"`
+	RequestCount int          `json:"request_count"`
+	Requests     []AuditEntry `json:"requests,omitempty"`
+}
+
+// AuditEntry is one request made with an impersonation token
+type AuditEntry struct {
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	RequestID string    `json:"request_id,omitempty"`
+	IPAddress string    `json:"ip_address,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Filter narrows List
+type Filter struct {
+	PartnerID string
+	Active    bool // only impersonations that have not ended or expired
+	Limit     int
+	Offset    int
+}
+
+// Start records a new impersonation lasting ttl; imp.APIKeyID, when set,
+// must be a key of imp.PartnerID
+func Start(ctx context.Context, db *pgxpool.Pool, imp *Impersonation, ttl time.Duration) error {
+	err := db.QueryRow(ctx, `
+		INSERT INTO impersonation (partner_id, api_key_id, admin_key_id, admin_email, reason, expires_at)
+		SELECT p.id, NULLIF($2, '')::uuid, NULLIF($3, '')::uuid, $4, $5, NOW() + make_interval(secs => $6)
+		FROM partner p
+		WHERE p.id::text = $1
+			AND ($2 = '' OR EXISTS (SELECT 1 FROM api_key ak WHERE ak.id::text = $2 AND ak.partner_id = p.id))
+		RETURNING id, started_at, expires_at
+	`, imp.PartnerID, imp.APIKeyID, imp.AdminKeyID, imp.AdminEmail, imp.Reason, ttl.Seconds()).
+		Scan(&imp.ID, &imp.StartedAt, &imp.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		exists, err := repository.PartnerExists(ctx, db, imp.PartnerID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+		return ErrUnknownKey
+	}
+	return err
+}
+
+const selectImpersonation = `
+	SELECT i.id, i.partner_id, COALESCE(i.api_key_id::text, ''), COALESCE(i.admin_key_id::text, ''),
+		i.admin_email, i.reason, i.started_at, i.expires_at, i.ended_at,
+		(SELECT COUNT(*) FROM impersonation_audit a WHERE a.impersonation_id = i.id)
+	FROM impersonation i
+`
+
+func scanImpersonation(row pgx.Row) (*Impersonation, error) {
+	imp := &Impersonation{}
+	err := row.Scan(&imp.ID, &imp.PartnerID, &imp.APIKeyID, &imp.AdminKeyID, &imp.AdminEmail,
+		&imp.Reason, &imp.StartedAt, &imp.ExpiresAt, &imp.EndedAt, &imp.RequestCount)
+	return imp, err
+}
+
+// List returns impersonations, newest first, and the total matching f
+func List(ctx context.Context, db *pgxpool.Pool, f Filter) ([]Impersonation, int, error) {
+	where := ` WHERE ($1 = '' OR i.partner_id::text = $1)
+		AND (NOT $2 OR (i.ended_at IS NULL AND i.expires_at > NOW()))`
+
+	var total int
+	if err := db.QueryRow(ctx, `SELECT COUNT(*) FROM impersonation i`+where,
+		f.PartnerID, f.Active).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(ctx, selectImpersonation+where+` ORDER BY i.started_at DESC LIMIT $3 OFFSET $4`,
+		f.PartnerID, f.Active, f.Limit, f.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	list := []Impersonation{}
+	for rows.Next() {
+		imp, err := scanImpersonation(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		list = append(list, *imp)
+	}
+	return list, total, rows.Err()
+}
+
+// Get returns an impersonation with every request made during it
+func Get(ctx context.Context, db *pgxpool.Pool, id string) (*Impersonation, error) {
+	imp, err := scanImpersonation(db.QueryRow(ctx, selectImpersonation+` WHERE i.id::text = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT method, path, status, COALESCE(request_id, ''), COALESCE(host(ip_address), ''), created_at
+		FROM impersonation_audit
+		WHERE impersonation_id = $1
+		ORDER BY created_at, id
+	`, imp.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	imp.Requests = []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.Method, &e.Path, &e.Status, &e.RequestID, &e.IPAddress, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		imp.Requests = append(imp.Requests, e)
+	}
+	return imp, rows.Err()
+}
+
+// End stops an impersonation; its token is rejected from the next request
+// Ending it again keeps the first end time
+func End(ctx context.Context, db *pgxpool.Pool, id string) (*Impersonation, error) {
+	_, err := db.Exec(ctx, `
+		UPDATE impersonation SET ended_at = NOW()
+		WHERE id::text = $1 AND ended_at IS NULL
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	return Get(ctx, db, id)
+}
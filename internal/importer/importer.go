@@ -0,0 +1,477 @@
+// Package importer loads a GTFS feed into PostgreSQL: parse, clean and
+// deduplicate stops, import every table, and optionally rebuild the graph
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/cache"
+	"github.com/passbi/passbi_core/internal/graph"
+	"github.com/passbi/passbi_core/internal/gtfs"
+	"github.com/passbi/passbi_core/internal/logging"
+	"github.com/passbi/passbi_core/internal/models"
+)
+
+var logger = logging.For("importer")
+
+// DefaultDedupeThreshold is the stop deduplication distance in meters
+const DefaultDedupeThreshold = 30.0
+
+// Steps is the number of pipeline steps reported through Options.Progress
+const Steps = 5
+
+// Options configures one import
+type Options struct {
+	AgencyID        string
+	GTFSPath        string
+	DedupeThreshold float64
+	RebuildGraph    bool
+
+	// Progress, when set, is called as each pipeline step starts
+	Progress func(step int, description string)
+}
+
+// Result summarizes a successful import
+type Result struct {
+	ImportLogID int64         `json:"import_log_id"`
+	Stops       int           `json:"stops"`
+	Routes      int           `json:"routes"`
+	Trips       int           `json:"trips"`
+	StopTimes   int           `json:"stop_times"`
+	Nodes       int           `json:"nodes"`
+	Edges       int           `json:"edges"`
+	Duration    time.Duration `json:"duration_ns"`
+
+	StopsInvalid int           `json:"stops_invalid"` // dropped for invalid coordinates
+	StopsMerged  int           `json:"stops_merged"`  // merged into a nearby stop
+	Phases       []PhaseTiming `json:"phases"`
+}
+
+// Run imports a GTFS zip and records the outcome in import_log
+func Run(ctx context.Context, pool *pgxpool.Pool, opts Options) (*Result, error) {
+	if opts.DedupeThreshold <= 0 {
+		opts.DedupeThreshold = DefaultDedupeThreshold
+	}
+
+	logID, err := createImportLog(ctx, pool, opts.AgencyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create import log: %w", err)
+	}
+
+	timer := &phaseTimer{}
+	result, err := runImport(ctx, pool, opts, timer)
+	recordImport(timer, result, err)
+	if err != nil {
+		// The import context may be canceled; the log update must still land
+		failed := &Result{Phases: timer.phases}
+		if logErr := updateImportLog(context.Background(), pool, logID, "failed", failed, err.Error(), timer.failureReason(err)); logErr != nil {
+			logger.WarnContext(ctx, "Failed to update import log", "error", logErr)
+		}
+		return nil, err
+	}
+
+	result.ImportLogID = logID
+	if err := updateImportLog(ctx, pool, logID, "success", result, "", ""); err != nil {
+		logger.WarnContext(ctx, "Failed to update import log", "error", err)
+	}
+
+	// Responses cached from the previous feed must not outlive it
+	if _, err := cache.BumpDataVersion(ctx); err != nil {
+		logger.WarnContext(ctx, "Failed to bump cache data version (cached responses expire with their TTL)", "error", err)
+	}
+
+	// API instances reload the rebuilt graph on their own
+	if opts.RebuildGraph {
+		if err := graph.NotifyReload(ctx, pool, "import", opts.AgencyID); err != nil {
+			logger.WarnContext(ctx, "Failed to notify graph reload (reload API instances by hand)", "error", err)
+		}
+	}
+	return result, nil
+}
+
+func (o Options) step(n int, description string) {
+	logger.Info(description, "step", n, "steps", Steps)
+	if o.Progress != nil {
+		o.Progress(n, description)
+	}
+}
+
+func runImport(ctx context.Context, pool *pgxpool.Pool, opts Options, timer *phaseTimer) (*Result, error) {
+	startTime := time.Now()
+	agencyID := opts.AgencyID
+
+	// Parse GTFS feed
+	opts.step(1, "Parsing GTFS feed")
+	done := timer.start(PhaseParse)
+	feed, err := gtfs.ParseGTFSZip(opts.GTFSPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GTFS: %w", err)
+	}
+	done(len(feed.Agencies) + len(feed.Stops) + len(feed.Routes) + len(feed.Trips) + len(feed.StopTimes) +
+		len(feed.Calendars) + len(feed.CalendarDates) + len(feed.Translations) + len(feed.Shapes))
+
+	// Validate and clean stops
+	opts.step(2, "Validating and cleaning stops")
+	done = timer.start(PhaseClean)
+	parsedStops := len(feed.Stops)
+	feed.Stops = gtfs.ValidateAndCleanStops(feed.Stops)
+	done(parsedStops)
+	stopsInvalid := parsedStops - len(feed.Stops)
+
+	// Deduplicate stops
+	opts.step(3, "Deduplicating stops")
+	done = timer.start(PhaseDedupe)
+	// Key name translations by record before stops are merged
+	feed.Translations = gtfs.ResolveTranslations(feed.Translations, feed.Stops, feed.Routes)
+
+	validStops := len(feed.Stops)
+	var stopMapping map[string]string
+	feed.Stops, stopMapping, err = gtfs.DeduplicateStops(ctx, pool, feed.Stops, opts.DedupeThreshold)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deduplicate stops: %w", err)
+	}
+
+	// Remap stop IDs in stop_times to use deduplicated stops
+	for i := range feed.StopTimes {
+		if newID, ok := stopMapping[feed.StopTimes[i].StopID]; ok {
+			feed.StopTimes[i].StopID = newID
+		}
+	}
+	for i := range feed.Translations {
+		if feed.Translations[i].TableName != "stops" {
+			continue
+		}
+		if newID, ok := stopMapping[feed.Translations[i].RecordID]; ok {
+			feed.Translations[i].RecordID = newID
+		}
+	}
+	done(validStops)
+
+	// Begin transaction
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Import stops
+	opts.step(4, "Importing stops and routes to database")
+	done = timer.start(PhaseStops)
+	if err := importStops(ctx, tx, agencyID, feed.Stops); err != nil {
+		return nil, fmt.Errorf("failed to import stops: %w", err)
+	}
+	done(len(feed.Stops))
+
+	// Import routes
+	done = timer.start(PhaseRoutes)
+	if err := importRoutes(ctx, tx, agencyID, feed.Routes); err != nil {
+		return nil, fmt.Errorf("failed to import routes: %w", err)
+	}
+	done(len(feed.Routes))
+
+	// Import trips
+	done = timer.start(PhaseTrips)
+	if err := importTrips(ctx, tx, agencyID, feed.Trips); err != nil {
+		return nil, fmt.Errorf("failed to import trips: %w", err)
+	}
+	done(len(feed.Trips))
+
+	// Import calendar
+	done = timer.start(PhaseCalendar)
+	if err := importCalendar(ctx, tx, agencyID, feed.Calendars); err != nil {
+		return nil, fmt.Errorf("failed to import calendar: %w", err)
+	}
+	done(len(feed.Calendars))
+
+	// Import calendar_dates
+	done = timer.start(PhaseCalendarDates)
+	if err := importCalendarDates(ctx, tx, agencyID, feed.CalendarDates); err != nil {
+		return nil, fmt.Errorf("failed to import calendar_dates: %w", err)
+	}
+	done(len(feed.CalendarDates))
+
+	// Import translations
+	done = timer.start(PhaseTranslations)
+	if err := importTranslations(ctx, tx, agencyID, feed.Translations); err != nil {
+		return nil, fmt.Errorf("failed to import translations: %w", err)
+	}
+	done(len(feed.Translations))
+
+	// Import shapes
+	done = timer.start(PhaseShapes)
+	if err := importShapes(ctx, tx, agencyID, feed.Shapes); err != nil {
+		return nil, fmt.Errorf("failed to import shapes: %w", err)
+	}
+	done(len(feed.Shapes))
+
+	// Commit transaction
+	done = timer.start(PhaseCommit)
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	done(0)
+
+	// Import stop_times outside the transaction: they replace the agency's
+	// stop_time partition in one swap (too large for a single tx)
+	logger.Info("Importing stop_times", "step", "4b", "steps", Steps, "stop_times", len(feed.StopTimes))
+	done = timer.start(PhaseStopTimes)
+	if err := importStopTimes(ctx, pool, agencyID, feed.StopTimes); err != nil {
+		return nil, fmt.Errorf("failed to import stop_times: %w", err)
+	}
+	done(len(feed.StopTimes))
+
+	result := &Result{
+		Stops:        len(feed.Stops),
+		Routes:       len(feed.Routes),
+		Trips:        len(feed.Trips),
+		StopTimes:    len(feed.StopTimes),
+		StopsInvalid: stopsInvalid,
+		StopsMerged:  validStops - len(feed.Stops),
+	}
+
+	// Build graph (if requested)
+	if opts.RebuildGraph {
+		opts.step(5, "Building routing graph")
+		done = timer.start(PhaseGraph)
+		builder := graph.NewBuilder(pool)
+		if err := builder.BuildGraph(ctx, feed); err != nil {
+			return nil, fmt.Errorf("failed to build graph: %w", err)
+		}
+		done(0)
+
+		// Count nodes and edges
+		if err := pool.QueryRow(ctx, "SELECT COUNT(*) FROM node").Scan(&result.Nodes); err != nil {
+			logger.WarnContext(ctx, "Failed to count nodes", "error", err)
+		}
+		if err := pool.QueryRow(ctx, "SELECT COUNT(*) FROM edge").Scan(&result.Edges); err != nil {
+			logger.WarnContext(ctx, "Failed to count edges", "error", err)
+		}
+	} else {
+		opts.step(5, "Skipping graph build")
+	}
+
+	result.Duration = time.Since(startTime)
+	result.Phases = timer.phases
+	logger.Info("Import completed", "duration", result.Duration.String(),
+		"stops_invalid", result.StopsInvalid, "stops_merged", result.StopsMerged)
+
+	return result, nil
+}
+
+func createImportLog(ctx context.Context, pool *pgxpool.Pool, agencyID string) (int64, error) {
+	var id int64
+	err := pool.QueryRow(ctx, `
+		INSERT INTO import_log (agency_id, status)
+		VALUES ($1, 'running')
+		RETURNING id
+	`, agencyID).Scan(&id)
+
+	return id, err
+}
+
+func updateImportLog(ctx context.Context, pool *pgxpool.Pool, id int64, status string, result *Result, errMsg, failureReason string) error {
+	if result == nil {
+		result = &Result{}
+	}
+
+	phases, err := json.Marshal(result.Phases)
+	if err != nil {
+		return err
+	}
+
+	_, err = pool.Exec(ctx, `
+		UPDATE import_log
+		SET completed_at = NOW(),
+		    status = $2,
+		    stops_count = $3,
+		    routes_count = $4,
+		    nodes_count = $5,
+		    edges_count = $6,
+		    error_message = NULLIF($7, ''),
+		    trips_count = $8,
+		    stop_times_count = $9,
+		    stops_invalid = $10,
+		    stops_merged = $11,
+		    phases = $12,
+		    failure_reason = NULLIF($13, '')
+		WHERE id = $1
+	`, id, status, result.Stops, result.Routes, result.Nodes, result.Edges, errMsg,
+		result.Trips, result.StopTimes, result.StopsInvalid, result.StopsMerged, phases, failureReason)
+
+	return err
+}
+
+func importStops(ctx context.Context, tx pgx.Tx, agencyID string, stops []models.GTFSStop) error {
+	rows := make([][]any, len(stops))
+	for i, stop := range stops {
+		rows[i] = []any{stop.StopID, stop.StopName, stop.Lat, stop.Lon, agencyID}
+	}
+
+	changed, err := upsert(ctx, tx, stopTable, rows)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Imported stops", "stops", len(stops), "changed", changed)
+	return nil
+}
+
+func importRoutes(ctx context.Context, tx pgx.Tx, agencyID string, routes []models.GTFSRoute) error {
+	rows := make([][]any, len(routes))
+	for i, route := range routes {
+		rows[i] = []any{route.RouteID, agencyID, route.ShortName, route.LongName, gtfs.InferMode(route)}
+	}
+
+	changed, err := upsert(ctx, tx, routeTable, rows)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Imported routes", "routes", len(routes), "changed", changed)
+	return nil
+}
+
+func importTrips(ctx context.Context, tx pgx.Tx, agencyID string, trips []models.GTFSTrip) error {
+	if len(trips) == 0 {
+		logger.Info("No trips to import")
+		return nil
+	}
+
+	rows := make([][]any, len(trips))
+	for i, trip := range trips {
+		var shapeID any
+		if trip.ShapeID != "" {
+			shapeID = trip.ShapeID
+		}
+		rows[i] = []any{trip.TripID, agencyID, trip.RouteID, trip.ServiceID, trip.Headsign, trip.Direction, shapeID}
+	}
+
+	changed, err := upsert(ctx, tx, tripTable, rows)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Imported trips", "trips", len(trips), "changed", changed)
+	return nil
+}
+
+func importCalendar(ctx context.Context, tx pgx.Tx, agencyID string, calendars []models.GTFSCalendar) error {
+	if len(calendars) == 0 {
+		logger.Info("No calendar entries to import")
+		return nil
+	}
+
+	rows := make([][]any, len(calendars))
+	for i, cal := range calendars {
+		rows[i] = []any{cal.ServiceID, agencyID,
+			cal.Monday, cal.Tuesday, cal.Wednesday, cal.Thursday,
+			cal.Friday, cal.Saturday, cal.Sunday,
+			parseGTFSDate(cal.StartDate), parseGTFSDate(cal.EndDate)}
+	}
+
+	changed, err := upsert(ctx, tx, calendarTable, rows)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Imported calendar entries", "calendars", len(calendars), "changed", changed)
+	return nil
+}
+
+func importCalendarDates(ctx context.Context, tx pgx.Tx, agencyID string, calDates []models.GTFSCalendarDate) error {
+	if len(calDates) == 0 {
+		logger.Info("No calendar_dates to import")
+		return nil
+	}
+
+	rows := make([][]any, len(calDates))
+	for i, cd := range calDates {
+		rows[i] = []any{cd.ServiceID, agencyID, parseGTFSDate(cd.Date), cd.ExceptionType}
+	}
+
+	changed, err := upsert(ctx, tx, calendarDateTable, rows)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Imported calendar_dates", "calendar_dates", len(calDates), "changed", changed)
+	return nil
+}
+
+func importTranslations(ctx context.Context, tx pgx.Tx, agencyID string, translations []models.GTFSTranslation) error {
+	if len(translations) == 0 {
+		logger.Info("No translations to import")
+		return nil
+	}
+
+	rows := make([][]any, len(translations))
+	for i, tr := range translations {
+		rows[i] = []any{tr.TableName, tr.FieldName, tr.Language, tr.RecordID, tr.Translation, agencyID}
+	}
+
+	changed, err := upsert(ctx, tx, translationTable, rows)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Imported translations", "translations", len(translations), "changed", changed)
+	return nil
+}
+
+// importShapes stores each shape as its points in sequence order
+func importShapes(ctx context.Context, tx pgx.Tx, agencyID string, points []models.GTFSShapePoint) error {
+	if len(points) == 0 {
+		logger.Info("No shapes to import")
+		return nil
+	}
+
+	rows := shapeRows(agencyID, points)
+	changed, err := upsert(ctx, tx, shapeTable, rows)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Imported shapes", "shapes", len(rows), "shape_points", len(points), "changed", changed)
+	return nil
+}
+
+// shapeRows groups shape points into one row per shape, in the order shapes
+// first appear, with their coordinates sorted by shape_pt_sequence
+func shapeRows(agencyID string, points []models.GTFSShapePoint) [][]any {
+	index := make(map[string]int)
+	var shapes [][]models.GTFSShapePoint
+	for _, p := range points {
+		i, ok := index[p.ShapeID]
+		if !ok {
+			i = len(shapes)
+			index[p.ShapeID] = i
+			shapes = append(shapes, nil)
+		}
+		shapes[i] = append(shapes[i], p)
+	}
+
+	rows := make([][]any, len(shapes))
+	for i, shape := range shapes {
+		sort.SliceStable(shape, func(a, b int) bool { return shape[a].Sequence < shape[b].Sequence })
+		lats, lons := make([]float64, len(shape)), make([]float64, len(shape))
+		for j, p := range shape {
+			lats[j], lons[j] = p.Lat, p.Lon
+		}
+		rows[i] = []any{shape[0].ShapeID, agencyID, lats, lons}
+	}
+	return rows
+}
+
+func parseGTFSDate(dateStr string) time.Time {
+	t, err := time.Parse("20060102", dateStr)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
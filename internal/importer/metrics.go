@@ -0,0 +1,175 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/metrics"
+)
+
+// Import phases, in pipeline order; loading is timed per table
+const (
+	PhaseParse         = "parse"
+	PhaseClean         = "clean"
+	PhaseDedupe        = "dedupe"
+	PhaseStops         = "stops"
+	PhaseRoutes        = "routes"
+	PhaseTrips         = "trips"
+	PhaseCalendar      = "calendar"
+	PhaseCalendarDates = "calendar_dates"
+	PhaseTranslations  = "translations"
+	PhaseShapes        = "shapes"
+	PhaseCommit        = "commit"
+	PhaseStopTimes     = "stop_times"
+	PhaseGraph         = "graph"
+)
+
+var phaseOrder = []string{
+	PhaseParse, PhaseClean, PhaseDedupe, PhaseStops, PhaseRoutes, PhaseTrips, PhaseCalendar,
+	PhaseCalendarDates, PhaseTranslations, PhaseShapes, PhaseCommit, PhaseStopTimes, PhaseGraph,
+}
+
+// PhaseTiming is how long one phase of an import took and how many rows it
+// handled (0 for phases without rows)
+type PhaseTiming struct {
+	Phase         string  `json:"phase"`
+	Seconds       float64 `json:"seconds"`
+	Rows          int     `json:"rows,omitempty"`
+	RowsPerSecond float64 `json:"rows_per_second,omitempty"`
+}
+
+// phaseTimer times the phases of one import
+type phaseTimer struct {
+	phases  []PhaseTiming
+	current string // phase running, or that failed
+}
+
+// start begins a phase; call the returned function with its row count once
+// it succeeds
+func (t *phaseTimer) start(phase string) func(rows int) {
+	t.current = phase
+	started := time.Now()
+	return func(rows int) {
+		p := PhaseTiming{Phase: phase, Seconds: time.Since(started).Seconds(), Rows: rows}
+		if rows > 0 && p.Seconds > 0 {
+			p.RowsPerSecond = float64(rows) / p.Seconds
+		}
+		t.phases = append(t.phases, p)
+		t.current = ""
+	}
+}
+
+// failureReason classifies a failed import by the phase it failed in, so
+// database, parsing and graph failures are told apart
+func (t *phaseTimer) failureReason(err error) string {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case t.current == "":
+		// Between phases: opening a transaction
+		return "database"
+	default:
+		return t.current
+	}
+}
+
+var (
+	importsSucceeded atomic.Int64
+	importsFailed    atomic.Int64
+
+	metricsMu     sync.Mutex
+	phaseSeconds  = map[string]*metrics.Histogram{}
+	rowsImported  = map[string]int64{}   // phase -> rows, all imports
+	lastRows      = map[string]int64{}   // phase -> rows of the last successful import
+	lastRowsRate  = map[string]float64{} // phase -> rows/s of the last successful import
+	failures      = map[string]int64{}   // reason -> imports
+	stopsInvalid  int64
+	stopsMerged   int64
+	lastDuration  float64
+	lastSuccessAt time.Time
+)
+
+func init() {
+	for _, p := range phaseOrder {
+		phaseSeconds[p] = metrics.NewHistogram(0.1, 0.5, 1, 5, 10, 30, 60, 120, 300, 600, 1800)
+	}
+	metrics.Register(collectMetrics)
+}
+
+// recordImport adds an import to the metrics; result is nil when it failed
+func recordImport(t *phaseTimer, result *Result, err error) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	for _, p := range t.phases {
+		phaseSeconds[p.Phase].Observe(p.Seconds)
+		rowsImported[p.Phase] += int64(p.Rows)
+	}
+
+	if err != nil {
+		importsFailed.Add(1)
+		failures[t.failureReason(err)]++
+		return
+	}
+
+	importsSucceeded.Add(1)
+	for _, p := range t.phases {
+		lastRows[p.Phase] = int64(p.Rows)
+		lastRowsRate[p.Phase] = p.RowsPerSecond
+	}
+	stopsInvalid += int64(result.StopsInvalid)
+	stopsMerged += int64(result.StopsMerged)
+	lastDuration = result.Duration.Seconds()
+	lastSuccessAt = time.Now()
+}
+
+func collectMetrics(w *metrics.Writer) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	w.Counter("passbi_imports_total", "GTFS imports by outcome", float64(importsSucceeded.Load()), metrics.L("outcome", "success"))
+	w.Counter("passbi_imports_total", "GTFS imports by outcome", float64(importsFailed.Load()), metrics.L("outcome", "failed"))
+	for _, reason := range sortedKeys(failures) {
+		w.Counter("passbi_import_failures_total", "Failed GTFS imports by the phase they failed in (or canceled, timeout)",
+			float64(failures[reason]), metrics.L("reason", reason))
+	}
+	for _, p := range phaseOrder {
+		w.Histogram("passbi_import_phase_seconds", "Duration of GTFS import phases", phaseSeconds[p], metrics.L("phase", p))
+	}
+	for _, p := range phaseOrder {
+		if _, ok := rowsImported[p]; ok {
+			w.Counter("passbi_import_rows_total", "Rows handled by GTFS import phases", float64(rowsImported[p]), metrics.L("phase", p))
+		}
+	}
+	for _, p := range phaseOrder {
+		if _, ok := lastRows[p]; ok {
+			w.Gauge("passbi_import_last_rows", "Rows handled by each phase of the last successful import (feed size)", float64(lastRows[p]), metrics.L("phase", p))
+		}
+	}
+	for _, p := range phaseOrder {
+		if lastRowsRate[p] > 0 {
+			w.Gauge("passbi_import_last_rows_per_second", "Throughput of each phase of the last successful import", lastRowsRate[p], metrics.L("phase", p))
+		}
+	}
+	w.Counter("passbi_import_stops_invalid_total", "Stops dropped for invalid coordinates", float64(stopsInvalid))
+	w.Counter("passbi_import_stops_merged_total", "Stops merged into a nearby stop by deduplication", float64(stopsMerged))
+	if !lastSuccessAt.IsZero() {
+		w.Gauge("passbi_import_last_duration_seconds", "Duration of the last successful import", lastDuration)
+		w.Gauge("passbi_import_last_success_timestamp_seconds", "Unix time of the last successful import", float64(lastSuccessAt.Unix()))
+	}
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
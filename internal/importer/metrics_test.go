@@ -0,0 +1,49 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPhaseTimer(t *testing.T) {
+	timer := &phaseTimer{}
+
+	done := timer.start(PhaseParse)
+	time.Sleep(10 * time.Millisecond)
+	done(1000)
+	timer.start(PhaseStopTimes)
+
+	if assert.Len(t, timer.phases, 1) {
+		p := timer.phases[0]
+		assert.Equal(t, PhaseParse, p.Phase)
+		assert.GreaterOrEqual(t, p.Seconds, 0.01)
+		assert.InDelta(t, 1000/p.Seconds, p.RowsPerSecond, 0.001)
+	}
+
+	err := errors.New("duplicate key value")
+	assert.Equal(t, PhaseStopTimes, timer.failureReason(err))
+	assert.Equal(t, "canceled", timer.failureReason(fmt.Errorf("failed to import stop_times: %w", context.Canceled)))
+}
+
+func TestRecordImport(t *testing.T) {
+	failed := &phaseTimer{}
+	failed.start(PhaseGraph)
+	recordImport(failed, nil, errors.New("no edges"))
+
+	ok := &phaseTimer{}
+	ok.start(PhaseStops)(250)
+	recordImport(ok, &Result{StopsMerged: 3, Duration: time.Minute}, nil)
+
+	out := metrics.Gather()
+	assert.Contains(t, out, `passbi_import_failures_total{reason="graph"} 1`)
+	assert.Contains(t, out, `passbi_import_last_rows{phase="stops"} 250`)
+	assert.Contains(t, out, `passbi_import_last_duration_seconds 60`)
+	assert.True(t, strings.Contains(out, `passbi_import_phase_seconds_count{phase="stops"} 1`), out)
+}
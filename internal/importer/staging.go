@@ -0,0 +1,155 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// upsertTable describes how feed rows are merged into a table
+// The rows are copied into a temporary staging table (not WAL-logged), then
+// merged with one INSERT ... SELECT ... ON CONFLICT: rows that did not change
+// since the last import are not rewritten
+type upsertTable struct {
+	name    string
+	columns []string
+	key     []string // conflict target, a subset of columns
+}
+
+var (
+	stopTable = upsertTable{
+		name:    "stop",
+		columns: []string{"id", "name", "lat", "lon", "agency_id"},
+		key:     []string{"id"},
+	}
+	routeTable = upsertTable{
+		name:    "route",
+		columns: []string{"id", "agency_id", "short_name", "long_name", "mode"},
+		key:     []string{"id"},
+	}
+	tripTable = upsertTable{
+		name:    "trip",
+		columns: []string{"trip_id", "agency_id", "route_id", "service_id", "headsign", "direction", "shape_id"},
+		key:     []string{"agency_id", "trip_id"},
+	}
+	calendarTable = upsertTable{
+		name: "calendar",
+		columns: []string{"service_id", "agency_id", "monday", "tuesday", "wednesday",
+			"thursday", "friday", "saturday", "sunday", "start_date", "end_date"},
+		key: []string{"agency_id", "service_id"},
+	}
+	calendarDateTable = upsertTable{
+		name:    "calendar_date",
+		columns: []string{"service_id", "agency_id", "date", "exception_type"},
+		key:     []string{"agency_id", "service_id", "date"},
+	}
+	translationTable = upsertTable{
+		name:    "translation",
+		columns: []string{"table_name", "field_name", "language", "record_id", "translation", "agency_id"},
+		key:     []string{"table_name", "field_name", "language", "record_id"},
+	}
+	shapeTable = upsertTable{
+		name:    "shape",
+		columns: []string{"shape_id", "agency_id", "lats", "lons"},
+		key:     []string{"agency_id", "shape_id"},
+	}
+)
+
+// staging is the name of the table's staging table
+func (t upsertTable) staging() string {
+	return "staging_" + t.name
+}
+
+// createSQL creates the staging table, with the target's column types and no
+// constraints; it is dropped when the import transaction ends
+func (t upsertTable) createSQL() string {
+	return fmt.Sprintf("CREATE TEMP TABLE %s ON COMMIT DROP AS SELECT %s FROM %s WITH NO DATA",
+		pgx.Identifier{t.staging()}.Sanitize(), identifiers(t.columns), pgx.Identifier{t.name}.Sanitize())
+}
+
+// mergeSQL merges the staging table into the target
+func (t upsertTable) mergeSQL() string {
+	target := pgx.Identifier{t.name}.Sanitize()
+	var set, current, excluded []string
+	for _, col := range t.columns {
+		if t.isKey(col) {
+			continue
+		}
+		c := pgx.Identifier{col}.Sanitize()
+		set = append(set, c+" = EXCLUDED."+c)
+		current = append(current, target+"."+c)
+		excluded = append(excluded, "EXCLUDED."+c)
+	}
+
+	cols := identifiers(t.columns)
+	return fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s ON CONFLICT (%s) DO UPDATE SET %s WHERE (%s) IS DISTINCT FROM (%s)",
+		target, cols, cols, pgx.Identifier{t.staging()}.Sanitize(), identifiers(t.key),
+		strings.Join(set, ", "), strings.Join(current, ", "), strings.Join(excluded, ", "))
+}
+
+func (t upsertTable) isKey(col string) bool {
+	for _, k := range t.key {
+		if k == col {
+			return true
+		}
+	}
+	return false
+}
+
+// dedupe keeps the last row of each key, in the position of its first: the
+// merge may only touch a row once, and per-row upserts let the last one win
+func (t upsertTable) dedupe(rows [][]any) [][]any {
+	var positions []int
+	for i, col := range t.columns {
+		if t.isKey(col) {
+			positions = append(positions, i)
+		}
+	}
+
+	index := make(map[string]int, len(rows))
+	out := make([][]any, 0, len(rows))
+	var key strings.Builder
+	for _, row := range rows {
+		key.Reset()
+		for _, p := range positions {
+			fmt.Fprint(&key, row[p])
+			key.WriteByte(0)
+		}
+		if i, ok := index[key.String()]; ok {
+			out[i] = row
+			continue
+		}
+		index[key.String()] = len(out)
+		out = append(out, row)
+	}
+	return out
+}
+
+// upsert stages rows (in t.columns order) and merges them into t in tx
+// Returns how many rows were inserted or changed
+func upsert(ctx context.Context, tx pgx.Tx, t upsertTable, rows [][]any) (int64, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	if _, err := tx.Exec(ctx, t.createSQL()); err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", t.staging(), err)
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{t.staging()}, t.columns, pgx.CopyFromRows(t.dedupe(rows))); err != nil {
+		return 0, fmt.Errorf("failed to copy into %s: %w", t.staging(), err)
+	}
+	tag, err := tx.Exec(ctx, t.mergeSQL())
+	if err != nil {
+		return 0, fmt.Errorf("failed to merge %s: %w", t.staging(), err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+func identifiers(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = pgx.Identifier{name}.Sanitize()
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,59 @@
+package importer
+
+import (
+	"testing"
+
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpsertTableSQL(t *testing.T) {
+	assert.Equal(t,
+		`CREATE TEMP TABLE "staging_calendar_date" ON COMMIT DROP AS SELECT "service_id", "agency_id", "date", "exception_type" FROM "calendar_date" WITH NO DATA`,
+		calendarDateTable.createSQL())
+	assert.Equal(t,
+		`INSERT INTO "calendar_date" ("service_id", "agency_id", "date", "exception_type") `+
+			`SELECT "service_id", "agency_id", "date", "exception_type" FROM "staging_calendar_date" `+
+			`ON CONFLICT ("agency_id", "service_id", "date") DO UPDATE SET "exception_type" = EXCLUDED."exception_type" `+
+			`WHERE ("calendar_date"."exception_type") IS DISTINCT FROM (EXCLUDED."exception_type")`,
+		calendarDateTable.mergeSQL())
+
+	for _, table := range []upsertTable{stopTable, routeTable, tripTable, calendarTable, calendarDateTable, translationTable, shapeTable} {
+		for _, k := range table.key {
+			assert.Contains(t, table.columns, k, table.name)
+		}
+		assert.Less(t, len(table.key), len(table.columns), table.name)
+	}
+}
+
+func TestUpsertTableDedupe(t *testing.T) {
+	rows := [][]any{
+		{"t1", "ddd", "r1", "weekday", "Petersen", 0},
+		{"t2", "ddd", "r1", "weekday", "Petersen", 0},
+		// repeated (agency_id, trip_id): the last row wins, in place
+		{"t1", "ddd", "r2", "weekday", "Colobane", 1},
+		// same trip_id, other agency
+		{"t1", "brt", "r3", "weekday", "Guédiawaye", 0},
+	}
+
+	out := tripTable.dedupe(rows)
+	assert.Equal(t, [][]any{
+		{"t1", "ddd", "r2", "weekday", "Colobane", 1},
+		{"t2", "ddd", "r1", "weekday", "Petersen", 0},
+		{"t1", "brt", "r3", "weekday", "Guédiawaye", 0},
+	}, out)
+}
+
+func TestShapeRows(t *testing.T) {
+	rows := shapeRows("aftu", []models.GTFSShapePoint{
+		{ShapeID: "s2", Lat: 14.70, Lon: -17.44, Sequence: 1},
+		{ShapeID: "s1", Lat: 14.72, Lon: -17.46, Sequence: 20},
+		{ShapeID: "s1", Lat: 14.71, Lon: -17.45, Sequence: 10},
+		{ShapeID: "s2", Lat: 14.75, Lon: -17.40, Sequence: 2},
+	})
+	if !assert.Len(t, rows, 2) {
+		return
+	}
+	assert.Equal(t, []any{"s2", "aftu", []float64{14.70, 14.75}, []float64{-17.44, -17.40}}, rows[0])
+	assert.Equal(t, []any{"s1", "aftu", []float64{14.71, 14.72}, []float64{-17.45, -17.46}}, rows[1], "points in sequence order")
+}
@@ -0,0 +1,83 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/gtfs"
+	"github.com/passbi/passbi_core/internal/models"
+)
+
+var stopTimeColumns = []string{"trip_id", "agency_id", "stop_id", "stop_sequence",
+	"arrival_time", "departure_time", "arrival_seconds", "departure_seconds"}
+
+// importStopTimes replaces the agency's stop_time partition (migration 032)
+// The feed is copied into a staged table, which swap_stop_time_partition
+// indexes and swaps in for the old partition, so a reimport never rewrites
+// the other agencies' rows and readers never see a half-loaded timetable
+func importStopTimes(ctx context.Context, pool *pgxpool.Pool, agencyID string, stopTimes []models.GTFSStopTime) (err error) {
+	if len(stopTimes) == 0 {
+		logger.Info("No stop_times to import")
+		return nil
+	}
+
+	var staged string
+	if err := pool.QueryRow(ctx, `SELECT stage_stop_time_partition($1)`, agencyID).Scan(&staged); err != nil {
+		return fmt.Errorf("failed to stage stop_time partition: %w", err)
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		// ctx may be what failed the import
+		cleanup, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if _, dropErr := pool.Exec(cleanup, `DROP TABLE IF EXISTS `+pgx.Identifier{staged}.Sanitize()); dropErr != nil {
+			logger.Warn("Failed to drop staged stop_times", "table", staged, "error", dropErr)
+		}
+	}()
+
+	rows := stopTimeRows(agencyID, stopTimes)
+	n, err := pool.CopyFrom(ctx, pgx.Identifier{staged}, stopTimeColumns, pgx.CopyFromRows(rows))
+	if err != nil {
+		return fmt.Errorf("failed to copy stop_times: %w", err)
+	}
+	logger.Debug("Staged stop_times", "table", staged, "stop_times", n)
+
+	if _, err := pool.Exec(ctx, `SELECT swap_stop_time_partition($1)`, agencyID); err != nil {
+		return fmt.Errorf("failed to swap stop_time partition: %w", err)
+	}
+
+	logger.Info("Imported stop_times", "stop_times", n)
+	return nil
+}
+
+// stopTimeRows converts the feed's stop_times to rows of stopTimeColumns
+// A (trip_id, stop_sequence) repeated in the feed keeps its last row, as the
+// upserts of earlier imports did
+func stopTimeRows(agencyID string, stopTimes []models.GTFSStopTime) [][]any {
+	type key struct {
+		tripID   string
+		sequence int
+	}
+	index := make(map[key]int, len(stopTimes))
+	rows := make([][]any, 0, len(stopTimes))
+	for _, st := range stopTimes {
+		arrSec, _ := gtfs.ParseTimeToSeconds(st.ArrivalTime)
+		depSec, _ := gtfs.ParseTimeToSeconds(st.DepartureTime)
+		row := []any{st.TripID, agencyID, st.StopID, st.StopSequence,
+			st.ArrivalTime, st.DepartureTime, arrSec, depSec}
+
+		k := key{st.TripID, st.StopSequence}
+		if i, ok := index[k]; ok {
+			rows[i] = row
+			continue
+		}
+		index[k] = len(rows)
+		rows = append(rows, row)
+	}
+	return rows
+}
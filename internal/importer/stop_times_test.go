@@ -0,0 +1,29 @@
+package importer
+
+import (
+	"testing"
+
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStopTimeRows(t *testing.T) {
+	stopTimes := []models.GTFSStopTime{
+		{TripID: "t1", StopID: "a", StopSequence: 1, ArrivalTime: "08:00:00", DepartureTime: "08:00:30"},
+		{TripID: "t1", StopID: "b", StopSequence: 2, ArrivalTime: "08:05:00", DepartureTime: "08:05:00"},
+		{TripID: "t2", StopID: "a", StopSequence: 1, ArrivalTime: "25:10:00", DepartureTime: "25:10:00"},
+		// repeated (trip, sequence): the last row wins, in place
+		{TripID: "t1", StopID: "c", StopSequence: 2, ArrivalTime: "08:06:00", DepartureTime: "08:06:00"},
+	}
+
+	rows := stopTimeRows("ddd", stopTimes)
+	if !assert.Len(t, rows, 3) {
+		return
+	}
+	assert.Equal(t, []any{"t1", "ddd", "a", 1, "08:00:00", "08:00:30", 28800, 28830}, rows[0])
+	assert.Equal(t, []any{"t1", "ddd", "c", 2, "08:06:00", "08:06:00", 29160, 29160}, rows[1])
+	assert.Equal(t, []any{"t2", "ddd", "a", 1, "25:10:00", "25:10:00", 90600, 90600}, rows[2])
+	for _, row := range rows {
+		assert.Len(t, row, len(stopTimeColumns))
+	}
+}
@@ -0,0 +1,282 @@
+// Package jobs runs long admin operations (GTFS imports, graph rebuilds) in
+// the background and records their progress in the admin_job table
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/passbi/passbi_core/internal/logging"
+)
+
+var logger = logging.For("jobs")
+
+// ErrNotFound is returned when a job ID does not exist
+var ErrNotFound = errors.New("job not found")
+
+// Status is the lifecycle state of a job
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+// Job kinds
+const (
+	KindImport       = "gtfs_import"
+	KindGraphRebuild = "graph_rebuild"
+)
+
+// Job is one background admin operation
+type Job struct {
+	ID         string          `json:"id"`
+	Kind       string          `json:"kind"`
+	Status     Status          `json:"status"`
+	Params     json.RawMessage `json:"params"`
+	Step       string          `json:"step,omitempty"`
+	Progress   int             `json:"progress"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	PartnerID  string          `json:"partner_id,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+// Reporter records the current step and completion percentage of a job
+type Reporter func(step string, progress int)
+
+// Func is the work of a job; its result is stored as JSON on success
+type Func func(ctx context.Context, report Reporter) (interface{}, error)
+
+// Runner executes jobs one at a time
+// Imports and rebuilds all rewrite the same tables and graph, so running
+// them concurrently would only make them slower and racier
+type Runner struct {
+	mu sync.Mutex
+	wg sync.WaitGroup
+}
+
+var (
+	globalRunner     *Runner
+	globalRunnerOnce sync.Once
+)
+
+// GetRunner returns the process-wide job runner
+func GetRunner() *Runner {
+	globalRunnerOnce.Do(func() {
+		globalRunner = &Runner{}
+	})
+	return globalRunner
+}
+
+// Submit records a queued job and starts it in the background
+// The job outlives the request that submitted it
+func (r *Runner) Submit(ctx context.Context, db *pgxpool.Pool, kind string, params interface{}, partnerID string, fn Func) (*Job, error) {
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job params: %w", err)
+	}
+
+	job, err := scanJob(db.QueryRow(ctx, `
+		INSERT INTO admin_job (kind, params, partner_id)
+		VALUES ($1, $2, NULLIF($3, '')::uuid)
+		RETURNING `+jobColumns,
+		kind, encoded, partnerID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job: %w", err)
+	}
+
+	r.wg.Add(1)
+	go r.run(db, job.ID, fn)
+
+	return job, nil
+}
+
+// Wait blocks until every submitted job has finished
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+func (r *Runner) run(db *pgxpool.Pool, id string, fn Func) {
+	defer r.wg.Done()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	jobLog := logger.With("job_id", id)
+	ctx := context.Background()
+	if _, err := db.Exec(ctx, `
+		UPDATE admin_job SET status = 'running', started_at = NOW() WHERE id = $1
+	`, id); err != nil {
+		jobLog.Error("Failed to mark job running", "error", err)
+	}
+
+	report := func(step string, progress int) {
+		if progress < 0 {
+			progress = 0
+		} else if progress > 100 {
+			progress = 100
+		}
+		if _, err := db.Exec(ctx, `
+			UPDATE admin_job SET step = $2, progress = $3 WHERE id = $1
+		`, id, step, progress); err != nil {
+			jobLog.Error("Failed to record job progress", "error", err)
+		}
+	}
+
+	result, err := safeCall(ctx, fn, report)
+	if err != nil {
+		jobLog.Error("Job failed", "error", err)
+		if _, dbErr := db.Exec(ctx, `
+			UPDATE admin_job SET status = 'failed', error = $2, finished_at = NOW() WHERE id = $1
+		`, id, err.Error()); dbErr != nil {
+			jobLog.Error("Failed to record job failure", "error", dbErr)
+		}
+		return
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		jobLog.Error("Failed to encode job result", "error", err)
+		encoded = nil
+	}
+	if _, err := db.Exec(ctx, `
+		UPDATE admin_job SET status = 'succeeded', progress = 100, result = $2, finished_at = NOW()
+		WHERE id = $1
+	`, id, encoded); err != nil {
+		jobLog.Error("Failed to record job success", "error", err)
+	}
+	jobLog.Info("Job succeeded")
+}
+
+// safeCall runs fn, turning a panic into an error so a crashing job is
+// recorded as failed instead of taking the API down
+func safeCall(ctx context.Context, fn Func, report Reporter) (result interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+	return fn(ctx, report)
+}
+
+// FailInterrupted marks jobs left queued or running by a previous process as
+// failed; call it once at startup before accepting new jobs
+func FailInterrupted(ctx context.Context, db *pgxpool.Pool) (int64, error) {
+	tag, err := db.Exec(ctx, `
+		UPDATE admin_job
+		SET status = 'failed', error = 'interrupted by server restart', finished_at = NOW()
+		WHERE status IN ('queued', 'running')
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update interrupted jobs: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Get returns a single job
+func Get(ctx context.Context, db *pgxpool.Pool, id string) (*Job, error) {
+	if !ValidID(id) {
+		return nil, ErrNotFound
+	}
+	job, err := scanJob(db.QueryRow(ctx, `SELECT `+jobColumns+` FROM admin_job WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return job, err
+}
+
+// Active returns the oldest queued or running job of a kind, or nil if none
+func Active(ctx context.Context, db *pgxpool.Pool, kind string) (*Job, error) {
+	job, err := scanJob(db.QueryRow(ctx, `
+		SELECT `+jobColumns+`
+		FROM admin_job
+		WHERE kind = $1 AND status IN ('queued', 'running')
+		ORDER BY created_at
+		LIMIT 1
+	`, kind))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// List returns the most recent jobs of a kind, newest first
+func List(ctx context.Context, db *pgxpool.Pool, kind string, limit int) ([]Job, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT `+jobColumns+`
+		FROM admin_job
+		WHERE kind = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, kind, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	defer rows.Close()
+
+	list := []Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *job)
+	}
+
+	return list, rows.Err()
+}
+
+// ValidID reports whether id is a UUID in its canonical text form
+func ValidID(id string) bool {
+	if len(id) != 36 {
+		return false
+	}
+	for i, ch := range id {
+		switch i {
+		case 8, 13, 18, 23:
+			if ch != '-' {
+				return false
+			}
+		default:
+			if !('0' <= ch && ch <= '9' || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+const jobColumns = `id::text, kind, status, params, COALESCE(step, ''), progress, result,
+	COALESCE(error, ''), COALESCE(partner_id::text, ''), created_at, started_at, finished_at`
+
+func scanJob(row pgx.Row) (*Job, error) {
+	var job Job
+	var status string
+	var params, result []byte
+	if err := row.Scan(&job.ID, &job.Kind, &status, &params, &job.Step, &job.Progress, &result,
+		&job.Error, &job.PartnerID, &job.CreatedAt, &job.StartedAt, &job.FinishedAt); err != nil {
+		return nil, err
+	}
+	job.Status = Status(status)
+	job.Params = params
+	if len(result) > 0 {
+		job.Result = result
+	}
+	return &job, nil
+}
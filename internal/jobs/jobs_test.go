@@ -0,0 +1,131 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidID(t *testing.T) {
+	assert.True(t, ValidID("3f2b9c1e-7a4d-4f7e-9b1a-2c8d5e6f7a8b"))
+	assert.True(t, ValidID("3F2B9C1E-7A4D-4F7E-9B1A-2C8D5E6F7A8B"))
+
+	assert.False(t, ValidID(""))
+	assert.False(t, ValidID("42"))
+	assert.False(t, ValidID("3f2b9c1e7a4d-4f7e-9b1a-2c8d5e6f7a8b0"))
+	assert.False(t, ValidID("3f2b9c1e-7a4d-4f7e-9b1a-2c8d5e6f7a8g"))
+}
+
+func TestSafeCall(t *testing.T) {
+	noop := func(string, int) {}
+
+	result, err := safeCall(context.Background(), func(context.Context, Reporter) (interface{}, error) {
+		return 42, nil
+	}, noop)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, result)
+
+	_, err = safeCall(context.Background(), func(context.Context, Reporter) (interface{}, error) {
+		return nil, errors.New("boom")
+	}, noop)
+	assert.EqualError(t, err, "boom")
+
+	_, err = safeCall(context.Background(), func(context.Context, Reporter) (interface{}, error) {
+		panic("nil map")
+	}, noop)
+	assert.EqualError(t, err, "job panicked: nil map")
+}
+
+// testPool returns a pool on the migrated database in TEST_DATABASE_URL and a
+// job kind of its own, whose jobs are deleted when the test ends
+func testPool(t *testing.T) (*pgxpool.Pool, string) {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	kind := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		pool.Exec(ctx, `DELETE FROM admin_job WHERE kind = $1`, kind)
+		pool.Close()
+	})
+	return pool, kind
+}
+
+func TestActive(t *testing.T) {
+	pool, kind := testPool(t)
+	ctx := context.Background()
+
+	active, err := Active(ctx, pool, kind)
+	assert.NoError(t, err)
+	assert.Nil(t, active, "no job of the kind")
+
+	_, err = pool.Exec(ctx, `
+		INSERT INTO admin_job (kind, params, status, created_at) VALUES
+			($1, '{}', 'succeeded', NOW() - INTERVAL '2 hours'),
+			($1, '{}', 'running', NOW() - INTERVAL '1 hour'),
+			($1, '{}', 'queued', NOW())
+	`, kind)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	active, err = Active(ctx, pool, kind)
+	if assert.NoError(t, err) && assert.NotNil(t, active) {
+		assert.Equal(t, StatusRunning, active.Status, "the oldest unfinished job")
+	}
+}
+
+func TestRunnerRecordsOutcome(t *testing.T) {
+	pool, kind := testPool(t)
+	ctx := context.Background()
+	r := &Runner{}
+
+	ok, err := r.Submit(ctx, pool, kind, map[string]string{}, "", func(_ context.Context, report Reporter) (interface{}, error) {
+		report("Building nodes", 150)
+		return map[string]int{"nodes": 3}, nil
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	failed, err := r.Submit(ctx, pool, kind, map[string]string{}, "", func(context.Context, Reporter) (interface{}, error) {
+		return nil, errors.New("no schedule data in database")
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	r.Wait()
+
+	job, err := Get(ctx, pool, ok.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, StatusSucceeded, job.Status)
+		assert.Equal(t, 100, job.Progress)
+		assert.Equal(t, "Building nodes", job.Step)
+		assert.JSONEq(t, `{"nodes":3}`, string(job.Result))
+	}
+	job, err = Get(ctx, pool, failed.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, StatusFailed, job.Status)
+		assert.Equal(t, "no schedule data in database", job.Error)
+		assert.NotNil(t, job.FinishedAt)
+	}
+
+	active, err := Active(ctx, pool, kind)
+	assert.NoError(t, err)
+	assert.Nil(t, active, "both jobs finished")
+
+	_, err = Get(ctx, pool, "3f2b9c1e-7a4d-4f7e-9b1a-2c8d5e6f7a8b")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
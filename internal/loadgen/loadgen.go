@@ -0,0 +1,375 @@
+// Package loadgen sends a target PassBi API a realistic mix of route
+// searches, nearby stop lookups and departure boards at a set rate, for
+// capacity testing of the graph, the cache and the rate limiter
+//
+// Requests go out at the rate asked whatever the latency, as riders' would:
+// a slow target gets more requests in flight rather than fewer requests
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of request
+const (
+	KindRouteSearch = "route-search"
+	KindNearby      = "nearby"
+	KindDepartures  = "departures"
+)
+
+// Kinds lists the kinds of request in report order
+var Kinds = []string{KindRouteSearch, KindNearby, KindDepartures}
+
+// Config holds the traffic settings
+type Config struct {
+	Target      string         // base URL of the API, such as http://localhost:8080
+	APIKey      string         // sent as a bearer token when set
+	RPS         float64        // requests per second once ramped up
+	Duration    time.Duration  // how long requests are sent, ramp included
+	Ramp        time.Duration  // how long the rate takes to rise from 0 to RPS
+	Concurrency int            // most requests in flight; ticks beyond it are dropped
+	Timeout     time.Duration  // of each request
+	Mix         map[string]int // weight of each kind
+	Area        Area
+	Hotspots    int     // places riders search from and to most
+	Fresh       float64 // share of places picked anywhere in Area, missing the cache
+	Seed        int64
+}
+
+// Area is the disc requests pick places in
+type Area struct {
+	Lat, Lon float64
+	Radius   float64 // meters
+}
+
+// DefaultConfig sends 10 requests per second for a minute over Dakar: half
+// route searches, 3 in 10 nearby lookups and 2 in 10 departure boards
+func DefaultConfig() Config {
+	return Config{
+		Target:      "http://localhost:8080",
+		RPS:         10,
+		Duration:    time.Minute,
+		Concurrency: 256,
+		Timeout:     30 * time.Second,
+		Mix:         map[string]int{KindRouteSearch: 5, KindNearby: 3, KindDepartures: 2},
+		Area:        Area{Lat: 14.7167, Lon: -17.4677, Radius: 8000},
+		Hotspots:    200,
+		Fresh:       0.2,
+		Seed:        time.Now().UnixNano(),
+	}
+}
+
+// ParseMix parses weights such as "route-search=5,nearby=3,departures=2";
+// kinds left out get no traffic
+func ParseMix(s string) (map[string]int, error) {
+	mix := make(map[string]int)
+	total := 0
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kind, weight, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid mix %q: use kind=weight", part)
+		}
+		kind = strings.TrimSpace(kind)
+		if !validKind(kind) {
+			return nil, fmt.Errorf("unknown kind %q (use %s)", kind, strings.Join(Kinds, ", "))
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(weight))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid weight %q for %s", weight, kind)
+		}
+		mix[kind] = n
+		total += n
+	}
+	if total == 0 {
+		return nil, errors.New("the mix has no traffic")
+	}
+	return mix, nil
+}
+
+func validKind(kind string) bool {
+	for _, k := range Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the settings before a run
+func (cfg Config) Validate() error {
+	if !strings.HasPrefix(cfg.Target, "http://") && !strings.HasPrefix(cfg.Target, "https://") {
+		return fmt.Errorf("target %q must be an http:// or https:// URL", cfg.Target)
+	}
+	if cfg.RPS <= 0 || math.IsInf(cfg.RPS, 0) || math.IsNaN(cfg.RPS) {
+		return errors.New("rps must be positive")
+	}
+	if cfg.Duration <= 0 {
+		return errors.New("duration must be positive")
+	}
+	if cfg.Ramp < 0 || cfg.Ramp > cfg.Duration {
+		return errors.New("ramp must be between 0 and the duration")
+	}
+	if cfg.Concurrency <= 0 {
+		return errors.New("concurrency must be positive")
+	}
+	if cfg.Hotspots <= 0 {
+		return errors.New("hotspots must be positive")
+	}
+	if cfg.Fresh < 0 || cfg.Fresh > 1 {
+		return errors.New("fresh must be between 0 and 1")
+	}
+	if cfg.Area.Radius <= 0 {
+		return errors.New("the area radius must be positive")
+	}
+	total := 0
+	for _, w := range cfg.Mix {
+		total += w
+	}
+	if total == 0 {
+		return errors.New("the mix has no traffic")
+	}
+	return nil
+}
+
+// rate is the requests per second elapsed into the run
+func (cfg Config) rate(elapsed time.Duration) float64 {
+	if cfg.Ramp <= 0 || elapsed >= cfg.Ramp {
+		return cfg.RPS
+	}
+	// Starting from a trickle, not from nothing, so the first tick comes
+	return math.Max(cfg.RPS*float64(elapsed)/float64(cfg.Ramp), cfg.RPS/100)
+}
+
+// Run sends traffic to cfg.Target until cfg.Duration has passed or ctx is
+// done, then waits for the requests in flight and reports on them
+// Progress, when set, is called every second with the report so far
+func Run(ctx context.Context, cfg Config, client *http.Client, progress func(*Report)) (*Report, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = &http.Client{Timeout: cfg.Timeout, Transport: &http.Transport{
+			MaxIdleConnsPerHost: cfg.Concurrency,
+		}}
+	}
+
+	traffic := newTraffic(cfg)
+	rec := newRecorder()
+	sem := make(chan struct{}, cfg.Concurrency)
+	var wg sync.WaitGroup
+
+	runCtx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	start := time.Now()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	next := start
+	for {
+		wait := time.Until(next)
+		select {
+		case <-runCtx.Done():
+			// Achieved over the time requests were sent, not the wait after
+			elapsed := time.Since(start)
+			wg.Wait()
+			return rec.report(elapsed), nil
+		case <-ticker.C:
+			if progress != nil {
+				progress(rec.report(time.Since(start)))
+			}
+			continue
+		case <-time.After(wait):
+		}
+
+		select {
+		case sem <- struct{}{}:
+			req := traffic.next()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				res := send(ctx, client, cfg, req)
+				traffic.learn(res.stopIDs)
+				rec.record(res)
+			}()
+		default:
+			rec.drop()
+		}
+		next = next.Add(time.Duration(float64(time.Second) / cfg.rate(time.Since(start))))
+	}
+}
+
+// send makes one request; it is bounded by cfg.Timeout rather than the end
+// of the run, so requests in flight complete (unless ctx is cancelled)
+func send(ctx context.Context, client *http.Client, cfg Config, r request) result {
+	res := result{kind: r.kind}
+	reqCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, strings.TrimRight(cfg.Target, "/")+r.path, nil)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	req.Header.Set("User-Agent", "passbi-load")
+	if cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+	}
+
+	started := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		res.latency = time.Since(started)
+		res.err = err
+		return res
+	}
+	defer resp.Body.Close()
+	res.status = resp.StatusCode
+	res.cacheHit = resp.Header.Get("X-Cache-Hit") == "true"
+	if r.kind == KindNearby && resp.StatusCode == http.StatusOK {
+		res.stopIDs = readStopIDs(resp.Body)
+	} else {
+		drain(resp.Body)
+	}
+	res.latency = time.Since(started)
+	return res
+}
+
+// Report summarizes a run
+type Report struct {
+	Elapsed  float64      `json:"elapsed_seconds"`
+	Sent     int          `json:"sent"`
+	Dropped  int          `json:"dropped"` // ticks skipped with Concurrency requests in flight
+	Achieved float64      `json:"achieved_rps"`
+	Kinds    []KindReport `json:"kinds"`
+}
+
+// KindReport summarizes the requests of a kind
+type KindReport struct {
+	Kind        string `json:"kind"`
+	Requests    int    `json:"requests"`
+	OK          int    `json:"ok"`           // 2xx and 3xx
+	ClientError int    `json:"client_error"` // 4xx but 429
+	RateLimited int    `json:"rate_limited"` // 429
+	ServerError int    `json:"server_error"` // 5xx
+	Failed      int    `json:"failed"`       // no response: timeouts, refused connections
+	CacheHits   int    `json:"cache_hits"`
+	// Latencies of the responses, in milliseconds
+	P50 float64 `json:"p50_ms"`
+	P90 float64 `json:"p90_ms"`
+	P99 float64 `json:"p99_ms"`
+	Max float64 `json:"max_ms"`
+}
+
+// result is the outcome of a request
+type result struct {
+	kind     string
+	status   int
+	err      error
+	latency  time.Duration
+	cacheHit bool
+	stopIDs  []string
+}
+
+// recorder collects results as they come
+type recorder struct {
+	mu        sync.Mutex
+	dropped   int
+	results   map[string]*KindReport
+	latencies map[string][]time.Duration
+}
+
+func newRecorder() *recorder {
+	return &recorder{results: make(map[string]*KindReport), latencies: make(map[string][]time.Duration)}
+}
+
+func (r *recorder) drop() {
+	r.mu.Lock()
+	r.dropped++
+	r.mu.Unlock()
+}
+
+func (r *recorder) record(res result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k, ok := r.results[res.kind]
+	if !ok {
+		k = &KindReport{Kind: res.kind}
+		r.results[res.kind] = k
+	}
+	k.Requests++
+	switch {
+	case res.err != nil:
+		k.Failed++
+	case res.status == http.StatusTooManyRequests:
+		k.RateLimited++
+	case res.status >= 500:
+		k.ServerError++
+	case res.status >= 400:
+		k.ClientError++
+	default:
+		k.OK++
+	}
+	if res.cacheHit {
+		k.CacheHits++
+	}
+	if res.err == nil {
+		r.latencies[res.kind] = append(r.latencies[res.kind], res.latency)
+	}
+}
+
+func (r *recorder) report(elapsed time.Duration) *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := &Report{Elapsed: elapsed.Seconds(), Dropped: r.dropped, Kinds: []KindReport{}}
+	for _, kind := range Kinds {
+		k, ok := r.results[kind]
+		if !ok {
+			continue
+		}
+		kr := *k
+		p50, p90, p99, max := percentiles(r.latencies[kind])
+		kr.P50, kr.P90, kr.P99, kr.Max = millis(p50), millis(p90), millis(p99), millis(max)
+		report.Kinds = append(report.Kinds, kr)
+		report.Sent += kr.Requests
+	}
+	if elapsed > 0 {
+		report.Achieved = float64(report.Sent) / elapsed.Seconds()
+	}
+	return report
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// percentiles returns the 50th, 90th and 99th percentiles and the maximum of
+// latencies, nearest rank
+func percentiles(latencies []time.Duration) (p50, p90, p99, max time.Duration) {
+	if len(latencies) == 0 {
+		return 0, 0, 0, 0
+	}
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := func(p float64) time.Duration {
+		i := int(math.Ceil(p*float64(len(sorted)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return sorted[i]
+	}
+	return rank(0.5), rank(0.9), rank(0.99), sorted[len(sorted)-1]
+}
@@ -0,0 +1,122 @@
+package loadgen
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMix(t *testing.T) {
+	mix, err := ParseMix("route-search=5, nearby=3,departures=0")
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]int{KindRouteSearch: 5, KindNearby: 3, KindDepartures: 0}, mix)
+	}
+
+	for _, bad := range []string{"", "nearby", "search=1", "nearby=-1", "nearby=x", "departures=0"} {
+		_, err := ParseMix(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestPercentiles(t *testing.T) {
+	var latencies []time.Duration
+	for i := 100; i >= 1; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	p50, p90, p99, max := percentiles(latencies)
+	assert.Equal(t, 50*time.Millisecond, p50)
+	assert.Equal(t, 90*time.Millisecond, p90)
+	assert.Equal(t, 99*time.Millisecond, p99)
+	assert.Equal(t, 100*time.Millisecond, max)
+	assert.Equal(t, 100*time.Millisecond, latencies[0], "left unsorted")
+
+	p50, _, _, _ = percentiles(nil)
+	assert.Zero(t, p50)
+}
+
+func TestTrafficPlaces(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Seed = 1
+	cfg.Fresh = 0
+	tr := newTraffic(cfg)
+
+	seen := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		p := tr.place()
+		assert.InDelta(t, cfg.Area.Lat, p[0], 0.08)
+		assert.InDelta(t, cfg.Area.Lon, p[1], 0.08)
+		seen[coords(p)]++
+	}
+	assert.LessOrEqual(t, len(seen), cfg.Hotspots)
+	busiest := 0
+	for _, n := range seen {
+		busiest = max(busiest, n)
+	}
+	assert.Greater(t, busiest, 100, "a few hotspots take most searches")
+
+	// Departure boards wait for stops from nearby responses
+	cfg.Mix = map[string]int{KindDepartures: 1}
+	tr = newTraffic(cfg)
+	assert.Equal(t, KindNearby, tr.next().kind)
+	tr.learn([]string{"S1", "S1"})
+	r := tr.next()
+	assert.Equal(t, KindDepartures, r.kind)
+	assert.Equal(t, "/v2/stops/S1/departures", r.path)
+	assert.Len(t, tr.stops, 1)
+}
+
+func TestRun(t *testing.T) {
+	var mu sync.Mutex
+	paths := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		switch {
+		case r.URL.Path == "/v2/stops/nearby":
+			paths["nearby"]++
+			w.Header().Set("X-Cache-Hit", "true")
+			w.Write([]byte(`{"stops":[{"id":"S1","name":"Gare"}]}`))
+		case strings.HasSuffix(r.URL.Path, "/departures"):
+			paths["departures"]++
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			paths["route-search"]++
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig()
+	cfg.Target = srv.URL
+	cfg.APIKey = "secret"
+	cfg.RPS = 200
+	cfg.Duration = 300 * time.Millisecond
+	cfg.Seed = 1
+
+	report, err := Run(context.Background(), cfg, srv.Client(), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Greater(t, report.Sent, 20)
+	assert.Zero(t, report.Dropped)
+	if !assert.Len(t, report.Kinds, 3) {
+		return
+	}
+	search, nearby, departures := report.Kinds[0], report.Kinds[1], report.Kinds[2]
+	assert.Equal(t, search.Requests, search.ServerError)
+	assert.Equal(t, nearby.Requests, nearby.OK)
+	assert.Equal(t, nearby.Requests, nearby.CacheHits)
+	assert.Equal(t, departures.Requests, departures.RateLimited)
+	assert.Equal(t, paths["nearby"], nearby.Requests)
+
+	cfg.RPS = 0
+	_, err = Run(context.Background(), cfg, nil, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,150 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/url"
+	"sync"
+)
+
+// maxStops bounds the stops departure boards are asked for
+const maxStops = 2000
+
+// request is a request to send, by its path and query
+type request struct {
+	kind string
+	path string
+}
+
+// traffic picks the requests of a run
+// Riders search from and to a few places far more than others: a place is
+// a hotspot picked by a Zipf law, so the busiest are often cached, or with
+// probability Fresh a new place anywhere in the area, which misses the cache
+type traffic struct {
+	mu       sync.Mutex
+	rng      *rand.Rand
+	cfg      Config
+	hotspots [][2]float64
+	zipf     *rand.Zipf
+	kinds    []string // one per weight unit
+	stops    []string // learnt from nearby responses
+	known    map[string]bool
+}
+
+func newTraffic(cfg Config) *traffic {
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	t := &traffic{rng: rng, cfg: cfg, known: make(map[string]bool)}
+	for i := 0; i < cfg.Hotspots; i++ {
+		t.hotspots = append(t.hotspots, t.randomPlace())
+	}
+	t.zipf = rand.NewZipf(rng, 1.1, 1, uint64(cfg.Hotspots-1))
+	for _, kind := range Kinds {
+		for i := 0; i < cfg.Mix[kind]; i++ {
+			t.kinds = append(t.kinds, kind)
+		}
+	}
+	return t
+}
+
+// next picks the next request
+// Departure boards need stops, so until a nearby response names some, a
+// nearby lookup goes instead
+func (t *traffic) next() request {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	kind := t.kinds[t.rng.Intn(len(t.kinds))]
+	if kind == KindDepartures && len(t.stops) == 0 {
+		kind = KindNearby
+	}
+	switch kind {
+	case KindRouteSearch:
+		from, to := t.place(), t.place()
+		for i := 0; to == from && i < 10; i++ {
+			to = t.place()
+		}
+		q := url.Values{}
+		q.Set("from", coords(from))
+		q.Set("to", coords(to))
+		return request{kind: kind, path: "/v2/route-search?" + q.Encode()}
+	case KindNearby:
+		p := t.place()
+		q := url.Values{}
+		q.Set("lat", fmt.Sprintf("%.5f", p[0]))
+		q.Set("lon", fmt.Sprintf("%.5f", p[1]))
+		q.Set("radius", "500")
+		return request{kind: kind, path: "/v2/stops/nearby?" + q.Encode()}
+	default:
+		stop := t.stops[t.rng.Intn(len(t.stops))]
+		return request{kind: kind, path: "/v2/stops/" + url.PathEscape(stop) + "/departures"}
+	}
+}
+
+// learn adds stops named by a nearby response
+func (t *traffic) learn(stopIDs []string) {
+	if len(stopIDs) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, id := range stopIDs {
+		if len(t.stops) >= maxStops {
+			return
+		}
+		if !t.known[id] {
+			t.known[id] = true
+			t.stops = append(t.stops, id)
+		}
+	}
+}
+
+// place returns a hotspot or, with probability Fresh, a new place
+func (t *traffic) place() [2]float64 {
+	if t.rng.Float64() < t.cfg.Fresh {
+		return t.randomPlace()
+	}
+	return t.hotspots[t.zipf.Uint64()]
+}
+
+// randomPlace returns a place picked evenly in the area
+func (t *traffic) randomPlace() [2]float64 {
+	a := t.cfg.Area
+	// sqrt keeps the density even rather than bunched at the center
+	d := a.Radius * math.Sqrt(t.rng.Float64())
+	bearing := 2 * math.Pi * t.rng.Float64()
+	dLat := d * math.Cos(bearing) / 111320
+	dLon := d * math.Sin(bearing) / (111320 * math.Cos(a.Lat*math.Pi/180))
+	return [2]float64{a.Lat + dLat, a.Lon + dLon}
+}
+
+func coords(p [2]float64) string {
+	return fmt.Sprintf("%.5f,%.5f", p[0], p[1])
+}
+
+// readStopIDs reads the stop IDs of a nearby response
+func readStopIDs(body io.Reader) []string {
+	var resp struct {
+		Stops []struct {
+			ID string `json:"id"`
+		} `json:"stops"`
+	}
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return nil
+	}
+	drain(body)
+	ids := make([]string, 0, len(resp.Stops))
+	for _, s := range resp.Stops {
+		if s.ID != "" {
+			ids = append(ids, s.ID)
+		}
+	}
+	return ids
+}
+
+// drain reads what is left of a body so its connection is reused
+func drain(body io.Reader) {
+	io.Copy(io.Discard, body)
+}
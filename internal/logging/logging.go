@@ -0,0 +1,156 @@
+// Package logging configures the process-wide structured logger (log/slog)
+// Packages log through a component logger from For; records logged with a
+// request's context (slog's *Context methods) also carry its request_id and
+// partner_id. Output is JSON by default, with the level and format set by
+// LOG_LEVEL and LOG_FORMAT. Calls to the standard log package still work and
+// are written by the same handler at info level
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/errreport"
+)
+
+// Config holds the logger configuration
+type Config struct {
+	Level  slog.Level
+	Format string // json or text
+}
+
+// LoadConfigFromEnv loads the logger configuration from environment variables
+func LoadConfigFromEnv() *Config {
+	return &Config{
+		Level:  ParseLevel(os.Getenv("LOG_LEVEL")),
+		Format: strings.ToLower(getEnv("LOG_FORMAT", "json")),
+	}
+}
+
+// ParseLevel parses debug, info, warn or error; anything else is info
+func ParseLevel(s string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// Setup installs the default logger for a service (api, importer, ...)
+// configured from the environment, writing to stderr
+func Setup(service string) {
+	SetupWithConfig(service, LoadConfigFromEnv(), os.Stderr)
+}
+
+// SetupWithConfig installs the default logger writing to w
+func SetupWithConfig(service string, cfg *Config, w io.Writer) {
+	opts := &slog.HandlerOptions{Level: cfg.Level}
+
+	var h slog.Handler
+	if cfg.Format == "text" {
+		h = slog.NewTextHandler(w, opts)
+	} else {
+		h = slog.NewJSONHandler(w, opts)
+	}
+
+	// Error records are also sent to the error tracker, if one is set up
+	h = errreport.Handler(h)
+
+	slog.SetDefault(slog.New(requestHandler{h}).With("service", service))
+}
+
+// For returns the logger of a component (api, graph, importer, ...)
+// It may be created in a package variable: records go to the default logger
+// installed when they are logged, not when For is called
+func For(component string) *slog.Logger {
+	return slog.New(&lazyHandler{attrs: []slog.Attr{slog.String("component", component)}})
+}
+
+// Fatal logs msg at error level and exits, like log.Fatalf
+// The error is sent to the error tracker before exiting
+func Fatal(l *slog.Logger, msg string, args ...any) {
+	l.Error(msg, args...)
+	errreport.Flush(2 * time.Second)
+	os.Exit(1)
+}
+
+// requestHandler adds the request_id and partner_id of the request a record
+// was logged for. Fiber stores request locals in its *fasthttp.RequestCtx,
+// which handlers pass down as their context, so they are found with Value
+type requestHandler struct {
+	slog.Handler
+}
+
+func (h requestHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx != nil {
+		if id, ok := ctx.Value("request_id").(string); ok && id != "" {
+			r.AddAttrs(slog.String("request_id", id))
+		}
+		// The authenticated partner renders itself as its ID
+		if partner, ok := ctx.Value("partner").(slog.LogValuer); ok {
+			r.AddAttrs(slog.Any("partner_id", partner))
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h requestHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestHandler) WithGroup(name string) slog.Handler {
+	return requestHandler{h.Handler.WithGroup(name)}
+}
+
+// lazyHandler forwards records to the current default handler
+type lazyHandler struct {
+	attrs []slog.Attr
+	group string
+}
+
+func (h *lazyHandler) target() slog.Handler {
+	t := slog.Default().Handler().WithAttrs(h.attrs)
+	if h.group != "" {
+		t = t.WithGroup(h.group)
+	}
+	return t
+}
+
+func (h *lazyHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return slog.Default().Handler().Enabled(ctx, level)
+}
+
+func (h *lazyHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.target().Handle(ctx, r)
+}
+
+func (h *lazyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if h.group != "" {
+		return h.target().WithAttrs(attrs)
+	}
+	return &lazyHandler{attrs: append(append([]slog.Attr(nil), h.attrs...), attrs...)}
+}
+
+func (h *lazyHandler) WithGroup(name string) slog.Handler {
+	if h.group != "" {
+		return h.target().WithGroup(name)
+	}
+	return &lazyHandler{attrs: h.attrs, group: name}
+}
+
+// getEnv retrieves an environment variable with a fallback default value
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
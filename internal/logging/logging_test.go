@@ -0,0 +1,102 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+type testPartner struct{ id, secret string }
+
+func (p *testPartner) LogValue() slog.Value { return slog.StringValue(p.id) }
+
+// capture installs a JSON logger writing to a buffer for the test
+func capture(t *testing.T, level slog.Level) *bytes.Buffer {
+	prev := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	var buf bytes.Buffer
+	SetupWithConfig("api", &Config{Level: level, Format: "json"}, &buf)
+	return &buf
+}
+
+func records(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var out []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]interface{}
+		if assert.NoError(t, json.Unmarshal([]byte(line), &rec), line) {
+			out = append(out, rec)
+		}
+	}
+	return out
+}
+
+func TestComponentLoggerCreatedBeforeSetup(t *testing.T) {
+	logger := For("graph")
+	buf := capture(t, slog.LevelInfo)
+
+	logger.Info("Graph loaded", "nodes", 42)
+	logger.Debug("Loaded edges")
+
+	recs := records(t, buf)
+	if assert.Len(t, recs, 1, "debug records are filtered out") {
+		assert.Equal(t, "Graph loaded", recs[0]["msg"])
+		assert.Equal(t, "INFO", recs[0]["level"])
+		assert.Equal(t, "api", recs[0]["service"])
+		assert.Equal(t, "graph", recs[0]["component"])
+		assert.Equal(t, float64(42), recs[0]["nodes"])
+	}
+}
+
+func TestRequestFields(t *testing.T) {
+	buf := capture(t, slog.LevelInfo)
+
+	// Fiber keeps request locals as user values of the fasthttp context
+	rc := &fasthttp.RequestCtx{}
+	rc.SetUserValue("request_id", "req-1")
+	rc.SetUserValue("partner", &testPartner{id: "partner-1", secret: "pk_live_x"})
+	ctx := context.WithValue(context.Context(rc), struct{}{}, "derived")
+
+	For("api").ErrorContext(ctx, "Database error", "error", "boom")
+	For("api").Warn("No request")
+
+	recs := records(t, buf)
+	if assert.Len(t, recs, 2) {
+		assert.Equal(t, "req-1", recs[0]["request_id"])
+		assert.Equal(t, "partner-1", recs[0]["partner_id"])
+		assert.Equal(t, "ERROR", recs[0]["level"])
+		assert.NotContains(t, buf.String(), "pk_live_x")
+
+		assert.NotContains(t, recs[1], "request_id")
+	}
+}
+
+func TestStandardLogIsStructured(t *testing.T) {
+	buf := capture(t, slog.LevelInfo)
+
+	log.Printf("legacy %d", 1)
+
+	recs := records(t, buf)
+	if assert.Len(t, recs, 1) {
+		assert.Equal(t, "legacy 1", recs[0]["msg"])
+		assert.Equal(t, "api", recs[0]["service"])
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	assert.Equal(t, slog.LevelDebug, ParseLevel("DEBUG"))
+	assert.Equal(t, slog.LevelWarn, ParseLevel("warning"))
+	assert.Equal(t, slog.LevelError, ParseLevel("error"))
+	assert.Equal(t, slog.LevelInfo, ParseLevel(""))
+	assert.Equal(t, slog.LevelInfo, ParseLevel("verbose"))
+}
@@ -0,0 +1,196 @@
+// Package mapmatch snaps GPS fixes to the line a trip follows, its GTFS shape
+// or else the straight legs between its stops, and measures how far along
+// the trip they are
+package mapmatch
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const earthRadius = 6371000 // meters
+
+// sameRoad is how much further from a fix than the closest part of a line
+// another part may be and still be taken as the same road; the earliest such
+// part wins, so a road driven both ways matches its first pass
+const sameRoad = 20.0 // meters
+
+// Line is a polyline with the distance along it of each point
+type Line struct {
+	lats, lons []float64
+	dist       []float64 // meters from the first point
+}
+
+// NewLine returns the line through the given points, skipping repeated
+// ones; nil when fewer than two distinct points remain
+func NewLine(lats, lons []float64) *Line {
+	if len(lats) != len(lons) {
+		return nil
+	}
+	l := &Line{}
+	for i := range lats {
+		n := len(l.lats)
+		if n > 0 && l.lats[n-1] == lats[i] && l.lons[n-1] == lons[i] {
+			continue
+		}
+		d := 0.0
+		if n > 0 {
+			d = l.dist[n-1] + Distance(l.lats[n-1], l.lons[n-1], lats[i], lons[i])
+		}
+		l.lats = append(l.lats, lats[i])
+		l.lons = append(l.lons, lons[i])
+		l.dist = append(l.dist, d)
+	}
+	if len(l.lats) < 2 {
+		return nil
+	}
+	return l
+}
+
+// Length is the length of the line in meters
+func (l *Line) Length() float64 {
+	return l.dist[len(l.dist)-1]
+}
+
+// Match is a point snapped to a line
+type Match struct {
+	Distance float64 // meters along the line
+	Offset   float64 // meters between the point and the line
+	Lat, Lon float64 // the snapped point
+}
+
+// Locate snaps a point to the closest part of the line at least minDistance
+// along it; parts within sameRoad of the closest count as close, and the
+// earliest of them is taken
+func (l *Line) Locate(lat, lon, minDistance float64) (Match, bool) {
+	if l == nil || minDistance > l.Length() {
+		return Match{}, false
+	}
+
+	matches := make([]Match, 0, len(l.lats)-1)
+	best := math.Inf(1)
+	for i := 0; i+1 < len(l.lats); i++ {
+		if l.dist[i+1] < minDistance {
+			continue
+		}
+		m := l.project(i, lat, lon, minDistance)
+		matches = append(matches, m)
+		best = min(best, m.Offset)
+	}
+	for _, m := range matches {
+		if m.Offset <= best+sameRoad {
+			return m, true
+		}
+	}
+	return Match{}, false
+}
+
+// project snaps a point to segment i, no earlier than minDistance along the
+// line, in a plane tangent at the segment's start
+func (l *Line) project(i int, lat, lon, minDistance float64) Match {
+	ax, ay := 0.0, 0.0
+	bx, by := planar(l.lats[i], l.lons[i], l.lats[i+1], l.lons[i+1])
+	px, py := planar(l.lats[i], l.lons[i], lat, lon)
+
+	length := l.dist[i+1] - l.dist[i]
+	t := 0.0
+	if sq := bx*bx + by*by; sq > 0 {
+		t = ((px-ax)*(bx-ax) + (py-ay)*(by-ay)) / sq
+	}
+	t = math.Max(0, math.Min(1, t))
+	if length > 0 && l.dist[i]+t*length < minDistance {
+		t = (minDistance - l.dist[i]) / length
+	}
+
+	sx, sy := ax+t*(bx-ax), ay+t*(by-ay)
+	return Match{
+		Distance: l.dist[i] + t*length,
+		Offset:   math.Hypot(px-sx, py-sy),
+		Lat:      l.lats[i] + t*(l.lats[i+1]-l.lats[i]),
+		Lon:      l.lons[i] + t*(l.lons[i+1]-l.lons[i]),
+	}
+}
+
+// StopDistances locates stops, in the order a trip calls at them, on the
+// line; each stop is at or after the previous one
+func (l *Line) StopDistances(lats, lons []float64) []float64 {
+	distances := make([]float64, len(lats))
+	at := 0.0
+	for i := range lats {
+		if m, ok := l.Locate(lats[i], lons[i], at); ok {
+			at = m.Distance
+		}
+		distances[i] = at
+	}
+	return distances
+}
+
+// planar returns the position of a point in meters east and north of an
+// origin; accurate enough over the length of a shape segment
+func planar(originLat, originLon, lat, lon float64) (x, y float64) {
+	x = (lon - originLon) * math.Pi / 180 * earthRadius * math.Cos(originLat*math.Pi/180)
+	y = (lat - originLat) * math.Pi / 180 * earthRadius
+	return x, y
+}
+
+// Distance is the great-circle distance between two points in meters
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	lat1Rad := lat1 * math.Pi / 180
+	lat2Rad := lat2 * math.Pi / 180
+	deltaLat := (lat2 - lat1) * math.Pi / 180
+	deltaLon := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
+		math.Cos(lat1Rad)*math.Cos(lat2Rad)*
+			math.Sin(deltaLon/2)*math.Sin(deltaLon/2)
+
+	return earthRadius * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// ShapeKey identifies a shape of an agency's feed
+type ShapeKey struct {
+	AgencyID string
+	ShapeID  string
+}
+
+// LoadShapes returns the lines of the given shapes imported from shapes.txt;
+// unknown shapes are left out
+func LoadShapes(ctx context.Context, pool *pgxpool.Pool, keys []ShapeKey) (map[ShapeKey]*Line, error) {
+	lines := make(map[ShapeKey]*Line)
+	if len(keys) == 0 {
+		return lines, nil
+	}
+	agencies, shapes := make([]string, len(keys)), make([]string, len(keys))
+	for i, k := range keys {
+		agencies[i], shapes[i] = k.AgencyID, k.ShapeID
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT s.agency_id, s.shape_id, s.lats, s.lons
+		FROM shape s
+		JOIN (SELECT DISTINCT * FROM unnest($1::text[], $2::text[])) AS k(agency_id, shape_id)
+			ON s.agency_id = k.agency_id AND s.shape_id = k.shape_id
+	`, agencies, shapes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shapes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var k ShapeKey
+		var lats, lons []float64
+		if err := rows.Scan(&k.AgencyID, &k.ShapeID, &lats, &lons); err != nil {
+			return nil, err
+		}
+		if line := NewLine(lats, lons); line != nil {
+			lines[k] = line
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query shapes: %w", err)
+	}
+	return lines, nil
+}
@@ -0,0 +1,64 @@
+package mapmatch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// About 1.1 km north, then 1.1 km east, from Place de l'Indépendance
+var (
+	lats = []float64{14.670, 14.680, 14.680}
+	lons = []float64{-17.430, -17.430, -17.4198}
+)
+
+func TestNewLine(t *testing.T) {
+	l := NewLine([]float64{14.67, 14.67, 14.68}, []float64{-17.43, -17.43, -17.43})
+	if assert.NotNil(t, l) {
+		assert.InDelta(t, 1112, l.Length(), 2, "repeated points are skipped")
+	}
+	assert.Nil(t, NewLine([]float64{14.67, 14.67}, []float64{-17.43, -17.43}))
+	assert.Nil(t, NewLine([]float64{14.67}, []float64{-17.43, -17.42}))
+}
+
+func TestLocate(t *testing.T) {
+	l := NewLine(lats, lons)
+
+	// 30 m west of the first leg, halfway up
+	m, ok := l.Locate(14.675, -17.43028, 0)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.InDelta(t, 556, m.Distance, 2)
+	assert.InDelta(t, 30, m.Offset, 1)
+	assert.InDelta(t, -17.43, m.Lon, 1e-9)
+
+	// Past the corner, on the second leg
+	m, _ = l.Locate(14.6801, -17.425, 0)
+	assert.InDelta(t, 1112+538, m.Distance, 5)
+
+	_, ok = l.Locate(14.675, -17.43, l.Length()+1)
+	assert.False(t, ok)
+}
+
+func TestLocateBothWays(t *testing.T) {
+	// Out 1.1 km and back on the same road
+	l := NewLine([]float64{14.670, 14.680, 14.670}, []float64{-17.43, -17.43, -17.43})
+
+	m, _ := l.Locate(14.6725, -17.43, 0)
+	assert.InDelta(t, 278, m.Distance, 2, "the first pass wins")
+
+	m, _ = l.Locate(14.6725, -17.43, 1200)
+	assert.InDelta(t, 1112+834, m.Distance, 2, "the way back once past the turn")
+}
+
+func TestStopDistances(t *testing.T) {
+	l := NewLine(lats, lons)
+
+	d := l.StopDistances([]float64{14.670, 14.680, 14.6801}, []float64{-17.4301, -17.4299, -17.4198})
+	if assert.Len(t, d, 3) {
+		assert.InDelta(t, 0, d[0], 1)
+		assert.InDelta(t, 1112, d[1], 15)
+		assert.InDelta(t, l.Length(), d[2], 1)
+	}
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+// Histogram counts observations into buckets, for latency-like values whose
+// distribution matters more than their total. It is safe for concurrent use
+// Packages hold their histograms, observe values into them and write them
+// from their collector
+type Histogram struct {
+	bounds []float64       // upper bounds, ascending
+	counts []atomic.Uint64 // per bucket, the last one is +Inf
+	count  atomic.Uint64
+	sum    atomic.Uint64 // float64 bits
+}
+
+// NewHistogram creates a histogram with the given bucket upper bounds
+func NewHistogram(bounds ...float64) *Histogram {
+	b := append([]float64(nil), bounds...)
+	sort.Float64s(b)
+	return &Histogram{bounds: b, counts: make([]atomic.Uint64, len(b)+1)}
+}
+
+// Observe records a value
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	for {
+		old := h.sum.Load()
+		if h.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// Count returns the number of observations
+func (h *Histogram) Count() uint64 {
+	return h.count.Load()
+}
+
+// Sum returns the sum of the observations
+func (h *Histogram) Sum() float64 {
+	return math.Float64frombits(h.sum.Load())
+}
+
+// Quantile estimates the value below which a share q (0 to 1) of the
+// observations fall, interpolating within the bucket like Prometheus'
+// histogram_quantile. It returns 0 without observations
+func (h *Histogram) Quantile(q float64) float64 {
+	total := h.count.Load()
+	if total == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+
+	var cumulative uint64
+	for i := range h.counts {
+		n := h.counts[i].Load()
+		if float64(cumulative+n) >= rank && n > 0 {
+			if i == len(h.bounds) {
+				// Beyond the last bound: the best estimate is that bound
+				return h.bounds[len(h.bounds)-1]
+			}
+			lower := 0.0
+			if i > 0 {
+				lower = h.bounds[i-1]
+			}
+			return lower + (h.bounds[i]-lower)*(rank-float64(cumulative))/float64(n)
+		}
+		cumulative += n
+	}
+	return h.bounds[len(h.bounds)-1]
+}
+
+// Histogram writes the buckets, sum and count of a histogram
+func (w *Writer) Histogram(name, help string, h *Histogram, labels ...Label) {
+	w.header(name, "histogram", help)
+
+	var cumulative uint64
+	for i := range h.counts {
+		cumulative += h.counts[i].Load()
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = strconv.FormatFloat(h.bounds[i], 'g', -1, 64)
+		}
+		w.line(name+"_bucket", float64(cumulative), append(labels[:len(labels):len(labels)], L("le", le)))
+	}
+	w.line(name+"_sum", h.Sum(), labels)
+	w.line(name+"_count", float64(h.Count()), labels)
+}
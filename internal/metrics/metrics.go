@@ -0,0 +1,117 @@
+// Package metrics exposes counters and gauges in the Prometheus text format
+// Packages register a collector that writes their current values on each
+// scrape, so no metric state lives here and no client library is needed
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Label is a metric label
+type Label struct {
+	Name  string
+	Value string
+}
+
+// L creates a label
+func L(name, value string) Label {
+	return Label{Name: name, Value: value}
+}
+
+// Collector writes the current value of a package's metrics
+type Collector func(w *Writer)
+
+var (
+	mu         sync.Mutex
+	collectors []Collector
+)
+
+// Register adds a collector called on every scrape
+func Register(c Collector) {
+	mu.Lock()
+	defer mu.Unlock()
+	collectors = append(collectors, c)
+}
+
+// Gather runs every collector and returns the exposition text
+func Gather() string {
+	mu.Lock()
+	cs := append([]Collector(nil), collectors...)
+	mu.Unlock()
+
+	w := &Writer{seen: map[string]bool{}}
+	for _, c := range cs {
+		c(w)
+	}
+	return w.b.String()
+}
+
+// Writer formats samples; the samples of one metric must be written together
+type Writer struct {
+	b    strings.Builder
+	seen map[string]bool
+}
+
+// Counter writes a sample of a monotonically increasing metric
+func (w *Writer) Counter(name, help string, value float64, labels ...Label) {
+	w.sample(name, "counter", help, value, labels)
+}
+
+// Gauge writes a sample of a metric that can go up and down
+func (w *Writer) Gauge(name, help string, value float64, labels ...Label) {
+	w.sample(name, "gauge", help, value, labels)
+}
+
+func (w *Writer) sample(name, typ, help string, value float64, labels []Label) {
+	w.header(name, typ, help)
+	w.line(name, value, labels)
+}
+
+// header writes the HELP and TYPE lines of a metric before its first sample
+func (w *Writer) header(name, typ, help string) {
+	if !w.seen[name] {
+		w.seen[name] = true
+		fmt.Fprintf(&w.b, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, typ)
+	}
+}
+
+func (w *Writer) line(name string, value float64, labels []Label) {
+	w.b.WriteString(name)
+	if len(labels) > 0 {
+		sorted := append([]Label(nil), labels...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+		w.b.WriteByte('{')
+		for i, l := range sorted {
+			if i > 0 {
+				w.b.WriteByte(',')
+			}
+			fmt.Fprintf(&w.b, "%s=%q", l.Name, l.Value)
+		}
+		w.b.WriteByte('}')
+	}
+	w.b.WriteByte(' ')
+	w.b.WriteString(formatValue(value))
+	w.b.WriteByte('\n')
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
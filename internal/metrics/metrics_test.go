@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter(t *testing.T) {
+	w := &Writer{seen: map[string]bool{}}
+	w.Counter("passbi_cache_hits_total", "Cache hits", 12, L("class", "route"), L("layer", "local"))
+	w.Counter("passbi_cache_hits_total", "Cache hits", 3, L("class", "dep"), L("layer", "redis"))
+	w.Gauge("passbi_graph_nodes", "Nodes in the graph", 1.5e6)
+
+	assert.Equal(t, `# HELP passbi_cache_hits_total Cache hits
+# TYPE passbi_cache_hits_total counter
+passbi_cache_hits_total{class="route",layer="local"} 12
+passbi_cache_hits_total{class="dep",layer="redis"} 3
+# HELP passbi_graph_nodes Nodes in the graph
+# TYPE passbi_graph_nodes gauge
+passbi_graph_nodes 1.5e+06
+`, w.b.String())
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram(100, 1000, 10000)
+	for _, v := range []float64{50, 80, 400, 900, 20000} {
+		h.Observe(v)
+	}
+
+	w := &Writer{seen: map[string]bool{}}
+	w.Histogram("passbi_routing_explored_nodes", "Nodes explored per search", h, L("strategy", "fast"))
+
+	assert.Equal(t, `# HELP passbi_routing_explored_nodes Nodes explored per search
+# TYPE passbi_routing_explored_nodes histogram
+passbi_routing_explored_nodes_bucket{le="100",strategy="fast"} 2
+passbi_routing_explored_nodes_bucket{le="1000",strategy="fast"} 4
+passbi_routing_explored_nodes_bucket{le="10000",strategy="fast"} 4
+passbi_routing_explored_nodes_bucket{le="+Inf",strategy="fast"} 5
+passbi_routing_explored_nodes_sum{strategy="fast"} 21430
+passbi_routing_explored_nodes_count{strategy="fast"} 5
+`, w.b.String())
+
+	assert.Equal(t, 100.0, h.Quantile(0.4))
+	assert.Equal(t, 550.0, h.Quantile(0.6))
+	assert.Equal(t, 10000.0, h.Quantile(0.99))
+	assert.Equal(t, 0.0, NewHistogram(1).Quantile(0.5))
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/passbi/passbi_core/internal/logging"
+)
+
+var accessLogger = logging.For("http")
+
+// AccessLog logs every request once it has been answered
+// Server errors are logged at error level, everything else at info level, so
+// LOG_LEVEL=warn keeps only failures. The record carries the request_id and
+// the partner_id once authentication has run
+func AccessLog() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			// The error handler renders the response after us
+			status = fiber.StatusInternalServerError
+			var fe *fiber.Error
+			if errors.As(err, &fe) {
+				status = fe.Code
+			}
+		}
+
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+
+		attrs := []any{
+			"method", c.Method(),
+			"path", c.Path(),
+			"route", c.Route().Path,
+			"status", status,
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"ip", ClientIP(c).String(),
+		}
+		if err != nil {
+			attrs = append(attrs, "error", err)
+		}
+		accessLogger.Log(c.Context(), level, "request", attrs...)
+		return err
+	}
+}
@@ -3,10 +3,11 @@ package middleware
 import (
 	"context"
 	"fmt"
-	"log"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -14,6 +15,7 @@ import (
 type RequestLog struct {
 	PartnerID      string
 	APIKeyID       string
+	RequestID      string
 	Endpoint       string
 	Method         string
 	ResponseTimeMs int
@@ -24,6 +26,8 @@ type RequestLog struct {
 	IPAddress      string
 	UserAgent      string
 	Timestamp      time.Time
+	Sandbox        bool
+	StopID         string // stop of /stops/:id requests
 }
 
 // Location represents a geographic coordinate
@@ -32,8 +36,18 @@ type Location struct {
 	Lon float64
 }
 
+// point converts a location to a PostgreSQL POINT (x = lon, y = lat)
+// A nil location is stored as NULL
+func (l *Location) point() pgtype.Point {
+	if l == nil {
+		return pgtype.Point{}
+	}
+	return pgtype.Point{P: pgtype.Vec2{X: l.Lon, Y: l.Lat}, Valid: true}
+}
+
 // AnalyticsMiddleware logs all API requests for analytics and billing
-func AnalyticsMiddleware(db *pgxpool.Pool) fiber.Handler {
+// Logs are written in batches by usage
+func AnalyticsMiddleware(usage *UsageWriter) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Record start time
 		start := time.Now()
@@ -59,7 +73,7 @@ func AnalyticsMiddleware(db *pgxpool.Pool) fiber.Handler {
 
 		// Extract location data if available (for route-search endpoint)
 		var fromLoc, toLoc *Location
-		if c.Path() == "/v2/route-search" {
+		if strings.HasSuffix(c.Path(), "/route-search") {
 			if from := c.Query("from"); from != "" {
 				fromLoc = parseLocationFromQuery(from)
 			}
@@ -68,24 +82,34 @@ func AnalyticsMiddleware(db *pgxpool.Pool) fiber.Handler {
 			}
 		}
 
+		// Stop requests are kept per stop so crawls can be detected
+		endpoint := endpointPattern(c)
+		var stopID string
+		if strings.Contains(endpoint, "/stops/:id") {
+			stopID = c.Params("id")
+		}
+
 		// Create request log
 		requestLog := &RequestLog{
 			PartnerID:      partner.PartnerID,
 			APIKeyID:       partner.APIKeyID,
-			Endpoint:       c.Path(),
+			RequestID:      GetRequestID(c),
+			Endpoint:       endpoint,
 			Method:         c.Method(),
 			ResponseTimeMs: int(responseTime.Milliseconds()),
 			ResponseStatus: c.Response().StatusCode(),
 			FromLocation:   fromLoc,
 			ToLocation:     toLoc,
 			CacheHit:       cacheHit,
-			IPAddress:      c.IP(),
+			IPAddress:      ClientIP(c).String(),
 			UserAgent:      c.Get("User-Agent"),
 			Timestamp:      time.Now(),
+			Sandbox:        partner.Sandbox,
+			StopID:         stopID,
 		}
 
-		// Log asynchronously (non-blocking)
-		go logRequest(db, requestLog)
+		// Written in the background; blocks briefly only if the buffer is full
+		usage.Log(requestLog)
 
 		// Add custom response headers for debugging
 		c.Set("X-Response-Time", responseTime.String())
@@ -95,139 +119,14 @@ func AnalyticsMiddleware(db *pgxpool.Pool) fiber.Handler {
 	}
 }
 
-// logRequest logs a request to the database
-func logRequest(db *pgxpool.Pool, reqLog *RequestLog) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	query := `
-		INSERT INTO usage_log (
-			partner_id,
-			api_key_id,
-			endpoint,
-			method,
-			response_time_ms,
-			response_status,
-			from_location,
-			to_location,
-			cache_hit,
-			ip_address,
-			user_agent,
-			timestamp
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
-	`
-
-	var fromPoint, toPoint interface{}
-	if reqLog.FromLocation != nil {
-		fromPoint = &reqLog.FromLocation
-	}
-	if reqLog.ToLocation != nil {
-		toPoint = &reqLog.ToLocation
-	}
-
-	_, err := db.Exec(ctx, query,
-		reqLog.PartnerID,
-		reqLog.APIKeyID,
-		reqLog.Endpoint,
-		reqLog.Method,
-		reqLog.ResponseTimeMs,
-		reqLog.ResponseStatus,
-		fromPoint,
-		toPoint,
-		reqLog.CacheHit,
-		reqLog.IPAddress,
-		reqLog.UserAgent,
-		reqLog.Timestamp,
-	)
-
-	if err != nil {
-		log.Println("Failed to log request:", err)
-	}
-
-	// Update quota usage
-	updateQuotaUsage(db, reqLog.PartnerID, reqLog.ResponseStatus >= 200 && reqLog.ResponseStatus < 300)
-}
-
-// updateQuotaUsage updates daily and monthly quota counters
-func updateQuotaUsage(db *pgxpool.Pool, partnerID string, success bool) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	now := time.Now()
-
-	// Update daily quota
-	queryDaily := `
-		INSERT INTO quota_usage (
-			partner_id,
-			period_type,
-			period_start,
-			period_end,
-			requests_count,
-			successful_requests,
-			failed_requests
-		)
-		VALUES ($1, 'daily', $2, $2, 1, $3, $4)
-		ON CONFLICT (partner_id, period_type, period_start)
-		DO UPDATE SET
-			requests_count = quota_usage.requests_count + 1,
-			successful_requests = quota_usage.successful_requests + $3,
-			failed_requests = quota_usage.failed_requests + $4,
-			updated_at = NOW()
-	`
-
-	successCount := 0
-	failCount := 0
-	if success {
-		successCount = 1
-	} else {
-		failCount = 1
-	}
-
-	_, err := db.Exec(ctx, queryDaily,
-		partnerID,
-		now.Format("2006-01-02"),
-		successCount,
-		failCount,
-	)
-
-	if err != nil {
-		log.Println("Failed to update daily quota:", err)
-	}
-
-	// Update monthly quota
-	firstDayOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
-	lastDayOfMonth := firstDayOfMonth.AddDate(0, 1, -1)
-
-	queryMonthly := `
-		INSERT INTO quota_usage (
-			partner_id,
-			period_type,
-			period_start,
-			period_end,
-			requests_count,
-			successful_requests,
-			failed_requests
-		)
-		VALUES ($1, 'monthly', $2, $3, 1, $4, $5)
-		ON CONFLICT (partner_id, period_type, period_start)
-		DO UPDATE SET
-			requests_count = quota_usage.requests_count + 1,
-			successful_requests = quota_usage.successful_requests + $4,
-			failed_requests = quota_usage.failed_requests + $5,
-			updated_at = NOW()
-	`
-
-	_, err = db.Exec(ctx, queryMonthly,
-		partnerID,
-		firstDayOfMonth.Format("2006-01-02"),
-		lastDayOfMonth.Format("2006-01-02"),
-		successCount,
-		failCount,
-	)
-
-	if err != nil {
-		log.Println("Failed to update monthly quota:", err)
+// endpointPattern returns the matched route pattern (/v2/stops/:id/departures)
+// so per-endpoint analytics are not split by path parameters
+// Unmatched requests keep their raw path
+func endpointPattern(c *fiber.Ctx) string {
+	if route := c.Route(); route != nil && route.Path != "" && route.Path != "/" {
+		return route.Path
 	}
+	return c.Path()
 }
 
 // parseLocationFromQuery parses "lat,lon" string into Location
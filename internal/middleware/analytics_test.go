@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocationPoint(t *testing.T) {
+	p := (&Location{Lat: 14.6937, Lon: -17.4441}).point()
+	assert.True(t, p.Valid)
+	assert.Equal(t, -17.4441, p.P.X)
+	assert.Equal(t, 14.6937, p.P.Y)
+
+	var missing *Location
+	assert.False(t, missing.point().Valid)
+}
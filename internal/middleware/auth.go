@@ -4,13 +4,20 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"log/slog"
+	"net/netip"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/passbi/passbi_core/internal/logging"
 )
 
+var logger = logging.For("middleware")
+
 // PartnerContext holds partner information for the request
 type PartnerContext struct {
 	PartnerID   string
@@ -19,144 +26,350 @@ type PartnerContext struct {
 	Scopes      []string
 	Email       string
 	CompanyName string
+	// Sandbox is set for test keys (pk_test_), which get SandboxRateLimits
+	// and are not billed
+	Sandbox bool
+	// ImpersonationID is set when an admin acts on behalf of the partner;
+	// impersonated API requests are sandboxed too
+	ImpersonationID string
+	// Agencies restricts the key to these agencies' data; nil allows all
+	Agencies []string
+	// UserID and Role identify the dashboard user of a session; dashboard
+	// requests made with an API key act as an owner
+	UserID string
+	Role   string
+
+	// HMAC request signing settings of the key (see RequestSigning)
+	signingSecret    string
+	requireSignature bool
+}
+
+// LogValue logs the partner as its ID (see logging)
+func (p *PartnerContext) LogValue() slog.Value {
+	return slog.StringValue(p.PartnerID)
+}
+
+// effectiveMonthLimit selects a partner's monthly quota: the prorated one in
+// the month its tier changed, rate_limit_per_month otherwise
+const effectiveMonthLimit = `CASE WHEN p.prorated_month = date_trunc('month', NOW())::date
+				THEN p.prorated_month_limit ELSE p.rate_limit_per_month END`
+
+// Key environments: test keys are sandbox keys
+const (
+	EnvironmentLive = "live"
+	EnvironmentTest = "test"
+)
+
+// HeaderEnvironment tells clients which environment answered
+const HeaderEnvironment = "X-PassBi-Environment"
+
+// SandboxRateLimits apply to every test key, whatever the partner's tier
+// Sandbox traffic is counted apart from the partner's quotas
+var SandboxRateLimits = map[string]int{
+	"per_second": 25,
+	"burst":      50,
+	"per_day":    20000,
+	"per_month":  0,
 }
 
+// RateLimitKey is the prefix of the partner's rate limit counters in Redis
+// Sandbox keys have their own counters
+func (p *PartnerContext) RateLimitKey() string {
+	if p.Sandbox {
+		return "rl:sandbox:" + p.PartnerID
+	}
+	return "rl:partner:" + p.PartnerID
+}
+
+// ScopeAdmin grants access to the /admin API
+const ScopeAdmin = "admin:*"
+
+// HasScope returns true if the partner's key grants the given scope
+// "*" and admin:* grant everything, and "prefix:*" grants every scope under
+// that prefix
+func (p *PartnerContext) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == "*" || s == ScopeAdmin {
+			return true
+		}
+		if strings.HasSuffix(s, ":*") && strings.HasPrefix(scope, strings.TrimSuffix(s, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticateKey is authenticate, replaced in tests
+var authenticateKey = authenticate
+
 // AuthMiddleware validates API key and loads partner information
 func AuthMiddleware(db *pgxpool.Pool) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Extract API key from Authorization header
-		authHeader := c.Get("Authorization")
-		if authHeader == "" {
-			return c.Status(401).JSON(fiber.Map{
-				"error":   "missing_api_key",
-				"message": "API key is required. Use Authorization: Bearer YOUR_API_KEY",
-				"docs":    "https://docs.passbi.com/authentication",
-			})
+		if ok, err := authenticateKey(c, db); !ok {
+			return err
 		}
+		return serve(c, db)
+	}
+}
 
-		// Format: "Bearer pk_live_..."
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			return c.Status(401).JSON(fiber.Map{
-				"error":   "invalid_auth_format",
-				"message": "Authorization header must be in format: Bearer YOUR_API_KEY",
-				"example": "Authorization: Bearer pk_live_abc123...",
-			})
+// AdminAuth validates the API key and requires a scope of the /admin API
+// (admin:*, or write:alerts for alert management); each route then checks its
+// own scope from AdminScopes. Keys requiring signatures must sign these
+// requests too
+func AdminAuth(db *pgxpool.Pool, rdb *redis.Client) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if ok, err := authenticateKey(c, db); !ok {
+			return err
+		}
+		if ok, err := verifySignature(c, rdb); !ok {
+			return err
 		}
 
-		apiKey := strings.TrimSpace(parts[1])
-
-		// Validate basic format
-		if !strings.HasPrefix(apiKey, "pk_") {
-			return c.Status(401).JSON(fiber.Map{
-				"error":   "invalid_api_key_format",
-				"message": "API key must start with pk_",
+		partner := c.Locals("partner").(*PartnerContext)
+		if partner.ImpersonationID != "" {
+			return c.Status(403).JSON(fiber.Map{
+				"error":   "impersonation_not_allowed",
+				"message": "Impersonation tokens cannot call the admin API",
+			})
+		}
+		if !partner.HasScope(ScopeAdmin) && !partner.HasScope(ScopeWriteAlerts) {
+			return c.Status(403).JSON(fiber.Map{
+				"error":          "insufficient_permissions",
+				"message":        "Admin access required",
+				"required_scope": ScopeAdmin,
 			})
 		}
 
-		// Hash the key for database lookup
-		hash := sha256.Sum256([]byte(apiKey))
-		keyHash := hex.EncodeToString(hash[:])
-
-		// Query database for API key and partner info
-		ctx := context.Background()
-		query := `
-			SELECT
-				ak.id,
-				ak.partner_id,
-				ak.scopes,
-				ak.allowed_ips,
-				p.tier,
-				p.status,
-				p.email,
-				p.company,
-				p.rate_limit_per_second,
-				p.rate_limit_per_day,
-				p.rate_limit_per_month
-			FROM api_key ak
-			JOIN partner p ON p.id = ak.partner_id
-			WHERE ak.key_hash = $1
-				AND ak.is_active = true
-				AND p.status = 'active'
-				AND (ak.expires_at IS NULL OR ak.expires_at > NOW())
-		`
-
-		var (
-			apiKeyID           string
-			partnerID          string
-			scopes             []string
-			allowedIPs         []string
-			tier               string
-			status             string
-			email              string
-			company            string
-			rateLimitPerSecond int
-			rateLimitPerDay    int
-			rateLimitPerMonth  int
-		)
-
-		err := db.QueryRow(ctx, query, keyHash).Scan(
-			&apiKeyID,
-			&partnerID,
-			&scopes,
-			&allowedIPs,
-			&tier,
-			&status,
-			&email,
-			&company,
-			&rateLimitPerSecond,
-			&rateLimitPerDay,
-			&rateLimitPerMonth,
-		)
+		return c.Next()
+	}
+}
+
+// authenticate validates the API key and stores partner context in locals
+// Returns false and the already-written error response when authentication fails
+func authenticate(c *fiber.Ctx, db *pgxpool.Pool) (bool, error) {
+	// Extract API key from Authorization header
+	authHeader := c.Get("Authorization")
+	if authHeader == "" {
+		return false, c.Status(401).JSON(fiber.Map{
+			"error":   "missing_api_key",
+			"message": "API key is required. Use Authorization: Bearer YOUR_API_KEY",
+			"docs":    "https://docs.passbi.com/authentication",
+		})
+	}
+
+	// Format: "Bearer pk_live_..."
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return false, c.Status(401).JSON(fiber.Map{
+			"error":   "invalid_auth_format",
+			"message": "Authorization header must be in format: Bearer YOUR_API_KEY",
+			"example": "Authorization: Bearer pk_live_abc123...",
+		})
+	}
+
+	apiKey := strings.TrimSpace(parts[1])
+
+	ctx := c.UserContext()
 
+	// OAuth access tokens (POST /oauth/token) name their client instead, and
+	// impersonation tokens the partner key an admin acts as
+	var claims *tokenClaims
+	if isJWT(apiKey) {
+		var err error
+		claims, err = parseAccessToken(apiKey)
 		if err != nil {
-			return c.Status(401).JSON(fiber.Map{
-				"error":   "invalid_api_key",
-				"message": "The provided API key is invalid, expired, or has been revoked",
+			if imp, impErr := parseImpersonationToken(apiKey); impErr == nil && imp.ClientID != "" {
+				claims, err = imp, checkImpersonation(ctx, db, imp)
+			}
+		}
+		if err != nil {
+			return false, c.Status(401).JSON(fiber.Map{
+				"error":   "invalid_access_token",
+				"message": "The access token is invalid or has expired. Request a new one at POST /oauth/token",
 			})
 		}
+	} else if !strings.HasPrefix(apiKey, "pk_") {
+		// Validate basic format
+		return false, c.Status(401).JSON(fiber.Map{
+			"error":   "invalid_api_key_format",
+			"message": "API key must start with pk_",
+		})
+	}
+
+	// Hash the key for database lookup
+	hash := sha256.Sum256([]byte(apiKey))
+	lookup := "ak.key_hash = $1 AND ak.kind = 'api_key'"
+	lookupArg := hex.EncodeToString(hash[:])
+	if claims != nil {
+		lookup = "ak.id = $1 AND ak.kind = 'oauth_client'"
+		lookupArg = claims.ClientID
+	}
+	impersonating := claims != nil && claims.Impersonation != ""
+	if impersonating {
+		lookup = "ak.id = $1"
+	}
 
-		// Check IP whitelist if configured
-		if len(allowedIPs) > 0 {
-			clientIP := c.IP()
-			allowed := false
-			for _, allowedIP := range allowedIPs {
-				if clientIP == allowedIP {
-					allowed = true
-					break
+	// Query database for API key and partner info
+	query := `
+		SELECT
+			ak.id,
+			ak.partner_id,
+			ak.scopes,
+			ak.allowed_ips,
+			ak.allowed_agencies,
+			COALESCE(ak.signing_secret, ''),
+			ak.require_signature,
+			ak.environment,
+			ak.suspended_at IS NOT NULL,
+			p.tier,
+			p.status,
+			p.email,
+			p.company,
+			p.rate_limit_per_second,
+			p.rate_limit_per_day,
+			` + effectiveMonthLimit + `,
+			p.rate_limit_burst,
+			COALESCE(tc.endpoint_weights, '{}'::jsonb)
+		FROM api_key ak
+		JOIN partner p ON p.id = ak.partner_id
+		LEFT JOIN tier_config tc ON tc.tier = p.tier
+		WHERE ` + lookup + `
+			AND ak.is_active = true
+			AND p.status = 'active'
+			AND (ak.expires_at IS NULL OR ak.expires_at > NOW())
+	`
+
+	var (
+		apiKeyID           string
+		partnerID          string
+		scopes             []string
+		allowedIPs         []netip.Prefix
+		allowedAgencies    []string
+		signingSecret      string
+		requireSignature   bool
+		environment        string
+		suspended          bool
+		tier               string
+		status             string
+		email              string
+		company            string
+		rateLimitPerSecond int
+		rateLimitPerDay    int
+		rateLimitPerMonth  int
+		rateLimitBurst     int
+		endpointWeights    map[string]int
+	)
+
+	err := db.QueryRow(ctx, query, lookupArg).Scan(
+		&apiKeyID,
+		&partnerID,
+		&scopes,
+		&allowedIPs,
+		&allowedAgencies,
+		&signingSecret,
+		&requireSignature,
+		&environment,
+		&suspended,
+		&tier,
+		&status,
+		&email,
+		&company,
+		&rateLimitPerSecond,
+		&rateLimitPerDay,
+		&rateLimitPerMonth,
+		&rateLimitBurst,
+		&endpointWeights,
+	)
+
+	if err == nil && claims != nil {
+		if partnerID != claims.Subject {
+			err = errInvalidToken
+		}
+		// A token keeps only the scopes its client still grants
+		if !impersonating {
+			client := &PartnerContext{Scopes: scopes}
+			scopes = nil
+			for _, scope := range strings.Fields(claims.Scope) {
+				if client.HasScope(scope) {
+					scopes = append(scopes, scope)
 				}
 			}
-			if !allowed {
-				return c.Status(403).JSON(fiber.Map{
-					"error":   "ip_not_allowed",
-					"message": "Your IP address is not authorized to use this API key",
-					"ip":      clientIP,
-				})
-			}
 		}
+	}
 
-		// Update last_used_at asynchronously (non-blocking)
-		go updateLastUsed(db, apiKeyID)
-
-		// Store partner context in locals
-		c.Locals("partner", &PartnerContext{
-			PartnerID:   partnerID,
-			APIKeyID:    apiKeyID,
-			Tier:        tier,
-			Scopes:      scopes,
-			Email:       email,
-			CompanyName: company,
+	if err != nil {
+		return false, c.Status(401).JSON(fiber.Map{
+			"error":   "invalid_api_key",
+			"message": "The provided API key is invalid, expired, or has been revoked",
 		})
+	}
 
-		// Store rate limits in locals for rate limiting middleware
-		c.Locals("rate_limits", map[string]int{
-			"per_second": rateLimitPerSecond,
-			"per_day":    rateLimitPerDay,
-			"per_month":  rateLimitPerMonth,
+	// Keys suspended for abnormal usage wait for an admin's review
+	// Admins impersonating the partner may still reproduce its requests
+	if suspended && !impersonating {
+		return false, c.Status(403).JSON(fiber.Map{
+			"error":   "api_key_suspended",
+			"message": "This API key was suspended after unusual activity and is pending review; contact PassBi support",
 		})
+	}
 
-		return c.Next()
+	// Check IP whitelist if configured (addresses or CIDR ranges)
+	// Admins impersonating the partner call from their own network
+	if len(allowedIPs) > 0 && !impersonating {
+		clientIP := ClientIP(c)
+		if !prefixesContain(allowedIPs, clientIP) {
+			return false, c.Status(403).JSON(fiber.Map{
+				"error":   "ip_not_allowed",
+				"message": "Your IP address is not authorized to use this API key",
+				"ip":      clientIP.String(),
+			})
+		}
+	}
+
+	// Store partner context in locals
+	partner := &PartnerContext{
+		PartnerID:        partnerID,
+		APIKeyID:         apiKeyID,
+		Tier:             tier,
+		Scopes:           scopes,
+		Email:            email,
+		CompanyName:      company,
+		Sandbox:          environment == EnvironmentTest,
+		Agencies:         allowedAgencies,
+		signingSecret:    signingSecret,
+		requireSignature: requireSignature,
 	}
+	if impersonating {
+		// Admins reproduce errors without signing or using the partner's quotas
+		partner.ImpersonationID = claims.Impersonation
+		partner.Sandbox = true
+		partner.signingSecret = ""
+		partner.requireSignature = false
+	} else {
+		// Update last_used_at asynchronously (non-blocking)
+		go updateLastUsed(db, apiKeyID)
+	}
+	c.Locals("partner", partner)
+
+	// Sandbox keys share generous fixed limits and every endpoint costs 1
+	if partner.Sandbox {
+		if environment == EnvironmentTest {
+			c.Set(HeaderEnvironment, EnvironmentTest)
+		}
+		c.Locals("rate_limits", SandboxRateLimits)
+		return true, nil
+	}
+
+	// Store rate limits in locals for rate limiting middleware
+	c.Locals("rate_limits", map[string]int{
+		"per_second": rateLimitPerSecond,
+		"per_day":    rateLimitPerDay,
+		"per_month":  rateLimitPerMonth,
+		"burst":      rateLimitBurst,
+	})
+	c.Locals("endpoint_weights", endpointWeights)
+
+	return true, nil
 }
 
 // updateLastUsed updates the last_used_at timestamp for an API key
@@ -193,15 +406,7 @@ func RequireScope(scope string) fiber.Handler {
 		}
 
 		// Check if partner has the required scope
-		hasScope := false
-		for _, s := range partner.Scopes {
-			if s == scope || s == "*" {
-				hasScope = true
-				break
-			}
-		}
-
-		if !hasScope {
+		if !partner.HasScope(scope) {
 			return c.Status(403).JSON(fiber.Map{
 				"error":   "insufficient_permissions",
 				"message": "Your API key does not have the required permissions",
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HeaderForwardedFor lists the client and the proxies a request went through
+const HeaderForwardedFor = "X-Forwarded-For"
+
+var (
+	trustedProxies     []netip.Prefix
+	trustedProxiesOnce sync.Once
+)
+
+// loadTrustedProxies reads TRUSTED_PROXIES, the comma-separated addresses or
+// CIDR ranges of the load balancers in front of the API
+// X-Forwarded-For is ignored unless the request comes from one of them
+func loadTrustedProxies() []netip.Prefix {
+	trustedProxiesOnce.Do(func() {
+		value := os.Getenv("TRUSTED_PROXIES")
+		if value == "" {
+			return
+		}
+		prefixes, err := ParsePrefixes(strings.Split(value, ","))
+		if err != nil {
+			logger.Warn("Invalid TRUSTED_PROXIES; ignoring X-Forwarded-For", "error", err)
+			return
+		}
+		trustedProxies = prefixes
+	})
+	return trustedProxies
+}
+
+// ClientIP returns the address of the client that sent the request
+// Behind trusted proxies it is the last X-Forwarded-For hop not added by one
+// of them, since entries to its left can be forged by the client
+func ClientIP(c *fiber.Ctx) netip.Addr {
+	peer, _ := netip.AddrFromSlice(c.Context().RemoteIP())
+
+	var forwardedFor []string
+	for _, header := range c.Request().Header.PeekAll(HeaderForwardedFor) {
+		forwardedFor = append(forwardedFor, strings.Split(string(header), ",")...)
+	}
+	return clientIPFrom(peer.Unmap(), forwardedFor, loadTrustedProxies())
+}
+
+// clientIPFrom walks X-Forwarded-For from the nearest hop while it was
+// appended by a trusted proxy
+func clientIPFrom(peer netip.Addr, forwardedFor []string, trusted []netip.Prefix) netip.Addr {
+	client := peer
+	for i := len(forwardedFor) - 1; i >= 0; i-- {
+		if !prefixesContain(trusted, client) {
+			return client
+		}
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwardedFor[i]))
+		if err != nil {
+			return client
+		}
+		client = hop.Unmap()
+	}
+	return client
+}
+
+// ParsePrefixes parses addresses ("203.0.113.7", "2001:db8::1") and CIDR
+// ranges ("203.0.113.0/24", "2001:db8::/32"); an address is a single-host range
+func ParsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		if strings.Contains(value, "/") {
+			prefix, err := netip.ParsePrefix(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR range %q", value)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address %q", value)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// prefixesContain reports whether addr is in one of the ranges
+// IPv4-mapped IPv6 addresses (::ffff:203.0.113.7) match IPv4 ranges
+func prefixesContain(prefixes []netip.Prefix, addr netip.Addr) bool {
+	if !addr.IsValid() {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if p.Masked().Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
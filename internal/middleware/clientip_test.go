@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes([]string{"203.0.113.7", " 198.51.100.0/24 ", "2001:db8::/32", "::ffff:192.0.2.1", "10.1.2.3/8", ""})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("203.0.113.7/32"),
+		netip.MustParsePrefix("198.51.100.0/24"),
+		netip.MustParsePrefix("2001:db8::/32"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("10.0.0.0/8"),
+	}, prefixes)
+
+	_, err = ParsePrefixes([]string{"203.0.113.300"})
+	assert.Error(t, err)
+	_, err = ParsePrefixes([]string{"198.51.100.0/33"})
+	assert.Error(t, err)
+}
+
+func TestPrefixesContain(t *testing.T) {
+	allowed, _ := ParsePrefixes([]string{"198.51.100.0/24", "2001:db8:1::/48", "203.0.113.7"})
+
+	assert.True(t, prefixesContain(allowed, netip.MustParseAddr("198.51.100.42")))
+	assert.True(t, prefixesContain(allowed, netip.MustParseAddr("::ffff:198.51.100.42")))
+	assert.True(t, prefixesContain(allowed, netip.MustParseAddr("2001:db8:1:ff::9")))
+	assert.True(t, prefixesContain(allowed, netip.MustParseAddr("203.0.113.7")))
+	assert.False(t, prefixesContain(allowed, netip.MustParseAddr("203.0.113.8")))
+	assert.False(t, prefixesContain(allowed, netip.MustParseAddr("2001:db8:2::1")))
+	assert.False(t, prefixesContain(allowed, netip.Addr{}))
+}
+
+func TestClientIPFrom(t *testing.T) {
+	trusted, _ := ParsePrefixes([]string{"10.0.0.0/8", "fd00::/8"})
+	lb := netip.MustParseAddr("10.0.0.5")
+
+	// Not behind a trusted proxy: the header is the client's word, ignored
+	assert.Equal(t, "198.51.100.9",
+		clientIPFrom(netip.MustParseAddr("198.51.100.9"), []string{"203.0.113.7"}, trusted).String())
+
+	// The nearest untrusted hop is the client; the forged entry on its left is not
+	assert.Equal(t, "203.0.113.7",
+		clientIPFrom(lb, []string{"1.2.3.4", " 203.0.113.7", "10.0.0.9"}, trusted).String())
+
+	assert.Equal(t, "2001:db8::7",
+		clientIPFrom(netip.MustParseAddr("fd00::1"), []string{"2001:db8::7"}, trusted).String())
+
+	// Without a header, or with garbage in it, the last known hop is used
+	assert.Equal(t, "10.0.0.5", clientIPFrom(lb, nil, trusted).String())
+	assert.Equal(t, "10.0.0.9", clientIPFrom(lb, []string{"unknown", "10.0.0.9"}, trusted).String())
+
+	// No trusted proxies configured: always the peer
+	assert.Equal(t, "10.0.0.5", clientIPFrom(lb, []string{"203.0.113.7"}, nil).String())
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DeprecationConfig describes a superseded API version
+type DeprecationConfig struct {
+	DeprecatedAt time.Time // Deprecation header (RFC 9745)
+	Sunset       time.Time // Sunset header (RFC 8594); zero omits it
+	Successor    string    // Link target advertised as rel="successor-version"
+}
+
+// Default v2 lifecycle; API_V2_DEPRECATED_AT and API_V2_SUNSET (YYYY-MM-DD) override it
+const (
+	defaultV2DeprecatedAt = "2026-10-16"
+	defaultV2Sunset       = "2027-06-30"
+)
+
+// V2Deprecation returns the deprecation schedule of the /v2 API
+func V2Deprecation() DeprecationConfig {
+	return DeprecationConfig{
+		DeprecatedAt: envDate("API_V2_DEPRECATED_AT", defaultV2DeprecatedAt),
+		Sunset:       envDate("API_V2_SUNSET", defaultV2Sunset),
+		Successor:    "/v3",
+	}
+}
+
+// Deprecation marks every response as coming from a deprecated API version
+// Headers are set before the handler runs so error responses carry them too
+func Deprecation(cfg DeprecationConfig) fiber.Handler {
+	deprecation := "@" + strconv.FormatInt(cfg.DeprecatedAt.Unix(), 10)
+	sunset := ""
+	if !cfg.Sunset.IsZero() {
+		sunset = cfg.Sunset.UTC().Format(http.TimeFormat)
+	}
+	link := ""
+	if cfg.Successor != "" {
+		link = "<" + cfg.Successor + `>; rel="successor-version"`
+	}
+
+	return func(c *fiber.Ctx) error {
+		c.Set("Deprecation", deprecation)
+		if sunset != "" {
+			c.Set("Sunset", sunset)
+		}
+		if link != "" {
+			c.Append(fiber.HeaderLink, link)
+		}
+		return c.Next()
+	}
+}
+
+// envDate parses a YYYY-MM-DD environment variable, falling back to def
+func envDate(key, def string) time.Time {
+	value := os.Getenv(key)
+	if value == "" {
+		value = def
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		logger.Warn("Invalid date, using the default", "env", key, "value", value, "default", def)
+		t, _ = time.Parse("2006-01-02", def)
+	}
+	return t
+}
@@ -0,0 +1,198 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// HeaderIdempotencyKey lets clients retry a POST without repeating its effect
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// HeaderIdempotentReplayed marks a response replayed from an earlier request
+const HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+const (
+	maxIdempotencyKeyLength = 255
+	idempotencyTTL          = 24 * time.Hour
+	// idempotencyLockTTL bounds how long a crashed request blocks its key
+	idempotencyLockTTL = time.Minute
+	// idempotentReplayLocal holds the body a handler wants stored for replay
+	idempotentReplayLocal = "idempotent_replay"
+)
+
+// idempotencyRecord is stored in Redis under the key while the first request
+// runs (Status 0) and, once it has finished, holds its response for replay
+type idempotencyRecord struct {
+	Fingerprint string `json:"fingerprint"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// Idempotency replays the stored response when a partner repeats a request
+// with the same Idempotency-Key, so retries over flaky networks do not
+// create a resource twice. Requests without the header are untouched
+// Keys are scoped to the partner and route; reusing one with a different
+// body is rejected. 5xx responses are not stored so the client can retry
+func Idempotency(rdb *redis.Client) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(HeaderIdempotencyKey)
+		if key == "" {
+			return c.Next()
+		}
+		if !validIdempotencyKey(key) {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "invalid_idempotency_key",
+				"message": fmt.Sprintf("Idempotency-Key must be 1-%d printable characters", maxIdempotencyKeyLength),
+			})
+		}
+
+		partner, ok := c.Locals("partner").(*PartnerContext)
+		if !ok {
+			return c.Next()
+		}
+
+		ctx := c.UserContext()
+		redisKey := idempotencyRedisKey(partner.PartnerID, c.Method(), endpointPattern(c), key)
+		fingerprint := requestFingerprint(c.Body())
+
+		pending, _ := json.Marshal(idempotencyRecord{Fingerprint: fingerprint})
+		acquired, err := rdb.SetNX(ctx, redisKey, pending, idempotencyLockTTL).Result()
+		if err != nil {
+			// Without Redis the request still runs, just without protection
+			logger.ErrorContext(ctx, "Idempotency check failed", "error", err)
+			return c.Next()
+		}
+
+		if !acquired {
+			return replayIdempotent(c, rdb, redisKey, fingerprint)
+		}
+
+		// The handler has run: record its outcome even if the client went away
+		// meanwhile, or the key stays locked until idempotencyLockTTL
+		err = c.Next()
+		ctx = context.WithoutCancel(ctx)
+		if err != nil {
+			rdb.Del(ctx, redisKey)
+			return err
+		}
+
+		status := c.Response().StatusCode()
+		if status >= 500 {
+			rdb.Del(ctx, redisKey)
+			return nil
+		}
+
+		done, _ := json.Marshal(completedRecord(c, fingerprint))
+		if err := rdb.Set(ctx, redisKey, done, idempotencyTTL).Err(); err != nil {
+			logger.ErrorContext(ctx, "Failed to store idempotent response", "error", err)
+		}
+		return nil
+	}
+}
+
+// SetIdempotentReplay makes Idempotency store body, encoded as JSON, for
+// replay instead of the response actually sent. Handlers whose response
+// carries a secret shown only once use it so the secret never lands in Redis
+func SetIdempotentReplay(c *fiber.Ctx, body interface{}) {
+	c.Locals(idempotentReplayLocal, body)
+}
+
+// completedRecord is the replay record of a request the handler has answered
+func completedRecord(c *fiber.Ctx, fingerprint string) idempotencyRecord {
+	record := idempotencyRecord{
+		Fingerprint: fingerprint,
+		Status:      c.Response().StatusCode(),
+		ContentType: string(c.Response().Header.ContentType()),
+		Body:        c.Response().Body(),
+	}
+	if replay := c.Locals(idempotentReplayLocal); replay != nil {
+		body, err := json.Marshal(replay)
+		if err != nil {
+			body = []byte("{}")
+		}
+		record.ContentType = fiber.MIMEApplicationJSON
+		record.Body = body
+	}
+	return record
+}
+
+// replayIdempotent answers a request whose key has already been used
+func replayIdempotent(c *fiber.Ctx, rdb *redis.Client, redisKey, fingerprint string) error {
+	data, err := rdb.Get(c.UserContext(), redisKey).Bytes()
+	if err == redis.Nil {
+		// The first request just failed and released the key
+		return c.Status(409).JSON(fiber.Map{
+			"error":   "idempotency_conflict",
+			"message": "A request with this Idempotency-Key just finished; retry it",
+		})
+	}
+	if err != nil {
+		logger.ErrorContext(c.UserContext(), "Failed to read idempotent response", "error", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to check Idempotency-Key",
+		})
+	}
+
+	var record idempotencyRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "internal_server_error",
+			"message": "Failed to check Idempotency-Key",
+		})
+	}
+
+	if record.Fingerprint != fingerprint {
+		return c.Status(422).JSON(fiber.Map{
+			"error":   "idempotency_key_reused",
+			"message": "Idempotency-Key was already used with a different request body",
+		})
+	}
+	if record.Status == 0 {
+		c.Set(fiber.HeaderRetryAfter, "1")
+		return c.Status(409).JSON(fiber.Map{
+			"error":   "idempotency_in_progress",
+			"message": "A request with this Idempotency-Key is still being processed",
+		})
+	}
+
+	c.Set(HeaderIdempotentReplayed, "true")
+	if record.ContentType != "" {
+		c.Set(fiber.HeaderContentType, record.ContentType)
+	}
+	return c.Status(record.Status).Send(record.Body)
+}
+
+// validIdempotencyKey accepts printable ASCII keys such as UUIDs
+func validIdempotencyKey(key string) bool {
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < ' ' || key[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// idempotencyRedisKey scopes a client key to the partner and route, hashed so
+// arbitrary client input never lands in Redis key names
+func idempotencyRedisKey(partnerID, method, endpoint, key string) string {
+	hash := sha256.Sum256([]byte(method + " " + endpoint + "\n" + key))
+	return fmt.Sprintf("idem:%s:%x", partnerID, hash[:16])
+}
+
+// requestFingerprint identifies the request body a key was first used with
+func requestFingerprint(body []byte) string {
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:])
+}
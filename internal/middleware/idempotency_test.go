@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidIdempotencyKey(t *testing.T) {
+	assert.True(t, validIdempotencyKey("3f1c2a9e-5b7d-4c1e-9a2b-8d7e6f5a4b3c"))
+	assert.True(t, validIdempotencyKey("retry key 1"))
+	assert.False(t, validIdempotencyKey(""))
+	assert.False(t, validIdempotencyKey("tab\there"))
+	assert.False(t, validIdempotencyKey(strings.Repeat("k", maxIdempotencyKeyLength+1)))
+}
+
+func TestIdempotencyRedisKey(t *testing.T) {
+	key := idempotencyRedisKey("p1", "POST", "/admin/alerts", "abc")
+	assert.True(t, strings.HasPrefix(key, "idem:p1:"))
+	assert.Equal(t, key, idempotencyRedisKey("p1", "POST", "/admin/alerts", "abc"))
+	assert.NotEqual(t, key, idempotencyRedisKey("p2", "POST", "/admin/alerts", "abc"))
+	assert.NotEqual(t, key, idempotencyRedisKey("p1", "POST", "/dashboard/api-keys", "abc"))
+}
+
+func TestIdempotencyRejectsInvalidKey(t *testing.T) {
+	app := fiber.New()
+	// Redis is never reached for requests without a usable key
+	app.Post("/alerts", Idempotency(nil), func(c *fiber.Ctx) error {
+		return c.Status(201).SendString("created")
+	})
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/alerts", nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 201, resp.StatusCode)
+
+	req := httptest.NewRequest("POST", "/alerts", nil)
+	req.Header.Set(HeaderIdempotencyKey, "bad\x01key")
+	resp, err = app.Test(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestIdempotencyRecordUsesReplayBody(t *testing.T) {
+	var records []idempotencyRecord
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		err := c.Next()
+		records = append(records, completedRecord(c, "fp"))
+		return err
+	})
+	app.Post("/plain", func(c *fiber.Ctx) error {
+		return c.Status(201).JSON(fiber.Map{"id": "a1"})
+	})
+	app.Post("/secret", func(c *fiber.Ctx) error {
+		SetIdempotentReplay(c, fiber.Map{"id": "k1"})
+		return c.Status(201).JSON(fiber.Map{"id": "k1", "api_key": "pk_live_secret"})
+	})
+
+	for _, path := range []string{"/plain", "/secret"} {
+		resp, err := app.Test(httptest.NewRequest("POST", path, nil))
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, 201, resp.StatusCode)
+	}
+	if !assert.Len(t, records, 2) {
+		return
+	}
+
+	assert.Equal(t, 201, records[0].Status)
+	assert.JSONEq(t, `{"id":"a1"}`, string(records[0].Body))
+
+	// The client got the key, but the stored replay never contains it
+	assert.Equal(t, 201, records[1].Status)
+	assert.Equal(t, fiber.MIMEApplicationJSON, records[1].ContentType)
+	assert.JSONEq(t, `{"id":"k1"}`, string(records[1].Body))
+	assert.NotContains(t, string(records[1].Body), "pk_live_secret")
+}
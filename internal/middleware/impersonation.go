@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Impersonation tokens let an admin act on behalf of a partner, to see its
+// dashboard or reproduce its errors with one of its keys
+// They are signed with the dashboard session secret under their own audience
+const (
+	impersonationAudience = "impersonation"
+	ImpersonationTTL      = 30 * time.Minute
+)
+
+// HeaderImpersonation is set on every response to an impersonated request
+// with the impersonation ID
+const HeaderImpersonation = "X-PassBi-Impersonation"
+
+var errImpersonationEnded = errors.New("impersonation has ended")
+
+// IssueImpersonationToken signs a token acting as a partner until expiresAt
+// apiKeyID names the key used on /v2 and /v3; without it the token only
+// opens the dashboard
+func IssueImpersonationToken(partnerID, apiKeyID, impersonationID string, now, expiresAt time.Time) (string, error) {
+	loadSessionConfig()
+
+	return signToken(sessionSecret, tokenClaims{
+		Subject:       partnerID,
+		Audience:      impersonationAudience,
+		IssuedAt:      now.Unix(),
+		Expires:       expiresAt.Unix(),
+		ClientID:      apiKeyID,
+		Impersonation: impersonationID,
+	})
+}
+
+// parseImpersonationToken verifies an impersonation token and returns its claims
+func parseImpersonationToken(token string) (*tokenClaims, error) {
+	loadSessionConfig()
+
+	claims, err := parseToken(sessionSecret, token, impersonationAudience, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if claims.Impersonation == "" {
+		return nil, errInvalidToken
+	}
+	return claims, nil
+}
+
+// checkImpersonation rejects tokens of an impersonation an admin has ended
+func checkImpersonation(ctx context.Context, db *pgxpool.Pool, claims *tokenClaims) error {
+	var active bool
+	err := db.QueryRow(ctx, `
+		SELECT ended_at IS NULL AND expires_at > NOW()
+		FROM impersonation
+		WHERE id = $1 AND partner_id = $2
+	`, claims.Impersonation, claims.Subject).Scan(&active)
+	if err != nil {
+		return err
+	}
+	if !active {
+		return errImpersonationEnded
+	}
+	return nil
+}
+
+// serve runs the rest of the chain; requests made while impersonating are
+// recorded in impersonation_audit with their final status
+func serve(c *fiber.Ctx, db *pgxpool.Pool) error {
+	partner := c.Locals("partner").(*PartnerContext)
+	if partner.ImpersonationID == "" {
+		return c.Next()
+	}
+
+	c.Set(HeaderImpersonation, partner.ImpersonationID)
+	err := c.Next()
+
+	status := c.Response().StatusCode()
+	if err != nil {
+		status = fiber.StatusInternalServerError
+		if e, ok := err.(*fiber.Error); ok {
+			status = e.Code
+		}
+	}
+	go recordImpersonatedRequest(db, partner.ImpersonationID, c.Method(), c.OriginalURL(), status,
+		GetRequestID(c), ClientIP(c).String())
+	return err
+}
+
+// recordImpersonatedRequest adds one request to the audit trail
+func recordImpersonatedRequest(db *pgxpool.Pool, impersonationID, method, path string, status int, requestID, ip string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := db.Exec(ctx, `
+		INSERT INTO impersonation_audit (impersonation_id, method, path, status, request_id, ip_address)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, '')::inet)
+	`, impersonationID, method, path, status, requestID, ip)
+	if err != nil {
+		logger.Error("Failed to record impersonated request", "impersonation_id", impersonationID, "method", method, "path", path, "error", err)
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImpersonationToken(t *testing.T) {
+	now := time.Now()
+
+	token, err := IssueImpersonationToken("partner-1", "key-1", "imp-1", now, now.Add(ImpersonationTTL))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	claims, err := parseImpersonationToken(token)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "partner-1", claims.Subject)
+		assert.Equal(t, "key-1", claims.ClientID)
+		assert.Equal(t, "imp-1", claims.Impersonation)
+	}
+
+	// Not a dashboard session, though signed with the same secret
+	_, err = parseToken(sessionSecret, token, sessionAudience, now)
+	assert.ErrorIs(t, err, errInvalidToken)
+
+	// A dashboard session is not an impersonation token
+	session, _, err := IssueSession("partner-1", "user-1", now)
+	if assert.NoError(t, err) {
+		_, err = parseImpersonationToken(session)
+		assert.ErrorIs(t, err, errInvalidToken)
+	}
+
+	expired, _ := IssueImpersonationToken("partner-1", "", "imp-1", now.Add(-time.Hour), now.Add(-time.Minute))
+	_, err = parseImpersonationToken(expired)
+	assert.ErrorIs(t, err, errTokenExpired)
+}
@@ -3,16 +3,42 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/redis/go-redis/v9"
 )
 
+// RateLimitStatusPath is the endpoint reporting a key's usage (/v2/limits)
+// Polling it does not count against the limits it reports
+const RateLimitStatusPath = "/limits"
+
+// QuotaThresholds are the percentages of the daily and monthly quotas
+// partners can be notified at
+var QuotaThresholds = []int{80, 100}
+
+// QuotaCrossing is a request taking a daily or monthly quota past one of
+// QuotaThresholds
+type QuotaCrossing struct {
+	Window    string    `json:"window"` // day or month
+	Threshold int       `json:"threshold"`
+	Used      int64     `json:"used"`
+	Limit     int64     `json:"limit"`
+	ResetAt   time.Time `json:"reset_at"`
+}
+
+// QuotaObserver is told when a request crosses a quota threshold
+// Each crossing is reported once, by the request that caused it; the
+// observer must not block the request
+type QuotaObserver func(partner *PartnerContext, crossing QuotaCrossing)
+
 // RateLimitMiddleware implements multi-level rate limiting
-// It checks limits per second, per day, and per month
-func RateLimitMiddleware(rdb *redis.Client) fiber.Handler {
+// It checks limits per second, per day, and per month, and reports quota
+// threshold crossings to onQuota when it is not nil
+func RateLimitMiddleware(rdb *redis.Client, onQuota QuotaObserver) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get partner context from auth middleware
 		partner, ok := c.Locals("partner").(*PartnerContext)
@@ -21,6 +47,10 @@ func RateLimitMiddleware(rdb *redis.Client) fiber.Handler {
 			return c.Next()
 		}
 
+		if strings.HasSuffix(c.Path(), RateLimitStatusPath) {
+			return c.Next()
+		}
+
 		// Get rate limits from context
 		rateLimits, ok := c.Locals("rate_limits").(map[string]int)
 		if !ok {
@@ -32,144 +62,345 @@ func RateLimitMiddleware(rdb *redis.Client) fiber.Handler {
 			}
 		}
 
-		ctx := context.Background()
+		ctx := c.UserContext()
 		now := time.Now()
 
-		// Generate Redis keys for different time periods
-		keySecond := fmt.Sprintf("rl:partner:%s:second:%d", partner.PartnerID, now.Unix())
-		keyDay := fmt.Sprintf("rl:partner:%s:day:%s", partner.PartnerID, now.Format("2006-01-02"))
-		keyMonth := fmt.Sprintf("rl:partner:%s:month:%s", partner.PartnerID, now.Format("2006-01"))
-
-		// Check per-second rate limit
-		if rateLimits["per_second"] > 0 {
-			countSecond, err := rdb.Incr(ctx, keySecond).Result()
-			if err == nil {
-				// Set expiration for per-second counter
-				rdb.Expire(ctx, keySecond, 2*time.Second)
-
-				if countSecond > int64(rateLimits["per_second"]) {
-					// Add rate limit headers
-					c.Set("X-RateLimit-Limit-Second", strconv.Itoa(rateLimits["per_second"]))
-					c.Set("X-RateLimit-Remaining-Second", "0")
-					c.Set("X-RateLimit-Reset-Second", strconv.FormatInt(now.Unix()+1, 10))
-					c.Set("Retry-After", "1")
-
-					return c.Status(429).JSON(fiber.Map{
-						"error":       "rate_limit_exceeded",
-						"message":     "Too many requests per second",
-						"limit_type":  "per_second",
-						"limit":       rateLimits["per_second"],
-						"retry_after": 1,
-					})
+		// Generate Redis keys: a token bucket for bursts, fixed windows for quotas
+		keyBucket, keyDay, keyMonth := rateLimitKeys(partner.RateLimitKey(), now)
+
+		// Expensive endpoints cost more of the daily and monthly quotas
+		weights, _ := c.Locals("endpoint_weights").(map[string]int)
+		weight := EndpointWeight(weights, c.Method(), c.Path())
+		c.Set("X-RateLimit-Cost", strconv.Itoa(weight))
+
+		// Take a token and count the request in the quotas with a single round-trip
+		burst := bucketCapacity(rateLimits["per_second"], rateLimits["burst"])
+		result, err := consumeRateLimits(ctx, rdb,
+			[]string{keyBucket, keyDay, keyMonth},
+			rateLimits["per_second"], burst, rateLimits["per_day"], rateLimits["per_month"],
+			weight, now)
+		countDay, countMonth := result.Day, result.Month
+
+		// Sandbox traffic is not part of the paid quotas
+		if onQuota != nil && err == nil && !partner.Sandbox {
+			_, resetDay, resetMonth := rateLimitResets(now)
+			crossings := append(
+				quotaCrossings("day", countDay, int64(weight), int64(rateLimits["per_day"]), resetDay),
+				quotaCrossings("month", countMonth, int64(weight), int64(rateLimits["per_month"]), resetMonth)...)
+			for _, crossing := range crossings {
+				onQuota(partner, crossing)
+			}
+		}
+
+		// Check per-second rate limit (token bucket)
+		if rateLimits["per_second"] > 0 && err == nil {
+			if result.Remaining < 0 {
+				retryAfter := int64(math.Ceil(result.RetryAfter.Seconds()))
+				if retryAfter < 1 {
+					retryAfter = 1
 				}
+
+				// Add rate limit headers
+				c.Set("X-RateLimit-Limit-Second", strconv.Itoa(rateLimits["per_second"]))
+				c.Set("X-RateLimit-Burst", strconv.Itoa(burst))
+				c.Set("X-RateLimit-Remaining-Second", "0")
+				c.Set("X-RateLimit-Reset-Second", strconv.FormatInt(now.Add(result.RetryAfter).Unix(), 10))
+				c.Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+
+				return c.Status(429).JSON(fiber.Map{
+					"error":       "rate_limit_exceeded",
+					"message":     "Too many requests per second",
+					"limit_type":  "per_second",
+					"limit":       rateLimits["per_second"],
+					"burst":       burst,
+					"retry_after": retryAfter,
+				})
 			}
+
+			c.Set("X-RateLimit-Remaining-Second", strconv.FormatInt(result.Remaining, 10))
 		}
 
 		// Check per-day rate limit
-		if rateLimits["per_day"] > 0 {
-			countDay, err := rdb.Incr(ctx, keyDay).Result()
-			if err == nil {
-				// Set expiration for per-day counter
-				rdb.Expire(ctx, keyDay, 25*time.Hour) // 25 hours to handle timezone differences
-
-				if countDay > int64(rateLimits["per_day"]) {
-					// Calculate seconds until midnight
-					tomorrow := now.AddDate(0, 0, 1)
-					midnight := time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 0, 0, 0, 0, tomorrow.Location())
-					retryAfter := int64(midnight.Sub(now).Seconds())
-
-					c.Set("X-RateLimit-Limit-Day", strconv.Itoa(rateLimits["per_day"]))
-					c.Set("X-RateLimit-Remaining-Day", "0")
-					c.Set("X-RateLimit-Reset-Day", strconv.FormatInt(midnight.Unix(), 10))
-					c.Set("Retry-After", strconv.FormatInt(retryAfter, 10))
-
-					return c.Status(429).JSON(fiber.Map{
-						"error":       "daily_quota_exceeded",
-						"message":     "Daily quota exceeded",
-						"limit_type":  "per_day",
-						"limit":       rateLimits["per_day"],
-						"used":        countDay,
-						"retry_after": retryAfter,
-						"reset_at":    midnight.Format(time.RFC3339),
-					})
-				}
+		if rateLimits["per_day"] > 0 && err == nil {
+			if countDay > int64(rateLimits["per_day"]) {
+				// Calculate seconds until midnight
+				tomorrow := now.AddDate(0, 0, 1)
+				midnight := time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 0, 0, 0, 0, tomorrow.Location())
+				retryAfter := int64(midnight.Sub(now).Seconds())
+
+				c.Set("X-RateLimit-Limit-Day", strconv.Itoa(rateLimits["per_day"]))
+				c.Set("X-RateLimit-Remaining-Day", "0")
+				c.Set("X-RateLimit-Reset-Day", strconv.FormatInt(midnight.Unix(), 10))
+				c.Set("Retry-After", strconv.FormatInt(retryAfter, 10))
 
-				// Set remaining count header
-				c.Set("X-RateLimit-Remaining-Day", strconv.FormatInt(int64(rateLimits["per_day"])-countDay, 10))
+				return c.Status(429).JSON(fiber.Map{
+					"error":       "daily_quota_exceeded",
+					"message":     "Daily quota exceeded",
+					"limit_type":  "per_day",
+					"limit":       rateLimits["per_day"],
+					"used":        countDay,
+					"retry_after": retryAfter,
+					"reset_at":    midnight.Format(time.RFC3339),
+				})
 			}
+
+			// Set remaining count header
+			c.Set("X-RateLimit-Remaining-Day", strconv.FormatInt(int64(rateLimits["per_day"])-countDay, 10))
 		}
 
 		// Check per-month rate limit
-		if rateLimits["per_month"] > 0 {
-			countMonth, err := rdb.Incr(ctx, keyMonth).Result()
-			if err == nil {
-				// Set expiration for per-month counter
-				rdb.Expire(ctx, keyMonth, 32*24*time.Hour) // 32 days
-
-				if countMonth > int64(rateLimits["per_month"]) {
-					// Calculate seconds until next month
-					firstDayNextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location())
-					retryAfter := int64(firstDayNextMonth.Sub(now).Seconds())
-
-					c.Set("X-RateLimit-Limit-Month", strconv.Itoa(rateLimits["per_month"]))
-					c.Set("X-RateLimit-Remaining-Month", "0")
-					c.Set("X-RateLimit-Reset-Month", strconv.FormatInt(firstDayNextMonth.Unix(), 10))
-					c.Set("Retry-After", strconv.FormatInt(retryAfter, 10))
-
-					return c.Status(429).JSON(fiber.Map{
-						"error":       "monthly_quota_exceeded",
-						"message":     "Monthly quota exceeded",
-						"limit_type":  "per_month",
-						"limit":       rateLimits["per_month"],
-						"used":        countMonth,
-						"retry_after": retryAfter,
-						"reset_at":    firstDayNextMonth.Format(time.RFC3339),
-					})
-				}
+		if rateLimits["per_month"] > 0 && err == nil {
+			if countMonth > int64(rateLimits["per_month"]) {
+				// Calculate seconds until next month
+				firstDayNextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location())
+				retryAfter := int64(firstDayNextMonth.Sub(now).Seconds())
+
+				c.Set("X-RateLimit-Limit-Month", strconv.Itoa(rateLimits["per_month"]))
+				c.Set("X-RateLimit-Remaining-Month", "0")
+				c.Set("X-RateLimit-Reset-Month", strconv.FormatInt(firstDayNextMonth.Unix(), 10))
+				c.Set("Retry-After", strconv.FormatInt(retryAfter, 10))
 
-				// Set remaining count header
-				c.Set("X-RateLimit-Remaining-Month", strconv.FormatInt(int64(rateLimits["per_month"])-countMonth, 10))
+				return c.Status(429).JSON(fiber.Map{
+					"error":       "monthly_quota_exceeded",
+					"message":     "Monthly quota exceeded",
+					"limit_type":  "per_month",
+					"limit":       rateLimits["per_month"],
+					"used":        countMonth,
+					"retry_after": retryAfter,
+					"reset_at":    firstDayNextMonth.Format(time.RFC3339),
+				})
 			}
+
+			// Set remaining count header
+			c.Set("X-RateLimit-Remaining-Month", strconv.FormatInt(int64(rateLimits["per_month"])-countMonth, 10))
 		}
 
 		// Add rate limit headers to response
 		c.Set("X-RateLimit-Limit-Second", strconv.Itoa(rateLimits["per_second"]))
+		c.Set("X-RateLimit-Burst", strconv.Itoa(burst))
 		c.Set("X-RateLimit-Limit-Day", strconv.Itoa(rateLimits["per_day"]))
 		c.Set("X-RateLimit-Limit-Month", strconv.Itoa(rateLimits["per_month"]))
 
 		// Store counts in locals for analytics middleware
 		c.Locals("rate_limit_counts", map[string]int64{
-			"second": getCurrentCount(ctx, rdb, keySecond),
-			"day":    getCurrentCount(ctx, rdb, keyDay),
-			"month":  getCurrentCount(ctx, rdb, keyMonth),
+			"second": int64(burst) - result.Remaining,
+			"day":    countDay,
+			"month":  countMonth,
 		})
 
 		return c.Next()
 	}
 }
 
-// getCurrentCount gets the current count from Redis
-func getCurrentCount(ctx context.Context, rdb *redis.Client, key string) int64 {
-	val, err := rdb.Get(ctx, key).Int64()
+// rateLimitTTLs are the expirations of the day and month counters
+// They outlive their window to handle timezone differences
+var rateLimitTTLs = []time.Duration{25 * time.Hour, 32 * 24 * time.Hour}
+
+// rateLimitScript takes a token from the bucket (KEYS[1]) refilled at ARGV[1]
+// tokens per second up to ARGV[2], then adds the endpoint weight (ARGV[7]) to
+// the day and month counters (KEYS[2-3]) of the windows with a limit (ARGV
+// 3-4) and reads the others; ARGV 5-6 are their TTLs, ARGV[8] is now in ms
+// It stops at the first limit exceeded so a rejected request does not consume
+// the longer quotas, and returns {whole tokens left or -1 when the bucket was
+// empty, ms until the next token, day count, month count}
+// The bucket is kept as a hash of its tokens and when they were counted
+var rateLimitScript = redis.NewScript(`
+local result = {0, 0, 0, 0}
+local rate = tonumber(ARGV[1])
+if rate > 0 then
+	local burst = tonumber(ARGV[2])
+	local now = tonumber(ARGV[8])
+	local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+	local tokens = tonumber(state[1]) or burst
+	local ts = tonumber(state[2]) or now
+	if now > ts then
+		tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+		ts = now
+	end
+	if tokens < 1 then
+		result[1] = -1
+		result[2] = math.ceil((1 - tokens) * 1000 / rate)
+		return result
+	end
+	tokens = tokens - 1
+	redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', ts)
+	redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+	result[1] = math.floor(tokens)
+end
+for i = 2, 3 do
+	local limit = tonumber(ARGV[i + 1])
+	if limit > 0 then
+		result[i + 1] = redis.call('INCRBY', KEYS[i], ARGV[7])
+		redis.call('EXPIRE', KEYS[i], ARGV[i + 3])
+		if result[i + 1] > limit then
+			return result
+		end
+	else
+		result[i + 1] = tonumber(redis.call('GET', KEYS[i]) or '0')
+	end
+end
+return result
+`)
+
+// rateLimitResult is what a request left of its key's limits
+type rateLimitResult struct {
+	// Remaining is the whole tokens left in the bucket, -1 when it was empty
+	Remaining int64
+	// RetryAfter is when the next token is due if the bucket was empty
+	RetryAfter time.Duration
+	Day        int64
+	Month      int64
+}
+
+// consumeRateLimits takes a token from the bucket key and counts a request of
+// the given weight against the day and month keys in one round-trip
+// On error the result is zero and the caller lets the request through
+func consumeRateLimits(ctx context.Context, rdb *redis.Client, keys []string, rate, burst, perDay, perMonth, weight int, now time.Time) (rateLimitResult, error) {
+	args := []interface{}{rate, burst, perDay, perMonth}
+	for _, ttl := range rateLimitTTLs {
+		args = append(args, int64(ttl.Seconds()))
+	}
+	args = append(args, weight, now.UnixMilli())
+
+	values, err := rateLimitScript.Run(ctx, rdb, keys, args...).Int64Slice()
+	if err != nil || len(values) != 4 {
+		return rateLimitResult{}, err
+	}
+	return rateLimitResult{
+		Remaining:  values[0],
+		RetryAfter: time.Duration(values[1]) * time.Millisecond,
+		Day:        values[2],
+		Month:      values[3],
+	}, nil
+}
+
+// bucketCapacity is how many requests a key may send at once: its burst
+// allowance, or one second's worth when that is not set
+func bucketCapacity(perSecond, burst int) int {
+	if burst < perSecond {
+		return perSecond
+	}
+	return burst
+}
+
+// refillTokens returns the tokens of a bucket last counted at ts, refilled at
+// rate per second up to capacity; rateLimitScript does the same in Redis
+func refillTokens(tokens float64, ts, now time.Time, rate, capacity int) float64 {
+	if now.After(ts) {
+		tokens += now.Sub(ts).Seconds() * float64(rate)
+	}
+	return math.Min(tokens, float64(capacity))
+}
+
+// quotaCrossings returns the thresholds a request of the given weight took a
+// quota's count past; the count is atomic, so only one request crosses each
+func quotaCrossings(window string, used, weight, limit int64, resetAt time.Time) []QuotaCrossing {
+	if limit <= 0 {
+		return nil
+	}
+
+	var crossings []QuotaCrossing
+	previous := used - weight
+	for _, threshold := range QuotaThresholds {
+		mark := (limit*int64(threshold) + 99) / 100
+		if previous < mark && used >= mark {
+			crossings = append(crossings, QuotaCrossing{
+				Window:    window,
+				Threshold: threshold,
+				Used:      used,
+				Limit:     limit,
+				ResetAt:   resetAt,
+			})
+		}
+	}
+	return crossings
+}
+
+// EndpointWeight returns the quota units a request costs: the weight of the
+// endpoint ("METHOD /path", :params matching any segment) matching the
+// request path without its /v2 or /v3 prefix, or 1
+// When several match, the one with the fewest :params wins
+func EndpointWeight(weights map[string]int, method, path string) int {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) > 0 && isVersionSegment(segments[0]) {
+		segments = segments[1:]
+	}
+
+	best, bestParams := 1, -1
+	for endpoint, weight := range weights {
+		endpointMethod, pattern, ok := strings.Cut(endpoint, " ")
+		if !ok || !strings.EqualFold(endpointMethod, method) || weight < 1 {
+			continue
+		}
+		params, ok := matchSegments(strings.Split(strings.Trim(pattern, "/"), "/"), segments)
+		if ok && (bestParams < 0 || params < bestParams) {
+			best, bestParams = weight, params
+		}
+	}
+	return best
+}
+
+// isVersionSegment reports whether a path segment is an API version (v2, v3)
+func isVersionSegment(segment string) bool {
+	if len(segment) < 2 || segment[0] != 'v' {
+		return false
+	}
+	_, err := strconv.Atoi(segment[1:])
+	return err == nil
+}
+
+// matchSegments matches path segments against a route pattern's segments and
+// returns how many :params it used
+func matchSegments(pattern, segments []string) (params int, ok bool) {
+	if len(pattern) != len(segments) {
+		return 0, false
+	}
+	for i, p := range pattern {
+		if strings.HasPrefix(p, ":") {
+			params++
+		} else if p != segments[i] {
+			return 0, false
+		}
+	}
+	return params, true
+}
+
+// getCurrentCounts gets the current counts of keys from Redis in one MGET
+// Missing keys and errors count as zero
+func getCurrentCounts(ctx context.Context, rdb *redis.Client, keys ...string) []int64 {
+	counts := make([]int64, len(keys))
+	values, err := rdb.MGet(ctx, keys...).Result()
 	if err != nil {
-		return 0
+		return counts
+	}
+	for i, v := range values {
+		if s, ok := v.(string); ok {
+			counts[i], _ = strconv.ParseInt(s, 10, 64)
+		}
 	}
-	return val
+	return counts
+}
+
+// rateLimitKeys returns the Redis keys of the token bucket and of the current
+// day and month counters under a RateLimitKey prefix
+func rateLimitKeys(prefix string, now time.Time) (bucket, day, month string) {
+	return prefix + ":bucket",
+		prefix + ":day:" + now.Format("2006-01-02"),
+		prefix + ":month:" + now.Format("2006-01")
 }
 
 // ResetRateLimit resets rate limits for a partner (admin function)
-func ResetRateLimit(rdb *redis.Client, partnerID string, period string) error {
-	ctx := context.Background()
-	now := time.Now()
+func ResetRateLimit(ctx context.Context, rdb *redis.Client, partnerID string, period string) error {
+	keyBucket, keyDay, keyMonth := rateLimitKeys((&PartnerContext{PartnerID: partnerID}).RateLimitKey(), time.Now())
 
 	var key string
 	switch period {
 	case "second":
-		key = fmt.Sprintf("rl:partner:%s:second:%d", partnerID, now.Unix())
+		key = keyBucket
 	case "day":
-		key = fmt.Sprintf("rl:partner:%s:day:%s", partnerID, now.Format("2006-01-02"))
+		key = keyDay
 	case "month":
-		key = fmt.Sprintf("rl:partner:%s:month:%s", partnerID, now.Format("2006-01"))
+		key = keyMonth
 	default:
 		return fmt.Errorf("invalid period: %s", period)
 	}
@@ -177,38 +408,77 @@ func ResetRateLimit(rdb *redis.Client, partnerID string, period string) error {
 	return rdb.Del(ctx, key).Err()
 }
 
-// GetRateLimitStatus gets current rate limit status for a partner
-func GetRateLimitStatus(rdb *redis.Client, partnerID string, rateLimits map[string]int) map[string]interface{} {
-	ctx := context.Background()
+// GetRateLimitStatus gets current rate limit status for a partner's key
+// Sandbox keys report their own counters
+func GetRateLimitStatus(ctx context.Context, rdb *redis.Client, partner *PartnerContext, rateLimits map[string]int) map[string]interface{} {
 	now := time.Now()
 
-	keySecond := fmt.Sprintf("rl:partner:%s:second:%d", partnerID, now.Unix())
-	keyDay := fmt.Sprintf("rl:partner:%s:day:%s", partnerID, now.Format("2006-01-02"))
-	keyMonth := fmt.Sprintf("rl:partner:%s:month:%s", partnerID, now.Format("2006-01"))
+	keyBucket, keyDay, keyMonth := rateLimitKeys(partner.RateLimitKey(), now)
+
+	counts := getCurrentCounts(ctx, rdb, keyDay, keyMonth)
+	countDay, countMonth := counts[0], counts[1]
 
-	countSecond := getCurrentCount(ctx, rdb, keySecond)
-	countDay := getCurrentCount(ctx, rdb, keyDay)
-	countMonth := getCurrentCount(ctx, rdb, keyMonth)
+	// An unknown bucket is full
+	burst := bucketCapacity(rateLimits["per_second"], rateLimits["burst"])
+	tokens := float64(burst)
+	if state, err := rdb.HMGet(ctx, keyBucket, "tokens", "ts").Result(); err == nil && len(state) == 2 {
+		t, tokensErr := redisFloat(state[0])
+		ts, tsErr := redisFloat(state[1])
+		if tokensErr == nil && tsErr == nil {
+			tokens = refillTokens(t, time.UnixMilli(int64(ts)), now, rateLimits["per_second"], burst)
+		}
+	}
+	remainingSecond := int64(math.Floor(tokens))
+
+	_, resetDay, resetMonth := rateLimitResets(now)
+	resetSecond := now.Truncate(time.Second)
+	if rate := rateLimits["per_second"]; rate > 0 && tokens < float64(burst) {
+		// When the bucket is full again
+		resetSecond = now.Add(time.Duration((float64(burst) - tokens) / float64(rate) * float64(time.Second)))
+	}
 
 	return map[string]interface{}{
 		"second": map[string]interface{}{
 			"limit":     rateLimits["per_second"],
-			"used":      countSecond,
-			"remaining": maxInt64(0, int64(rateLimits["per_second"])-countSecond),
+			"burst":     burst,
+			"used":      int64(burst) - remainingSecond,
+			"remaining": remainingSecond,
+			"reset_at":  resetSecond.Format(time.RFC3339),
 		},
 		"day": map[string]interface{}{
 			"limit":     rateLimits["per_day"],
 			"used":      countDay,
 			"remaining": maxInt64(0, int64(rateLimits["per_day"])-countDay),
+			"reset_at":  resetDay.Format(time.RFC3339),
 		},
 		"month": map[string]interface{}{
 			"limit":     rateLimits["per_month"],
 			"used":      countMonth,
 			"remaining": maxInt64(0, int64(rateLimits["per_month"])-countMonth),
+			"reset_at":  resetMonth.Format(time.RFC3339),
 		},
 	}
 }
 
+// redisFloat parses a number read from Redis
+func redisFloat(v interface{}) (float64, error) {
+	s, ok := v.(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected value %v", v)
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// rateLimitResets returns when the current second, day and month counters
+// roll over, matching the windows RateLimitMiddleware counts in
+func rateLimitResets(now time.Time) (second, day, month time.Time) {
+	second = time.Unix(now.Unix()+1, 0).In(now.Location())
+	tomorrow := now.AddDate(0, 0, 1)
+	day = time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 0, 0, 0, 0, now.Location())
+	month = time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location())
+	return second, day, month
+}
+
 func maxInt64(a, b int64) int64 {
 	if a > b {
 		return a
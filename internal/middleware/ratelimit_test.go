@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitResets(t *testing.T) {
+	now := time.Date(2026, time.December, 31, 17, 45, 12, 500, time.UTC)
+
+	second, day, month := rateLimitResets(now)
+	assert.Equal(t, time.Date(2026, time.December, 31, 17, 45, 13, 0, time.UTC), second)
+	assert.Equal(t, time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC), day)
+	assert.Equal(t, time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC), month)
+}
+
+func TestConsumeRateLimitsUnavailable(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", DialTimeout: 100 * time.Millisecond, MaxRetries: -1})
+	defer rdb.Close()
+
+	// Without Redis the request is let through: the bucket is not empty and
+	// counts are zero, never over a limit
+	result, err := consumeRateLimits(context.Background(), rdb, []string{"b", "d", "m"}, 10, 20, 100, 1000, 5, time.Now())
+	assert.Error(t, err)
+	assert.Equal(t, rateLimitResult{}, result)
+}
+
+func TestRefillTokens(t *testing.T) {
+	ts := time.Date(2026, time.March, 2, 8, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 0.0, refillTokens(0, ts, ts, 10, 20))
+	// 10 tokens per second: one every 100ms
+	assert.InDelta(t, 2.5, refillTokens(0.5, ts, ts.Add(200*time.Millisecond), 10, 20), 1e-9)
+	// Never more than the burst allowance
+	assert.Equal(t, 20.0, refillTokens(3, ts, ts.Add(time.Minute), 10, 20))
+	// A clock behind the last count does not take tokens away
+	assert.Equal(t, 3.0, refillTokens(3, ts, ts.Add(-time.Second), 10, 20))
+}
+
+func TestBucketCapacity(t *testing.T) {
+	assert.Equal(t, 10, bucketCapacity(10, 0))
+	assert.Equal(t, 10, bucketCapacity(10, 5))
+	assert.Equal(t, 25, bucketCapacity(10, 25))
+}
+
+func TestEndpointWeight(t *testing.T) {
+	weights := map[string]int{
+		"GET /route-search":        5,
+		"GET /routes/:id/schedule": 2,
+		"GET /routes/:id":          4,
+		"GET /routes/list":         3,
+		"POST /itineraries":        0,
+	}
+
+	assert.Equal(t, 5, EndpointWeight(weights, "GET", "/v2/route-search"))
+	assert.Equal(t, 5, EndpointWeight(weights, "GET", "/v3/route-search/"))
+	assert.Equal(t, 2, EndpointWeight(weights, "GET", "/v3/routes/L1/schedule"))
+	assert.Equal(t, 1, EndpointWeight(weights, "GET", "/v3/routes/L1/schedule.ics"))
+	assert.Equal(t, 1, EndpointWeight(weights, "POST", "/v2/route-search"))
+	assert.Equal(t, 3, EndpointWeight(weights, "GET", "/v2/routes/list"))
+	assert.Equal(t, 4, EndpointWeight(weights, "GET", "/v2/routes/L1"))
+	// Weights below 1 are ignored rather than making a request free
+	assert.Equal(t, 1, EndpointWeight(weights, "POST", "/v2/itineraries"))
+	assert.Equal(t, 1, EndpointWeight(nil, "GET", "/v2/route-search"))
+}
+
+func TestQuotaCrossings(t *testing.T) {
+	reset := time.Date(2026, time.October, 17, 0, 0, 0, 0, time.UTC)
+
+	assert.Empty(t, quotaCrossings("day", 799, 1, 1000, reset))
+	crossings := quotaCrossings("day", 800, 1, 1000, reset)
+	if assert.Len(t, crossings, 1) {
+		assert.Equal(t, QuotaCrossing{Window: "day", Threshold: 80, Used: 800, Limit: 1000, ResetAt: reset}, crossings[0])
+	}
+	// Only the request that crosses reports it
+	assert.Empty(t, quotaCrossings("day", 801, 1, 1000, reset))
+
+	// A heavy request can cross both thresholds at once
+	crossings = quotaCrossings("month", 1003, 205, 1000, reset)
+	if assert.Len(t, crossings, 2) {
+		assert.Equal(t, 80, crossings[0].Threshold)
+		assert.Equal(t, 100, crossings[1].Threshold)
+	}
+
+	// Unlimited quotas have no thresholds
+	assert.Empty(t, quotaCrossings("month", 5000, 1, -1, reset))
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+)
+
+// Recover turns a panic in a handler into a 500 response
+// The panic is logged with its stack, which also reports it to the error
+// tracker; the error handler should not log the resulting error again
+func Recover() fiber.Handler {
+	return recover.New(recover.Config{
+		EnableStackTrace:  true,
+		StackTraceHandler: logPanic,
+	})
+}
+
+func logPanic(c *fiber.Ctx, e interface{}) {
+	c.Locals("panic", true)
+	logger.ErrorContext(c.Context(), "Panic recovered",
+		"method", c.Method(),
+		"path", c.Path(),
+		"route", c.Route().Path,
+		"panic", fmt.Sprint(e),
+		"stack", string(debug.Stack()),
+	)
+}
+
+// Panicked reports whether the request failed with a recovered panic
+func Panicked(c *fiber.Ctx) bool {
+	p, _ := c.Locals("panic").(bool)
+	return p
+}
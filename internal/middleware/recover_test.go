@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/passbi/passbi_core/internal/errreport"
+	"github.com/passbi/passbi_core/internal/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+type panicReporter struct{ events []*errreport.Event }
+
+func (r *panicReporter) Report(e *errreport.Event) { r.events = append(r.events, e) }
+func (r *panicReporter) Flush(time.Duration)       {}
+
+func TestRecoverReportsPanic(t *testing.T) {
+	reporter := &panicReporter{}
+	errreport.SetReporter(reporter)
+	defer errreport.SetReporter(nil)
+
+	prev := slog.Default()
+	defer slog.SetDefault(prev)
+	logging.SetupWithConfig("api", &logging.Config{Level: slog.LevelInfo}, io.Discard)
+
+	var panicked bool
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			panicked = Panicked(c)
+			return c.SendStatus(500)
+		},
+	})
+	app.Use(Recover())
+	app.Get("/v2/stops/:id", func(c *fiber.Ctx) error {
+		var stops map[string]int
+		stops[c.Params("id")]++
+		return nil
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/v2/stops/42", nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 500, resp.StatusCode)
+	assert.True(t, panicked)
+
+	if assert.Len(t, reporter.events, 1) {
+		e := reporter.events[0]
+		assert.Equal(t, "panic", e.ErrorType)
+		assert.Contains(t, e.Error, "nil map")
+		assert.Equal(t, "/v2/stops/:id", e.Tags["route"])
+	}
+}
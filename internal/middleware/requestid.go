@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HeaderRequestID carries the ID that ties a response to our logs
+const HeaderRequestID = "X-Request-ID"
+
+// maxRequestIDLength bounds client-supplied IDs stored in logs and usage_log
+const maxRequestIDLength = 128
+
+// RequestID assigns every request an ID, reusing the client's X-Request-ID
+// when it is sane so partners can correlate with their own logs
+// The ID is echoed in the response header and added to JSON error bodies
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(HeaderRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Locals("request_id", id)
+		c.Set(HeaderRequestID, id)
+
+		// Returned errors are rendered later by the app's error handler,
+		// which adds the ID itself
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		if c.Response().StatusCode() >= 400 {
+			contentType := string(c.Response().Header.ContentType())
+			if strings.HasPrefix(contentType, fiber.MIMEApplicationJSON) ||
+				strings.HasPrefix(contentType, "application/problem+json") {
+				c.Response().SetBodyRaw(withRequestID(c.Response().Body(), id))
+			}
+		}
+		return nil
+	}
+}
+
+// GetRequestID returns the ID assigned by RequestID, or "" outside it
+func GetRequestID(c *fiber.Ctx) string {
+	id, _ := c.Locals("request_id").(string)
+	return id
+}
+
+// validRequestID accepts short IDs made of printable ASCII without spaces,
+// so a client header cannot break log lines
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns 16 random bytes in hex
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// withRequestID adds a request_id field to a JSON object body
+// Bodies that are not objects, or already name a request_id, are unchanged
+func withRequestID(body []byte, id string) []byte {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) < 2 || trimmed[0] != '{' || !json.Valid(trimmed) {
+		return body
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &fields); err != nil {
+		return body
+	}
+	if _, ok := fields["request_id"]; ok {
+		return body
+	}
+
+	encodedID, _ := json.Marshal(id)
+	out := make([]byte, 0, len(trimmed)+len(encodedID)+16)
+	out = append(out, `{"request_id":`...)
+	out = append(out, encodedID...)
+	if rest := bytes.TrimSpace(trimmed[1:]); len(rest) > 0 && rest[0] != '}' {
+		out = append(out, ',')
+	}
+	out = append(out, trimmed[1:]...)
+	return out
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidRequestID(t *testing.T) {
+	assert.True(t, validRequestID("abc-123_XYZ"))
+	assert.False(t, validRequestID(""))
+	assert.False(t, validRequestID("has space"))
+	assert.False(t, validRequestID("line\nbreak"))
+	assert.False(t, validRequestID(string(make([]byte, maxRequestIDLength+1))))
+}
+
+func TestWithRequestID(t *testing.T) {
+	assert.Equal(t, `{"request_id":"r1","error":"x"}`, string(withRequestID([]byte(`{"error":"x"}`), "r1")))
+	assert.Equal(t, `{"request_id":"r1"}`, string(withRequestID([]byte(`{}`), "r1")))
+	assert.Equal(t, `{"request_id":"mine"}`, string(withRequestID([]byte(`{"request_id":"mine"}`), "r1")))
+	assert.Equal(t, `[1,2]`, string(withRequestID([]byte(`[1,2]`), "r1")))
+	assert.Equal(t, `{broken`, string(withRequestID([]byte(`{broken`), "r1")))
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	app := fiber.New()
+	app.Use(RequestID())
+	app.Get("/missing", func(c *fiber.Ctx) error {
+		return c.Status(404).JSON(fiber.Map{"error": "not found"})
+	})
+
+	req := httptest.NewRequest("GET", "/missing", nil)
+	req.Header.Set(HeaderRequestID, "partner-42")
+	resp, err := app.Test(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "partner-42", resp.Header.Get(HeaderRequestID))
+	assert.JSONEq(t, `{"error":"not found","request_id":"partner-42"}`, string(body))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/missing", nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, resp.Header.Get(HeaderRequestID), 32)
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// Roles of dashboard users within their partner account
+const (
+	RoleOwner     = "owner"
+	RoleDeveloper = "developer"
+	RoleBilling   = "billing"
+	RoleReadOnly  = "read_only"
+
+	// RoleAPIKey is the role of dashboard requests made with an API key rather
+	// than a user session; it cannot be given to users
+	RoleAPIKey = "api_key"
+)
+
+// Dashboard capabilities granted by roles
+const (
+	CapRead          = "read"         // account, API keys, usage, quotas and settings
+	CapManageKeys    = "manage_keys"  // create and revoke API keys and signing secrets
+	CapSettings      = "settings"     // quota notification settings
+	CapViewBilling   = "view_billing" // invoices
+	CapManageBilling = "billing"      // tier changes
+	CapManageUsers   = "manage_users" // invite users, change roles, remove users
+)
+
+// RoleCapabilities lists what each role may do on the dashboard
+var RoleCapabilities = map[string][]string{
+	RoleOwner:     {CapRead, CapManageKeys, CapSettings, CapViewBilling, CapManageBilling, CapManageUsers},
+	RoleDeveloper: {CapRead, CapManageKeys, CapSettings},
+	RoleBilling:   {CapRead, CapSettings, CapViewBilling, CapManageBilling},
+	RoleReadOnly:  {CapRead, CapViewBilling},
+
+	// A leaked key must not be enough to invite users or change the tier
+	RoleAPIKey: {CapRead, CapManageKeys, CapSettings, CapViewBilling},
+}
+
+// ValidRole reports whether role is one of the roles users can be given
+func ValidRole(role string) bool {
+	_, ok := RoleCapabilities[role]
+	return ok && role != RoleAPIKey
+}
+
+// DashboardCapabilities maps each /dashboard endpoint (without the prefix)
+// to the capability it requires; "" only requires a session
+var DashboardCapabilities = map[string]string{
+	"GET /me":              CapRead,
+	"PUT /password":        "",
+	"GET /api-keys":        CapRead,
+	"POST /api-keys":       CapManageKeys,
+	"DELETE /api-keys/:id": CapManageKeys,
+
+	"POST /api-keys/:id/signing-secret":   CapManageKeys,
+	"PATCH /api-keys/:id/signing-secret":  CapManageKeys,
+	"DELETE /api-keys/:id/signing-secret": CapManageKeys,
+
+	"GET /usage":               CapRead,
+	"GET /usage/export":        CapRead,
+	"GET /quota":               CapRead,
+	"PUT /tier":                CapManageBilling,
+	"GET /invoices":            CapViewBilling,
+	"GET /invoices/:id":        CapViewBilling,
+	"GET /notifications/quota": CapRead,
+	"PUT /notifications/quota": CapSettings,
+	"GET /users":               CapRead,
+	"POST /users":              CapManageUsers,
+	"PATCH /users/:id":         CapManageUsers,
+	"DELETE /users/:id":        CapManageUsers,
+}
+
+// Can reports whether the dashboard user's role grants a capability
+func (p *PartnerContext) Can(capability string) bool {
+	for _, c := range RoleCapabilities[p.Role] {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireCapability rejects dashboard users whose role lacks a capability
+func RequireCapability(capability string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		partner, ok := c.Locals("partner").(*PartnerContext)
+		if !ok {
+			return c.Status(401).JSON(fiber.Map{
+				"error":   "unauthorized",
+				"message": "Authentication required",
+			})
+		}
+
+		if !partner.Can(capability) {
+			return c.Status(403).JSON(fiber.Map{
+				"error":               "insufficient_role",
+				"message":             "Your role does not allow this action",
+				"role":                partner.Role,
+				"required_capability": capability,
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleCapabilities(t *testing.T) {
+	owner := &PartnerContext{Role: RoleOwner}
+	developer := &PartnerContext{Role: RoleDeveloper}
+	billing := &PartnerContext{Role: RoleBilling}
+	readOnly := &PartnerContext{Role: RoleReadOnly}
+
+	assert.True(t, owner.Can(CapManageUsers))
+	assert.True(t, developer.Can(CapManageKeys))
+	assert.False(t, developer.Can(CapViewBilling))
+	assert.True(t, billing.Can(CapManageBilling))
+	assert.False(t, billing.Can(CapManageKeys))
+	assert.True(t, readOnly.Can(CapRead))
+	assert.False(t, readOnly.Can(CapSettings))
+
+	assert.False(t, (&PartnerContext{}).Can(CapRead), "no role")
+	assert.False(t, ValidRole("admin"))
+
+	apiKey := &PartnerContext{Role: RoleAPIKey}
+	assert.True(t, apiKey.Can(CapManageKeys))
+	assert.False(t, apiKey.Can(CapManageUsers))
+	assert.False(t, apiKey.Can(CapManageBilling))
+	assert.False(t, ValidRole(RoleAPIKey), "users cannot be given the API key role")
+}
+
+func TestDashboardAuthAPIKeyRole(t *testing.T) {
+	// The key lookup needs Postgres: stand in for it with a valid key
+	defer func(f func(*fiber.Ctx, *pgxpool.Pool) (bool, error)) { authenticateKey = f }(authenticateKey)
+	authenticateKey = func(c *fiber.Ctx, _ *pgxpool.Pool) (bool, error) {
+		c.Locals("partner", &PartnerContext{APIKeyID: "k1"})
+		return true, nil
+	}
+
+	app := fiber.New()
+	dashboard := app.Group("/dashboard", DashboardAuth(nil, nil))
+	ok := func(c *fiber.Ctx) error { return c.SendString("ok") }
+	r := Permissioned(dashboard)
+	r.Get("/me", ok)
+	r.Post("/api-keys", ok)
+	r.Post("/users", ok)
+	r.Patch("/users/:id", ok)
+	r.Put("/tier", ok)
+
+	for _, tc := range []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "/dashboard/me", 200},
+		{"POST", "/dashboard/api-keys", 200},
+		{"POST", "/dashboard/users", 403},
+		{"PATCH", "/dashboard/users/u1", 403},
+		{"PUT", "/dashboard/tier", 403},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("Authorization", "Bearer pk_live_leaked")
+		resp, err := app.Test(req)
+		if assert.NoError(t, err) {
+			assert.Equal(t, tc.status, resp.StatusCode, tc.method+" "+tc.path)
+		}
+	}
+}
+
+func TestPermissionedRouter(t *testing.T) {
+	role := RoleDeveloper
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("partner", &PartnerContext{Role: role})
+		return c.Next()
+	})
+	ok := func(c *fiber.Ctx) error { return c.SendString("ok") }
+
+	r := Permissioned(app)
+	r.Post("/api-keys", ok)
+	r.Put("/tier", ok)
+	r.Put("/password", ok)
+
+	for _, tc := range []struct {
+		role, method, path string
+		status             int
+	}{
+		{RoleDeveloper, "POST", "/api-keys", 200},
+		{RoleDeveloper, "PUT", "/tier", 403},
+		{RoleBilling, "PUT", "/tier", 200},
+		{RoleBilling, "POST", "/api-keys", 403},
+		{RoleReadOnly, "PUT", "/password", 200},
+	} {
+		role = tc.role
+		resp, err := app.Test(httptest.NewRequest(tc.method, tc.path, nil))
+		if assert.NoError(t, err) {
+			assert.Equal(t, tc.status, resp.StatusCode, tc.role+" "+tc.method+" "+tc.path)
+		}
+	}
+
+	assert.Panics(t, func() { r.Get("/unmapped", ok) })
+}
@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Scopes an API key can hold; ScopeAdmin is defined with HasScope
+const (
+	ScopeReadRoutes     = "read:routes"     // trip planning, stops, lines and schedules
+	ScopeReadDepartures = "read:departures" // departure boards, SIRI and service alerts
+	ScopeReadUsers      = "read:users"      // saved places and favorites of app users
+	ScopeWriteUsers     = "write:users"
+	ScopeWriteFeedback  = "write:feedback"  // data error reports
+	ScopeWriteAlerts    = "write:alerts"    // service alert management under /admin
+	ScopeWriteVehicles  = "write:vehicles"  // GPS fixes pushed by operators and the driver app
+	ScopeWriteOccupancy = "write:occupancy" // crowding reported by drivers and riders
+)
+
+// PartnerScopes are the scopes partners may grant their own keys
+// ScopeAdmin, ScopeWriteAlerts and ScopeWriteVehicles are granted by PassBi
+// staff only
+var PartnerScopes = []string{
+	ScopeReadRoutes, ScopeReadDepartures, ScopeReadUsers, ScopeWriteUsers, ScopeWriteFeedback,
+	ScopeWriteOccupancy,
+}
+
+// DefaultScopes are given to a new key that does not ask for any
+var DefaultScopes = []string{ScopeReadRoutes, ScopeReadDepartures}
+
+// APIScopes maps each /v2 and /v3 endpoint ("METHOD /path" without the
+// version prefix) to the scope it requires; "" only requires a valid key
+var APIScopes = map[string]string{
+	"GET /route-search":            ScopeReadRoutes,
+	"GET /stops/nearby":            ScopeReadRoutes,
+	"GET /stops/search":            ScopeReadRoutes,
+	"GET /routes/list":             ScopeReadRoutes,
+	"GET /routes":                  ScopeReadRoutes,
+	"GET /stops/:id/routes":        ScopeReadRoutes,
+	"GET /routes/:id/schedule":     ScopeReadRoutes,
+	"GET /routes/:id/schedule.ics": ScopeReadRoutes,
+	"GET /routes/:id/trips":        ScopeReadRoutes,
+	"GET /routes/:id/stops":        ScopeReadRoutes,
+	"GET /routes/:id/frequency":    ScopeReadRoutes,
+	"GET /network/stats":           ScopeReadRoutes,
+	"GET /services":                ScopeReadRoutes,
+	"POST /itineraries":            ScopeReadRoutes,
+	"GET /itineraries/:token":      ScopeReadRoutes,
+	"GET /stops/:id/departures":    ScopeReadDepartures,
+	"GET /routes/:id/vehicles":     ScopeReadDepartures,
+	"GET /routes/:id/occupancy":    ScopeReadDepartures,
+	"GET /routes/:id/headways":     ScopeWriteVehicles,
+	"GET /trips/:id/replay":        ScopeWriteVehicles,
+	"GET /siri/stop-monitoring":    ScopeReadDepartures,
+	"GET /alerts":                  ScopeReadDepartures,
+	"POST /feedback":               ScopeWriteFeedback,
+	"POST /vehicles/positions":     ScopeWriteVehicles,
+	"POST /occupancy":              ScopeWriteOccupancy,
+	"GET /driver/devices":          ScopeWriteVehicles,
+	"POST /driver/devices":         ScopeWriteVehicles,
+	"DELETE /driver/devices/:id":   ScopeWriteVehicles,
+	"GET " + RateLimitStatusPath:   "",
+	"GET /me":                      ScopeReadUsers,
+	"DELETE /me":                   ScopeWriteUsers,
+	"PUT /me/places/:kind":         ScopeWriteUsers,
+	"DELETE /me/places/:kind":      ScopeWriteUsers,
+	"PUT /me/stops/:id":            ScopeWriteUsers,
+	"DELETE /me/stops/:id":         ScopeWriteUsers,
+	"PUT /me/routes/:id":           ScopeWriteUsers,
+	"DELETE /me/routes/:id":        ScopeWriteUsers,
+}
+
+// AdminScopes maps each /admin endpoint (without the prefix) to its scope
+// Alerts can be managed with write:alerts, everything else needs admin:*
+var AdminScopes = map[string]string{
+	"GET /stats":               ScopeAdmin,
+	"GET /cache/stats":         ScopeAdmin,
+	"DELETE /cache":            ScopeAdmin,
+	"GET /alerts":              ScopeWriteAlerts,
+	"POST /alerts":             ScopeWriteAlerts,
+	"GET /alerts/:id":          ScopeWriteAlerts,
+	"PUT /alerts/:id":          ScopeWriteAlerts,
+	"POST /alerts/:id/expire":  ScopeWriteAlerts,
+	"POST /alerts/:id/confirm": ScopeWriteAlerts,
+	"DELETE /alerts/:id":       ScopeWriteAlerts,
+	"GET /feedback":            ScopeAdmin,
+	"GET /feedback/:id":        ScopeAdmin,
+	"PATCH /feedback/:id":      ScopeAdmin,
+	"GET /imports":             ScopeAdmin,
+	"POST /imports":            ScopeAdmin,
+	"GET /imports/:id":         ScopeAdmin,
+	"GET /graph/rebuild":       ScopeAdmin,
+	"POST /graph/rebuild":      ScopeAdmin,
+	"GET /graph/rebuild/:id":   ScopeAdmin,
+	"POST /invoices":           ScopeAdmin,
+	"GET /invoices/export":     ScopeAdmin,
+	"PUT /partners/:id/tier":   ScopeAdmin,
+
+	"POST /partners/:id/impersonate": ScopeAdmin,
+	"GET /impersonations":            ScopeAdmin,
+	"GET /impersonations/:id":        ScopeAdmin,
+	"POST /impersonations/:id/end":   ScopeAdmin,
+	"GET /anomalies":                 ScopeAdmin,
+	"GET /anomalies/:id":             ScopeAdmin,
+	"PATCH /anomalies/:id":           ScopeAdmin,
+	"GET /analytics/gaps":            ScopeAdmin,
+	"GET /debug/pprof":               ScopeAdmin,
+	"GET /debug/pprof/profile":       ScopeAdmin,
+	"GET /debug/pprof/trace":         ScopeAdmin,
+	"GET /debug/pprof/:name":         ScopeAdmin,
+}
+
+// ScopedRouter registers routes behind RequireScope with the scope its map
+// gives them
+// Registering an endpoint missing from the map panics, so a new endpoint
+// cannot ship without a scope
+type ScopedRouter struct {
+	router  fiber.Router
+	scopes  map[string]string
+	enforce bool
+	require func(string) fiber.Handler
+}
+
+// Scoped wraps a router; with enforce false (authentication disabled) routes
+// are registered without scope checks but must still be in the map
+func Scoped(router fiber.Router, scopes map[string]string, enforce bool) *ScopedRouter {
+	return &ScopedRouter{router: router, scopes: scopes, enforce: enforce, require: RequireScope}
+}
+
+// Permissioned wraps a /dashboard router; its routes require the capability
+// DashboardCapabilities gives them through RequireCapability
+func Permissioned(router fiber.Router) *ScopedRouter {
+	return &ScopedRouter{router: router, scopes: DashboardCapabilities, enforce: true, require: RequireCapability}
+}
+
+// Get registers a GET route
+func (s *ScopedRouter) Get(path string, handlers ...fiber.Handler) {
+	s.add(fiber.MethodGet, path, handlers)
+}
+
+// Post registers a POST route
+func (s *ScopedRouter) Post(path string, handlers ...fiber.Handler) {
+	s.add(fiber.MethodPost, path, handlers)
+}
+
+// Put registers a PUT route
+func (s *ScopedRouter) Put(path string, handlers ...fiber.Handler) {
+	s.add(fiber.MethodPut, path, handlers)
+}
+
+// Patch registers a PATCH route
+func (s *ScopedRouter) Patch(path string, handlers ...fiber.Handler) {
+	s.add(fiber.MethodPatch, path, handlers)
+}
+
+// Delete registers a DELETE route
+func (s *ScopedRouter) Delete(path string, handlers ...fiber.Handler) {
+	s.add(fiber.MethodDelete, path, handlers)
+}
+
+func (s *ScopedRouter) add(method, path string, handlers []fiber.Handler) {
+	scope, ok := s.scopes[method+" "+path]
+	if !ok {
+		panic(fmt.Sprintf("no scope defined for %s %s", method, path))
+	}
+
+	if s.enforce && scope != "" {
+		handlers = append([]fiber.Handler{s.require(scope)}, handlers...)
+	}
+	s.router.Add(method, path, handlers...)
+}
+
+// InvalidPartnerScopes returns the requested scopes partners may not grant
+func InvalidPartnerScopes(scopes []string) (invalid []string) {
+	for _, scope := range scopes {
+		allowed := false
+		for _, s := range PartnerScopes {
+			if scope == s {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			invalid = append(invalid, scope)
+		}
+	}
+	return invalid
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasScope(t *testing.T) {
+	p := &PartnerContext{Scopes: []string{"read:routes", "write:*"}}
+	assert.True(t, p.HasScope(ScopeReadRoutes))
+	assert.True(t, p.HasScope(ScopeWriteAlerts))
+	assert.False(t, p.HasScope(ScopeReadDepartures))
+	assert.False(t, p.HasScope(ScopeAdmin))
+
+	admin := &PartnerContext{Scopes: []string{ScopeAdmin}}
+	assert.True(t, admin.HasScope(ScopeReadDepartures))
+	assert.True(t, admin.HasScope(ScopeWriteAlerts))
+}
+
+func TestScopedRouter(t *testing.T) {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("partner", &PartnerContext{Scopes: []string{ScopeReadRoutes}})
+		return c.Next()
+	})
+	ok := func(c *fiber.Ctx) error { return c.SendString("ok") }
+
+	r := Scoped(app, APIScopes, true)
+	r.Get("/route-search", ok)
+	r.Get("/stops/:id/departures", ok)
+	r.Get(RateLimitStatusPath, ok)
+
+	for path, status := range map[string]int{
+		"/route-search":        200,
+		"/stops/S1/departures": 403,
+		RateLimitStatusPath:    200,
+	} {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		if assert.NoError(t, err) {
+			assert.Equal(t, status, resp.StatusCode, path)
+		}
+	}
+
+	assert.Panics(t, func() { r.Get("/unmapped", ok) })
+	assert.Panics(t, func() { r.Post("/route-search", ok) })
+}
+
+func TestScopedRouterNotEnforced(t *testing.T) {
+	app := fiber.New()
+	r := Scoped(app, APIScopes, false)
+	r.Get("/stops/:id/departures", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	// Without authentication there is no partner, and no scope check
+	resp, err := app.Test(httptest.NewRequest("GET", "/stops/S1/departures", nil))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 200, resp.StatusCode)
+	}
+}
+
+func TestInvalidPartnerScopes(t *testing.T) {
+	assert.Empty(t, InvalidPartnerScopes(DefaultScopes))
+	assert.Empty(t, InvalidPartnerScopes(PartnerScopes))
+	assert.Equal(t, []string{ScopeAdmin, "read:everything"},
+		InvalidPartnerScopes([]string{ScopeReadRoutes, ScopeAdmin, "read:everything"}))
+}
+
+func TestScopeMapsUseKnownScopes(t *testing.T) {
+	known := map[string]bool{"": true, ScopeAdmin: true, ScopeWriteAlerts: true, ScopeWriteVehicles: true}
+	for _, s := range PartnerScopes {
+		known[s] = true
+	}
+	for _, scopes := range []map[string]string{APIScopes, AdminScopes} {
+		for endpoint, scope := range scopes {
+			assert.True(t, known[scope], "%s requires unknown scope %q", endpoint, scope)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+)
+
+// Dashboard sessions are tokens issued by POST /dashboard/login
+// DASHBOARD_JWT_SECRET signs them and DASHBOARD_SESSION_TTL bounds their life
+const (
+	sessionAudience   = "dashboard"
+	defaultSessionTTL = 15 * time.Minute
+)
+
+var (
+	sessionSecret []byte
+	sessionTTL    time.Duration
+	sessionOnce   sync.Once
+)
+
+// loadSessionConfig reads the signing secret and session lifetime once
+func loadSessionConfig() {
+	sessionOnce.Do(func() {
+		sessionSecret = tokenSecret("DASHBOARD_JWT_SECRET")
+		sessionTTL = tokenTTL("DASHBOARD_SESSION_TTL", defaultSessionTTL)
+	})
+}
+
+// IssueSession signs a dashboard session token for a user of a partner
+func IssueSession(partnerID, userID string, now time.Time) (token string, expiresAt time.Time, err error) {
+	loadSessionConfig()
+
+	expiresAt = now.Add(sessionTTL).Truncate(time.Second)
+	token, err = signToken(sessionSecret, tokenClaims{
+		Subject:  partnerID,
+		Audience: sessionAudience,
+		IssuedAt: now.Unix(),
+		Expires:  expiresAt.Unix(),
+		User:     userID,
+	})
+	return token, expiresAt, err
+}
+
+// DashboardAuth authenticates /dashboard requests with a session token from
+// POST /dashboard/login, or with an API key so existing scripts keep working
+// Keys act with RoleAPIKey: managing users and billing takes a user session
+// Keys requiring signatures must sign dashboard requests too: otherwise a
+// leaked key could turn the requirement off here
+func DashboardAuth(db *pgxpool.Pool, rdb *redis.Client) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		parts := strings.SplitN(c.Get("Authorization"), " ", 2)
+		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" ||
+			strings.HasPrefix(strings.TrimSpace(parts[1]), "pk_") {
+			if ok, err := authenticateKey(c, db); !ok {
+				return err
+			}
+			if ok, err := verifySignature(c, rdb); !ok {
+				return err
+			}
+			c.Locals("partner").(*PartnerContext).Role = RoleAPIKey
+			return serve(c, db)
+		}
+
+		// Admins open the dashboard of a partner they impersonate
+		loadSessionConfig()
+		token := strings.TrimSpace(parts[1])
+		claims, err := parseToken(sessionSecret, token, sessionAudience, time.Now())
+		if err != nil {
+			if imp, impErr := parseImpersonationToken(token); impErr == nil {
+				claims, err = imp, checkImpersonation(c.UserContext(), db, imp)
+			}
+		}
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{
+				"error":   "invalid_session",
+				"message": "The session token is invalid or has expired. Log in again at POST /dashboard/login",
+			})
+		}
+
+		if ok, err := authenticateSession(c, db, claims); !ok {
+			return err
+		}
+		return serve(c, db)
+	}
+}
+
+// authenticateSession loads the session's partner and user and stores their
+// context in locals like authenticate does; the user's role is read on every
+// request, and removing the user or changing its password ends its sessions
+// Admins impersonating the partner act as an owner
+func authenticateSession(c *fiber.Ctx, db *pgxpool.Pool, claims *tokenClaims) (bool, error) {
+	query := `
+		SELECT
+			p.tier,
+			p.email,
+			COALESCE(p.company, ''),
+			p.rate_limit_per_second,
+			p.rate_limit_per_day,
+			` + effectiveMonthLimit + `,
+			p.rate_limit_burst,
+			COALESCE(u.role, ''),
+			u.password_updated_at
+		FROM partner p
+		LEFT JOIN partner_user u ON u.id::text = $2 AND u.partner_id = p.id
+		WHERE p.id = $1
+			AND p.status = 'active'
+	`
+
+	var (
+		partner = PartnerContext{
+			PartnerID:       claims.Subject,
+			ImpersonationID: claims.Impersonation,
+			UserID:          claims.User,
+		}
+		perSecond         int
+		perDay            int
+		perMonth          int
+		burst             int
+		passwordUpdatedAt *time.Time
+	)
+	err := db.QueryRow(c.UserContext(), query, claims.Subject, claims.User).Scan(
+		&partner.Tier,
+		&partner.Email,
+		&partner.CompanyName,
+		&perSecond,
+		&perDay,
+		&perMonth,
+		&burst,
+		&partner.Role,
+		&passwordUpdatedAt,
+	)
+	if err == nil {
+		if claims.Impersonation != "" {
+			partner.Role = RoleOwner
+		} else if partner.Role == "" {
+			err = errInvalidToken
+		} else if passwordUpdatedAt != nil && claims.IssuedAt < passwordUpdatedAt.Unix() {
+			err = errTokenExpired
+		}
+	}
+	if err != nil {
+		return false, c.Status(401).JSON(fiber.Map{
+			"error":   "invalid_session",
+			"message": "The session token is invalid or has expired. Log in again at POST /dashboard/login",
+		})
+	}
+
+	c.Locals("partner", &partner)
+	c.Locals("rate_limits", map[string]int{
+		"per_second": perSecond,
+		"per_day":    perDay,
+		"per_month":  perMonth,
+		"burst":      burst,
+	})
+	return true, nil
+}
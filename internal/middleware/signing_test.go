@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestSigning(t *testing.T) {
+	// Without Redis replays are not detected, but signatures are still checked
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", DialTimeout: 100 * time.Millisecond, MaxRetries: -1})
+	defer rdb.Close()
+
+	newApp := func(partner *PartnerContext) *fiber.App {
+		app := fiber.New()
+		app.Use(func(c *fiber.Ctx) error {
+			c.Locals("partner", partner)
+			return c.Next()
+		})
+		app.Use(RequestSigning(rdb))
+		app.Post("/itineraries", func(c *fiber.Ctx) error { return c.SendString("ok") })
+		return app
+	}
+	send := func(app *fiber.App, body string, sign func() (string, string)) int {
+		req := httptest.NewRequest("POST", "/itineraries?lang=fr", strings.NewReader(body))
+		if sign != nil {
+			timestamp, signature := sign()
+			req.Header.Set(HeaderSignatureTimestamp, timestamp)
+			req.Header.Set(HeaderSignature, signature)
+		}
+		resp, err := app.Test(req)
+		if !assert.NoError(t, err) {
+			return 0
+		}
+		return resp.StatusCode
+	}
+	signedAt := func(at time.Time, body string) func() (string, string) {
+		return func() (string, string) {
+			return strconv.FormatInt(at.Unix(), 10), SignRequest("ss_secret", at.Unix(), "POST", "/itineraries?lang=fr", []byte(body))
+		}
+	}
+
+	required := newApp(&PartnerContext{APIKeyID: "k1", signingSecret: "ss_secret", requireSignature: true})
+	assert.Equal(t, 401, send(required, `{"a":1}`, nil))
+	assert.Equal(t, 200, send(required, `{"a":1}`, signedAt(time.Now(), `{"a":1}`)))
+	assert.Equal(t, 401, send(required, `{"a":2}`, signedAt(time.Now(), `{"a":1}`)))
+	assert.Equal(t, 401, send(required, `{"a":1}`, signedAt(time.Now().Add(-10*time.Minute), `{"a":1}`)))
+
+	optional := newApp(&PartnerContext{APIKeyID: "k2", signingSecret: "ss_secret"})
+	assert.Equal(t, 200, send(optional, `{}`, nil))
+	assert.Equal(t, 401, send(optional, `{}`, signedAt(time.Now(), `{"other":true}`)))
+
+	unsigned := newApp(&PartnerContext{APIKeyID: "k3"})
+	assert.Equal(t, 200, send(unsigned, `{}`, nil))
+}
+
+func TestDashboardAuthRequiresSignature(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", DialTimeout: 100 * time.Millisecond, MaxRetries: -1})
+	defer rdb.Close()
+
+	// The key lookup needs Postgres: stand in for it with a signing key
+	defer func(f func(*fiber.Ctx, *pgxpool.Pool) (bool, error)) { authenticateKey = f }(authenticateKey)
+	authenticateKey = func(c *fiber.Ctx, _ *pgxpool.Pool) (bool, error) {
+		c.Locals("partner", &PartnerContext{APIKeyID: "k1", signingSecret: "ss_secret", requireSignature: true})
+		return true, nil
+	}
+
+	app := fiber.New()
+	app.Use("/dashboard", DashboardAuth(nil, rdb))
+	app.Use("/admin", AdminAuth(nil, rdb))
+	app.Delete("/dashboard/api-keys/k1/signing-secret", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	app.Get("/admin/stats", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	send := func(method, uri string, signed bool) int {
+		req := httptest.NewRequest(method, uri, nil)
+		req.Header.Set("Authorization", "Bearer pk_live_leaked")
+		if signed {
+			now := time.Now().Unix()
+			req.Header.Set(HeaderSignatureTimestamp, strconv.FormatInt(now, 10))
+			req.Header.Set(HeaderSignature, SignRequest("ss_secret", now, method, uri, nil))
+		}
+		resp, err := app.Test(req)
+		if !assert.NoError(t, err) {
+			return 0
+		}
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, 401, send("DELETE", "/dashboard/api-keys/k1/signing-secret", false), "unsigned dashboard request")
+	assert.Equal(t, 200, send("DELETE", "/dashboard/api-keys/k1/signing-secret", true))
+	assert.Equal(t, 401, send("GET", "/admin/stats", false), "unsigned admin request")
+}
+
+func TestSignRequest(t *testing.T) {
+	a := SignRequest("secret", 1760000000, "get", "/v3/route-search?from=a&to=b", nil)
+	assert.True(t, strings.HasPrefix(a, "v1="))
+	assert.Len(t, a, len("v1=")+64)
+	assert.Equal(t, a, SignRequest("secret", 1760000000, "GET", "/v3/route-search?from=a&to=b", []byte{}))
+	assert.NotEqual(t, a, SignRequest("secret", 1760000001, "GET", "/v3/route-search?from=a&to=b", nil))
+	assert.NotEqual(t, a, SignRequest("secret", 1760000000, "GET", "/v3/route-search?from=b&to=a", nil))
+	assert.NotEqual(t, a, SignRequest("other", 1760000000, "GET", "/v3/route-search?from=a&to=b", nil))
+}
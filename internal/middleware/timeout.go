@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultRequestTimeout bounds the database and Redis work of one request
+const DefaultRequestTimeout = 30 * time.Second
+
+// RequestTimeoutFromEnv reads the request deadline from REQUEST_TIMEOUT
+// (a Go duration, 0 disables it)
+func RequestTimeoutFromEnv() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("REQUEST_TIMEOUT")); err == nil && d >= 0 {
+		return d
+	}
+	return DefaultRequestTimeout
+}
+
+// RequestTimeout gives every request a context with a deadline, as
+// c.UserContext(): handlers pass it to their queries and Redis calls, which
+// are canceled once the deadline passes or the server shuts down
+// The context derives from the request, so logs and spans started from it
+// keep the request ID, partner and trace. A request that fails because its
+// deadline passed is answered 504
+func RequestTimeout(timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if timeout <= 0 {
+			c.SetUserContext(c.Context())
+			return c.Next()
+		}
+
+		ctx, cancel := context.WithTimeout(c.Context(), timeout)
+		defer cancel()
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return err
+		}
+		if err == nil && c.Response().StatusCode() < 500 {
+			return nil
+		}
+		logger.WarnContext(c.Context(), "Request deadline exceeded", "timeout", timeout.String(), "error", err)
+		return c.Status(fiber.StatusGatewayTimeout).JSON(fiber.Map{
+			"error":   "timeout",
+			"message": "The request took too long; retry later or narrow it",
+		})
+	}
+}
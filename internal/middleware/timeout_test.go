@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	app := fiber.New()
+	app.Use(RequestID())
+	app.Use(RequestTimeout(20 * time.Millisecond))
+	app.Get("/fast", func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		_, hasDeadline := ctx.Deadline()
+		// Values of the request stay reachable from its context
+		return c.JSON(fiber.Map{"deadline": hasDeadline, "request_id": ctx.Value("request_id")})
+	})
+	app.Get("/slow", func(c *fiber.Ctx) error {
+		<-c.UserContext().Done()
+		return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+	})
+
+	req := httptest.NewRequest("GET", "/fast", nil)
+	req.Header.Set(HeaderRequestID, "r1")
+	resp, err := app.Test(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.JSONEq(t, `{"deadline":true,"request_id":"r1"}`, string(body))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/slow", nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	body, _ = io.ReadAll(resp.Body)
+	assert.Equal(t, 504, resp.StatusCode)
+	assert.Contains(t, string(body), `"error":"timeout"`)
+}
+
+func TestRequestTimeoutDisabled(t *testing.T) {
+	app := fiber.New()
+	app.Use(RequestTimeout(0))
+	app.Get("/", func(c *fiber.Ctx) error {
+		_, hasDeadline := c.UserContext().Deadline()
+		assert.False(t, hasDeadline)
+		assert.NotEqual(t, context.Background(), c.UserContext())
+		return c.SendStatus(204)
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 204, resp.StatusCode)
+	}
+}
+
+func TestRequestTimeoutFromEnv(t *testing.T) {
+	t.Setenv("REQUEST_TIMEOUT", "")
+	assert.Equal(t, DefaultRequestTimeout, RequestTimeoutFromEnv())
+	t.Setenv("REQUEST_TIMEOUT", "5s")
+	assert.Equal(t, 5*time.Second, RequestTimeoutFromEnv())
+	t.Setenv("REQUEST_TIMEOUT", "0")
+	assert.Equal(t, time.Duration(0), RequestTimeoutFromEnv())
+	t.Setenv("REQUEST_TIMEOUT", "soon")
+	assert.Equal(t, DefaultRequestTimeout, RequestTimeoutFromEnv())
+}
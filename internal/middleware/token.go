@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/logging"
+)
+
+// Dashboard sessions and OAuth access tokens are HS256 JWTs
+// Each kind has its own audience so one is never accepted in place of the other
+
+var (
+	errInvalidToken = errors.New("invalid token")
+	errTokenExpired = errors.New("token has expired")
+)
+
+// tokenHeader is the fixed JOSE header of the tokens PassBi issues
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// tokenClaims are the JWT claims PassBi tokens carry
+type tokenClaims struct {
+	Subject  string `json:"sub"` // partner ID
+	Audience string `json:"aud"`
+	IssuedAt int64  `json:"iat"`
+	Expires  int64  `json:"exp"`
+	ClientID string `json:"client_id,omitempty"` // OAuth client (api_key ID)
+	Scope    string `json:"scope,omitempty"`     // space-separated granted scopes
+	// Impersonation is the impersonation ID of an admin's impersonation token
+	Impersonation string `json:"imp,omitempty"`
+	User          string `json:"uid,omitempty"` // dashboard user of a session
+}
+
+// signToken encodes and signs the claims as a compact JWT
+func signToken(secret []byte, claims tokenClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + tokenSignature(secret, unsigned), nil
+}
+
+// parseToken verifies a token for the given audience and returns its claims
+// Only the header signToken writes is accepted, so "alg":"none" or
+// algorithm-confusion tokens are rejected before the claims are read
+func parseToken(secret []byte, token, audience string, now time.Time) (*tokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return nil, errInvalidToken
+	}
+
+	expected := tokenSignature(secret, parts[0]+"."+parts[1])
+	if !hmac.Equal([]byte(parts[2]), []byte(expected)) {
+		return nil, errInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errInvalidToken
+	}
+
+	var claims tokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errInvalidToken
+	}
+	if claims.Audience != audience || claims.Subject == "" {
+		return nil, errInvalidToken
+	}
+	if now.Unix() >= claims.Expires {
+		return nil, errTokenExpired
+	}
+
+	return &claims, nil
+}
+
+// tokenSignature is the base64url HMAC-SHA256 of the signing input
+func tokenSignature(secret []byte, unsigned string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// isJWT reports whether a bearer credential looks like a JWT rather than a key
+func isJWT(credential string) bool {
+	return strings.Count(credential, ".") == 2 && strings.HasPrefix(credential, "eyJ")
+}
+
+// tokenSecret reads a signing secret from the environment
+// Without it a random secret is used, so tokens stop working when the process
+// restarts and are not accepted by other instances
+func tokenSecret(env string) []byte {
+	if secret := os.Getenv(env); secret != "" {
+		return []byte(secret)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		logging.Fatal(logger, "Failed to generate token secret", "env", env, "error", err)
+	}
+	logger.Warn("Token secret is not set; tokens will not survive a restart", "env", env)
+	return secret
+}
+
+// tokenTTL reads a token lifetime from the environment
+func tokenTTL(env string, def time.Duration) time.Duration {
+	value := os.Getenv(env)
+	if value == "" {
+		return def
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		logger.Warn("Invalid duration, using the default", "env", env, "value", value, "default", def.String())
+		return def
+	}
+	return ttl
+}
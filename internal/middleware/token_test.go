@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenRoundTrip(t *testing.T) {
+	secret := []byte("test-secret")
+	now := time.Unix(1760000000, 0)
+
+	token, err := signToken(secret, tokenClaims{
+		Subject: "partner-1", Audience: sessionAudience, IssuedAt: now.Unix(), Expires: now.Add(time.Minute).Unix(),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	claims, err := parseToken(secret, token, sessionAudience, now.Add(30*time.Second))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "partner-1", claims.Subject)
+	}
+
+	_, err = parseToken(secret, token, sessionAudience, now.Add(time.Minute))
+	assert.ErrorIs(t, err, errTokenExpired)
+
+	_, err = parseToken([]byte("other-secret"), token, sessionAudience, now)
+	assert.ErrorIs(t, err, errInvalidToken)
+}
+
+func TestTokenRejectsForgedTokens(t *testing.T) {
+	secret := []byte("test-secret")
+	now := time.Unix(1760000000, 0)
+
+	// Another audience, e.g. a token minted for a different service
+	token, _ := signToken(secret, tokenClaims{
+		Subject: "partner-1", Audience: "api", IssuedAt: now.Unix(), Expires: now.Add(time.Minute).Unix(),
+	})
+	_, err := parseToken(secret, token, sessionAudience, now)
+	assert.ErrorIs(t, err, errInvalidToken)
+
+	// Claims swapped under a valid signature
+	token, _ = signToken(secret, tokenClaims{
+		Subject: "partner-1", Audience: sessionAudience, IssuedAt: now.Unix(), Expires: now.Add(time.Minute).Unix(),
+	})
+	parts := strings.Split(token, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"partner-2","aud":"dashboard","iat":1760000000,"exp":1860000000}`))
+	_, err = parseToken(secret, parts[0]+"."+forged+"."+parts[2], sessionAudience, now)
+	assert.ErrorIs(t, err, errInvalidToken)
+
+	// Unsigned token
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	_, err = parseToken(secret, none+"."+parts[1]+".", sessionAudience, now)
+	assert.ErrorIs(t, err, errInvalidToken)
+
+	_, err = parseToken(secret, "pk_live_abc", sessionAudience, now)
+	assert.ErrorIs(t, err, errInvalidToken)
+}
+
+func TestTokenAudiences(t *testing.T) {
+	now := time.Now()
+
+	// A dashboard session is not an API access token, and vice versa
+	session, _, err := IssueSession("partner-1", "user-1", now)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = parseAccessToken(session)
+	assert.ErrorIs(t, err, errInvalidToken)
+
+	access, _, err := IssueAccessToken("partner-1", "client-1", []string{"read:routes"}, now)
+	if !assert.NoError(t, err) {
+		return
+	}
+	claims, err := parseAccessToken(access)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "client-1", claims.ClientID)
+		assert.Equal(t, "read:routes", claims.Scope)
+	}
+	_, err = parseToken(sessionSecret, access, sessionAudience, now)
+	assert.ErrorIs(t, err, errInvalidToken)
+
+	assert.True(t, isJWT(access))
+	assert.False(t, isJWT("pk_live_abc.def.ghi"))
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/passbi/passbi_core/internal/tracing"
+)
+
+// Tracing starts a server span for every request when tracing is enabled
+// The span joins the caller's trace when a traceparent header is sent and is
+// the parent of the database, Redis and routing spans of the request. The
+// trace ID is returned in the traceresponse header
+func Tracing() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !tracing.Enabled() {
+			return c.Next()
+		}
+
+		span := tracing.StartServer(c.Get("traceparent"), c.Method()+" "+c.Path(),
+			tracing.String("http.request.method", c.Method()),
+			tracing.String("url.path", c.Path()),
+		)
+		if span == nil {
+			return c.Next()
+		}
+		defer span.End()
+
+		tracing.BindRequest(c.Context(), span)
+		c.SetUserContext(tracing.ContextWithSpan(c.UserContext(), span))
+		c.Set("traceresponse", span.Traceparent())
+
+		err := c.Next()
+
+		// The matched route is only known once the request has been routed
+		route := c.Route().Path
+		span.SetName(c.Method() + " " + route)
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			var fe *fiber.Error
+			if errors.As(err, &fe) {
+				status = fe.Code
+			}
+			span.RecordError(err)
+		} else if status >= 500 {
+			span.Fail(fmt.Sprintf("HTTP %d", status))
+		}
+
+		span.SetAttributes(
+			tracing.String("http.route", route),
+			tracing.Int("http.response.status_code", status),
+			tracing.String("request_id", GetRequestID(c)),
+		)
+		if partner, ok := c.Locals("partner").(*PartnerContext); ok {
+			span.SetAttributes(tracing.String("passbi.partner_id", partner.PartnerID))
+		}
+		if hit, ok := c.Locals("cache_hit").(bool); ok {
+			span.SetAttributes(tracing.Bool("passbi.cache_hit", hit))
+		}
+		return err
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/passbi/passbi_core/internal/tracing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracingJoinsCallerTrace(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer collector.Close()
+
+	tracing.Init(&tracing.Config{Endpoint: collector.URL, SampleRatio: 1, BatchInterval: time.Hour})
+	defer tracing.Close()
+
+	var handlerSpan *tracing.Span
+	app := fiber.New()
+	app.Use(Tracing())
+	app.Get("/v2/stops/:id", func(c *fiber.Ctx) error {
+		handlerSpan = tracing.FromContext(c.Context())
+		return c.SendString("ok")
+	})
+
+	req := httptest.NewRequest("GET", "/v2/stops/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := app.Test(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", handlerSpan.TraceID())
+	assert.True(t, strings.HasPrefix(resp.Header.Get("traceresponse"), "00-4bf92f3577b34da6a3ce929d0e0e4736-"))
+
+	// Callers that opted out of sampling are not traced
+	req = httptest.NewRequest("GET", "/v2/stops/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	resp, err = app.Test(req)
+	if assert.NoError(t, err) {
+		assert.Nil(t, handlerSpan)
+		assert.Empty(t, resp.Header.Get("traceresponse"))
+	}
+}
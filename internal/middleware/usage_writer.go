@@ -0,0 +1,339 @@
+package middleware
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/metrics"
+)
+
+// UsageWriterConfig sizes the usage_log write buffer
+type UsageWriterConfig struct {
+	Buffer       int           // requests held in memory waiting to be written
+	BatchSize    int           // requests written per COPY
+	FlushEvery   time.Duration // longest a request waits in the buffer
+	EnqueueWait  time.Duration // how long a request blocks on a full buffer before its log is dropped
+	WriteTimeout time.Duration // deadline of one batch
+}
+
+// DefaultUsageWriterConfig buffers 10000 requests, written every second or
+// by 500
+func DefaultUsageWriterConfig() UsageWriterConfig {
+	return UsageWriterConfig{
+		Buffer:       10000,
+		BatchSize:    500,
+		FlushEvery:   time.Second,
+		EnqueueWait:  50 * time.Millisecond,
+		WriteTimeout: 10 * time.Second,
+	}
+}
+
+// UsageWriterConfigFromEnv returns the defaults overridden by USAGE_LOG_*
+// variables
+func UsageWriterConfigFromEnv() UsageWriterConfig {
+	cfg := DefaultUsageWriterConfig()
+	if n, err := strconv.Atoi(os.Getenv("USAGE_LOG_BUFFER")); err == nil && n > 0 {
+		cfg.Buffer = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("USAGE_LOG_BATCH")); err == nil && n > 0 {
+		cfg.BatchSize = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("USAGE_LOG_FLUSH")); err == nil && d > 0 {
+		cfg.FlushEvery = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("USAGE_LOG_ENQUEUE_WAIT")); err == nil && d >= 0 {
+		cfg.EnqueueWait = d
+	}
+	return cfg
+}
+
+var (
+	usageQueued  atomic.Int64
+	usageWritten atomic.Int64
+	usageDropped atomic.Int64 // buffer full
+	usageFailed  atomic.Int64 // batch write failed
+	usagePending atomic.Int64
+)
+
+func init() {
+	metrics.Register(func(w *metrics.Writer) {
+		w.Counter("passbi_usage_log_queued_total", "Requests queued for usage_log", float64(usageQueued.Load()))
+		w.Counter("passbi_usage_log_written_total", "Requests written to usage_log", float64(usageWritten.Load()))
+		w.Counter("passbi_usage_log_dropped_total", "Requests not logged because the usage_log buffer was full", float64(usageDropped.Load()))
+		w.Counter("passbi_usage_log_failed_total", "Requests lost in usage_log batches that failed to write", float64(usageFailed.Load()))
+		w.Gauge("passbi_usage_log_pending", "Requests waiting in the usage_log buffer", float64(usagePending.Load()))
+	})
+}
+
+// UsageWriter writes request logs to usage_log, and their counts to
+// quota_usage, in batches from a bounded buffer
+// A request blocks for at most EnqueueWait when the buffer is full, so a slow
+// database slows the API down a little before logs are dropped
+type UsageWriter struct {
+	db    *pgxpool.Pool
+	cfg   UsageWriterConfig
+	queue chan *RequestLog
+
+	mu     sync.RWMutex // held for reading while enqueuing, so Close never races a send
+	closed bool
+	done   chan struct{}
+}
+
+// NewUsageWriter starts a writer; Close it before closing the pool
+func NewUsageWriter(db *pgxpool.Pool, cfg UsageWriterConfig) *UsageWriter {
+	w := &UsageWriter{
+		db:    db,
+		cfg:   cfg,
+		queue: make(chan *RequestLog, cfg.Buffer),
+		done:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Log queues a request log; it reports false when the log was dropped
+func (w *UsageWriter) Log(r *RequestLog) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		usageDropped.Add(1)
+		return false
+	}
+
+	select {
+	case w.queue <- r:
+	default:
+		if !w.wait(r) {
+			usageDropped.Add(1)
+			return false
+		}
+	}
+	usageQueued.Add(1)
+	usagePending.Add(1)
+	return true
+}
+
+// wait blocks until the buffer has room for r or EnqueueWait elapses
+func (w *UsageWriter) wait(r *RequestLog) bool {
+	if w.cfg.EnqueueWait <= 0 {
+		return false
+	}
+	t := time.NewTimer(w.cfg.EnqueueWait)
+	defer t.Stop()
+	select {
+	case w.queue <- r:
+		return true
+	case <-t.C:
+		return false
+	}
+}
+
+// Close stops accepting logs and writes those buffered, until ctx is done
+func (w *UsageWriter) Close(ctx context.Context) error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *UsageWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.cfg.FlushEvery)
+	defer ticker.Stop()
+
+	batch := make([]*RequestLog, 0, w.cfg.BatchSize)
+	for {
+		select {
+		case r, ok := <-w.queue:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			batch = append(batch, r)
+			if len(batch) < w.cfg.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+
+		w.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+// flush writes a batch in one transaction, so quota_usage never counts
+// requests missing from usage_log
+func (w *UsageWriter) flush(batch []*RequestLog) {
+	if len(batch) == 0 {
+		return
+	}
+	usagePending.Add(-int64(len(batch)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.cfg.WriteTimeout)
+	defer cancel()
+
+	if err := writeUsage(ctx, w.db, batch); err != nil {
+		usageFailed.Add(int64(len(batch)))
+		logger.ErrorContext(ctx, "Failed to write usage log batch", "requests", len(batch), "error", err)
+		return
+	}
+	usageWritten.Add(int64(len(batch)))
+}
+
+var usageColumns = []string{
+	"partner_id", "api_key_id", "endpoint", "method", "response_time_ms", "response_status",
+	"from_location", "to_location", "cache_hit", "ip_address", "user_agent", "timestamp",
+	"request_id", "sandbox", "stop_id",
+}
+
+func writeUsage(ctx context.Context, db *pgxpool.Pool, batch []*RequestLog) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"usage_log"}, usageColumns,
+		pgx.CopyFromSlice(len(batch), func(i int) ([]any, error) {
+			return usageRow(batch[i]), nil
+		}))
+	if err != nil {
+		return err
+	}
+
+	quota := &pgx.Batch{}
+	for _, q := range aggregateQuota(batch) {
+		quota.Queue(`
+			INSERT INTO quota_usage (
+				partner_id,
+				period_type,
+				period_start,
+				period_end,
+				requests_count,
+				successful_requests,
+				failed_requests
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (partner_id, period_type, period_start)
+			DO UPDATE SET
+				requests_count = quota_usage.requests_count + $5,
+				successful_requests = quota_usage.successful_requests + $6,
+				failed_requests = quota_usage.failed_requests + $7,
+				updated_at = NOW()
+		`, q.PartnerID, q.PeriodType, q.PeriodStart, q.PeriodEnd, q.Requests, q.Successful, q.Failed)
+	}
+	if err := tx.SendBatch(ctx, quota).Close(); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// usageRow is the usage_log row of a request; empty request and stop IDs are
+// stored as NULL
+func usageRow(r *RequestLog) []any {
+	return []any{
+		r.PartnerID,
+		r.APIKeyID,
+		r.Endpoint,
+		r.Method,
+		r.ResponseTimeMs,
+		r.ResponseStatus,
+		r.FromLocation.point(),
+		r.ToLocation.point(),
+		r.CacheHit,
+		inet(r.IPAddress),
+		r.UserAgent,
+		r.Timestamp,
+		nullIfEmpty(r.RequestID),
+		r.Sandbox,
+		nullIfEmpty(r.StopID),
+	}
+}
+
+// inet converts an address for COPY, which only takes binary values
+func inet(ip string) any {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil
+	}
+	return netip.PrefixFrom(addr, addr.BitLen())
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// quotaDelta is what a batch adds to one quota_usage row
+type quotaDelta struct {
+	PartnerID   string
+	PeriodType  string // daily or monthly
+	PeriodStart string
+	PeriodEnd   string
+	Requests    int
+	Successful  int
+	Failed      int
+}
+
+// aggregateQuota sums the requests of a batch per partner, day and month,
+// in the order partners first appear; sandbox requests are not billed
+func aggregateQuota(batch []*RequestLog) []*quotaDelta {
+	var deltas []*quotaDelta
+	index := map[[3]string]*quotaDelta{}
+
+	add := func(partnerID, periodType string, start, end time.Time, success bool) {
+		key := [3]string{partnerID, periodType, start.Format("2006-01-02")}
+		d, ok := index[key]
+		if !ok {
+			d = &quotaDelta{
+				PartnerID:   partnerID,
+				PeriodType:  periodType,
+				PeriodStart: key[2],
+				PeriodEnd:   end.Format("2006-01-02"),
+			}
+			index[key] = d
+			deltas = append(deltas, d)
+		}
+		d.Requests++
+		if success {
+			d.Successful++
+		} else {
+			d.Failed++
+		}
+	}
+
+	for _, r := range batch {
+		if r.Sandbox {
+			continue
+		}
+		success := r.ResponseStatus >= 200 && r.ResponseStatus < 300
+		day := r.Timestamp
+		add(r.PartnerID, "daily", day, day, success)
+
+		firstDayOfMonth := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+		add(r.PartnerID, "monthly", firstDayOfMonth, firstDayOfMonth.AddDate(0, 1, -1), success)
+	}
+	return deltas
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregateQuota(t *testing.T) {
+	day := time.Date(2024, 3, 31, 23, 0, 0, 0, time.UTC)
+	batch := []*RequestLog{
+		{PartnerID: "a", ResponseStatus: 200, Timestamp: day},
+		{PartnerID: "b", ResponseStatus: 500, Timestamp: day},
+		{PartnerID: "a", ResponseStatus: 404, Timestamp: day},
+		{PartnerID: "a", ResponseStatus: 200, Timestamp: day.Add(2 * time.Hour)},
+		{PartnerID: "a", ResponseStatus: 200, Timestamp: day, Sandbox: true},
+	}
+
+	deltas := aggregateQuota(batch)
+	if !assert.Len(t, deltas, 6) {
+		return
+	}
+	assert.Equal(t, quotaDelta{PartnerID: "a", PeriodType: "daily", PeriodStart: "2024-03-31", PeriodEnd: "2024-03-31", Requests: 2, Successful: 1, Failed: 1}, *deltas[0])
+	assert.Equal(t, quotaDelta{PartnerID: "a", PeriodType: "monthly", PeriodStart: "2024-03-01", PeriodEnd: "2024-03-31", Requests: 2, Successful: 1, Failed: 1}, *deltas[1])
+	assert.Equal(t, "b", deltas[2].PartnerID)
+	assert.Equal(t, 1, deltas[2].Failed)
+	assert.Equal(t, quotaDelta{PartnerID: "a", PeriodType: "daily", PeriodStart: "2024-04-01", PeriodEnd: "2024-04-01", Requests: 1, Successful: 1}, *deltas[4])
+	assert.Equal(t, "2024-04-30", deltas[5].PeriodEnd)
+}
+
+func TestUsageRow(t *testing.T) {
+	row := usageRow(&RequestLog{PartnerID: "a", IPAddress: "203.0.113.7", FromLocation: &Location{Lat: 14.7, Lon: -17.4}})
+	assert.Len(t, row, len(usageColumns))
+	assert.Equal(t, netip.MustParsePrefix("203.0.113.7/32"), row[9])
+	assert.Nil(t, row[12], "empty request_id")
+	assert.Nil(t, row[14], "empty stop_id")
+
+	assert.Nil(t, usageRow(&RequestLog{IPAddress: "unknown"})[9])
+}
+
+func TestUsageWriterBackpressure(t *testing.T) {
+	w := &UsageWriter{
+		cfg:   UsageWriterConfig{EnqueueWait: 20 * time.Millisecond},
+		queue: make(chan *RequestLog, 1),
+		done:  make(chan struct{}),
+	}
+	dropped := usageDropped.Load()
+
+	assert.True(t, w.Log(&RequestLog{}))
+
+	// A full buffer holds the request back until there is room
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		<-w.queue
+	}()
+	assert.True(t, w.Log(&RequestLog{}))
+
+	start := time.Now()
+	assert.False(t, w.Log(&RequestLog{}))
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	assert.Equal(t, dropped+1, usageDropped.Load())
+
+	// Nothing is accepted once closing
+	close(w.done)
+	assert.NoError(t, w.Close(context.Background()))
+	assert.False(t, w.Log(&RequestLog{}))
+}
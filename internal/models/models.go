@@ -49,6 +49,7 @@ type Node struct {
 	StopName  string
 	RouteID   string
 	RouteName string
+	AgencyID  string
 	Mode      TransitMode
 	Lat       float64
 	Lon       float64
@@ -104,7 +105,10 @@ type Step struct {
 	Stops         []StopInfo  `json:"stops,omitempty"`
 	DepartureTime string      `json:"departure_time,omitempty"`
 	ArrivalTime   string      `json:"arrival_time,omitempty"`
+	DelaySeconds  *int        `json:"delay_seconds,omitempty"` // realtime delay of the trip expected to serve a ride
+	Crowding      *Crowding   `json:"crowding,omitempty"`
 	AgencyName    string      `json:"agency_name,omitempty"`
+	Instruction   string      `json:"instruction,omitempty"`
 }
 
 // GTFS data structures for import
@@ -142,6 +146,15 @@ type GTFSTrip struct {
 	TripID    string
 	Headsign  string
 	Direction int
+	ShapeID   string
+}
+
+// GTFSShapePoint represents a point of a shape from shapes.txt
+type GTFSShapePoint struct {
+	ShapeID  string
+	Lat      float64
+	Lon      float64
+	Sequence int
 }
 
 // GTFSStopTime represents a stop time from stop_times.txt
@@ -174,6 +187,17 @@ type GTFSCalendarDate struct {
 	ExceptionType int    // 1=service added, 2=service removed
 }
 
+// GTFSTranslation represents a row from translations.txt
+// Either RecordID or FieldValue identifies the translated record
+type GTFSTranslation struct {
+	TableName   string // stops, routes, ...
+	FieldName   string // stop_name, route_short_name, ...
+	Language    string
+	Translation string
+	RecordID    string
+	FieldValue  string
+}
+
 // ImportLog represents a GTFS import operation log
 type ImportLog struct {
 	ID          int64
@@ -187,3 +211,139 @@ type ImportLog struct {
 	EdgesCount  int
 	ErrorMsg    string
 }
+
+// AlertSeverity represents how disruptive a service alert is
+type AlertSeverity string
+
+const (
+	SeverityInfo    AlertSeverity = "info"
+	SeverityWarning AlertSeverity = "warning"
+	SeveritySevere  AlertSeverity = "severe"
+)
+
+// AlertEntity scopes an alert to an agency, a route, a stop, or a stop on a route
+type AlertEntity struct {
+	AgencyID string `json:"agency_id,omitempty"`
+	RouteID  string `json:"route_id,omitempty"`
+	StopID   string `json:"stop_id,omitempty"`
+}
+
+// ServiceAlert represents a rider-facing disruption notice
+// Cause and Effect hold GTFS-Realtime enum names (e.g. STRIKE, DETOUR)
+type ServiceAlert struct {
+	ID          int64         `json:"id" fields:"always"`
+	Title       string        `json:"title"`
+	Description string        `json:"description,omitempty"`
+	URL         string        `json:"url,omitempty"`
+	Severity    AlertSeverity `json:"severity"`
+	Cause       string        `json:"cause"`
+	Effect      string        `json:"effect"`
+	StartsAt    time.Time     `json:"starts_at"`
+	EndsAt      *time.Time    `json:"ends_at,omitempty"`
+	Entities    []AlertEntity `json:"entities"`
+	Source      string        `json:"source"`                // manual, headway or disruption
+	Provisional bool          `json:"provisional,omitempty"` // raised automatically, not yet confirmed by staff
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+// IsActive returns true if the alert's time window contains t
+func (a *ServiceAlert) IsActive(t time.Time) bool {
+	if t.Before(a.StartsAt) {
+		return false
+	}
+	return a.EndsAt == nil || t.Before(*a.EndsAt)
+}
+
+// VehiclePosition is a GPS fix of a vehicle in service
+type VehiclePosition struct {
+	VehicleID string    `json:"vehicle_id"`
+	TripID    string    `json:"trip_id,omitempty"`
+	RouteID   string    `json:"route_id,omitempty"`
+	AgencyID  string    `json:"agency_id,omitempty"`
+	Lat       float64   `json:"lat"`
+	Lon       float64   `json:"lon"`
+	Bearing   *float64  `json:"bearing,omitempty"` // degrees clockwise from north
+	Speed     *float64  `json:"speed,omitempty"`   // meters per second
+	StopID    string    `json:"stop_id,omitempty"` // current or next stop
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// OccupancyLevel is how full a vehicle is, named after GTFS-Realtime's
+// OccupancyStatus from the emptiest to the fullest
+type OccupancyLevel string
+
+const (
+	OccupancyEmpty            OccupancyLevel = "empty"
+	OccupancyManySeats        OccupancyLevel = "many_seats_available"
+	OccupancyFewSeats         OccupancyLevel = "few_seats_available"
+	OccupancyStandingRoomOnly OccupancyLevel = "standing_room_only"
+	OccupancyCrushed          OccupancyLevel = "crushed_standing_room_only"
+	OccupancyFull             OccupancyLevel = "full"
+)
+
+// OccupancyReport is a driver's or rider's report of how full a vehicle is
+type OccupancyReport struct {
+	AgencyID  string         `json:"agency_id,omitempty"`
+	TripID    string         `json:"trip_id,omitempty"`
+	RouteID   string         `json:"route_id,omitempty"`
+	VehicleID string         `json:"vehicle_id,omitempty"`
+	StopID    string         `json:"stop_id,omitempty"` // where the report was made
+	Level     OccupancyLevel `json:"level"`
+	Reporter  string         `json:"reporter,omitempty"` // "driver" or "rider"
+	Timestamp time.Time      `json:"timestamp"`
+}
+
+// Crowding is how full a departure or ride is expected to be
+type Crowding struct {
+	Level OccupancyLevel `json:"level"`
+	// Source is "trip" for today's reports on the trip itself, "route" for
+	// the last reports on the route's vehicles and "typical" for past reports
+	// on the route at that time of day
+	Source  string `json:"source"`
+	Reports int    `json:"reports"`
+}
+
+// FeedbackKind is the type of data problem a rider or partner reports
+type FeedbackKind string
+
+const (
+	FeedbackWrongStopLocation FeedbackKind = "wrong_stop_location"
+	FeedbackMissingStop       FeedbackKind = "missing_stop"
+	FeedbackMissingLine       FeedbackKind = "missing_line"
+	FeedbackIncorrectTime     FeedbackKind = "incorrect_time"
+	FeedbackOther             FeedbackKind = "other"
+)
+
+// FeedbackStatus tracks a report through the data team's triage
+type FeedbackStatus string
+
+const (
+	FeedbackNew      FeedbackStatus = "new"
+	FeedbackTriaged  FeedbackStatus = "triaged"
+	FeedbackResolved FeedbackStatus = "resolved"
+	FeedbackRejected FeedbackStatus = "rejected"
+)
+
+// FeedbackReport is a crowdsourced report of wrong or missing transit data
+// Lat/Lon is where the reporter says the problem is (e.g. the real stop
+// position); NearestStopID and distances are computed when it is stored
+type FeedbackReport struct {
+	ID                   int64          `json:"id" fields:"always"`
+	Kind                 FeedbackKind   `json:"kind"`
+	Description          string         `json:"description"`
+	StopID               string         `json:"stop_id,omitempty"`
+	RouteID              string         `json:"route_id,omitempty"`
+	TripID               string         `json:"trip_id,omitempty"`
+	Lat                  *float64       `json:"lat,omitempty"`
+	Lon                  *float64       `json:"lon,omitempty"`
+	StopDistanceM        *int           `json:"stop_distance_meters,omitempty"`
+	NearestStopID        string         `json:"nearest_stop_id,omitempty"`
+	NearestStopDistanceM *int           `json:"nearest_stop_distance_meters,omitempty"`
+	Contact              string         `json:"contact,omitempty"`
+	PartnerID            string         `json:"partner_id,omitempty"`
+	Status               FeedbackStatus `json:"status"`
+	TriageNote           string         `json:"triage_note,omitempty"`
+	CreatedAt            time.Time      `json:"created_at"`
+	UpdatedAt            time.Time      `json:"updated_at"`
+}
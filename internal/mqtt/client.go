@@ -0,0 +1,336 @@
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types (upper nibble of the fixed header)
+const (
+	packetConnect    = 0x10
+	packetConnack    = 0x20
+	packetPublish    = 0x30
+	packetPuback     = 0x40
+	packetPingreq    = 0xC0
+	packetPingresp   = 0xD0
+	packetDisconnect = 0xE0
+)
+
+// maxRemainingLength is the largest packet body MQTT can frame
+const maxRemainingLength = 268435455
+
+// ErrClosed is returned when publishing on a closed client
+var ErrClosed = errors.New("mqtt: client closed")
+
+// Client is a minimal MQTT 3.1.1 publisher
+// It supports QoS 0 and 1 and retained messages; it never subscribes, so the
+// broker only ever sends acknowledgements, which are read synchronously
+type Client struct {
+	cfg *Config
+
+	mu       sync.Mutex
+	conn     net.Conn
+	r        *bufio.Reader
+	packetID uint16
+	closed   bool
+	done     chan struct{}
+}
+
+// NewClient creates a client; the connection is opened lazily on first publish
+func NewClient(cfg *Config) *Client {
+	c := &Client{cfg: cfg, done: make(chan struct{})}
+	go c.keepAlive()
+	return c
+}
+
+// Publish sends a message, reconnecting first if the connection was lost
+func (c *Client) Publish(topic string, payload []byte, qos byte, retain bool) error {
+	if qos > 1 {
+		return fmt.Errorf("mqtt: unsupported QoS %d", qos)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+	if err := c.ensureConnected(); err != nil {
+		return err
+	}
+
+	err := c.publish(topic, payload, qos, retain)
+	if err != nil {
+		c.drop()
+	}
+	return err
+}
+
+// Close sends DISCONNECT and closes the connection
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+
+	if c.conn == nil {
+		return nil
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(c.cfg.Timeout))
+	_, err := c.conn.Write([]byte{packetDisconnect, 0})
+	c.drop()
+	return err
+}
+
+func (c *Client) publish(topic string, payload []byte, qos byte, retain bool) error {
+	header := byte(packetPublish) | qos<<1
+	if retain {
+		header |= 1
+	}
+
+	body := appendString(nil, topic)
+	var id uint16
+	if qos > 0 {
+		id = c.nextPacketID()
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	body = append(body, payload...)
+
+	if err := c.write(header, body); err != nil {
+		return err
+	}
+	if qos == 0 {
+		return nil
+	}
+
+	ack, err := c.read()
+	if err != nil {
+		return err
+	}
+	if ack.kind != packetPuback || len(ack.body) < 2 || binary.BigEndian.Uint16(ack.body) != id {
+		return fmt.Errorf("mqtt: unexpected packet 0x%02x waiting for PUBACK", ack.kind)
+	}
+	return nil
+}
+
+// ensureConnected dials and performs the CONNECT handshake if needed
+func (c *Client) ensureConnected() error {
+	if c.conn != nil {
+		return nil
+	}
+
+	u, err := url.Parse(c.cfg.BrokerURL)
+	if err != nil {
+		return fmt.Errorf("mqtt: invalid broker URL: %w", err)
+	}
+
+	dialer := &net.Dialer{Timeout: c.cfg.Timeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		conn, err = dialer.Dial("tcp", hostPort(u, "1883"))
+	case "ssl", "tls", "mqtts":
+		conn, err = tls.DialWithDialer(dialer, "tcp", hostPort(u, "8883"), &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			ServerName: u.Hostname(),
+		})
+	default:
+		return fmt.Errorf("mqtt: unsupported broker scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return fmt.Errorf("mqtt: failed to connect to broker: %w", err)
+	}
+
+	c.conn = conn
+	c.r = bufio.NewReader(conn)
+
+	if err := c.connect(); err != nil {
+		c.drop()
+		return err
+	}
+	return nil
+}
+
+func (c *Client) connect() error {
+	flags := byte(0x02) // clean session
+	if c.cfg.Username != "" {
+		flags |= 0x80
+		if c.cfg.Password != "" {
+			flags |= 0x40
+		}
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags) // protocol level 4 = MQTT 3.1.1
+	body = binary.BigEndian.AppendUint16(body, uint16(c.cfg.KeepAlive/time.Second))
+	body = appendString(body, c.cfg.ClientID)
+	if c.cfg.Username != "" {
+		body = appendString(body, c.cfg.Username)
+		if c.cfg.Password != "" {
+			body = appendString(body, c.cfg.Password)
+		}
+	}
+
+	if err := c.write(packetConnect, body); err != nil {
+		return err
+	}
+
+	ack, err := c.read()
+	if err != nil {
+		return err
+	}
+	if ack.kind != packetConnack || len(ack.body) < 2 {
+		return fmt.Errorf("mqtt: unexpected packet 0x%02x waiting for CONNACK", ack.kind)
+	}
+	if code := ack.body[1]; code != 0 {
+		return fmt.Errorf("mqtt: connection refused (code %d)", code)
+	}
+	return nil
+}
+
+// keepAlive pings the broker so idle connections are not dropped
+func (c *Client) keepAlive() {
+	interval := c.cfg.KeepAlive / 2
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			if c.conn != nil {
+				if err := c.ping(); err != nil {
+					c.drop()
+				}
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+func (c *Client) ping() error {
+	if err := c.write(packetPingreq, nil); err != nil {
+		return err
+	}
+	resp, err := c.read()
+	if err != nil {
+		return err
+	}
+	if resp.kind != packetPingresp {
+		return fmt.Errorf("mqtt: unexpected packet 0x%02x waiting for PINGRESP", resp.kind)
+	}
+	return nil
+}
+
+func (c *Client) nextPacketID() uint16 {
+	c.packetID++
+	if c.packetID == 0 {
+		c.packetID = 1
+	}
+	return c.packetID
+}
+
+// drop closes a broken connection so the next publish reconnects
+func (c *Client) drop() {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.conn = nil
+	c.r = nil
+}
+
+func (c *Client) write(header byte, body []byte) error {
+	if len(body) > maxRemainingLength {
+		return fmt.Errorf("mqtt: packet too large (%d bytes)", len(body))
+	}
+
+	packet := make([]byte, 0, len(body)+5)
+	packet = append(packet, header)
+	packet = appendRemainingLength(packet, len(body))
+	packet = append(packet, body...)
+
+	c.conn.SetWriteDeadline(time.Now().Add(c.cfg.Timeout))
+	_, err := c.conn.Write(packet)
+	return err
+}
+
+type packet struct {
+	kind byte
+	body []byte
+}
+
+func (c *Client) read() (packet, error) {
+	c.conn.SetReadDeadline(time.Now().Add(c.cfg.Timeout))
+
+	header, err := c.r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return packet{}, errors.New("mqtt: malformed remaining length")
+		}
+		multiplier *= 128
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return packet{}, err
+	}
+	return packet{kind: header & 0xf0, body: body}, nil
+}
+
+// appendRemainingLength encodes a packet length as MQTT's base-128 varint
+func appendRemainingLength(b []byte, n int) []byte {
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+// appendString encodes a length-prefixed UTF-8 string
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func hostPort(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
@@ -0,0 +1,101 @@
+package mqtt
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandTopic(t *testing.T) {
+	values := map[string]string{"route_id": "BRT/B1", "vehicle_id": "bus-7"}
+
+	assert.Equal(t, "passbi/vehicles/BRT_B1/bus-7", ExpandTopic("passbi/vehicles/{route_id}/{vehicle_id}", values))
+	assert.Equal(t, "stations/_/x", ExpandTopic("stations/{stop_id}/x", values))
+	assert.Equal(t, "plain/topic", ExpandTopic("plain/topic", values))
+}
+
+func TestAppendRemainingLength(t *testing.T) {
+	assert.Equal(t, []byte{0x00}, appendRemainingLength(nil, 0))
+	assert.Equal(t, []byte{0x7f}, appendRemainingLength(nil, 127))
+	assert.Equal(t, []byte{0x80, 0x01}, appendRemainingLength(nil, 128))
+	assert.Equal(t, []byte{0xff, 0xff, 0xff, 0x7f}, appendRemainingLength(nil, maxRemainingLength))
+}
+
+// fakeBroker accepts one connection, acknowledges CONNECT and QoS 1 PUBLISH,
+// and reports the received publish packets
+func fakeBroker(l net.Listener, published chan<- []byte) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	for {
+		header, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		length, multiplier := 0, 1
+		for {
+			b, _ := r.ReadByte()
+			length += int(b&0x7f) * multiplier
+			if b&0x80 == 0 {
+				break
+			}
+			multiplier *= 128
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return
+		}
+
+		switch header & 0xf0 {
+		case packetConnect:
+			conn.Write([]byte{packetConnack, 2, 0, 0})
+		case packetPublish:
+			if header&0x06 != 0 {
+				topicLen := int(body[0])<<8 | int(body[1])
+				id := body[2+topicLen : 4+topicLen]
+				conn.Write([]byte{packetPuback, 2, id[0], id[1]})
+			}
+			published <- append([]byte{header}, body...)
+		case packetDisconnect:
+			return
+		}
+	}
+}
+
+func TestClientPublish(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer l.Close()
+
+	published := make(chan []byte, 1)
+	go fakeBroker(l, published)
+
+	c := NewClient(&Config{
+		BrokerURL: "tcp://" + l.Addr().String(),
+		ClientID:  "test",
+		Timeout:   2 * time.Second,
+	})
+	defer c.Close()
+
+	assert.NoError(t, c.Publish("passbi/alerts/1", []byte(`{}`), 1, true))
+
+	select {
+	case pkt := <-published:
+		// PUBLISH, QoS 1, retain
+		assert.Equal(t, byte(0x33), pkt[0])
+		assert.Equal(t, "passbi/alerts/1", string(pkt[3:18]))
+		assert.Equal(t, `{}`, string(pkt[20:]))
+	case <-time.After(2 * time.Second):
+		t.Fatal("broker did not receive the publish")
+	}
+}
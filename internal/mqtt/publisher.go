@@ -0,0 +1,175 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/logging"
+	"github.com/passbi/passbi_core/internal/models"
+)
+
+var logger = logging.For("mqtt")
+
+var (
+	publisher     *Publisher
+	publisherOnce sync.Once
+)
+
+// Config holds MQTT broker and topic configuration
+// Topic templates accept {id}, {agency_id}, {route_id} and {vehicle_id} placeholders
+type Config struct {
+	BrokerURL     string
+	ClientID      string
+	Username      string
+	Password      string
+	QoS           byte
+	KeepAlive     time.Duration
+	Timeout       time.Duration
+	AlertTopic    string
+	PositionTopic string
+}
+
+// LoadConfigFromEnv loads MQTT configuration from environment variables
+func LoadConfigFromEnv() *Config {
+	qos, _ := strconv.Atoi(getEnv("MQTT_QOS", "1"))
+	keepAlive, _ := time.ParseDuration(getEnv("MQTT_KEEPALIVE", "60s"))
+	hostname, _ := os.Hostname()
+
+	return &Config{
+		BrokerURL:     getEnv("MQTT_BROKER_URL", ""),
+		ClientID:      getEnv("MQTT_CLIENT_ID", "passbi-"+hostname),
+		Username:      getEnv("MQTT_USERNAME", ""),
+		Password:      getEnv("MQTT_PASSWORD", ""),
+		QoS:           byte(qos),
+		KeepAlive:     keepAlive,
+		Timeout:       5 * time.Second,
+		AlertTopic:    getEnv("MQTT_TOPIC_ALERTS", "passbi/alerts/{id}"),
+		PositionTopic: getEnv("MQTT_TOPIC_POSITIONS", "passbi/vehicles/{route_id}/{vehicle_id}"),
+	}
+}
+
+// Publisher publishes alerts and vehicle positions to MQTT topics
+// A nil *Publisher is valid and publishes nothing, so callers need no checks
+// when MQTT is not configured
+type Publisher struct {
+	cfg    *Config
+	client *Client
+}
+
+// NewPublisher creates a publisher for the given configuration
+func NewPublisher(cfg *Config) *Publisher {
+	return &Publisher{cfg: cfg, client: NewClient(cfg)}
+}
+
+// GetPublisher returns the global publisher, or nil when MQTT_BROKER_URL is unset
+func GetPublisher() *Publisher {
+	publisherOnce.Do(func() {
+		cfg := LoadConfigFromEnv()
+		if cfg.BrokerURL == "" {
+			return
+		}
+		publisher = NewPublisher(cfg)
+		logger.Info("MQTT publishing enabled", "broker", cfg.BrokerURL)
+	})
+	return publisher
+}
+
+// Close disconnects the global publisher
+func Close() {
+	if publisher != nil {
+		publisher.client.Close()
+	}
+}
+
+// PublishAlert publishes an alert as a retained JSON message so displays that
+// subscribe later still receive it
+func (p *Publisher) PublishAlert(a *models.ServiceAlert) error {
+	if p == nil {
+		return nil
+	}
+
+	payload, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %w", err)
+	}
+
+	return p.client.Publish(p.alertTopic(a.ID), payload, p.cfg.QoS, true)
+}
+
+// ClearAlert removes a retained alert from the broker
+func (p *Publisher) ClearAlert(id int64) error {
+	if p == nil {
+		return nil
+	}
+
+	// An empty retained payload deletes the retained message
+	return p.client.Publish(p.alertTopic(id), nil, p.cfg.QoS, true)
+}
+
+// PublishPosition publishes a vehicle position as a retained JSON message
+func (p *Publisher) PublishPosition(pos *models.VehiclePosition) error {
+	if p == nil {
+		return nil
+	}
+
+	payload, err := json.Marshal(pos)
+	if err != nil {
+		return fmt.Errorf("failed to encode position: %w", err)
+	}
+
+	topic := ExpandTopic(p.cfg.PositionTopic, map[string]string{
+		"agency_id":  pos.AgencyID,
+		"route_id":   pos.RouteID,
+		"vehicle_id": pos.VehicleID,
+		"id":         pos.VehicleID,
+	})
+
+	return p.client.Publish(topic, payload, p.cfg.QoS, true)
+}
+
+func (p *Publisher) alertTopic(id int64) string {
+	return ExpandTopic(p.cfg.AlertTopic, map[string]string{"id": strconv.FormatInt(id, 10)})
+}
+
+// ExpandTopic fills {name} placeholders in a topic template
+// Values are sanitized so they cannot inject topic levels or wildcards;
+// missing values become "_"
+func ExpandTopic(template string, values map[string]string) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+
+		b.WriteString(template[:start])
+		b.WriteString(topicLevel(values[template[start+1:end]]))
+		template = template[end+1:]
+	}
+	b.WriteString(template)
+	return b.String()
+}
+
+func topicLevel(v string) string {
+	if v == "" {
+		return "_"
+	}
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(v)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,227 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// EventKeyExpiring is the webhook event sent before an API key expires
+const EventKeyExpiring = "api_key.expiring"
+
+// KeyExpiryReminders are the days before expiry partners are reminded at,
+// longest first; 0 is sent once the key has expired
+var KeyExpiryReminders = []int{14, 3, 0}
+
+// KeyExpiryEvent is the webhook body of an expiry reminder
+type KeyExpiryEvent struct {
+	Event     string    `json:"event"`
+	PartnerID string    `json:"partner_id"`
+	APIKeyID  string    `json:"api_key_id"`
+	KeyName   string    `json:"key_name"`
+	KeyPrefix string    `json:"key_prefix"`
+	ExpiresAt time.Time `json:"expires_at"`
+	DaysLeft  int       `json:"days_left"`
+	SentAt    time.Time `json:"sent_at"`
+}
+
+// expiringKey is an active key expiring within the first reminder
+type expiringKey struct {
+	ID, PartnerID, Name, Prefix, PartnerEmail string
+	ExpiresAt                                 time.Time
+	Sent                                      []int // reminders already sent for ExpiresAt
+}
+
+// DaysLeft is the number of days until expiresAt, rounded up; 0 once expired
+func DaysLeft(expiresAt, now time.Time) int {
+	left := expiresAt.Sub(now)
+	if left <= 0 {
+		return 0
+	}
+	return int(math.Ceil(left.Hours() / 24))
+}
+
+// dueReminder returns the reminder to send now for a key, if any
+// Only the most urgent reminder reached is sent, so a key created 2 days
+// before it expires gets the 3-day reminder but not the 14-day one; keys that
+// expired more than a day ago are not reminded
+func dueReminder(expiresAt, now time.Time, sent []int) (int, bool) {
+	left := expiresAt.Sub(now)
+	if left <= -24*time.Hour {
+		return 0, false
+	}
+
+	due := -1
+	for _, days := range KeyExpiryReminders {
+		if left <= time.Duration(days)*24*time.Hour {
+			due = days
+		}
+	}
+	if due < 0 {
+		return 0, false
+	}
+	for _, s := range sent {
+		if s <= due {
+			return 0, false
+		}
+	}
+	return due, true
+}
+
+// RunKeyExpiryReminders sends due expiry reminders now and every interval
+// until ctx is done; several instances may run it, each reminder is sent once
+func RunKeyExpiryReminders(ctx context.Context, db *pgxpool.Pool, interval time.Duration) {
+	mailer := NewMailer()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		sent, err := SendKeyExpiryReminders(ctx, db, mailer, time.Now())
+		if err != nil {
+			logger.ErrorContext(ctx, "Key expiry reminders failed", "error", err)
+		} else if sent > 0 {
+			logger.Info("Sent API key expiry reminders", "sent", sent)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SendKeyExpiryReminders notifies partners of their keys reaching a reminder
+// by webhook and email, with their quota notification settings; mailer may
+// be nil. It returns the number of reminders sent
+func SendKeyExpiryReminders(ctx context.Context, db *pgxpool.Pool, mailer *Mailer, now time.Time) (int, error) {
+	keys, err := loadExpiringKeys(ctx, db, now)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, k := range keys {
+		days, ok := dueReminder(k.ExpiresAt, now, k.Sent)
+		if !ok {
+			continue
+		}
+
+		// Claiming the reminder first keeps other instances from sending it
+		tag, err := db.Exec(ctx, `
+			INSERT INTO api_key_expiry_reminder (api_key_id, expires_at, days_before)
+			VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING
+		`, k.ID, k.ExpiresAt, days)
+		if err != nil {
+			return sent, fmt.Errorf("failed to record expiry reminder: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			continue
+		}
+
+		deliverKeyExpiry(ctx, db, mailer, k, DaysLeft(k.ExpiresAt, now))
+		sent++
+	}
+	return sent, nil
+}
+
+func loadExpiringKeys(ctx context.Context, db *pgxpool.Pool, now time.Time) ([]expiringKey, error) {
+	rows, err := db.Query(ctx, `
+		SELECT ak.id, ak.partner_id, ak.name, ak.key_prefix, p.email, ak.expires_at,
+			COALESCE(array_agg(r.days_before) FILTER (WHERE r.days_before IS NOT NULL), '{}')
+		FROM api_key ak
+		JOIN partner p ON p.id = ak.partner_id
+		LEFT JOIN api_key_expiry_reminder r ON r.api_key_id = ak.id AND r.expires_at = ak.expires_at
+		WHERE ak.is_active = true
+			AND p.status = 'active'
+			AND ak.expires_at > $1 - interval '1 day'
+			AND ak.expires_at <= $1 + make_interval(days => $2)
+		GROUP BY ak.id, p.email
+	`, now, KeyExpiryReminders[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to load expiring keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []expiringKey
+	for rows.Next() {
+		var k expiringKey
+		if err := rows.Scan(&k.ID, &k.PartnerID, &k.Name, &k.Prefix, &k.PartnerEmail, &k.ExpiresAt, &k.Sent); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func deliverKeyExpiry(ctx context.Context, db *pgxpool.Pool, mailer *Mailer, k expiringKey, daysLeft int) {
+	settings, err := LoadQuotaSettings(ctx, db, k.PartnerID)
+	if err != nil {
+		logger.Error("Failed to load key expiry reminder settings", "partner_id", k.PartnerID, "error", err)
+		return
+	}
+
+	if settings.WebhookURL != "" {
+		body, _ := json.Marshal(KeyExpiryEvent{
+			Event:     EventKeyExpiring,
+			PartnerID: k.PartnerID,
+			APIKeyID:  k.ID,
+			KeyName:   k.Name,
+			KeyPrefix: k.Prefix,
+			ExpiresAt: k.ExpiresAt.UTC(),
+			DaysLeft:  daysLeft,
+			SentAt:    time.Now().UTC(),
+		})
+		if err := PostWebhook(ctx, settings.WebhookURL, settings.WebhookSecret, body); err != nil {
+			logger.Error("Key expiry webhook failed", "partner_id", k.PartnerID, "error", err)
+		}
+	}
+
+	if settings.EmailEnabled && mailer != nil {
+		to := settings.Email
+		if to == "" {
+			to = k.PartnerEmail
+		}
+		subject, body := keyExpiryEmail(k, daysLeft)
+		if err := mailer.Send(to, subject, body); err != nil {
+			logger.Error("Key expiry email failed", "partner_id", k.PartnerID, "error", err)
+		}
+	}
+}
+
+// keyExpiryEmail writes the reminder email for a key
+func keyExpiryEmail(k expiringKey, daysLeft int) (subject, body string) {
+	at := k.ExpiresAt.UTC().Format("2006-01-02 15:04 MST")
+	if daysLeft == 0 {
+		subject = fmt.Sprintf("PassBi: API key %q has expired", k.Name)
+		body = fmt.Sprintf(`Hello,
+
+Your PassBi API key %q (%s...) expired at %s.
+Requests made with it are now rejected with 401.
+`, k.Name, k.Prefix, at)
+	} else {
+		when := fmt.Sprintf("in %d days", daysLeft)
+		if daysLeft == 1 {
+			when = "tomorrow"
+		}
+		subject = fmt.Sprintf("PassBi: API key %q expires %s", k.Name, when)
+		body = fmt.Sprintf(`Hello,
+
+Your PassBi API key %q (%s...) expires %s, at %s.
+Requests made with it are rejected with 401 after that.
+`, k.Name, k.Prefix, when, at)
+	}
+
+	body += `
+Create a replacement key in the dashboard (POST /dashboard/api-keys) and
+switch your applications to it.
+
+The PassBi team
+`
+	return subject, body
+}
@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDueReminder(t *testing.T) {
+	now := time.Date(2026, time.October, 16, 9, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	for _, tc := range []struct {
+		name string
+		left time.Duration
+		sent []int
+		days int
+		due  bool
+	}{
+		{"too early", 15 * day, nil, 0, false},
+		{"two weeks", 14 * day, nil, 14, true},
+		{"already sent", 10 * day, []int{14}, 0, false},
+		{"three days", 3 * day, []int{14}, 3, true},
+		{"late key skips the 14-day reminder", 2 * day, nil, 3, true},
+		{"expired", -time.Hour, []int{14, 3}, 0, true},
+		{"expired and sent", -time.Hour, []int{14, 3, 0}, 0, false},
+		{"expired long ago", -2 * day, nil, 0, false},
+	} {
+		days, due := dueReminder(now.Add(tc.left), now, tc.sent)
+		assert.Equal(t, tc.due, due, tc.name)
+		assert.Equal(t, tc.days, days, tc.name)
+	}
+}
+
+func TestDaysLeft(t *testing.T) {
+	now := time.Date(2026, time.October, 16, 9, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 14, DaysLeft(now.Add(14*24*time.Hour), now))
+	assert.Equal(t, 1, DaysLeft(now.Add(time.Hour), now))
+	assert.Equal(t, 0, DaysLeft(now.Add(-time.Hour), now))
+}
+
+func TestKeyExpiryEmail(t *testing.T) {
+	k := expiringKey{Name: "Mobile app", Prefix: "pk_live_ab12", ExpiresAt: time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)}
+
+	subject, body := keyExpiryEmail(k, 3)
+	assert.Equal(t, `PassBi: API key "Mobile app" expires in 3 days`, subject)
+	assert.Contains(t, body, "2026-10-19 00:00 UTC")
+
+	subject, _ = keyExpiryEmail(k, 0)
+	assert.Equal(t, `PassBi: API key "Mobile app" has expired`, subject)
+}
@@ -0,0 +1,208 @@
+// Package notify tells partners about their account by webhook and email
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/logging"
+)
+
+var logger = logging.For("notify")
+
+// HeaderWebhookSignature signs webhook bodies: "t=<unix time>,v1=<hex
+// HMAC-SHA256 of "<unix time>.<body>" keyed with the webhook secret>"
+const HeaderWebhookSignature = "X-PassBi-Webhook-Signature"
+
+// Webhooks are retried after these delays when the partner's endpoint fails
+var webhookRetryDelays = []time.Duration{time.Second, 5 * time.Second, 30 * time.Second}
+
+// webhookClient refuses to connect to internal addresses, whatever the
+// partner's host resolves to when the webhook is sent; it connects directly,
+// since the check would otherwise apply to the proxy
+var webhookClient = &http.Client{
+	Timeout: 5 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || internalIP(ip) {
+					return fmt.Errorf("webhook address %s is not public", host)
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+}
+
+// internalIP reports whether ip is loopback, private, link-local or
+// unspecified: webhooks must not reach the servers' own network
+func internalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast()
+}
+
+// checkWebhookHost refuses a webhook host that is or resolves to an internal
+// address; a host that does not resolve yet is left to the send-time check
+func checkWebhookHost(ctx context.Context, host string) error {
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return fmt.Errorf("webhook_url must not point to localhost")
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if internalIP(ip) {
+			return fmt.Errorf("webhook_url must not point to an internal address")
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if internalIP(addr.IP) {
+			return fmt.Errorf("webhook_url host %s resolves to an internal address", host)
+		}
+	}
+	return nil
+}
+
+// SignWebhook returns the HeaderWebhookSignature value of a body
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// PostWebhook sends a JSON body to a partner's webhook, retrying failures
+// A 2xx response is a delivery; 4xx other than 429 are not retried
+func PostWebhook(ctx context.Context, url, secret string, body []byte) error {
+	var lastErr error
+	for attempt := 0; attempt <= len(webhookRetryDelays); attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(webhookRetryDelays[attempt-1]):
+			}
+		}
+
+		retry, err := postWebhookOnce(ctx, url, secret, body)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry {
+			break
+		}
+	}
+	return lastErr
+}
+
+func postWebhookOnce(ctx context.Context, url, secret string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "PassBi-Webhooks/1.0")
+	if secret != "" {
+		req.Header.Set(HeaderWebhookSignature, SignWebhook(secret, time.Now().Unix(), body))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("webhook returned %d", resp.StatusCode)
+}
+
+// Mailer sends plain-text email through the SMTP server in SMTP_HOST
+type Mailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+// NewMailer reads SMTP_HOST, SMTP_PORT (587), SMTP_USERNAME, SMTP_PASSWORD and
+// SMTP_FROM; it returns nil when SMTP_HOST is not set
+func NewMailer() *Mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return nil
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "PassBi <noreply@passbi.com>"
+	}
+	return &Mailer{
+		host:     host,
+		port:     port,
+		username: os.Getenv("SMTP_USERNAME"),
+		password: os.Getenv("SMTP_PASSWORD"),
+		from:     from,
+	}
+}
+
+// Send emails one recipient
+func (m *Mailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+	return smtp.SendMail(m.host+":"+m.port, auth, senderAddress(m.from), []string{to}, composeEmail(m.from, to, subject, body))
+}
+
+// composeEmail builds an RFC 5322 message with CRLF line endings
+func composeEmail(from, to, subject, body string) []byte {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(msg.String())
+}
+
+// senderAddress extracts the address from "Name <address>"
+func senderAddress(from string) string {
+	if start := strings.LastIndex(from, "<"); start >= 0 {
+		if end := strings.LastIndex(from, ">"); end > start {
+			return from[start+1 : end]
+		}
+	}
+	return from
+}
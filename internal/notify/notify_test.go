@@ -0,0 +1,129 @@
+package notify
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+// allowLoopbackWebhooks lets webhooks reach httptest servers
+func allowLoopbackWebhooks(t *testing.T) {
+	client := webhookClient
+	webhookClient = &http.Client{Timeout: 5 * time.Second}
+	t.Cleanup(func() { webhookClient = client })
+}
+
+func TestPostWebhookRetries(t *testing.T) {
+	allowLoopbackWebhooks(t)
+	webhookRetryDelays = []time.Duration{time.Millisecond, time.Millisecond}
+	defer func() { webhookRetryDelays = []time.Duration{time.Second, 5 * time.Second, 30 * time.Second} }()
+
+	var calls int32
+	body := []byte(`{"event":"quota.threshold"}`)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ := io.ReadAll(r.Body)
+		assert.Equal(t, body, got)
+
+		sig := r.Header.Get(HeaderWebhookSignature)
+		unix, _ := strconv.ParseInt(strings.TrimPrefix(strings.Split(sig, ",")[0], "t="), 10, 64)
+		assert.Equal(t, SignWebhook("whsec_test", unix, body), sig)
+
+		if atomic.AddInt32(&calls, 1) < 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	err := PostWebhook(context.Background(), srv.URL, "whsec_test", body)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestPostWebhookClientError(t *testing.T) {
+	allowLoopbackWebhooks(t)
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	// A 404 will not fix itself: no retry
+	err := PostWebhook(context.Background(), srv.URL, "", []byte(`{}`))
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestQuotaSettingsValidate(t *testing.T) {
+	s := DefaultQuotaSettings()
+	assert.NoError(t, s.Validate())
+
+	s.WebhookURL = "http://partner.example/hook"
+	assert.Error(t, s.Validate())
+	s.WebhookURL = "https://partner.example/hook"
+	assert.NoError(t, s.Validate())
+
+	for _, internal := range []string{"https://localhost/hook", "https://127.0.0.1/hook",
+		"https://10.0.0.5/hook", "https://[::1]:8443/hook", "https://169.254.169.254/latest"} {
+		s.WebhookURL = internal
+		assert.Error(t, s.Validate(), internal)
+	}
+	s.WebhookURL = "https://partner.example/hook"
+
+	s.Email = "ops@partner.example\r\nBcc: victim@example.com"
+	assert.Error(t, s.Validate())
+	s.Email = "Ops <ops@partner.example>"
+	assert.NoError(t, s.Validate())
+	assert.Equal(t, "ops@partner.example", s.Email)
+
+	s.Thresholds = []int{50}
+	assert.Error(t, s.Validate())
+	s.Thresholds = []int{100}
+	s.Windows = []string{"week"}
+	assert.Error(t, s.Validate())
+}
+
+func TestPostWebhookRefusesInternalAddress(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer srv.Close()
+
+	_, err := postWebhookOnce(context.Background(), srv.URL, "", []byte(`{}`))
+	assert.Error(t, err)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+}
+
+func TestQuotaSettingsWants(t *testing.T) {
+	s := QuotaSettings{Thresholds: []int{100}, Windows: []string{"month"}}
+
+	assert.True(t, s.wants(middleware.QuotaCrossing{Window: "month", Threshold: 100}))
+	assert.False(t, s.wants(middleware.QuotaCrossing{Window: "month", Threshold: 80}))
+	assert.False(t, s.wants(middleware.QuotaCrossing{Window: "day", Threshold: 100}))
+}
+
+func TestComposeEmail(t *testing.T) {
+	subject, body := quotaEmail(middleware.QuotaCrossing{
+		Window: "day", Threshold: 100, Used: 1000, Limit: 1000,
+		ResetAt: time.Date(2026, time.October, 17, 0, 0, 0, 0, time.UTC),
+	})
+	assert.Equal(t, "PassBi: daily quota reached", subject)
+	assert.Contains(t, body, "429")
+
+	msg := string(composeEmail("PassBi <noreply@passbi.com>", "ops@partner.example", subject, body))
+	assert.Contains(t, msg, "Subject: PassBi: daily quota reached\r\n")
+	assert.NotContains(t, strings.ReplaceAll(msg, "\r\n", ""), "\n")
+	assert.Equal(t, "noreply@passbi.com", senderAddress("PassBi <noreply@passbi.com>"))
+}
@@ -0,0 +1,230 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/middleware"
+)
+
+// EventQuotaThreshold is the webhook event sent when a quota threshold is crossed
+const EventQuotaThreshold = "quota.threshold"
+
+// QuotaSettings is how a partner wants to hear about its quotas
+// Partners without settings are emailed at every threshold
+type QuotaSettings struct {
+	WebhookURL    string   `json:"webhook_url"`
+	WebhookSecret string   `json:"webhook_secret,omitempty"`
+	Email         string   `json:"email"` // the partner's email when empty
+	EmailEnabled  bool     `json:"email_enabled"`
+	Thresholds    []int    `json:"thresholds"`
+	Windows       []string `json:"windows"`
+}
+
+// DefaultQuotaSettings are used until a partner saves its own
+func DefaultQuotaSettings() QuotaSettings {
+	return QuotaSettings{
+		EmailEnabled: true,
+		Thresholds:   append([]int(nil), middleware.QuotaThresholds...),
+		Windows:      []string{"day", "month"},
+	}
+}
+
+// Validate checks the settings a partner submits
+// The webhook must be a public https URL, since the servers post to it, and
+// the email a single address, since it goes into the message headers
+func (s *QuotaSettings) Validate() error {
+	if s.WebhookURL != "" {
+		u, err := url.Parse(s.WebhookURL)
+		if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+			return fmt.Errorf("webhook_url must be an https URL")
+		}
+		if err := checkWebhookHost(context.Background(), u.Hostname()); err != nil {
+			return err
+		}
+	}
+	if s.Email != "" {
+		addr, err := mail.ParseAddress(s.Email)
+		if err != nil || strings.ContainsAny(s.Email, "\r\n") {
+			return fmt.Errorf("email must be a single email address")
+		}
+		s.Email = addr.Address
+	}
+	for _, t := range s.Thresholds {
+		if !containsInt(middleware.QuotaThresholds, t) {
+			return fmt.Errorf("invalid threshold %d (use %v)", t, middleware.QuotaThresholds)
+		}
+	}
+	for _, w := range s.Windows {
+		if w != "day" && w != "month" {
+			return fmt.Errorf("invalid window %q (use day or month)", w)
+		}
+	}
+	return nil
+}
+
+// wants reports whether a crossing should be notified
+func (s *QuotaSettings) wants(c middleware.QuotaCrossing) bool {
+	return containsInt(s.Thresholds, c.Threshold) && containsString(s.Windows, c.Window)
+}
+
+// LoadQuotaSettings returns a partner's settings, or the defaults
+func LoadQuotaSettings(ctx context.Context, db *pgxpool.Pool, partnerID string) (QuotaSettings, error) {
+	s := QuotaSettings{}
+	err := db.QueryRow(ctx, `
+		SELECT COALESCE(webhook_url, ''), COALESCE(webhook_secret, ''), COALESCE(email, ''),
+			email_enabled, thresholds, windows
+		FROM quota_notification_settings
+		WHERE partner_id = $1
+	`, partnerID).Scan(&s.WebhookURL, &s.WebhookSecret, &s.Email, &s.EmailEnabled, &s.Thresholds, &s.Windows)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DefaultQuotaSettings(), nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("failed to load quota notification settings: %w", err)
+	}
+	return s, nil
+}
+
+// SaveQuotaSettings stores a partner's settings; the webhook secret is kept
+// unless s carries a new one
+func SaveQuotaSettings(ctx context.Context, db *pgxpool.Pool, partnerID string, s QuotaSettings) error {
+	_, err := db.Exec(ctx, `
+		INSERT INTO quota_notification_settings (partner_id, webhook_url, webhook_secret, email,
+			email_enabled, thresholds, windows)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, ''), $5, $6, $7)
+		ON CONFLICT (partner_id) DO UPDATE SET
+			webhook_url = EXCLUDED.webhook_url,
+			webhook_secret = COALESCE(EXCLUDED.webhook_secret, quota_notification_settings.webhook_secret),
+			email = EXCLUDED.email,
+			email_enabled = EXCLUDED.email_enabled,
+			thresholds = EXCLUDED.thresholds,
+			windows = EXCLUDED.windows,
+			updated_at = NOW()
+	`, partnerID, s.WebhookURL, s.WebhookSecret, s.Email, s.EmailEnabled, s.Thresholds, s.Windows)
+	if err != nil {
+		return fmt.Errorf("failed to save quota notification settings: %w", err)
+	}
+	return nil
+}
+
+// QuotaEvent is the webhook body of a quota threshold crossing
+type QuotaEvent struct {
+	Event     string `json:"event"`
+	PartnerID string `json:"partner_id"`
+	middleware.QuotaCrossing
+	SentAt time.Time `json:"sent_at"`
+}
+
+// QuotaNotifier delivers quota crossings to partners by webhook and email
+type QuotaNotifier struct {
+	db     *pgxpool.Pool
+	mailer *Mailer
+}
+
+// NewQuotaNotifier returns a notifier; without SMTP_HOST it only sends webhooks
+func NewQuotaNotifier(db *pgxpool.Pool) *QuotaNotifier {
+	mailer := NewMailer()
+	if mailer == nil {
+		logger.Info("SMTP_HOST not set, quota notifications are sent by webhook only")
+	}
+	return &QuotaNotifier{db: db, mailer: mailer}
+}
+
+// Notify is a middleware.QuotaObserver; delivery happens in the background
+func (n *QuotaNotifier) Notify(partner *middleware.PartnerContext, crossing middleware.QuotaCrossing) {
+	go n.deliver(partner.PartnerID, partner.Email, crossing)
+}
+
+func (n *QuotaNotifier) deliver(partnerID, partnerEmail string, crossing middleware.QuotaCrossing) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	settings, err := LoadQuotaSettings(ctx, n.db, partnerID)
+	if err != nil {
+		logger.Error("Failed to load quota notification settings", "partner_id", partnerID, "error", err)
+		return
+	}
+	if !settings.wants(crossing) {
+		return
+	}
+
+	if settings.WebhookURL != "" {
+		body, _ := json.Marshal(QuotaEvent{
+			Event:         EventQuotaThreshold,
+			PartnerID:     partnerID,
+			QuotaCrossing: crossing,
+			SentAt:        time.Now().UTC(),
+		})
+		if err := PostWebhook(ctx, settings.WebhookURL, settings.WebhookSecret, body); err != nil {
+			logger.Error("Quota webhook failed", "partner_id", partnerID, "error", err)
+		}
+	}
+
+	if settings.EmailEnabled && n.mailer != nil {
+		to := settings.Email
+		if to == "" {
+			to = partnerEmail
+		}
+		subject, body := quotaEmail(crossing)
+		if err := n.mailer.Send(to, subject, body); err != nil {
+			logger.Error("Quota email failed", "partner_id", partnerID, "error", err)
+		}
+	}
+}
+
+// quotaEmail writes the email for a crossing
+func quotaEmail(c middleware.QuotaCrossing) (subject, body string) {
+	period := "daily"
+	if c.Window == "month" {
+		period = "monthly"
+	}
+
+	if c.Threshold >= 100 {
+		subject = fmt.Sprintf("PassBi: %s quota reached", period)
+	} else {
+		subject = fmt.Sprintf("PassBi: %d%% of your %s quota used", c.Threshold, period)
+	}
+
+	body = fmt.Sprintf(`Hello,
+
+Your PassBi API keys have used %d of the %d units in your %s quota (%d%%).
+`, c.Used, c.Limit, period, c.Threshold)
+	if c.Threshold >= 100 {
+		body += "Further requests are rejected with 429 until the quota resets.\n"
+	}
+	body += fmt.Sprintf(`The quota resets at %s.
+
+To raise your limits, upgrade your plan in the dashboard. To change these
+notifications, use PUT /dashboard/notifications/quota.
+
+The PassBi team
+`, c.ResetAt.UTC().Format("2006-01-02 15:04 MST"))
+	return subject, body
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,271 @@
+package occupancy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/passbi/passbi_core/internal/models"
+)
+
+// Run recomputes the typical bands every cfg.Interval until ctx is done, and
+// loads them as the Current model
+// Several instances may run it: one aggregates at a time, all reload
+func Run(ctx context.Context, pool *pgxpool.Pool, cfg Config) {
+	if err := Reload(ctx, pool, cfg); err != nil {
+		logger.ErrorContext(ctx, "Failed to load occupancy bands", "error", err)
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			runCtx, cancel := context.WithTimeout(ctx, cfg.Interval)
+			err := Aggregate(runCtx, pool, cfg, now)
+			if err == nil {
+				err = Reload(runCtx, pool, cfg)
+			}
+			cancel()
+			if err != nil {
+				logger.ErrorContext(ctx, "Occupancy aggregation failed", "error", err)
+			}
+		}
+	}
+}
+
+// Aggregate forgets reports older than cfg.History and recomputes the
+// typical level of each route and band from the rest
+// It does nothing when another instance is aggregating
+func Aggregate(ctx context.Context, pool *pgxpool.Pool, cfg Config, now time.Time) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var locked bool
+	if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock(hashtext('passbi:occupancy'))`).Scan(&locked); err != nil {
+		return fmt.Errorf("failed to take the aggregation lock: %w", err)
+	}
+	if !locked {
+		return nil
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM occupancy_report WHERE reported_at < $1`, now.Add(-cfg.History)); err != nil {
+		return fmt.Errorf("failed to purge occupancy reports: %w", err)
+	}
+
+	bands, err := tx.Exec(ctx, `
+		INSERT INTO occupancy_band (route_id, weekend, band, reports, level, updated_at)
+		SELECT route_id,
+			EXTRACT(ISODOW FROM reported_at AT TIME ZONE 'UTC') >= 6,
+			FLOOR(EXTRACT(EPOCH FROM (reported_at AT TIME ZONE 'UTC')::time) / $1)::smallint,
+			COUNT(*), ROUND(AVG(level))::smallint, $2
+		FROM occupancy_report
+		WHERE route_id IS NOT NULL
+		GROUP BY 1, 2, 3
+		ON CONFLICT (route_id, weekend, band) DO UPDATE
+		SET reports = EXCLUDED.reports, level = EXCLUDED.level, updated_at = EXCLUDED.updated_at
+	`, cfg.Band.Seconds(), now)
+	if err != nil {
+		return fmt.Errorf("failed to aggregate occupancy bands: %w", err)
+	}
+	// Bands without reports left in the history, or of another band width,
+	// are forgotten
+	if _, err := tx.Exec(ctx, `DELETE FROM occupancy_band WHERE updated_at < $1`, now); err != nil {
+		return fmt.Errorf("failed to purge occupancy bands: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit occupancy bands: %w", err)
+	}
+	logger.Info("Aggregated occupancy bands", "bands", bands.RowsAffected())
+	return nil
+}
+
+// Reload makes the bands in the database the Current model
+func Reload(ctx context.Context, pool *pgxpool.Pool, cfg Config) error {
+	rows, err := pool.Query(ctx, `SELECT route_id, weekend, band, reports, level FROM occupancy_band`)
+	if err != nil {
+		return fmt.Errorf("failed to load occupancy bands: %w", err)
+	}
+	defer rows.Close()
+
+	bands := make(map[BandKey]BandStats)
+	for rows.Next() {
+		var k BandKey
+		var s BandStats
+		if err := rows.Scan(&k.RouteID, &k.Weekend, &k.Band, &s.Reports, &s.Level); err != nil {
+			return err
+		}
+		bands[k] = s
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load occupancy bands: %w", err)
+	}
+
+	current.Store(NewModel(bands, cfg))
+	return nil
+}
+
+// observation is one recent report
+type observation struct {
+	level    int
+	reporter string
+	at       time.Time
+}
+
+// summarize combines recent reports on a vehicle: the latest driver report
+// wins, as drivers see the whole vehicle; otherwise riders' reports are
+// combined by their median, which one mistaken rider does not move
+func summarize(observations []observation) (level, reports int) {
+	var latest *observation
+	var riders []int
+	for i, o := range observations {
+		if o.reporter == ReporterDriver {
+			if latest == nil || o.at.After(latest.at) {
+				latest = &observations[i]
+			}
+			continue
+		}
+		riders = append(riders, o.level)
+	}
+	if latest != nil {
+		return latest.level, len(observations)
+	}
+	return median(riders), len(riders)
+}
+
+// median returns the lower median of levels, -1 when there are none
+func median(levels []int) int {
+	if len(levels) == 0 {
+		return -1
+	}
+	sort.Ints(levels)
+	return levels[(len(levels)-1)/2]
+}
+
+// TripKey identifies a trip of an agency
+type TripKey struct {
+	AgencyID string
+	TripID   string
+}
+
+// TripCrowding returns how full the given trips are, from the reports on
+// them within cfg.MaxAge of now; trips without reports are left out
+func TripCrowding(ctx context.Context, pool *pgxpool.Pool, cfg Config, trips []TripKey, now time.Time) (map[TripKey]*models.Crowding, error) {
+	crowding := make(map[TripKey]*models.Crowding)
+	if len(trips) == 0 {
+		return crowding, nil
+	}
+	agencies, tripIDs := make([]string, len(trips)), make([]string, len(trips))
+	for i, k := range trips {
+		agencies[i], tripIDs[i] = k.AgencyID, k.TripID
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT r.agency_id, r.trip_id, r.level, r.reporter, r.reported_at
+		FROM occupancy_report r
+		JOIN (SELECT DISTINCT * FROM unnest($1::text[], $2::text[])) AS t(agency_id, trip_id)
+			ON r.agency_id = t.agency_id AND r.trip_id = t.trip_id
+		WHERE r.reported_at > $3
+	`, agencies, tripIDs, now.Add(-cfg.MaxAge))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query occupancy reports: %w", err)
+	}
+	defer rows.Close()
+
+	observed := make(map[TripKey][]observation)
+	for rows.Next() {
+		var k TripKey
+		var o observation
+		if err := rows.Scan(&k.AgencyID, &k.TripID, &o.level, &o.reporter, &o.at); err != nil {
+			return nil, err
+		}
+		observed[k] = append(observed[k], o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query occupancy reports: %w", err)
+	}
+
+	for k, obs := range observed {
+		if level, n := summarize(obs); level >= 0 && level < len(Levels) {
+			crowding[k] = &models.Crowding{Level: Levels[level], Source: SourceTrip, Reports: n}
+		}
+	}
+	return crowding, nil
+}
+
+// RouteTripCrowding returns how full the trips of a route reported on
+// within cfg.MaxAge of now are
+func RouteTripCrowding(ctx context.Context, pool *pgxpool.Pool, cfg Config, routeID string, now time.Time) (map[TripKey]*models.Crowding, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT DISTINCT agency_id, trip_id
+		FROM occupancy_report
+		WHERE route_id = $1 AND trip_id IS NOT NULL AND reported_at > $2
+	`, routeID, now.Add(-cfg.MaxAge))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query occupancy reports: %w", err)
+	}
+	defer rows.Close()
+
+	var trips []TripKey
+	for rows.Next() {
+		var k TripKey
+		if err := rows.Scan(&k.AgencyID, &k.TripID); err != nil {
+			return nil, err
+		}
+		trips = append(trips, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query occupancy reports: %w", err)
+	}
+	return TripCrowding(ctx, pool, cfg, trips, now)
+}
+
+// RouteCrowding returns how full the vehicles of the given routes are, from
+// the median of the reports on them within cfg.MaxAge of now; routes without
+// reports are left out
+func RouteCrowding(ctx context.Context, pool *pgxpool.Pool, cfg Config, routeIDs []string, now time.Time) (map[string]*models.Crowding, error) {
+	crowding := make(map[string]*models.Crowding)
+	if len(routeIDs) == 0 {
+		return crowding, nil
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT route_id, level
+		FROM occupancy_report
+		WHERE route_id = ANY($1) AND reported_at > $2
+	`, routeIDs, now.Add(-cfg.MaxAge))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query occupancy reports: %w", err)
+	}
+	defer rows.Close()
+
+	observed := make(map[string][]int)
+	for rows.Next() {
+		var routeID string
+		var level int
+		if err := rows.Scan(&routeID, &level); err != nil {
+			return nil, err
+		}
+		observed[routeID] = append(observed[routeID], level)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query occupancy reports: %w", err)
+	}
+
+	for routeID, levels := range observed {
+		if level := median(levels); level >= 0 && level < len(Levels) {
+			crowding[routeID] = &models.Crowding{Level: Levels[level], Source: SourceRoute, Reports: len(levels)}
+		}
+	}
+	return crowding, nil
+}
@@ -0,0 +1,288 @@
+// Package occupancy stores how full vehicles are, as reported by drivers and
+// riders, and tells how crowded a trip is now or a route usually is at a
+// time of day
+package occupancy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/passbi/passbi_core/internal/logging"
+	"github.com/passbi/passbi_core/internal/models"
+)
+
+var logger = logging.For("occupancy")
+
+// ErrInvalid is wrapped by the validation errors of Normalize
+var ErrInvalid = errors.New("invalid occupancy report")
+
+// Reporters of an occupancy report
+const (
+	ReporterDriver = "driver"
+	ReporterRider  = "rider"
+)
+
+// Sources of a models.Crowding
+const (
+	SourceTrip    = "trip"
+	SourceRoute   = "route"
+	SourceTypical = "typical"
+)
+
+// Levels are the occupancy levels in order, stored as their index
+var Levels = []models.OccupancyLevel{
+	models.OccupancyEmpty,
+	models.OccupancyManySeats,
+	models.OccupancyFewSeats,
+	models.OccupancyStandingRoomOnly,
+	models.OccupancyCrushed,
+	models.OccupancyFull,
+}
+
+// levelIndex returns the stored value of a level, -1 for unknown ones
+func levelIndex(level models.OccupancyLevel) int {
+	for i, l := range Levels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// maxClockSkew is how far in the future a report may be dated
+const maxClockSkew = time.Minute
+
+// maxIDLength bounds the identifiers a report stores
+const maxIDLength = 100
+
+// Config holds the report lifetimes and the aggregation settings
+type Config struct {
+	MaxAge     time.Duration // how long a report describes its trip or route
+	History    time.Duration // reports kept and aggregated into bands
+	Band       time.Duration // width of the bands of the day
+	MinReports int           // reports a band needs before it is shown
+	Interval   time.Duration // how often bands are recomputed
+	MaxBatch   int           // reports accepted in one request
+}
+
+// DefaultConfig aggregates four weeks of reports into half hours every 15
+// minutes
+func DefaultConfig() Config {
+	return Config{
+		MaxAge:     30 * time.Minute,
+		History:    28 * 24 * time.Hour,
+		Band:       30 * time.Minute,
+		MinReports: 3,
+		Interval:   15 * time.Minute,
+		MaxBatch:   100,
+	}
+}
+
+// ConfigFromEnv returns the defaults overridden by OCCUPANCY_* variables
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	if d, err := time.ParseDuration(os.Getenv("OCCUPANCY_MAX_AGE")); err == nil && d > 0 {
+		cfg.MaxAge = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("OCCUPANCY_HISTORY")); err == nil && d > 0 {
+		cfg.History = d
+	}
+	// Bands must divide the day evenly to line up from one day to the next
+	if d, err := time.ParseDuration(os.Getenv("OCCUPANCY_BAND")); err == nil && d >= time.Minute && (24*time.Hour)%d == 0 {
+		cfg.Band = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("OCCUPANCY_MIN_REPORTS")); err == nil && n > 0 {
+		cfg.MinReports = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("OCCUPANCY_INTERVAL")); err == nil && d > 0 {
+		cfg.Interval = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("OCCUPANCY_MAX_BATCH")); err == nil && n > 0 {
+		cfg.MaxBatch = n
+	}
+	return cfg
+}
+
+// Normalize trims and validates a report received at now
+// A report without a reporter comes from a rider, one without a timestamp
+// is dated now
+func (cfg Config) Normalize(r *models.OccupancyReport, now time.Time) error {
+	r.AgencyID = strings.TrimSpace(r.AgencyID)
+	r.TripID = strings.TrimSpace(r.TripID)
+	r.RouteID = strings.TrimSpace(r.RouteID)
+	r.VehicleID = strings.TrimSpace(r.VehicleID)
+	r.StopID = strings.TrimSpace(r.StopID)
+	r.Level = models.OccupancyLevel(strings.ToLower(strings.TrimSpace(string(r.Level))))
+	r.Reporter = strings.ToLower(strings.TrimSpace(r.Reporter))
+
+	if r.AgencyID == "" {
+		return fmt.Errorf("%w: agency_id is required", ErrInvalid)
+	}
+	if r.TripID == "" && r.RouteID == "" {
+		return fmt.Errorf("%w: trip_id or route_id is required", ErrInvalid)
+	}
+	for name, id := range map[string]string{
+		"agency_id": r.AgencyID, "trip_id": r.TripID, "route_id": r.RouteID,
+		"vehicle_id": r.VehicleID, "stop_id": r.StopID,
+	} {
+		if len(id) > maxIDLength {
+			return fmt.Errorf("%w: %s is longer than %d characters", ErrInvalid, name, maxIDLength)
+		}
+	}
+	if levelIndex(r.Level) < 0 {
+		return fmt.Errorf("%w: level must be one of empty, many_seats_available, few_seats_available, standing_room_only, crushed_standing_room_only, full", ErrInvalid)
+	}
+	switch r.Reporter {
+	case "":
+		r.Reporter = ReporterRider
+	case ReporterDriver, ReporterRider:
+	default:
+		return fmt.Errorf("%w: reporter must be driver or rider", ErrInvalid)
+	}
+
+	if r.Timestamp.IsZero() {
+		r.Timestamp = now
+	}
+	r.Timestamp = r.Timestamp.UTC()
+	if r.Timestamp.After(now.Add(maxClockSkew)) {
+		return fmt.Errorf("%w: timestamp is in the future", ErrInvalid)
+	}
+	if r.Timestamp.Before(now.Add(-cfg.MaxAge)) {
+		return fmt.Errorf("%w: timestamp is older than %s", ErrInvalid, cfg.MaxAge)
+	}
+	return nil
+}
+
+// Store records normalized reports posted by partnerID ("" when
+// authentication is off); reports that only name their trip get the trip's
+// route
+func Store(ctx context.Context, pool *pgxpool.Pool, partnerID string, reports []models.OccupancyReport) (int, error) {
+	n := len(reports)
+	if n == 0 {
+		return 0, nil
+	}
+	agencies, trips, routes, vehicles, stops := make([]string, n), make([]string, n), make([]string, n), make([]string, n), make([]string, n)
+	levels := make([]int, n)
+	reporters := make([]string, n)
+	reported := make([]time.Time, n)
+	for i, r := range reports {
+		agencies[i], trips[i], routes[i], vehicles[i], stops[i] = r.AgencyID, r.TripID, r.RouteID, r.VehicleID, r.StopID
+		levels[i] = levelIndex(r.Level)
+		reporters[i] = r.Reporter
+		reported[i] = r.Timestamp
+	}
+
+	tag, err := pool.Exec(ctx, `
+		INSERT INTO occupancy_report
+			(agency_id, trip_id, route_id, vehicle_id, stop_id, level, reporter, reported_at, partner_id)
+		SELECT f.agency_id, NULLIF(f.trip_id, ''), COALESCE(NULLIF(f.route_id, ''), t.route_id),
+			NULLIF(f.vehicle_id, ''), NULLIF(f.stop_id, ''), f.level, f.reporter, f.reported_at, NULLIF($9, '')::uuid
+		FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::text[],
+			$6::int[], $7::text[], $8::timestamptz[])
+			AS f(agency_id, trip_id, route_id, vehicle_id, stop_id, level, reporter, reported_at)
+		LEFT JOIN trip t ON t.agency_id = f.agency_id AND t.trip_id = f.trip_id
+	`, agencies, trips, routes, vehicles, stops, levels, reporters, reported, partnerID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to store occupancy reports: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// BandKey identifies the trips of a route during a band of weekdays or
+// weekend days
+type BandKey struct {
+	RouteID string
+	Weekend bool
+	Band    int
+}
+
+// BandStats is the typical level of a band and the reports it comes from
+type BandStats struct {
+	Level   int
+	Reports int
+}
+
+// Model is the typical occupancy of routes by band
+type Model struct {
+	bands      map[BandKey]BandStats
+	band       time.Duration
+	minReports int
+}
+
+// NewModel returns a model over aggregated bands
+func NewModel(bands map[BandKey]BandStats, cfg Config) *Model {
+	return &Model{bands: bands, band: cfg.Band, minReports: cfg.MinReports}
+}
+
+var current atomic.Pointer[Model]
+
+// Current returns the model loaded by Run, nil before the first load
+func Current() *Model {
+	return current.Load()
+}
+
+// BandOf returns the band of the day a time falls in, and whether it is a
+// weekend day
+func BandOf(t time.Time, band time.Duration) (int, bool) {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	weekend := t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
+	return int(t.Sub(day) / band), weekend
+}
+
+// Typical returns how full a route usually is at a time, from the band it
+// falls in; false when the band has too few reports
+func (m *Model) Typical(routeID string, at time.Time) (*models.Crowding, bool) {
+	if m == nil || m.band <= 0 {
+		return nil, false
+	}
+	band, weekend := BandOf(at, m.band)
+	s, ok := m.bands[BandKey{RouteID: routeID, Weekend: weekend, Band: band}]
+	if !ok || s.Reports < m.minReports || s.Level < 0 || s.Level >= len(Levels) {
+		return nil, false
+	}
+	return &models.Crowding{Level: Levels[s.Level], Source: SourceTypical, Reports: s.Reports}, true
+}
+
+// Bands returns a route's typical bands with enough reports, in order of
+// the day, weekdays first
+func (m *Model) Bands(routeID string) []Band {
+	if m == nil {
+		return nil
+	}
+	var bands []Band
+	perDay := int(24 * time.Hour / m.band)
+	for _, weekend := range []bool{false, true} {
+		for b := 0; b < perDay; b++ {
+			s, ok := m.bands[BandKey{RouteID: routeID, Weekend: weekend, Band: b}]
+			if !ok || s.Reports < m.minReports || s.Level < 0 || s.Level >= len(Levels) {
+				continue
+			}
+			bands = append(bands, Band{
+				Weekend: weekend,
+				Start:   b * int(m.band.Seconds()),
+				End:     (b + 1) * int(m.band.Seconds()),
+				Level:   Levels[s.Level],
+				Reports: s.Reports,
+			})
+		}
+	}
+	return bands
+}
+
+// Band is the typical occupancy of a route during part of the day
+type Band struct {
+	Weekend bool
+	Start   int // seconds since midnight
+	End     int
+	Level   models.OccupancyLevel
+	Reports int
+}
@@ -0,0 +1,100 @@
+package occupancy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func report() models.OccupancyReport {
+	return models.OccupancyReport{
+		AgencyID: "dakar_dem_dikk",
+		TripID:   " T1 ",
+		Level:    " Standing_Room_Only",
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	cfg := DefaultConfig()
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+
+	r := report()
+	assert.NoError(t, cfg.Normalize(&r, now))
+	assert.Equal(t, "T1", r.TripID)
+	assert.Equal(t, models.OccupancyStandingRoomOnly, r.Level)
+	assert.Equal(t, ReporterRider, r.Reporter)
+	assert.Equal(t, now, r.Timestamp)
+
+	cases := map[string]func(r *models.OccupancyReport){
+		"no agency":        func(r *models.OccupancyReport) { r.AgencyID = "" },
+		"no trip or route": func(r *models.OccupancyReport) { r.TripID = "" },
+		"level":            func(r *models.OccupancyReport) { r.Level = "packed" },
+		"reporter":         func(r *models.OccupancyReport) { r.Reporter = "conductor" },
+		"future":           func(r *models.OccupancyReport) { r.Timestamp = now.Add(2 * time.Minute) },
+		"stale":            func(r *models.OccupancyReport) { r.Timestamp = now.Add(-time.Hour) },
+	}
+	for name, mutate := range cases {
+		r := report()
+		mutate(&r)
+		err := cfg.Normalize(&r, now)
+		assert.True(t, errors.Is(err, ErrInvalid), name)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	at := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+
+	level, n := summarize([]observation{
+		{level: 5, reporter: ReporterRider, at: at},
+		{level: 2, reporter: ReporterRider, at: at},
+		{level: 3, reporter: ReporterRider, at: at},
+	})
+	assert.Equal(t, 3, level, "the median of riders")
+	assert.Equal(t, 3, n)
+
+	level, n = summarize([]observation{
+		{level: 5, reporter: ReporterRider, at: at},
+		{level: 1, reporter: ReporterDriver, at: at},
+		{level: 2, reporter: ReporterDriver, at: at.Add(time.Minute)},
+	})
+	assert.Equal(t, 2, level, "the latest driver report wins")
+	assert.Equal(t, 3, n)
+
+	level, _ = summarize(nil)
+	assert.Equal(t, -1, level)
+}
+
+func TestTypical(t *testing.T) {
+	cfg := DefaultConfig()
+	monday := time.Date(2026, 3, 2, 7, 40, 0, 0, time.UTC)
+
+	band, weekend := BandOf(monday, cfg.Band)
+	assert.Equal(t, 15, band)
+	assert.False(t, weekend)
+	_, weekend = BandOf(monday.AddDate(0, 0, 5), cfg.Band)
+	assert.True(t, weekend, "saturday")
+
+	m := NewModel(map[BandKey]BandStats{
+		{RouteID: "R1", Band: 15}:                {Level: 4, Reports: 12},
+		{RouteID: "R1", Band: 16}:                {Level: 2, Reports: 2},
+		{RouteID: "R1", Weekend: true, Band: 15}: {Level: 1, Reports: 5},
+	}, cfg)
+
+	c, ok := m.Typical("R1", monday)
+	if assert.True(t, ok) {
+		assert.Equal(t, models.Crowding{Level: models.OccupancyCrushed, Source: SourceTypical, Reports: 12}, *c)
+	}
+	_, ok = m.Typical("R1", monday.Add(30*time.Minute))
+	assert.False(t, ok, "too few reports")
+	_, ok = (*Model)(nil).Typical("R1", monday)
+	assert.False(t, ok)
+
+	bands := m.Bands("R1")
+	if assert.Len(t, bands, 2) {
+		assert.Equal(t, Band{Start: 27000, End: 28800, Level: models.OccupancyCrushed, Reports: 12}, bands[0])
+		assert.True(t, bands[1].Weekend)
+	}
+}
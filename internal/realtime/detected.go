@@ -0,0 +1,129 @@
+package realtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Detected is the delay of a trip observed from its vehicle's position at
+// one of its stops, already propagated to the following stops
+type Detected struct {
+	AgencyID    string
+	TripID      string
+	RouteID     string
+	VehicleID   string
+	ServiceDate time.Time
+	Delay       int // seconds late (negative when early) at the observed stop
+	ObservedAt  time.Time
+	Predictions []StopPrediction
+}
+
+// DecayDelay propagates a delay observed at stops[from] to the stops after it
+// Unlike a feed's delay, which carries over unchanged, a detected one halves
+// every halfDistance meters the vehicle still has to travel, as drivers make
+// up for lost time; distances are cumulative along the trip, one per stop
+// The prediction stops at the first stop where the delay falls under
+// minDelay, which keeps the schedule from there on
+// A halfDistance of zero carries the delay over like a feed would
+func DecayDelay(stops []ScheduledStop, distances []float64, from, delay int, halfDistance float64, minDelay int) []StopPrediction {
+	if from < 0 || from >= len(stops) || len(distances) != len(stops) {
+		return nil
+	}
+
+	var predictions []StopPrediction
+	for i := from; i < len(stops); i++ {
+		d := delay
+		if halfDistance > 0 {
+			travelled := max(distances[i]-distances[from], 0)
+			d = int(math.Round(float64(delay) * math.Pow(0.5, travelled/halfDistance)))
+		}
+		if abs(d) < minDelay {
+			break
+		}
+		predictions = append(predictions, StopPrediction{
+			Sequence:       stops[i].Sequence,
+			StopID:         stops[i].StopID,
+			ArrivalDelay:   &d,
+			DepartureDelay: &d,
+		})
+	}
+	return predictions
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// StoreDetected stores detected delays as trip updates of source gps,
+// replacing those detected before
+// A trip whose feed update is younger than MaxAge keeps it: the feed knows
+// about the trip and is trusted over positions
+// It returns how many trips were stored
+func StoreDetected(ctx context.Context, db *pgxpool.Pool, detected []Detected) (int, error) {
+	if len(detected) == 0 {
+		return 0, nil
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	stored := 0
+	for _, d := range detected {
+		serviceDate := serviceDay(d.ServiceDate)
+
+		var tripID string
+		err := tx.QueryRow(ctx, `
+			INSERT INTO trip_update (agency_id, trip_id, service_date, route_id, vehicle_id,
+				schedule_relationship, delay, feed_timestamp, source, updated_at)
+			VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), 'SCHEDULED', $6, $7, 'gps', NOW())
+			ON CONFLICT (agency_id, trip_id, service_date) DO UPDATE SET
+				route_id = EXCLUDED.route_id,
+				vehicle_id = EXCLUDED.vehicle_id,
+				schedule_relationship = EXCLUDED.schedule_relationship,
+				delay = EXCLUDED.delay,
+				feed_timestamp = EXCLUDED.feed_timestamp,
+				source = 'gps',
+				updated_at = NOW()
+			WHERE trip_update.source = 'gps' OR trip_update.updated_at <= NOW() - $8::interval
+			RETURNING trip_id
+		`, d.AgencyID, d.TripID, serviceDate, d.RouteID, d.VehicleID, d.Delay, d.ObservedAt, MaxAge.String()).Scan(&tripID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to store detected delay: %w", err)
+		}
+
+		batch := &pgx.Batch{}
+		batch.Queue(`DELETE FROM stop_time_update WHERE agency_id = $1 AND trip_id = $2 AND service_date = $3`,
+			d.AgencyID, d.TripID, serviceDate)
+		for _, p := range d.Predictions {
+			batch.Queue(`
+				INSERT INTO stop_time_update (agency_id, trip_id, service_date, stop_sequence, stop_id,
+					arrival_delay, departure_delay, schedule_relationship)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, 'SCHEDULED')
+			`, d.AgencyID, d.TripID, serviceDate, p.Sequence, p.StopID, p.ArrivalDelay, p.DepartureDelay)
+		}
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return 0, fmt.Errorf("failed to store detected stop delays: %w", err)
+		}
+		stored++
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit detected delays: %w", err)
+	}
+	return stored, nil
+}
@@ -0,0 +1,38 @@
+package realtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecayDelay(t *testing.T) {
+	stops := []ScheduledStop{
+		{Sequence: 1, StopID: "A"},
+		{Sequence: 2, StopID: "B"},
+		{Sequence: 3, StopID: "C"},
+		{Sequence: 4, StopID: "D"},
+		{Sequence: 5, StopID: "E"},
+	}
+	distances := []float64{0, 1000, 3000, 5000, 9000}
+
+	// 8 minutes late at B, halving every 2 km
+	got := DecayDelay(stops, distances, 1, 480, 2000, 60)
+	assert.Equal(t, []StopPrediction{
+		{Sequence: 2, StopID: "B", ArrivalDelay: intPtr(480), DepartureDelay: intPtr(480)},
+		{Sequence: 3, StopID: "C", ArrivalDelay: intPtr(240), DepartureDelay: intPtr(240)},
+		{Sequence: 4, StopID: "D", ArrivalDelay: intPtr(120), DepartureDelay: intPtr(120)},
+	}, got, "E, 30 s late, keeps the schedule")
+
+	got = DecayDelay(stops, distances, 3, -200, 2000, 60)
+	assert.Equal(t, []StopPrediction{
+		{Sequence: 4, StopID: "D", ArrivalDelay: intPtr(-200), DepartureDelay: intPtr(-200)},
+	}, got, "early vehicles converge on the schedule too")
+
+	got = DecayDelay(stops, distances, 2, 300, 0, 60)
+	assert.Len(t, got, 3, "without decay the delay reaches the terminus")
+	assert.Equal(t, 300, *got[2].ArrivalDelay)
+
+	assert.Empty(t, DecayDelay(stops, distances, 0, 45, 2000, 60), "an on-time vehicle predicts nothing")
+	assert.Nil(t, DecayDelay(stops, distances[:2], 0, 300, 2000, 60))
+}
@@ -0,0 +1,440 @@
+package realtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/gtfsrt"
+)
+
+// MaxAge is how long stored predictions are trusted after their last refresh
+// Older rows are ignored by readers so a stalled feed falls back to the schedule
+const MaxAge = 10 * time.Minute
+
+// Sources of a stored trip update
+const (
+	SourceFeed = "feed" // a GTFS-Realtime TripUpdates feed
+	SourceGPS  = "gps"  // a delay detected from the trip's vehicle positions
+)
+
+// maxFeedSize bounds the size of a downloaded feed
+const maxFeedSize = 32 << 20
+
+// tripRelationships maps TripDescriptor.schedule_relationship to stored names
+var tripRelationships = map[int32]string{
+	gtfsrt.TripScheduled:   "SCHEDULED",
+	gtfsrt.TripAdded:       "ADDED",
+	gtfsrt.TripUnscheduled: "UNSCHEDULED",
+	gtfsrt.TripCanceled:    "CANCELED",
+	gtfsrt.TripReplacement: "REPLACEMENT",
+	gtfsrt.TripDuplicated:  "DUPLICATED",
+	gtfsrt.TripDeleted:     "DELETED",
+}
+
+// ScheduledStop is a stop_time row of the trip being updated
+type ScheduledStop struct {
+	Sequence      int
+	StopID        string
+	ArrivalSecs   int
+	DepartureSecs int
+}
+
+// StopPrediction is the realtime state of one scheduled stop
+type StopPrediction struct {
+	Sequence       int
+	StopID         string
+	ArrivalDelay   *int
+	DepartureDelay *int
+	Skipped        bool
+	Source         string // SourceFeed or SourceGPS, set when read back
+}
+
+// TripStatus is the latest realtime state of a trip on a service day
+type TripStatus struct {
+	Delay     *int
+	Canceled  bool
+	UpdatedAt time.Time
+}
+
+// Call identifies a trip's visit to a stop; loop trips may visit a stop twice
+type Call struct {
+	AgencyID string
+	TripID   string
+	Sequence int
+}
+
+// IngestStats summarizes one feed ingestion
+type IngestStats struct {
+	Trips        int
+	Stops        int
+	Canceled     int
+	UnknownTrips int
+}
+
+// Fetch downloads and decodes a GTFS-Realtime feed
+func Fetch(ctx context.Context, client *http.Client, url string) (*gtfsrt.FeedMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/x-protobuf")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch feed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed returned HTTP %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feed: %w", err)
+	}
+
+	return gtfsrt.Unmarshal(data)
+}
+
+// Propagate applies a TripUpdate to a trip's scheduled stops
+// Following the GTFS-Realtime rules, a delay carries over to downstream stops
+// until the next StopTimeUpdate; stops before the first update get no prediction
+func Propagate(stops []ScheduledStop, u *gtfsrt.TripUpdate, serviceDate time.Time) []StopPrediction {
+	midnight := serviceDay(serviceDate).Unix()
+
+	updates := make(map[int]*gtfsrt.StopTimeUpdate, len(u.StopTimeUpdates))
+	last := 0
+	for i := range u.StopTimeUpdates {
+		s := &u.StopTimeUpdates[i]
+		if idx := matchStop(stops, s, last); idx >= 0 {
+			updates[idx] = s
+			last = idx
+		}
+	}
+
+	var current *int
+	if len(u.StopTimeUpdates) == 0 && u.Delay != nil {
+		d := int(*u.Delay)
+		current = &d
+	}
+
+	predictions := make([]StopPrediction, 0, len(stops))
+	for i, st := range stops {
+		p := StopPrediction{Sequence: st.Sequence, StopID: st.StopID}
+
+		if s, ok := updates[i]; ok {
+			switch s.ScheduleRelationship {
+			case gtfsrt.StopSkipped:
+				p.Skipped = true
+				predictions = append(predictions, p)
+				continue
+			case gtfsrt.StopNoData:
+				current = nil
+				continue
+			}
+
+			arr := eventDelay(s.Arrival, midnight+int64(st.ArrivalSecs))
+			dep := eventDelay(s.Departure, midnight+int64(st.DepartureSecs))
+			if arr == nil {
+				arr = dep
+			}
+			if dep == nil {
+				dep = arr
+			}
+			if dep == nil {
+				arr, dep = current, current
+			}
+			p.ArrivalDelay, p.DepartureDelay = arr, dep
+			current = dep
+		} else {
+			p.ArrivalDelay, p.DepartureDelay = current, current
+		}
+
+		if p.ArrivalDelay != nil || p.DepartureDelay != nil {
+			predictions = append(predictions, p)
+		}
+	}
+
+	return predictions
+}
+
+// matchStop finds the scheduled stop a StopTimeUpdate refers to, searching from
+// index from so that loop routes visiting a stop twice resolve in order
+func matchStop(stops []ScheduledStop, s *gtfsrt.StopTimeUpdate, from int) int {
+	for i := from; i < len(stops); i++ {
+		if s.StopSequence != nil {
+			if stops[i].Sequence == int(*s.StopSequence) {
+				return i
+			}
+		} else if s.StopID != "" && stops[i].StopID == s.StopID {
+			return i
+		}
+	}
+	return -1
+}
+
+// eventDelay returns the delay of a StopTimeEvent relative to the scheduled time
+func eventDelay(ev *gtfsrt.StopTimeEvent, scheduled int64) *int {
+	if ev == nil {
+		return nil
+	}
+	if ev.Delay != nil {
+		d := int(*ev.Delay)
+		return &d
+	}
+	if ev.Time != nil {
+		d := int(*ev.Time - scheduled)
+		return &d
+	}
+	return nil
+}
+
+// ServiceDate resolves the service day of a trip update
+// start_date from the descriptor wins; otherwise the feed time's date is used
+func ServiceDate(t *gtfsrt.TripDescriptor, feedTime time.Time) time.Time {
+	if t.StartDate != "" {
+		if d, err := time.Parse("20060102", t.StartDate); err == nil {
+			return d
+		}
+	}
+	return serviceDay(feedTime)
+}
+
+// serviceDay truncates a time to its date (Dakar runs on UTC)
+func serviceDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Ingest stores a TripUpdates feed for one agency in a single transaction
+// A FULL_DATASET feed replaces every stored feed update of the agency, and
+// any update of a trip replaces a delay detected for it
+func Ingest(ctx context.Context, db *pgxpool.Pool, agencyID string, feed *gtfsrt.FeedMessage) (*IngestStats, error) {
+	feedTime := time.Now().UTC()
+	if feed.Header.Timestamp > 0 {
+		feedTime = time.Unix(int64(feed.Header.Timestamp), 0).UTC()
+	}
+
+	var tripIDs []string
+	for _, ent := range feed.Entities {
+		if ent.TripUpdate != nil && ent.TripUpdate.Trip.TripID != "" {
+			tripIDs = append(tripIDs, ent.TripUpdate.Trip.TripID)
+		}
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	schedules, err := loadScheduledStops(ctx, tx, agencyID, tripIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &IngestStats{}
+	batch := &pgx.Batch{}
+
+	if feed.Header.Incrementality == gtfsrt.FullDataset {
+		batch.Queue(`DELETE FROM trip_update WHERE agency_id = $1 AND source = 'feed'`, agencyID)
+	}
+
+	for _, ent := range feed.Entities {
+		u := ent.TripUpdate
+		if u == nil || u.Trip.TripID == "" {
+			continue
+		}
+		tripID := u.Trip.TripID
+		serviceDate := ServiceDate(&u.Trip, feedTime)
+
+		if ent.IsDeleted {
+			batch.Queue(`DELETE FROM trip_update WHERE agency_id = $1 AND trip_id = $2 AND service_date = $3`,
+				agencyID, tripID, serviceDate)
+			continue
+		}
+
+		stops, ok := schedules[tripID]
+		if !ok {
+			stats.UnknownTrips++
+			continue
+		}
+
+		relationship, ok := tripRelationships[u.Trip.ScheduleRelationship]
+		if !ok {
+			relationship = "SCHEDULED"
+		}
+
+		var predictions []StopPrediction
+		if relationship == "CANCELED" || relationship == "DELETED" {
+			stats.Canceled++
+		} else {
+			predictions = Propagate(stops, u, serviceDate)
+		}
+
+		var tripDelay *int
+		if u.Delay != nil {
+			d := int(*u.Delay)
+			tripDelay = &d
+		} else {
+			for _, p := range predictions {
+				if p.DepartureDelay != nil {
+					tripDelay = p.DepartureDelay
+					break
+				}
+			}
+		}
+
+		updatedAt := feedTime
+		if u.Timestamp > 0 {
+			updatedAt = time.Unix(int64(u.Timestamp), 0).UTC()
+		}
+
+		batch.Queue(`
+			INSERT INTO trip_update (agency_id, trip_id, service_date, route_id, vehicle_id,
+				schedule_relationship, delay, feed_timestamp, updated_at)
+			VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7, $8, NOW())
+			ON CONFLICT (agency_id, trip_id, service_date) DO UPDATE SET
+				route_id = EXCLUDED.route_id,
+				vehicle_id = EXCLUDED.vehicle_id,
+				schedule_relationship = EXCLUDED.schedule_relationship,
+				delay = EXCLUDED.delay,
+				feed_timestamp = EXCLUDED.feed_timestamp,
+				source = 'feed',
+				updated_at = NOW()
+		`, agencyID, tripID, serviceDate, u.Trip.RouteID, u.VehicleID, relationship, tripDelay, updatedAt)
+
+		batch.Queue(`DELETE FROM stop_time_update WHERE agency_id = $1 AND trip_id = $2 AND service_date = $3`,
+			agencyID, tripID, serviceDate)
+
+		for _, p := range predictions {
+			stopRelationship := "SCHEDULED"
+			if p.Skipped {
+				stopRelationship = "SKIPPED"
+			}
+			batch.Queue(`
+				INSERT INTO stop_time_update (agency_id, trip_id, service_date, stop_sequence, stop_id,
+					arrival_delay, departure_delay, schedule_relationship)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			`, agencyID, tripID, serviceDate, p.Sequence, p.StopID, p.ArrivalDelay, p.DepartureDelay, stopRelationship)
+		}
+
+		stats.Trips++
+		stats.Stops += len(predictions)
+	}
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return nil, fmt.Errorf("failed to store trip updates: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit trip updates: %w", err)
+	}
+
+	return stats, nil
+}
+
+// loadScheduledStops returns the ordered stop_times of each trip
+func loadScheduledStops(ctx context.Context, tx pgx.Tx, agencyID string, tripIDs []string) (map[string][]ScheduledStop, error) {
+	schedules := make(map[string][]ScheduledStop)
+	if len(tripIDs) == 0 {
+		return schedules, nil
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT trip_id, stop_sequence, stop_id,
+			COALESCE(arrival_seconds, departure_seconds, 0),
+			COALESCE(departure_seconds, arrival_seconds, 0)
+		FROM stop_time
+		WHERE agency_id = $1 AND trip_id = ANY($2)
+		ORDER BY trip_id, stop_sequence
+	`, agencyID, tripIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load scheduled stops: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tripID string
+		var s ScheduledStop
+		if err := rows.Scan(&tripID, &s.Sequence, &s.StopID, &s.ArrivalSecs, &s.DepartureSecs); err != nil {
+			return nil, err
+		}
+		schedules[tripID] = append(schedules[tripID], s)
+	}
+
+	return schedules, rows.Err()
+}
+
+// TripStatuses returns fresh realtime state for the given trips on a service day
+func TripStatuses(ctx context.Context, db *pgxpool.Pool, agencyID string, tripIDs []string, serviceDate time.Time) (map[string]TripStatus, error) {
+	statuses := make(map[string]TripStatus)
+	if len(tripIDs) == 0 {
+		return statuses, nil
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT trip_id, delay, schedule_relationship IN ('CANCELED', 'DELETED'), updated_at
+		FROM trip_update
+		WHERE agency_id = $1 AND trip_id = ANY($2) AND service_date = $3 AND updated_at > $4
+	`, agencyID, tripIDs, serviceDay(serviceDate), time.Now().Add(-MaxAge))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trip updates: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tripID string
+		var s TripStatus
+		if err := rows.Scan(&tripID, &s.Delay, &s.Canceled, &s.UpdatedAt); err != nil {
+			return nil, err
+		}
+		statuses[tripID] = s
+	}
+
+	return statuses, rows.Err()
+}
+
+// StopPredictions returns fresh per-stop predictions at a stop on a service day
+func StopPredictions(ctx context.Context, db *pgxpool.Pool, stopID string, serviceDate time.Time) (map[Call]StopPrediction, error) {
+	rows, err := db.Query(ctx, `
+		SELECT u.agency_id, u.trip_id, u.stop_sequence, u.arrival_delay, u.departure_delay,
+			u.schedule_relationship = 'SKIPPED', t.source
+		FROM stop_time_update u
+		JOIN trip_update t ON t.agency_id = u.agency_id AND t.trip_id = u.trip_id AND t.service_date = u.service_date
+		WHERE u.stop_id = $1 AND u.service_date = $2 AND u.updated_at > $3
+	`, stopID, serviceDay(serviceDate), time.Now().Add(-MaxAge))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stop time updates: %w", err)
+	}
+	defer rows.Close()
+
+	predictions := make(map[Call]StopPrediction)
+	for rows.Next() {
+		var call Call
+		p := StopPrediction{StopID: stopID}
+		if err := rows.Scan(&call.AgencyID, &call.TripID, &p.Sequence,
+			&p.ArrivalDelay, &p.DepartureDelay, &p.Skipped, &p.Source); err != nil {
+			return nil, err
+		}
+		call.Sequence = p.Sequence
+		predictions[call] = p
+	}
+
+	return predictions, rows.Err()
+}
+
+// Purge deletes trip updates for service days before the given date
+func Purge(ctx context.Context, db *pgxpool.Pool, before time.Time) (int64, error) {
+	tag, err := db.Exec(ctx, `DELETE FROM trip_update WHERE service_date < $1`, serviceDay(before))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge trip updates: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,89 @@
+package realtime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/gtfsrt"
+	"github.com/stretchr/testify/assert"
+)
+
+func intPtr(v int) *int { return &v }
+
+func TestPropagate(t *testing.T) {
+	day := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	stops := []ScheduledStop{
+		{Sequence: 1, StopID: "A", ArrivalSecs: 28800, DepartureSecs: 28800},
+		{Sequence: 2, StopID: "B", ArrivalSecs: 29100, DepartureSecs: 29160},
+		{Sequence: 3, StopID: "C", ArrivalSecs: 29400, DepartureSecs: 29400},
+		{Sequence: 4, StopID: "D", ArrivalSecs: 29700, DepartureSecs: 29700},
+	}
+	seq := func(v uint32) *uint32 { return &v }
+	delay := func(v int32) *int32 { return &v }
+
+	t.Run("delay carries downstream", func(t *testing.T) {
+		u := &gtfsrt.TripUpdate{StopTimeUpdates: []gtfsrt.StopTimeUpdate{
+			{StopSequence: seq(2), Arrival: &gtfsrt.StopTimeEvent{Delay: delay(120)}},
+		}}
+		got := Propagate(stops, u, day)
+
+		assert.Equal(t, []StopPrediction{
+			{Sequence: 2, StopID: "B", ArrivalDelay: intPtr(120), DepartureDelay: intPtr(120)},
+			{Sequence: 3, StopID: "C", ArrivalDelay: intPtr(120), DepartureDelay: intPtr(120)},
+			{Sequence: 4, StopID: "D", ArrivalDelay: intPtr(120), DepartureDelay: intPtr(120)},
+		}, got)
+	})
+
+	t.Run("absolute time and stop_id matching", func(t *testing.T) {
+		at := day.Unix() + 29400 + 300
+		u := &gtfsrt.TripUpdate{StopTimeUpdates: []gtfsrt.StopTimeUpdate{
+			{StopID: "C", Departure: &gtfsrt.StopTimeEvent{Time: &at}},
+		}}
+		got := Propagate(stops, u, day)
+
+		assert.Len(t, got, 2)
+		assert.Equal(t, 300, *got[0].ArrivalDelay)
+		assert.Equal(t, 300, *got[1].DepartureDelay)
+	})
+
+	t.Run("skipped stop keeps upstream delay", func(t *testing.T) {
+		u := &gtfsrt.TripUpdate{StopTimeUpdates: []gtfsrt.StopTimeUpdate{
+			{StopSequence: seq(1), Departure: &gtfsrt.StopTimeEvent{Delay: delay(60)}},
+			{StopSequence: seq(3), ScheduleRelationship: gtfsrt.StopSkipped},
+		}}
+		got := Propagate(stops, u, day)
+
+		assert.Len(t, got, 4)
+		assert.True(t, got[2].Skipped)
+		assert.Equal(t, 60, *got[3].ArrivalDelay)
+	})
+
+	t.Run("no data stops propagation", func(t *testing.T) {
+		u := &gtfsrt.TripUpdate{StopTimeUpdates: []gtfsrt.StopTimeUpdate{
+			{StopSequence: seq(1), Departure: &gtfsrt.StopTimeEvent{Delay: delay(60)}},
+			{StopSequence: seq(3), ScheduleRelationship: gtfsrt.StopNoData},
+		}}
+		got := Propagate(stops, u, day)
+
+		assert.Len(t, got, 2)
+		assert.Equal(t, "B", got[1].StopID)
+	})
+
+	t.Run("trip level delay", func(t *testing.T) {
+		u := &gtfsrt.TripUpdate{Delay: delay(-30)}
+		got := Propagate(stops, u, day)
+
+		assert.Len(t, got, 4)
+		assert.Equal(t, -30, *got[0].DepartureDelay)
+	})
+}
+
+func TestServiceDate(t *testing.T) {
+	feedTime := time.Date(2024, 3, 4, 23, 10, 0, 0, time.UTC)
+
+	d := ServiceDate(&gtfsrt.TripDescriptor{StartDate: "20240303"}, feedTime)
+	assert.Equal(t, time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC), d)
+
+	d = ServiceDate(&gtfsrt.TripDescriptor{}, feedTime)
+	assert.Equal(t, time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), d)
+}
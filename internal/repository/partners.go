@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// Partner is a row of partner with its effective rate limits
+type Partner struct {
+	ID                 string
+	Name               string
+	Email              string
+	Company            string
+	Status             string
+	Tier               string
+	RateLimitPerSecond int
+	RateLimitPerDay    int
+	RateLimitPerMonth  int
+	RateLimitBurst     int // never below RateLimitPerSecond
+	CreatedAt          time.Time
+	LastActiveAt       *time.Time
+}
+
+// GetPartner returns the partner with the given ID
+func GetPartner(ctx context.Context, q Querier, id string) (*Partner, error) {
+	var p Partner
+	err := q.QueryRow(ctx, `
+		SELECT
+			id, name, email, COALESCE(company, ''), status, tier,
+			rate_limit_per_second, rate_limit_per_day, rate_limit_per_month,
+			GREATEST(rate_limit_burst, rate_limit_per_second),
+			created_at, last_active_at
+		FROM partner
+		WHERE id = $1
+	`, id).Scan(
+		&p.ID, &p.Name, &p.Email, &p.Company, &p.Status, &p.Tier,
+		&p.RateLimitPerSecond, &p.RateLimitPerDay, &p.RateLimitPerMonth,
+		&p.RateLimitBurst,
+		&p.CreatedAt, &p.LastActiveAt,
+	)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &p, nil
+}
+
+// PartnerExists reports whether a partner ID is in the database
+// IDs that are not UUIDs do not exist rather than failing the query
+func PartnerExists(ctx context.Context, q Querier, id string) (bool, error) {
+	var exists bool
+	err := q.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM partner WHERE id::text = $1)`, id).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,40 @@
+// Package repository holds typed queries of the transit and partner tables
+// that several handlers share, so each is written, filtered and scanned once
+// Optional filters are bound as NULL instead of being spliced into the SQL,
+// so every query is a constant string
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Querier runs the queries: a *pgxpool.Pool (db.GetDB, db.ReadDB), a
+// pgx.Tx or a *pgx.Conn
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// ErrNotFound is returned when a looked up row does not exist
+var ErrNotFound = errors.New("not found")
+
+// optional binds "" as NULL, which skips a `$n::text IS NULL OR ...` filter
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// notFound maps pgx.ErrNoRows to ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptional(t *testing.T) {
+	assert.Nil(t, optional(""))
+	if v := optional("BUS"); assert.NotNil(t, v) {
+		assert.Equal(t, "BUS", *v)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	assert.ErrorIs(t, notFound(pgx.ErrNoRows), ErrNotFound)
+	assert.ErrorIs(t, notFound(fmt.Errorf("scan: %w", pgx.ErrNoRows)), ErrNotFound)
+
+	other := errors.New("connection reset")
+	assert.Equal(t, other, notFound(other))
+}
+
+// testTx returns a transaction on the migrated database in TEST_DATABASE_URL,
+// rolled back when the test ends, holding a small two-agency network
+func testTx(t *testing.T) pgx.Tx {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, url)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { conn.Close(ctx) })
+
+	tx, err := conn.Begin(ctx)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { tx.Rollback(ctx) })
+
+	fixtures := []string{
+		`INSERT INTO stop (id, name, lat, lon) VALUES
+			('repo_s1', 'Petersen', 14.6700, -17.4300),
+			('repo_s2', 'Colobane', 14.6850, -17.4450),
+			('repo_s3', 'Grand Yoff', 14.7300, -17.4600)`,
+		`INSERT INTO route (id, agency_id, short_name, long_name, mode) VALUES
+			('repo_r1', 'repo_ddd', '7', 'Petersen - Grand Yoff', 'BUS'),
+			('repo_r2', 'repo_ddd', NULL, 'Petersen - Colobane', 'BUS'),
+			('repo_r3', 'repo_brt', NULL, NULL, 'BRT')`,
+		`INSERT INTO node (stop_id, route_id, mode) VALUES
+			('repo_s1', 'repo_r1', 'BUS'), ('repo_s2', 'repo_r1', 'BUS'), ('repo_s3', 'repo_r1', 'BUS'),
+			('repo_s1', 'repo_r2', 'BUS')`,
+		`INSERT INTO trip (trip_id, agency_id, route_id, service_id, headsign, direction) VALUES
+			('repo_t1', 'repo_ddd', 'repo_r1', 'weekday', 'Grand Yoff', 0),
+			('repo_t2', 'repo_ddd', 'repo_r1', 'weekday', 'Grand Yoff', 0),
+			('repo_t3', 'repo_ddd', 'repo_r1', 'sunday', 'Petersen', 1)`,
+		`INSERT INTO stop_time (trip_id, agency_id, stop_id, stop_sequence, arrival_time, departure_time) VALUES
+			('repo_t1', 'repo_ddd', 'repo_s1', 1, NULL, '08:00:00'),
+			('repo_t1', 'repo_ddd', 'repo_s2', 2, '08:10:00', '08:11:00'),
+			('repo_t1', 'repo_ddd', 'repo_s3', 3, '08:25:00', NULL),
+			('repo_t2', 'repo_ddd', 'repo_s1', 1, NULL, '07:30:00'),
+			('repo_t2', 'repo_ddd', 'repo_s2', 2, '07:40:00', '07:41:00'),
+			('repo_t3', 'repo_ddd', 'repo_s3', 1, NULL, '09:00:00')`,
+	}
+	for _, sql := range fixtures {
+		if _, err := tx.Exec(ctx, sql); !assert.NoError(t, err) {
+			t.FailNow()
+		}
+	}
+	return tx
+}
+
+func TestStopsAndRoutes(t *testing.T) {
+	tx := testTx(t)
+	ctx := context.Background()
+
+	stop, err := GetStop(ctx, tx, "repo_s2")
+	if assert.NoError(t, err) {
+		assert.Equal(t, Stop{ID: "repo_s2", Name: "Colobane", Lat: 14.6850, Lon: -17.4450}, *stop)
+	}
+	_, err = GetStop(ctx, tx, "repo_missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	t.Run("Names a route by short name, long name, then ID", func(t *testing.T) {
+		for id, name := range map[string]string{"repo_r1": "7", "repo_r2": "Petersen - Colobane", "repo_r3": "repo_r3"} {
+			route, err := GetRoute(ctx, tx, id)
+			if assert.NoError(t, err) {
+				assert.Equal(t, name, route.Name)
+			}
+		}
+		_, err := GetRoute(ctx, tx, "repo_missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("Checks existence", func(t *testing.T) {
+		exists, err := StopExists(ctx, tx, "repo_s1")
+		assert.NoError(t, err)
+		assert.True(t, exists)
+		exists, err = RouteExists(ctx, tx, "repo_missing")
+		assert.NoError(t, err)
+		assert.False(t, exists)
+		exists, err = TripExists(ctx, tx, "repo_t3")
+		assert.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("Filters and pages routes", func(t *testing.T) {
+		routes, err := ListRoutes(ctx, tx, RouteFilter{AgencyID: "repo_ddd", Limit: 10})
+		if assert.NoError(t, err) && assert.Len(t, routes, 2) {
+			assert.Equal(t, RouteSummary{ID: "repo_r1", Name: "7", Mode: "BUS", AgencyID: "repo_ddd", StopsCount: 3}, routes[0])
+			assert.Equal(t, 1, routes[1].StopsCount)
+		}
+
+		routes, err = ListRoutes(ctx, tx, RouteFilter{Mode: "brt", Agencies: []string{"repo_brt"}, Limit: 10})
+		if assert.NoError(t, err) && assert.Len(t, routes, 1) {
+			assert.Equal(t, "repo_r3", routes[0].ID)
+		}
+
+		routes, err = ListRoutes(ctx, tx, RouteFilter{AgencyID: "repo_ddd", After: "repo_r1", Limit: 10})
+		if assert.NoError(t, err) && assert.Len(t, routes, 1) {
+			assert.Equal(t, "repo_r2", routes[0].ID)
+		}
+
+		routes, err = ListRoutes(ctx, tx, RouteFilter{AgencyID: "repo_ddd", Agencies: []string{"repo_brt"}, Limit: 10})
+		assert.NoError(t, err)
+		assert.Empty(t, routes)
+	})
+}
+
+func TestTrips(t *testing.T) {
+	tx := testTx(t)
+	ctx := context.Background()
+	outbound := 0
+
+	t.Run("Counts and pages a route's trips", func(t *testing.T) {
+		all := TripFilter{RouteID: "repo_r1"}
+		total, err := CountTrips(ctx, tx, all)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, total)
+
+		total, err = CountTrips(ctx, tx, TripFilter{RouteID: "repo_r1", ServiceID: "weekday", Direction: &outbound})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, total)
+
+		trips, err := ListTrips(ctx, tx, all, Page{Limit: 2})
+		if assert.NoError(t, err) && assert.Len(t, trips, 2) {
+			assert.Equal(t, Trip{TripID: "repo_t1", AgencyID: "repo_ddd", ServiceID: "weekday", Headsign: "Grand Yoff"}, trips[0])
+			assert.Equal(t, "repo_t2", trips[1].TripID)
+		}
+
+		trips, err = ListTrips(ctx, tx, all, Page{After: "repo_t1", Limit: 10, Offset: 1})
+		if assert.NoError(t, err) && assert.Len(t, trips, 1) {
+			assert.Equal(t, "repo_t3", trips[0].TripID)
+		}
+	})
+
+	t.Run("Orders a timetable by first departure", func(t *testing.T) {
+		trips, err := TripsByDeparture(ctx, tx, TripFilter{RouteID: "repo_r1", Direction: &outbound}, 50)
+		if assert.NoError(t, err) && assert.Len(t, trips, 2) {
+			assert.Equal(t, "repo_t2", trips[0].TripID)
+			assert.Equal(t, "repo_t1", trips[1].TripID)
+		}
+	})
+
+	t.Run("Reads stop times and the stop sequence", func(t *testing.T) {
+		times, err := TripStopTimes(ctx, tx, "repo_ddd", "repo_t1")
+		if assert.NoError(t, err) && assert.Len(t, times, 3) {
+			assert.Equal(t, StopTime{StopID: "repo_s1", StopName: "Petersen", Sequence: 1, DepartureTime: "08:00:00"}, times[0])
+			assert.Equal(t, "08:25:00", times[2].ArrivalTime)
+			assert.Equal(t, "", times[2].DepartureTime)
+		}
+
+		times, err = TripStopTimes(ctx, tx, "repo_brt", "repo_t1")
+		assert.NoError(t, err)
+		assert.Empty(t, times)
+
+		stops, err := RouteStopSequence(ctx, tx, TripFilter{RouteID: "repo_r1", ServiceID: "weekday"})
+		if assert.NoError(t, err) && assert.Len(t, stops, 3) {
+			assert.Equal(t, RouteStop{ID: "repo_s3", Name: "Grand Yoff", Sequence: 3}, stops[2])
+		}
+	})
+}
+
+func TestPartners(t *testing.T) {
+	tx := testTx(t)
+	ctx := context.Background()
+
+	var id string
+	err := tx.QueryRow(ctx, `
+		INSERT INTO partner (name, email, rate_limit_per_second)
+		VALUES ('Repository Test', 'repository-test@passbi.example', 5)
+		RETURNING id
+	`).Scan(&id)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	p, err := GetPartner(ctx, tx, id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Repository Test", p.Name)
+		assert.Equal(t, "", p.Company)
+		assert.Equal(t, "active", p.Status)
+		assert.GreaterOrEqual(t, p.RateLimitBurst, p.RateLimitPerSecond)
+		assert.Nil(t, p.LastActiveAt)
+	}
+
+	_, err = GetPartner(ctx, tx, "00000000-0000-0000-0000-000000000000")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	exists, err := PartnerExists(ctx, tx, id)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = PartnerExists(ctx, tx, "not-a-uuid")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Trip is a row of trip
+type Trip struct {
+	TripID    string
+	AgencyID  string
+	ServiceID string
+	Headsign  string
+	Direction int
+}
+
+// TripFilter selects the trips of a route; zero fields do not filter
+type TripFilter struct {
+	RouteID   string
+	ServiceID string
+	Direction *int
+}
+
+// Page is a page of a listing ordered by ID
+// After pages by ID and may be combined with Offset
+type Page struct {
+	After  string
+	Limit  int
+	Offset int
+}
+
+// TripExists reports whether a trip ID is in the database, for any agency
+func TripExists(ctx context.Context, q Querier, tripID string) (bool, error) {
+	var exists bool
+	err := q.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM trip WHERE trip_id = $1)`, tripID).Scan(&exists)
+	return exists, err
+}
+
+// CountTrips returns how many trips match f
+func CountTrips(ctx context.Context, q Querier, f TripFilter) (int, error) {
+	var total int
+	err := q.QueryRow(ctx, `
+		SELECT COUNT(*) FROM trip
+		WHERE route_id = $1
+			AND ($2::text IS NULL OR service_id = $2)
+			AND ($3::int IS NULL OR direction = $3)
+	`, f.RouteID, optional(f.ServiceID), f.Direction).Scan(&total)
+	return total, err
+}
+
+// ListTrips returns a page of the trips matching f, ordered by trip ID
+func ListTrips(ctx context.Context, q Querier, f TripFilter, p Page) ([]Trip, error) {
+	return queryTrips(ctx, q, `
+		SELECT trip_id, agency_id, service_id, COALESCE(headsign, ''), direction
+		FROM trip
+		WHERE route_id = $1
+			AND ($2::text IS NULL OR service_id = $2)
+			AND ($3::int IS NULL OR direction = $3)
+			AND ($4::text IS NULL OR trip_id > $4)
+		ORDER BY trip_id
+		LIMIT $5 OFFSET $6
+	`, f.RouteID, optional(f.ServiceID), f.Direction, optional(p.After), p.Limit, p.Offset)
+}
+
+// TripsByDeparture returns up to limit trips matching f, ordered by the time
+// they leave their first stop, as a timetable lists them
+func TripsByDeparture(ctx context.Context, q Querier, f TripFilter, limit int) ([]Trip, error) {
+	return queryTrips(ctx, q, `
+		SELECT t.trip_id, t.agency_id, t.service_id, COALESCE(t.headsign, ''), t.direction
+		FROM trip t
+		WHERE t.route_id = $1
+			AND ($2::text IS NULL OR t.service_id = $2)
+			AND ($3::int IS NULL OR t.direction = $3)
+		ORDER BY (SELECT st.departure_time FROM stop_time st
+			WHERE st.trip_id = t.trip_id AND st.agency_id = t.agency_id
+			ORDER BY st.stop_sequence LIMIT 1)
+		LIMIT $4
+	`, f.RouteID, optional(f.ServiceID), f.Direction, limit)
+}
+
+func queryTrips(ctx context.Context, q Querier, sql string, args ...any) ([]Trip, error) {
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trips := []Trip{}
+	for rows.Next() {
+		var t Trip
+		if err := rows.Scan(&t.TripID, &t.AgencyID, &t.ServiceID, &t.Headsign, &t.Direction); err != nil {
+			return nil, err
+		}
+		trips = append(trips, t)
+	}
+	return trips, rows.Err()
+}
+
+// StopTime is a scheduled call of a trip at a stop
+// Times are GTFS "HH:MM:SS" strings, "" when the feed left them out
+type StopTime struct {
+	StopID        string
+	StopName      string
+	Sequence      int
+	ArrivalTime   string
+	DepartureTime string
+}
+
+// TripStopTimes returns a trip's stop times in order
+func TripStopTimes(ctx context.Context, q Querier, agencyID, tripID string) ([]StopTime, error) {
+	rows, err := q.Query(ctx, `
+		SELECT st.stop_id, s.name, st.stop_sequence,
+			COALESCE(st.arrival_time, ''), COALESCE(st.departure_time, '')
+		FROM stop_time st
+		JOIN stop s ON s.id = st.stop_id
+		WHERE st.trip_id = $1 AND st.agency_id = $2
+		ORDER BY st.stop_sequence
+	`, tripID, agencyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stops := []StopTime{}
+	for rows.Next() {
+		var s StopTime
+		if err := rows.Scan(&s.StopID, &s.StopName, &s.Sequence, &s.ArrivalTime, &s.DepartureTime); err != nil {
+			return nil, err
+		}
+		stops = append(stops, s)
+	}
+	return stops, rows.Err()
+}
+
+// RouteStop is a stop of a route's stop sequence
+type RouteStop struct {
+	ID       string
+	Name     string
+	Sequence int
+}
+
+// RouteStopSequence returns the stop at each stop_sequence of the trips
+// matching f, up to 100 stops
+func RouteStopSequence(ctx context.Context, q Querier, f TripFilter) ([]RouteStop, error) {
+	rows, err := q.Query(ctx, `
+		SELECT DISTINCT ON (st.stop_sequence) st.stop_id, s.name, st.stop_sequence
+		FROM stop_time st
+		JOIN trip t ON st.trip_id = t.trip_id AND st.agency_id = t.agency_id
+		JOIN stop s ON s.id = st.stop_id
+		WHERE t.route_id = $1
+			AND ($2::text IS NULL OR t.service_id = $2)
+			AND ($3::int IS NULL OR t.direction = $3)
+		ORDER BY st.stop_sequence
+		LIMIT 100
+	`, f.RouteID, optional(f.ServiceID), f.Direction)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stops := []RouteStop{}
+	for rows.Next() {
+		var s RouteStop
+		if err := rows.Scan(&s.ID, &s.Name, &s.Sequence); err != nil {
+			return nil, err
+		}
+		stops = append(stops, s)
+	}
+	return stops, rows.Err()
+}
+
+// ActiveServicesCTE returns an "active_services" CTE listing the
+// (service_id, agency_id) pairs running on date, bound to dateParam
+func ActiveServicesCTE(date time.Time, dateParam string) string {
+	// Map Go's Weekday() to the calendar column name
+	dayColumns := [7]string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+	dayCol := dayColumns[date.Weekday()]
+
+	return fmt.Sprintf(`active_services AS (
+			-- Tier 1: Valid calendars (date within range + day-of-week match)
+			SELECT DISTINCT c.service_id, c.agency_id
+			FROM calendar c
+			WHERE %[2]s::date BETWEEN c.start_date AND c.end_date
+			  AND c.%[1]s = true
+			  AND NOT EXISTS (
+				SELECT 1 FROM calendar_date cd
+				WHERE cd.service_id = c.service_id
+				  AND cd.agency_id = c.agency_id
+				  AND cd.date = %[2]s::date
+				  AND cd.exception_type = 2
+			  )
+
+			UNION
+
+			-- Tier 2: Expired calendars - match day-of-week only (stale GTFS feeds still running)
+			SELECT DISTINCT c.service_id, c.agency_id
+			FROM calendar c
+			WHERE c.end_date < %[2]s::date
+			  AND c.%[1]s = true
+
+			UNION
+
+			-- Tier 3: calendar_date additions for today
+			SELECT cd.service_id, cd.agency_id
+			FROM calendar_date cd
+			WHERE cd.date = %[2]s::date
+			  AND cd.exception_type = 1
+
+			UNION
+
+			-- Tier 4: Agencies with NO calendar (BRT) - derive DOW from calendar_dates pattern
+			SELECT DISTINCT cd.service_id, cd.agency_id
+			FROM calendar_date cd
+			WHERE cd.exception_type = 1
+			  AND EXTRACT(DOW FROM cd.date) = EXTRACT(DOW FROM %[2]s::date)
+			  AND NOT EXISTS (
+				SELECT 1 FROM calendar c
+				WHERE c.service_id = cd.service_id AND c.agency_id = cd.agency_id
+			  )
+		)`, dayCol, dateParam)
+}
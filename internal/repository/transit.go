@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+)
+
+// Stop is a row of stop
+type Stop struct {
+	ID   string
+	Name string
+	Lat  float64
+	Lon  float64
+}
+
+// GetStop returns the stop with the given ID
+func GetStop(ctx context.Context, q Querier, id string) (*Stop, error) {
+	var s Stop
+	err := q.QueryRow(ctx, `SELECT id, name, lat, lon FROM stop WHERE id = $1`, id).
+		Scan(&s.ID, &s.Name, &s.Lat, &s.Lon)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &s, nil
+}
+
+// StopExists reports whether a stop ID is in the database
+func StopExists(ctx context.Context, q Querier, id string) (bool, error) {
+	var exists bool
+	err := q.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM stop WHERE id = $1)`, id).Scan(&exists)
+	return exists, err
+}
+
+// Route is a row of route; Name is the short name, else the long name, else the ID
+type Route struct {
+	ID       string
+	Name     string
+	Mode     string
+	AgencyID string
+}
+
+// GetRoute returns the route with the given ID
+func GetRoute(ctx context.Context, q Querier, id string) (*Route, error) {
+	var r Route
+	err := q.QueryRow(ctx, `
+		SELECT id, COALESCE(short_name, long_name, id), mode, agency_id
+		FROM route WHERE id = $1
+	`, id).Scan(&r.ID, &r.Name, &r.Mode, &r.AgencyID)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &r, nil
+}
+
+// RouteNames returns the names of the given routes, as GetRoute names them;
+// unknown routes are left out
+func RouteNames(ctx context.Context, q Querier, ids []string) (map[string]string, error) {
+	rows, err := q.Query(ctx, `
+		SELECT id, COALESCE(short_name, long_name, id) FROM route WHERE id = ANY($1)
+	`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[string]string, len(ids))
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		names[id] = name
+	}
+	return names, rows.Err()
+}
+
+// RouteExists reports whether a route ID is in the database
+func RouteExists(ctx context.Context, q Querier, id string) (bool, error) {
+	var exists bool
+	err := q.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM route WHERE id = $1)`, id).Scan(&exists)
+	return exists, err
+}
+
+// RouteFilter narrows ListRoutes; zero fields do not filter
+// Agencies is an API key's restriction and applies on top of AgencyID
+type RouteFilter struct {
+	Mode     string // case-insensitive
+	AgencyID string
+	Agencies []string
+	After    string // only routes whose ID sorts after it
+	Limit    int
+}
+
+// RouteSummary is a route with the number of stops it serves
+type RouteSummary struct {
+	ID         string
+	Name       string
+	Mode       string
+	AgencyID   string
+	StopsCount int
+}
+
+// ListRoutes returns the routes matching f, ordered by ID
+func ListRoutes(ctx context.Context, q Querier, f RouteFilter) ([]RouteSummary, error) {
+	var agencies []string
+	if len(f.Agencies) > 0 {
+		agencies = f.Agencies
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT
+			r.id,
+			COALESCE(r.short_name, r.long_name, r.id) AS name,
+			r.mode,
+			r.agency_id,
+			COUNT(DISTINCT n.stop_id) AS stops_count
+		FROM route r
+		LEFT JOIN node n ON n.route_id = r.id
+		WHERE ($1::text IS NULL OR UPPER(r.mode) = UPPER($1))
+			AND ($2::text IS NULL OR r.agency_id = $2)
+			AND ($3::text[] IS NULL OR r.agency_id = ANY($3))
+			AND ($4::text IS NULL OR r.id > $4)
+		GROUP BY r.id, r.short_name, r.long_name, r.mode, r.agency_id
+		ORDER BY r.id
+		LIMIT $5
+	`, optional(f.Mode), optional(f.AgencyID), agencies, optional(f.After), f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	routes := []RouteSummary{}
+	for rows.Next() {
+		var r RouteSummary
+		if err := rows.Scan(&r.ID, &r.Name, &r.Mode, &r.AgencyID, &r.StopsCount); err != nil {
+			return nil, err
+		}
+		routes = append(routes, r)
+	}
+	return routes, rows.Err()
+}
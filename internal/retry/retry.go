@@ -0,0 +1,84 @@
+// Package retry retries an operation with exponential backoff until it
+// succeeds or a deadline passes
+// Services use it at startup, when Postgres or Redis may still be coming up
+// (a deploy restarting them at the same time as the API)
+package retry
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/logging"
+)
+
+var logger = logging.For("retry")
+
+// Config bounds the retries of an operation
+type Config struct {
+	Initial  time.Duration // wait after the first failure, doubled after each failure
+	Max      time.Duration // longest wait between attempts
+	Deadline time.Duration // give up once this long has passed since the first attempt (0: a single attempt)
+}
+
+// DefaultConfig retries for a minute, waiting 500ms to 10s between attempts
+func DefaultConfig() Config {
+	return Config{
+		Initial:  500 * time.Millisecond,
+		Max:      10 * time.Second,
+		Deadline: time.Minute,
+	}
+}
+
+// StartupConfigFromEnv reads the retries of startup connections from
+// STARTUP_RETRY_DEADLINE and STARTUP_RETRY_MAX_WAIT (Go durations)
+func StartupConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	if d, err := time.ParseDuration(os.Getenv("STARTUP_RETRY_DEADLINE")); err == nil && d >= 0 {
+		cfg.Deadline = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("STARTUP_RETRY_MAX_WAIT")); err == nil && d > 0 {
+		cfg.Max = d
+	}
+	return cfg
+}
+
+// wait returns how long to wait after the given number of failed attempts
+func (c Config) wait(failures int) time.Duration {
+	d := c.Initial
+	for i := 1; i < failures && d < c.Max; i++ {
+		d *= 2
+	}
+	return min(d, c.Max)
+}
+
+// Do calls op until it returns nil, ctx is canceled or cfg.Deadline has
+// passed, logging each failure; it returns the last error
+// what names the operation in logs and errors ("database", "redis")
+func Do(ctx context.Context, cfg Config, what string, op func(context.Context) error) error {
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := op(ctx)
+		if err == nil {
+			if attempt > 1 {
+				logger.InfoContext(ctx, "Connected after retries", "to", what,
+					"attempts", attempt, "after", time.Since(start).Round(time.Millisecond).String())
+			}
+			return nil
+		}
+
+		wait := cfg.wait(attempt)
+		if time.Since(start)+wait > cfg.Deadline {
+			return fmt.Errorf("%s unavailable after %d attempts: %w", what, attempt, err)
+		}
+		logger.WarnContext(ctx, "Unavailable, retrying", "to", what,
+			"attempt", attempt, "retry_in", wait.String(), "error", err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s unavailable: %w", what, ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWait(t *testing.T) {
+	cfg := Config{Initial: 100 * time.Millisecond, Max: time.Second, Deadline: time.Minute}
+	assert.Equal(t, 100*time.Millisecond, cfg.wait(1))
+	assert.Equal(t, 200*time.Millisecond, cfg.wait(2))
+	assert.Equal(t, 800*time.Millisecond, cfg.wait(4))
+	assert.Equal(t, time.Second, cfg.wait(5))
+	assert.Equal(t, time.Second, cfg.wait(100))
+}
+
+func TestDo(t *testing.T) {
+	cfg := Config{Initial: time.Millisecond, Max: 5 * time.Millisecond, Deadline: time.Second}
+	down := errors.New("connection refused")
+
+	calls := 0
+	err := Do(context.Background(), cfg, "database", func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return down
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	// Gives up at the deadline with the last error
+	cfg.Deadline = 20 * time.Millisecond
+	calls = 0
+	err = Do(context.Background(), cfg, "redis", func(context.Context) error {
+		calls++
+		return down
+	})
+	assert.ErrorIs(t, err, down)
+	assert.Contains(t, err.Error(), "redis unavailable")
+	assert.Greater(t, calls, 1)
+
+	// No deadline: a single attempt
+	calls = 0
+	err = Do(context.Background(), Config{Initial: time.Millisecond, Max: time.Millisecond}, "redis", func(context.Context) error {
+		calls++
+		return down
+	})
+	assert.ErrorIs(t, err, down)
+	assert.Equal(t, 1, calls)
+
+	// Canceled while waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = Do(ctx, Config{Initial: time.Hour, Max: time.Hour, Deadline: 2 * time.Hour}, "database", func(context.Context) error {
+		return down
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestStartupConfigFromEnv(t *testing.T) {
+	t.Setenv("STARTUP_RETRY_DEADLINE", "")
+	t.Setenv("STARTUP_RETRY_MAX_WAIT", "")
+	assert.Equal(t, DefaultConfig(), StartupConfigFromEnv())
+
+	t.Setenv("STARTUP_RETRY_DEADLINE", "5m")
+	t.Setenv("STARTUP_RETRY_MAX_WAIT", "30s")
+	cfg := StartupConfigFromEnv()
+	assert.Equal(t, 5*time.Minute, cfg.Deadline)
+	assert.Equal(t, 30*time.Second, cfg.Max)
+
+	t.Setenv("STARTUP_RETRY_DEADLINE", "0")
+	assert.Equal(t, time.Duration(0), StartupConfigFromEnv().Deadline)
+}
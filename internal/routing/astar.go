@@ -11,6 +11,7 @@ import (
 
 	"github.com/passbi/passbi_core/internal/graph"
 	"github.com/passbi/passbi_core/internal/models"
+	"github.com/passbi/passbi_core/internal/tracing"
 )
 
 // getMaxExploredNodes reads MAX_EXPLORED_NODES from env or returns default
@@ -35,7 +36,8 @@ func getRoutingTimeout() time.Duration {
 
 // Router handles pathfinding operations using in-memory graph
 type Router struct {
-	graph *graph.InMemoryGraph
+	graph    *graph.InMemoryGraph
+	agencies map[string]bool // nil: every agency
 }
 
 // NewRouter creates a new router instance using the in-memory graph
@@ -43,8 +45,48 @@ func NewRouter() *Router {
 	return &Router{graph: graph.GetGraph()}
 }
 
+// WithAgencies restricts paths to the routes of the given agencies
+// An empty list lifts the restriction
+func (r *Router) WithAgencies(agencies []string) *Router {
+	r.agencies = nil
+	if len(agencies) > 0 {
+		r.agencies = make(map[string]bool, len(agencies))
+		for _, a := range agencies {
+			r.agencies[a] = true
+		}
+	}
+	return r
+}
+
+// allows reports whether paths may go through a node
+func (r *Router) allows(node models.Node) bool {
+	return r.agencies == nil || r.agencies[node.AgencyID]
+}
+
+// allowedNodes keeps the nodes paths may go through
+func (r *Router) allowedNodes(nodes []models.Node) []models.Node {
+	if r.agencies == nil {
+		return nodes
+	}
+	allowed := nodes[:0:0]
+	for _, n := range nodes {
+		if r.allows(n) {
+			allowed = append(allowed, n)
+		}
+	}
+	return allowed
+}
+
+// maxWalkEdgeM is the longest walk edge a path may take, in meters
+const maxWalkEdgeM = 200
+
 // FindPath finds a route from origin to destination using the specified strategy
 func (r *Router) FindPath(ctx context.Context, fromLat, fromLon, toLat, toLon float64, strategy Strategy) (*models.Path, error) {
+	return r.findPath(ctx, fromLat, fromLon, toLat, toLon, strategy, nil)
+}
+
+// findPath is FindPath; trace, when set, records how the search went
+func (r *Router) findPath(ctx context.Context, fromLat, fromLon, toLat, toLon float64, strategy Strategy, trace *searchTrace) (*models.Path, error) {
 	// Create context with timeout
 	ctx, cancel := context.WithTimeout(ctx, getRoutingTimeout())
 	defer cancel()
@@ -53,17 +95,41 @@ func (r *Router) FindPath(ctx context.Context, fromLat, fromLon, toLat, toLon fl
 		return nil, fmt.Errorf("graph not loaded into memory")
 	}
 
+	// Every search that reaches the graph feeds the routing telemetry
+	stats := SearchStats{
+		Strategy:   strategy.Name(),
+		FromLat:    fromLat,
+		FromLon:    fromLon,
+		ToLat:      toLat,
+		ToLon:      toLon,
+		StartSnapM: -1,
+		GoalSnapM:  -1,
+	}
+	start := time.Now()
+	defer func() {
+		stats.Duration = time.Since(start)
+		recordSearch(stats)
+		if trace != nil {
+			trace.stats = stats
+		}
+	}()
+
 	// Find candidate start nodes (nearest stops to origin) - in-memory
 	// Higher limit to include BRT/TER stops from wider search radius
-	startNodes := r.graph.FindNearestNodes(fromLat, fromLon, 20)
+	startNodes := r.allowedNodes(r.graph.FindNearestNodes(fromLat, fromLon, 20))
+	stats.StartNodes, stats.StartSnapM = len(startNodes), snapDistance(startNodes, fromLat, fromLon)
 	if len(startNodes) == 0 {
-		return nil, fmt.Errorf("no start nodes found near origin")
+		return nil, stats.fail(OutcomeNoStart, "no start nodes found near origin")
 	}
 
 	// Find candidate goal nodes (nearest stops to destination) - in-memory
-	goalNodes := r.graph.FindNearestNodes(toLat, toLon, 20)
+	goalNodes := r.allowedNodes(r.graph.FindNearestNodes(toLat, toLon, 20))
+	stats.GoalNodes, stats.GoalSnapM = len(goalNodes), snapDistance(goalNodes, toLat, toLon)
+	if trace != nil {
+		trace.startNodes, trace.goalNodes = startNodes, goalNodes
+	}
 	if len(goalNodes) == 0 {
-		return nil, fmt.Errorf("no goal nodes found near destination")
+		return nil, stats.fail(OutcomeNoGoal, "no goal nodes found near destination")
 	}
 
 	// Build goal node set for quick lookup
@@ -73,7 +139,7 @@ func (r *Router) FindPath(ctx context.Context, fromLat, fromLon, toLat, toLon fl
 	}
 
 	// Run A* search - entirely in-memory
-	path, err := r.astar(ctx, startNodes, goalSet, toLat, toLon, strategy)
+	path, err := r.astar(ctx, startNodes, goalSet, toLat, toLon, strategy, &stats, trace)
 	if err != nil {
 		return nil, err
 	}
@@ -111,13 +177,35 @@ func (r *Router) FindPath(ctx context.Context, fromLat, fromLon, toLat, toLon fl
 }
 
 // astar implements the A* pathfinding algorithm using in-memory graph
-func (r *Router) astar(ctx context.Context, startNodes []models.Node, goalSet map[int64]models.Node, goalLat, goalLon float64, strategy Strategy) (*searchPath, error) {
+// stats receives the explored nodes, the open set peak and the outcome
+func (r *Router) astar(ctx context.Context, startNodes []models.Node, goalSet map[int64]models.Node, goalLat, goalLon float64, strategy Strategy, stats *SearchStats, trace *searchTrace) (found *searchPath, err error) {
+	exploredCount := 0
+	peakQueue := 0
+	_, span := tracing.Start(ctx, "routing.astar",
+		tracing.String("routing.strategy", strategy.Name()),
+		tracing.Int("routing.start_nodes", len(startNodes)),
+		tracing.Int("routing.goal_nodes", len(goalSet)),
+	)
+	defer func() {
+		stats.ExploredNodes, stats.PeakQueue = exploredCount, peakQueue
+		span.SetAttributes(
+			tracing.Int("routing.explored_nodes", exploredCount),
+			tracing.Int("routing.queue_peak", peakQueue),
+			tracing.String("routing.outcome", stats.Outcome),
+		)
+		span.RecordError(err)
+		span.End()
+	}()
+
 	// Initialize open set (priority queue)
 	openSet := &PriorityQueue{}
 	heap.Init(openSet)
 
 	// Track best gScore to each node (just the cost, not the full path)
 	bestG := make(map[int64]int)
+	if trace != nil {
+		trace.bestG = bestG
+	}
 
 	// Add all start nodes to open set
 	for _, node := range startNodes {
@@ -134,22 +222,26 @@ func (r *Router) astar(ctx context.Context, startNodes []models.Node, goalSet ma
 		bestG[node.ID] = 0
 	}
 
-	exploredCount := 0
 	maxNodes := getMaxExploredNodes()
+	stats.MaxExplored = maxNodes
 
 	for openSet.Len() > 0 {
+		if openSet.Len() > peakQueue {
+			peakQueue = openSet.Len()
+		}
+
 		// Check timeout periodically (every 1000 nodes to reduce overhead)
 		if exploredCount%1000 == 0 {
 			select {
 			case <-ctx.Done():
-				return nil, fmt.Errorf("routing timeout exceeded after exploring %d nodes", exploredCount)
+				return nil, stats.fail(OutcomeTimeout, "routing timeout exceeded after exploring %d nodes", exploredCount)
 			default:
 			}
 		}
 
 		// Check exploration limit
 		if exploredCount > maxNodes {
-			return nil, fmt.Errorf("explored too many nodes (%d), no path found", exploredCount)
+			return nil, stats.fail(OutcomeNodeLimit, "explored too many nodes (%d), no path found", exploredCount)
 		}
 
 		// Pop node with lowest fScore
@@ -163,6 +255,7 @@ func (r *Router) astar(ctx context.Context, startNodes []models.Node, goalSet ma
 
 		// Check if we reached goal
 		if _, isGoal := goalSet[current.nodeID]; isGoal {
+			stats.Outcome = OutcomeFound
 			return current, nil
 		}
 
@@ -173,6 +266,9 @@ func (r *Router) astar(ctx context.Context, startNodes []models.Node, goalSet ma
 			ExploredNodes: exploredCount,
 		}
 		if strategy.ShouldStop(state) {
+			if trace != nil {
+				trace.stopped++
+			}
 			continue
 		}
 
@@ -182,33 +278,24 @@ func (r *Router) astar(ctx context.Context, startNodes []models.Node, goalSet ma
 		// Explore neighbors
 		for _, edge := range neighbors {
 			// Skip walk edges longer than 200m
-			if edge.Type == models.EdgeWalk && edge.CostWalk > 200 {
+			if edge.Type == models.EdgeWalk && edge.CostWalk > maxWalkEdgeM {
 				continue
 			}
 
 			// Get neighbor node info from in-memory graph (instant lookup)
 			neighborNode, ok := r.graph.GetNode(edge.ToNodeID)
-			if !ok {
+			if !ok || !r.allows(neighborNode) {
 				continue
 			}
 
 			// Calculate tentative gScore
-			edgeCost := strategy.EdgeCost(edge)
-
-			// Mode bonus: BRT/TER rides are cheaper (faster, higher capacity)
-			if edge.Type == models.EdgeRide {
-				switch neighborNode.Mode {
-				case models.ModeTER:
-					edgeCost = edgeCost * 50 / 100 // TER: 50% cost (train is fastest)
-				case models.ModeBRT:
-					edgeCost = edgeCost * 65 / 100 // BRT: 65% cost (dedicated lanes)
-				}
-			}
-
-			tentativeG := current.gScore + edgeCost
+			tentativeG := current.gScore + edgeCost(strategy, edge, neighborNode)
 
 			// Check if this is a better path
 			if existingG, ok := bestG[edge.ToNodeID]; ok && tentativeG >= existingG {
+				if trace != nil {
+					trace.reached(goalSet, current, edge, neighborNode, tentativeG, false)
+				}
 				continue
 			}
 
@@ -235,10 +322,41 @@ func (r *Router) astar(ctx context.Context, startNodes []models.Node, goalSet ma
 
 			bestG[edge.ToNodeID] = tentativeG
 			heap.Push(openSet, newPath)
+			if trace != nil {
+				trace.reached(goalSet, current, edge, neighborNode, tentativeG, true)
+			}
 		}
 	}
 
-	return nil, fmt.Errorf("no path found after exploring %d nodes", exploredCount)
+	return nil, stats.fail(OutcomeNoPath, "no path found after exploring %d nodes", exploredCount)
+}
+
+// edgeCost is the cost of edge to a strategy, leading to node to
+func edgeCost(strategy Strategy, edge models.Edge, to models.Node) int {
+	cost := strategy.EdgeCost(edge)
+
+	// Mode bonus: BRT/TER rides are cheaper (faster, higher capacity)
+	if edge.Type == models.EdgeRide {
+		switch to.Mode {
+		case models.ModeTER:
+			cost = cost * 50 / 100 // TER: 50% cost (train is fastest)
+		case models.ModeBRT:
+			cost = cost * 65 / 100 // BRT: 65% cost (dedicated lanes)
+		}
+	}
+	return cost
+}
+
+// snapDistance is the distance in meters from a point to the nearest of
+// nodes, or -1 without nodes
+func snapDistance(nodes []models.Node, lat, lon float64) float64 {
+	best := -1.0
+	for _, n := range nodes {
+		if d := haversineDistance(lat, lon, n.Lat, n.Lon); best < 0 || d < best {
+			best = d
+		}
+	}
+	return best
 }
 
 // buildSteps constructs user-friendly step-by-step directions
@@ -0,0 +1,40 @@
+package routing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/passbi/passbi_core/internal/graph"
+	"github.com/passbi/passbi_core/internal/gtfs"
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindPathDemoCity(t *testing.T) {
+	opts := gtfs.DefaultDemoOptions()
+	feed, err := gtfs.GenerateDemo(opts)
+	if !assert.NoError(t, err) {
+		return
+	}
+	g := &graph.InMemoryGraph{}
+	if !assert.NoError(t, g.LoadFromFeeds(context.Background(), map[string]*gtfs.GTFSFeed{opts.AgencyID: feed})) {
+		return
+	}
+	r := &Router{graph: g}
+
+	// From the south-west corner to the north-east one, 3.4 km apart
+	from, to := feed.Stops[0], feed.Stops[len(feed.Stops)-1]
+	for _, s := range GetAllStrategies() {
+		path, err := r.FindPath(context.Background(), from.Lat, from.Lon, to.Lat, to.Lon, s)
+		if !assert.NoError(t, err, s.Name()) {
+			continue
+		}
+		rides := 0
+		for _, e := range path.Edges {
+			if e.Type == models.EdgeRide {
+				rides++
+			}
+		}
+		assert.NotZero(t, rides, s.Name())
+	}
+}
@@ -0,0 +1,187 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/passbi/passbi_core/internal/models"
+)
+
+// Explanation is how a search chose its path, for debugging a route
+type Explanation struct {
+	Strategy   string
+	Stats      SearchStats
+	StartNodes []models.Node // candidates near the origin
+	GoalNodes  []models.Node // candidates near the destination
+	Path       *models.Path  // nil when no path was found
+	Hops       []Hop         // the edges of Path
+	// Alternatives are the other paths that reached a goal node during the
+	// search, cheapest first, one per sequence of routes and goal stop
+	Alternatives []Alternative
+	// Stopped counts the partial paths the strategy's ShouldStop dropped
+	Stopped int
+}
+
+// Hop is an edge of the chosen path and what it cost
+type Hop struct {
+	From, To models.Node
+	Edge     models.Edge
+	BaseCost int // strategy.EdgeCost
+	Cost     int // with the BRT/TER bonus
+	G        int // cost of the path so far
+	H        int // estimate left to the destination
+	// Rejected are the other edges out of From and why the path did not take
+	// them
+	Rejected []RejectedEdge
+}
+
+// RejectedEdge is an edge the path did not take
+type RejectedEdge struct {
+	To     models.Node
+	Edge   models.Edge
+	Cost   int // -1 when the edge could not be taken at all
+	Reason string
+}
+
+// Alternative is a path to a goal node the search did not choose
+type Alternative struct {
+	Nodes  []models.Node
+	Edges  []models.Edge
+	Cost   int
+	Routes []string // route IDs ridden, in order
+	Reason string
+}
+
+// Explain runs a search like FindPath and records how it went
+// The error is the search's; the explanation is returned either way
+func (r *Router) Explain(ctx context.Context, fromLat, fromLon, toLat, toLon float64, strategy Strategy) (*Explanation, error) {
+	trace := &searchTrace{}
+	path, err := r.findPath(ctx, fromLat, fromLon, toLat, toLon, strategy, trace)
+
+	e := &Explanation{
+		Strategy:   strategy.Name(),
+		Stats:      trace.stats,
+		StartNodes: trace.startNodes,
+		GoalNodes:  trace.goalNodes,
+		Path:       path,
+		Stopped:    trace.stopped,
+	}
+	if path == nil {
+		e.Alternatives = trace.alternatives(-1)
+		return e, err
+	}
+
+	g := 0
+	for i, edge := range path.Edges {
+		from, to := path.Nodes[i], path.Nodes[i+1]
+		hop := Hop{From: from, To: to, Edge: edge, BaseCost: strategy.EdgeCost(edge), Cost: edgeCost(strategy, edge, to)}
+		hop.Rejected = r.rejectedEdges(strategy, from, edge, g, trace.bestG)
+		g += hop.Cost
+		hop.G = g
+		hop.H = int(haversineDistance(to.Lat, to.Lon, toLat, toLon) / 5.5)
+		e.Hops = append(e.Hops, hop)
+	}
+	e.Alternatives = trace.alternatives(path.TotalTime)
+	return e, nil
+}
+
+// rejectedEdges explains why the edges out of from other than taken are not
+// on the path, reached from from at cost g
+func (r *Router) rejectedEdges(strategy Strategy, from models.Node, taken models.Edge, g int, bestG map[int64]int) []RejectedEdge {
+	var rejected []RejectedEdge
+	for _, edge := range r.graph.GetEdges(from.ID) {
+		if edge.ID == taken.ID && edge.ToNodeID == taken.ToNodeID {
+			continue
+		}
+		to, ok := r.graph.GetNode(edge.ToNodeID)
+		rej := RejectedEdge{To: to, Edge: edge, Cost: -1}
+		switch {
+		case edge.Type == models.EdgeWalk && edge.CostWalk > maxWalkEdgeM:
+			rej.Reason = fmt.Sprintf("walk of %d m, over %d m", edge.CostWalk, maxWalkEdgeM)
+		case !ok:
+			rej.Reason = "leads to a node missing from the graph"
+		case !r.allows(to):
+			rej.Reason = fmt.Sprintf("agency %s not allowed", to.AgencyID)
+		default:
+			rej.Cost = edgeCost(strategy, edge, to)
+			best, reached := bestG[edge.ToNodeID]
+			switch {
+			case !reached:
+				rej.Reason = "never reached"
+			case best < g+rej.Cost:
+				rej.Reason = fmt.Sprintf("a cheaper path reached the node (%d < %d)", best, g+rej.Cost)
+			default:
+				rej.Reason = "led to a costlier branch"
+			}
+		}
+		rejected = append(rejected, rej)
+	}
+	sort.SliceStable(rejected, func(i, j int) bool {
+		ci, cj := rejected[i].Cost, rejected[j].Cost
+		if (ci < 0) != (cj < 0) {
+			return cj < 0
+		}
+		return ci < cj
+	})
+	return rejected
+}
+
+// searchTrace records a search for Explain
+type searchTrace struct {
+	stats      SearchStats
+	startNodes []models.Node
+	goalNodes  []models.Node
+	bestG      map[int64]int
+	stopped    int
+	reaches    []Alternative
+}
+
+// reached records an edge from current to a goal node, queued or not
+func (t *searchTrace) reached(goalSet map[int64]models.Node, current *searchPath, edge models.Edge, to models.Node, g int, queued bool) {
+	if _, isGoal := goalSet[to.ID]; !isGoal {
+		return
+	}
+	alt := Alternative{Nodes: append(append([]models.Node(nil), current.nodes...), to),
+		Edges: append(append([]models.Edge(nil), current.edges...), edge), Cost: g}
+	if !queued {
+		alt.Reason = "a cheaper path reached the same stop first"
+	}
+	for i, e := range alt.Edges {
+		if e.Type == models.EdgeRide {
+			if route := alt.Nodes[i+1].RouteID; len(alt.Routes) == 0 || alt.Routes[len(alt.Routes)-1] != route {
+				alt.Routes = append(alt.Routes, route)
+			}
+		}
+	}
+	t.reaches = append(t.reaches, alt)
+}
+
+// alternatives returns the paths to a goal node other than the one costing
+// chosen (-1 without a path), cheapest first, deduplicated
+func (t *searchTrace) alternatives(chosen int) []Alternative {
+	sort.SliceStable(t.reaches, func(i, j int) bool { return t.reaches[i].Cost < t.reaches[j].Cost })
+	seen := make(map[string]bool)
+	alts := []Alternative{}
+	for _, alt := range t.reaches {
+		key := strings.Join(alt.Routes, ">") + "@" + alt.Nodes[len(alt.Nodes)-1].StopID
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if alt.Cost == chosen && alt.Reason == "" {
+			// The chosen path itself, or one as cheap found after it
+			continue
+		}
+		if alt.Reason == "" {
+			if chosen >= 0 {
+				alt.Reason = fmt.Sprintf("costs %d more", alt.Cost-chosen)
+			} else {
+				alt.Reason = "queued but not reached before the search ended"
+			}
+		}
+		alts = append(alts, alt)
+	}
+	return alts
+}
@@ -0,0 +1,69 @@
+package routing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/passbi/passbi_core/internal/graph"
+	"github.com/passbi/passbi_core/internal/gtfs"
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// testGraph loads a graph where line 1 runs A -> C in 10 minutes and the
+// BRT runs B -> C in 9, B being a short walk from A
+func testGraph(t *testing.T) *graph.InMemoryGraph {
+	feed := &gtfs.GTFSFeed{
+		Stops: []models.GTFSStop{
+			{StopID: "A", StopName: "Sandaga", Lat: 14.6700, Lon: -17.4400},
+			{StopID: "B", StopName: "Kermel", Lat: 14.6710, Lon: -17.4400},
+			{StopID: "C", StopName: "Colobane", Lat: 14.6810, Lon: -17.4400},
+		},
+		Routes: []models.GTFSRoute{
+			{RouteID: "1", ShortName: "1", RouteType: 3},
+			{RouteID: "BRT", ShortName: "B1", RouteType: 3},
+		},
+		Trips: []models.GTFSTrip{{RouteID: "1", TripID: "1a"}, {RouteID: "BRT", TripID: "Ba"}},
+		StopTimes: []models.GTFSStopTime{
+			{TripID: "1a", StopID: "A", StopSequence: 1, DepartureTime: "08:00:00"},
+			{TripID: "1a", StopID: "C", StopSequence: 2, ArrivalTime: "08:10:00"},
+			{TripID: "Ba", StopID: "B", StopSequence: 1, DepartureTime: "08:00:00"},
+			{TripID: "Ba", StopID: "C", StopSequence: 2, ArrivalTime: "08:09:00"},
+		},
+	}
+	g := &graph.InMemoryGraph{}
+	assert.NoError(t, g.LoadFromFeeds(context.Background(), map[string]*gtfs.GTFSFeed{"ddd": feed}))
+	return g
+}
+
+func TestExplain(t *testing.T) {
+	r := &Router{graph: testGraph(t)}
+
+	e, err := r.Explain(context.Background(), 14.6700, -17.4400, 14.6810, -17.4400, &FastStrategy{})
+	if !assert.NoError(t, err) || !assert.NotNil(t, e.Path) {
+		return
+	}
+	assert.Equal(t, "fast", e.Strategy)
+	assert.Equal(t, OutcomeFound, e.Stats.Outcome)
+	assert.NotEmpty(t, e.StartNodes)
+	if assert.Len(t, e.Hops, len(e.Path.Edges)) {
+		last := e.Hops[len(e.Hops)-1]
+		assert.Equal(t, e.Path.TotalTime, last.G)
+		assert.Equal(t, 0, last.H)
+	}
+	assert.Equal(t, "BRT", e.Hops[0].To.RouteID)
+	if assert.Len(t, e.Hops[0].Rejected, 1) {
+		assert.Equal(t, models.EdgeWalk, e.Hops[0].Rejected[0].Edge.Type)
+		assert.Contains(t, e.Hops[0].Rejected[0].Reason, "cheaper path")
+	}
+	if assert.Len(t, e.Alternatives, 1) {
+		assert.Equal(t, []string{"1"}, e.Alternatives[0].Routes)
+		assert.Equal(t, "costs 60 more", e.Alternatives[0].Reason)
+	}
+
+	// No stop near the origin
+	e, err = r.Explain(context.Background(), 14.80, -17.30, 14.6810, -17.4400, &FastStrategy{})
+	assert.Equal(t, OutcomeNoStart, OutcomeOf(err))
+	assert.Nil(t, e.Path)
+	assert.Empty(t, e.StartNodes)
+}
@@ -0,0 +1,133 @@
+package routing
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/passbi/passbi_core/internal/models"
+)
+
+// Inspection describes a node as searches see it, to diagnose why a stop is
+// unroutable
+type Inspection struct {
+	Node models.Node
+	Out  []models.Edge // outgoing edges
+	In   []models.Edge // incoming edges
+	// Candidate reports whether a search from or to the node's own
+	// coordinates starts or ends at the node
+	Candidate bool
+	Routes    []ReachableRoute // routes reachable from the node, fewest hops first
+	Problems  []string
+}
+
+// ReachableRoute is a route a path from the inspected node can ride
+type ReachableRoute struct {
+	RouteID   string
+	RouteName string
+	AgencyID  string
+	Mode      models.TransitMode
+	Hops      int // fewest edges to a node of the route, 0 for the node's own
+	Stops     int // stops of the route reached within the hops
+}
+
+// Inspect describes node nodeID and the routes reachable from it within hops
+// edges, following the edges a search would; false when there is no such node
+func (r *Router) Inspect(nodeID int64, hops int) (*Inspection, bool) {
+	node, ok := r.graph.GetNode(nodeID)
+	if !ok {
+		return nil, false
+	}
+	in := &Inspection{Node: node, Out: r.graph.GetEdges(nodeID), In: r.graph.GetEdgesTo(nodeID), Routes: []ReachableRoute{}}
+
+	for _, n := range r.allowedNodes(r.graph.FindNearestNodes(node.Lat, node.Lon, 20)) {
+		if n.ID == nodeID {
+			in.Candidate = true
+		}
+	}
+
+	// Breadth first over the edges searches take
+	depth := map[int64]int{nodeID: 0}
+	frontier := []int64{nodeID}
+	routes := make(map[string]*ReachableRoute)
+	routeStops := make(map[string]map[string]bool)
+	reach := func(n models.Node, hops int) {
+		route, ok := routes[n.RouteID]
+		if !ok {
+			route = &ReachableRoute{RouteID: n.RouteID, RouteName: n.RouteName, AgencyID: n.AgencyID, Mode: n.Mode, Hops: hops}
+			routes[n.RouteID] = route
+			routeStops[n.RouteID] = make(map[string]bool)
+		}
+		routeStops[n.RouteID][n.StopID] = true
+		route.Stops = len(routeStops[n.RouteID])
+	}
+	reach(node, 0)
+	usable := 0
+	for d := 1; d <= hops && len(frontier) > 0; d++ {
+		var next []int64
+		for _, id := range frontier {
+			for _, e := range r.graph.GetEdges(id) {
+				if e.Type == models.EdgeWalk && e.CostWalk > maxWalkEdgeM {
+					continue
+				}
+				to, ok := r.graph.GetNode(e.ToNodeID)
+				if !ok || !r.allows(to) {
+					continue
+				}
+				if id == nodeID {
+					usable++
+				}
+				if _, seen := depth[to.ID]; seen {
+					continue
+				}
+				depth[to.ID] = d
+				next = append(next, to.ID)
+				reach(to, d)
+			}
+		}
+		frontier = next
+	}
+	for _, route := range routes {
+		in.Routes = append(in.Routes, *route)
+	}
+	sort.Slice(in.Routes, func(i, j int) bool {
+		if in.Routes[i].Hops != in.Routes[j].Hops {
+			return in.Routes[i].Hops < in.Routes[j].Hops
+		}
+		return in.Routes[i].RouteID < in.Routes[j].RouteID
+	})
+
+	in.Problems = inspectionProblems(in, usable)
+	return in, true
+}
+
+// inspectionProblems lists what keeps searches from using the node
+func inspectionProblems(in *Inspection, usable int) []string {
+	var problems []string
+	if in.Node.Lat == 0 && in.Node.Lon == 0 {
+		problems = append(problems, "the node has no coordinates")
+	}
+	if len(in.Out) == 0 {
+		problems = append(problems, "no outgoing edge: paths cannot leave the node")
+	} else if usable == 0 {
+		problems = append(problems, fmt.Sprintf("every outgoing edge is skipped by searches (walks over %d m, or other agencies)", maxWalkEdgeM))
+	}
+	if len(in.In) == 0 {
+		problems = append(problems, "no incoming edge: paths cannot reach the node")
+	}
+	rides := 0
+	for _, edges := range [][]models.Edge{in.Out, in.In} {
+		for _, e := range edges {
+			if e.Type == models.EdgeRide {
+				rides++
+			}
+		}
+	}
+	if rides == 0 {
+		problems = append(problems, "no RIDE edge: no trip of the route stops here")
+	}
+	if !in.Candidate {
+		problems = append(problems, "searches from or to the stop do not start or end at this node: "+
+			"only the nearest 2 BRT/TER and 3 other stops within 500 m are used, up to 20 nodes")
+	}
+	return problems
+}
@@ -0,0 +1,37 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspect(t *testing.T) {
+	g := testGraph(t)
+	r := &Router{graph: g}
+	nodes := g.GetStopNodes("A")
+	if !assert.Len(t, nodes, 1) {
+		return
+	}
+
+	in, ok := r.Inspect(nodes[0].ID, 2)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, "1", in.Node.RouteID)
+	assert.True(t, in.Candidate)
+	assert.Len(t, in.Out, 2) // ride to C, walk to B
+	assert.Len(t, in.In, 1)  // walk from B
+	assert.Equal(t, []ReachableRoute{
+		{RouteID: "1", RouteName: "1", AgencyID: "ddd", Mode: models.ModeBus, Hops: 0, Stops: 2},
+		{RouteID: "BRT", RouteName: "B1", AgencyID: "ddd", Mode: models.ModeBus, Hops: 1, Stops: 2},
+	}, in.Routes)
+	assert.Empty(t, in.Problems)
+
+	in, _ = r.WithAgencies([]string{"other"}).Inspect(nodes[0].ID, 2)
+	assert.Contains(t, in.Problems, "every outgoing edge is skipped by searches (walks over 200 m, or other agencies)")
+
+	_, ok = r.Inspect(999, 1)
+	assert.False(t, ok)
+}
@@ -0,0 +1,279 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/passbi/passbi_core/internal/logging"
+	"github.com/passbi/passbi_core/internal/metrics"
+)
+
+var logger = logging.For("routing")
+
+// Search outcomes
+const (
+	OutcomeFound     = "found"
+	OutcomeNoPath    = "no_path"    // the reachable graph was exhausted
+	OutcomeNodeLimit = "node_limit" // MAX_EXPLORED_NODES was reached
+	OutcomeTimeout   = "timeout"    // ROUTE_TIMEOUT elapsed
+	OutcomeNoStart   = "no_start"   // no stop near the origin
+	OutcomeNoGoal    = "no_goal"    // no stop near the destination
+)
+
+var outcomes = []string{OutcomeFound, OutcomeNoPath, OutcomeNodeLimit, OutcomeTimeout, OutcomeNoStart, OutcomeNoGoal}
+
+// SearchError is returned by a search that found no path
+type SearchError struct {
+	Outcome string // one of the Outcome constants but OutcomeFound
+	msg     string
+}
+
+func (e *SearchError) Error() string {
+	return e.msg
+}
+
+// OutcomeOf returns why a search found no path, or "" when err is not a
+// SearchError (graph not loaded, ...)
+func OutcomeOf(err error) string {
+	var se *SearchError
+	if errors.As(err, &se) {
+		return se.Outcome
+	}
+	return ""
+}
+
+// SearchStats describes one path search, for tuning MAX_EXPLORED_NODES and
+// the snapping radius
+type SearchStats struct {
+	Strategy string
+	FromLat  float64
+	FromLon  float64
+	ToLat    float64
+	ToLon    float64
+	Outcome  string
+
+	ExploredNodes int
+	PeakQueue     int // largest open set during the search
+	MaxExplored   int // MAX_EXPLORED_NODES in effect
+	StartNodes    int
+	GoalNodes     int
+
+	// Straight-line distance from the origin to the nearest start node, and
+	// from the nearest goal node to the destination; -1 without nodes
+	StartSnapM float64
+	GoalSnapM  float64
+
+	Duration time.Duration
+}
+
+// fail records the outcome of a search that found no path and returns its error
+func (s *SearchStats) fail(outcome, format string, args ...any) error {
+	s.Outcome = outcome
+	return &SearchError{Outcome: outcome, msg: fmt.Sprintf(format, args...)}
+}
+
+// strategyTelemetry aggregates the searches of one strategy
+type strategyTelemetry struct {
+	explored *metrics.Histogram
+	queue    *metrics.Histogram
+	duration *metrics.Histogram
+	snap     map[string]*metrics.Histogram // origin, destination
+	outcomes map[string]*atomic.Int64
+}
+
+var (
+	telemetry sync.Map // strategy name -> *strategyTelemetry
+
+	samplesDropped atomic.Int64
+	samplesWritten atomic.Int64
+
+	// samples are the searches waiting to be written to routing_search_sample
+	samples = make(chan SearchStats, 1000)
+
+	sampleRateOnce sync.Once
+	sampleRate     float64
+)
+
+func init() {
+	metrics.Register(collectTelemetry)
+}
+
+func newStrategyTelemetry() *strategyTelemetry {
+	t := &strategyTelemetry{
+		explored: metrics.NewHistogram(100, 500, 1000, 2500, 5000, 10000, 25000, 50000, 100000),
+		queue:    metrics.NewHistogram(100, 500, 1000, 2500, 5000, 10000, 25000, 50000, 100000),
+		duration: metrics.NewHistogram(0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10),
+		snap: map[string]*metrics.Histogram{
+			"origin":      metrics.NewHistogram(25, 50, 100, 200, 300, 400, 500),
+			"destination": metrics.NewHistogram(25, 50, 100, 200, 300, 400, 500),
+		},
+		outcomes: map[string]*atomic.Int64{},
+	}
+	for _, o := range outcomes {
+		t.outcomes[o] = &atomic.Int64{}
+	}
+	return t
+}
+
+func strategyStats(strategy string) *strategyTelemetry {
+	if t, ok := telemetry.Load(strategy); ok {
+		return t.(*strategyTelemetry)
+	}
+	t, _ := telemetry.LoadOrStore(strategy, newStrategyTelemetry())
+	return t.(*strategyTelemetry)
+}
+
+// recordSearch adds a search to the metrics and, if sampled, queues it for
+// routing_search_sample
+func recordSearch(s SearchStats) {
+	t := strategyStats(s.Strategy)
+	t.outcomes[s.Outcome].Add(1)
+	t.duration.Observe(s.Duration.Seconds())
+	if s.StartSnapM >= 0 {
+		t.snap["origin"].Observe(s.StartSnapM)
+	}
+	if s.GoalSnapM >= 0 {
+		t.snap["destination"].Observe(s.GoalSnapM)
+	}
+	// Searches that never started explore nothing; they would skew the tuning
+	if s.Outcome != OutcomeNoStart && s.Outcome != OutcomeNoGoal {
+		t.explored.Observe(float64(s.ExploredNodes))
+		t.queue.Observe(float64(s.PeakQueue))
+	}
+
+	if rate := TelemetrySampleRate(); rate > 0 && rand.Float64() < rate {
+		select {
+		case samples <- s:
+		default:
+			samplesDropped.Add(1)
+		}
+	}
+}
+
+func collectTelemetry(w *metrics.Writer) {
+	var names []string
+	telemetry.Range(func(k, _ any) bool {
+		names = append(names, k.(string))
+		return true
+	})
+	sort.Strings(names)
+
+	for _, name := range names {
+		t := strategyStats(name)
+		for _, o := range outcomes {
+			w.Counter("passbi_routing_searches_total", "Path searches by strategy and outcome (found, no_path, node_limit, timeout, no_start, no_goal)",
+				float64(t.outcomes[o].Load()), metrics.L("strategy", name), metrics.L("outcome", o))
+		}
+	}
+	for _, name := range names {
+		w.Histogram("passbi_routing_explored_nodes", "Nodes explored per path search", strategyStats(name).explored, metrics.L("strategy", name))
+	}
+	for _, name := range names {
+		w.Histogram("passbi_routing_queue_peak", "Largest A* open set per path search", strategyStats(name).queue, metrics.L("strategy", name))
+	}
+	for _, name := range names {
+		w.Histogram("passbi_routing_search_seconds", "Path search duration", strategyStats(name).duration, metrics.L("strategy", name))
+	}
+	for _, name := range names {
+		t := strategyStats(name)
+		for _, end := range []string{"origin", "destination"} {
+			w.Histogram("passbi_routing_snap_distance_meters", "Distance between a search endpoint and its nearest usable stop",
+				t.snap[end], metrics.L("strategy", name), metrics.L("end", end))
+		}
+	}
+	w.Counter("passbi_routing_samples_written_total", "Searches written to routing_search_sample", float64(samplesWritten.Load()))
+	w.Counter("passbi_routing_samples_dropped_total", "Sampled searches dropped because the writer fell behind", float64(samplesDropped.Load()))
+}
+
+// TelemetrySampleRate is the share of searches written to
+// routing_search_sample, from ROUTING_TELEMETRY_SAMPLE (0, the default,
+// disables the table)
+func TelemetrySampleRate() float64 {
+	sampleRateOnce.Do(func() {
+		if v := os.Getenv("ROUTING_TELEMETRY_SAMPLE"); v != "" {
+			if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 && f <= 1 {
+				sampleRate = f
+			}
+		}
+	})
+	return sampleRate
+}
+
+// telemetryRetention is how long sampled searches are kept
+const telemetryRetention = 30 * 24 * time.Hour
+
+var sampleColumns = []string{
+	"strategy", "from_lat", "from_lon", "to_lat", "to_lon", "outcome",
+	"explored_nodes", "peak_queue", "max_explored_nodes", "start_nodes", "goal_nodes",
+	"start_snap_m", "goal_snap_m", "duration_ms", "created_at",
+}
+
+// RunTelemetryWriter writes sampled searches to routing_search_sample until
+// ctx is canceled, and prunes samples older than 30 days
+// It returns at once when sampling is disabled
+func RunTelemetryWriter(ctx context.Context, pool *pgxpool.Pool) {
+	if TelemetrySampleRate() == 0 {
+		return
+	}
+	logger.Info("Sampling route searches into routing_search_sample", "rate", TelemetrySampleRate())
+
+	flush := time.NewTicker(5 * time.Second)
+	defer flush.Stop()
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+
+	var batch [][]any
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-samples:
+			batch = append(batch, sampleRow(s))
+			if len(batch) < 500 {
+				continue
+			}
+		case <-flush.C:
+		case <-prune.C:
+			if _, err := pool.Exec(ctx, `DELETE FROM routing_search_sample WHERE created_at < $1`, time.Now().Add(-telemetryRetention)); err != nil {
+				logger.Warn("Failed to prune routing samples", "error", err)
+			}
+			continue
+		}
+
+		if len(batch) == 0 {
+			continue
+		}
+		n, err := pool.CopyFrom(ctx, pgx.Identifier{"routing_search_sample"}, sampleColumns, pgx.CopyFromRows(batch))
+		if err != nil {
+			samplesDropped.Add(int64(len(batch)))
+			logger.Warn("Failed to write routing samples", "samples", len(batch), "error", err)
+		} else {
+			samplesWritten.Add(n)
+		}
+		batch = batch[:0]
+	}
+}
+
+func sampleRow(s SearchStats) []any {
+	snap := func(m float64) any {
+		if m < 0 {
+			return nil
+		}
+		return int(m)
+	}
+	return []any{
+		s.Strategy, s.FromLat, s.FromLon, s.ToLat, s.ToLon, s.Outcome,
+		s.ExploredNodes, s.PeakQueue, s.MaxExplored, s.StartNodes, s.GoalNodes,
+		snap(s.StartSnapM), snap(s.GoalSnapM), int(s.Duration.Milliseconds()), time.Now(),
+	}
+}
@@ -0,0 +1,49 @@
+package routing
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/metrics"
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordSearch(t *testing.T) {
+	recordSearch(SearchStats{
+		Strategy:      "telemetry_test",
+		Outcome:       OutcomeNodeLimit,
+		ExploredNodes: 50001,
+		PeakQueue:     1800,
+		StartSnapM:    120,
+		GoalSnapM:     40,
+		Duration:      300 * time.Millisecond,
+	})
+	recordSearch(SearchStats{Strategy: "telemetry_test", Outcome: OutcomeNoStart, StartSnapM: -1, GoalSnapM: -1})
+
+	out := metrics.Gather()
+	for _, line := range []string{
+		`passbi_routing_searches_total{outcome="node_limit",strategy="telemetry_test"} 1`,
+		`passbi_routing_searches_total{outcome="no_start",strategy="telemetry_test"} 1`,
+		`passbi_routing_searches_total{outcome="found",strategy="telemetry_test"} 0`,
+		// Searches without start nodes are left out of the explored nodes
+		`passbi_routing_explored_nodes_bucket{le="50000",strategy="telemetry_test"} 0`,
+		`passbi_routing_explored_nodes_count{strategy="telemetry_test"} 1`,
+		`passbi_routing_queue_peak_bucket{le="2500",strategy="telemetry_test"} 1`,
+		`passbi_routing_snap_distance_meters_bucket{end="origin",le="200",strategy="telemetry_test"} 1`,
+		`passbi_routing_snap_distance_meters_count{end="destination",strategy="telemetry_test"} 1`,
+		`passbi_routing_search_seconds_count{strategy="telemetry_test"} 2`,
+	} {
+		assert.True(t, strings.Contains(out, line+"\n"), line)
+	}
+}
+
+func TestSnapDistance(t *testing.T) {
+	nodes := []models.Node{
+		{ID: 1, Lat: 14.6950, Lon: -17.4440},
+		{ID: 2, Lat: 14.6930, Lon: -17.4467},
+	}
+	assert.InDelta(t, 22, snapDistance(nodes, 14.6928, -17.4467), 1)
+	assert.Equal(t, -1.0, snapDistance(nil, 14.6928, -17.4467))
+}
@@ -166,3 +166,31 @@ func (e *VehiclePositionEstimator) DistanceAlongPath(path *models.Path, elapsedS
 
 	return cumulativeDistance
 }
+
+// Segment returns the index of the edge a vehicle is on after elapsedSeconds
+// along a path: -1 before it starts, len(path.Edges) once it has arrived
+func Segment(path *models.Path, elapsedSeconds int) int {
+	if elapsedSeconds < 0 {
+		return -1
+	}
+	cumulativeTime := 0
+	for i, edge := range path.Edges {
+		cumulativeTime += edge.CostTime
+		if elapsedSeconds < cumulativeTime {
+			return i
+		}
+	}
+	return len(path.Edges)
+}
+
+// Bearing returns the initial bearing from the first point to the second, in
+// degrees clockwise from north
+func Bearing(lat1, lon1, lat2, lon2 float64) float64 {
+	lat1Rad := lat1 * math.Pi / 180
+	lat2Rad := lat2 * math.Pi / 180
+	deltaLon := (lon2 - lon1) * math.Pi / 180
+
+	y := math.Sin(deltaLon) * math.Cos(lat2Rad)
+	x := math.Cos(lat1Rad)*math.Sin(lat2Rad) - math.Sin(lat1Rad)*math.Cos(lat2Rad)*math.Cos(deltaLon)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
@@ -0,0 +1,26 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegment(t *testing.T) {
+	path := &models.Path{Edges: []models.Edge{{CostTime: 60}, {CostTime: 0}, {CostTime: 120}}}
+
+	assert.Equal(t, -1, Segment(path, -5))
+	assert.Equal(t, 0, Segment(path, 0))
+	assert.Equal(t, 0, Segment(path, 59))
+	assert.Equal(t, 2, Segment(path, 60), "zero-time edges are passed through")
+	assert.Equal(t, 2, Segment(path, 179))
+	assert.Equal(t, 3, Segment(path, 180))
+}
+
+func TestBearing(t *testing.T) {
+	assert.InDelta(t, 0, Bearing(14.69, -17.44, 14.70, -17.44), 0.01)
+	assert.InDelta(t, 90, Bearing(14.69, -17.44, 14.69, -17.43), 0.1)
+	assert.InDelta(t, 180, Bearing(14.70, -17.44, 14.69, -17.44), 0.01)
+	assert.InDelta(t, 270, Bearing(14.69, -17.43, 14.69, -17.44), 0.1)
+}
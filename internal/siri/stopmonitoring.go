@@ -0,0 +1,194 @@
+package siri
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Namespace is the SIRI XML namespace
+const Namespace = "http://www.siri.org.uk/siri"
+
+// Version is the SIRI version this package produces
+const Version = "2.0"
+
+// ProducerRef identifies PassBi as the producer of deliveries
+const ProducerRef = "PassBi"
+
+// Visit is a departure of a vehicle journey at the monitored stop
+type Visit struct {
+	StopID            string
+	StopName          string
+	LineRef           string
+	LineName          string
+	OperatorRef       string
+	Direction         int
+	TripID            string
+	ServiceDate       time.Time
+	Destination       string
+	AimedDeparture    time.Time
+	ExpectedDeparture *time.Time // set only when a realtime prediction exists
+}
+
+// Siri is the root element of a SIRI document
+type Siri struct {
+	XMLName         xml.Name         `xml:"Siri"`
+	Xmlns           string           `xml:"xmlns,attr"`
+	Version         string           `xml:"version,attr"`
+	ServiceDelivery *ServiceDelivery `xml:"ServiceDelivery"`
+}
+
+// ServiceDelivery wraps the functional deliveries of a response
+type ServiceDelivery struct {
+	ResponseTimestamp      string                   `xml:"ResponseTimestamp"`
+	ProducerRef            string                   `xml:"ProducerRef"`
+	StopMonitoringDelivery []StopMonitoringDelivery `xml:"StopMonitoringDelivery"`
+}
+
+// StopMonitoringDelivery carries the visits of one monitored stop
+type StopMonitoringDelivery struct {
+	Version            string               `xml:"version,attr"`
+	ResponseTimestamp  string               `xml:"ResponseTimestamp"`
+	Status             bool                 `xml:"Status"`
+	ErrorCondition     *ErrorCondition      `xml:"ErrorCondition,omitempty"`
+	MonitoredStopVisit []MonitoredStopVisit `xml:"MonitoredStopVisit"`
+}
+
+// ErrorCondition reports why a delivery failed
+type ErrorCondition struct {
+	InvalidDataReferencesError *ErrorText `xml:"InvalidDataReferencesError,omitempty"`
+	OtherError                 *ErrorText `xml:"OtherError,omitempty"`
+}
+
+// ErrorText is the description of an error condition
+type ErrorText struct {
+	ErrorText string `xml:"ErrorText"`
+}
+
+// MonitoredStopVisit is a single vehicle journey calling at the stop
+type MonitoredStopVisit struct {
+	RecordedAtTime          string                  `xml:"RecordedAtTime"`
+	ItemIdentifier          string                  `xml:"ItemIdentifier"`
+	MonitoringRef           string                  `xml:"MonitoringRef"`
+	MonitoredVehicleJourney MonitoredVehicleJourney `xml:"MonitoredVehicleJourney"`
+}
+
+// MonitoredVehicleJourney describes the journey and its call at the stop
+type MonitoredVehicleJourney struct {
+	LineRef                 string                  `xml:"LineRef"`
+	DirectionRef            string                  `xml:"DirectionRef"`
+	FramedVehicleJourneyRef FramedVehicleJourneyRef `xml:"FramedVehicleJourneyRef"`
+	PublishedLineName       string                  `xml:"PublishedLineName"`
+	OperatorRef             string                  `xml:"OperatorRef"`
+	DestinationName         string                  `xml:"DestinationName,omitempty"`
+	Monitored               bool                    `xml:"Monitored"`
+	MonitoredCall           MonitoredCall           `xml:"MonitoredCall"`
+}
+
+// FramedVehicleJourneyRef identifies a trip on a service day
+type FramedVehicleJourneyRef struct {
+	DataFrameRef           string `xml:"DataFrameRef"`
+	DatedVehicleJourneyRef string `xml:"DatedVehicleJourneyRef"`
+}
+
+// MonitoredCall is the call of the journey at the monitored stop
+type MonitoredCall struct {
+	StopPointRef          string `xml:"StopPointRef"`
+	StopPointName         string `xml:"StopPointName"`
+	AimedDepartureTime    string `xml:"AimedDepartureTime"`
+	ExpectedDepartureTime string `xml:"ExpectedDepartureTime,omitempty"`
+}
+
+// StopMonitoring builds a successful StopMonitoring response for one stop
+func StopMonitoring(stopID string, visits []Visit, now time.Time) *Siri {
+	ts := formatTime(now)
+	delivery := StopMonitoringDelivery{
+		Version:            Version,
+		ResponseTimestamp:  ts,
+		Status:             true,
+		MonitoredStopVisit: make([]MonitoredStopVisit, 0, len(visits)),
+	}
+
+	for _, v := range visits {
+		call := MonitoredCall{
+			StopPointRef:       v.StopID,
+			StopPointName:      v.StopName,
+			AimedDepartureTime: formatTime(v.AimedDeparture),
+		}
+		if v.ExpectedDeparture != nil {
+			call.ExpectedDepartureTime = formatTime(*v.ExpectedDeparture)
+		}
+
+		delivery.MonitoredStopVisit = append(delivery.MonitoredStopVisit, MonitoredStopVisit{
+			RecordedAtTime: ts,
+			ItemIdentifier: v.TripID + ":" + v.StopID,
+			MonitoringRef:  stopID,
+			MonitoredVehicleJourney: MonitoredVehicleJourney{
+				LineRef:      v.LineRef,
+				DirectionRef: directionRef(v.Direction),
+				FramedVehicleJourneyRef: FramedVehicleJourneyRef{
+					DataFrameRef:           v.ServiceDate.Format("2006-01-02"),
+					DatedVehicleJourneyRef: v.TripID,
+				},
+				PublishedLineName: v.LineName,
+				OperatorRef:       v.OperatorRef,
+				DestinationName:   v.Destination,
+				Monitored:         v.ExpectedDeparture != nil,
+				MonitoredCall:     call,
+			},
+		})
+	}
+
+	return wrap(delivery, ts)
+}
+
+// StopMonitoringError builds a failed StopMonitoring response
+// invalidRef reports an unknown MonitoringRef rather than a server error
+func StopMonitoringError(message string, invalidRef bool, now time.Time) *Siri {
+	ts := formatTime(now)
+	cond := &ErrorCondition{}
+	if invalidRef {
+		cond.InvalidDataReferencesError = &ErrorText{ErrorText: message}
+	} else {
+		cond.OtherError = &ErrorText{ErrorText: message}
+	}
+
+	return wrap(StopMonitoringDelivery{
+		Version:           Version,
+		ResponseTimestamp: ts,
+		Status:            false,
+		ErrorCondition:    cond,
+	}, ts)
+}
+
+// Marshal renders the document with an XML declaration
+func (s *Siri) Marshal() ([]byte, error) {
+	out, err := xml.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+func wrap(delivery StopMonitoringDelivery, ts string) *Siri {
+	return &Siri{
+		Xmlns:   Namespace,
+		Version: Version,
+		ServiceDelivery: &ServiceDelivery{
+			ResponseTimestamp:      ts,
+			ProducerRef:            ProducerRef,
+			StopMonitoringDelivery: []StopMonitoringDelivery{delivery},
+		},
+	}
+}
+
+// directionRef maps GTFS direction_id to SIRI direction names
+func directionRef(direction int) string {
+	if direction == 1 {
+		return "inbound"
+	}
+	return "outbound"
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
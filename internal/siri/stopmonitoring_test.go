@@ -0,0 +1,45 @@
+package siri
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStopMonitoring(t *testing.T) {
+	day := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	aimed := day.Add(8 * time.Hour)
+	expected := aimed.Add(2 * time.Minute)
+
+	doc := StopMonitoring("S1", []Visit{
+		{StopID: "S1", StopName: "Place de l'Indépendance", LineRef: "DDD_7", LineName: "7",
+			OperatorRef: "DDD", TripID: "T1", ServiceDate: day, Destination: "Parcelles",
+			AimedDeparture: aimed, ExpectedDeparture: &expected},
+		{StopID: "S1", StopName: "Place de l'Indépendance", LineRef: "DDD_8", LineName: "8",
+			OperatorRef: "DDD", Direction: 1, TripID: "T2", ServiceDate: day, AimedDeparture: aimed},
+	}, day.Add(7*time.Hour))
+
+	body, err := doc.Marshal()
+	assert.NoError(t, err)
+
+	xml := string(body)
+	assert.True(t, strings.HasPrefix(xml, "<?xml"))
+	assert.Contains(t, xml, `<Siri xmlns="http://www.siri.org.uk/siri" version="2.0">`)
+	assert.Contains(t, xml, "<AimedDepartureTime>2024-03-04T08:00:00Z</AimedDepartureTime>")
+	assert.Contains(t, xml, "<ExpectedDepartureTime>2024-03-04T08:02:00Z</ExpectedDepartureTime>")
+	assert.Contains(t, xml, "<DirectionRef>inbound</DirectionRef>")
+	assert.Equal(t, 1, strings.Count(xml, "<ExpectedDepartureTime>"))
+	assert.Equal(t, 1, strings.Count(xml, "<Monitored>true</Monitored>"))
+}
+
+func TestStopMonitoringError(t *testing.T) {
+	body, err := StopMonitoringError("unknown stop X", true, time.Unix(0, 0)).Marshal()
+	assert.NoError(t, err)
+
+	xml := string(body)
+	assert.Contains(t, xml, "<Status>false</Status>")
+	assert.Contains(t, xml, "<InvalidDataReferencesError>")
+	assert.NotContains(t, xml, "<MonitoredStopVisit>")
+}
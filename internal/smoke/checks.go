@@ -0,0 +1,144 @@
+package smoke
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// checks lists the checks in the order they run
+// v3 answers the v2 data in an envelope, so its checks are the v2 ones under
+// "data"
+func checks() []check {
+	stopPath := func(suffix string) func(Config, ids) string {
+		return func(_ Config, known ids) string {
+			if known.stop == "" {
+				return ""
+			}
+			return "/v2/stops/" + url.PathEscape(known.stop) + suffix
+		}
+	}
+	routePath := func(suffix string) func(Config, ids) string {
+		return func(_ Config, known ids) string {
+			if known.route == "" {
+				return ""
+			}
+			return "/v2/routes/" + url.PathEscape(known.route) + suffix
+		}
+	}
+	fixed := func(path string) func(Config, ids) string {
+		return func(Config, ids) string { return path }
+	}
+
+	v2 := []check{
+		{name: "livez", path: fixed("/livez"), fields: []string{"status:string"}},
+		{name: "readyz", path: fixed("/readyz"), fields: []string{"status:string", "checks:object"}},
+		{name: "health", path: fixed("/health"), fields: []string{"status:string"}},
+		{name: "metrics", path: fixed("/metrics"), contentType: "text/plain"},
+
+		{name: "v2 route-search", slow: true, path: func(cfg Config, _ ids) string {
+			return "/v2/route-search" + q("from", cfg.From.String(), "to", cfg.To.String())
+		}, fields: []string{"routes:object"}},
+		{name: "v2 stops/nearby", path: func(cfg Config, _ ids) string {
+			return "/v2/stops/nearby" + q("lat", strconv.FormatFloat(cfg.From.Lat, 'f', 6, 64),
+				"lon", strconv.FormatFloat(cfg.From.Lon, 'f', 6, 64), "radius", "1000")
+		}, fields: []string{"stops:array+", "stops[].id:string", "stops[].name:string", "stops[].distance_meters:number"},
+			learn: func(doc any, known *ids) { known.stop = first(doc, "stops", "id") }},
+		{name: "v2 stops/search", path: func(cfg Config, _ ids) string {
+			return "/v2/stops/search" + q("q", cfg.Query)
+		}, fields: []string{"stops:array", "stops[].id:string", "total:number"}},
+		{name: "v2 stops/:id/departures", path: stopPath("/departures"),
+			fields: []string{"stop.id:string", "departures:array", "departures[].route_id:string", "date:string", "total:number"}},
+		{name: "v2 stops/:id/routes", path: stopPath("/routes"),
+			fields: []string{"stop.id:string", "routes:array", "routes[].id:string", "total:number"},
+			learn:  func(doc any, known *ids) { known.route = first(doc, "routes", "id") }},
+		{name: "v2 routes/list", path: fixed("/v2/routes/list" + q("limit", "5")),
+			fields: []string{"routes:array+", "routes[].id:string", "total:number"},
+			learn: func(doc any, known *ids) {
+				if known.route == "" {
+					known.route = first(doc, "routes", "id")
+				}
+			}},
+
+		{name: "v2 routes/:id/schedule", slow: true, path: routePath("/schedule"),
+			fields: []string{"route.id:string", "services:array", "stops:array", "trips:array", "total_trips:number"}},
+		{name: "v2 routes/:id/schedule.ics", slow: true, path: routePath("/schedule.ics"), contentType: "text/calendar"},
+		{name: "v2 routes/:id/trips", path: routePath("/trips" + q("limit", "5")),
+			fields: []string{"route.id:string", "trips:array", "trips[].trip_id:string", "total:number"},
+			learn:  func(doc any, known *ids) { known.trip = first(doc, "trips", "trip_id") }},
+		{name: "v2 routes/:id/stops", path: routePath("/stops"), fields: []string{"route.id:string", "directions:array"}},
+		{name: "v2 routes/:id/frequency", path: routePath("/frequency"), fields: []string{"route.id:string", "day_types:array"}},
+		{name: "v2 routes/:id/vehicles", path: routePath("/vehicles"), fields: []string{"route.id:string", "vehicles:array", "total:number"}},
+		{name: "v2 routes/:id/occupancy", path: routePath("/occupancy"), fields: []string{"route.id:string", "typical:array"}},
+		// Headways and replays are for operators: keys without write:vehicles
+		// get 403, and the server built without auth does not serve them
+		{name: "v2 routes/:id/headways", status: []int{http.StatusOK, http.StatusForbidden, http.StatusNotFound}, path: routePath("/headways"),
+			fields: []string{"route.id:string", "status:string", "headways:array"}},
+		// Trips are archived once run: yesterday's may be missing on a new
+		// deployment
+		{name: "v2 trips/:id/replay", status: []int{http.StatusOK, http.StatusForbidden, http.StatusNotFound}, path: func(_ Config, known ids) string {
+			if known.trip == "" {
+				return ""
+			}
+			yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+			return "/v2/trips/" + url.PathEscape(known.trip) + "/replay" + q("date", yesterday)
+		}, fields: []string{"trip_id:string", "runs:array"}},
+
+		{name: "v2 network/stats", path: fixed("/v2/network/stats"), fields: []string{"stops:number", "routes:number", "modes:array"}},
+		{name: "v2 services", path: fixed("/v2/services"), fields: []string{"date:string", "services:array", "total:number"}},
+		{name: "v2 alerts", path: fixed("/v2/alerts"), fields: []string{"alerts:array", "total:number"}},
+		{name: "v2 siri/stop-monitoring", contentType: "application/xml", path: func(_ Config, known ids) string {
+			if known.stop == "" {
+				return ""
+			}
+			return "/v2/siri/stop-monitoring" + q("MonitoringRef", known.stop)
+		}},
+		{name: "gtfs-rt/alerts", path: fixed("/gtfs-rt/alerts"), contentType: "application/x-protobuf"},
+	}
+
+	all := append([]check(nil), v2...)
+	for _, c := range v2 {
+		if v3c, ok := toV3(c); ok {
+			all = append(all, v3c)
+		}
+	}
+	return all
+}
+
+// toV3 returns the v3 check of a v2 one, false when v3 has no such endpoint
+// or answers something else than JSON
+func toV3(c check) (check, bool) {
+	if !strings.HasPrefix(c.name, "v2 ") || c.contentType != "" {
+		return check{}, false
+	}
+	v2Path := c.path
+	c.path = func(cfg Config, known ids) string {
+		p := v2Path(cfg, known)
+		if p == "" {
+			return ""
+		}
+		p = "/v3/" + strings.TrimPrefix(p, "/v2/")
+		// v3 lists routes at /v3/routes, with cursors
+		return strings.Replace(p, "/v3/routes/list", "/v3/routes", 1)
+	}
+	c.name = "v3 " + strings.TrimPrefix(c.name, "v2 ")
+	c.learn = nil
+
+	fields := []string{"data:object"}
+	switch c.name {
+	case "v3 routes/list":
+		// The page is the data itself
+		fields = []string{"data:array+", "data[].id:string", "meta.limit:number"}
+	case "v3 routes/:id/trips":
+		// The total moved to meta
+		fields = []string{"data.route.id:string", "data.trips:array", "data.trips[].trip_id:string", "meta.limit:number"}
+	default:
+		for _, f := range c.fields {
+			fields = append(fields, "data."+f)
+		}
+	}
+	c.fields = fields
+	return c, true
+}
@@ -0,0 +1,114 @@
+package smoke
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkFields asserts the fields of a JSON document
+// A field is "path:type": path is dotted, "[]" checks every element of an
+// array, and type is string, number, bool, object, array, or array+ for a
+// non-empty array. A field missing from an element of an empty array holds
+func checkFields(doc any, fields []string) []string {
+	var errs []string
+	for _, field := range fields {
+		path, kind, ok := strings.Cut(field, ":")
+		if !ok {
+			errs = append(errs, fmt.Sprintf("invalid field %q", field))
+			continue
+		}
+		errs = append(errs, checkPath(doc, strings.Split(path, "."), path, kind)...)
+	}
+	return errs
+}
+
+func checkPath(v any, segments []string, path, kind string) []string {
+	if len(segments) == 0 {
+		got := typeOf(v)
+		if kind == "array+" && got == "array" {
+			if len(v.([]any)) == 0 {
+				return []string{fmt.Sprintf("%s is empty", path)}
+			}
+			return nil
+		}
+		if got != kind {
+			return []string{fmt.Sprintf("%s is %s, want %s", path, got, kind)}
+		}
+		return nil
+	}
+
+	seg := segments[0]
+	if name, each := strings.CutSuffix(seg, "[]"); each {
+		if name != "" {
+			obj, ok := v.(map[string]any)
+			if !ok {
+				return []string{fmt.Sprintf("%s: %s is not an object", path, name)}
+			}
+			if v, ok = obj[name]; !ok {
+				return []string{fmt.Sprintf("%s: missing %s", path, name)}
+			}
+		}
+		items, ok := v.([]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: %s is %s, want array", path, seg, typeOf(v))}
+		}
+		for i, item := range items {
+			if errs := checkPath(item, segments[1:], path, kind); len(errs) > 0 {
+				// One element is enough to tell the schema broke
+				return []string{fmt.Sprintf("element %d: %s", i, errs[0])}
+			}
+		}
+		return nil
+	}
+
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return []string{fmt.Sprintf("%s: parent of %s is %s, want object", path, seg, typeOf(v))}
+	}
+	child, ok := obj[seg]
+	if !ok {
+		return []string{fmt.Sprintf("missing %s", path)}
+	}
+	return checkPath(child, segments[1:], path, kind)
+}
+
+func typeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// first returns the string at key of the first element of the array at path,
+// "" when there is none
+func first(doc any, path, key string) string {
+	v := doc
+	for _, seg := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return ""
+		}
+		v = obj[seg]
+	}
+	items, ok := v.([]any)
+	if !ok || len(items) == 0 {
+		return ""
+	}
+	obj, ok := items[0].(map[string]any)
+	if !ok {
+		return ""
+	}
+	s, _ := obj[key].(string)
+	return s
+}
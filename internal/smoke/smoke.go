@@ -0,0 +1,230 @@
+// Package smoke checks a deployed PassBi API end to end, after a deploy:
+// every public read endpoint of v2 and v3 is called once, and its status,
+// content type, required JSON fields and latency are asserted
+//
+// Checks run in order: stop, route and trip IDs found by the first ones are
+// used by the later ones, so nothing but a base URL is needed. Nothing is
+// written: endpoints that create data are left out
+package smoke
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Config holds the smoke test settings
+type Config struct {
+	BaseURL string // such as https://api.passbi.com
+	APIKey  string // sent as a bearer token when set
+	// From and To are searched between; stops are looked up near From
+	From, To Point
+	Query    string // stop name searched
+	// Budget is the latency allowed to a request, and SearchBudget to route
+	// searches and timetables, which do more work
+	Budget       time.Duration
+	SearchBudget time.Duration
+	Timeout      time.Duration // of each request
+}
+
+// Point is a place, in degrees
+type Point struct {
+	Lat, Lon float64
+}
+
+func (p Point) String() string {
+	return fmt.Sprintf("%.6f,%.6f", p.Lat, p.Lon)
+}
+
+// DefaultConfig searches across central Dakar
+func DefaultConfig() Config {
+	return Config{
+		BaseURL:      "http://localhost:8080",
+		From:         Point{14.7167, -17.4677},
+		To:           Point{14.6928, -17.4467},
+		Query:        "gare",
+		Budget:       time.Second,
+		SearchBudget: 5 * time.Second,
+		Timeout:      30 * time.Second,
+	}
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Name    string        `json:"name"`
+	URL     string        `json:"url,omitempty"`
+	Status  int           `json:"status,omitempty"`
+	Latency time.Duration `json:"latency_ns"`
+	Budget  time.Duration `json:"budget_ns"`
+	// Errors are the assertions that failed; none when the check passed
+	Errors  []string `json:"errors,omitempty"`
+	Skipped string   `json:"skipped,omitempty"` // why the check did not run
+}
+
+// Passed reports whether the check ran and every assertion held
+func (r Result) Passed() bool {
+	return r.Skipped == "" && len(r.Errors) == 0
+}
+
+// Report is the outcome of a run
+type Report struct {
+	BaseURL string   `json:"base_url"`
+	Results []Result `json:"results"`
+	Passed  int      `json:"passed"`
+	Failed  int      `json:"failed"`
+	Skipped int      `json:"skipped"`
+}
+
+// ids are what the checks learn for the later ones
+type ids struct {
+	stop, route, trip string
+}
+
+// check is a request and what its response must be
+type check struct {
+	name string
+	// path returns the path and query, "" when an ID it needs is unknown
+	path        func(cfg Config, known ids) string
+	status      []int  // accepted statuses; 200 when empty
+	contentType string // prefix; JSON when empty
+	fields      []string
+	slow        bool // held to SearchBudget
+	learn       func(body any, known *ids)
+}
+
+// Run runs every check against cfg.BaseURL; client may be nil
+// A failed check does not stop the run; checks whose IDs are unknown are
+// skipped
+func Run(ctx context.Context, cfg Config, client *http.Client) *Report {
+	if client == nil {
+		client = &http.Client{Timeout: cfg.Timeout}
+	}
+	report := &Report{BaseURL: cfg.BaseURL}
+	var known ids
+	for _, c := range checks() {
+		if ctx.Err() != nil {
+			break
+		}
+		r := run(ctx, cfg, client, c, &known)
+		switch {
+		case r.Skipped != "":
+			report.Skipped++
+		case r.Passed():
+			report.Passed++
+		default:
+			report.Failed++
+		}
+		report.Results = append(report.Results, r)
+	}
+	return report
+}
+
+func run(ctx context.Context, cfg Config, client *http.Client, c check, known *ids) Result {
+	r := Result{Name: c.name, Budget: cfg.Budget}
+	if c.slow {
+		r.Budget = cfg.SearchBudget
+	}
+	path := c.path(cfg, *known)
+	if path == "" {
+		r.Skipped = "no ID from an earlier check"
+		return r
+	}
+	r.URL = strings.TrimRight(cfg.BaseURL, "/") + path
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL, nil)
+	if err != nil {
+		r.Errors = append(r.Errors, err.Error())
+		return r
+	}
+	req.Header.Set("User-Agent", "passbi-smoke")
+	if cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		r.Latency = time.Since(start)
+		r.Errors = append(r.Errors, err.Error())
+		return r
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	r.Latency = time.Since(start)
+	r.Status = resp.StatusCode
+	if err != nil {
+		r.Errors = append(r.Errors, fmt.Sprintf("reading the body: %v", err))
+		return r
+	}
+
+	accepted := c.status
+	if len(accepted) == 0 {
+		accepted = []int{http.StatusOK}
+	}
+	if !containsInt(accepted, resp.StatusCode) {
+		r.Errors = append(r.Errors, fmt.Sprintf("status %d, want %v%s", resp.StatusCode, accepted, excerpt(body)))
+		return r
+	}
+	if r.Latency > r.Budget {
+		r.Errors = append(r.Errors, fmt.Sprintf("took %s, over the %s budget", r.Latency.Round(time.Millisecond), r.Budget))
+	}
+	if resp.StatusCode != http.StatusOK {
+		// An accepted error status, such as a trip not archived
+		return r
+	}
+	contentType := c.contentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, contentType) {
+		r.Errors = append(r.Errors, fmt.Sprintf("content type %q, want %s", got, contentType))
+		return r
+	}
+	if contentType != "application/json" {
+		return r
+	}
+
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		r.Errors = append(r.Errors, fmt.Sprintf("invalid JSON: %v", err))
+		return r
+	}
+	r.Errors = append(r.Errors, checkFields(doc, c.fields)...)
+	if c.learn != nil && len(r.Errors) == 0 {
+		c.learn(doc, known)
+	}
+	return r
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// excerpt is the start of an error body, for the failure message
+func excerpt(body []byte) string {
+	s := strings.TrimSpace(string(body))
+	if s == "" {
+		return ""
+	}
+	if len(s) > 200 {
+		s = s[:200] + "..."
+	}
+	return ": " + s
+}
+
+func q(values ...string) string {
+	v := url.Values{}
+	for i := 0; i+1 < len(values); i += 2 {
+		v.Set(values[i], values[i+1])
+	}
+	return "?" + v.Encode()
+}
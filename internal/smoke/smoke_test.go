@@ -0,0 +1,88 @@
+package smoke
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckFields(t *testing.T) {
+	var doc any
+	json.Unmarshal([]byte(`{"route":{"id":"R1"},"trips":[{"trip_id":"T1"},{"trip_id":2}],"empty":[],"total":3}`), &doc)
+
+	assert.Empty(t, checkFields(doc, []string{"route.id:string", "trips:array+", "total:number", "empty:array", "empty[].x:string"}))
+	assert.Equal(t, []string{
+		"element 1: trips[].trip_id is number, want string",
+		"empty is empty",
+		"missing route.name",
+		"total is number, want string",
+		`invalid field "total"`,
+	}, checkFields(doc, []string{"trips[].trip_id:string", "empty:array+", "route.name:string", "total:string", "total"}))
+
+	assert.Equal(t, "T1", first(doc, "trips", "trip_id"))
+	assert.Equal(t, "", first(doc, "empty", "id"))
+}
+
+func TestRun(t *testing.T) {
+	mux := http.NewServeMux()
+	reply := func(path string, status int, body string) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		})
+	}
+	reply("/livez", 200, `{"status":"alive"}`)
+	reply("/readyz", 503, `{"status":"not_ready","checks":{"graph":"not loaded"}}`)
+	reply("/v2/stops/nearby", 200, `{"stops":[{"id":"S1","name":"Sandaga","distance_meters":12}]}`)
+	reply("/v2/stops/S1/departures", 200, `{"stop":{"id":"S1"},"departures":[],"date":"2026-10-16","total":0}`)
+	reply("/v3/stops/S1/departures", 200, `{"data":{"stop":{"id":"S1"},"departures":[],"date":"2026-10-16"}}`)
+	mux.HandleFunc("/v2/route-search", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		time.Sleep(30 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"routes":{}}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	cfg := DefaultConfig()
+	cfg.BaseURL, cfg.APIKey = srv.URL+"/", "secret"
+	cfg.Budget, cfg.SearchBudget = time.Second, 10*time.Millisecond
+	report := Run(context.Background(), cfg, nil)
+
+	results := make(map[string]Result)
+	for _, r := range report.Results {
+		results[r.Name] = r
+	}
+	assert.Len(t, report.Results, len(checks()))
+	assert.Equal(t, len(report.Results), report.Passed+report.Failed+report.Skipped)
+
+	assert.True(t, results["livez"].Passed())
+	assert.Equal(t, srv.URL+"/livez", results["livez"].URL)
+	assert.Contains(t, results["readyz"].Errors[0], "status 503, want [200]: {\"status\":\"not_ready\"")
+	if assert.Len(t, results["v2 route-search"].Errors, 1) {
+		assert.Contains(t, results["v2 route-search"].Errors[0], "over the 10ms budget")
+	}
+
+	// The stop found nearby is used by the stop checks
+	assert.True(t, results["v2 stops/nearby"].Passed())
+	assert.True(t, results["v2 stops/:id/departures"].Passed(), results["v2 stops/:id/departures"].Errors)
+	assert.Equal(t, srv.URL+"/v2/stops/S1/departures", results["v2 stops/:id/departures"].URL)
+	assert.Equal(t, []string{"missing data.total"}, results["v3 stops/:id/departures"].Errors)
+	assert.NotEmpty(t, results["v2 stops/:id/routes"].Errors) // 404
+
+	// No route was found, so the route checks did not run
+	assert.Equal(t, "no ID from an earlier check", results["v2 routes/:id/schedule"].Skipped)
+	assert.Equal(t, "no ID from an earlier check", results["v3 trips/:id/replay"].Skipped)
+	assert.False(t, results["v2 routes/:id/schedule"].Passed())
+
+	_, hasV3Ics := results["v3 routes/:id/schedule.ics"]
+	assert.False(t, hasV3Ics)
+	assert.Contains(t, results, "v3 routes/list")
+}
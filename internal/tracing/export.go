@@ -0,0 +1,353 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/logging"
+	"github.com/passbi/passbi_core/internal/metrics"
+)
+
+var logger = logging.For("tracing")
+
+// Config holds the OTLP exporter configuration
+// The standard OTEL_* environment variables are honored so that collectors
+// and vendors can be configured as for any OpenTelemetry SDK
+type Config struct {
+	Endpoint    string            // full URL spans are POSTed to; "" disables tracing
+	Headers     map[string]string // e.g. authentication for hosted collectors
+	ServiceName string
+	SampleRatio float64 // share of new traces recorded, 0 to 1
+
+	BatchSize     int
+	BatchInterval time.Duration
+	QueueSize     int
+}
+
+// LoadConfigFromEnv loads the exporter configuration from environment variables
+func LoadConfigFromEnv(serviceName string) *Config {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimRight(base, "/") + "/v1/traces"
+		}
+	}
+
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		serviceName = name
+	}
+
+	ratio := 1.0
+	if v, err := strconv.ParseFloat(os.Getenv("OTEL_TRACES_SAMPLER_ARG"), 64); err == nil && v >= 0 && v <= 1 {
+		ratio = v
+	}
+
+	return &Config{
+		Endpoint:      endpoint,
+		Headers:       parseHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+		ServiceName:   serviceName,
+		SampleRatio:   ratio,
+		BatchSize:     512,
+		BatchInterval: 5 * time.Second,
+		QueueSize:     4096,
+	}
+}
+
+// parseHeaders parses "key=value,key2=value2"
+func parseHeaders(s string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if k = strings.TrimSpace(k); ok && k != "" {
+			headers[k] = strings.TrimSpace(v)
+		}
+	}
+	return headers
+}
+
+// exporter batches ended spans and POSTs them as OTLP/JSON
+type exporter struct {
+	cfg    Config
+	client *http.Client
+	queue  chan *Span
+	done   chan struct{}
+}
+
+var (
+	current atomic.Pointer[exporter]
+
+	spansExported atomic.Int64
+	spansDropped  atomic.Int64
+	exportErrors  atomic.Int64
+)
+
+func init() {
+	metrics.Register(func(w *metrics.Writer) {
+		w.Counter("passbi_tracing_spans_exported_total", "Spans sent to the OTLP collector", float64(spansExported.Load()))
+		w.Counter("passbi_tracing_spans_dropped_total", "Spans dropped because the export queue was full or the collector failed", float64(spansDropped.Load()))
+		w.Counter("passbi_tracing_export_errors_total", "Failed OTLP export requests", float64(exportErrors.Load()))
+	})
+}
+
+// Init starts exporting spans; it does nothing when cfg has no endpoint
+func Init(cfg *Config) {
+	if cfg == nil || cfg.Endpoint == "" {
+		return
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 512
+	}
+	if cfg.BatchInterval <= 0 {
+		cfg.BatchInterval = 5 * time.Second
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 4096
+	}
+
+	e := &exporter{
+		cfg:    *cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan *Span, cfg.QueueSize),
+		done:   make(chan struct{}),
+	}
+	go e.run()
+
+	if old := current.Swap(e); old != nil {
+		old.stop(5 * time.Second)
+	}
+	logger.Info("Tracing enabled", "endpoint", cfg.Endpoint, "sample_ratio", cfg.SampleRatio)
+}
+
+// Close flushes queued spans and stops exporting
+func Close() {
+	if e := current.Swap(nil); e != nil {
+		e.stop(5 * time.Second)
+	}
+}
+
+// Enabled reports whether spans are being recorded
+func Enabled() bool {
+	return current.Load() != nil
+}
+
+func sample() bool {
+	e := current.Load()
+	return e != nil && (e.cfg.SampleRatio >= 1 || rand.Float64() < e.cfg.SampleRatio)
+}
+
+// export queues an ended span, dropping it when the queue is full so that
+// a slow collector never holds up requests
+func export(s *Span) {
+	e := current.Load()
+	if e == nil {
+		return
+	}
+	defer func() {
+		// The exporter was closed concurrently
+		if recover() != nil {
+			spansDropped.Add(1)
+		}
+	}()
+
+	select {
+	case e.queue <- s:
+	default:
+		spansDropped.Add(1)
+	}
+}
+
+func (e *exporter) stop(timeout time.Duration) {
+	close(e.queue)
+	select {
+	case <-e.done:
+	case <-time.After(timeout):
+		logger.Warn("Timed out flushing spans")
+	}
+}
+
+func (e *exporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.cfg.BatchInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, e.cfg.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			exportErrors.Add(1)
+			spansDropped.Add(int64(len(batch)))
+			logger.Error("Failed to export spans", "spans", len(batch), "error", err)
+		} else {
+			spansExported.Add(int64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case s, ok := <-e.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) >= e.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (e *exporter) send(spans []*Span) error {
+	body, err := json.Marshal(encodeSpans(e.cfg.ServiceName, spans))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// OTLP/JSON request body (ExportTraceServiceRequest)
+// IDs are hex strings and 64-bit integers are decimal strings
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"` // 2: error
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+func encodeSpans(serviceName string, spans []*Span) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        encodeAttrs(s.attrs),
+		}
+		if s.parentID != ([8]byte{}) {
+			span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		if s.failed {
+			span.Status = &otlpStatus{Code: 2, Message: s.errMsg}
+		}
+		s.mu.Unlock()
+		out = append(out, span)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: encodeAttrs([]Attr{String("service.name", serviceName)})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/passbi/passbi_core"}, Spans: out}},
+	}}}
+}
+
+func encodeAttrs(attrs []Attr) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		var v otlpAnyValue
+		switch x := a.Value.(type) {
+		case string:
+			v.StringValue = &x
+		case int64:
+			s := strconv.FormatInt(x, 10)
+			v.IntValue = &s
+		case float64:
+			v.DoubleValue = &x
+		case bool:
+			v.BoolValue = &x
+		default:
+			s := fmt.Sprint(x)
+			v.StringValue = &s
+		}
+		kvs = append(kvs, otlpKeyValue{Key: a.Key, Value: v})
+	}
+	return kvs
+}
@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// maxStatementLen bounds the SQL recorded on query spans
+const maxStatementLen = 1000
+
+// QueryTracer records a span for each query run within a traced request
+// Set it as the pgx ConnConfig.Tracer
+type QueryTracer struct{}
+
+type querySpanKey struct{}
+
+// TraceQueryStart implements pgx.QueryTracer
+func (QueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if FromContext(ctx) == nil {
+		return ctx
+	}
+	op := SQLOperation(data.SQL)
+	ctx, span := StartKind(ctx, "db "+op, KindClient,
+		String("db.system", "postgresql"),
+		String("db.operation", op),
+		String("db.statement", SQLStatement(data.SQL)),
+	)
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, querySpanKey{}, span)
+}
+
+// TraceQueryEnd implements pgx.QueryTracer
+func (QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span, ok := ctx.Value(querySpanKey{}).(*Span)
+	if !ok {
+		return
+	}
+	if data.Err != nil && data.Err != pgx.ErrNoRows {
+		span.RecordError(data.Err)
+	}
+	span.SetAttributes(Int("db.rows_affected", int(data.CommandTag.RowsAffected())))
+	span.End()
+}
+
+// SQLOperation returns the first keyword of a statement, e.g. SELECT
+func SQLOperation(sql string) string {
+	for _, line := range strings.Split(sql, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "--") {
+			continue
+		}
+		return strings.ToUpper(strings.Fields(line)[0])
+	}
+	return "QUERY"
+}
+
+// SQLStatement collapses the whitespace of a statement and truncates it
+func SQLStatement(sql string) string {
+	s := strings.Join(strings.Fields(sql), " ")
+	if len(s) > maxStatementLen {
+		s = s[:maxStatementLen] + "..."
+	}
+	return s
+}
+
+// RedisHook records a span for each Redis command run within a traced request
+// Add it with client.AddHook
+type RedisHook struct{}
+
+// DialHook implements redis.Hook
+func (RedisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+// ProcessHook implements redis.Hook
+func (RedisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, span := StartKind(ctx, "redis "+cmd.Name(), KindClient,
+			String("db.system", "redis"),
+			String("db.operation", cmd.Name()),
+		)
+		err := next(ctx, cmd)
+		if err != nil && err != redis.Nil {
+			span.RecordError(err)
+		}
+		span.End()
+		return err
+	}
+}
+
+// ProcessPipelineHook implements redis.Hook
+func (RedisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, span := StartKind(ctx, "redis pipeline", KindClient,
+			String("db.system", "redis"),
+			String("db.operation", "pipeline"),
+			Int("db.redis.commands", len(cmds)),
+		)
+		err := next(ctx, cmds)
+		if err != nil && err != redis.Nil {
+			span.RecordError(err)
+		}
+		span.End()
+		return err
+	}
+}
@@ -0,0 +1,273 @@
+// Package tracing records OpenTelemetry spans and exports them over OTLP/HTTP
+// Request spans are started by the HTTP middleware; database, Redis and
+// routing code add child spans to them, so the time of a slow request can be
+// broken down across cache, database and computation. Without an OTLP
+// endpoint nothing is recorded and every span is a no-op nil *Span
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Span kinds, as numbered by OTLP
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+// Attr is a span attribute
+type Attr struct {
+	Key   string
+	Value interface{} // string, int64, float64 or bool
+}
+
+// String creates a string attribute
+func String(key, value string) Attr { return Attr{Key: key, Value: value} }
+
+// Int creates an integer attribute
+func Int(key string, value int) Attr { return Attr{Key: key, Value: int64(value)} }
+
+// Float creates a floating point attribute
+func Float(key string, value float64) Attr { return Attr{Key: key, Value: value} }
+
+// Bool creates a boolean attribute
+func Bool(key string, value bool) Attr { return Attr{Key: key, Value: value} }
+
+// Span is a timed operation within a trace
+// A nil *Span is valid and ignores every call, which is what Start returns
+// when tracing is disabled or the request is not sampled
+type Span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+	end      time.Time
+
+	mu     sync.Mutex
+	attrs  []Attr
+	errMsg string
+	failed bool
+	ended  bool
+}
+
+type spanKey struct{}
+
+// FromContext returns the span carried by ctx, if any
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// ContextWithSpan returns a copy of ctx carrying s
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// BindRequest makes s the parent of spans started from the request's context
+// Handlers pass c.Context() (the *fasthttp.RequestCtx) down to database and
+// cache calls, so the span is stored as a user value rather than in a new context
+func BindRequest(rc *fasthttp.RequestCtx, s *Span) {
+	if s != nil {
+		rc.SetUserValue(spanKey{}, s)
+	}
+}
+
+// Start starts a child of the span carried by ctx
+// Operations outside a traced request, such as background jobs, are not
+// recorded: Start then returns ctx unchanged and a nil span
+func Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	return StartKind(ctx, name, KindInternal, attrs...)
+}
+
+// StartKind is Start with a span kind
+func StartKind(ctx context.Context, name string, kind int, attrs ...Attr) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil || !Enabled() {
+		return ctx, nil
+	}
+
+	s := newSpan(parent.traceID, name, kind, attrs)
+	s.parentID = parent.spanID
+	return ContextWithSpan(ctx, s), s
+}
+
+// StartServer starts the root span of an incoming request
+// traceparent is the request's W3C traceparent header: the span joins the
+// caller's trace and follows its sampling decision. Without one a new trace
+// is started and sampled at the configured ratio
+func StartServer(traceparent, name string, attrs ...Attr) *Span {
+	if !Enabled() {
+		return nil
+	}
+
+	traceID, parentID, sampled, ok := ParseTraceparent(traceparent)
+	if !ok {
+		if !sample() {
+			return nil
+		}
+		traceID = newTraceID()
+	} else if !sampled {
+		return nil
+	}
+
+	s := newSpan(traceID, name, KindServer, attrs)
+	s.parentID = parentID
+	return s
+}
+
+func newSpan(traceID [16]byte, name string, kind int, attrs []Attr) *Span {
+	s := &Span{
+		traceID: traceID,
+		spanID:  newSpanID(),
+		name:    name,
+		kind:    kind,
+		start:   time.Now(),
+	}
+	s.attrs = append(s.attrs, attrs...)
+	return s
+}
+
+// SetName renames the span, e.g. once the matched route is known
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attrs...)
+	s.mu.Unlock()
+}
+
+// RecordError marks the span as failed; a nil err is ignored
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.Fail(err.Error())
+}
+
+// Fail marks the span as failed with a message
+func (s *Span) Fail(msg string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.failed = true
+	s.errMsg = msg
+	s.mu.Unlock()
+}
+
+// End ends the span and queues it for export; later calls are ignored
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	export(s)
+}
+
+// TraceID returns the hex trace ID, or "" for a nil span
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// Traceparent returns the W3C traceparent header identifying the span
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return "00-" + hex.EncodeToString(s.traceID[:]) + "-" + hex.EncodeToString(s.spanID[:]) + "-01"
+}
+
+var errTraceparent = errors.New("invalid traceparent")
+
+// ParseTraceparent parses a W3C traceparent header ("00-<trace>-<span>-<flags>")
+func ParseTraceparent(h string) (traceID [16]byte, spanID [8]byte, sampled bool, ok bool) {
+	if err := parseTraceparent(strings.TrimSpace(h), &traceID, &spanID, &sampled); err != nil {
+		return [16]byte{}, [8]byte{}, false, false
+	}
+	return traceID, spanID, sampled, true
+}
+
+func parseTraceparent(h string, traceID *[16]byte, spanID *[8]byte, sampled *bool) error {
+	parts := strings.Split(h, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return errTraceparent
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return errTraceparent
+	}
+
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return errTraceparent
+	}
+	if _, err := hex.Decode(spanID[:], []byte(parts[2])); err != nil {
+		return errTraceparent
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return errTraceparent
+	}
+	if *traceID == ([16]byte{}) || *spanID == ([8]byte{}) {
+		return errTraceparent
+	}
+
+	*sampled = flags[0]&1 == 1
+	return nil
+}
+
+func newTraceID() (id [16]byte) {
+	for id == ([16]byte{}) {
+		putUint64(id[:8], rand.Uint64())
+		putUint64(id[8:], rand.Uint64())
+	}
+	return id
+}
+
+func newSpanID() (id [8]byte) {
+	for id == ([8]byte{}) {
+		putUint64(id[:], rand.Uint64())
+	}
+	return id
+}
+
+func putUint64(b []byte, v uint64) {
+	for i := range b {
+		b[i] = byte(v >> (8 * i))
+	}
+}
@@ -0,0 +1,130 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	traceID, spanID, sampled, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if assert.True(t, ok) {
+		assert.Equal(t, byte(0x4b), traceID[0])
+		assert.Equal(t, byte(0xb7), spanID[7])
+		assert.True(t, sampled)
+	}
+
+	_, _, sampled, ok = ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	assert.True(t, ok)
+	assert.False(t, sampled)
+
+	for _, h := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-zzf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		_, _, _, ok := ParseTraceparent(h)
+		assert.False(t, ok, h)
+	}
+}
+
+func TestDisabledSpansAreNoops(t *testing.T) {
+	Close()
+	assert.False(t, Enabled())
+	assert.Nil(t, StartServer("", "GET /"))
+
+	ctx, span := Start(context.Background(), "child")
+	assert.Nil(t, span)
+	assert.Nil(t, FromContext(ctx))
+
+	// A nil span ignores every call
+	span.SetAttributes(String("k", "v"))
+	span.RecordError(errors.New("boom"))
+	span.End()
+	assert.Empty(t, span.Traceparent())
+}
+
+func TestExportOTLP(t *testing.T) {
+	received := make(chan otlpRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("X-Api-Key"))
+		var body otlpRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		received <- body
+	}))
+	defer srv.Close()
+
+	Init(&Config{
+		Endpoint:      srv.URL,
+		Headers:       map[string]string{"X-Api-Key": "secret"},
+		ServiceName:   "passbi-test",
+		SampleRatio:   0, // the caller's sampling decision wins
+		BatchInterval: time.Hour,
+	})
+	defer Close()
+
+	root := StartServer("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "GET /v2/route-search")
+	if !assert.NotNil(t, root) {
+		return
+	}
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", root.TraceID())
+
+	ctx := ContextWithSpan(context.Background(), root)
+	_, child := Start(ctx, "routing.astar", Int("routing.explored_nodes", 42))
+	child.RecordError(errors.New("no path found"))
+	child.End()
+	root.End()
+	root.End() // ended once
+
+	assert.Nil(t, StartServer("", "GET /"), "new traces are not sampled at ratio 0")
+
+	Close()
+
+	var body otlpRequest
+	select {
+	case body = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no spans exported")
+	}
+
+	if !assert.Len(t, body.ResourceSpans, 1) {
+		return
+	}
+	rs := body.ResourceSpans[0]
+	assert.Equal(t, "service.name", rs.Resource.Attributes[0].Key)
+	assert.Equal(t, "passbi-test", *rs.Resource.Attributes[0].Value.StringValue)
+
+	spans := rs.ScopeSpans[0].Spans
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	c, r := spans[0], spans[1]
+	assert.Equal(t, "routing.astar", c.Name)
+	assert.Equal(t, r.SpanID, c.ParentSpanID)
+	assert.Equal(t, r.TraceID, c.TraceID)
+	assert.Equal(t, "42", *c.Attributes[0].Value.IntValue)
+	if assert.NotNil(t, c.Status) {
+		assert.Equal(t, 2, c.Status.Code)
+	}
+
+	assert.Equal(t, KindServer, r.Kind)
+	assert.Equal(t, "00f067aa0ba902b7", r.ParentSpanID)
+	assert.Nil(t, r.Status)
+}
+
+func TestStatement(t *testing.T) {
+	assert.Equal(t, "SELECT", SQLOperation("\n\t\tselect id FROM stop"))
+	assert.Equal(t, "UPDATE", SQLOperation("-- bump\nUPDATE api_key SET x = 1"))
+	assert.Equal(t, "SELECT id FROM stop WHERE id = $1", SQLStatement("SELECT id\n\t\tFROM stop\n\t\tWHERE id = $1"))
+}
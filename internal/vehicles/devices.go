@@ -0,0 +1,258 @@
+package vehicles
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/passbi/passbi_core/internal/models"
+)
+
+// ErrDeviceNotFound is returned for an unknown, revoked or foreign device
+var ErrDeviceNotFound = errors.New("device not found")
+
+// DeviceTokenPrefix starts every driver app token, telling it apart from
+// partner API keys
+const DeviceTokenPrefix = "pd_"
+
+// maxSessionLength bounds the session identifiers the app sends
+const maxSessionLength = 100
+
+// Device is a driver app install bound to a vehicle
+type Device struct {
+	ID         string     `json:"id"`
+	PartnerID  string     `json:"-"`
+	AgencyID   string     `json:"agency_id"`
+	VehicleID  string     `json:"vehicle_id"`
+	RouteID    string     `json:"route_id,omitempty"`
+	Label      string     `json:"label,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// generateDeviceToken returns a device token and its SHA-256 hex hash
+func generateDeviceToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = DeviceTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, hashDeviceToken(token), nil
+}
+
+func hashDeviceToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateDevice registers a device of partnerID ("" when authentication is
+// off) and returns its token, which is not stored and cannot be shown again
+func CreateDevice(ctx context.Context, pool *pgxpool.Pool, partnerID string, d *Device) (string, error) {
+	d.AgencyID = strings.TrimSpace(d.AgencyID)
+	d.VehicleID = strings.TrimSpace(d.VehicleID)
+	d.RouteID = strings.TrimSpace(d.RouteID)
+	d.Label = strings.TrimSpace(d.Label)
+	if d.AgencyID == "" || d.VehicleID == "" {
+		return "", fmt.Errorf("%w: agency_id and vehicle_id are required", ErrInvalid)
+	}
+	for name, id := range map[string]string{
+		"agency_id": d.AgencyID, "vehicle_id": d.VehicleID, "route_id": d.RouteID, "label": d.Label,
+	} {
+		if len(id) > maxIDLength {
+			return "", fmt.Errorf("%w: %s is longer than %d characters", ErrInvalid, name, maxIDLength)
+		}
+	}
+
+	token, hash, err := generateDeviceToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate device token: %w", err)
+	}
+	err = pool.QueryRow(ctx, `
+		INSERT INTO driver_device (partner_id, agency_id, vehicle_id, route_id, label, token_hash)
+		VALUES (NULLIF($1, '')::uuid, $2, $3, NULLIF($4, ''), $5, $6)
+		RETURNING id, created_at
+	`, partnerID, d.AgencyID, d.VehicleID, d.RouteID, d.Label, hash).Scan(&d.ID, &d.CreatedAt)
+	if err != nil {
+		return "", fmt.Errorf("failed to create device: %w", err)
+	}
+	d.PartnerID = partnerID
+	return token, nil
+}
+
+// ListDevices returns the devices of partnerID, newest first, revoked ones
+// included
+func ListDevices(ctx context.Context, pool *pgxpool.Pool, partnerID string) ([]Device, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT id, agency_id, vehicle_id, COALESCE(route_id, ''), label, created_at, last_seen_at, revoked_at
+		FROM driver_device
+		WHERE partner_id IS NOT DISTINCT FROM NULLIF($1, '')::uuid
+		ORDER BY created_at DESC
+	`, partnerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query devices: %w", err)
+	}
+	defer rows.Close()
+
+	devices := []Device{}
+	for rows.Next() {
+		d := Device{PartnerID: partnerID}
+		if err := rows.Scan(&d.ID, &d.AgencyID, &d.VehicleID, &d.RouteID, &d.Label,
+			&d.CreatedAt, &d.LastSeenAt, &d.RevokedAt); err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+// RevokeDevice stops a device of partnerID from pushing pings
+// Agencies, when not empty, restricts which devices may be revoked
+func RevokeDevice(ctx context.Context, pool *pgxpool.Pool, partnerID, id string, agencies []string) error {
+	tag, err := pool.Exec(ctx, `
+		UPDATE driver_device SET revoked_at = NOW()
+		WHERE id::text = $1 AND partner_id IS NOT DISTINCT FROM NULLIF($2, '')::uuid
+		  AND revoked_at IS NULL
+		  AND (COALESCE(cardinality($3::text[]), 0) = 0 OR agency_id = ANY($3))
+	`, id, partnerID, agencies)
+	if err != nil {
+		return fmt.Errorf("failed to revoke device: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDeviceNotFound
+	}
+	return nil
+}
+
+// AuthenticateDevice returns the device a token belongs to and marks it seen
+// Revoked devices and devices of a suspended partner are not found
+func AuthenticateDevice(ctx context.Context, pool *pgxpool.Pool, token string) (*Device, error) {
+	if !strings.HasPrefix(token, DeviceTokenPrefix) {
+		return nil, ErrDeviceNotFound
+	}
+
+	var d Device
+	err := pool.QueryRow(ctx, `
+		UPDATE driver_device d SET last_seen_at = NOW()
+		WHERE d.token_hash = $1 AND d.revoked_at IS NULL
+		  AND (d.partner_id IS NULL OR EXISTS (
+			SELECT 1 FROM partner p WHERE p.id = d.partner_id AND p.status = 'active'
+		  ))
+		RETURNING d.id, COALESCE(d.partner_id::text, ''), d.agency_id, d.vehicle_id,
+			COALESCE(d.route_id, ''), d.label, d.created_at, d.last_seen_at
+	`, hashDeviceToken(token)).Scan(&d.ID, &d.PartnerID, &d.AgencyID, &d.VehicleID,
+		&d.RouteID, &d.Label, &d.CreatedAt, &d.LastSeenAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate device: %w", err)
+	}
+	return &d, nil
+}
+
+// Ping is a normalized fix of a driver app upload with its sequence number,
+// which increases through an app session
+type Ping struct {
+	Seq      int64
+	Position models.VehiclePosition
+}
+
+// PingResult counts what StorePings did with an upload
+type PingResult struct {
+	Ack        int64 // every ping of the session up to Ack is stored or dropped
+	Stored     int
+	Duplicates int
+	Live       int
+}
+
+// StorePings records the pings of a device's upload that were not stored
+// before and moves the session's watermark to through, the highest sequence
+// number of the upload including the pings dropped as invalid
+// The app deletes pings up to the returned Ack from its offline buffer and
+// uploads the rest again; the watermark only moves when the pings are
+// stored, and concurrent uploads of a session wait for each other
+func StorePings(ctx context.Context, pool *pgxpool.Pool, rdb *redis.Client, cfg Config, device *Device, session string, through int64, pings []Ping) (PingResult, error) {
+	var result PingResult
+	if session == "" || len(session) > maxSessionLength {
+		return result, fmt.Errorf("%w: session must be 1 to %d characters", ErrInvalid, maxSessionLength)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var last int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO driver_session (device_id, session, last_seq)
+		VALUES ($1, $2, 0)
+		ON CONFLICT (device_id, session) DO UPDATE SET updated_at = NOW()
+		RETURNING last_seq
+	`, device.ID, session).Scan(&last)
+	if err != nil {
+		return result, fmt.Errorf("failed to lock driver session: %w", err)
+	}
+
+	fresh := newPings(pings, last)
+	result.Duplicates = len(pings) - len(fresh)
+	result.Ack = max(last, through)
+	if result.Ack == last {
+		return result, tx.Commit(ctx)
+	}
+
+	positions := make([]models.VehiclePosition, len(fresh))
+	for i, p := range fresh {
+		positions[i] = p.Position
+	}
+	stored, err := Store(ctx, pool, rdb, cfg, device.PartnerID, positions)
+	if err != nil {
+		return PingResult{}, err
+	}
+	result.Stored, result.Live = stored.Stored, stored.Live
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE driver_session SET last_seq = $3, updated_at = NOW()
+		WHERE device_id = $1 AND session = $2
+	`, device.ID, session, result.Ack); err != nil {
+		return PingResult{}, fmt.Errorf("failed to update driver session: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return PingResult{}, fmt.Errorf("failed to update driver session: %w", err)
+	}
+	return result, nil
+}
+
+// newPings keeps the pings above the watermark, once each
+func newPings(pings []Ping, last int64) []Ping {
+	seen := make(map[int64]bool, len(pings))
+	fresh := make([]Ping, 0, len(pings))
+	for _, p := range pings {
+		if p.Seq <= last || seen[p.Seq] {
+			continue
+		}
+		seen[p.Seq] = true
+		fresh = append(fresh, p)
+	}
+	return fresh
+}
+
+// PurgeSessions deletes the driver sessions idle since the given time
+func PurgeSessions(ctx context.Context, pool *pgxpool.Pool, before time.Time) (int64, error) {
+	tag, err := pool.Exec(ctx, `DELETE FROM driver_session WHERE updated_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge driver sessions: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,444 @@
+// Package vehicles stores the GPS fixes operator systems and the driver app
+// push: the latest fix of each vehicle in Redis for live maps, and every fix
+// in Postgres until the retention period has passed
+package vehicles
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/passbi/passbi_core/internal/logging"
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/passbi/passbi_core/internal/mqtt"
+)
+
+var logger = logging.For("vehicles")
+
+// ErrInvalid is wrapped by the validation errors of Normalize
+var ErrInvalid = errors.New("invalid position")
+
+// maxClockSkew is how far in the future a fix may be dated, for devices whose
+// clock runs ahead
+const maxClockSkew = time.Minute
+
+// Length limits bound what a single fix stores
+const maxIDLength = 100
+
+// Config holds the lifetimes of stored positions
+type Config struct {
+	LiveTTL   time.Duration // how long a vehicle stays live after its last fix
+	Retention time.Duration // how long fixes are kept in Postgres
+	MaxBatch  int           // fixes accepted in one request
+	// Driver app uploads, which may carry pings buffered while offline
+	MaxPings    int     // pings accepted in one upload
+	MaxAccuracy float64 // meters; less accurate pings are dropped
+}
+
+// DefaultConfig keeps vehicles live for 5 minutes and their history for a week
+func DefaultConfig() Config {
+	return Config{
+		LiveTTL:   5 * time.Minute,
+		Retention: 7 * 24 * time.Hour,
+		MaxBatch:  500,
+
+		MaxPings:    2000,
+		MaxAccuracy: 100,
+	}
+}
+
+// ConfigFromEnv returns the defaults overridden by VEHICLE_POSITION_*
+// variables
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	if d, err := time.ParseDuration(os.Getenv("VEHICLE_POSITION_TTL")); err == nil && d > 0 {
+		cfg.LiveTTL = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("VEHICLE_POSITION_RETENTION")); err == nil && d > 0 {
+		cfg.Retention = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("VEHICLE_POSITION_MAX_BATCH")); err == nil && n > 0 {
+		cfg.MaxBatch = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("DRIVER_PING_MAX_BATCH")); err == nil && n > 0 {
+		cfg.MaxPings = n
+	}
+	if f, err := strconv.ParseFloat(os.Getenv("DRIVER_PING_MAX_ACCURACY"), 64); err == nil && f > 0 {
+		cfg.MaxAccuracy = f
+	}
+	return cfg
+}
+
+// Normalize trims and validates a fix received at now
+// A fix without a timestamp is dated now; one older than the retention
+// period would be purged right away and is refused
+func (cfg Config) Normalize(p *models.VehiclePosition, now time.Time) error {
+	p.VehicleID = strings.TrimSpace(p.VehicleID)
+	p.TripID = strings.TrimSpace(p.TripID)
+	p.RouteID = strings.TrimSpace(p.RouteID)
+	p.AgencyID = strings.TrimSpace(p.AgencyID)
+	p.StopID = strings.TrimSpace(p.StopID)
+
+	if p.VehicleID == "" {
+		return fmt.Errorf("%w: vehicle_id is required", ErrInvalid)
+	}
+	if p.AgencyID == "" {
+		return fmt.Errorf("%w: agency_id is required", ErrInvalid)
+	}
+	if p.TripID == "" && p.RouteID == "" {
+		return fmt.Errorf("%w: trip_id or route_id is required", ErrInvalid)
+	}
+	for name, id := range map[string]string{
+		"vehicle_id": p.VehicleID, "trip_id": p.TripID, "route_id": p.RouteID,
+		"agency_id": p.AgencyID, "stop_id": p.StopID,
+	} {
+		if len(id) > maxIDLength {
+			return fmt.Errorf("%w: %s is longer than %d characters", ErrInvalid, name, maxIDLength)
+		}
+	}
+
+	if math.IsNaN(p.Lat) || math.IsNaN(p.Lon) || p.Lat < -90 || p.Lat > 90 || p.Lon < -180 || p.Lon > 180 {
+		return fmt.Errorf("%w: lat and lon must be valid WGS84 coordinates", ErrInvalid)
+	}
+	// Receivers without a fix report 0,0, in the Gulf of Guinea
+	if p.Lat == 0 && p.Lon == 0 {
+		return fmt.Errorf("%w: 0,0 is not a GPS fix", ErrInvalid)
+	}
+	if p.Bearing != nil && (math.IsNaN(*p.Bearing) || *p.Bearing < 0 || *p.Bearing >= 360) {
+		return fmt.Errorf("%w: bearing must be in [0, 360)", ErrInvalid)
+	}
+	if p.Speed != nil && (math.IsNaN(*p.Speed) || *p.Speed < 0) {
+		return fmt.Errorf("%w: speed must not be negative", ErrInvalid)
+	}
+
+	if p.Timestamp.IsZero() {
+		p.Timestamp = now
+	}
+	p.Timestamp = p.Timestamp.UTC()
+	if p.Timestamp.After(now.Add(maxClockSkew)) {
+		return fmt.Errorf("%w: timestamp is in the future", ErrInvalid)
+	}
+	if p.Timestamp.Before(now.Add(-cfg.Retention)) {
+		return fmt.Errorf("%w: timestamp is older than the %s retention", ErrInvalid, cfg.Retention)
+	}
+	return nil
+}
+
+// Result counts what Store did with a batch
+type Result struct {
+	Stored int `json:"stored"` // fixes written to the history
+	Live   int `json:"live"`   // vehicles whose live position moved forward
+}
+
+// Store records normalized fixes pushed by partnerID ("" when authentication
+// is off): every fix goes to the history, and the newest of each vehicle to
+// its route's live positions in Redis and to MQTT
+// Fixes with a trip but no route get the trip's route; Redis and MQTT
+// failures are logged, only the history is required
+func Store(ctx context.Context, pool *pgxpool.Pool, rdb *redis.Client, cfg Config, partnerID string, positions []models.VehiclePosition) (Result, error) {
+	var result Result
+	if len(positions) == 0 {
+		return result, nil
+	}
+	if err := resolveRoutes(ctx, pool, positions); err != nil {
+		return result, err
+	}
+
+	n, err := insert(ctx, pool, partnerID, positions)
+	if err != nil {
+		return result, err
+	}
+	result.Stored = n
+
+	latest := latestByVehicle(positions)
+	if rdb != nil {
+		live, err := storeLive(ctx, rdb, cfg.LiveTTL, latest, time.Now())
+		if err != nil {
+			logger.WarnContext(ctx, "Failed to update live vehicle positions", "error", err)
+		}
+		result.Live = live
+	}
+	publisher := mqtt.GetPublisher()
+	for i := range latest {
+		if err := publisher.PublishPosition(&latest[i]); err != nil {
+			logger.WarnContext(ctx, "Failed to publish vehicle position", "vehicle_id", latest[i].VehicleID, "error", err)
+		}
+	}
+	return result, nil
+}
+
+// resolveRoutes fills in the route of fixes that only name their trip
+// Fixes whose trip is unknown keep an empty route: they are stored but not
+// live, since live positions are kept per route
+func resolveRoutes(ctx context.Context, pool *pgxpool.Pool, positions []models.VehiclePosition) error {
+	var agencies, trips []string
+	for _, p := range positions {
+		if p.RouteID == "" {
+			agencies = append(agencies, p.AgencyID)
+			trips = append(trips, p.TripID)
+		}
+	}
+	if len(trips) == 0 {
+		return nil
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT t.agency_id, t.trip_id, t.route_id
+		FROM trip t
+		JOIN unnest($1::text[], $2::text[]) AS f(agency_id, trip_id)
+			ON t.agency_id = f.agency_id AND t.trip_id = f.trip_id
+	`, agencies, trips)
+	if err != nil {
+		return fmt.Errorf("failed to resolve trip routes: %w", err)
+	}
+	defer rows.Close()
+
+	routes := make(map[[2]string]string)
+	for rows.Next() {
+		var agencyID, tripID, routeID string
+		if err := rows.Scan(&agencyID, &tripID, &routeID); err != nil {
+			return err
+		}
+		routes[[2]string{agencyID, tripID}] = routeID
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to resolve trip routes: %w", err)
+	}
+
+	for i := range positions {
+		if positions[i].RouteID == "" {
+			positions[i].RouteID = routes[[2]string{positions[i].AgencyID, positions[i].TripID}]
+		}
+	}
+	return nil
+}
+
+// insert appends fixes to the history in one statement
+func insert(ctx context.Context, pool *pgxpool.Pool, partnerID string, positions []models.VehiclePosition) (int, error) {
+	n := len(positions)
+	agencies, vehicleIDs, trips, routes, stops := make([]string, n), make([]string, n), make([]string, n), make([]string, n), make([]string, n)
+	lats, lons := make([]float64, n), make([]float64, n)
+	bearings, speeds := make([]*float64, n), make([]*float64, n)
+	recorded := make([]time.Time, n)
+	for i, p := range positions {
+		agencies[i], vehicleIDs[i], trips[i], routes[i], stops[i] = p.AgencyID, p.VehicleID, p.TripID, p.RouteID, p.StopID
+		lats[i], lons[i] = p.Lat, p.Lon
+		bearings[i], speeds[i] = p.Bearing, p.Speed
+		recorded[i] = p.Timestamp
+	}
+
+	tag, err := pool.Exec(ctx, `
+		INSERT INTO vehicle_position
+			(agency_id, vehicle_id, trip_id, route_id, stop_id, lat, lon, bearing, speed, recorded_at, partner_id)
+		SELECT f.agency_id, f.vehicle_id, NULLIF(f.trip_id, ''), NULLIF(f.route_id, ''), NULLIF(f.stop_id, ''),
+			f.lat, f.lon, f.bearing, f.speed, f.recorded_at, NULLIF($11, '')::uuid
+		FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::text[],
+			$6::float8[], $7::float8[], $8::float8[], $9::float8[], $10::timestamptz[])
+			AS f(agency_id, vehicle_id, trip_id, route_id, stop_id, lat, lon, bearing, speed, recorded_at)
+	`, agencies, vehicleIDs, trips, routes, stops, lats, lons, bearings, speeds, recorded, partnerID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to store vehicle positions: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// latestByVehicle keeps the newest fix of each vehicle of a batch, in the
+// order vehicles first appear
+func latestByVehicle(positions []models.VehiclePosition) []models.VehiclePosition {
+	index := make(map[string]int, len(positions))
+	latest := make([]models.VehiclePosition, 0, len(positions))
+	for _, p := range positions {
+		key := vehicleField(p.AgencyID, p.VehicleID)
+		i, seen := index[key]
+		if !seen {
+			index[key] = len(latest)
+			latest = append(latest, p)
+			continue
+		}
+		if p.Timestamp.After(latest[i].Timestamp) {
+			latest[i] = p
+		}
+	}
+	return latest
+}
+
+// LiveKey is the Redis hash of the live positions of a route's vehicles:
+// one JSON models.VehiclePosition per vehicleField
+func LiveKey(routeID string) string {
+	return "vehicles:route:" + routeID
+}
+
+// liveIndexKey is the sorted set of the vehicles of LiveKey, scored by the
+// time of their fix in milliseconds
+func liveIndexKey(routeID string) string {
+	return LiveKey(routeID) + ":seen"
+}
+
+func vehicleField(agencyID, vehicleID string) string {
+	return agencyID + ":" + vehicleID
+}
+
+// liveScript replaces the live position of each vehicle (ARGV triples of
+// field, fix time in ms and JSON from ARGV[3]) unless the stored one is newer,
+// then drops vehicles whose fix is older than ARGV[1] ms and lets both keys
+// (KEYS[1] hash, KEYS[2] index) expire ARGV[2] ms after this update
+// It returns the number of vehicles updated
+var liveScript = redis.NewScript(`
+local updated = 0
+for i = 3, #ARGV, 3 do
+	local current = redis.call('ZSCORE', KEYS[2], ARGV[i])
+	if not current or tonumber(current) <= tonumber(ARGV[i + 1]) then
+		redis.call('ZADD', KEYS[2], ARGV[i + 1], ARGV[i])
+		redis.call('HSET', KEYS[1], ARGV[i], ARGV[i + 2])
+		updated = updated + 1
+	end
+end
+local stale = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', '(' .. ARGV[1])
+if #stale > 0 then
+	redis.call('ZREM', KEYS[2], unpack(stale))
+	redis.call('HDEL', KEYS[1], unpack(stale))
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+redis.call('PEXPIRE', KEYS[2], ARGV[2])
+return updated
+`)
+
+// storeLive updates the live positions of each route in latest; fixes
+// already older than ttl and fixes without a route are skipped
+func storeLive(ctx context.Context, rdb *redis.Client, ttl time.Duration, latest []models.VehiclePosition, now time.Time) (int, error) {
+	cutoff := now.Add(-ttl).UnixMilli()
+	byRoute := make(map[string][]interface{})
+	var routes []string
+	for _, p := range latest {
+		if p.RouteID == "" || p.Timestamp.UnixMilli() < cutoff {
+			continue
+		}
+		data, err := json.Marshal(p)
+		if err != nil {
+			return 0, err
+		}
+		if _, ok := byRoute[p.RouteID]; !ok {
+			routes = append(routes, p.RouteID)
+		}
+		byRoute[p.RouteID] = append(byRoute[p.RouteID], vehicleField(p.AgencyID, p.VehicleID), p.Timestamp.UnixMilli(), data)
+	}
+
+	updated := 0
+	for _, routeID := range routes {
+		args := append([]interface{}{cutoff, ttl.Milliseconds()}, byRoute[routeID]...)
+		n, err := liveScript.Run(ctx, rdb, []string{LiveKey(routeID), liveIndexKey(routeID)}, args...).Int()
+		if err != nil {
+			return updated, err
+		}
+		updated += n
+	}
+	return updated, nil
+}
+
+// Live returns the live positions of a route's vehicles: the newest fix of
+// each vehicle seen within ttl of now
+func Live(ctx context.Context, rdb *redis.Client, routeID string, ttl time.Duration, now time.Time) ([]models.VehiclePosition, error) {
+	fields, err := rdb.ZRangeByScore(ctx, liveIndexKey(routeID), &redis.ZRangeBy{
+		Min: strconv.FormatInt(now.Add(-ttl).UnixMilli(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read live vehicles: %w", err)
+	}
+	if len(fields) == 0 {
+		return []models.VehiclePosition{}, nil
+	}
+
+	values, err := rdb.HMGet(ctx, LiveKey(routeID), fields...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read live vehicles: %w", err)
+	}
+	positions := make([]models.VehiclePosition, 0, len(values))
+	for _, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			continue // expired between the two reads
+		}
+		var p models.VehiclePosition
+		if err := json.Unmarshal([]byte(data), &p); err != nil {
+			logger.WarnContext(ctx, "Skipping unreadable live vehicle position", "route_id", routeID, "error", err)
+			continue
+		}
+		positions = append(positions, p)
+	}
+	return positions, nil
+}
+
+// Recent returns the newest fix of each of a route's vehicles recorded since
+// the given time, from the history; it stands in for Live without Redis
+func Recent(ctx context.Context, pool *pgxpool.Pool, routeID string, since time.Time) ([]models.VehiclePosition, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT DISTINCT ON (agency_id, vehicle_id)
+			agency_id, vehicle_id, COALESCE(trip_id, ''), route_id, lat, lon, bearing, speed,
+			COALESCE(stop_id, ''), recorded_at
+		FROM vehicle_position
+		WHERE route_id = $1 AND recorded_at >= $2
+		ORDER BY agency_id, vehicle_id, recorded_at DESC
+	`, routeID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query vehicle positions: %w", err)
+	}
+	defer rows.Close()
+
+	positions := []models.VehiclePosition{}
+	for rows.Next() {
+		var p models.VehiclePosition
+		if err := rows.Scan(&p.AgencyID, &p.VehicleID, &p.TripID, &p.RouteID, &p.Lat, &p.Lon,
+			&p.Bearing, &p.Speed, &p.StopID, &p.Timestamp); err != nil {
+			return nil, err
+		}
+		positions = append(positions, p)
+	}
+	return positions, rows.Err()
+}
+
+// Purge deletes the fixes recorded before the given time
+func Purge(ctx context.Context, pool *pgxpool.Pool, before time.Time) (int64, error) {
+	tag, err := pool.Exec(ctx, `DELETE FROM vehicle_position WHERE recorded_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge vehicle positions: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// RunRetention purges fixes older than cfg.Retention, and driver app
+// sessions idle as long, every hour until ctx is done
+func RunRetention(ctx context.Context, pool *pgxpool.Pool, cfg Config) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n, err := Purge(ctx, pool, now.Add(-cfg.Retention))
+			if err != nil {
+				logger.ErrorContext(ctx, "Vehicle position retention failed", "error", err)
+				continue
+			}
+			if n > 0 {
+				logger.Info("Purged old vehicle positions", "positions", n)
+			}
+			// A session idle for the retention period can only upload pings
+			// Normalize refuses
+			if _, err := PurgeSessions(ctx, pool, now.Add(-cfg.Retention)); err != nil {
+				logger.ErrorContext(ctx, "Driver session retention failed", "error", err)
+			}
+		}
+	}
+}
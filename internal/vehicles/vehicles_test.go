@@ -0,0 +1,127 @@
+package vehicles
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/passbi/passbi_core/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func fix() models.VehiclePosition {
+	return models.VehiclePosition{
+		VehicleID: " BUS-12 ",
+		RouteID:   "DDD_7",
+		AgencyID:  "dakar_dem_dikk",
+		Lat:       14.6928,
+		Lon:       -17.4467,
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	cfg := DefaultConfig()
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+
+	p := fix()
+	assert.NoError(t, cfg.Normalize(&p, now))
+	assert.Equal(t, "BUS-12", p.VehicleID)
+	assert.Equal(t, now, p.Timestamp, "undated fixes are dated on receipt")
+
+	p = fix()
+	p.Timestamp = now.Add(30 * time.Second).In(time.FixedZone("WAT", 3600))
+	assert.NoError(t, cfg.Normalize(&p, now), "within the clock skew")
+	assert.Equal(t, time.UTC, p.Timestamp.Location())
+
+	p = fix()
+	p.RouteID, p.TripID = "", "trip_1"
+	assert.NoError(t, cfg.Normalize(&p, now), "the route is resolved from the trip")
+}
+
+func TestNormalizeRejects(t *testing.T) {
+	cfg := DefaultConfig()
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	bearing, speed := 360.0, -1.0
+
+	cases := map[string]func(p *models.VehiclePosition){
+		"no vehicle":       func(p *models.VehiclePosition) { p.VehicleID = "  " },
+		"no agency":        func(p *models.VehiclePosition) { p.AgencyID = "" },
+		"no trip or route": func(p *models.VehiclePosition) { p.RouteID = "" },
+		"latitude":         func(p *models.VehiclePosition) { p.Lat = 91 },
+		"longitude":        func(p *models.VehiclePosition) { p.Lon = -181 },
+		"null island":      func(p *models.VehiclePosition) { p.Lat, p.Lon = 0, 0 },
+		"bearing":          func(p *models.VehiclePosition) { p.Bearing = &bearing },
+		"speed":            func(p *models.VehiclePosition) { p.Speed = &speed },
+		"future":           func(p *models.VehiclePosition) { p.Timestamp = now.Add(2 * time.Minute) },
+		"past retention":   func(p *models.VehiclePosition) { p.Timestamp = now.Add(-8 * 24 * time.Hour) },
+		"long id":          func(p *models.VehiclePosition) { p.StopID = string(make([]byte, 101)) },
+	}
+	for name, mutate := range cases {
+		p := fix()
+		mutate(&p)
+		err := cfg.Normalize(&p, now)
+		assert.True(t, errors.Is(err, ErrInvalid), name)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("VEHICLE_POSITION_TTL", "2m")
+	t.Setenv("VEHICLE_POSITION_RETENTION", "720h")
+	t.Setenv("VEHICLE_POSITION_MAX_BATCH", "nope")
+	t.Setenv("DRIVER_PING_MAX_ACCURACY", "50")
+
+	cfg := ConfigFromEnv()
+	assert.Equal(t, 2*time.Minute, cfg.LiveTTL)
+	assert.Equal(t, 30*24*time.Hour, cfg.Retention)
+	assert.Equal(t, DefaultConfig().MaxBatch, cfg.MaxBatch)
+	assert.Equal(t, 50.0, cfg.MaxAccuracy)
+	assert.Equal(t, DefaultConfig().MaxPings, cfg.MaxPings)
+}
+
+func TestLatestByVehicle(t *testing.T) {
+	at := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	positions := []models.VehiclePosition{
+		{AgencyID: "a", VehicleID: "1", Lat: 1, Timestamp: at},
+		{AgencyID: "a", VehicleID: "2", Lat: 2, Timestamp: at},
+		{AgencyID: "a", VehicleID: "1", Lat: 3, Timestamp: at.Add(time.Second)},
+		{AgencyID: "a", VehicleID: "1", Lat: 4, Timestamp: at.Add(-time.Second)},
+		{AgencyID: "b", VehicleID: "1", Lat: 5, Timestamp: at},
+	}
+
+	latest := latestByVehicle(positions)
+	if !assert.Len(t, latest, 3) {
+		return
+	}
+	assert.Equal(t, 3.0, latest[0].Lat, "out of order fixes do not move a vehicle back")
+	assert.Equal(t, 2.0, latest[1].Lat)
+	assert.Equal(t, 5.0, latest[2].Lat, "vehicle IDs are per agency")
+}
+
+func TestNewPings(t *testing.T) {
+	pings := []Ping{{Seq: 3}, {Seq: 4}, {Seq: 5}, {Seq: 4}, {Seq: 7}}
+
+	fresh := newPings(pings, 4)
+	if !assert.Len(t, fresh, 2) {
+		return
+	}
+	assert.Equal(t, int64(5), fresh[0].Seq)
+	assert.Equal(t, int64(7), fresh[1].Seq)
+
+	assert.Len(t, newPings(pings, 0), 4, "a ping uploaded twice in a batch is stored once")
+	assert.Empty(t, newPings(pings, 7))
+}
+
+func TestAuthenticateDeviceRejectsAPIKeys(t *testing.T) {
+	_, err := AuthenticateDevice(context.Background(), nil, "pk_live_abc")
+	assert.ErrorIs(t, err, ErrDeviceNotFound)
+
+	token, hash, err := generateDeviceToken()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, strings.HasPrefix(token, DeviceTokenPrefix))
+	assert.Equal(t, hashDeviceToken(token), hash)
+	assert.Len(t, hash, 64)
+}
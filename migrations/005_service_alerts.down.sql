@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS update_service_alert_updated_at ON service_alert;
+DROP TABLE IF EXISTS service_alert_entity;
+DROP TABLE IF EXISTS service_alert;
@@ -0,0 +1,43 @@
+-- Service alerts: rider-facing disruption notices (strikes, detours, closed stops)
+-- cause/effect use the GTFS-Realtime enum names so alerts can be published as-is
+CREATE TABLE service_alert (
+    id          BIGSERIAL PRIMARY KEY,
+    title       TEXT NOT NULL,
+    description TEXT,
+    url         TEXT,
+    severity    TEXT NOT NULL DEFAULT 'warning' CHECK (severity IN ('info', 'warning', 'severe')),
+    cause       TEXT NOT NULL DEFAULT 'UNKNOWN_CAUSE',
+    effect      TEXT NOT NULL DEFAULT 'UNKNOWN_EFFECT',
+    starts_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ends_at     TIMESTAMPTZ,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT service_alert_window_check CHECK (ends_at IS NULL OR ends_at > starts_at)
+);
+
+CREATE INDEX idx_service_alert_window ON service_alert(starts_at, ends_at);
+
+-- Informed entities: an alert applies to a route, a stop, or a stop on a given route.
+-- An alert with no entity rows applies network-wide.
+CREATE TABLE service_alert_entity (
+    id        BIGSERIAL PRIMARY KEY,
+    alert_id  BIGINT NOT NULL REFERENCES service_alert(id) ON DELETE CASCADE,
+    agency_id TEXT,
+    route_id  TEXT,
+    stop_id   TEXT,
+    CONSTRAINT service_alert_entity_scope_check CHECK (
+        agency_id IS NOT NULL OR route_id IS NOT NULL OR stop_id IS NOT NULL
+    )
+);
+
+CREATE INDEX idx_service_alert_entity_alert ON service_alert_entity(alert_id);
+CREATE INDEX idx_service_alert_entity_route ON service_alert_entity(route_id) WHERE route_id IS NOT NULL;
+CREATE INDEX idx_service_alert_entity_stop ON service_alert_entity(stop_id) WHERE stop_id IS NOT NULL;
+
+CREATE TRIGGER update_service_alert_updated_at
+    BEFORE UPDATE ON service_alert
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE service_alert IS 'Rider-facing service alerts with an active time window';
+COMMENT ON TABLE service_alert_entity IS 'Routes/stops/agencies affected by a service alert';
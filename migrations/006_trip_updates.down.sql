@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS stop_time_update;
+DROP TABLE IF EXISTS trip_update;
@@ -0,0 +1,40 @@
+-- Realtime trip updates ingested from GTFS-Realtime TripUpdates feeds
+-- One row per trip and service day; replaced on every feed fetch
+CREATE TABLE trip_update (
+    agency_id             TEXT NOT NULL,
+    trip_id               TEXT NOT NULL,
+    service_date          DATE NOT NULL,
+    route_id              TEXT,
+    vehicle_id            TEXT,
+    schedule_relationship TEXT NOT NULL DEFAULT 'SCHEDULED'
+        CHECK (schedule_relationship IN ('SCHEDULED', 'ADDED', 'UNSCHEDULED', 'CANCELED', 'REPLACEMENT', 'DUPLICATED', 'DELETED')),
+    delay                 INT,
+    feed_timestamp        TIMESTAMPTZ NOT NULL,
+    updated_at            TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (agency_id, trip_id, service_date)
+);
+
+CREATE INDEX idx_trip_update_updated ON trip_update(updated_at);
+
+-- Per-stop predictions, with delays already propagated to downstream stops
+-- so readers can join on (agency_id, trip_id, stop_sequence) directly
+CREATE TABLE stop_time_update (
+    agency_id             TEXT NOT NULL,
+    trip_id               TEXT NOT NULL,
+    service_date          DATE NOT NULL,
+    stop_sequence         INT NOT NULL,
+    stop_id               TEXT NOT NULL,
+    arrival_delay         INT,
+    departure_delay       INT,
+    schedule_relationship TEXT NOT NULL DEFAULT 'SCHEDULED'
+        CHECK (schedule_relationship IN ('SCHEDULED', 'SKIPPED')),
+    updated_at            TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (agency_id, trip_id, service_date, stop_sequence),
+    FOREIGN KEY (agency_id, trip_id, service_date)
+        REFERENCES trip_update(agency_id, trip_id, service_date) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_stop_time_update_stop ON stop_time_update(stop_id, service_date);
+
+COMMENT ON TABLE trip_update IS 'Latest GTFS-Realtime TripUpdate per trip and service day';
+COMMENT ON TABLE stop_time_update IS 'Predicted arrival/departure delays per scheduled stop';
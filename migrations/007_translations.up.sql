@@ -0,0 +1,16 @@
+-- Localized stop and route names imported from GTFS translations.txt
+-- Keyed the way GTFS keys them so rows map 1:1 onto the feed
+CREATE TABLE translation (
+    table_name  TEXT NOT NULL CHECK (table_name IN ('stops', 'routes')),
+    field_name  TEXT NOT NULL,
+    language    TEXT NOT NULL,
+    record_id   TEXT NOT NULL,
+    translation TEXT NOT NULL,
+    agency_id   TEXT NOT NULL,
+    PRIMARY KEY (table_name, field_name, language, record_id)
+);
+
+CREATE INDEX idx_translation_lookup ON translation(language, table_name, record_id);
+
+COMMENT ON TABLE translation IS 'Per-language stop/route names from GTFS translations.txt';
+COMMENT ON COLUMN translation.language IS 'Lowercase primary language subtag (fr, wo, en)';
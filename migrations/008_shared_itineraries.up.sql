@@ -0,0 +1,20 @@
+-- Itineraries shared by link: a computed route stored under a short token
+-- The itinerary is kept as returned at creation so shared links stay stable
+-- across graph rebuilds; rows past expires_at are no longer served
+CREATE TABLE shared_itinerary (
+    token          TEXT PRIMARY KEY,
+    from_lat       DOUBLE PRECISION NOT NULL,
+    from_lon       DOUBLE PRECISION NOT NULL,
+    to_lat         DOUBLE PRECISION NOT NULL,
+    to_lon         DOUBLE PRECISION NOT NULL,
+    strategy       TEXT NOT NULL,
+    departure_time TEXT NOT NULL,
+    itinerary      JSONB NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at     TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_shared_itinerary_expires ON shared_itinerary(expires_at);
+
+COMMENT ON TABLE shared_itinerary IS 'Trip plans shared through /v2/itineraries/:token';
+COMMENT ON COLUMN shared_itinerary.itinerary IS 'RouteResult without alerts; names in the default language';
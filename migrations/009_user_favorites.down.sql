@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS user_favorite_route;
+DROP TABLE IF EXISTS user_favorite_stop;
+DROP TABLE IF EXISTS user_place;
@@ -0,0 +1,36 @@
+-- Rider data saved by partner apps: home/work places and favorite stops and lines
+-- Riders are identified by an opaque user_ref chosen by the partner (X-User-ID),
+-- so PassBi never stores end-user accounts or personal identifiers.
+-- Stop and route IDs are not foreign keys: favorites survive GTFS re-imports
+-- and dangling entries are simply not returned.
+
+CREATE TABLE user_place (
+    partner_id UUID NOT NULL REFERENCES partner(id) ON DELETE CASCADE,
+    user_ref   TEXT NOT NULL,
+    kind       TEXT NOT NULL CHECK (kind IN ('home', 'work')),
+    label      TEXT,
+    lat        DOUBLE PRECISION NOT NULL CHECK (lat BETWEEN -90 AND 90),
+    lon        DOUBLE PRECISION NOT NULL CHECK (lon BETWEEN -180 AND 180),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (partner_id, user_ref, kind)
+);
+
+CREATE TABLE user_favorite_stop (
+    partner_id UUID NOT NULL REFERENCES partner(id) ON DELETE CASCADE,
+    user_ref   TEXT NOT NULL,
+    stop_id    TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (partner_id, user_ref, stop_id)
+);
+
+CREATE TABLE user_favorite_route (
+    partner_id UUID NOT NULL REFERENCES partner(id) ON DELETE CASCADE,
+    user_ref   TEXT NOT NULL,
+    route_id   TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (partner_id, user_ref, route_id)
+);
+
+COMMENT ON TABLE user_place IS 'Saved home/work coordinates of a partner app user';
+COMMENT ON TABLE user_favorite_stop IS 'Favorite stops of a partner app user';
+COMMENT ON TABLE user_favorite_route IS 'Favorite lines of a partner app user';
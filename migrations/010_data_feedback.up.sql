@@ -0,0 +1,39 @@
+-- Crowdsourced reports of wrong or missing transit data, triaged by the data team
+-- Geo context (distance to the reported stop, nearest known stop) is computed
+-- when the report is stored so triage does not depend on later re-imports
+CREATE TABLE data_feedback (
+    id                           BIGSERIAL PRIMARY KEY,
+    kind                         TEXT NOT NULL CHECK (kind IN
+        ('wrong_stop_location', 'missing_stop', 'missing_line', 'incorrect_time', 'other')),
+    description                  TEXT NOT NULL,
+    stop_id                      TEXT,
+    route_id                     TEXT,
+    trip_id                      TEXT,
+    lat                          DOUBLE PRECISION CHECK (lat BETWEEN -90 AND 90),
+    lon                          DOUBLE PRECISION CHECK (lon BETWEEN -180 AND 180),
+    geom                         GEOGRAPHY(Point, 4326),
+    stop_distance_meters         INT,
+    nearest_stop_id              TEXT,
+    nearest_stop_distance_meters INT,
+    contact                      TEXT,
+    partner_id                   UUID REFERENCES partner(id) ON DELETE SET NULL,
+    status                       TEXT NOT NULL DEFAULT 'new'
+        CHECK (status IN ('new', 'triaged', 'resolved', 'rejected')),
+    triage_note                  TEXT,
+    created_at                   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at                   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT data_feedback_location_check CHECK ((lat IS NULL) = (lon IS NULL))
+);
+
+CREATE INDEX idx_data_feedback_status ON data_feedback(status, created_at DESC);
+CREATE INDEX idx_data_feedback_stop ON data_feedback(stop_id) WHERE stop_id IS NOT NULL;
+CREATE INDEX idx_data_feedback_route ON data_feedback(route_id) WHERE route_id IS NOT NULL;
+CREATE INDEX idx_data_feedback_geom ON data_feedback USING GIST (geom);
+
+CREATE TRIGGER update_data_feedback_updated_at
+    BEFORE UPDATE ON data_feedback
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE data_feedback IS 'Rider/partner reports of wrong stop locations, missing lines or incorrect times';
+COMMENT ON COLUMN data_feedback.stop_distance_meters IS 'Distance between the reported location and the stored stop position';
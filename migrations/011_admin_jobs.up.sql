@@ -0,0 +1,23 @@
+-- Long-running admin operations (GTFS imports, graph rebuilds) run in the
+-- background; this table lets admins follow their progress and outcome
+CREATE TABLE admin_job (
+    id           UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind         TEXT NOT NULL,
+    status       TEXT NOT NULL DEFAULT 'queued'
+        CHECK (status IN ('queued', 'running', 'succeeded', 'failed')),
+    params       JSONB NOT NULL DEFAULT '{}',
+    step         TEXT,
+    progress     INT NOT NULL DEFAULT 0 CHECK (progress BETWEEN 0 AND 100),
+    result       JSONB,
+    error        TEXT,
+    partner_id   UUID REFERENCES partner(id) ON DELETE SET NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at   TIMESTAMPTZ,
+    finished_at  TIMESTAMPTZ
+);
+
+CREATE INDEX idx_admin_job_kind ON admin_job(kind, created_at DESC);
+CREATE INDEX idx_admin_job_active ON admin_job(status) WHERE status IN ('queued', 'running');
+
+COMMENT ON TABLE admin_job IS 'Background admin jobs such as GTFS imports and graph rebuilds';
+COMMENT ON COLUMN admin_job.progress IS 'Completion percentage reported by the running job';
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_usage_request_id;
+ALTER TABLE usage_log DROP COLUMN IF EXISTS request_id;
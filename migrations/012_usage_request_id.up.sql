@@ -0,0 +1,7 @@
+-- Every response carries an X-Request-ID; storing it on usage_log lets
+-- support find the exact request a partner reports as failing
+ALTER TABLE usage_log ADD COLUMN request_id VARCHAR(128);
+
+CREATE INDEX idx_usage_request_id ON usage_log(request_id) WHERE request_id IS NOT NULL;
+
+COMMENT ON COLUMN usage_log.request_id IS 'X-Request-ID sent to the client for this request';
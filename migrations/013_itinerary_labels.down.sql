@@ -0,0 +1,3 @@
+ALTER TABLE shared_itinerary
+    DROP COLUMN IF EXISTS from_label,
+    DROP COLUMN IF EXISTS to_label;
@@ -0,0 +1,5 @@
+-- Human-readable origin/destination labels (landmark, neighborhood or stop)
+-- so shared and printed itineraries do not show bare coordinates
+ALTER TABLE shared_itinerary
+    ADD COLUMN from_label TEXT,
+    ADD COLUMN to_label   TEXT;
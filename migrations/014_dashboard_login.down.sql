@@ -0,0 +1,3 @@
+ALTER TABLE partner
+    DROP COLUMN IF EXISTS password_hash,
+    DROP COLUMN IF EXISTS password_updated_at;
@@ -0,0 +1,5 @@
+-- Email/password login for the partner dashboard, which issues short-lived
+-- session tokens so partners do not paste API keys into a browser
+ALTER TABLE partner
+    ADD COLUMN password_hash       VARCHAR(255),
+    ADD COLUMN password_updated_at TIMESTAMP;
@@ -0,0 +1,4 @@
+DELETE FROM api_key WHERE kind = 'oauth_client';
+ALTER TABLE api_key
+    DROP CONSTRAINT IF EXISTS api_key_kind_check,
+    DROP COLUMN IF EXISTS kind;
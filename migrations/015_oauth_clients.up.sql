@@ -0,0 +1,6 @@
+-- OAuth2 client-credentials clients are api_key rows of kind oauth_client:
+-- their secret (cs_...) is hashed like a key, but is only accepted by
+-- POST /oauth/token in exchange for a short-lived access token
+ALTER TABLE api_key
+    ADD COLUMN kind VARCHAR(20) NOT NULL DEFAULT 'api_key',
+    ADD CONSTRAINT api_key_kind_check CHECK (kind IN ('api_key', 'oauth_client'));
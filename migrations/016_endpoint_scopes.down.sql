@@ -0,0 +1,3 @@
+-- Scopes granted by the up migration are kept; they are harmless unenforced
+ALTER TABLE api_key
+    ALTER COLUMN scopes SET DEFAULT ARRAY['read:routes'];
@@ -0,0 +1,12 @@
+-- Scopes are now enforced per endpoint. Existing keys could call every
+-- partner endpoint, so they keep that access; new keys default to read access
+UPDATE api_key
+SET scopes = ARRAY(
+    SELECT DISTINCT unnest(scopes || ARRAY[
+        'read:routes', 'read:departures', 'read:users', 'write:users', 'write:feedback'
+    ])
+    ORDER BY 1
+);
+
+ALTER TABLE api_key
+    ALTER COLUMN scopes SET DEFAULT ARRAY['read:routes', 'read:departures'];
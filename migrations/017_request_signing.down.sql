@@ -0,0 +1,3 @@
+ALTER TABLE api_key
+    DROP COLUMN IF EXISTS signing_secret,
+    DROP COLUMN IF EXISTS require_signature;
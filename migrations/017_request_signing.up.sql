@@ -0,0 +1,6 @@
+-- Optional HMAC request signing. The secret must be readable to verify
+-- signatures, so unlike key_hash it is stored as issued; once set, requests
+-- with the key are rejected unless signed
+ALTER TABLE api_key
+    ADD COLUMN signing_secret VARCHAR(100),
+    ADD COLUMN require_signature BOOLEAN NOT NULL DEFAULT false;
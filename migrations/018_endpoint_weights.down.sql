@@ -0,0 +1 @@
+ALTER TABLE tier_config DROP COLUMN IF EXISTS endpoint_weights;
@@ -0,0 +1,13 @@
+-- Expensive endpoints consume more of the daily and monthly quotas
+-- endpoint_weights maps "METHOD /path" (without the /v2 or /v3 prefix) to the
+-- units a request costs; endpoints not listed cost 1
+ALTER TABLE tier_config
+    ADD COLUMN endpoint_weights JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+UPDATE tier_config SET endpoint_weights = '{"GET /route-search": 5, "POST /itineraries": 5, "GET /routes": 3, "GET /siri/stop-monitoring": 2}'::jsonb
+WHERE tier IN ('free', 'starter');
+
+UPDATE tier_config SET endpoint_weights = '{"GET /route-search": 3, "POST /itineraries": 3, "GET /routes": 2}'::jsonb
+WHERE tier = 'business';
+
+COMMENT ON COLUMN tier_config.endpoint_weights IS 'Quota units per request by endpoint ("GET /route-search": 5); unlisted endpoints cost 1';
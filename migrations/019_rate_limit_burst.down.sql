@@ -0,0 +1,2 @@
+ALTER TABLE partner DROP COLUMN IF EXISTS rate_limit_burst;
+ALTER TABLE tier_config DROP COLUMN IF EXISTS rate_limit_burst;
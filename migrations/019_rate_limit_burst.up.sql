@@ -0,0 +1,22 @@
+-- The per-second limit is a token bucket refilled at rate_limit_per_second
+-- rate_limit_burst is how many requests may be sent at once; below
+-- rate_limit_per_second (the default 0) it is one second's worth
+ALTER TABLE tier_config
+    ADD COLUMN rate_limit_burst INT NOT NULL DEFAULT 0;
+
+ALTER TABLE partner
+    ADD COLUMN rate_limit_burst INT NOT NULL DEFAULT 0;
+
+UPDATE tier_config SET rate_limit_burst = CASE tier
+    WHEN 'free' THEN 5
+    WHEN 'starter' THEN 20
+    WHEN 'business' THEN 100
+    WHEN 'enterprise' THEN 2000
+END;
+
+UPDATE partner p
+SET rate_limit_burst = tc.rate_limit_burst
+FROM tier_config tc
+WHERE tc.tier = p.tier;
+
+COMMENT ON COLUMN partner.rate_limit_burst IS 'Token bucket capacity: requests allowed at once, refilled at rate_limit_per_second';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS invoice_line;
+DROP TABLE IF EXISTS invoice;
+ALTER TABLE tier_config DROP COLUMN IF EXISTS overage_cents_per_1000;
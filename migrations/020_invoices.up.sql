@@ -0,0 +1,50 @@
+-- Monthly invoices: the tier's base price plus overage on the quota units
+-- (requests weighted by endpoint) used beyond the monthly limit
+ALTER TABLE tier_config
+    ADD COLUMN overage_cents_per_1000 INT NOT NULL DEFAULT 0;
+
+UPDATE tier_config SET overage_cents_per_1000 = CASE tier
+    WHEN 'starter' THEN 50
+    WHEN 'business' THEN 30
+    ELSE 0
+END;
+
+CREATE TABLE invoice (
+    id BIGSERIAL PRIMARY KEY,
+    partner_id UUID NOT NULL REFERENCES partner(id) ON DELETE CASCADE,
+    period_start DATE NOT NULL,
+    period_end DATE NOT NULL,
+    tier VARCHAR(50) NOT NULL,
+
+    requests_count BIGINT NOT NULL DEFAULT 0,
+    successful_requests BIGINT NOT NULL DEFAULT 0,
+    failed_requests BIGINT NOT NULL DEFAULT 0,
+
+    units BIGINT NOT NULL DEFAULT 0,
+    included_units BIGINT NOT NULL DEFAULT -1,
+    overage_units BIGINT NOT NULL DEFAULT 0,
+
+    base_cents BIGINT NOT NULL DEFAULT 0,
+    overage_cents BIGINT NOT NULL DEFAULT 0,
+    total_cents BIGINT NOT NULL DEFAULT 0,
+
+    generated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+    UNIQUE (partner_id, period_start)
+);
+
+CREATE INDEX idx_invoice_period ON invoice(period_start);
+
+CREATE TABLE invoice_line (
+    invoice_id BIGINT NOT NULL REFERENCES invoice(id) ON DELETE CASCADE,
+    method VARCHAR(10) NOT NULL,
+    endpoint VARCHAR(255) NOT NULL,
+    requests BIGINT NOT NULL,
+    weight INT NOT NULL,
+    units BIGINT NOT NULL,
+
+    PRIMARY KEY (invoice_id, method, endpoint)
+);
+
+COMMENT ON TABLE invoice IS 'Monthly partner bills generated from quota_usage and usage_log';
+COMMENT ON COLUMN invoice.included_units IS 'Monthly quota in units; -1 when unlimited';
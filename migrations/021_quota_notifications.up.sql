@@ -0,0 +1,15 @@
+-- Partners are told by webhook and/or email when a request takes their daily
+-- or monthly quota past 80% or 100%; partners without a row get emails only
+CREATE TABLE quota_notification_settings (
+    partner_id UUID PRIMARY KEY REFERENCES partner(id) ON DELETE CASCADE,
+    webhook_url TEXT,
+    webhook_secret VARCHAR(100),
+    email VARCHAR(255),
+    email_enabled BOOLEAN NOT NULL DEFAULT true,
+    thresholds INT[] NOT NULL DEFAULT ARRAY[80, 100],
+    windows TEXT[] NOT NULL DEFAULT ARRAY['day', 'month'],
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON COLUMN quota_notification_settings.email IS 'Recipient of quota emails; the partner email when NULL';
+COMMENT ON COLUMN quota_notification_settings.webhook_secret IS 'Key of the X-PassBi-Webhook-Signature HMAC';
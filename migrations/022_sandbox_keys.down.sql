@@ -0,0 +1,3 @@
+ALTER TABLE usage_log DROP COLUMN IF EXISTS sandbox;
+ALTER TABLE api_key DROP CONSTRAINT IF EXISTS api_key_environment_check;
+ALTER TABLE api_key DROP COLUMN IF EXISTS environment;
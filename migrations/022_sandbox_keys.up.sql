@@ -0,0 +1,14 @@
+-- Test keys (pk_test_, cs_test_) are sandbox keys: fixed generous limits
+-- counted apart from the partner's quotas, and never billed
+ALTER TABLE api_key
+    ADD COLUMN environment VARCHAR(10) NOT NULL DEFAULT 'live',
+    ADD CONSTRAINT api_key_environment_check CHECK (environment IN ('live', 'test'));
+
+UPDATE api_key SET environment = 'test'
+WHERE key_prefix LIKE 'pk\_test\_%' OR key_prefix LIKE 'cs\_test\_%';
+
+ALTER TABLE usage_log
+    ADD COLUMN sandbox BOOLEAN NOT NULL DEFAULT false;
+
+COMMENT ON COLUMN api_key.environment IS 'live, or test for sandbox keys';
+COMMENT ON COLUMN usage_log.sandbox IS 'Request made with a sandbox key; not counted in quota_usage or invoices';
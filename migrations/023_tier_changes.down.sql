@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS partner_tier_change;
+ALTER TABLE partner
+    DROP COLUMN IF EXISTS prorated_month_limit,
+    DROP COLUMN IF EXISTS prorated_month;
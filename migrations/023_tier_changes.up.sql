@@ -0,0 +1,20 @@
+-- Partners change tier from the dashboard or through an admin; the new rate
+-- limits apply at once, and the month of the change gets a prorated quota
+ALTER TABLE partner
+    ADD COLUMN prorated_month DATE,
+    ADD COLUMN prorated_month_limit INT;
+
+CREATE TABLE partner_tier_change (
+    id BIGSERIAL PRIMARY KEY,
+    partner_id UUID NOT NULL REFERENCES partner(id) ON DELETE CASCADE,
+    from_tier VARCHAR(50) NOT NULL,
+    to_tier VARCHAR(50) NOT NULL,
+    changed_by VARCHAR(20) NOT NULL,
+    changed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT partner_tier_change_by_check CHECK (changed_by IN ('partner', 'admin'))
+);
+
+CREATE INDEX idx_partner_tier_change_partner ON partner_tier_change(partner_id, changed_at DESC);
+
+COMMENT ON COLUMN partner.prorated_month_limit IS 'Monthly quota of prorated_month, blending the old and new tier by days left';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS impersonation_audit;
+DROP TABLE IF EXISTS impersonation;
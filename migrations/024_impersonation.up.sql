@@ -0,0 +1,31 @@
+-- Admins act on behalf of a partner with short-lived impersonation tokens;
+-- each impersonation and every request made with it is kept for audit
+CREATE TABLE impersonation (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    partner_id UUID NOT NULL REFERENCES partner(id) ON DELETE CASCADE,
+    api_key_id UUID REFERENCES api_key(id) ON DELETE SET NULL,
+    admin_key_id UUID REFERENCES api_key(id) ON DELETE SET NULL,
+    admin_email VARCHAR(255) NOT NULL,
+    reason TEXT NOT NULL,
+    started_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP
+);
+
+CREATE INDEX idx_impersonation_partner ON impersonation(partner_id, started_at DESC);
+
+CREATE TABLE impersonation_audit (
+    id BIGSERIAL PRIMARY KEY,
+    impersonation_id UUID NOT NULL REFERENCES impersonation(id) ON DELETE CASCADE,
+    method VARCHAR(10) NOT NULL,
+    path TEXT NOT NULL,
+    status INT NOT NULL,
+    request_id VARCHAR(128),
+    ip_address INET,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_impersonation_audit_impersonation ON impersonation_audit(impersonation_id, created_at);
+
+COMMENT ON COLUMN impersonation.api_key_id IS 'Key the token acts as on /v2 and /v3; dashboard only when NULL';
+COMMENT ON COLUMN impersonation.admin_email IS 'Email of the partner owning the admin key, kept if the key is deleted';
@@ -0,0 +1,6 @@
+-- Keys can be restricted to some agencies' data, for data licenses covering
+-- one operator; routes, stops, departures and route searches are filtered
+ALTER TABLE api_key
+    ADD COLUMN allowed_agencies TEXT[];
+
+COMMENT ON COLUMN api_key.allowed_agencies IS 'route.agency_id values the key may see; every agency when NULL';
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS usage_anomaly;
+ALTER TABLE api_key DROP COLUMN IF EXISTS suspended_reason;
+ALTER TABLE api_key DROP COLUMN IF EXISTS suspended_at;
+DROP INDEX IF EXISTS idx_usage_key_timestamp;
+ALTER TABLE usage_log DROP COLUMN IF EXISTS stop_id;
@@ -0,0 +1,34 @@
+-- A background job flags keys whose traffic looks abnormal (volume spikes,
+-- stop crawls, many client IPs) and can suspend them until an admin reviews
+ALTER TABLE usage_log
+    ADD COLUMN stop_id VARCHAR(255);
+
+CREATE INDEX idx_usage_key_timestamp ON usage_log(api_key_id, timestamp DESC);
+
+ALTER TABLE api_key
+    ADD COLUMN suspended_at TIMESTAMP,
+    ADD COLUMN suspended_reason TEXT;
+
+CREATE TABLE usage_anomaly (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    partner_id UUID NOT NULL REFERENCES partner(id) ON DELETE CASCADE,
+    api_key_id UUID NOT NULL REFERENCES api_key(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('volume_spike', 'stop_crawl', 'many_ips')),
+    details JSONB NOT NULL DEFAULT '{}',
+    window_start TIMESTAMP NOT NULL,
+    window_end TIMESTAMP NOT NULL,
+    key_suspended BOOLEAN NOT NULL DEFAULT false,
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'dismissed', 'confirmed')),
+    review_note TEXT,
+    reviewed_by VARCHAR(255),
+    reviewed_at TIMESTAMP,
+    detected_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- One open anomaly per key and kind; detection runs repeat without duplicating it
+CREATE UNIQUE INDEX idx_usage_anomaly_open ON usage_anomaly(api_key_id, kind) WHERE status = 'open';
+CREATE INDEX idx_usage_anomaly_detected ON usage_anomaly(detected_at DESC);
+
+COMMENT ON COLUMN usage_log.stop_id IS 'Stop of /stops/:id requests, to detect crawls';
+COMMENT ON COLUMN api_key.suspended_at IS 'Set when an anomaly suspends the key; the key is refused until cleared';
+COMMENT ON COLUMN usage_anomaly.details IS 'Measurements that triggered the anomaly';
@@ -0,0 +1,11 @@
+ALTER TABLE partner
+    ADD COLUMN password_hash       VARCHAR(255),
+    ADD COLUMN password_updated_at TIMESTAMP;
+
+-- Partners keep the password of the owner using the partner's email
+UPDATE partner p
+SET password_hash = u.password_hash, password_updated_at = u.password_updated_at
+FROM partner_user u
+WHERE u.partner_id = p.id AND lower(u.email) = lower(p.email);
+
+DROP TABLE IF EXISTS partner_user;
@@ -0,0 +1,32 @@
+-- A partner account has several dashboard users, each with a role governing
+-- what they can do, instead of one login shared by the whole team
+CREATE TABLE partner_user (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    partner_id UUID NOT NULL REFERENCES partner(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    name VARCHAR(255),
+    role VARCHAR(20) NOT NULL CHECK (role IN ('owner', 'developer', 'billing', 'read_only')),
+    password_hash VARCHAR(255),
+    password_updated_at TIMESTAMP,
+    invite_token_hash VARCHAR(64) UNIQUE,
+    invite_expires_at TIMESTAMP,
+    invited_by UUID REFERENCES partner_user(id) ON DELETE SET NULL,
+    last_login_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- An email logs in to one partner
+CREATE UNIQUE INDEX idx_partner_user_email ON partner_user(lower(email));
+CREATE INDEX idx_partner_user_partner ON partner_user(partner_id);
+
+-- The existing shared login becomes the partner's owner
+INSERT INTO partner_user (partner_id, email, name, role, password_hash, password_updated_at)
+SELECT id, email, name, 'owner', password_hash, password_updated_at
+FROM partner;
+
+ALTER TABLE partner
+    DROP COLUMN password_hash,
+    DROP COLUMN password_updated_at;
+
+COMMENT ON COLUMN partner_user.invite_token_hash IS 'SHA-256 of the pending invitation token; NULL once accepted';
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_api_key_expires_at;
+DROP TABLE IF EXISTS api_key_expiry_reminder;
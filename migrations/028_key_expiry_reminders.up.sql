@@ -0,0 +1,11 @@
+-- Partners are reminded 14, 3 and 0 days before an API key expires; each
+-- reminder is sent once per expiry date, so extending a key re-arms them
+CREATE TABLE api_key_expiry_reminder (
+    api_key_id UUID NOT NULL REFERENCES api_key(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    days_before INT NOT NULL,
+    sent_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (api_key_id, expires_at, days_before)
+);
+
+CREATE INDEX idx_api_key_expires_at ON api_key(expires_at) WHERE expires_at IS NOT NULL;
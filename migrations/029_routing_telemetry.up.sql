@@ -0,0 +1,27 @@
+-- A sample of route searches (ROUTING_TELEMETRY_SAMPLE) with how much of the
+-- graph each explored, so MAX_EXPLORED_NODES and the stop snapping radius
+-- can be tuned from real traffic. Rows older than 30 days are pruned
+CREATE TABLE routing_search_sample (
+    id BIGSERIAL PRIMARY KEY,
+    strategy VARCHAR(50) NOT NULL,
+    from_lat DOUBLE PRECISION NOT NULL,
+    from_lon DOUBLE PRECISION NOT NULL,
+    to_lat DOUBLE PRECISION NOT NULL,
+    to_lon DOUBLE PRECISION NOT NULL,
+    outcome VARCHAR(20) NOT NULL,
+    explored_nodes INT NOT NULL,
+    peak_queue INT NOT NULL,
+    max_explored_nodes INT NOT NULL,
+    start_nodes INT NOT NULL,
+    goal_nodes INT NOT NULL,
+    start_snap_m INT,
+    goal_snap_m INT,
+    duration_ms INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_routing_search_sample_created ON routing_search_sample(created_at);
+
+COMMENT ON COLUMN routing_search_sample.outcome IS 'found, no_path, node_limit, timeout, no_start or no_goal';
+COMMENT ON COLUMN routing_search_sample.peak_queue IS 'Largest A* open set during the search';
+COMMENT ON COLUMN routing_search_sample.start_snap_m IS 'Meters from the origin to the nearest start node';
@@ -0,0 +1,7 @@
+ALTER TABLE import_log
+    DROP COLUMN IF EXISTS trips_count,
+    DROP COLUMN IF EXISTS stop_times_count,
+    DROP COLUMN IF EXISTS stops_invalid,
+    DROP COLUMN IF EXISTS stops_merged,
+    DROP COLUMN IF EXISTS phases,
+    DROP COLUMN IF EXISTS failure_reason;
@@ -0,0 +1,15 @@
+-- Keep the size and timing of each import, so regressions in feed size or
+-- import performance can be followed across imports (the importer CLI exits
+-- before its metrics can be scraped)
+ALTER TABLE import_log
+    ADD COLUMN trips_count INT DEFAULT 0,
+    ADD COLUMN stop_times_count INT DEFAULT 0,
+    ADD COLUMN stops_invalid INT DEFAULT 0,
+    ADD COLUMN stops_merged INT DEFAULT 0,
+    ADD COLUMN phases JSONB,
+    ADD COLUMN failure_reason TEXT;
+
+COMMENT ON COLUMN import_log.stops_invalid IS 'Stops dropped for invalid coordinates';
+COMMENT ON COLUMN import_log.stops_merged IS 'Stops merged into a nearby stop by deduplication';
+COMMENT ON COLUMN import_log.phases IS 'Duration, rows and rows/s of each import phase';
+COMMENT ON COLUMN import_log.failure_reason IS 'Phase a failed import stopped in, or canceled / timeout';
@@ -0,0 +1,19 @@
+-- Route searches that returned no itinerary, for network planning
+-- Origins and destinations are snapped to a 0.005 degree grid (about 550 m)
+-- and counted per day, so no individual search or address is stored
+-- Rows older than a year are pruned
+CREATE TABLE route_gap (
+    day DATE NOT NULL,
+    from_lat DOUBLE PRECISION NOT NULL,
+    from_lon DOUBLE PRECISION NOT NULL,
+    to_lat DOUBLE PRECISION NOT NULL,
+    to_lon DOUBLE PRECISION NOT NULL,
+    reason VARCHAR(30) NOT NULL,
+    searches INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, from_lat, from_lon, to_lat, to_lon, reason)
+);
+
+CREATE INDEX idx_route_gap_day ON route_gap(day);
+
+COMMENT ON TABLE route_gap IS 'Daily counts of route searches without an itinerary, per pair of grid cells';
+COMMENT ON COLUMN route_gap.reason IS 'no_origin_stop, no_destination_stop, no_path or search_limit';
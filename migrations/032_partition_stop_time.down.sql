@@ -0,0 +1,37 @@
+DROP FUNCTION IF EXISTS swap_stop_time_partition(TEXT);
+DROP FUNCTION IF EXISTS stage_stop_time_partition(TEXT);
+
+ALTER TABLE stop_time RENAME TO stop_time_partitioned;
+ALTER INDEX idx_stop_time_stop RENAME TO idx_stop_time_stop_partitioned;
+ALTER INDEX idx_stop_time_stop_departure RENAME TO idx_stop_time_stop_departure_partitioned;
+ALTER INDEX idx_stop_time_trip_seq RENAME TO idx_stop_time_trip_seq_partitioned;
+ALTER INDEX stop_time_pkey RENAME TO stop_time_partitioned_pkey;
+
+CREATE TABLE stop_time (
+    id                BIGSERIAL PRIMARY KEY,
+    trip_id           TEXT NOT NULL,
+    agency_id         TEXT NOT NULL,
+    stop_id           TEXT NOT NULL REFERENCES stop(id) ON DELETE CASCADE,
+    stop_sequence     INT NOT NULL,
+    arrival_time      TEXT,
+    departure_time    TEXT,
+    arrival_seconds   INT,
+    departure_seconds INT,
+    created_at        TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE (agency_id, trip_id, stop_sequence)
+);
+
+INSERT INTO stop_time (trip_id, agency_id, stop_id, stop_sequence,
+    arrival_time, departure_time, arrival_seconds, departure_seconds, created_at)
+SELECT trip_id, agency_id, stop_id, stop_sequence,
+    arrival_time, departure_time, arrival_seconds, departure_seconds, created_at
+FROM stop_time_partitioned;
+
+DROP TABLE stop_time_partitioned;
+DROP FUNCTION IF EXISTS stop_time_partition(TEXT);
+
+CREATE INDEX idx_stop_time_trip ON stop_time(trip_id);
+CREATE INDEX idx_stop_time_stop ON stop_time(stop_id);
+CREATE INDEX idx_stop_time_agency ON stop_time(agency_id);
+CREATE INDEX idx_stop_time_stop_departure ON stop_time(stop_id, departure_seconds);
+CREATE INDEX idx_stop_time_trip_seq ON stop_time(trip_id, stop_sequence);
@@ -0,0 +1,111 @@
+-- Partition stop_time by agency
+-- Each agency's stop_times live in their own partition, so a reimport replaces
+-- one partition instead of upserting millions of rows, and queries that know
+-- the agency (joins on trip) only touch that agency's partition
+-- The unused id column is dropped: the primary key of a partitioned table
+-- must include agency_id, and (agency_id, trip_id, stop_sequence) already
+-- identifies a row
+
+-- stop_time_partition names the partition of an agency: readable, unique
+-- (md5 suffix) and short enough for the "_new" suffix of a staged reload
+CREATE FUNCTION stop_time_partition(agency TEXT) RETURNS TEXT AS $$
+    SELECT 'stop_time_'
+        || left(regexp_replace(lower(agency), '[^a-z0-9]+', '_', 'g'), 40)
+        || '_' || left(md5(agency), 8)
+$$ LANGUAGE sql IMMUTABLE;
+
+ALTER TABLE stop_time RENAME TO stop_time_unpartitioned;
+ALTER TABLE stop_time_unpartitioned
+    DROP CONSTRAINT stop_time_pkey,
+    DROP CONSTRAINT stop_time_agency_id_trip_id_stop_sequence_key;
+DROP INDEX idx_stop_time_trip;
+DROP INDEX idx_stop_time_stop;
+DROP INDEX idx_stop_time_agency;
+DROP INDEX idx_stop_time_stop_departure;
+DROP INDEX idx_stop_time_trip_seq;
+
+CREATE TABLE stop_time (
+    trip_id           TEXT NOT NULL,
+    agency_id         TEXT NOT NULL,
+    stop_id           TEXT NOT NULL REFERENCES stop(id) ON DELETE CASCADE,
+    stop_sequence     INT NOT NULL,
+    arrival_time      TEXT,
+    departure_time    TEXT,
+    arrival_seconds   INT,
+    departure_seconds INT,
+    created_at        TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (agency_id, trip_id, stop_sequence)
+) PARTITION BY LIST (agency_id);
+
+-- Rows of agencies without a partition yet (inserted by hand); the importer
+-- moves them into the agency's partition on its next import
+CREATE TABLE stop_time_default PARTITION OF stop_time DEFAULT;
+
+CREATE INDEX idx_stop_time_stop ON stop_time(stop_id);
+CREATE INDEX idx_stop_time_stop_departure ON stop_time(stop_id, departure_seconds);
+CREATE INDEX idx_stop_time_trip_seq ON stop_time(trip_id, stop_sequence);
+
+DO $$
+DECLARE
+    agency TEXT;
+BEGIN
+    FOR agency IN SELECT DISTINCT agency_id FROM stop_time_unpartitioned LOOP
+        EXECUTE format('CREATE TABLE %I PARTITION OF stop_time FOR VALUES IN (%L)',
+            stop_time_partition(agency), agency);
+    END LOOP;
+END $$;
+
+INSERT INTO stop_time (trip_id, agency_id, stop_id, stop_sequence,
+    arrival_time, departure_time, arrival_seconds, departure_seconds, created_at)
+SELECT trip_id, agency_id, stop_id, stop_sequence,
+    arrival_time, departure_time, arrival_seconds, departure_seconds, created_at
+FROM stop_time_unpartitioned;
+
+DROP TABLE stop_time_unpartitioned;
+
+-- stage_stop_time_partition creates an empty table for the next stop_times
+-- of an agency, dropping what a failed import left behind, and returns its name
+CREATE FUNCTION stage_stop_time_partition(agency TEXT) RETURNS TEXT AS $$
+DECLARE
+    staged TEXT := stop_time_partition(agency) || '_new';
+BEGIN
+    EXECUTE format('DROP TABLE IF EXISTS %I', staged);
+    EXECUTE format('CREATE TABLE %I (LIKE stop_time INCLUDING DEFAULTS, CHECK (agency_id = %L))',
+        staged, agency);
+    RETURN staged;
+END;
+$$ LANGUAGE plpgsql;
+
+-- swap_stop_time_partition replaces the agency's partition with the staged
+-- table. The staged rows are indexed and checked before stop_time is locked,
+-- so the swap itself only holds the lock for the catalog changes, and readers
+-- see either the old or the new timetable
+CREATE FUNCTION swap_stop_time_partition(agency TEXT) RETURNS VOID AS $$
+DECLARE
+    part TEXT := stop_time_partition(agency);
+    staged TEXT := stop_time_partition(agency) || '_new';
+    def TEXT;
+BEGIN
+    -- Same indexes as stop_time, so ATTACH adopts them instead of building them
+    FOR def IN
+        SELECT i.indexdef FROM pg_indexes i
+        WHERE i.schemaname = current_schema() AND i.tablename = 'stop_time'
+          AND NOT EXISTS (SELECT 1 FROM pg_constraint c
+                          WHERE c.conrelid = 'stop_time'::regclass AND c.conname = i.indexname)
+    LOOP
+        EXECUTE regexp_replace(def, 'INDEX \S+ ON ONLY \S+', format('INDEX ON %I', staged));
+    END LOOP;
+    EXECUTE format('ALTER TABLE %I ADD PRIMARY KEY (agency_id, trip_id, stop_sequence)', staged);
+    EXECUTE format('ALTER TABLE %I ADD FOREIGN KEY (stop_id) REFERENCES stop(id) ON DELETE CASCADE', staged);
+
+    IF to_regclass(quote_ident(part)) IS NOT NULL THEN
+        EXECUTE format('ALTER TABLE stop_time DETACH PARTITION %I', part);
+        EXECUTE format('DROP TABLE %I', part);
+    END IF;
+    DELETE FROM stop_time_default WHERE agency_id = agency;
+    EXECUTE format('ALTER TABLE %I RENAME TO %I', staged, part);
+    EXECUTE format('ALTER TABLE stop_time ATTACH PARTITION %I FOR VALUES IN (%L)', part, agency);
+END;
+$$ LANGUAGE plpgsql;
+
+COMMENT ON TABLE stop_time IS 'Scheduled stop_times, one partition per agency (see stop_time_partition)';
@@ -0,0 +1,26 @@
+-- GPS fixes pushed by operator systems and the driver app
+-- The latest fix of each vehicle is also kept in Redis for live maps; this
+-- table is the history, pruned after VEHICLE_POSITION_RETENTION
+CREATE TABLE vehicle_position (
+    id          BIGSERIAL PRIMARY KEY,
+    agency_id   TEXT NOT NULL,
+    vehicle_id  TEXT NOT NULL,
+    trip_id     TEXT,
+    route_id    TEXT,
+    lat         DOUBLE PRECISION NOT NULL,
+    lon         DOUBLE PRECISION NOT NULL,
+    bearing     DOUBLE PRECISION,
+    speed       DOUBLE PRECISION,
+    stop_id     TEXT,
+    recorded_at TIMESTAMPTZ NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    partner_id  UUID
+);
+
+CREATE INDEX idx_vehicle_position_route ON vehicle_position(route_id, recorded_at DESC);
+CREATE INDEX idx_vehicle_position_vehicle ON vehicle_position(agency_id, vehicle_id, recorded_at DESC);
+CREATE INDEX idx_vehicle_position_recorded ON vehicle_position(recorded_at);
+
+COMMENT ON TABLE vehicle_position IS 'History of vehicle GPS fixes pushed to POST /v2/vehicles/positions';
+COMMENT ON COLUMN vehicle_position.recorded_at IS 'Time of the fix on the vehicle';
+COMMENT ON COLUMN vehicle_position.partner_id IS 'Partner of the API key that pushed the fix';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS segment_travel_time;
+DROP TABLE IF EXISTS stop_arrival;
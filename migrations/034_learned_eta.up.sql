@@ -0,0 +1,33 @@
+-- Learned arrival predictions
+-- stop_arrival records when a vehicle pushing GPS fixes reached each stop of
+-- its trip; segment_travel_time summarizes the travel times between
+-- consecutive stops by route and hour of the day, refreshed by the learner
+CREATE TABLE stop_arrival (
+    agency_id     TEXT NOT NULL,
+    trip_id       TEXT NOT NULL,
+    service_date  DATE NOT NULL,
+    stop_sequence INT NOT NULL,
+    stop_id       TEXT NOT NULL,
+    route_id      TEXT NOT NULL,
+    vehicle_id    TEXT NOT NULL,
+    arrived_at    TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (agency_id, trip_id, service_date, stop_sequence)
+);
+
+CREATE INDEX idx_stop_arrival_date ON stop_arrival(service_date);
+
+CREATE TABLE segment_travel_time (
+    route_id      TEXT NOT NULL,
+    from_stop_id  TEXT NOT NULL,
+    to_stop_id    TEXT NOT NULL,
+    hour          SMALLINT NOT NULL CHECK (hour BETWEEN 0 AND 23),
+    samples       INT NOT NULL,
+    median_secs   INT NOT NULL,
+    p85_secs      INT NOT NULL,
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (route_id, from_stop_id, to_stop_id, hour)
+);
+
+COMMENT ON TABLE stop_arrival IS 'First GPS fix of a trip within ETA_ARRIVAL_RADIUS of each of its stops';
+COMMENT ON TABLE segment_travel_time IS 'Observed arrival-to-arrival times between consecutive stops over ETA_HISTORY';
+COMMENT ON COLUMN segment_travel_time.hour IS 'Hour of the day (UTC) the vehicle left from_stop_id';
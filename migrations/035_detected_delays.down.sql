@@ -0,0 +1,2 @@
+DELETE FROM trip_update WHERE source = 'gps';
+ALTER TABLE trip_update DROP COLUMN IF EXISTS source;
@@ -0,0 +1,7 @@
+-- Delays detected from vehicles pushing GPS fixes are stored as trip updates
+-- next to the GTFS-Realtime ones; source tells them apart so that a feed
+-- update always wins over a detected one
+ALTER TABLE trip_update ADD COLUMN source TEXT NOT NULL DEFAULT 'feed'
+    CHECK (source IN ('feed', 'gps'));
+
+COMMENT ON COLUMN trip_update.source IS 'feed for GTFS-Realtime TripUpdates, gps for delays detected from vehicle positions';
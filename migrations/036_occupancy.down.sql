@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS occupancy_band;
+DROP TABLE IF EXISTS occupancy_report;
@@ -0,0 +1,36 @@
+-- Crowding reported by drivers and riders
+-- occupancy_report keeps every report; occupancy_band summarizes them by
+-- route and half hour of the day, refreshed by the API, so departures and
+-- route search can show how full a line usually is
+CREATE TABLE occupancy_report (
+    id          BIGSERIAL PRIMARY KEY,
+    agency_id   TEXT NOT NULL,
+    trip_id     TEXT,
+    route_id    TEXT,
+    vehicle_id  TEXT,
+    stop_id     TEXT,
+    level       SMALLINT NOT NULL CHECK (level BETWEEN 0 AND 5),
+    reporter    TEXT NOT NULL CHECK (reporter IN ('driver', 'rider')),
+    reported_at TIMESTAMPTZ NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    partner_id  UUID
+);
+
+CREATE INDEX idx_occupancy_report_trip ON occupancy_report(agency_id, trip_id, reported_at DESC);
+CREATE INDEX idx_occupancy_report_route ON occupancy_report(route_id, reported_at DESC);
+CREATE INDEX idx_occupancy_report_reported ON occupancy_report(reported_at);
+
+CREATE TABLE occupancy_band (
+    route_id   TEXT NOT NULL,
+    weekend    BOOLEAN NOT NULL,
+    band       SMALLINT NOT NULL,
+    reports    INT NOT NULL,
+    level      SMALLINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (route_id, weekend, band)
+);
+
+COMMENT ON TABLE occupancy_report IS 'Occupancy reports posted to POST /v2/occupancy';
+COMMENT ON COLUMN occupancy_report.level IS '0 empty to 5 full, following GTFS-Realtime OccupancyStatus';
+COMMENT ON TABLE occupancy_band IS 'Typical occupancy of a route by band of the day, on weekdays or weekends';
+COMMENT ON COLUMN occupancy_band.band IS 'Band of the day (UTC), counted in OCCUPANCY_BAND from midnight';
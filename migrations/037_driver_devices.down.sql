@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS driver_session;
+DROP TABLE IF EXISTS driver_device;
@@ -0,0 +1,34 @@
+-- Phones of the driver app, each bound to a vehicle
+-- A device authenticates with its own token instead of a partner API key, so
+-- a lost phone can be revoked without rotating the operator's key
+CREATE TABLE driver_device (
+    id           UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    partner_id   UUID REFERENCES partner(id) ON DELETE CASCADE,
+    agency_id    TEXT NOT NULL,
+    vehicle_id   TEXT NOT NULL,
+    route_id     TEXT,
+    label        TEXT NOT NULL DEFAULT '',
+    token_hash   TEXT NOT NULL UNIQUE,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ
+);
+
+CREATE INDEX idx_driver_device_partner ON driver_device(partner_id);
+
+-- Highest ping sequence number stored per device and app session, so pings
+-- buffered offline and uploaded again are stored once
+CREATE TABLE driver_session (
+    device_id  UUID NOT NULL REFERENCES driver_device(id) ON DELETE CASCADE,
+    session    TEXT NOT NULL,
+    last_seq   BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (device_id, session)
+);
+
+CREATE INDEX idx_driver_session_updated ON driver_session(updated_at);
+
+COMMENT ON TABLE driver_device IS 'Driver app devices pushing pings to POST /driver/pings';
+COMMENT ON COLUMN driver_device.token_hash IS 'SHA-256 hex of the pd_ device token, shown once on creation';
+COMMENT ON COLUMN driver_device.route_id IS 'Route assumed for pings that name neither a trip nor a route';
+COMMENT ON TABLE driver_session IS 'Ping sequence watermark of each driver app session';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS shape;
+ALTER TABLE trip DROP COLUMN IF EXISTS shape_id;
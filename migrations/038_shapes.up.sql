@@ -0,0 +1,16 @@
+-- Shapes from shapes.txt, the path vehicles follow between stops
+-- GPS fixes are snapped to them to tell how far along its trip a vehicle is
+ALTER TABLE trip ADD COLUMN shape_id TEXT;
+
+CREATE TABLE shape (
+    shape_id   TEXT NOT NULL,
+    agency_id  TEXT NOT NULL,
+    lats       DOUBLE PRECISION[] NOT NULL,
+    lons       DOUBLE PRECISION[] NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (agency_id, shape_id),
+    CHECK (cardinality(lats) = cardinality(lons))
+);
+
+COMMENT ON TABLE shape IS 'Shapes of an agency''s feed, their points in shape_pt_sequence order';
+COMMENT ON COLUMN trip.shape_id IS 'Shape of the trip, NULL when the feed has none';
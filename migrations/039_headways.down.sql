@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS headway_alert;
+DROP TABLE IF EXISTS route_headway;
@@ -0,0 +1,35 @@
+-- Headways between consecutive vehicles of a route, measured from their
+-- positions by the API; each pass replaces the previous one
+CREATE TABLE route_headway (
+    agency_id         TEXT NOT NULL,
+    trip_id           TEXT NOT NULL,
+    route_id          TEXT NOT NULL,
+    direction         INT NOT NULL,
+    vehicle_id        TEXT NOT NULL,
+    leader_trip_id    TEXT NOT NULL,
+    leader_vehicle_id TEXT NOT NULL,
+    stop_id           TEXT NOT NULL,
+    headway_secs      INT NOT NULL,
+    scheduled_secs    INT NOT NULL,
+    status            TEXT NOT NULL CHECK (status IN ('ok', 'bunched', 'gap')),
+    observed_at       TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (agency_id, trip_id)
+);
+
+CREATE INDEX idx_route_headway_route ON route_headway(route_id);
+
+-- Routes with bunched vehicles or gaps, and the service alert riders see
+-- once the route stayed irregular long enough
+CREATE TABLE headway_alert (
+    route_id      TEXT PRIMARY KEY,
+    status        TEXT NOT NULL CHECK (status IN ('bunched', 'gap')),
+    flagged_since TIMESTAMPTZ NOT NULL,
+    alert_id      BIGINT REFERENCES service_alert(id) ON DELETE CASCADE,
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE route_headway IS 'Latest headway of each vehicle behind the one ahead of it on its route and direction';
+COMMENT ON COLUMN route_headway.stop_id IS 'Stop last passed by the vehicle, where both headways are measured';
+COMMENT ON COLUMN route_headway.headway_secs IS 'Seconds between the two vehicles passing the vehicle''s position';
+COMMENT ON COLUMN route_headway.scheduled_secs IS 'Seconds between the two trips there according to the schedule';
+COMMENT ON TABLE headway_alert IS 'Irregular routes and the alert raised for them, expired once service is regular again';
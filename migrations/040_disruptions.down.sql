@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS route_disruption;
+DROP INDEX IF EXISTS idx_service_alert_provisional;
+ALTER TABLE service_alert DROP COLUMN IF EXISTS provisional, DROP COLUMN IF EXISTS source;
@@ -0,0 +1,32 @@
+-- Alerts raised automatically are provisional until staff confirm them;
+-- source tells them apart from the ones staff write
+ALTER TABLE service_alert
+    ADD COLUMN source TEXT NOT NULL DEFAULT 'manual'
+        CHECK (source IN ('manual', 'headway', 'disruption')),
+    ADD COLUMN provisional BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE service_alert a SET source = 'headway'
+WHERE EXISTS (SELECT 1 FROM headway_alert h WHERE h.alert_id = a.id);
+
+CREATE INDEX idx_service_alert_provisional ON service_alert(created_at DESC) WHERE provisional;
+
+-- Routes found at a standstill or mostly cancelled during service hours, and
+-- the provisional alert raised for each
+-- An alert staff dismissed by deleting it leaves alert_id NULL, so the
+-- disruption is not alerted again until it is over
+CREATE TABLE route_disruption (
+    route_id    TEXT NOT NULL,
+    kind        TEXT NOT NULL CHECK (kind IN ('stalled', 'cancelled')),
+    agency_id   TEXT NOT NULL,
+    detected_at TIMESTAMPTZ NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL,
+    scheduled   INT NOT NULL,
+    affected    INT NOT NULL,
+    alert_id    BIGINT REFERENCES service_alert(id) ON DELETE SET NULL,
+    PRIMARY KEY (route_id, kind)
+);
+
+COMMENT ON COLUMN service_alert.source IS 'manual for alerts written by staff, headway or disruption for the ones raised automatically';
+COMMENT ON COLUMN service_alert.provisional IS 'Raised automatically and not yet confirmed through POST /admin/alerts/:id/confirm';
+COMMENT ON COLUMN route_disruption.scheduled IS 'Trips scheduled: running now when stalled, starting around now when cancelled';
+COMMENT ON COLUMN route_disruption.affected IS 'Vehicles seen standing still when stalled, cancelled trips when cancelled';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS vehicle_history_day;
+DROP TABLE IF EXISTS vehicle_trip_arrival;
+DROP TABLE IF EXISTS vehicle_trip_history;
@@ -0,0 +1,51 @@
+-- Archive of vehicle positions past VEHICLE_POSITION_RETENTION
+-- Once a day is over, the fixes of each trip and vehicle are downsampled into
+-- one row of parallel arrays, with the time the vehicle reached each stop
+-- taken from every fix; positions without a trip are not archived
+CREATE TABLE vehicle_trip_history (
+    agency_id    TEXT NOT NULL,
+    trip_id      TEXT NOT NULL,
+    service_date DATE NOT NULL,
+    vehicle_id   TEXT NOT NULL,
+    route_id     TEXT,
+    recorded_at  TIMESTAMPTZ[] NOT NULL,
+    lats         DOUBLE PRECISION[] NOT NULL,
+    lons         DOUBLE PRECISION[] NOT NULL,
+    speeds       DOUBLE PRECISION[] NOT NULL,
+    fixes        INT NOT NULL,
+    PRIMARY KEY (agency_id, trip_id, service_date, vehicle_id),
+    CHECK (cardinality(recorded_at) = cardinality(lats)
+       AND cardinality(lats) = cardinality(lons)
+       AND cardinality(lons) = cardinality(speeds))
+);
+
+CREATE INDEX idx_vehicle_trip_history_route ON vehicle_trip_history(route_id, service_date);
+CREATE INDEX idx_vehicle_trip_history_date ON vehicle_trip_history(service_date);
+
+CREATE TABLE vehicle_trip_arrival (
+    agency_id     TEXT NOT NULL,
+    trip_id       TEXT NOT NULL,
+    service_date  DATE NOT NULL,
+    vehicle_id    TEXT NOT NULL,
+    stop_sequence INT NOT NULL,
+    stop_id       TEXT NOT NULL,
+    arrived_at    TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (agency_id, trip_id, service_date, vehicle_id, stop_sequence)
+);
+
+CREATE INDEX idx_vehicle_trip_arrival_date ON vehicle_trip_arrival(service_date);
+
+-- Days archived, so each is archived once
+CREATE TABLE vehicle_history_day (
+    service_date DATE PRIMARY KEY,
+    trips        INT NOT NULL,
+    fixes        BIGINT NOT NULL,
+    points       BIGINT NOT NULL,
+    archived_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE vehicle_trip_history IS 'Downsampled path of a vehicle on a trip over a day (UTC), kept for HISTORY_RETENTION';
+COMMENT ON COLUMN vehicle_trip_history.speeds IS 'Speed in m/s at each point, NULL where the fix had none';
+COMMENT ON COLUMN vehicle_trip_history.fixes IS 'Fixes recorded before downsampling';
+COMMENT ON TABLE vehicle_trip_arrival IS 'First fix of a vehicle on a trip within ETA_ARRIVAL_RADIUS of each of its stops';
+COMMENT ON TABLE vehicle_history_day IS 'Days whose vehicle positions were archived';
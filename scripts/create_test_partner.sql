@@ -48,7 +48,7 @@ INSERT INTO api_key (
     'KEY_PREFIX_HERE',  -- Replace with prefix from generate_api_key.go
     'Test API Key',
     'API key for testing the partner system',
-    ARRAY['read:routes', 'read:stops'],
+    ARRAY['read:routes', 'read:departures'],
     true
 ) RETURNING id, key_prefix, created_at;
 */
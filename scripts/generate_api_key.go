@@ -31,7 +31,7 @@ func main() {
 	fmt.Println("\n⚠️  Save the API key now! You won't be able to see it again.")
 	fmt.Println("\nTo insert into database:")
 	fmt.Printf("INSERT INTO api_key (partner_id, key_hash, key_prefix, name, scopes)\n")
-	fmt.Printf("VALUES ('PARTNER_ID', '%s', '%s', 'Key Name', ARRAY['read:routes']);\n", hash, prefix)
+	fmt.Printf("VALUES ('PARTNER_ID', '%s', '%s', 'Key Name', ARRAY['read:routes', 'read:departures']);\n", hash, prefix)
 	fmt.Println("═══════════════════════════════════════════════════")
 }
 